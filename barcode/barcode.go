@@ -0,0 +1,197 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package barcode renders 1D barcodes as bilevel images and reads them back
+// from rows of pixels.
+//
+// Code 128, EAN-13, Code 39 and ITF are supported. A barcode is a row of
+// bars and spaces made of modules, the narrowest of them; it is rendered
+// with a given module width and bar height, between quiet zones, and
+// optionally with its text printed under the bars. Scan reads Code 128,
+// EAN-13 and ITF barcodes, in either direction, from the lengths of the runs
+// of pixels of each row.
+package barcode
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/font"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the text can not be coded.
+type FormatError string
+
+func (e FormatError) Error() string { return "barcode: invalid format: " + string(e) }
+
+// A Symbology is a kind of barcode.
+type Symbology int
+
+const (
+	// Code128 codes ASCII text, switching code sets as needed, with runs
+	// of digits packed in pairs.
+	Code128 Symbology = iota
+	// EAN13 codes 12 digits and a check digit, which is computed when only
+	// 12 digits are given.
+	EAN13
+	// Code39 codes digits, upper case letters and " -.$/+%".
+	Code39
+	// ITF, Interleaved 2 of 5, codes an even number of digits.
+	ITF
+)
+
+// wide is the width in modules of the wide elements of the symbologies with
+// two widths.
+const wide = 3
+
+// Options are the rendering parameters.
+type Options struct {
+	// Module is the width of a module in pixels, 2 if 0.
+	Module int
+	// Height is the height of the bars in pixels, 30 modules if 0.
+	Height int
+	// Quiet is the width of the quiet zones in modules, 10 if 0, or 11
+	// for EAN-13, which prints its first digit there.
+	Quiet int
+	// Text prints the text under the bars.
+	Text bool
+}
+
+// Bars returns the modules of the barcode of text, true for bars, without
+// quiet zones.
+func Bars(s Symbology, text string) ([]bool, error) {
+	var w []int
+	var err error
+	switch s {
+	case Code128:
+		w, err = code128(text)
+	case EAN13:
+		_, w, err = ean13(text)
+	case Code39:
+		w, err = code39(text)
+	case ITF:
+		w, err = itf(text)
+	default:
+		return nil, FormatError("unknown symbology")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return modules(w), nil
+}
+
+// modules expands the widths of alternating bars and spaces, starting with
+// a bar.
+func modules(widths []int) []bool {
+	var m []bool
+	for i, w := range widths {
+		for ; w > 0; w-- {
+			m = append(m, i%2 == 0)
+		}
+	}
+	return m
+}
+
+// Render renders the barcode of text. The image palette is {white, black}.
+func Render(s Symbology, text string, opt *Options) (*img1b.Image, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.Module <= 0 {
+		o.Module = 2
+	}
+	if o.Height <= 0 {
+		o.Height = 30 * o.Module
+	}
+	if o.Quiet <= 0 {
+		o.Quiet = 10
+		if s == EAN13 {
+			o.Quiet = 11
+		}
+	}
+	bars, err := Bars(s, text)
+	if err != nil {
+		return nil, err
+	}
+	mw := o.Module
+	w := (len(bars) + 2*o.Quiet) * mw
+	h := o.Height
+	if o.Text {
+		// A module apart, a module below.
+		h += (font.Height + 2) * mw
+	}
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	row := m.Pix[:m.Stride]
+	for x := 0; x < len(bars); {
+		if !bars[x] {
+			x++
+			continue
+		}
+		x1 := x + 1
+		for x1 < len(bars) && bars[x1] {
+			x1++
+		}
+		setBits(row, (o.Quiet+x)*mw, (o.Quiet+x1)*mw)
+		x = x1
+	}
+	for y := 1; y < o.Height; y++ {
+		copy(m.Pix[y*m.Stride:], row)
+	}
+	if !o.Text {
+		return m, nil
+	}
+	ty := o.Height + mw
+	if s != EAN13 {
+		scale := mw
+		for scale > 1 && font.TextWidth(text, scale) > w {
+			scale--
+		}
+		font.Draw(m, (w-font.TextWidth(text, scale))/2, ty, text, scale)
+		return m, nil
+	}
+
+	// EAN-13 prints the first digit left of the bars and the others in two
+	// groups of 6, between the guard bars reaching down over the text.
+	digits, _, _ := ean13(text)
+	guard := make([]bool, len(bars))
+	for _, x := range []int{0, 2, 46, 48, 92, 94} {
+		guard[x] = true
+	}
+	for y := o.Height; y < ty+font.Height*mw/2; y++ {
+		r := m.Pix[y*m.Stride:]
+		for x, g := range guard {
+			if g {
+				setBits(r, (o.Quiet+x)*mw, (o.Quiet+x+1)*mw)
+			}
+		}
+	}
+	// Each digit centered on its 7 modules.
+	pad := (7*mw - font.Width*mw) / 2
+	font.Draw(m, (o.Quiet-7)*mw+pad, ty, digits[:1], mw)
+	for i := 1; i < 13; i++ {
+		x := 3 + (i-1)*7
+		if i > 6 {
+			x += 5
+		}
+		font.Draw(m, (o.Quiet+x)*mw+pad, ty, digits[i:i+1], mw)
+	}
+	return m, nil
+}
+
+// setBits sets bits [x0, x1) of row.
+func setBits(row []byte, x0, x1 int) {
+	i0, i1 := x0/8, (x1-1)/8
+	m0 := byte(0xff) >> uint(x0%8)
+	m1 := byte(0xff) << uint(7-(x1-1)%8)
+	if i0 == i1 {
+		row[i0] |= m0 & m1
+		return
+	}
+	row[i0] |= m0
+	for i := i0 + 1; i < i1; i++ {
+		row[i] = 0xff
+	}
+	row[i1] |= m1
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+import (
+	"github.com/mi-v/img1b"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	for v, p := range code128Patterns {
+		sum := 0
+		for _, d := range p {
+			sum += int(d - '0')
+		}
+		if want := map[bool]int{false: 11, true: 13}[v == c128Stop]; sum != want {
+			t.Errorf("value %d: %d modules", v, sum)
+		}
+	}
+}
+
+func TestCode128Values(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"PJJ123C", []int{104, 48, 42, 42, 17, 18, 19, 35, 55}},
+		{"123456", []int{105, 12, 34, 56, 0}},
+		{"12345", []int{104, 17, 99, 23, 45, 0}},
+		{"AB123456CD", []int{104, 33, 34, 99, 12, 34, 56, 100, 35, 36, 0}},
+		{"A1234", []int{104, 33, 99, 12, 34, 0}},
+		{"A\tb", []int{104, 33, 101, 73, 100, 66, 0}},
+		{"", []int{104, 0}},
+	}
+	for _, tt := range tests {
+		got, err := code128Values(tt.text)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		// The check symbol.
+		sum := tt.want[0]
+		for i := 1; i < len(tt.want)-1; i++ {
+			sum += i * tt.want[i]
+		}
+		tt.want[len(tt.want)-1] = sum % 103
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEAN13(t *testing.T) {
+	digits, w, err := ean13("400638133393")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digits != "4006381333931" {
+		t.Errorf("digits %s", digits)
+	}
+	if len(modules(w)) != 95 {
+		t.Errorf("%d modules", len(modules(w)))
+	}
+	bars, _ := Bars(EAN13, "4006381333931")
+	// The start of the barcode: the guard, then 0 of odd parity and 0 of
+	// even parity, as the first digit 4 wants.
+	want := "101" + "0001101" + "0100111"
+	for i, c := range want {
+		if bars[i] != (c == '1') {
+			t.Fatalf("module %d: got %v", i, bars[i])
+		}
+	}
+	// The end: 3 and 1 on the right side, then the guard.
+	want = "1000010" + "1100110" + "101"
+	for i, c := range want {
+		if bars[95-len(want)+i] != (c == '1') {
+			t.Fatalf("module %d from the end: got %v", len(want)-i, bars[95-len(want)+i])
+		}
+	}
+}
+
+func TestCode39(t *testing.T) {
+	bars, err := Bars(Code39, "CODE39")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 8 characters of 6 narrow and 3 wide elements, with gaps.
+	if len(bars) != 8*15+7 {
+		t.Errorf("%d modules", len(bars))
+	}
+	// The start character: n w n n w n w n n.
+	want := "1000101110111010"
+	for i, c := range want {
+		if bars[i] != (c == '1') {
+			t.Fatalf("module %d: got %v", i, bars[i])
+		}
+	}
+}
+
+// black reports whether the pixel at (x, y) of m is black.
+func black(m *img1b.Image, x, y int) bool {
+	return m.At(x, y) == color.Black
+}
+
+func TestRender(t *testing.T) {
+	for _, s := range []Symbology{Code128, EAN13, Code39} {
+		text := map[Symbology]string{Code128: "Label 0042", EAN13: "400638133393", Code39: "LABEL-42"}[s]
+		bars, err := Bars(s, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range []Options{{}, {Module: 3, Height: 40, Quiet: 12, Text: true}} {
+			m, err := Render(s, text, &o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mw, q, h := 2, 10, 60
+			if o.Module != 0 {
+				mw, q, h = o.Module, o.Quiet, o.Height
+			} else if s == EAN13 {
+				q = 11
+			}
+			if m.Rect.Dx() != (len(bars)+2*q)*mw {
+				t.Errorf("%d: width %d", s, m.Rect.Dx())
+			}
+			if want := h + map[bool]int{false: 0, true: 9 * mw}[o.Text]; m.Rect.Dy() != want {
+				t.Errorf("%d: height %d, want %d", s, m.Rect.Dy(), want)
+			}
+			for y := 0; y < h; y += h - 1 {
+				for x := 0; x < m.Rect.Dx(); x++ {
+					want := false
+					if k := x/mw - q; k >= 0 && k < len(bars) {
+						want = bars[k]
+					}
+					if black(m, x, y) != want {
+						t.Fatalf("%d: pixel (%d, %d) is %v", s, x, y, !want)
+					}
+				}
+			}
+			if !o.Text {
+				continue
+			}
+			n := 0
+			for y := h + mw; y < m.Rect.Dy(); y++ {
+				for x := 0; x < m.Rect.Dx(); x++ {
+					if black(m, x, y) {
+						n++
+					}
+				}
+			}
+			if n < len(text)*4*mw*mw {
+				t.Errorf("%d: %d black pixels of text", s, n)
+			}
+			if s == EAN13 && (!black(m, (q+46)*mw, h+2*mw) || black(m, (q+44)*mw, h+2*mw)) {
+				t.Error("EAN-13 guard bars do not reach into the text")
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		s    Symbology
+		text string
+	}{
+		{Code128, "caf\xc3\xa9"},
+		{EAN13, "12345"},
+		{EAN13, "40063813339A"},
+		{EAN13, "4006381333932"},
+		{Code39, "lower"},
+		{Code39, "A*B"},
+		{Symbology(9), "1"},
+	}
+	for _, tt := range tests {
+		if _, err := Render(tt.s, tt.text, nil); err == nil {
+			t.Errorf("%d %q: no error", tt.s, tt.text)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+// code128Patterns are the widths of the bars and spaces of the Code 128
+// symbols by value, the stop symbol last.
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code 128 symbol values.
+const (
+	c128CodeC  = 99
+	c128CodeB  = 100
+	c128CodeA  = 101
+	c128StartA = 103 // then B and C
+	c128Stop   = 106
+)
+
+// digitRun returns the number of digits of s starting at i.
+func digitRun(s string, i int) int {
+	n := 0
+	for i+n < len(s) && s[i+n] >= '0' && s[i+n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// code128Values returns the symbol values of text with the start symbol
+// and the check symbol, choosing code sets for the fewest symbols: code
+// set C for runs of digits long enough to pay for the switch, A for
+// control characters and B otherwise.
+func code128Values(text string) ([]int, error) {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			return nil, FormatError("non-ASCII text")
+		}
+	}
+	var v []int
+	set := 0
+	// switchTo emits the switch, or the start symbol, to a code set.
+	switchTo := func(s int) {
+		if len(v) == 0 {
+			v = append(v, c128StartA+s-'A')
+		} else {
+			v = append(v, c128CodeA-(s-'A'))
+		}
+		set = s
+	}
+	for i := 0; i < len(text); {
+		if r := digitRun(text, i); set == 'C' && r >= 2 {
+			v = append(v, int(text[i]-'0')*10+int(text[i+1]-'0'))
+			i += 2
+			continue
+		} else if set != 'C' && r >= 2 && (i == 0 && (r == len(text) || r >= 4) || r >= 6 || i+r == len(text) && r >= 4) {
+			if r%2 == 1 {
+				// The odd digit goes first, in the current set.
+				if set == 0 {
+					switchTo('B')
+				}
+				v = append(v, int(text[i])-32)
+				i++
+			}
+			switchTo('C')
+			continue
+		}
+		c := int(text[i])
+		switch {
+		case c < 32 && set != 'A':
+			switchTo('A')
+		case c >= 96 && set != 'B':
+			switchTo('B')
+		case set == 0 || set == 'C':
+			switchTo('B')
+		}
+		if c < 32 {
+			c += 64
+		} else {
+			c -= 32
+		}
+		v = append(v, c)
+		i++
+	}
+	if len(v) == 0 {
+		switchTo('B')
+	}
+	sum := v[0]
+	for i := 1; i < len(v); i++ {
+		sum += i * v[i]
+	}
+	return append(v, sum%103), nil
+}
+
+// code128 returns the widths of the Code 128 barcode of text.
+func code128(text string) ([]int, error) {
+	v, err := code128Values(text)
+	if err != nil {
+		return nil, err
+	}
+	var w []int
+	for _, x := range append(v, c128Stop) {
+		w = append(w, widths(code128Patterns[x])...)
+	}
+	return w, nil
+}
+
+// code128Widths are code128Patterns as widths, without the stop symbol.
+var code128Widths = func() [][]int {
+	w := make([][]int, c128Stop)
+	for i := range w {
+		w[i] = widths(code128Patterns[i])
+	}
+	return w
+}()
+
+// readCode128 reads a Code 128 barcode whose first bar is run i of r and
+// returns its text and number of runs.
+func readCode128(r []int, i int) (string, int) {
+	if i+6 > len(r) || !quietBefore(r, i, 6, 11) {
+		return "", 0
+	}
+	start := bestPattern(r[i:i+6], code128Widths[c128StartA:], maxVarianceCode128)
+	if start < 0 {
+		return "", 0
+	}
+	v := []int{c128StartA + start}
+	stop := widths(code128Patterns[c128Stop])
+	j := i + 6
+	for j+7 > len(r) || variance(r[j:j+7], stop) >= maxVarianceCode128 || !quietAfter(r, j, 7, 13) {
+		if j+6 > len(r) {
+			return "", 0
+		}
+		x := bestPattern(r[j:j+6], code128Widths[:c128StartA], maxVarianceCode128)
+		if x < 0 {
+			return "", 0
+		}
+		v = append(v, x)
+		j += 6
+	}
+	if len(v) < 2 {
+		return "", 0
+	}
+	sum := v[0]
+	for k := 1; k < len(v)-1; k++ {
+		sum += k * v[k]
+	}
+	if sum%103 != v[len(v)-1] {
+		return "", 0
+	}
+	text, ok := code128Text(v[:len(v)-1])
+	if !ok {
+		return "", 0
+	}
+	return text, j + 7 - i
+}
+
+// code128Text returns the text of the symbol values, from the start symbol
+// to the check symbol. FNC1 is returned as the ASCII GS character, except
+// in the first position, where it marks GS1 data. FNC4 adds 128 to the next
+// character.
+func code128Text(v []int) (string, bool) {
+	set := v[0] - c128StartA // 0 for A, 1 for B, 2 for C
+	var b []byte
+	shift, fnc4 := false, false
+	for k, x := range v[1:] {
+		cs := set
+		if shift {
+			cs, shift = 1-set, false
+		}
+		if x == 102 {
+			if k > 0 {
+				b = append(b, 0x1d)
+			}
+			continue
+		}
+		if cs == 2 {
+			switch x {
+			case c128CodeB:
+				set = 1
+			case c128CodeA:
+				set = 0
+			default:
+				if x >= 100 {
+					return "", false
+				}
+				b = append(b, byte('0'+x/10), byte('0'+x%10))
+			}
+			continue
+		}
+		switch {
+		case x < 64 || x < 96 && cs == 1:
+			c := byte(x + 32)
+			if fnc4 {
+				c, fnc4 = c+128, false
+			}
+			b = append(b, c)
+		case x < 96:
+			c := byte(x - 64)
+			if fnc4 {
+				c, fnc4 = c+128, false
+			}
+			b = append(b, c)
+		case x == 98:
+			shift = true
+		case x == c128CodeC:
+			set = 2
+		case x == c128CodeB && cs == 0, x == c128CodeA && cs == 1:
+			set = 1 - cs
+		case x == c128CodeB, x == c128CodeA:
+			fnc4 = true
+		}
+	}
+	return string(b), true
+}
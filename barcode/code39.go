@@ -0,0 +1,49 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+import (
+	"strings"
+)
+
+// code39Chars are the characters of Code 39, and code39Patterns their
+// elements, bars and spaces from the first, a bit set for wide ones.
+const code39Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. *$/+%"
+
+var code39Patterns = [...]uint16{
+	0x034, 0x121, 0x061, 0x160, 0x031, 0x130, 0x070, 0x025, 0x124, 0x064,
+	0x109, 0x049, 0x148, 0x019, 0x118, 0x058, 0x00d, 0x10c, 0x04c, 0x01c,
+	0x103, 0x043, 0x142, 0x013, 0x112, 0x052, 0x007, 0x106, 0x046, 0x016,
+	0x181, 0x0c1, 0x1c0, 0x091, 0x190, 0x0d0, 0x085, 0x184, 0x0c4, 0x094,
+	0x0a8, 0x0a2, 0x08a, 0x02a,
+}
+
+// code39 returns the widths of the Code 39 barcode of text, between the '*'
+// start and stop characters.
+func code39(text string) ([]int, error) {
+	if strings.IndexByte(text, '*') >= 0 {
+		return nil, FormatError("'*' in Code 39 text")
+	}
+	var w []int
+	s := "*" + text + "*"
+	for i := 0; i < len(s); i++ {
+		k := strings.IndexByte(code39Chars, s[i])
+		if k < 0 {
+			return nil, FormatError("character not in Code 39")
+		}
+		if i > 0 {
+			w = append(w, 1)
+		}
+		p := code39Patterns[k]
+		for j := 8; j >= 0; j-- {
+			if p>>uint(j)&1 != 0 {
+				w = append(w, wide)
+			} else {
+				w = append(w, 1)
+			}
+		}
+	}
+	return w, nil
+}
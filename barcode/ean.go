@@ -0,0 +1,114 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+// eanL are the widths of the digits of odd parity on the left side of EAN
+// barcodes, starting with a space. Even parity digits are reversed and the
+// right side digits start with a bar.
+var eanL = [10][4]int{
+	{3, 2, 1, 1}, {2, 2, 2, 1}, {2, 1, 2, 2}, {1, 4, 1, 1}, {1, 1, 3, 2},
+	{1, 2, 3, 1}, {1, 1, 1, 4}, {1, 3, 1, 2}, {1, 2, 1, 3}, {3, 1, 1, 2},
+}
+
+// eanParity are the parities of the left digits of EAN-13 barcodes by the
+// first digit, which they code: bit 5 is for the second digit and so on, set
+// for even parity.
+var eanParity = [10]int{0x00, 0x0b, 0x0d, 0x0e, 0x13, 0x19, 0x1c, 0x15, 0x16, 0x1a}
+
+// eanCheck returns the check digit of the digits before it.
+func eanCheck(digits string) byte {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// ean13 returns the 13 digits with the check digit and the widths of the
+// EAN-13 barcode of text.
+func ean13(text string) (string, []int, error) {
+	if len(text) != 12 && len(text) != 13 || digitRun(text, 0) != len(text) {
+		return "", nil, FormatError("EAN-13 needs 12 or 13 digits")
+	}
+	c := eanCheck(text[:12])
+	if len(text) == 13 && text[12] != c {
+		return "", nil, FormatError("bad EAN-13 check digit")
+	}
+	digits := text[:12] + string(c)
+	w := []int{1, 1, 1}
+	par := eanParity[digits[0]-'0']
+	for i := 1; i < 13; i++ {
+		p := eanL[digits[i]-'0']
+		switch {
+		case i == 7:
+			w = append(w, 1, 1, 1, 1, 1)
+			fallthrough
+		case i > 7 || par>>uint(6-i)&1 == 0:
+			w = append(w, p[:]...)
+		default:
+			w = append(w, p[3], p[2], p[1], p[0])
+		}
+	}
+	return digits, append(w, 1, 1, 1), nil
+}
+
+// readEAN13 reads an EAN-13 barcode whose first bar is run i of r and
+// returns its digits and number of runs.
+func readEAN13(r []int, i int) (string, int) {
+	const n = 3 + 6*4 + 5 + 6*4 + 3
+	guard := []int{1, 1, 1}
+	if i+n > len(r) || variance(r[i:i+3], guard) >= maxVarianceEAN || !quietBefore(r, i, 3, 3) {
+		return "", 0
+	}
+	var left, right [][]int
+	for d := range eanL {
+		left = append(left, eanL[d][:])
+		right = append(right, eanL[d][:])
+	}
+	for _, p := range eanL {
+		left = append(left, []int{p[3], p[2], p[1], p[0]})
+	}
+	digits := make([]byte, 13)
+	par := 0
+	j := i + 3
+	for k := 1; k < 13; k++ {
+		if k == 7 {
+			if variance(r[j:j+5], []int{1, 1, 1, 1, 1}) >= maxVarianceEAN {
+				return "", 0
+			}
+			j += 5
+		}
+		pats := right
+		if k < 7 {
+			pats = left
+		}
+		d := bestPattern(r[j:j+4], pats, maxVarianceEAN)
+		if d < 0 {
+			return "", 0
+		}
+		if k < 7 {
+			par = par<<1 | d/10
+		}
+		digits[k] = byte('0' + d%10)
+		j += 4
+	}
+	if variance(r[j:j+3], guard) >= maxVarianceEAN || !quietAfter(r, j, 3, 3) {
+		return "", 0
+	}
+	digits[0] = 0
+	for d, p := range eanParity {
+		if p == par {
+			digits[0] = byte('0' + d)
+		}
+	}
+	if digits[0] == 0 || eanCheck(string(digits[:12])) != digits[12] {
+		return "", 0
+	}
+	return string(digits), n
+}
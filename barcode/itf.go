@@ -0,0 +1,94 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+// itfPatterns are the elements of the ITF digits, the first in bit 4, a
+// bit set for wide ones.
+var itfPatterns = [10]byte{0x06, 0x11, 0x09, 0x18, 0x05, 0x14, 0x0c, 0x03, 0x12, 0x0a}
+
+// itf returns the widths of the ITF barcode of text. Digits come in pairs,
+// the first coded by the bars and the second by the spaces between them.
+func itf(text string) ([]int, error) {
+	if len(text) == 0 || len(text)%2 != 0 || digitRun(text, 0) != len(text) {
+		return nil, FormatError("ITF needs an even number of digits")
+	}
+	w := []int{1, 1, 1, 1}
+	for i := 0; i < len(text); i += 2 {
+		a, b := itfPatterns[text[i]-'0'], itfPatterns[text[i+1]-'0']
+		for k := 4; k >= 0; k-- {
+			w = append(w, 1+(wide-1)*int(a>>uint(k)&1), 1+(wide-1)*int(b>>uint(k)&1))
+		}
+	}
+	return append(w, wide, 1, 1), nil
+}
+
+// minITF is the fewest digits of ITF barcodes read; shorter reads are
+// mostly false.
+const minITF = 6
+
+// readITF reads an ITF barcode whose first bar is run i of r and returns
+// its digits and number of runs.
+func readITF(r []int, i int) (string, int) {
+	if i+4 > len(r) || variance(r[i:i+4], []int{1, 1, 1, 1}) >= maxVarianceITF || !quietBefore(r, i, 4, 4) {
+		return "", 0
+	}
+	stop := []int{wide, 1, 1}
+	var digits []byte
+	j := i + 4
+	for j+3 > len(r) || variance(r[j:j+3], stop) >= maxVarianceITF || !quietAfter(r, j, 3, wide+2) {
+		if j+10 > len(r) {
+			return "", 0
+		}
+		var bars, spaces [5]int
+		for k := 0; k < 5; k++ {
+			bars[k], spaces[k] = r[j+2*k], r[j+2*k+1]
+		}
+		a, b := itfDigit(bars), itfDigit(spaces)
+		if a < 0 || b < 0 {
+			return "", 0
+		}
+		digits = append(digits, byte('0'+a), byte('0'+b))
+		j += 10
+	}
+	if len(digits) < minITF {
+		return "", 0
+	}
+	return string(digits), j + 3 - i
+}
+
+// itfDigit returns the digit of the widths of 5 elements, two of them wide,
+// or -1.
+func itfDigit(w [5]int) int {
+	// The two widest are wide.
+	w1, w2 := 0, 1
+	if w[w2] > w[w1] {
+		w1, w2 = w2, w1
+	}
+	for k := 2; k < 5; k++ {
+		if w[k] > w[w1] {
+			w1, w2 = k, w1
+		} else if w[k] > w[w2] {
+			w2 = k
+		}
+	}
+	var p byte
+	narrow := 0
+	for k := 0; k < 5; k++ {
+		if k == w1 || k == w2 {
+			p |= 0x10 >> uint(k)
+		} else if w[k] > narrow {
+			narrow = w[k]
+		}
+	}
+	if 2*w[w2] < 3*narrow {
+		return -1
+	}
+	for d, q := range itfPatterns {
+		if q == p {
+			return d
+		}
+	}
+	return -1
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"math"
+)
+
+// A Result is a barcode read from an image.
+type Result struct {
+	Symbology Symbology
+	Text      string
+	// Bounds spans the bars, over the rows the barcode was read in.
+	Bounds image.Rectangle
+}
+
+// minQuiet is the width in modules of the quiet zones Scan requires. The
+// symbologies ask for more, but scans are often cropped tightly.
+const minQuiet = 5
+
+// The largest mean deviations of the run lengths from a pattern, relative
+// to its length, that still match. The more redundant symbologies take
+// more.
+const (
+	maxVarianceCode128 = 0.25
+	maxVarianceEAN     = 0.48
+	maxVarianceITF     = 0.38
+)
+
+// Scan reads the Code 128, EAN-13 and ITF barcodes crossing the rows of m,
+// in the order they are first met from the top. A barcode read in several
+// rows is reported once, with the rows in its bounds. Barcodes turned
+// upside down read too.
+func Scan(m *img1b.Image) []Result {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	ink := bitmap.BlackIndex(m.Palette)
+	var res []Result
+	var runs, rev []int
+	for y := 0; y < h; y++ {
+		runs = rowRuns(runs[:0], m.Pix[y*m.Stride:], w, ink)
+		// The runs from the right, starting with white.
+		rev = rev[:0]
+		if len(runs)%2 == 0 {
+			rev = append(rev, 0)
+		}
+		for i := len(runs) - 1; i >= 0; i-- {
+			rev = append(rev, runs[i])
+		}
+		for pass, r := range [][]int{runs, rev} {
+			x := 0
+			for i := 0; i < len(r); i++ {
+				if i%2 == 1 {
+					if s, text, n := readAt(r, i); n > 0 {
+						x1 := x
+						for _, v := range r[i : i+n] {
+							x1 += v
+						}
+						b := image.Rect(x, y, x1, y+1)
+						if pass == 1 {
+							b.Min.X, b.Max.X = w-x1, w-x
+						}
+						res = addResult(res, Result{s, text, b.Add(m.Rect.Min)})
+						x = x1
+						i += n - 1
+						continue
+					}
+				}
+				x += r[i]
+			}
+		}
+	}
+	return res
+}
+
+// addResult adds r to res, unless it is a barcode already read in the rows
+// above, whose bounds it then extends.
+func addResult(res []Result, r Result) []Result {
+	for i := range res {
+		o := &res[i]
+		if o.Symbology == r.Symbology && o.Text == r.Text && o.Bounds.Max.Y >= r.Bounds.Min.Y-1 &&
+			o.Bounds.Min.X < r.Bounds.Max.X && r.Bounds.Min.X < o.Bounds.Max.X {
+			o.Bounds = o.Bounds.Union(r.Bounds)
+			return res
+		}
+	}
+	return append(res, r)
+}
+
+// rowRuns appends the lengths of the runs of a row of w pixels to runs,
+// white ones at even indices, starting with a white one, possibly empty.
+func rowRuns(runs []int, row []byte, w int, ink uint8) []int {
+	cur, n := false, 0
+	for x := 0; x < w; {
+		b := row[x>>3]
+		if ink == 0 {
+			b = ^b
+		}
+		// Whole bytes of the current color.
+		if x&7 == 0 && x+8 <= w && (b == 0 && !cur || b == 0xff && cur) {
+			n += 8
+			x += 8
+			continue
+		}
+		if black := b>>uint(7-x&7)&1 != 0; black != cur {
+			runs = append(runs, n)
+			cur, n = black, 0
+		}
+		n++
+		x++
+	}
+	return append(runs, n)
+}
+
+// readAt reads a barcode whose first bar is run i of r. It returns the
+// number of runs of the barcode, 0 if there is none.
+func readAt(r []int, i int) (Symbology, string, int) {
+	if text, n := readCode128(r, i); n > 0 {
+		return Code128, text, n
+	}
+	if text, n := readEAN13(r, i); n > 0 {
+		return EAN13, text, n
+	}
+	if text, n := readITF(r, i); n > 0 {
+		return ITF, text, n
+	}
+	return 0, "", 0
+}
+
+// variance returns the mean deviation of the run lengths from a pattern of
+// widths in modules, relative to the length. Any run off by 0.7 modules or
+// more rules the match out.
+func variance(runs, pattern []int) float64 {
+	total, modules := 0, 0
+	for i := range pattern {
+		total += runs[i]
+		modules += pattern[i]
+	}
+	unit := float64(total) / float64(modules)
+	var v float64
+	for i, p := range pattern {
+		d := math.Abs(float64(runs[i]) - float64(p)*unit)
+		if d >= 0.7*unit {
+			return math.Inf(1)
+		}
+		v += d
+	}
+	return v / float64(total)
+}
+
+// quietBefore reports whether the space before run i of r is a quiet zone
+// for a pattern of the next n runs and m modules.
+func quietBefore(r []int, i, n, m int) bool {
+	total := 0
+	for _, v := range r[i : i+n] {
+		total += v
+	}
+	return r[i-1]*m >= minQuiet*total
+}
+
+// quietAfter reports whether the space after run i+n-1 of r is a quiet zone
+// for a pattern of the runs from i and m modules.
+func quietAfter(r []int, i, n, m int) bool {
+	if i+n >= len(r) {
+		return false
+	}
+	total := 0
+	for _, v := range r[i : i+n] {
+		total += v
+	}
+	return r[i+n]*m >= minQuiet*total
+}
+
+// bestPattern returns the index of the pattern the runs match best, or -1
+// if none matches within max.
+func bestPattern(runs []int, patterns [][]int, max float64) int {
+	best, bestV := -1, max
+	for k, p := range patterns {
+		if v := variance(runs, p); v < bestV {
+			best, bestV = k, v
+		}
+	}
+	return best
+}
+
+// widths returns the digits of s as widths.
+func widths(s string) []int {
+	w := make([]int, len(s))
+	for i := range s {
+		w[i] = int(s[i] - '0')
+	}
+	return w
+}
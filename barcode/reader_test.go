@@ -0,0 +1,133 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package barcode
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		s    Symbology
+		text string
+	}{
+		{Code128, "Label 0042"},
+		{Code128, "1234567890"},
+		{Code128, "a\tB\x00c 99887766 x"},
+		{EAN13, "4006381333931"},
+		{EAN13, "9780201379624"},
+		{ITF, "00012345678905"},
+		{ITF, "123456"},
+	}
+	for _, tt := range tests {
+		m, err := Render(tt.s, tt.text, &Options{Module: 2, Height: 10, Text: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := Scan(m)
+		if len(res) != 1 {
+			t.Errorf("%q: %d results", tt.text, len(res))
+			continue
+		}
+		r := res[0]
+		if r.Symbology != tt.s || r.Text != tt.text {
+			t.Errorf("%q: read %d %q", tt.text, r.Symbology, r.Text)
+		}
+		bars, _ := Bars(tt.s, tt.text)
+		q := 10
+		if tt.s == EAN13 {
+			q = 11
+		}
+		if want := image.Rect(2*q, 0, 2*(q+len(bars)), 10); r.Bounds != want {
+			t.Errorf("%q: bounds %v, want %v", tt.text, r.Bounds, want)
+		}
+	}
+}
+
+// flip turns m upside down and inverts its palette.
+func flip(m *img1b.Image) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	d := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d.SetColorIndex(w-1-x, h-1-y, 1-m.ColorIndexAt(x, y))
+		}
+	}
+	return d
+}
+
+// spread widens the bars of m by a pixel, as ink does.
+func spread(m *img1b.Image) {
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := m.Rect.Dx() - 1; x > 0; x-- {
+			if m.ColorIndexAt(x-1, y) == 1 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+}
+
+func TestScanDistorted(t *testing.T) {
+	tests := []struct {
+		s    Symbology
+		text string
+	}{
+		{Code128, "SHIP-TO 10115"},
+		{EAN13, "5901234123457"},
+		{ITF, "1234567890"},
+	}
+	for _, tt := range tests {
+		m, err := Render(tt.s, tt.text, &Options{Module: 4, Height: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		spread(m)
+		for _, d := range []*img1b.Image{m, flip(m)} {
+			res := Scan(d)
+			if len(res) != 1 || res[0].Text != tt.text {
+				t.Errorf("%q: got %+v", tt.text, res)
+			}
+		}
+	}
+}
+
+func TestScanSeveral(t *testing.T) {
+	a, _ := Render(Code128, "FIRST", &Options{Height: 6})
+	b, _ := Render(EAN13, "400638133393", &Options{Height: 6})
+	m := img1b.New(image.Rect(0, 0, 400, 20), color.Palette{color.White, color.Black})
+	for y := 0; y < 6; y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			m.SetColorIndex(x, y, a.ColorIndexAt(x, y))
+		}
+		for x := 0; x < b.Rect.Dx(); x++ {
+			m.SetColorIndex(x+100, y+12, b.ColorIndexAt(x, y))
+		}
+	}
+	res := Scan(m)
+	if len(res) != 2 || res[0].Text != "FIRST" || res[1].Text != "4006381333931" {
+		t.Fatalf("got %+v", res)
+	}
+	if res[1].Bounds.Min.Y != 12 || res[1].Bounds.Max.Y != 18 {
+		t.Errorf("second bounds %v", res[1].Bounds)
+	}
+}
+
+func TestScanNothing(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 300, 10), color.Palette{color.White, color.Black})
+	// Regular stripes are no barcode.
+	for y := 0; y < 10; y++ {
+		for x := 20; x < 280; x++ {
+			if x%6 < 3 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	if res := Scan(m); len(res) != 0 {
+		t.Errorf("got %+v", res)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// bigTile is the width and height of the tiles of a BigImage, in pixels.
+const bigTile = 1024
+
+// A BigImage is an image made of square tiles, each an Image, allocated as
+// pixels in them are set. Pixels of tiles never set have index 0. Very large
+// bitmaps, such as masks of maps, take no single huge slice this way, and
+// their blank parts take no memory. It is mostly used as an Image is, but
+// like an Image it is not safe for concurrent writes.
+type BigImage struct {
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+	// Palette is the image's palette.
+	Palette color.Palette
+
+	g  *tileGrid
+	pc *paletteCache
+}
+
+// A tileGrid is the tiles of a BigImage, shared with its sub-images.
+type tileGrid struct {
+	bounds     image.Rectangle // of the image the tiles were made for
+	cols, rows int
+	tiles      []*Image // by rows, nil where no pixel was set
+}
+
+// NewBig returns a new BigImage with given dimensions and palette, taking no
+// memory for the pixels yet.
+func NewBig(r image.Rectangle, p color.Palette) *BigImage {
+	w, h := r.Dx(), r.Dy()
+	if w < 0 || h < 0 {
+		panic("img1b.NewBig: Rectangle has negative dimensions")
+	}
+	cols, rows := (w+bigTile-1)/bigTile, (h+bigTile-1)/bigTile
+	return &BigImage{Rect: r, Palette: p, g: &tileGrid{r, cols, rows, make([]*Image, cols*rows)}}
+}
+
+// tileIndex returns the index of the tile holding the pixel at (x, y).
+func (g *tileGrid) tileIndex(x, y int) int {
+	return (y-g.bounds.Min.Y)/bigTile*g.cols + (x-g.bounds.Min.X)/bigTile
+}
+
+// tileRect returns the bounds of tile i. The tiles at the right and the
+// bottom are cut to the image.
+func (g *tileGrid) tileRect(i int) image.Rectangle {
+	min := g.bounds.Min.Add(image.Pt(i%g.cols*bigTile, i/g.cols*bigTile))
+	return image.Rectangle{min, min.Add(image.Pt(bigTile, bigTile))}.Intersect(g.bounds)
+}
+
+// tile returns tile i, allocating it if it is not yet.
+func (p *BigImage) tile(i int) *Image {
+	t := p.g.tiles[i]
+	if t == nil {
+		t = New(p.g.tileRect(i), p.Palette)
+		p.g.tiles[i] = t
+	}
+	return t
+}
+
+// Bounds returns the domain for which At can return non-zero color.
+func (p *BigImage) Bounds() image.Rectangle { return p.Rect }
+
+// ColorModel returns the image's color model, as Image.ColorModel does.
+func (p *BigImage) ColorModel() color.Model { return colorModel(p.pc, p.Palette) }
+
+// ColorIndexAt returns the palette index of the pixel at (x, y).
+func (p *BigImage) ColorIndexAt(x, y int) uint8 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return 0
+	}
+	t := p.g.tiles[p.g.tileIndex(x, y)]
+	if t == nil {
+		return 0
+	}
+	return t.ColorIndexAtUnchecked(x, y)
+}
+
+// At returns the color of the pixel at (x, y).
+func (p *BigImage) At(x, y int) color.Color {
+	if len(p.Palette) == 0 {
+		return nil
+	}
+	return p.Palette[p.ColorIndexAt(x, y)]
+}
+
+// SetColorIndex sets color index for the pixel at (x, y). Index should be 0
+// or 1.
+func (p *BigImage) SetColorIndex(x, y int, index uint8) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.g.tileIndex(x, y)
+	if index == 0 && p.g.tiles[i] == nil {
+		return
+	}
+	p.tile(i).SetColorIndexUnchecked(x, y, index)
+}
+
+// Set sets the pixel at (x, y) to the color of the palette nearer to c in
+// luminance, as Image.Set does, which makes the image a draw.Image.
+func (p *BigImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	var i uint8
+	if !p.pc.of(p.Palette) {
+		p.pc = newPaletteCache(p.Palette)
+	}
+	if p.pc != nil {
+		i = p.pc.model.Index(c)
+	}
+	p.SetColorIndex(x, y, i)
+}
+
+// SubImage returns an image representing the portion of the image p
+// visible through r. The returned value shares pixels with the original
+// image. Unlike with Image.SubImage, r may have any left edge.
+func (p *BigImage) SubImage(r image.Rectangle) *BigImage {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		r = image.Rectangle{}
+	}
+	return &BigImage{Rect: r, Palette: p.Palette, g: p.g}
+}
+
+// Crop returns a copy of the part of p within r as an Image.
+func (p *BigImage) Crop(r image.Rectangle) *Image {
+	r = r.Intersect(p.Rect)
+	d := New(r, p.Palette)
+	p.eachTile(r, func(i int, tr image.Rectangle) {
+		if t := p.g.tiles[i]; t != nil {
+			Blit(d, tr, t, tr.Min)
+		}
+	})
+	return d
+}
+
+// Blit copies the pixels of src starting at sp into the rectangle dr of p,
+// clipped to both images, as the Blit function does. Tiles left blank are
+// not kept.
+func (p *BigImage) Blit(dr image.Rectangle, src *Image, sp image.Point) {
+	orig := dr.Min
+	dr = dr.Intersect(p.Rect)
+	dr = dr.Intersect(src.Rect.Add(orig.Sub(sp)))
+	delta := sp.Sub(orig)
+	p.eachTile(dr, func(i int, tr image.Rectangle) {
+		fresh := p.g.tiles[i] == nil
+		t := p.tile(i)
+		Blit(t, tr, src, tr.Min.Add(delta))
+		if fresh && bitmap.All(t.Pix, 0) {
+			p.g.tiles[i] = nil
+		}
+	})
+}
+
+// eachTile calls f with the index of each tile crossing r and the part of r
+// within it.
+func (p *BigImage) eachTile(r image.Rectangle, f func(i int, tr image.Rectangle)) {
+	if r.Empty() {
+		return
+	}
+	g := p.g
+	i0, i1 := g.tileIndex(r.Min.X, r.Min.Y), g.tileIndex(r.Max.X-1, r.Max.Y-1)
+	for row := i0 / g.cols; row <= i1/g.cols; row++ {
+		for col := i0 % g.cols; col <= i1%g.cols; col++ {
+			i := row*g.cols + col
+			f(i, g.tileRect(i).Intersect(r))
+		}
+	}
+}
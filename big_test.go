@@ -0,0 +1,114 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// allocated returns the number of tiles of p with memory.
+func allocated(p *BigImage) int {
+	n := 0
+	for _, t := range p.g.tiles {
+		if t != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBigImage(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pal := color.Palette{color.White, color.Black}
+	rect := image.Rect(-700, 300, 2100, 1700)
+	b := NewBig(rect, pal)
+	m := New(rect, pal)
+	if allocated(b) != 0 {
+		t.Fatal("new image has tiles")
+	}
+	for i := 0; i < 5000; i++ {
+		x, y := rect.Min.X+r.Intn(rect.Dx()+2)-1, rect.Min.Y+r.Intn(rect.Dy()+2)-1
+		v := uint8(r.Intn(2))
+		b.SetColorIndex(x, y, v)
+		m.SetColorIndex(x, y, v)
+	}
+	for _, q := range []image.Point{{-700, 300}, {2099, 1699}, {324, 1323}, {323, 1324}, {-701, 300}} {
+		b.SetColorIndex(q.X, q.Y, 1)
+		m.SetColorIndex(q.X, q.Y, 1)
+	}
+	for y := rect.Min.Y - 1; y <= rect.Max.Y; y++ {
+		for x := rect.Min.X - 1; x <= rect.Max.X; x++ {
+			if b.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) || b.At(x, y) != m.At(x, y) {
+				t.Fatalf("(%d, %d) differs", x, y)
+			}
+		}
+	}
+	if !equalPixels(b.Crop(rect), m) {
+		t.Error("Crop differs")
+	}
+	cr := image.Rect(300, 1000, 1500, 1400)
+	if !equalPixels(b.Crop(cr), m.SubImage(image.Rect(300, 1000, 1500, 1400))) {
+		t.Error("Crop of a part differs")
+	}
+
+	// A sub-image shares the tiles and takes any left edge.
+	s := b.SubImage(image.Rect(3, 500, 1030, 1200))
+	s.SetColorIndex(1027, 600, 1)
+	m.SetColorIndex(1027, 600, 1)
+	s.SetColorIndex(2, 600, 1)
+	if b.ColorIndexAt(1027, 600) != 1 || b.ColorIndexAt(2, 600) != m.ColorIndexAt(2, 600) {
+		t.Error("sub-image does not share pixels")
+	}
+	if s.Bounds() != image.Rect(3, 500, 1030, 1200) {
+		t.Errorf("sub-image bounds %v", s.Bounds())
+	}
+
+	// Blit across tiles.
+	src := randImage(r, image.Rect(0, 0, 1500, 900))
+	b.Blit(image.Rect(-77, 333, 1500, 1500), src, image.Pt(5, 7))
+	Blit(m, image.Rect(-77, 333, 1500, 1500), src, image.Pt(5, 7))
+	if !equalPixels(b.Crop(rect), m) {
+		t.Error("Blit differs")
+	}
+}
+
+func TestBigImageSparse(t *testing.T) {
+	b := NewBig(image.Rect(0, 0, 60000, 80000), color.Palette{color.White, color.Black})
+	b.SetColorIndex(0, 0, 0)
+	b.SetColorIndex(59999, 79999, 1)
+	b.SetColorIndex(30000, 40000, 1)
+	if n := allocated(b); n != 2 {
+		t.Errorf("%d tiles allocated, want 2", n)
+	}
+	// A blank source keeps no tiles.
+	b.Blit(image.Rect(5000, 5000, 7000, 7000), New(image.Rect(0, 0, 2000, 2000), nil), image.Point{})
+	if n := allocated(b); n != 2 {
+		t.Errorf("%d tiles allocated after a blank Blit, want 2", n)
+	}
+	if b.ColorIndexAt(59999, 79999) != 1 || b.ColorIndexAt(59998, 79999) != 0 {
+		t.Error("wrong pixels")
+	}
+}
+
+func TestBigImageSet(t *testing.T) {
+	b := NewBig(image.Rect(0, 0, 3000, 2000), color.Palette{color.Black, color.White})
+	var _ draw.Image = b
+	draw.Draw(b, image.Rect(100, 10, 200, 20), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(b, image.Rect(2500, 1500, 2600, 1600), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	if n := allocated(b); n != 1 {
+		t.Errorf("%d tiles allocated, want 1", n)
+	}
+	if b.ColorIndexAt(150, 15) != 1 || b.ColorIndexAt(150, 20) != 0 {
+		t.Error("wrong pixels")
+	}
+	b.Set(150, 15, color.Gray{0x20})
+	if b.ColorIndexAt(150, 15) != 0 {
+		t.Error("Set of a dark gray: got index 1, want 0")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bitplane splits grayscale images into their 8 bit planes, bilevel
+// images of one bit of each pixel, and joins them back.
+//
+// Planes compress as bilevel images do, each in its own way, and the most
+// significant one is the image thresholded at half gray, for approximate
+// processing at the speed of bilevel images. Gray coding the values first,
+// so that neighboring values differ in one bit, makes the planes below it
+// smoother: a gradient crossing 127 to 128 flips all 8 bits otherwise.
+package bitplane
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// palette is the palette of the planes: set bits are white, so that the
+// most significant plane looks like the image.
+func palette() color.Palette {
+	return color.Palette{color.Black, color.White}
+}
+
+// Split returns the bit planes of m, the plane of bit k at index k, with
+// the bounds of m and the palette {black, white}. With gray, the planes are
+// of the Gray codes of the values, v ^ v>>1.
+func Split(m *image.Gray, gray bool) [8]*img1b.Image {
+	var p [8]*img1b.Image
+	for k := range p {
+		p[k] = img1b.New(m.Rect, palette())
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	var src, dst [8]byte
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+w]
+		for x := 0; x < w; x += 8 {
+			// The 8 values, a byte each, make the rows of a block whose
+			// columns are the planes.
+			n := copy(src[:], row[x:])
+			for i := range src {
+				if i >= n {
+					src[i] = 0
+				} else if gray {
+					src[i] ^= src[i] >> 1
+				}
+			}
+			bitmap.Transpose8(dst[:], 1, src[:], 1)
+			for j, b := range dst {
+				q := p[7-j]
+				q.Pix[y*q.Stride+x/8] = b
+			}
+		}
+	}
+	return p
+}
+
+// Plane returns the plane of bit k of m, 0 to 7, as Split does.
+func Plane(m *image.Gray, k int, gray bool) *img1b.Image {
+	p := img1b.New(m.Rect, palette())
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+w]
+		dst := p.Pix[y*p.Stride:]
+		for x, v := range row {
+			if gray {
+				v ^= v >> 1
+			}
+			dst[x>>3] |= (v >> uint(k) & 1) << uint(7-x&7)
+		}
+	}
+	return p
+}
+
+// Join returns the grayscale image of the bit planes p, at index k the
+// plane of bit k, as Split makes them; with gray, the planes are of Gray
+// codes. The bits are the color indices of the planes, whatever their
+// palettes. Nil planes count as all zero, so that the image of some planes
+// only, an approximation, can be had. The planes must have the same bounds.
+func Join(p [8]*img1b.Image, gray bool) *image.Gray {
+	var r image.Rectangle
+	first := true
+	for _, q := range p {
+		if q == nil {
+			continue
+		}
+		if first {
+			r, first = q.Rect, false
+		} else if q.Rect != r {
+			panic("bitplane.Join: planes of different bounds")
+		}
+	}
+	m := image.NewGray(r)
+	w, h := r.Dx(), r.Dy()
+	var src, dst [8]byte
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+w]
+		for x := 0; x < w; x += 8 {
+			for j := range src {
+				src[j] = 0
+				if q := p[7-j]; q != nil {
+					src[j] = q.Pix[y*q.Stride+x/8]
+				}
+			}
+			bitmap.Transpose8(dst[:], 1, src[:], 1)
+			for i := 0; i < 8 && x+i < w; i++ {
+				v := dst[i]
+				if gray {
+					v ^= v >> 1
+					v ^= v >> 2
+					v ^= v >> 4
+				}
+				row[x+i] = v
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bitplane
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestSplitJoin(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, b := range []image.Rectangle{
+		image.Rect(0, 0, 16, 4),
+		image.Rect(-3, 5, 18, 12),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 0, 3),
+	} {
+		m := image.NewGray(b)
+		r.Read(m.Pix)
+		for _, gray := range []bool{false, true} {
+			p := Split(m, gray)
+			for k, q := range p {
+				if q.Rect != b {
+					t.Fatalf("%v, gray %t: plane %d has bounds %v", b, gray, k, q.Rect)
+				}
+				if err := q.Validate(); err != nil {
+					t.Errorf("%v, gray %t: plane %d: %v", b, gray, k, err)
+				}
+				pk := Plane(m, k, gray)
+				if !bytes.Equal(pk.Pix, q.Pix) {
+					t.Errorf("%v, gray %t: Plane(%d) differs from Split", b, gray, k)
+				}
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						v := m.GrayAt(x, y).Y
+						if gray {
+							v ^= v >> 1
+						}
+						if got, want := q.ColorIndexAt(x, y), v>>uint(k)&1; got != want {
+							t.Fatalf("%v, gray %t: plane %d at (%d, %d): got %d, want %d", b, gray, k, x, y, got, want)
+						}
+					}
+				}
+			}
+			if j := Join(p, gray); j.Rect != b || !bytes.Equal(j.Pix, m.Pix) {
+				t.Errorf("%v, gray %t: Join does not restore the image", b, gray)
+			}
+		}
+	}
+}
+
+func TestJoinSome(t *testing.T) {
+	m := image.NewGray(image.Rect(0, 0, 10, 1))
+	for x := range m.Pix {
+		m.Pix[x] = uint8(x * 28)
+	}
+	// The most significant plane alone is the image at half gray.
+	j := Join([8]*img1b.Image{7: Plane(m, 7, false)}, false)
+	for x, v := range j.Pix {
+		if want := m.Pix[x] & 0x80; v != want {
+			t.Errorf("pixel %d: got %d, want %d", x, v, want)
+		}
+	}
+	if j := Join([8]*img1b.Image{}, false); !j.Rect.Empty() {
+		t.Errorf("no planes: got bounds %v", j.Rect)
+	}
+}
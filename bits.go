@@ -0,0 +1,36 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import "github.com/mi-v/img1b/internal/bitmap"
+
+// ReverseBits reverses the bit order of each byte of b in place, converting
+// rows between the MSB-first packing of Image and the LSB-first packing of
+// many displays, printers and scanners. The bytes stay where they are, so
+// the pixels stay in order; MirrorRow is the one that flips a row.
+func ReverseBits(b []byte) {
+	bitmap.ReverseBits(b)
+}
+
+// MirrorRow sets dst to the row of width pixels in src flipped left to
+// right, both packed MSB-first. It reverses the order of the bits of the
+// whole row and moves them left over the padding, which it leaves zero in
+// dst. dst and src must hold (width+7)/8 bytes and must not overlap.
+func MirrorRow(dst, src []byte, width int) {
+	if width <= 0 {
+		return
+	}
+	n := (width + 7) / 8
+	dst, src = dst[:n], src[:n]
+	bitmap.Reverse(dst, src)
+	shift := uint(8*n - width)
+	if shift == 0 {
+		return
+	}
+	for i := 0; i < n-1; i++ {
+		dst[i] = dst[i]<<shift | dst[i+1]>>(8-shift)
+	}
+	dst[n-1] <<= shift
+}
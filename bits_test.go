@@ -0,0 +1,49 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"bytes"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+func TestReverseBits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 7, 31, 32, 33, 100} {
+		b := make([]byte, n)
+		r.Read(b)
+		want := make([]byte, n)
+		for i, c := range b {
+			want[i] = bits.Reverse8(c)
+		}
+		ReverseBits(b)
+		if !bytes.Equal(b, want) {
+			t.Errorf("%d bytes: got %x, want %x", n, b, want)
+		}
+	}
+}
+
+func TestMirrorRow(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, w := range []int{1, 5, 8, 13, 64, 77, 300} {
+		n := (w + 7) / 8
+		src := make([]byte, n)
+		r.Read(src)
+		dst := make([]byte, n)
+		MirrorRow(dst, src, w)
+		for x := 0; x < w; x++ {
+			got := dst[x/8] >> uint(7-x%8) & 1
+			want := src[(w-1-x)/8] >> uint(7-(w-1-x)%8) & 1
+			if got != want {
+				t.Fatalf("width %d: pixel %d is %d, want %d", w, x, got, want)
+			}
+		}
+		if w%8 != 0 && dst[n-1]<<uint(w%8) != 0 {
+			t.Errorf("width %d: padding %08b", w, dst[n-1])
+		}
+	}
+}
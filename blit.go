@@ -0,0 +1,99 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// Blit copies the pixels of src starting at sp into the rectangle dr of
+// dst, clipped to both images, as draw.Draw does with draw.Src. Color
+// indices are copied; the palettes are not looked at. The images may have
+// any bit alignment, so unlike SubImage it works for any rectangle. dst and
+// src may be the same image, with the rectangles overlapping.
+func Blit(dst *Image, dr image.Rectangle, src *Image, sp image.Point) {
+	orig := dr.Min
+	dr = dr.Intersect(dst.Rect)
+	dr = dr.Intersect(src.Rect.Add(orig.Sub(sp)))
+	if dr.Empty() {
+		return
+	}
+	sp = sp.Add(dr.Min.Sub(orig))
+	dst.Unshare()
+	w, h := dr.Dx(), dr.Dy()
+	dx := dr.Min.X - dst.Rect.Min.X
+	sx := sp.X - src.Rect.Min.X
+	dy := dr.Min.Y - dst.Rect.Min.Y
+	sy := sp.Y - src.Rect.Min.Y
+
+	y0, y1, step := 0, h, 1
+	var tmp []byte
+	if dst == src {
+		if dy > sy {
+			// Copying down, the rows of src below are read first.
+			y0, y1, step = h-1, -1, -1
+		} else if dy == sy && dx != sx {
+			// The rows overlap, so each is read before it is written.
+			tmp = make([]byte, (sx&7+w+7)/8)
+		}
+	}
+	for y := y0; y != y1; y += step {
+		srow := src.Pix[(sy+y)*src.Stride:]
+		s := sx
+		if tmp != nil {
+			copy(tmp, srow[sx>>3:])
+			srow, s = tmp, sx&7
+		}
+		copyRowBits(dst.Pix[(dy+y)*dst.Stride:], dx, srow, s, w)
+	}
+}
+
+// copyRowBits copies the w bits of src from bit sx to dst from bit dx,
+// keeping the other bits of dst. The middle bytes of dst take 8 bytes at a
+// time, each from a pair of source words shifted together.
+func copyRowBits(dst []byte, dx int, src []byte, sx, w int) {
+	d := sx - dx // source bit offset of a destination bit
+	j0, j1 := dx>>3, (dx+w-1)>>3
+	m0 := byte(0xff) >> uint(dx&7)
+	m1 := byte(0xff) << uint(7-(dx+w-1)&7)
+	if j0 == j1 {
+		m := m0 & m1
+		dst[j0] = dst[j0]&^m | srcByte(src, 8*j0+d)&m
+		return
+	}
+	dst[j0] = dst[j0]&^m0 | srcByte(src, 8*j0+d)&m0
+	j := j0 + 1
+	if r := uint(d & 7); r == 0 {
+		j += copy(dst[j:j1], src[(8*j+d)>>3:])
+	} else {
+		for ; j+8 <= j1; j += 8 {
+			k := (8*j + d) >> 3
+			if k+9 > len(src) {
+				break
+			}
+			v := binary.BigEndian.Uint64(src[k:])<<r | uint64(src[k+8])>>(8-r)
+			binary.BigEndian.PutUint64(dst[j:], v)
+		}
+	}
+	for ; j < j1; j++ {
+		dst[j] = srcByte(src, 8*j+d)
+	}
+	dst[j1] = dst[j1]&^m1 | srcByte(src, 8*j1+d)&m1
+}
+
+// srcByte returns the 8 bits of src from bit b, which may be before its
+// start or run past its end, with zeros there.
+func srcByte(src []byte, b int) byte {
+	if b < 0 {
+		return src[0] >> uint(-b)
+	}
+	k, r := b>>3, uint(b&7)
+	v := src[k] << r
+	if r > 0 && k+1 < len(src) {
+		v |= src[k+1] >> (8 - r)
+	}
+	return v
+}
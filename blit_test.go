@@ -0,0 +1,101 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randImage(r *rand.Rand, rect image.Rectangle) *Image {
+	m := New(rect, color.Palette{color.White, color.Black})
+	r.Read(m.Pix)
+	return m
+}
+
+// slowBlit is Blit pixel by pixel, reading all of src first.
+func slowBlit(dst *Image, dr image.Rectangle, src *Image, sp image.Point) {
+	c := New(src.Rect, src.Palette)
+	for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+		for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+			c.SetColorIndex(x, y, src.ColorIndexAt(x, y))
+		}
+	}
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			p := image.Pt(x, y).Sub(dr.Min).Add(sp)
+			if (image.Point{x, y}.In(dst.Rect)) && p.In(src.Rect) {
+				dst.SetColorIndex(x, y, c.ColorIndexAt(p.X, p.Y))
+			}
+		}
+	}
+}
+
+func equalPixels(a, b *Image) bool {
+	if a.Rect != b.Rect {
+		return false
+	}
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			if a.ColorIndexAt(x, y) != b.ColorIndexAt(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestBlit(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		src := randImage(r, image.Rect(r.Intn(20)-10, r.Intn(10)-5, 1+r.Intn(200), 1+r.Intn(12)))
+		dst := randImage(r, image.Rect(r.Intn(20)-10, r.Intn(10)-5, 1+r.Intn(200), 1+r.Intn(12)))
+		min := image.Pt(r.Intn(220)-15, r.Intn(20)-8)
+		dr := image.Rectangle{min, min.Add(image.Pt(r.Intn(210), r.Intn(14)))}
+		sp := image.Pt(r.Intn(220)-15, r.Intn(20)-8)
+
+		want := New(dst.Rect, dst.Palette)
+		copy(want.Pix, dst.Pix)
+		slowBlit(want, dr, src, sp)
+		Blit(dst, dr, src, sp)
+		if !equalPixels(dst, want) {
+			t.Fatalf("%v of %v from %v of %v: pixels differ", dr, dst.Rect, sp, src.Rect)
+		}
+	}
+}
+
+func TestBlitOverlap(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 1000; i++ {
+		m := randImage(r, image.Rect(0, 0, 1+r.Intn(150), 1+r.Intn(10)))
+		min := image.Pt(r.Intn(40)-20, r.Intn(6)-3)
+		dr := image.Rectangle{min, min.Add(image.Pt(r.Intn(150), r.Intn(10)))}
+		sp := image.Pt(r.Intn(40)-20, r.Intn(6)-3)
+		if r.Intn(3) == 0 {
+			sp.Y = dr.Min.Y
+		}
+
+		want := New(m.Rect, m.Palette)
+		copy(want.Pix, m.Pix)
+		slowBlit(want, dr, want, sp)
+		Blit(m, dr, m, sp)
+		if !equalPixels(m, want) {
+			t.Fatalf("%v from %v of %v: pixels differ", dr, sp, m.Rect)
+		}
+	}
+}
+
+func BenchmarkBlit(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	src := randImage(r, image.Rect(0, 0, 2480, 3508))
+	dst := New(src.Rect, src.Palette)
+	b.SetBytes(int64(len(src.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Blit(dst, dst.Rect.Inset(3), src, image.Pt(5, 5))
+	}
+}
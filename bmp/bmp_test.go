@@ -0,0 +1,184 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func testImage() *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 37, 5), color.Palette{
+		color.RGBA{0x10, 0x20, 0x30, 0xff},
+		color.RGBA{0xf0, 0xe0, 0xd0, 0xff},
+	})
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 37; x++ {
+			m.SetColorIndex(x, y, uint8((x*y+x)%3)&1)
+		}
+	}
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	m0 := testImage()
+	var b bytes.Buffer
+	if err := Encode(&b, m0); err != nil {
+		t.Fatal(err)
+	}
+	// 14 + 40 + 8 header bytes and 5 rows of 8 bytes.
+	if b.Len() != 62+5*8 {
+		t.Errorf("got %d bytes, want %d", b.Len(), 62+5*8)
+	}
+	cfg, err := DecodeConfig(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 37 || cfg.Height != 5 {
+		t.Errorf("DecodeConfig: got %dx%d", cfg.Width, cfg.Height)
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 37; x++ {
+			if m0.At(x, y) != m1.At(x, y) {
+				t.Fatalf("at (%d, %d): got %v, want %v", x, y, m1.At(x, y), m0.At(x, y))
+			}
+		}
+	}
+}
+
+func TestDIB(t *testing.T) {
+	m0 := testImage()
+	dib, err := ToDIB(m0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dib, b.Bytes()[fileHeaderLen:]) {
+		t.Error("DIB differs from the BMP file after its header")
+	}
+	m1, err := FromDIB(dib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 37; x++ {
+			if m0.At(x, y) != m1.At(x, y) {
+				t.Fatalf("at (%d, %d): got %v, want %v", x, y, m1.At(x, y), m0.At(x, y))
+			}
+		}
+	}
+	if _, err := FromDIB(dib[:len(dib)-1]); err == nil {
+		t.Error("truncated DIB: no error")
+	}
+	// A header claiming a huge image must be rejected before the
+	// allocation.
+	huge := make([]byte, infoHeaderLen+8)
+	copy(huge, dib[:infoHeaderLen+8])
+	binary.LittleEndian.PutUint32(huge[4:], 1<<30)
+	binary.LittleEndian.PutUint32(huge[8:], 1<<30)
+	if _, err := FromDIB(huge); err == nil {
+		t.Error("huge DIB: no error")
+	} else if _, ok := err.(FormatError); !ok {
+		t.Errorf("huge DIB: got %v, want a FormatError", err)
+	}
+}
+
+func TestTopDown(t *testing.T) {
+	m0 := testImage()
+	var b bytes.Buffer
+	if err := Encode(&b, m0); err != nil {
+		t.Fatal(err)
+	}
+	// Flip the rows and negate the height.
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data[22:26], uint32(-5&0xffffffff))
+	rows := data[62:]
+	for i := 0; i < 2; i++ {
+		r0, r1 := rows[i*8:i*8+8], rows[(4-i)*8:(4-i)*8+8]
+		for j := range r0 {
+			r0[j], r1[j] = r1[j], r0[j]
+		}
+	}
+	m1, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m0.Pix, m1.Pix) {
+		t.Error("top-down image differs")
+	}
+}
+
+func TestOneColor(t *testing.T) {
+	var b bytes.Buffer
+	if err := Encode(&b, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data[fileHeaderLen+32:], 1)
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Palette) != 2 {
+		t.Fatalf("got %d palette entries, want 2", len(m.Palette))
+	}
+	if c := m.At(1, 0); c != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("index 1: got %v, want black", c)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	var b bytes.Buffer
+	Encode(&b, testImage())
+	data := b.Bytes()
+	bpp4 := append([]byte(nil), data...)
+	bpp4[28] = 4
+	rle := append([]byte(nil), data...)
+	rle[30] = 2
+	for _, tt := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "EOF"},
+		{[]byte("GIF89a........"), "not a BMP file"},
+		{data[:len(data)-1], "unexpected EOF"},
+		{bpp4, "bit depth 4"},
+		{rle, "compression 2"},
+	} {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	var b bytes.Buffer
+	Encode(&b, testImage())
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 37 * 5}}
+	if _, err := d.Decode(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	// The header is enough: the rows are not there.
+	huge := b.Bytes()[:62]
+	binary.LittleEndian.PutUint32(huge[18:], 100000)
+	binary.LittleEndian.PutUint32(huge[22:], 100000)
+	_, err := d.Decode(bytes.NewReader(huge))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bmp implements a decoder and encoder for 1-bit BMP images.
+//
+// Only uncompressed (BI_RGB) images are supported. Both bottom-up and
+// top-down row orders are decoded; images are always encoded bottom-up.
+//
+// ToDIB and FromDIB convert to and from packed device independent bitmaps,
+// the BMP data without the file header that Windows passes around in
+// memory, for the clipboard and for printing.
+//
+// The BMP specification is at
+// https://docs.microsoft.com/en-us/windows/win32/gdi/bitmap-storage.
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// A FormatError reports that the input is not a valid BMP.
+type FormatError string
+
+func (e FormatError) Error() string { return "bmp: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "bmp: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of BMP images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their header is read.
+	Limits *img1b.Limits
+}
+
+const (
+	fileHeaderLen = 14
+	infoHeaderLen = 40
+	coreHeaderLen = 12
+)
+
+type decoder struct {
+	r             io.Reader
+	width, height int
+	topDown       bool
+	palette       color.Palette
+	offset        int // bytes consumed so far
+	pixOffset     int
+	limits        *img1b.Limits
+	tmp           [124]byte
+}
+
+func (d *decoder) readFull(b []byte) error {
+	n, err := io.ReadFull(d.r, b)
+	d.offset += n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *decoder) parseFileHeader() error {
+	if err := d.readFull(d.tmp[:fileHeaderLen]); err != nil {
+		return err
+	}
+	if d.tmp[0] != 'B' || d.tmp[1] != 'M' {
+		return FormatError("not a BMP file")
+	}
+	d.pixOffset = int(binary.LittleEndian.Uint32(d.tmp[10:14]))
+	return nil
+}
+
+// parseInfoHeader parses a DIB header and color table.
+func (d *decoder) parseInfoHeader() error {
+	if err := d.readFull(d.tmp[:4]); err != nil {
+		return err
+	}
+	size := binary.LittleEndian.Uint32(d.tmp[:4])
+	var planes, bpp, ncolors int
+	switch {
+	case size == coreHeaderLen:
+		if err := d.readFull(d.tmp[4:coreHeaderLen]); err != nil {
+			return err
+		}
+		d.width = int(binary.LittleEndian.Uint16(d.tmp[4:6]))
+		d.height = int(binary.LittleEndian.Uint16(d.tmp[6:8]))
+		planes = int(binary.LittleEndian.Uint16(d.tmp[8:10]))
+		bpp = int(binary.LittleEndian.Uint16(d.tmp[10:12]))
+	case size >= infoHeaderLen && size <= uint32(len(d.tmp)):
+		if err := d.readFull(d.tmp[4:size]); err != nil {
+			return err
+		}
+		d.width = int(int32(binary.LittleEndian.Uint32(d.tmp[4:8])))
+		h := int32(binary.LittleEndian.Uint32(d.tmp[8:12]))
+		if h < 0 {
+			d.topDown = true
+			h = -h
+		}
+		d.height = int(h)
+		planes = int(binary.LittleEndian.Uint16(d.tmp[12:14]))
+		bpp = int(binary.LittleEndian.Uint16(d.tmp[14:16]))
+		if c := binary.LittleEndian.Uint32(d.tmp[16:20]); c != 0 {
+			return UnsupportedError(fmt.Sprintf("compression %d", c))
+		}
+		ncolors = int(binary.LittleEndian.Uint32(d.tmp[32:36]))
+	default:
+		return UnsupportedError(fmt.Sprintf("DIB header size %d", size))
+	}
+	if planes != 1 {
+		return FormatError("bad number of planes")
+	}
+	if bpp != 1 {
+		return UnsupportedError(fmt.Sprintf("bit depth %d", bpp))
+	}
+	if d.width <= 0 || d.height <= 0 {
+		return FormatError("non-positive dimension")
+	}
+	if ncolors == 0 || ncolors > 2 {
+		// Indices above 1 can't be referenced by 1-bit pixels.
+		ncolors = 2
+	}
+
+	// Color table entries are BGR triples in core headers and BGRX quads otherwise.
+	entry := 4
+	if size == coreHeaderLen {
+		entry = 3
+	}
+	if err := d.readFull(d.tmp[:ncolors*entry]); err != nil {
+		return err
+	}
+	d.palette = make(color.Palette, ncolors)
+	for i := range d.palette {
+		p := d.tmp[i*entry:]
+		d.palette[i] = color.RGBA{p[2], p[1], p[0], 0xff}
+	}
+	if ncolors == 1 {
+		// Pixels may still reference index 1; give it the color of a zeroed
+		// entry.
+		d.palette = append(d.palette, color.RGBA{0, 0, 0, 0xff})
+	}
+	return nil
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	if d.pixOffset < d.offset {
+		return nil, FormatError("bad pixel data offset")
+	}
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), d.palette)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, d.r, int64(d.pixOffset-d.offset)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	rowBytes := (d.width + 7) / 8
+	// Rows are padded to 4 bytes.
+	row := make([]byte, (rowBytes+3)&^3)
+	tm := bitmap.TailMask(d.width)
+	for i := 0; i < d.height; i++ {
+		if err := d.readFull(row); err != nil {
+			return nil, err
+		}
+		y := d.height - 1 - i
+		if d.topDown {
+			y = i
+		}
+		dst := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+		copy(dst, row)
+		dst[rowBytes-1] &= tm
+	}
+	return img, nil
+}
+
+// Decode reads a BMP image from r and returns it as an img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads a BMP image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d := &decoder{r: r, limits: dec.Limits}
+	if err := d.parseFileHeader(); err != nil {
+		return nil, err
+	}
+	if err := d.parseInfoHeader(); err != nil {
+		return nil, err
+	}
+	return d.decode()
+}
+
+// FromDIB decodes a packed device independent bitmap, the BMP data after
+// the file header with the rows right after the color table, as ToDIB
+// makes and the CF_DIB clipboard format holds.
+func FromDIB(b []byte) (*img1b.Image, error) {
+	var d Decoder
+	return d.FromDIB(b)
+}
+
+// FromDIB decodes a packed device independent bitmap, as the function
+// FromDIB does.
+func (dec *Decoder) FromDIB(b []byte) (*img1b.Image, error) {
+	d := &decoder{r: bytes.NewReader(b), limits: dec.Limits}
+	if err := d.parseInfoHeader(); err != nil {
+		return nil, err
+	}
+	d.pixOffset = d.offset
+	// The whole DIB is at hand, so it is checked to hold the rows before
+	// they are allocated.
+	rowSize := ((d.width+7)/8 + 3) &^ 3
+	if d.height > (len(b)-d.pixOffset)/rowSize {
+		return nil, FormatError("DIB too short for its dimensions")
+	}
+	return d.decode()
+}
+
+// DecodeConfig returns the color model and dimensions of a BMP image without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{r: r}
+	if err := d.parseFileHeader(); err != nil {
+		return image.Config{}, err
+	}
+	if err := d.parseInfoHeader(); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: d.palette,
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image/color"
+	"io"
+)
+
+// Encode writes the Image m to w in BMP format.
+func Encode(w io.Writer, m *img1b.Image) error {
+	paddedBytes, err := check(m)
+	if err != nil {
+		return err
+	}
+	b := m.Bounds()
+	pixOffset := fileHeaderLen + infoHeaderLen + 2*4
+	fileSize := int64(pixOffset) + int64(paddedBytes)*int64(b.Dy())
+	if fileSize >= 1<<32 {
+		return FormatError("image is too large")
+	}
+
+	var h [fileHeaderLen + infoHeaderLen + 2*4]byte
+	h[0], h[1] = 'B', 'M'
+	binary.LittleEndian.PutUint32(h[2:6], uint32(fileSize))
+	binary.LittleEndian.PutUint32(h[10:14], uint32(pixOffset))
+	putInfoHeader(h[fileHeaderLen:], m, paddedBytes)
+
+	bw := bufio.NewWriter(w)
+	bw.Write(h[:])
+	row := make([]byte, paddedBytes)
+	for y := b.Dy() - 1; y >= 0; y-- {
+		putRow(row, m, y)
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ToDIB returns m as a packed device independent bitmap: a
+// BITMAPINFOHEADER, the color table and the rows, bottom-up, as BMP files
+// hold them after their file header. It is the CF_DIB clipboard format and
+// the memory block CreateDIBitmap, SetDIBitsToDevice and StretchDIBits take
+// to make an HBITMAP or to print.
+func ToDIB(m *img1b.Image) ([]byte, error) {
+	paddedBytes, err := check(m)
+	if err != nil {
+		return nil, err
+	}
+	h := m.Bounds().Dy()
+	size := int64(infoHeaderLen+2*4) + int64(paddedBytes)*int64(h)
+	if size >= 1<<32 || size != int64(int(size)) {
+		return nil, FormatError("image is too large")
+	}
+	b := make([]byte, size)
+	putInfoHeader(b, m, paddedBytes)
+	pix := b[infoHeaderLen+2*4:]
+	for y := h - 1; y >= 0; y-- {
+		putRow(pix[(h-1-y)*paddedBytes:(h-y)*paddedBytes], m, y)
+	}
+	return b, nil
+}
+
+// check returns the padded row size of m, or an error if m cannot be
+// encoded.
+func check(m *img1b.Image) (int, error) {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || int64(b.Dx()) >= 1<<31 || int64(b.Dy()) >= 1<<31 {
+		return 0, FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	if len(m.Palette) < 1 || len(m.Palette) > 2 {
+		return 0, FormatError(fmt.Sprintf("bad palette length: %d", len(m.Palette)))
+	}
+	rowBytes := (b.Dx() + 7) / 8
+	return (rowBytes + 3) &^ 3, nil
+}
+
+// putInfoHeader fills ih with the BITMAPINFOHEADER and the color table of
+// m.
+func putInfoHeader(ih []byte, m *img1b.Image, paddedBytes int) {
+	b := m.Bounds()
+	binary.LittleEndian.PutUint32(ih[0:4], infoHeaderLen)
+	binary.LittleEndian.PutUint32(ih[4:8], uint32(b.Dx()))
+	binary.LittleEndian.PutUint32(ih[8:12], uint32(b.Dy()))
+	binary.LittleEndian.PutUint16(ih[12:14], 1) // planes
+	binary.LittleEndian.PutUint16(ih[14:16], 1) // bits per pixel
+	binary.LittleEndian.PutUint32(ih[20:24], uint32(paddedBytes*b.Dy()))
+	binary.LittleEndian.PutUint32(ih[24:28], 2835) // 72 DPI
+	binary.LittleEndian.PutUint32(ih[28:32], 2835)
+	binary.LittleEndian.PutUint32(ih[32:36], 2)
+	ct := ih[infoHeaderLen:]
+	for i := 0; i < 2; i++ {
+		c := color.Color(color.Black)
+		if i < len(m.Palette) {
+			c = m.Palette[i]
+		}
+		c1 := color.RGBAModel.Convert(c).(color.RGBA)
+		ct[4*i+0], ct[4*i+1], ct[4*i+2] = c1.B, c1.G, c1.R
+	}
+}
+
+// putRow fills row with row y of m, zero padded.
+func putRow(row []byte, m *img1b.Image, y int) {
+	rowBytes := (m.Rect.Dx() + 7) / 8
+	copy(row, m.Pix[y*m.Stride:y*m.Stride+rowBytes])
+	row[rowBytes-1] &= bitmap.TailMask(m.Rect.Dx())
+	for i := rowBytes; i < len(row); i++ {
+		row[i] = 0
+	}
+}
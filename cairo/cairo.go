@@ -0,0 +1,116 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cairo converts images to and from the data of cairo image
+// surfaces of format A1, for Go programs rendering masks with cairo.
+//
+// A1 rows are padded to 32-bit words, and a word holds its pixels from its
+// least significant bit on little endian machines and from its most
+// significant bit on big endian ones, as cairo and pixman do. In bytes, A1
+// is the layout of img1b on big endian machines and has the bits of each
+// byte reversed on little endian ones. The conversions here use the byte
+// order of the machine they run on, so that the data can be passed to and
+// from cairo_image_surface_create_for_data and cairo_image_surface_get_data
+// as they are.
+package cairo
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the dimensions or the data are not valid.
+type FormatError string
+
+func (e FormatError) Error() string { return "cairo: invalid format: " + string(e) }
+
+// Stride returns the stride of A1 rows of the given width, as
+// cairo_format_stride_for_width does.
+func Stride(width int) int {
+	return (width + 31) / 32 * 4
+}
+
+// alpha returns the alpha of color i of p, opaque if p has no such color.
+func alpha(p color.Palette, i int) uint32 {
+	if i >= len(p) {
+		return 0xffff
+	}
+	_, _, _, a := p[i].RGBA()
+	return a
+}
+
+// opaqueIndex returns the color index of m stored as set bits: that of the
+// more opaque color, or of the darker one if both are as opaque.
+func opaqueIndex(p color.Palette) uint8 {
+	a0, a1 := alpha(p, 0), alpha(p, 1)
+	switch {
+	case a1 > a0:
+		return 1
+	case a0 > a1:
+		return 0
+	}
+	return bitmap.BlackIndex(p)
+}
+
+// ToA1 returns the pixels of m as the data of an A1 surface of the same
+// size, and its stride. The pixels of the more opaque palette color are
+// set, those of the darker one for palettes with the two colors as opaque,
+// so a black on white image becomes a mask of its black pixels. The padding
+// bits are zero.
+func ToA1(m *img1b.Image) (data []byte, stride int) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	stride = Stride(w)
+	data = make([]byte, stride*h)
+	if w == 0 {
+		return data, stride
+	}
+	invert := opaqueIndex(m.Palette) == 0
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h; y++ {
+		row := data[y*stride : y*stride+n]
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[n-1] &= tm
+		if littleEndian {
+			img1b.ReverseBits(row)
+		}
+	}
+	return data, stride
+}
+
+// FromA1 returns a new image of the given size with the pixels of the data
+// of an A1 surface, rows stride bytes apart. The palette is
+// {color.Transparent, color.Opaque}, so the image is a mask for
+// draw.DrawMask.
+func FromA1(data []byte, width, height, stride int) (*img1b.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, FormatError(fmt.Sprintf("invalid size: %dx%d", width, height))
+	}
+	n := (width + 7) / 8
+	if stride < n {
+		return nil, FormatError(fmt.Sprintf("stride %d too small for width %d", stride, width))
+	}
+	if int64(stride)*int64(height-1)+int64(n) > int64(len(data)) {
+		return nil, FormatError("short data")
+	}
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.Transparent, color.Opaque})
+	tm := bitmap.TailMask(width)
+	for y := 0; y < height; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+n]
+		copy(row, data[y*stride:])
+		if littleEndian {
+			img1b.ReverseBits(row)
+		}
+		row[n-1] &= tm
+	}
+	return m, nil
+}
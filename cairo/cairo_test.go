@@ -0,0 +1,94 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cairo
+
+import (
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// pixel returns the pixel at (x, y) of A1 data as pixman reads it: from a
+// 32-bit word in the byte order of the machine.
+func pixel(data []byte, stride, x, y int) uint8 {
+	w := data[y*stride+4*(x/32):]
+	if littleEndian {
+		return uint8(binary.LittleEndian.Uint32(w) >> uint(x%32) & 1)
+	}
+	return uint8(binary.BigEndian.Uint32(w) >> uint(31-x%32) & 1)
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, w := range []int{1, 8, 31, 32, 33, 70} {
+		for _, p := range []color.Palette{
+			{color.White, color.Black},
+			{color.Black, color.White},
+			{color.Transparent, color.Opaque},
+			{color.Opaque, color.Transparent},
+		} {
+			m := img1b.New(image.Rect(0, 0, w, 3), p)
+			r.Read(m.Pix)
+			data, stride := ToA1(m)
+			if stride%4 != 0 || stride*8 < w || len(data) != 3*stride {
+				t.Fatalf("width %d: stride %d, %d bytes", w, stride, len(data))
+			}
+			set := opaqueIndex(p)
+			for y := 0; y < 3; y++ {
+				for x := 0; x < 8*stride; x++ {
+					want := uint8(0)
+					if x < w && m.ColorIndexAt(x, y) == set {
+						want = 1
+					}
+					if got := pixel(data, stride, x, y); got != want {
+						t.Fatalf("width %d, palette %v: (%d, %d) is %d, want %d", w, p, x, y, got, want)
+					}
+				}
+			}
+			back, err := FromA1(data, w, 3, stride)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < 3; y++ {
+				for x := 0; x < w; x++ {
+					if got, want := back.ColorIndexAt(x, y), uint8(pixel(data, stride, x, y)); got != want {
+						t.Fatalf("width %d, palette %v: back at (%d, %d) is %d, want %d", w, p, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOpaqueIndex(t *testing.T) {
+	for _, tc := range []struct {
+		p    color.Palette
+		want uint8
+	}{
+		{color.Palette{color.White, color.Black}, 1},
+		{color.Palette{color.Black, color.White}, 0},
+		{color.Palette{color.Transparent, color.Opaque}, 1},
+		{color.Palette{color.Black, color.Transparent}, 0},
+	} {
+		if got := opaqueIndex(tc.p); got != tc.want {
+			t.Errorf("%v: got %d, want %d", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestFromA1Errors(t *testing.T) {
+	for _, tc := range []struct{ n, w, h, stride int }{
+		{4, 0, 1, 4},
+		{8, 40, 2, 4},
+		{7, 32, 2, 4},
+	} {
+		if _, err := FromA1(make([]byte, tc.n), tc.w, tc.h, tc.stride); err == nil {
+			t.Errorf("%+v: no error", tc)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package canvas expands images into the RGBA bytes of the HTML canvas
+// ImageData, for programs compiled to WebAssembly: the pixels are
+// converted in one pass over the packed rows instead of a call to At per
+// pixel, and handed to JavaScript in one copy.
+//
+// ImageData holds 4 bytes per pixel, red, green, blue and alpha, not
+// premultiplied, rows top to bottom without padding.
+package canvas
+
+import (
+	"github.com/mi-v/img1b"
+	"image/color"
+)
+
+// RGBA returns the pixels of m in the layout of ImageData, the colors of
+// its palette applied.
+func RGBA(m *img1b.Image) []byte {
+	b := make([]byte, 4*m.Rect.Dx()*m.Rect.Dy())
+	PutRGBA(b, m)
+	return b
+}
+
+// PutRGBA writes the pixels of m to dst in the layout of ImageData, the
+// colors of its palette applied, so that a buffer can be reused from frame
+// to frame. dst must hold 4×width×height bytes.
+func PutRGBA(dst []byte, m *img1b.Image) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w <= 0 || h <= 0 {
+		return
+	}
+	dst = dst[:4*w*h]
+	var c [2][4]byte
+	for i := range c {
+		if i < len(m.Palette) {
+			n := color.NRGBAModel.Convert(m.Palette[i]).(color.NRGBA)
+			c[i] = [4]byte{n.R, n.G, n.B, n.A}
+		}
+	}
+	// The 4 pixels of each nibble.
+	var table [16][16]byte
+	for v := range table {
+		for k := 0; k < 4; k++ {
+			copy(table[v][4*k:], c[v>>uint(3-k)&1][:])
+		}
+	}
+	full := w / 8
+	for y := 0; y < h; y++ {
+		src := m.Pix[y*m.Stride:]
+		row := dst[4*w*y : 4*w*(y+1)]
+		for i := 0; i < full; i++ {
+			b := src[i]
+			copy(row[32*i:], table[b>>4][:])
+			copy(row[32*i+16:], table[b&15][:])
+		}
+		for x := 8 * full; x < w; x++ {
+			copy(row[4*x:], c[src[x>>3]>>uint(7-x&7)&1][:])
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build js && wasm
+// +build js,wasm
+
+package canvas
+
+import (
+	"github.com/mi-v/img1b"
+	"syscall/js"
+)
+
+// ImageData returns a new JavaScript ImageData with the pixels of m, ready
+// for putImageData. buf, if long enough, is used for the RGBA bytes, so
+// that a buffer can be reused from frame to frame.
+func ImageData(m *img1b.Image, buf []byte) js.Value {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	n := 4 * w * h
+	if len(buf) < n {
+		buf = make([]byte, n)
+	}
+	PutRGBA(buf, m)
+	a := js.Global().Get("Uint8ClampedArray").New(n)
+	js.CopyBytesToJS(a, buf[:n])
+	return js.Global().Get("ImageData").New(a, w, h)
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package canvas
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRGBA(t *testing.T) {
+	pal := color.Palette{color.NRGBA{0x10, 0x20, 0x30, 0x80}, color.Black}
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 0),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 8, 2),
+		image.Rect(0, 0, 13, 3),
+		image.Rect(0, 0, 40, 5),
+		image.Rect(-3, 2, 20, 7),
+	} {
+		m := img1b.New(r, pal)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.SetColorIndex(x, y, uint8((x*7+y*3)%5&1))
+			}
+		}
+		// Dirty padding must not show.
+		if w := r.Dx(); w%8 != 0 {
+			for y := 0; y < r.Dy(); y++ {
+				m.Pix[y*m.Stride+m.Stride-1] |= 0xff >> uint(w%8)
+			}
+		}
+		want := make([]byte, 0, 4*r.Dx()*r.Dy())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+				want = append(want, c.R, c.G, c.B, c.A)
+			}
+		}
+		if got := RGBA(m); !bytes.Equal(got, want) {
+			t.Errorf("%v: got %v, want %v", r, got, want)
+		}
+		// A subimage with a stride wider than its rows.
+		if r.Dx() > 8 {
+			s := m.SubImage(image.Rect(r.Min.X, r.Min.Y, r.Min.X+5, r.Max.Y))
+			got := RGBA(s)
+			for y := 0; y < r.Dy(); y++ {
+				if !bytes.Equal(got[20*y:20*y+20], want[4*r.Dx()*y:4*r.Dx()*y+20]) {
+					t.Errorf("%v: subimage row %d differs", r, y)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkPutRGBA(b *testing.B) {
+	m := img1b.New(image.Rect(0, 0, 640, 480), color.Palette{color.White, color.Black})
+	dst := make([]byte, 4*640*480)
+	b.SetBytes(int64(len(dst)))
+	for i := 0; i < b.N; i++ {
+		PutRGBA(dst, m)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// CBORTag is the CBOR tag MarshalCBOR marks images with, "img1" in ASCII.
+// It is in the first come, first served range of tags and is not
+// registered with IANA.
+const CBORTag = 0x696d6731
+
+// A CBORError reports CBOR data that does not hold an image.
+type CBORError string
+
+func (e CBORError) Error() string { return "img1b: invalid CBOR: " + string(e) }
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegint = 1
+	cborBytes  = 2
+	cborArray  = 4
+	cborTag    = 6
+)
+
+// MarshalCBOR returns p as CBOR, for exchanging frames with devices in
+// their packed form, as over CoAP. The image is an array tagged with
+// CBORTag of:
+//
+//   - its bounds, an array of Min.X, Min.Y, Max.X and Max.Y;
+//   - the stride of its pixels, (Max.X-Min.X+7)/8;
+//   - its palette, an array of colors as 0xRRGGBBAA non-premultiplied;
+//   - its pixels, a byte string of the rows, most significant bit first,
+//     the padding bits past the right edge clear.
+//
+// It implements the Marshaler interface of CBOR libraries such as
+// github.com/fxamacker/cbor. Images that UnmarshalCBOR would reject, those
+// failing Validate for other reasons than their padding, are rejected with
+// the InvalidError of Validate.
+func (p *Image) MarshalCBOR() ([]byte, error) {
+	if err := p.validate(false); err != nil {
+		return nil, err
+	}
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	n := 0
+	if w > 0 && h > 0 {
+		n = (w + 7) / 8
+	}
+	b := make([]byte, 0, 64+5*len(p.Palette)+n*h)
+	b = cborHead(b, cborTag, CBORTag)
+	b = cborHead(b, cborArray, 4)
+	b = cborHead(b, cborArray, 4)
+	for _, v := range [4]int{p.Rect.Min.X, p.Rect.Min.Y, p.Rect.Max.X, p.Rect.Max.Y} {
+		b = cborInt(b, v)
+	}
+	b = cborHead(b, cborUint, uint64(n))
+	b = cborHead(b, cborArray, uint64(len(p.Palette)))
+	for _, c := range p.Palette {
+		var v uint32
+		if c != nil {
+			nc := color.NRGBAModel.Convert(c).(color.NRGBA)
+			v = uint32(nc.R)<<24 | uint32(nc.G)<<16 | uint32(nc.B)<<8 | uint32(nc.A)
+		}
+		b = cborHead(b, cborUint, uint64(v))
+	}
+	b = cborHead(b, cborBytes, uint64(n*h))
+	if n > 0 {
+		tm := bitmap.TailMask(w)
+		for y := 0; y < h; y++ {
+			b = append(b, p.Pix[y*p.Stride:y*p.Stride+n]...)
+			b[len(b)-1] &= tm
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalCBOR sets p to the image of the CBOR data b, as MarshalCBOR
+// writes it, with or without the tag; the stride may be larger than the
+// width needs. The image has pixels of its own, and is checked as Validate
+// does.
+func (p *Image) UnmarshalCBOR(b []byte) error {
+	d := cborDecoder{b: b}
+	major, v := d.head()
+	if major == cborTag {
+		if v != CBORTag {
+			return CBORError("tag " + strconv.FormatUint(v, 10) + " is not that of an image")
+		}
+		major, v = d.head()
+	}
+	if d.err == nil && (major != cborArray || v != 4) {
+		d.fail("not an array of 4 items")
+	}
+	if major, v = d.head(); d.err == nil && (major != cborArray || v != 4) {
+		d.fail("bounds are not an array of 4 integers")
+	}
+	var r [4]int
+	for i := range r {
+		r[i] = d.int()
+	}
+	stride := d.int()
+	if stride < 0 {
+		d.fail("negative stride")
+	}
+	major, v = d.head()
+	if d.err == nil && major != cborArray {
+		d.fail("palette is not an array")
+	}
+	if d.err == nil && v > uint64(len(d.b)) {
+		d.fail("palette of " + strconv.FormatUint(v, 10) + " colors in " + strconv.Itoa(len(d.b)) + " bytes")
+	}
+	var pal color.Palette
+	for i := uint64(0); i < v && d.err == nil; i++ {
+		major, c := d.head()
+		if major != cborUint || c > math.MaxUint32 {
+			d.fail("color is not a 32-bit unsigned integer")
+		}
+		pal = append(pal, color.NRGBA{uint8(c >> 24), uint8(c >> 16), uint8(c >> 8), uint8(c)})
+	}
+	pix := d.bytes()
+	if d.err == nil && len(d.b) > 0 {
+		d.fail(strconv.Itoa(len(d.b)) + " bytes past the image")
+	}
+	if d.err != nil {
+		return d.err
+	}
+	m, err := NewFromPix(append([]byte(nil), pix...), stride, image.Rect(r[0], r[1], r[2], r[3]), pal)
+	if err != nil {
+		return err
+	}
+	m.own = true
+	*p = *m
+	return nil
+}
+
+// cborHead appends the head of a CBOR item of the major type and argument.
+func cborHead(b []byte, major byte, v uint64) []byte {
+	major <<= 5
+	switch {
+	case v < 24:
+		return append(b, major|byte(v))
+	case v <= math.MaxUint8:
+		return append(b, major|24, byte(v))
+	case v <= math.MaxUint16:
+		return append(b, major|25, byte(v>>8), byte(v))
+	case v <= math.MaxUint32:
+		return append(b, major|26, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, major|27, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// cborInt appends v as a CBOR integer.
+func cborInt(b []byte, v int) []byte {
+	if v < 0 {
+		return cborHead(b, cborNegint, uint64(-1-v))
+	}
+	return cborHead(b, cborUint, uint64(v))
+}
+
+// A cborDecoder reads CBOR items from b, keeping the first error.
+type cborDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *cborDecoder) fail(s string) {
+	if d.err == nil {
+		d.err = CBORError(s)
+	}
+}
+
+// head reads the head of an item, returning its major type and argument.
+// Items of indefinite length are not supported.
+func (d *cborDecoder) head() (major byte, v uint64) {
+	if d.err != nil {
+		return 0, 0
+	}
+	if len(d.b) == 0 {
+		d.fail("unexpected end of data")
+		return 0, 0
+	}
+	major, info := d.b[0]>>5, d.b[0]&31
+	d.b = d.b[1:]
+	if info < 24 {
+		return major, uint64(info)
+	}
+	if info > 27 {
+		d.fail("indefinite length or reserved item")
+		return 0, 0
+	}
+	n := 1 << (info - 24)
+	if len(d.b) < n {
+		d.fail("unexpected end of data")
+		return 0, 0
+	}
+	for _, c := range d.b[:n] {
+		v = v<<8 | uint64(c)
+	}
+	d.b = d.b[n:]
+	return major, v
+}
+
+// int reads an integer that fits in an int.
+func (d *cborDecoder) int() int {
+	major, v := d.head()
+	if d.err != nil {
+		return 0
+	}
+	if (major != cborUint && major != cborNegint) || v > math.MaxInt32 {
+		d.fail("not a 32-bit integer")
+		return 0
+	}
+	if major == cborNegint {
+		return -1 - int(v)
+	}
+	return int(v)
+}
+
+// bytes reads a byte string, returning a slice of the data.
+func (d *cborDecoder) bytes() []byte {
+	major, v := d.head()
+	if d.err != nil {
+		return nil
+	}
+	if major != cborBytes {
+		d.fail("pixels are not a byte string")
+		return nil
+	}
+	if v > uint64(len(d.b)) {
+		d.fail("byte string of " + strconv.FormatUint(v, 10) + " bytes in " + strconv.Itoa(len(d.b)))
+		return nil
+	}
+	s := d.b[:v]
+	d.b = d.b[v:]
+	return s
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestMarshalCBOR(t *testing.T) {
+	m := New(image.Rect(1, -1, 4, 1), color.Palette{color.White, color.Black})
+	m.SetColorIndex(1, -1, 1)
+	m.SetColorIndex(3, 0, 1)
+	m.Pix[0] |= 0x1f
+	b, err := m.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0xda, 'i', 'm', 'g', '1', // tag
+		0x84,
+		0x84, 0x01, 0x20, 0x04, 0x01, // bounds
+		0x01,                                           // stride
+		0x82, 0x1a, 0xff, 0xff, 0xff, 0xff, 0x18, 0xff, // palette
+		0x42, 0x80, 0x20, // pixels
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("got % x\nwant % x", b, want)
+	}
+}
+
+func TestMarshalCBORInvalid(t *testing.T) {
+	// What MarshalCBOR writes, UnmarshalCBOR reads back; other images are
+	// rejected.
+	dot := New(image.Rect(0, 0, 9, 2), color.Palette{color.Black})
+	dot.SetColorIndex(3, 1, 1)
+	for _, tc := range []struct {
+		name string
+		m    *Image
+		ok   bool
+	}{
+		{"empty palette", &Image{Pix: make([]byte, 4), Stride: 2, Rect: image.Rect(0, 0, 9, 2)}, false},
+		{"empty palette, no pixels", &Image{}, false},
+		{"one color", New(image.Rect(0, 0, 9, 2), color.Palette{color.Black}), true},
+		{"one color, index 1", dot, false},
+		{"nil color", &Image{Pix: make([]byte, 2), Stride: 1, Rect: image.Rect(0, 0, 8, 2), Palette: color.Palette{nil, color.Black}}, false},
+		{"few pixels", &Image{Pix: make([]byte, 3), Stride: 2, Rect: image.Rect(0, 0, 9, 2), Palette: color.Palette{color.Black}}, false},
+	} {
+		b, err := tc.m.MarshalCBOR()
+		if !tc.ok {
+			if _, ok := err.(InvalidError); !ok {
+				t.Errorf("%s: got %v, want an InvalidError", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var m1 Image
+		if err := m1.UnmarshalCBOR(b); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestUnmarshalCBOR(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bw := color.Palette{color.White, color.Black}
+	for i := 0; i < 20; i++ {
+		p := New(image.Rect(r.Intn(100)-50, r.Intn(100)-50, 50+r.Intn(60), 50+r.Intn(10)), bw)
+		r.Read(p.Pix)
+		// A sub-image has a stride wider than its rows need.
+		m := p.SubImage(image.Rect(p.Rect.Min.X+8*r.Intn(3), p.Rect.Min.Y+r.Intn(5), p.Rect.Max.X-r.Intn(20), p.Rect.Max.Y))
+		b, err := m.MarshalCBOR()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m1 Image
+		if err := m1.UnmarshalCBOR(b); err != nil {
+			t.Fatalf("%v: %v", m.Rect, err)
+		}
+		if m1.Rect != m.Rect || m1.Stride != (m.Rect.Dx()+7)/8 {
+			t.Fatalf("%v: got %v, stride %d", m.Rect, m1.Rect, m1.Stride)
+		}
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+				if m1.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) {
+					t.Fatalf("%v: pixel (%d, %d) differs", m.Rect, x, y)
+				}
+			}
+		}
+		if r, g, b, a := m1.Palette[1].RGBA(); r|g|b != 0 || a != 0xffff {
+			t.Fatalf("%v: black is %v", m.Rect, m1.Palette[1])
+		}
+	}
+
+	// Untagged, with a wider stride.
+	var m Image
+	if err := m.UnmarshalCBOR([]byte{0x84, 0x84, 0, 0, 9, 1, 3, 0x82, 0x1a, 0xff, 0xff, 0xff, 0xff, 0x18, 0xff, 0x43, 0xff, 0x80, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Stride != 3 || m.ColorIndexAt(8, 0) != 1 || m.Validate() != nil {
+		t.Errorf("untagged: %+v", m)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"other tag", []byte{0xc1, 0x84}},
+		{"map", []byte{0xa0}},
+		{"short", []byte{0x84, 0x84, 0, 0, 8, 1, 1, 0x81, 0}},
+		{"indefinite", []byte{0x84, 0x9f}},
+		{"huge string", []byte{0x84, 0x84, 0, 0, 8, 1, 1, 0x81, 0, 0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"few pixels", []byte{0x84, 0x84, 0, 0, 8, 2, 1, 0x81, 0, 0x41, 0}},
+		{"dirty padding", []byte{0x84, 0x84, 0, 0, 7, 1, 1, 0x82, 0, 0, 0x41, 1}},
+		{"trailing", []byte{0x84, 0x84, 0, 0, 8, 1, 1, 0x81, 0, 0x41, 0, 0}},
+	} {
+		var m Image
+		if err := m.UnmarshalCBOR(tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
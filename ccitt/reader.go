@@ -0,0 +1,534 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ccitt implements the ITU-T T.4 (CCITT Group 3) and T.6 (CCITT
+// Group 4) bilevel image codecs over packed rows, independently of any
+// container format.
+//
+// Rows are laid out as in img1b.Image: each row starts at a byte boundary,
+// the leftmost pixel is the most significant bit and rows are Stride bytes
+// apart. Set bits are black unless Options.Invert is set.
+//
+// The coding parameters follow the ones of the PDF CCITTFaxDecode filter.
+//
+// The specifications are at https://www.itu.int/rec/T-REC-T.4 and
+// https://www.itu.int/rec/T-REC-T.6.
+package ccitt
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io"
+)
+
+// A FormatError reports that the input is not valid CCITT coded data.
+type FormatError string
+
+func (e FormatError) Error() string { return "ccitt: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "ccitt: unsupported feature: " + string(e) }
+
+// Options are the coding parameters. A nil *Options means T.6 coding with
+// the zero values of the other fields.
+type Options struct {
+	// K selects the coding scheme, as in the PDF CCITTFaxDecode filter:
+	// K < 0 is pure two-dimensional T.6 coding (Group 4, MMR), K = 0 is
+	// one-dimensional T.4 coding (Group 3, MH) and K > 0 is mixed T.4 coding
+	// (Group 3, MR) where every Kth row is coded one-dimensionally. On
+	// decoding with K > 0 each row is coded as its tag bit says.
+	K int
+
+	// EndOfLine makes the encoder write an EOL code before each T.4 row.
+	// Fax transmissions need it; TIFF CCITT RLE data has none. The decoder
+	// accepts EOLs anyway, but with EncodedByteAlign it needs EndOfLine to
+	// tell fill bits from row padding.
+	EndOfLine bool
+
+	// EncodedByteAlign makes each coded row start at a byte boundary. With
+	// EOLs, fill bits are inserted before the EOL code instead.
+	EncodedByteAlign bool
+
+	// EndOfBlock makes the encoder finish the data with the end of block
+	// marker: RTC (six EOLs) for T.4 and EOFB (two EOLs) for T.6.
+	EndOfBlock bool
+
+	// Invert makes set bits white and clear bits black.
+	Invert bool
+
+	// Limits, if not nil, bounds the size of the images Decode makes.
+	// Images of unknown height are rejected with an img1b.LimitError as
+	// soon as their rows go over the limits. The encoder ignores it.
+	Limits *img1b.Limits
+}
+
+// bitReader reads bits most significant first.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (b *bitReader) bit() (int, error) {
+	i := b.pos >> 3
+	if i >= len(b.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := int(b.data[i]>>uint(7-b.pos&7)) & 1
+	b.pos++
+	return v, nil
+}
+
+// decode reads a code and returns its value.
+func (b *bitReader) decode(t huffTree) (int, error) {
+	n := 0
+	for {
+		v, err := b.bit()
+		if err != nil {
+			return 0, err
+		}
+		n = int(t[n].child[v])
+		if n == 0 {
+			return 0, errBadCode
+		}
+		if t[n].child[0] == 0 && t[n].child[1] == 0 {
+			return int(t[n].value), nil
+		}
+	}
+}
+
+// run reads a complete run length of the given color: any makeup codes
+// followed by a terminating code.
+func (b *bitReader) run(black bool) (int, error) {
+	t := whiteTree
+	if black {
+		t = blackTree
+	}
+	total := 0
+	for {
+		n, err := b.decode(t)
+		if err != nil {
+			return 0, err
+		}
+		if n == runEOL {
+			return 0, errUnexpectedEOL
+		}
+		total += n
+		if n < 64 {
+			return total, nil
+		}
+	}
+}
+
+var (
+	errBadCode       = FormatError("bad code")
+	errUnexpectedEOL = FormatError("unexpected EOL")
+	errBadRow        = FormatError("row does not match width")
+)
+
+// A decoder decodes CCITT coded rows into packed rows. It keeps the
+// changing elements of the reference row, the positions where the color
+// changes; the first one is a change to black.
+type decoder struct {
+	br        bitReader
+	width     int
+	k         int
+	byteAlign bool
+	eol       bool
+	invert    bool
+	eofb      bool  // an end of block marker was found
+	ref       []int // reference row changing elements, with sentinels
+	cur       []int // coding row changing elements
+}
+
+func newDecoder(data []byte, width int, opt *Options) *decoder {
+	d := &decoder{
+		br:    bitReader{data: data},
+		width: width,
+		k:     -1,
+	}
+	if opt != nil {
+		d.k = opt.K
+		d.byteAlign = opt.EncodedByteAlign
+		d.eol = opt.EndOfLine
+		d.invert = opt.Invert
+	}
+	d.reset()
+	return d
+}
+
+// reset makes the reference row all white.
+func (d *decoder) reset() {
+	d.ref = append(d.ref[:0], d.width, d.width)
+}
+
+// b1 returns the index in d.ref of the first changing element to the right of
+// a0 with the color opposite to that of a0.
+func (d *decoder) b1(a0 int, black bool, start int) int {
+	i := start
+	for i > 0 && d.ref[i-1] > a0 {
+		i--
+	}
+	for d.ref[i] <= a0 && d.ref[i] < d.width {
+		i++
+	}
+	// Changes to black have even indices.
+	if (i&1 == 1) != black {
+		i++
+	}
+	if i >= len(d.ref) {
+		i = len(d.ref) - 1
+	}
+	return i
+}
+
+// decode2D decodes a two-dimensionally coded row, as per ITU-T T.4
+// section 4.2, into d.cur.
+func (d *decoder) decode2D() error {
+	d.cur = d.cur[:0]
+	a0, black := -1, false
+	bi := 0
+	for a0 < d.width {
+		mode, err := d.br.decode(modeTree)
+		if err != nil {
+			return err
+		}
+		bi = d.b1(a0, black, bi)
+		b1 := d.ref[bi]
+		b2 := d.width
+		if bi+1 < len(d.ref) {
+			b2 = d.ref[bi+1]
+		}
+		switch mode {
+		case modePass:
+			a0 = b2
+		case modeHoriz:
+			if a0 < 0 {
+				a0 = 0
+			}
+			r1, err := d.br.run(black)
+			if err != nil {
+				return err
+			}
+			r2, err := d.br.run(!black)
+			if err != nil {
+				return err
+			}
+			a1 := a0 + r1
+			a2 := a1 + r2
+			if a2 > d.width {
+				return errBadRow
+			}
+			d.cur = append(d.cur, a1, a2)
+			a0 = a2
+		case modeExt:
+			return UnsupportedError("extension mode")
+		case modeEOL:
+			return errUnexpectedEOL
+		default:
+			a1 := b1 + mode - modeV0
+			if mode >= modeVL1 {
+				a1 = b1 - (mode - modeVL1 + 1)
+			}
+			if a1 < 0 || a1 > d.width || a1 < a0 {
+				return errBadRow
+			}
+			d.cur = append(d.cur, a1)
+			a0 = a1
+			black = !black
+		}
+	}
+	return nil
+}
+
+// decode1D decodes a one-dimensionally (Modified Huffman) coded row, as per
+// ITU-T T.4 section 4.1, into d.cur.
+func (d *decoder) decode1D() error {
+	d.cur = d.cur[:0]
+	a0, black := 0, false
+	for a0 < d.width {
+		r, err := d.br.run(black)
+		if err != nil {
+			return err
+		}
+		a0 += r
+		if a0 > d.width {
+			return errBadRow
+		}
+		if a0 < d.width {
+			d.cur = append(d.cur, a0)
+		}
+		black = !black
+	}
+	return nil
+}
+
+// skipEOL consumes an EOL code preceded by any number of fill bits and
+// reports whether it was found. Nothing is consumed if there is no EOL.
+func (d *decoder) skipEOL() bool {
+	pos := d.br.pos
+	zeros := 0
+	for {
+		v, err := d.br.bit()
+		if err != nil {
+			break
+		}
+		if v == 1 {
+			if zeros >= 11 {
+				return true
+			}
+			break
+		}
+		zeros++
+	}
+	d.br.pos = pos
+	return false
+}
+
+// align skips to the next byte boundary.
+func (d *decoder) align() {
+	d.br.pos = (d.br.pos + 7) &^ 7
+}
+
+// finishRow makes the coding row the reference row and writes it to row.
+func (d *decoder) finishRow(row []byte) {
+	fillRow(row, d.cur, d.width)
+	if d.invert {
+		flipBits(row, 0, d.width)
+	}
+	d.ref, d.cur = d.cur, d.ref
+	d.ref = append(d.ref, d.width, d.width)
+}
+
+// fillRow writes a row given by its changing elements. Black pixels are
+// set bits.
+func fillRow(row []byte, changes []int, width int) {
+	rowBytes := (width + 7) / 8
+	for i := range row[:rowBytes] {
+		row[i] = 0
+	}
+	for i := 0; i < len(changes); i += 2 {
+		x0 := changes[i]
+		x1 := width
+		if i+1 < len(changes) {
+			x1 = changes[i+1]
+		}
+		if x1 > width {
+			x1 = width
+		}
+		flipBits(row, x0, x1)
+	}
+}
+
+// flipBits flips bits [x0, x1) of row.
+func flipBits(row []byte, x0, x1 int) {
+	if x0 >= x1 {
+		return
+	}
+	i0, i1 := x0/8, (x1-1)/8
+	m0 := byte(0xff) >> uint(x0%8)
+	m1 := byte(0xff) << uint(7-(x1-1)%8)
+	if i0 == i1 {
+		row[i0] ^= m0 & m1
+		return
+	}
+	row[i0] ^= m0
+	for i := i0 + 1; i < i1; i++ {
+		row[i] ^= 0xff
+	}
+	row[i1] ^= m1
+}
+
+// errEnd is returned by row when the data ends, either with an end of block
+// marker or with nothing but zero padding.
+var errEnd = FormatError("end of data")
+
+// atEnd reports whether the rest of the data consists of zero bits only.
+func (d *decoder) atEnd() bool {
+	i := d.br.pos >> 3
+	if i >= len(d.br.data) {
+		return true
+	}
+	if d.br.data[i]<<uint(d.br.pos&7) != 0 {
+		return false
+	}
+	for _, c := range d.br.data[i+1:] {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// row decodes the next row into dst.
+func (d *decoder) row(dst []byte) error {
+	if d.atEnd() {
+		return errEnd
+	}
+	var err error
+	if d.k < 0 {
+		if d.byteAlign {
+			d.align()
+		}
+		if d.skipEOL() {
+			// EOFB.
+			d.eofb = true
+			return errEnd
+		}
+		err = d.decode2D()
+	} else {
+		// EOLs are optional in T.4 data read by this package. Without them
+		// aligned rows are padded, which may look like the start of an EOL.
+		if d.byteAlign && !d.eol {
+			d.align()
+		}
+		eol := d.skipEOL()
+		oneD := true
+		if d.k > 0 {
+			v, err := d.br.bit()
+			if err != nil {
+				return err
+			}
+			oneD = v == 1
+		}
+		if eol {
+			// A second EOL is a part of RTC.
+			pos := d.br.pos
+			if d.skipEOL() {
+				d.eofb = true
+				return errEnd
+			}
+			d.br.pos = pos
+			if d.atEnd() {
+				return errEnd
+			}
+		}
+		if oneD {
+			err = d.decode1D()
+		} else {
+			err = d.decode2D()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d.finishRow(dst)
+	return nil
+}
+
+// DecodeRows decodes height rows of src into dst, stride bytes apart, and
+// returns the number of rows decoded. Decoding stops early without an error
+// if an end of block marker is found. If the data runs out before that,
+// io.ErrUnexpectedEOF is returned.
+func DecodeRows(dst []byte, stride, width, height int, src []byte, opt *Options) (int, error) {
+	if width <= 0 || height < 0 || stride < (width+7)/8 || len(dst) < stride*(height-1)+(width+7)/8 {
+		return 0, FormatError("bad dimensions")
+	}
+	d := newDecoder(src, width, opt)
+	for y := 0; y < height; y++ {
+		if err := d.row(dst[y*stride:]); err != nil {
+			if err == errEnd {
+				if d.eofb {
+					return y, nil
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			return y, err
+		}
+	}
+	return height, nil
+}
+
+// A RowReader decodes CCITT data one row at a time, for converting images
+// too large to be held whole.
+type RowReader struct {
+	d   *decoder
+	err error // sticky
+}
+
+// NewRowReader returns a RowReader of the rows of src, width pixels wide.
+func NewRowReader(src []byte, width int, opt *Options) (*RowReader, error) {
+	if width <= 0 {
+		return nil, FormatError("bad dimensions")
+	}
+	return &RowReader{d: newDecoder(src, width, opt)}, nil
+}
+
+// Width returns the width of the rows in pixels.
+func (r *RowReader) Width() int { return r.d.width }
+
+// ReadRow decodes the next row into dst, black pixels being set bits. It
+// returns io.EOF after the last row, at an end of block marker or the end
+// of the data.
+func (r *RowReader) ReadRow(dst []byte) error {
+	if len(dst) < (r.d.width+7)/8 {
+		return FormatError("short row")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.d.row(dst)
+	if r.err == errEnd {
+		r.err = io.EOF
+	}
+	return r.err
+}
+
+// Decode decodes src into a new image of the given width. If height is zero
+// or less, rows are decoded until an end of block marker or the end of the
+// data. The image palette is {white, black}.
+func Decode(src []byte, width, height int, opt *Options) (*img1b.Image, error) {
+	p := color.Palette{color.White, color.Black}
+	var l *img1b.Limits
+	if opt != nil {
+		l = opt.Limits
+	}
+	if height > 0 {
+		m, err := l.New(image.Rect(0, 0, width, height), p)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := DecodeRows(m.Pix, m.Stride, width, height, src, opt); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if width <= 0 {
+		return nil, FormatError("bad dimensions")
+	}
+	stride := (width + 7) / 8
+	d := newDecoder(src, width, opt)
+	var pix []byte
+	for {
+		y := len(pix) / stride
+		pix = append(pix, make([]byte, stride)...)
+		if err := d.row(pix[y*stride:]); err != nil {
+			if err != errEnd {
+				return nil, err
+			}
+			pix = pix[:y*stride]
+			break
+		}
+		if err := l.Check(width, y+1); err != nil {
+			return nil, err
+		}
+	}
+	if l != nil && l.Alloc != nil {
+		m, err := l.New(image.Rect(0, 0, width, len(pix)/stride), p)
+		if err != nil {
+			return nil, err
+		}
+		copy(m.Pix, pix)
+		return m, nil
+	}
+	return &img1b.Image{
+		Pix:     pix,
+		Stride:  stride,
+		Rect:    image.Rect(0, 0, width, len(pix)/stride),
+		Palette: p,
+	}, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccitt
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"io"
+	"testing"
+)
+
+// bitString packs a string of '0' and '1' into bytes, ignoring spaces.
+func bitString(s string) []byte {
+	var b []byte
+	n := 0
+	for _, c := range s {
+		if c != '0' && c != '1' {
+			continue
+		}
+		if n%8 == 0 {
+			b = append(b, 0)
+		}
+		if c == '1' {
+			b[n/8] |= 0x80 >> uint(n%8)
+		}
+		n++
+	}
+	return b
+}
+
+const eolBits = "000000000001 "
+
+// twoD is an 8x3 image coded with K > 0 and terminated with RTC.
+var twoD = bitString(
+	// Row 0, 1D: white 2, black 3, white 3.
+	eolBits + "1 0111 10 1000 " +
+		// Row 1, 2D: V0, V0, V0.
+		eolBits + "0 1 1 1 " +
+		// Row 2, 2D with fill bits: horizontal mode, white 8, black 0.
+		"0000" + eolBits + "0 001 10011 0000110111 " +
+		eolBits + "1" + eolBits + "1" + eolBits + "1" + eolBits + "1" + eolBits + "1" + eolBits + "1")
+
+func TestDecodeRowsTwoDimensional(t *testing.T) {
+	dst := make([]byte, 3)
+	n, err := DecodeRows(dst, 1, 8, 3, twoD, &Options{K: 2})
+	if err != nil || n != 3 {
+		t.Fatalf("got %d rows, %v", n, err)
+	}
+	if want := []byte{0x38, 0x38, 0x00}; !bytes.Equal(dst, want) {
+		t.Errorf("got %x, want %x", dst, want)
+	}
+}
+
+func TestRowReader(t *testing.T) {
+	r, err := NewRowReader(twoD, 8, &Options{K: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Width() != 8 {
+		t.Errorf("width %d", r.Width())
+	}
+	var got []byte
+	row := make([]byte, 1)
+	for {
+		err := r.ReadRow(row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row...)
+	}
+	if want := []byte{0x38, 0x38, 0x00}; !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+	if err := r.ReadRow(row); err != io.EOF {
+		t.Errorf("after the end: %v", err)
+	}
+	if _, err := NewRowReader(twoD, 0, nil); err == nil {
+		t.Error("zero width: no error")
+	}
+}
+
+func TestDecodeEndOfBlock(t *testing.T) {
+	// Rows past RTC are not decoded.
+	dst := make([]byte, 5)
+	n, err := DecodeRows(dst, 1, 8, 5, twoD, &Options{K: 2})
+	if err != nil || n != 3 {
+		t.Errorf("got %d rows, %v, want 3 rows", n, err)
+	}
+	m, err := Decode(twoD, 8, 0, &Options{K: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dy() != 3 {
+		t.Errorf("got height %d, want 3", m.Bounds().Dy())
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	allocs := 0
+	l := &img1b.Limits{MaxPixels: 8 * 3, Alloc: func(n int) []byte {
+		allocs++
+		return make([]byte, n)
+	}}
+	for _, height := range []int{3, 0} {
+		if _, err := Decode(twoD, 8, height, &Options{K: 2, Limits: l}); err != nil {
+			t.Errorf("height %d, at the limit: %v", height, err)
+		}
+	}
+	if allocs != 2 {
+		t.Errorf("%d allocations, want 2", allocs)
+	}
+	l.MaxPixels--
+	for _, height := range []int{3, 0} {
+		_, err := Decode(twoD, 8, height, &Options{K: 2, Limits: l})
+		if _, ok := err.(img1b.LimitError); !ok {
+			t.Errorf("height %d: got %v, want LimitError", height, err)
+		}
+	}
+}
+
+func TestDecodeInvert(t *testing.T) {
+	dst := make([]byte, 3)
+	if _, err := DecodeRows(dst, 1, 7, 3, twoD, &Options{K: 2, Invert: true}); err == nil {
+		t.Error("wrong width: got nil error")
+	}
+	if _, err := DecodeRows(dst, 1, 8, 3, twoD, &Options{K: 2, Invert: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xc7, 0xc7, 0xff}; !bytes.Equal(dst, want) {
+		t.Errorf("got %x, want %x", dst, want)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	src := EncodeRows(testRows, testStride, testWidth, testHeight, nil)
+	dst := make([]byte, len(testRows)+testStride)
+	for _, n := range []int{0, 1, len(src) / 2} {
+		_, err := DecodeRows(dst, testStride, testWidth, testHeight, src[:n], nil)
+		if err == nil {
+			t.Errorf("%d bytes: got nil error", n)
+		}
+	}
+	// Data without an end of block marker ends cleanly at the last row.
+	src = EncodeRows(testRows, testStride, testWidth, testHeight, &Options{K: -1})
+	if _, err := DecodeRows(dst, testStride, testWidth, testHeight+1, src, nil); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	m, err := Decode(src, testWidth, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dy() != testHeight {
+		t.Errorf("got height %d, want %d", m.Bounds().Dy(), testHeight)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccitt
+
+import (
+	"math/bits"
+)
+
+// bitWriter accumulates bits most significant first.
+type bitWriter struct {
+	buf  []byte
+	acc  uint64
+	nacc uint
+}
+
+func (w *bitWriter) write(c code) {
+	w.acc = w.acc<<c.n | uint64(c.bits)
+	w.nacc += uint(c.n)
+	for w.nacc >= 8 {
+		w.nacc -= 8
+		w.buf = append(w.buf, byte(w.acc>>w.nacc))
+	}
+}
+
+// align pads the output with zero bits to a byte boundary.
+func (w *bitWriter) align() {
+	if w.nacc > 0 {
+		w.write(code{0, uint8(8 - w.nacc)})
+	}
+}
+
+// run writes a run length of the given color.
+func (w *bitWriter) run(n int, black bool) {
+	rc := whiteRunCodes
+	if black {
+		rc = blackRunCodes
+	}
+	for n >= 2560+64 {
+		w.write(rc.makeup[2560/64])
+		n -= 2560
+	}
+	if n >= 64 {
+		w.write(rc.makeup[n/64])
+	}
+	w.write(rc.term[n%64])
+}
+
+// rowChanges appends the changing elements of a packed row to changes. Set
+// bits are black; if invert is true they are white.
+func rowChanges(changes []int, row []byte, width int, invert bool) []int {
+	var xor, prev byte
+	if invert {
+		xor = 0xff
+	}
+	rowBytes := (width + 7) / 8
+	for i, b := range row[:rowBytes] {
+		b ^= xor
+		t := b ^ (b>>1 | prev<<7)
+		for t != 0 {
+			z := bits.LeadingZeros8(t)
+			x := i*8 + z
+			if x >= width {
+				break
+			}
+			changes = append(changes, x)
+			t &^= 0x80 >> uint(z)
+		}
+		prev = b & 1
+	}
+	return changes
+}
+
+// An encoder codes packed rows.
+type encoder struct {
+	bw     bitWriter
+	width  int
+	invert bool
+	ref    []int // reference row changing elements, with sentinels
+	cur    []int // coding row changing elements, with sentinels
+}
+
+func newEncoder(width int, invert bool) *encoder {
+	e := &encoder{
+		width:  width,
+		invert: invert,
+	}
+	e.ref = append(e.ref, width, width)
+	return e
+}
+
+// encode1D codes a row one-dimensionally and makes it the reference row.
+func (e *encoder) encode1D(row []byte) {
+	e.cur = append(rowChanges(e.cur[:0], row, e.width, e.invert), e.width, e.width)
+	a0, black := 0, false
+	for _, a1 := range e.cur[:len(e.cur)-2] {
+		e.bw.run(a1-a0, black)
+		a0, black = a1, !black
+	}
+	e.bw.run(e.width-a0, black)
+	e.ref, e.cur = e.cur, e.ref
+}
+
+// encode2D codes a row two-dimensionally and makes it the reference row.
+func (e *encoder) encode2D(row []byte) {
+	e.cur = append(rowChanges(e.cur[:0], row, e.width, e.invert), e.width, e.width)
+	a0, black := -1, false
+	ai, bi := 0, 0
+	for a0 < e.width {
+		// a1 is the next changing element of the coding row.
+		for e.cur[ai] <= a0 && e.cur[ai] < e.width {
+			ai++
+		}
+		a1 := e.cur[ai]
+		// b1 is the first changing element of the reference row to the right
+		// of a0 and of the opposite color; changes to black have even indices.
+		for bi > 0 && e.ref[bi-1] > a0 {
+			bi--
+		}
+		for e.ref[bi] <= a0 && e.ref[bi] < e.width {
+			bi++
+		}
+		if (bi&1 == 1) != black {
+			bi++
+		}
+		if bi >= len(e.ref)-1 {
+			bi = len(e.ref) - 2
+		}
+		b1, b2 := e.ref[bi], e.ref[bi+1]
+
+		switch {
+		case b2 < a1:
+			e.bw.write(modeEncCodes[modePass])
+			a0 = b2
+		case a1-b1 <= 3 && b1-a1 <= 3:
+			switch d := a1 - b1; {
+			case d == 0:
+				e.bw.write(modeEncCodes[modeV0])
+			case d > 0:
+				e.bw.write(modeEncCodes[modeV0+d])
+			default:
+				e.bw.write(modeEncCodes[modeVL1-1-d])
+			}
+			a0 = a1
+			black = !black
+		default:
+			a2 := e.cur[ai+1]
+			if a0 < 0 {
+				a0 = 0
+			}
+			e.bw.write(modeEncCodes[modeHoriz])
+			e.bw.run(a1-a0, black)
+			e.bw.run(a2-a1, !black)
+			a0 = a2
+		}
+	}
+	e.ref, e.cur = e.cur, e.ref
+}
+
+// eol writes an EOL code. If align is set, it is preceded by fill bits so
+// that it ends at a byte boundary.
+func (e *encoder) eol(align bool) {
+	if align {
+		if n := (8 - (e.bw.nacc+12)%8) % 8; n > 0 {
+			e.bw.write(code{0, uint8(n)})
+		}
+	}
+	e.bw.write(eolCode)
+}
+
+// EncodeRows codes height rows of src, stride bytes apart, and returns the
+// coded data. If opt is nil, T.6 (Group 4) coding is used.
+func EncodeRows(src []byte, stride, width, height int, opt *Options) []byte {
+	var o Options
+	if opt != nil {
+		o = *opt
+	} else {
+		o.K = -1
+	}
+	e := newEncoder(width, o.Invert)
+	for y := 0; y < height; y++ {
+		row := src[y*stride:]
+		if o.K < 0 {
+			if o.EncodedByteAlign {
+				e.bw.align()
+			}
+			e.encode2D(row)
+			continue
+		}
+		if o.EndOfLine {
+			e.eol(o.EncodedByteAlign)
+		} else if o.EncodedByteAlign {
+			e.bw.align()
+		}
+		oneD := o.K == 0 || y%o.K == 0
+		if o.K > 0 {
+			// Tag bit telling the coding of the row.
+			if oneD {
+				e.bw.write(code{1, 1})
+			} else {
+				e.bw.write(code{0, 1})
+			}
+		}
+		if oneD {
+			e.encode1D(row)
+		} else {
+			e.encode2D(row)
+		}
+	}
+	if o.EndOfBlock {
+		if o.K < 0 {
+			// EOFB.
+			if o.EncodedByteAlign {
+				e.bw.align()
+			}
+			e.eol(false)
+			e.eol(false)
+		} else {
+			// RTC.
+			for i := 0; i < 6; i++ {
+				e.eol(o.EncodedByteAlign)
+				if o.K > 0 {
+					e.bw.write(code{1, 1})
+				}
+			}
+		}
+	}
+	e.bw.align()
+	return e.bw.buf
+}
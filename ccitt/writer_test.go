@@ -0,0 +1,105 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ccitt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+const (
+	testWidth  = 75
+	testHeight = 40
+	testStride = 12
+)
+
+// testRows is a pattern of shapes with long and short runs.
+var testRows = func() []byte {
+	pix := make([]byte, testStride*testHeight)
+	for y := 0; y < testHeight; y++ {
+		for x := 0; x < testWidth; x++ {
+			dx, dy := x-30, y-20
+			if dx*dx+dy*dy < 200 || (x+y)%17 == 0 || (y > 30 && x%5 < 2) {
+				pix[y*testStride+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return pix
+}()
+
+var codingTests = []struct {
+	name string
+	opt  *Options
+}{
+	{"default", nil},
+	{"G4", &Options{K: -1}},
+	{"G4 aligned", &Options{K: -1, EncodedByteAlign: true, EndOfBlock: true}},
+	{"MH", &Options{}},
+	{"MH EOL", &Options{EndOfLine: true, EndOfBlock: true}},
+	{"MH aligned", &Options{EncodedByteAlign: true}},
+	{"MH EOL aligned", &Options{EndOfLine: true, EncodedByteAlign: true, EndOfBlock: true}},
+	{"MR", &Options{K: 4}},
+	{"MR EOL", &Options{K: 2, EndOfLine: true, EndOfBlock: true}},
+	{"MR EOL aligned", &Options{K: 4, EndOfLine: true, EncodedByteAlign: true, EndOfBlock: true}},
+	{"inverted", &Options{K: -1, Invert: true}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range codingTests {
+		src := EncodeRows(testRows, testStride, testWidth, testHeight, tt.opt)
+		dst := make([]byte, len(testRows))
+		n, err := DecodeRows(dst, testStride, testWidth, testHeight, src, tt.opt)
+		if err != nil || n != testHeight {
+			t.Errorf("%s: got %d rows, %v", tt.name, n, err)
+			continue
+		}
+		if !bytes.Equal(dst, testRows) {
+			t.Errorf("%s: rows differ", tt.name)
+		}
+		if tt.opt == nil || !tt.opt.EndOfBlock {
+			continue
+		}
+		m, err := Decode(src, testWidth, 0, tt.opt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if m.Bounds().Dy() != testHeight {
+			t.Errorf("%s: got height %d, want %d", tt.name, m.Bounds().Dy(), testHeight)
+		}
+	}
+}
+
+func TestEncodeAligned(t *testing.T) {
+	// Fill bits make each EOL end at a byte boundary.
+	src := EncodeRows(testRows, testStride, testWidth, testHeight,
+		&Options{EndOfLine: true, EncodedByteAlign: true})
+	n := 0
+	for i := 1; i < len(src); i++ {
+		if src[i] == 0x01 && src[i-1]&0x0f == 0 {
+			n++
+		}
+	}
+	if n < testHeight {
+		t.Errorf("found %d aligned EOLs, want at least %d", n, testHeight)
+	}
+}
+
+func TestEncodeTwoDimensionalIsSmaller(t *testing.T) {
+	mh := EncodeRows(testRows, testStride, testWidth, testHeight, &Options{})
+	mmr := EncodeRows(testRows, testStride, testWidth, testHeight, nil)
+	if len(mmr) >= len(mh) {
+		t.Errorf("MMR %d bytes, MH %d bytes", len(mmr), len(mh))
+	}
+}
+
+func BenchmarkEncodeRows(b *testing.B) {
+	b.SetBytes(int64(len(testRows)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ioutil.Discard.Write(EncodeRows(testRows, testStride, testWidth, testHeight, nil))
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command img1b converts bilevel images between the formats supported by
+// the img1b packages and applies simple operations to them.
+//
+// Usage:
+//
+//	img1b [flags] input output
+//
+// The formats are told by the file name extensions, or by the -from and -to
+// flags; input formats are also recognized by their contents. A file name of
+// "-" means the standard input or output. Images that are not bilevel, such
+// as grayscale PNG or JPEG files, are converted with a threshold or by
+// dithering; PNM graymaps and pixmaps always use the threshold.
+//
+// The operations are applied in the order of the flags below:
+//
+//	-threshold n  luminance below which pixels turn black, 0 to 256 (128)
+//	-dither       dither images that are not bilevel instead
+//	-deskew       rotate the image so that its lines of text are horizontal
+//	-despeckle n  remove groups of at most n connected black pixels
+//	-rotate n     rotate clockwise by 90, 180 or 270 degrees
+//	-invert       swap black and white
+//
+// Run img1b -formats for the list of formats.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/bmp"
+	"github.com/mi-v/img1b/g3"
+	"github.com/mi-v/img1b/gif"
+	"github.com/mi-v/img1b/ico"
+	"github.com/mi-v/img1b/jbig2"
+	"github.com/mi-v/img1b/macpaint"
+	"github.com/mi-v/img1b/pcl"
+	"github.com/mi-v/img1b/pdf"
+	"github.com/mi-v/img1b/png"
+	"github.com/mi-v/img1b/pnm"
+	"github.com/mi-v/img1b/pwg"
+	"github.com/mi-v/img1b/scan"
+	"github.com/mi-v/img1b/sixel"
+	"github.com/mi-v/img1b/svg"
+	"github.com/mi-v/img1b/tiff"
+	"github.com/mi-v/img1b/wbmp"
+	"github.com/mi-v/img1b/xbm"
+	"github.com/mi-v/img1b/xpm"
+	"github.com/mi-v/img1b/xwd"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A format is a file format with its decoder, encoder or both.
+type format struct {
+	exts   []string
+	magic  []string // prefixes of the file contents
+	decode func(io.Reader, *config) (*img1b.Image, error)
+	encode func(io.Writer, *img1b.Image) error
+}
+
+// plain adapts a decoder that takes no settings.
+func plain(decode func(io.Reader) (*img1b.Image, error)) func(io.Reader, *config) (*img1b.Image, error) {
+	return func(r io.Reader, _ *config) (*img1b.Image, error) { return decode(r) }
+}
+
+// decodePNM decodes PNM files, making graymaps and pixmaps bilevel with the
+// threshold of c.
+func decodePNM(r io.Reader, c *config) (*img1b.Image, error) {
+	// pnm.Decoder compares 16-bit luminances and takes a zero threshold
+	// as a request to reject graymaps and pixmaps, so the thresholds 0
+	// and 256 keep pure black and pure white pixels.
+	t := c.threshold << 8
+	if t < 1 {
+		t = 1
+	} else if t > 0xffff {
+		t = 0xffff
+	}
+	return (&pnm.Decoder{Threshold: uint16(t)}).Decode(r)
+}
+
+var formats = map[string]*format{
+	"bmp": {exts: []string{".bmp", ".dib"}, magic: []string{"BM"},
+		decode: plain(bmp.Decode), encode: bmp.Encode},
+	"g3": {exts: []string{".g3", ".fax"},
+		decode: func(r io.Reader, _ *config) (*img1b.Image, error) { return g3.Decode(r, nil) },
+		encode: func(w io.Writer, m *img1b.Image) error { return g3.Encode(w, m, nil) }},
+	"gif": {exts: []string{".gif"}, magic: []string{"GIF87a", "GIF89a"},
+		decode: plain(gif.Decode), encode: gif.Encode},
+	"ico": {exts: []string{".ico", ".cur"}, magic: []string{"\x00\x00\x01\x00", "\x00\x00\x02\x00"},
+		decode: plain(ico.Decode)},
+	"jbig2": {exts: []string{".jb2", ".jbig2"}, magic: []string{"\x97JB2\r\n\x1a\n"},
+		decode: plain(jbig2.Decode),
+		encode: func(w io.Writer, m *img1b.Image) error { return jbig2.Encode(w, m, nil) }},
+	"macpaint": {exts: []string{".mac", ".pntg"},
+		decode: plain(macpaint.Decode)},
+	"pcl": {exts: []string{".pcl"},
+		encode: func(w io.Writer, m *img1b.Image) error { return pcl.Encode(w, m, nil) }},
+	"pdf": {exts: []string{".pdf"},
+		encode: func(w io.Writer, m *img1b.Image) error { return pdf.Encode(w, m, nil) }},
+	"png": {exts: []string{".png"}, magic: []string{"\x89PNG\r\n\x1a\n"},
+		decode: plain(png.Decode), encode: png.Encode},
+	"pnm": {exts: []string{".pbm", ".pgm", ".ppm", ".pnm", ".pam"},
+		magic:  []string{"P1", "P2", "P3", "P4", "P5", "P6", "P7"},
+		decode: decodePNM, encode: pnm.Encode},
+	"pwg": {exts: []string{".pwg"}, magic: []string{"RaS2"},
+		encode: func(w io.Writer, m *img1b.Image) error { return pwg.Encode(w, m, nil) }},
+	"sixel": {exts: []string{".six", ".sixel"},
+		encode: func(w io.Writer, m *img1b.Image) error { return sixel.Encode(w, m, nil) }},
+	"svg": {exts: []string{".svg"},
+		encode: func(w io.Writer, m *img1b.Image) error { return svg.Encode(w, m, nil) }},
+	"tiff": {exts: []string{".tif", ".tiff"}, magic: []string{"II*\x00", "MM\x00*"},
+		decode: plain(tiff.Decode),
+		encode: func(w io.Writer, m *img1b.Image) error { return tiff.Encode(w, m, nil) }},
+	"wbmp": {exts: []string{".wbmp"},
+		decode: plain(wbmp.Decode), encode: wbmp.Encode},
+	"xbm": {exts: []string{".xbm"}, magic: []string{"#define"},
+		decode: plain(xbm.Decode), encode: xbm.Encode},
+	"xpm": {exts: []string{".xpm"}, magic: []string{"/* XPM */", "! XPM2"},
+		decode: plain(xpm.Decode), encode: xpm.Encode},
+	"xwd": {exts: []string{".xwd"},
+		decode: plain(xwd.Decode)},
+}
+
+// formatByExt returns the name of the format of files named name.
+func formatByExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for n, f := range formats {
+		for _, e := range f.exts {
+			if e == ext {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+// formatByMagic returns the name of the format of the data.
+func formatByMagic(data []byte) string {
+	for n, f := range formats {
+		for _, m := range f.magic {
+			if bytes.HasPrefix(data, []byte(m)) {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+// config holds the command line settings.
+type config struct {
+	from, to  string
+	threshold int
+	dither    bool
+	deskew    bool
+	despeckle int
+	rotate    int
+	invert    bool
+}
+
+// decode decodes the data, in the named format or in the one recognized.
+// Images the img1b decoders reject are decoded by the standard library, if
+// it can, and made bilevel.
+func decode(data []byte, name string, c *config) (*img1b.Image, error) {
+	fn := name
+	if fn == "" {
+		fn = formatByMagic(data)
+	}
+	var err error
+	if f := formats[fn]; f != nil && f.decode != nil {
+		var m *img1b.Image
+		if m, err = f.decode(bytes.NewReader(data), c); err == nil {
+			return m, nil
+		}
+	} else if name != "" {
+		return nil, fmt.Errorf("can not read %s files", name)
+	}
+	m, _, serr := image.Decode(bytes.NewReader(data))
+	if serr != nil {
+		if err == nil {
+			err = errors.New("unknown format")
+		}
+		return nil, err
+	}
+	if c.dither {
+		return scan.Dither(m), nil
+	}
+	return scan.Threshold(m, c.threshold), nil
+}
+
+// process applies the operations to m.
+func process(m *img1b.Image, c *config) (*img1b.Image, error) {
+	if c.deskew {
+		m = scan.Deskew(m)
+	}
+	if c.despeckle > 0 {
+		m = scan.Despeckle(m, c.despeckle)
+	}
+	switch c.rotate {
+	case 0:
+	case 90, 180, 270:
+		m = rotate(m, c.rotate)
+	default:
+		return nil, fmt.Errorf("can not rotate by %d degrees", c.rotate)
+	}
+	if c.invert {
+		m = invert(m)
+	}
+	return m, nil
+}
+
+// run converts the input file to the output file.
+func run(in, out string, c *config) error {
+	var data []byte
+	var err error
+	if in == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(in)
+	}
+	if err != nil {
+		return err
+	}
+	from := c.from
+	if from == "" && in != "-" {
+		from = formatByExt(in)
+	}
+	to := c.to
+	if to == "" && out != "-" {
+		to = formatByExt(out)
+	}
+	f := formats[to]
+	if f == nil || f.encode == nil {
+		if to == "" {
+			return errors.New("unknown output format, use -to")
+		}
+		return fmt.Errorf("can not write %s files", to)
+	}
+
+	m, err := decode(data, from, c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+	if m, err = process(m, c); err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if out != "-" {
+		if w, err = os.Create(out); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriter(w)
+	err = f.encode(bw, m)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if out != "-" {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", out, err)
+	}
+	return nil
+}
+
+// listFormats prints the formats and what can be done with them.
+func listFormats(w io.Writer) {
+	var names []string
+	for n := range formats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		f := formats[n]
+		rw := "  "
+		if f.decode != nil {
+			rw = "r" + rw[1:]
+		}
+		if f.encode != nil {
+			rw = rw[:1] + "w"
+		}
+		fmt.Fprintf(w, "%-9s %s  %s\n", n, rw, strings.Join(f.exts, " "))
+	}
+	fmt.Fprintln(w, "Other grayscale and color images are read as GIF, JPEG or PNG.")
+}
+
+func main() {
+	var c config
+	flag.StringVar(&c.from, "from", "", "input `format`")
+	flag.StringVar(&c.to, "to", "", "output `format`")
+	flag.IntVar(&c.threshold, "threshold", 128, "luminance `level` below which pixels turn black")
+	flag.BoolVar(&c.dither, "dither", false, "dither images that are not bilevel")
+	flag.BoolVar(&c.deskew, "deskew", false, "straighten lines of text")
+	flag.IntVar(&c.despeckle, "despeckle", 0, "remove groups of at most `n` black pixels")
+	flag.IntVar(&c.rotate, "rotate", 0, "rotate clockwise by `degrees`: 90, 180 or 270")
+	flag.BoolVar(&c.invert, "invert", false, "swap black and white")
+	list := flag.Bool("formats", false, "list the formats")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: img1b [flags] input output")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *list {
+		listFormats(os.Stdout)
+		return
+	}
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), &c); err != nil {
+		fmt.Fprintln(os.Stderr, "img1b:", err)
+		os.Exit(1)
+	}
+}
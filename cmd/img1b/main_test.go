@@ -0,0 +1,34 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodePNM(t *testing.T) {
+	for _, tc := range []struct {
+		name, data string
+	}{
+		{"P2", "P2 4 1 255 0 127 128 255\n"},
+		{"P5", "P5 4 1 255\n\x00\x7f\x80\xff"},
+		{"P6", "P6 4 1 255\n\x00\x00\x00\x7f\x7f\x7f\x80\x80\x80\xff\xff\xff"},
+	} {
+		for _, c := range []*config{{threshold: 128}, {threshold: 128, dither: true}} {
+			m, err := decode([]byte(tc.data), "", c)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if m.Rect.Dx() != 4 || m.Rect.Dy() != 1 {
+				t.Fatalf("%s: size %v", tc.name, m.Rect.Size())
+			}
+			for x, want := range []bool{true, true, false, false} {
+				if isBlack(m, x, 0) != want {
+					t.Errorf("%s: pixel %d black %v, want %v", tc.name, x, !want, want)
+				}
+			}
+		}
+	}
+}
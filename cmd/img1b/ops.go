@@ -0,0 +1,60 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// blackBits returns a copy of m at the origin with black pixels set and
+// zero padding.
+func blackBits(m *img1b.Image) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	d := img1b.New(image.Rect(0, 0, w, h), bitmap.Palette())
+	bitmap.CopyBlack(d.Pix, d.Stride, m.Pix, m.Stride, w, h, m.Palette)
+	return d
+}
+
+// invert swaps black and white.
+func invert(m *img1b.Image) *img1b.Image {
+	d := blackBits(m)
+	for i := range d.Pix {
+		d.Pix[i] = ^d.Pix[i]
+	}
+	return blackBits(d)
+}
+
+// rotate rotates m clockwise by a multiple of 90 degrees.
+func rotate(m *img1b.Image, deg int) *img1b.Image {
+	s := blackBits(m)
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	switch (deg%360 + 360) % 360 {
+	case 90, 270:
+		d := img1b.New(image.Rect(0, 0, h, w), bitmap.Palette())
+		cw := (deg%360+360)%360 == 90
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if !bitmap.Bit(s.Pix, s.Stride, s.Rect, x, y) {
+					continue
+				}
+				dx, dy := h-1-y, x
+				if !cw {
+					dx, dy = y, w-1-x
+				}
+				d.Pix[dy*d.Stride+dx>>3] |= 0x80 >> uint(dx&7)
+			}
+		}
+		return d
+	case 180:
+		d := img1b.New(image.Rect(0, 0, w, h), bitmap.Palette())
+		for y := 0; y < h; y++ {
+			img1b.MirrorRow(d.Pix[(h-1-y)*d.Stride:], s.Pix[y*s.Stride:], w)
+		}
+		return d
+	}
+	return s
+}
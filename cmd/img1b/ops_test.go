@@ -0,0 +1,69 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	return m
+}
+
+// isBlack reports whether the pixel at (x, y) from the top left corner of m
+// is black.
+func isBlack(m *img1b.Image, x, y int) bool {
+	return m.At(m.Rect.Min.X+x, m.Rect.Min.Y+y) == color.Black
+}
+
+func TestRotate(t *testing.T) {
+	for _, p := range []color.Palette{{color.White, color.Black}, {color.Black, color.White}} {
+		m := randImage(13, 7, p)
+		for _, deg := range []int{90, 180, 270} {
+			r := rotate(m, deg)
+			w, h := 13, 7
+			if deg != 180 {
+				w, h = h, w
+			}
+			if r.Rect.Dx() != w || r.Rect.Dy() != h {
+				t.Fatalf("%d: size %v", deg, r.Rect.Size())
+			}
+			for y := 0; y < 7; y++ {
+				for x := 0; x < 13; x++ {
+					var rx, ry int
+					switch deg {
+					case 90:
+						rx, ry = 6-y, x
+					case 180:
+						rx, ry = 12-x, 6-y
+					case 270:
+						rx, ry = y, 12-x
+					}
+					if isBlack(m, x, y) != isBlack(r, rx, ry) {
+						t.Fatalf("%d: pixel (%d, %d) differs", deg, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestInvert(t *testing.T) {
+	m := randImage(11, 5, color.Palette{color.Black, color.White})
+	d := invert(m)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 11; x++ {
+			if isBlack(m, x, y) == isBlack(d, x, y) {
+				t.Fatalf("pixel (%d, %d) not inverted", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"math/bits"
+)
+
+// A Rule tells Combine which pixels to set: those set in at least a number
+// of the frames, which depends on the rule and on the number of frames.
+type Rule int
+
+const (
+	// And sets the pixels set in all the frames.
+	And Rule = -1 - iota
+	// Or sets the pixels set in any of the frames.
+	Or
+	// Majority sets the pixels set in more than half of the frames.
+	Majority
+)
+
+// AtLeast returns the rule setting the pixels set in at least k of the
+// frames, k from 1 up. Combining fewer than k frames sets no pixel.
+func AtLeast(k int) Rule {
+	if k < 1 {
+		k = 1
+	}
+	return Rule(k)
+}
+
+// threshold returns the number of the n frames a pixel has to be set in.
+func (r Rule) threshold(n int) int {
+	switch r {
+	case And:
+		return n
+	case Or:
+		return 1
+	case Majority:
+		return n/2 + 1
+	}
+	if r < 1 {
+		return 1
+	}
+	return int(r)
+}
+
+// Combine returns an image whose pixels are set, of color index 1, as rule
+// tells from the pixels of the frames at the same place: the frames are
+// stacked, as for the temporal denoising of binarized video frames or the
+// consensus of masks. Color indices are combined; the palettes are not
+// looked at, and the image has the palette of the first frame. Its bounds
+// are those the frames have in common. Combine returns nil for no frames.
+func Combine(frames []*Image, rule Rule) *Image {
+	if len(frames) == 0 {
+		return nil
+	}
+	r := frames[0].Rect
+	for _, f := range frames[1:] {
+		r = r.Intersect(f.Rect)
+	}
+	d := New(r, frames[0].Palette)
+	w, h := r.Dx(), r.Dy()
+	if w <= 0 || h <= 0 {
+		return d
+	}
+	n := (w + 7) / 8
+	k := rule.threshold(len(frames))
+	if k > len(frames) {
+		return d
+	}
+	// The count of the frames each pixel is set in is kept bit-sliced: the
+	// bits of weight 1<<i of the counts of a row are in plane i.
+	planes := make([][]byte, bits.Len(uint(len(frames))))
+	for i := range planes {
+		planes[i] = make([]byte, n)
+	}
+	tmp := make([]byte, n)
+	carry := make([]byte, n)
+	for y := 0; y < h; y++ {
+		for _, p := range planes {
+			for i := range p {
+				p[i] = 0
+			}
+		}
+		for _, f := range frames {
+			src := frameRow(f, r.Min.X, r.Min.Y+y, w, tmp)
+			copy(carry, src)
+			for _, p := range planes {
+				for i, c := range carry {
+					p[i], carry[i] = p[i]^c, p[i]&c
+				}
+			}
+		}
+		// count >= k, comparing from the top bit: gt has the counts found
+		// greater, eq those equal so far.
+		row := d.Pix[y*d.Stride : y*d.Stride+n]
+		eq := carry
+		for i := range eq {
+			row[i], eq[i] = 0, 0xff
+		}
+		for b := len(planes) - 1; b >= 0; b-- {
+			p := planes[b]
+			if k>>uint(b)&1 != 0 {
+				bitmap.And(eq, p)
+				continue
+			}
+			for i := range row {
+				row[i] |= eq[i] & p[i]
+				eq[i] &^= p[i]
+			}
+		}
+		bitmap.Or(row, eq)
+		row[n-1] &= bitmap.TailMask(w)
+	}
+	return d
+}
+
+// frameRow returns the w pixels of f from (x, y) on, as a row of bits from
+// the first byte, using tmp if they are not on a byte boundary.
+func frameRow(f *Image, x, y, w int, tmp []byte) []byte {
+	sx := x - f.Rect.Min.X
+	src := f.Pix[(y-f.Rect.Min.Y)*f.Stride:]
+	if sx&7 == 0 {
+		return src[sx>>3 : sx>>3+len(tmp)]
+	}
+	for i := range tmp {
+		tmp[i] = 0
+	}
+	copyRowBits(tmp, 0, src, sx, w)
+	return tmp
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bw := color.Palette{color.White, color.Black}
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		// Frames of bounds and alignments of their own, with dirty padding.
+		var frames []*Image
+		common := image.Rect(-100, -100, 100, 100)
+		for i := 0; i < n; i++ {
+			b := image.Rect(r.Intn(11)-5, r.Intn(5), 40+r.Intn(30), 10+r.Intn(5))
+			f := New(b, bw)
+			r.Read(f.Pix)
+			frames = append(frames, f)
+			common = common.Intersect(b)
+		}
+		for _, rule := range []Rule{And, Or, Majority, AtLeast(2), AtLeast(n), AtLeast(n + 1)} {
+			d := Combine(frames, rule)
+			if d.Rect != common {
+				t.Fatalf("%d frames, rule %d: bounds %v, want %v", n, rule, d.Rect, common)
+			}
+			if err := d.Validate(); err != nil {
+				t.Errorf("%d frames, rule %d: %v", n, rule, err)
+			}
+			k := map[Rule]int{And: n, Or: 1, Majority: n/2 + 1}[rule]
+			if rule > 0 {
+				k = int(rule)
+			}
+			for y := common.Min.Y; y < common.Max.Y; y++ {
+				for x := common.Min.X; x < common.Max.X; x++ {
+					c := 0
+					for _, f := range frames {
+						c += int(f.ColorIndexAt(x, y))
+					}
+					want := uint8(0)
+					if c >= k {
+						want = 1
+					}
+					if got := d.ColorIndexAt(x, y); got != want {
+						t.Fatalf("%d frames, rule %d: pixel (%d, %d) is %d, want %d", n, rule, x, y, got, want)
+					}
+				}
+			}
+		}
+	}
+	if Combine(nil, And) != nil {
+		t.Error("no frames: got an image")
+	}
+	a, b := New(image.Rect(0, 0, 5, 5), bw), New(image.Rect(10, 10, 15, 15), bw)
+	if d := Combine([]*Image{a, b}, Or); !d.Rect.Empty() {
+		t.Errorf("disjoint frames: bounds %v", d.Rect)
+	}
+}
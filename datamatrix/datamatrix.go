@@ -0,0 +1,150 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package datamatrix implements a Data Matrix (ECC 200) generator rendering
+// symbols straight into bilevel images.
+//
+// The 24 square sizes, from 10×10 to 144×144 modules, and the 6 rectangular
+// ones, from 8×18 to 16×48, are generated. Text is coded in ASCII mode,
+// digits in pairs and bytes above 127 after an upper shift, which keeps
+// short numeric part marks in the smallest symbols. A symbol is a matrix of
+// data regions, each framed by a solid L on its left and bottom sides and
+// alternating modules on the others.
+//
+// The format is specified by ISO/IEC 16022.
+package datamatrix
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the data can not be coded.
+type FormatError string
+
+func (e FormatError) Error() string { return "datamatrix: invalid format: " + string(e) }
+
+// A Shape is the shape of the symbols Encode chooses from.
+type Shape int
+
+const (
+	Square Shape = iota
+	Rectangle
+)
+
+// A symbol describes a symbol size.
+type symbol struct {
+	rows, cols int
+	// The data regions, vertically and horizontally.
+	regRows, regCols int
+	// The codewords, and the interleaved blocks they are split in.
+	data, ecc, blocks int
+}
+
+// symbols are the symbol sizes, smallest first within each shape.
+var symbols = []symbol{
+	{10, 10, 1, 1, 3, 5, 1},
+	{12, 12, 1, 1, 5, 7, 1},
+	{14, 14, 1, 1, 8, 10, 1},
+	{16, 16, 1, 1, 12, 12, 1},
+	{18, 18, 1, 1, 18, 14, 1},
+	{20, 20, 1, 1, 22, 18, 1},
+	{22, 22, 1, 1, 30, 20, 1},
+	{24, 24, 1, 1, 36, 24, 1},
+	{26, 26, 1, 1, 44, 28, 1},
+	{32, 32, 2, 2, 62, 36, 1},
+	{36, 36, 2, 2, 86, 42, 1},
+	{40, 40, 2, 2, 114, 48, 1},
+	{44, 44, 2, 2, 144, 56, 1},
+	{48, 48, 2, 2, 174, 68, 1},
+	{52, 52, 2, 2, 204, 84, 2},
+	{64, 64, 4, 4, 280, 112, 2},
+	{72, 72, 4, 4, 368, 144, 4},
+	{80, 80, 4, 4, 456, 192, 4},
+	{88, 88, 4, 4, 576, 224, 4},
+	{96, 96, 4, 4, 696, 272, 4},
+	{104, 104, 4, 4, 816, 336, 6},
+	{120, 120, 6, 6, 1050, 408, 6},
+	{132, 132, 6, 6, 1304, 496, 8},
+	{144, 144, 6, 6, 1558, 620, 10},
+
+	{8, 18, 1, 1, 5, 7, 1},
+	{8, 32, 1, 2, 10, 11, 1},
+	{12, 26, 1, 1, 16, 14, 1},
+	{12, 36, 1, 2, 22, 18, 1},
+	{16, 36, 1, 2, 32, 24, 1},
+	{16, 48, 1, 2, 49, 28, 1},
+}
+
+// region returns the size of the data regions of s in modules.
+func (s symbol) region() (rows, cols int) {
+	return s.rows/s.regRows - 2, s.cols/s.regCols - 2
+}
+
+// A Code is a Data Matrix symbol.
+type Code struct {
+	// Rows and Cols are the size of the symbol in modules.
+	Rows, Cols int
+	bits       []bool
+}
+
+// Black reports whether the module at (x, y) is dark. Modules outside the
+// symbol are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Cols || y >= c.Rows {
+		return false
+	}
+	return c.bits[y*c.Cols+x]
+}
+
+// Image renders the symbol with modules of scale×scale pixels surrounded by
+// a quiet zone of quiet modules. The specification asks for a quiet zone of
+// 1 module. The image palette is {white, black}.
+func (c *Code) Image(scale, quiet int) *img1b.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	if quiet < 0 {
+		quiet = 0
+	}
+	w, h := (c.Cols+2*quiet)*scale, (c.Rows+2*quiet)*scale
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Rows; y++ {
+		y0 := (y + quiet) * scale
+		row := m.Pix[y0*m.Stride : (y0+1)*m.Stride]
+		for x := 0; x < c.Cols; {
+			if !c.Black(x, y) {
+				x++
+				continue
+			}
+			x1 := x + 1
+			for x1 < c.Cols && c.Black(x1, y) {
+				x1++
+			}
+			setBits(row, (x+quiet)*scale, (x1+quiet)*scale)
+			x = x1
+		}
+		for j := 1; j < scale; j++ {
+			copy(m.Pix[(y0+j)*m.Stride:], row)
+		}
+	}
+	return m
+}
+
+// setBits sets bits [x0, x1) of row.
+func setBits(row []byte, x0, x1 int) {
+	i0, i1 := x0/8, (x1-1)/8
+	m0 := byte(0xff) >> uint(x0%8)
+	m1 := byte(0xff) << uint(7-(x1-1)%8)
+	if i0 == i1 {
+		row[i0] |= m0 & m1
+		return
+	}
+	row[i0] |= m0
+	for i := i0 + 1; i < i1; i++ {
+		row[i] = 0xff
+	}
+	row[i1] |= m1
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package datamatrix
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestSymbols(t *testing.T) {
+	for _, s := range symbols {
+		dr, dc := s.region()
+		if (dr+2)*s.regRows != s.rows || (dc+2)*s.regCols != s.cols {
+			t.Errorf("%d×%d: regions do not fit", s.rows, s.cols)
+		}
+		if n := dr * s.regRows * dc * s.regCols / 8; n != s.data+s.ecc {
+			t.Errorf("%d×%d: %d codewords fit, want %d", s.rows, s.cols, n, s.data+s.ecc)
+		}
+		if s.ecc%s.blocks != 0 {
+			t.Errorf("%d×%d: %d blocks", s.rows, s.cols, s.blocks)
+		}
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	for _, s := range symbols {
+		dr, dc := s.region()
+		cells := placement(dr*s.regRows, dc*s.regCols)
+		seen := make(map[int]bool)
+		for _, v := range cells {
+			if v <= cornerDark {
+				continue
+			}
+			if seen[v] {
+				t.Fatalf("%d×%d: bit %d of codeword %d placed twice", s.rows, s.cols, v&7, v>>3-1)
+			}
+			seen[v] = true
+		}
+		if len(seen) != 8*(s.data+s.ecc) {
+			t.Errorf("%d×%d: %d bits placed", s.rows, s.cols, len(seen))
+		}
+	}
+}
+
+func TestCodewords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+	}{
+		{"123456", []byte{142, 164, 186}},
+		{"A1", []byte{66, 50}},
+		{"12345", []byte{142, 164, 54}},
+		{"\xe9", []byte{235, 106}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := asciiCodewords(tt.text); !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	// The example of the specification.
+	got := codewords(symbols[0], pad(asciiCodewords("123456"), 3))
+	if want := []byte{142, 164, 186, 114, 25, 5, 88, 102}; !bytes.Equal(got, want) {
+		t.Errorf("123456: got %v, want %v", got, want)
+	}
+	if got := pad([]byte{66}, 5); !bytes.Equal(got, []byte{66, 129, 70, 220, 115}) {
+		t.Errorf("padding: got %v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text       string
+		s          Shape
+		rows, cols int
+	}{
+		{"123456", Square, 10, 10},
+		{"Hello", Square, 12, 12},
+		{"Hello", Rectangle, 8, 18},
+		{"Part 42", Rectangle, 8, 32},
+		{strings.Repeat("0123456789", 10), Square, 32, 32},
+		{strings.Repeat("x", 1000), Square, 120, 120},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.text, tt.s)
+		if err != nil {
+			t.Errorf("%.20q: %v", tt.text, err)
+			continue
+		}
+		if c.Rows != tt.rows || c.Cols != tt.cols {
+			t.Errorf("%.20q: %d×%d, want %d×%d", tt.text, c.Rows, c.Cols, tt.rows, tt.cols)
+		}
+		// The finder: solid left and bottom sides, alternating top and
+		// right ones.
+		for x := 0; x < c.Cols; x++ {
+			if !c.Black(x, c.Rows-1) {
+				t.Fatalf("%.20q: bottom module %d light", tt.text, x)
+			}
+		}
+		for y := 0; y < c.Rows; y++ {
+			if !c.Black(0, y) || c.Black(c.Cols-1, y) != (y%2 == 1) {
+				t.Fatalf("%.20q: side modules %d wrong", tt.text, y)
+			}
+		}
+	}
+	if _, err := Encode(strings.Repeat("x", 50), Rectangle); err == nil {
+		t.Error("long rectangle: no error")
+	}
+	if _, err := Encode(strings.Repeat("\xff", 1600), Square); err == nil {
+		t.Error("long square: no error")
+	}
+}
+
+func TestImage(t *testing.T) {
+	c, err := Encode("Part 42", Rectangle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Image(3, 1)
+	if m.Rect.Dx() != (c.Cols+2)*3 || m.Rect.Dy() != (c.Rows+2)*3 {
+		t.Fatalf("size %v", m.Rect)
+	}
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			if (m.At(x, y) == color.Black) != c.Black(x/3-1, y/3-1) {
+				t.Fatalf("pixel (%d, %d) wrong", x, y)
+			}
+		}
+	}
+}
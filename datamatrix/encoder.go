@@ -0,0 +1,248 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package datamatrix
+
+// ASCII mode codewords.
+const (
+	padFirst   = 129
+	digitPairs = 130
+	upperShift = 235
+)
+
+// Encode returns the smallest symbol of shape s coding text.
+func Encode(text string, s Shape) (*Code, error) {
+	data := asciiCodewords(text)
+	for _, sym := range symbols {
+		if (sym.rows == sym.cols) != (s == Square) || len(data) > sym.data {
+			continue
+		}
+		return newCode(sym, codewords(sym, pad(data, sym.data))), nil
+	}
+	return nil, FormatError("text too long")
+}
+
+// asciiCodewords codes text in ASCII mode.
+func asciiCodewords(text string) []byte {
+	var res []byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case isDigit(c) && i+1 < len(text) && isDigit(text[i+1]):
+			res = append(res, digitPairs+(c-'0')*10+text[i+1]-'0')
+			i++
+		case c >= 128:
+			res = append(res, upperShift, c-127)
+		default:
+			res = append(res, c+1)
+		}
+	}
+	return res
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// pad pads data to n codewords: the first pad codeword as is, the next ones
+// scrambled by their positions.
+func pad(data []byte, n int) []byte {
+	if len(data) < n {
+		data = append(data, padFirst)
+	}
+	for len(data) < n {
+		v := padFirst + (149*(len(data)+1))%253 + 1
+		if v > 254 {
+			v -= 254
+		}
+		data = append(data, byte(v))
+	}
+	return data
+}
+
+// codewords appends the error correction codewords of the blocks of data
+// to it. Blocks take every blocks-th codeword, data and error correction
+// alike.
+func codewords(s symbol, data []byte) []byte {
+	n := s.ecc / s.blocks
+	div := rsDivisor(n)
+	res := make([]byte, s.data+s.ecc)
+	copy(res, data)
+	for b := 0; b < s.blocks; b++ {
+		var block []byte
+		for i := b; i < s.data; i += s.blocks {
+			block = append(block, data[i])
+		}
+		for j, c := range rsRemainder(block, div) {
+			res[s.data+j*s.blocks+b] = c
+		}
+	}
+	return res
+}
+
+// gfMul multiplies in GF(256) modulo x^8 + x^5 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ z>>7*0x2d
+		z ^= (y >> uint(i) & 1) * x
+	}
+	return z
+}
+
+// rsDivisor returns the generator polynomial of degree n of Reed-Solomon
+// codes, whose roots are 2^1 to 2^n, without its leading coefficient,
+// highest powers first.
+func rsDivisor(n int) []byte {
+	res := make([]byte, n)
+	res[n-1] = 1
+	root := byte(2)
+	for i := 0; i < n; i++ {
+		for j := range res {
+			res[j] = gfMul(res[j], root)
+			if j+1 < n {
+				res[j] ^= res[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return res
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, div []byte) []byte {
+	res := make([]byte, len(div))
+	for _, b := range data {
+		f := b ^ res[0]
+		copy(res, res[1:])
+		res[len(res)-1] = 0
+		for i, c := range div {
+			res[i] ^= gfMul(c, f)
+		}
+	}
+	return res
+}
+
+// newCode returns the symbol of size s holding the codewords.
+func newCode(s symbol, cw []byte) *Code {
+	c := &Code{Rows: s.rows, Cols: s.cols, bits: make([]bool, s.rows*s.cols)}
+	dr, dc := s.region()
+	// The finder and the timing pattern of each region.
+	for ry := 0; ry < s.regRows; ry++ {
+		for rx := 0; rx < s.regCols; rx++ {
+			x0, y0 := rx*(dc+2), ry*(dr+2)
+			for i := 0; i < dc+2; i++ {
+				c.set(x0+i, y0, i%2 == 0)
+				c.set(x0+i, y0+dr+1, true)
+			}
+			for i := 0; i < dr+2; i++ {
+				c.set(x0, y0+i, true)
+				c.set(x0+dc+1, y0+i, i%2 == 1)
+			}
+		}
+	}
+	nrow, ncol := s.regRows*dr, s.regCols*dc
+	for i, v := range placement(nrow, ncol) {
+		r, col := i/ncol, i%ncol
+		dark := v == cornerDark
+		if v > cornerDark {
+			k, bit := v>>3-1, v&7
+			dark = cw[k]>>uint(7-bit)&1 != 0
+		}
+		c.set(col+1+col/dc*2, r+1+r/dr*2, dark)
+	}
+	return c
+}
+
+func (c *Code) set(x, y int, black bool) {
+	c.bits[y*c.Cols+x] = black
+}
+
+// cornerDark marks the dark cells of the fixed pattern filling the bottom
+// right corner of the placement matrix when the codewords leave it empty.
+// The others stay 0.
+const cornerDark = 1
+
+// placement returns the nrow×ncol placement matrix of the codewords, in
+// rows. A cell holds k<<3 | i for bit i, from the most significant one, of
+// codeword k-1.
+func placement(nrow, ncol int) []int {
+	p := &placer{nrow: nrow, ncol: ncol, cells: make([]int, nrow*ncol)}
+	k := 1
+	row, col := 4, 0
+	for {
+		// The corner cases.
+		switch {
+		case row == nrow && col == 0:
+			p.corner(k, [8][2]int{{nrow - 1, 0}, {nrow - 1, 1}, {nrow - 1, 2}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}})
+			k++
+		case row == nrow-2 && col == 0 && ncol%4 != 0:
+			p.corner(k, [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 4}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}})
+			k++
+		case row == nrow-2 && col == 0 && ncol%8 == 4:
+			p.corner(k, [8][2]int{{nrow - 3, 0}, {nrow - 2, 0}, {nrow - 1, 0}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 1}, {2, ncol - 1}, {3, ncol - 1}})
+			k++
+		case row == nrow+4 && col == 2 && ncol%8 == 0:
+			p.corner(k, [8][2]int{{nrow - 1, 0}, {nrow - 1, ncol - 1}, {0, ncol - 3}, {0, ncol - 2}, {0, ncol - 1}, {1, ncol - 3}, {1, ncol - 2}, {1, ncol - 1}})
+			k++
+		}
+		// Sweep up and right, then down and left.
+		for ; row >= 0 && col < ncol; row, col = row-2, col+2 {
+			if row < nrow && col >= 0 && p.cells[row*ncol+col] == 0 {
+				p.utah(row, col, k)
+				k++
+			}
+		}
+		row, col = row+1, col+3
+		for ; row < nrow && col >= 0; row, col = row+2, col-2 {
+			if row >= 0 && col < ncol && p.cells[row*ncol+col] == 0 {
+				p.utah(row, col, k)
+				k++
+			}
+		}
+		row, col = row+3, col+1
+		if row >= nrow && col >= ncol {
+			break
+		}
+	}
+	if p.cells[nrow*ncol-1] == 0 {
+		p.cells[nrow*ncol-1] = cornerDark
+		p.cells[(nrow-1)*ncol-2] = cornerDark
+	}
+	return p.cells
+}
+
+// A placer places codewords in a placement matrix.
+type placer struct {
+	nrow, ncol int
+	cells      []int
+}
+
+// module places bit i of codeword k at (row, col), wrapping around the
+// edges.
+func (p *placer) module(row, col, k, i int) {
+	if row < 0 {
+		row += p.nrow
+		col += 4 - (p.nrow+4)%8
+	}
+	if col < 0 {
+		col += p.ncol
+		row += 4 - (p.ncol+4)%8
+	}
+	p.cells[row*p.ncol+col] = k<<3 | i
+}
+
+// utah places codeword k in the usual shape, whose last bit is at
+// (row, col).
+func (p *placer) utah(row, col, k int) {
+	pos := [8][2]int{{-2, -2}, {-2, -1}, {-1, -2}, {-1, -1}, {-1, 0}, {0, -2}, {0, -1}, {0, 0}}
+	for i, d := range pos {
+		p.module(row+d[0], col+d[1], k, i)
+	}
+}
+
+// corner places codeword k at the given cells.
+func (p *placer) corner(k int, pos [8][2]int) {
+	for i, d := range pos {
+		p.module(d[0], d[1], k, i)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package display converts images to and from the display memory of the
+// SSD1306 and SH1106 monochrome OLED controllers, and sends them to such
+// displays.
+//
+// The display memory is divided in pages of 8 rows. Each byte holds a
+// column of a page, the top pixel in the least significant bit, and the
+// bytes of a page run from left to right. A set bit is a lit pixel, which
+// is white in images: pixels of other colors than black are lit.
+package display
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// A FormatError reports that the image or the display memory does not fit
+// the display.
+type FormatError string
+
+func (e FormatError) Error() string { return "display: invalid format: " + string(e) }
+
+// A Controller is a display controller model.
+type Controller int
+
+const (
+	// SSD1306 has 128 columns of display memory and a horizontal
+	// addressing mode, in which a whole frame is sent at once.
+	SSD1306 Controller = iota
+
+	// SH1106 has 132 columns of display memory, of which 128 wide
+	// displays usually show columns 2 to 129, and only page addressing.
+	SH1106
+)
+
+// columns returns the number of columns of display memory of c.
+func (c Controller) columns() int {
+	if c == SH1106 {
+		return 132
+	}
+	return 128
+}
+
+// maxPages is the number of pages of display memory of both controllers.
+const maxPages = 8
+
+// Options are the parameters of sending images.
+type Options struct {
+	// Controller is the controller of the display.
+	Controller Controller
+
+	// ColumnOffset is the display memory column of the leftmost pixel of
+	// the image, commonly 2 for SH1106 based 128 pixel wide displays.
+	ColumnOffset int
+}
+
+// Framebuffer returns the display memory contents showing m, one page after
+// another and as wide as m. The last page is filled with dark pixels.
+func Framebuffer(m *img1b.Image) []byte {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	pages := (height + 7) / 8
+	fb := make([]byte, pages*width)
+	// Lit pixels are set bits unless set bits are black.
+	invert := bitmap.BlackIndex(m.Palette) == 1
+	tm := bitmap.TailMask(width)
+	rowBytes := (width + 7) / 8
+	var block, cols [8]byte
+	for p := 0; p < pages; p++ {
+		page := fb[p*width : (p+1)*width]
+		for bx := 0; bx < rowBytes; bx++ {
+			for j := range block {
+				y := 8*p + j
+				if y >= height {
+					block[j] = 0
+					continue
+				}
+				b := m.Pix[y*m.Stride+bx]
+				if invert {
+					b = ^b
+				}
+				if bx == rowBytes-1 {
+					b &= tm
+				}
+				block[j] = b
+			}
+			bitmap.Transpose8(cols[:], 1, block[:], 1)
+			// Columns come top pixel first, the controllers want it last.
+			for i := 0; i < 8 && 8*bx+i < width; i++ {
+				page[8*bx+i] = bits.Reverse8(cols[i])
+			}
+		}
+	}
+	return fb
+}
+
+// Decode returns the image shown by display memory contents laid out as
+// returned by Framebuffer, of the given size. The image palette is {black,
+// white}, so set bits are lit pixels.
+func Decode(fb []byte, width, height int) (*img1b.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	pages := (height + 7) / 8
+	if len(fb) < pages*width {
+		return nil, FormatError(fmt.Sprintf("%d bytes of display memory, want %d", len(fb), pages*width))
+	}
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	var block, rows [8]byte
+	for p := 0; p < pages; p++ {
+		page := fb[p*width : (p+1)*width]
+		for bx := 0; bx < m.Stride; bx++ {
+			for i := range block {
+				block[i] = 0
+				if x := 8*bx + i; x < width {
+					block[i] = bits.Reverse8(page[x])
+				}
+			}
+			bitmap.Transpose8(rows[:], 1, block[:], 1)
+			for j := 0; j < 8 && 8*p+j < height; j++ {
+				m.Pix[(8*p+j)*m.Stride+bx] = rows[j]
+			}
+		}
+	}
+	return m, nil
+}
+
+// A Bus carries bytes to a controller, which tells commands from display
+// data by the D/C line on SPI and by a control byte on I2C.
+type Bus interface {
+	Command(b []byte) error
+	Data(b []byte) error
+}
+
+// I2C returns a Bus writing to w the payloads of I2C write transactions,
+// each one in a single Write call: a control byte, 0x00 for commands or
+// 0x40 for display data, followed by the bytes.
+func I2C(w io.Writer) Bus {
+	return i2cBus{w}
+}
+
+type i2cBus struct {
+	w io.Writer
+}
+
+func (b i2cBus) write(control byte, p []byte) error {
+	buf := make([]byte, 1+len(p))
+	buf[0] = control
+	copy(buf[1:], p)
+	_, err := b.w.Write(buf)
+	return err
+}
+
+func (b i2cBus) Command(p []byte) error { return b.write(0x00, p) }
+func (b i2cBus) Data(p []byte) error    { return b.write(0x40, p) }
+
+// Send shows the image m on the display, at the top and at the column
+// given by opt. The display must have been initialized.
+func Send(bus Bus, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || o.ColumnOffset < 0 ||
+		o.ColumnOffset+width > o.Controller.columns() || height > 8*maxPages {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	fb := Framebuffer(m)
+	pages := len(fb) / width
+	c0 := o.ColumnOffset
+	if o.Controller == SSD1306 {
+		// Horizontal addressing mode wraps to the next page at the end of
+		// the column range.
+		cmd := []byte{
+			0x20, 0x00,
+			0x21, byte(c0), byte(c0 + width - 1),
+			0x22, 0, byte(pages - 1),
+		}
+		if err := bus.Command(cmd); err != nil {
+			return err
+		}
+		return bus.Data(fb)
+	}
+	for p := 0; p < pages; p++ {
+		cmd := []byte{0xb0 | byte(p), byte(c0 & 0x0f), 0x10 | byte(c0>>4)}
+		if err := bus.Command(cmd); err != nil {
+			return err
+		}
+		if err := bus.Data(fb[p*width : (p+1)*width]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
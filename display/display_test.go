@@ -0,0 +1,163 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package display
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	return m
+}
+
+// lit reports whether the pixel at (x, y) of m is shown lit.
+func lit(m *img1b.Image, x, y int) bool {
+	return m.At(m.Rect.Min.X+x, m.Rect.Min.Y+y) != color.Black
+}
+
+func TestFramebuffer(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 10, 10), color.Palette{color.Black, color.White})
+	m.SetColorIndex(0, 0, 1)
+	m.SetColorIndex(1, 7, 1)
+	m.SetColorIndex(9, 8, 1)
+	fb := Framebuffer(m)
+	want := make([]byte, 20)
+	want[0] = 0x01
+	want[1] = 0x80
+	want[10+9] = 0x01
+	if !bytes.Equal(fb, want) {
+		t.Errorf("got % x, want % x", fb, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+	}{
+		{128, 64, color.Palette{color.Black, color.White}},
+		{128, 32, color.Palette{color.White, color.Black}},
+		{13, 11, color.Palette{color.Black, color.White}},
+		{72, 40, color.Palette{color.White, color.Black}},
+	}
+	for i, tt := range tests {
+		m := randImage(tt.w, tt.h, tt.palette)
+		d, err := Decode(Framebuffer(m), tt.w, tt.h)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < tt.w; x++ {
+				if lit(m, x, y) != lit(d, x, y) {
+					t.Fatalf("%d: pixel (%d, %d) differs", i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestFramebufferSubImage(t *testing.T) {
+	m := randImage(40, 30, color.Palette{color.Black, color.White})
+	sub := m.SubImage(image.Rect(8, 3, 29, 20))
+	d, err := Decode(Framebuffer(sub), 21, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 17; y++ {
+		for x := 0; x < 21; x++ {
+			if lit(sub, x, y) != lit(d, x, y) {
+				t.Fatalf("pixel (%d, %d) differs", x, y)
+			}
+		}
+	}
+}
+
+// recorder records the transfers of a Bus.
+type recorder struct {
+	cmds, data [][]byte
+}
+
+func (r *recorder) Command(b []byte) error {
+	r.cmds = append(r.cmds, append([]byte(nil), b...))
+	return nil
+}
+
+func (r *recorder) Data(b []byte) error {
+	r.data = append(r.data, append([]byte(nil), b...))
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	m := randImage(128, 20, color.Palette{color.Black, color.White})
+	fb := Framebuffer(m)
+
+	var r recorder
+	if err := Send(&r, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.cmds) != 1 || !bytes.Equal(r.cmds[0], []byte{0x20, 0, 0x21, 0, 127, 0x22, 0, 2}) {
+		t.Errorf("SSD1306 commands % x", r.cmds)
+	}
+	if len(r.data) != 1 || !bytes.Equal(r.data[0], fb) {
+		t.Error("SSD1306 data differs")
+	}
+
+	r = recorder{}
+	if err := Send(&r, m, &Options{Controller: SH1106, ColumnOffset: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.cmds) != 3 || len(r.data) != 3 {
+		t.Fatalf("SH1106: %d commands, %d data", len(r.cmds), len(r.data))
+	}
+	for p := 0; p < 3; p++ {
+		if !bytes.Equal(r.cmds[p], []byte{0xb0 + byte(p), 0x02, 0x10}) {
+			t.Errorf("SH1106 page %d commands % x", p, r.cmds[p])
+		}
+		if !bytes.Equal(r.data[p], fb[p*128:(p+1)*128]) {
+			t.Errorf("SH1106 page %d data differs", p)
+		}
+	}
+}
+
+func TestI2C(t *testing.T) {
+	var b bytes.Buffer
+	bus := I2C(&b)
+	bus.Command([]byte{0xaf})
+	bus.Data([]byte{1, 2})
+	if want := []byte{0x00, 0xaf, 0x40, 1, 2}; !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("got % x, want % x", b.Bytes(), want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	p := color.Palette{color.Black, color.White}
+	for _, tt := range []struct {
+		w, h int
+		opt  *Options
+	}{
+		{129, 8, nil},
+		{128, 65, nil},
+		{128, 8, &Options{ColumnOffset: 2}},
+		{132, 8, &Options{Controller: SH1106, ColumnOffset: 1}},
+		{10, 8, &Options{ColumnOffset: -1}},
+	} {
+		if err := Send(&recorder{}, randImage(tt.w, tt.h, p), tt.opt); err == nil {
+			t.Errorf("%dx%d %+v: no error", tt.w, tt.h, tt.opt)
+		}
+	}
+	if _, err := Decode(make([]byte, 10), 10, 9); err == nil {
+		t.Error("short framebuffer: no error")
+	}
+	if _, err := Decode(nil, 0, 8); err == nil {
+		t.Error("empty image: no error")
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"math"
+)
+
+// A Distance sums up how far the set pixels of one image are from those of
+// another, in pixels, as DirectedDistance finds.
+type Distance struct {
+	// Max is the largest distance, the directed Hausdorff distance.
+	Max float64
+	// Mean is the mean distance, the directed chamfer distance.
+	Mean float64
+}
+
+// DirectedDistance returns how far the set pixels, of color index 1, of a
+// are from the nearest set pixels of b, by Euclidean distance between
+// pixels at the same coordinates of both images, which may have any bounds.
+// The distances are +Inf if b has no set pixel and a has some, and 0 if a
+// has none. Color indices are used; the palettes are not looked at.
+func DirectedDistance(a, b *Image) Distance {
+	var d Distance
+	var n int
+	var sum float64
+	edt(a, b, func(sq int64) {
+		v := math.Inf(1)
+		if sq != noPixel {
+			v = math.Sqrt(float64(sq))
+		}
+		if v > d.Max {
+			d.Max = v
+		}
+		sum += v
+		n++
+	})
+	if n > 0 {
+		d.Mean = sum / float64(n)
+	}
+	return d
+}
+
+// HausdorffDistance returns the largest distance from a set pixel, of color
+// index 1, of either of a and b to the nearest set pixel of the other: 0
+// for the same shapes, and at most r for shapes drawn a pixel or so off
+// each other, such as a traced outline and the original, if no pixel is
+// more than r away. A single stray pixel counts in full; ChamferDistance
+// tells the typical error instead.
+func HausdorffDistance(a, b *Image) float64 {
+	return math.Max(DirectedDistance(a, b).Max, DirectedDistance(b, a).Max)
+}
+
+// ChamferDistance returns the mean of the mean distances from the set
+// pixels, of color index 1, of each of a and b to the nearest set pixels of
+// the other: a score of how well the shapes match, which, unlike the count
+// of differing pixels, grows smoothly as they drift apart.
+func ChamferDistance(a, b *Image) float64 {
+	return (DirectedDistance(a, b).Mean + DirectedDistance(b, a).Mean) / 2
+}
+
+// noPixel is the squared distance to no pixel at all.
+const noPixel = math.MaxInt64
+
+// edt calls f with the squared Euclidean distance of each set pixel of a to
+// the nearest set pixel of b, noPixel if there is none. The exact distance
+// transform is that of Felzenszwalb and Huttenlocher: by columns, then by
+// rows as the lower envelope of parabolas.
+func edt(a, b *Image, f func(sq int64)) {
+	aw, ah := a.Rect.Dx(), a.Rect.Dy()
+	bw, bh := b.Rect.Dx(), b.Rect.Dy()
+	if aw <= 0 || ah <= 0 {
+		return
+	}
+	if bw < 0 {
+		bw = 0
+	}
+	if bh < 0 {
+		bh = 0
+	}
+
+	// The distance of each row of a to the nearest set pixel in each column
+	// of b: the rows of b are scanned down and up, the rows of a beyond b
+	// count from the first and the last set pixels.
+	col := make([]int64, ah*bw)
+	near := make([]int, bh)
+	for x := 0; x < bw; x++ {
+		last := -1
+		for y := 0; y < bh; y++ {
+			if bitAt(b.Pix[y*b.Stride:], x) {
+				last = y
+			}
+			near[y] = last
+		}
+		next := -1
+		for y := bh - 1; y >= 0; y-- {
+			if near[y] == y {
+				next = y
+			} else if next >= 0 && (near[y] < 0 || next-y < y-near[y]) {
+				near[y] = next
+			}
+		}
+		first := -1
+		if bh > 0 {
+			first = near[0]
+		}
+		for y := 0; y < ah; y++ {
+			by := a.Rect.Min.Y + y - b.Rect.Min.Y
+			var n int
+			switch {
+			case first < 0:
+				col[y*bw+x] = noPixel
+				continue
+			case by < 0:
+				n = first
+			case by >= bh:
+				n = last
+			default:
+				n = near[by]
+			}
+			dy := int64(n - by)
+			col[y*bw+x] = dy * dy
+		}
+	}
+
+	// The lower envelope of the parabolas of the columns of each row: v
+	// has their columns, z where they start to be the lowest.
+	v := make([]int, bw)
+	z := make([]float64, bw+1)
+	for y := 0; y < ah; y++ {
+		arow := a.Pix[y*a.Stride:]
+		if x := nextChange(arow, 0, aw, 0); x >= aw {
+			continue
+		}
+		g := col[y*bw : (y+1)*bw]
+		k := -1
+		for q := 0; q < bw; q++ {
+			if g[q] == noPixel {
+				continue
+			}
+			if k < 0 {
+				k = 0
+				v[0], z[0], z[1] = q, math.Inf(-1), math.Inf(1)
+				continue
+			}
+			var s float64
+			for {
+				p := v[k]
+				s = (float64(g[q]-g[p]) + float64(q*q-p*p)) / float64(2*(q-p))
+				if s > z[k] {
+					break
+				}
+				k--
+			}
+			k++
+			v[k], z[k], z[k+1] = q, s, math.Inf(1)
+		}
+		j := 0
+		dx := a.Rect.Min.X - b.Rect.Min.X
+		for x := 0; x < aw; x++ {
+			if !bitAt(arow, x) {
+				continue
+			}
+			if k < 0 {
+				f(noPixel)
+				continue
+			}
+			q := x + dx
+			for z[j+1] < float64(q) {
+				j++
+			}
+			e := int64(q - v[j])
+			f(e*e + g[v[j]])
+		}
+	}
+}
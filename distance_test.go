@@ -0,0 +1,107 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// slowDistance finds DirectedDistance by trying all the pairs of pixels.
+func slowDistance(a, b *Image) Distance {
+	var d Distance
+	n := 0
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			if a.ColorIndexAt(x, y) != 1 {
+				continue
+			}
+			best := math.Inf(1)
+			for by := b.Rect.Min.Y; by < b.Rect.Max.Y; by++ {
+				for bx := b.Rect.Min.X; bx < b.Rect.Max.X; bx++ {
+					if b.ColorIndexAt(bx, by) == 1 {
+						best = math.Min(best, math.Hypot(float64(x-bx), float64(y-by)))
+					}
+				}
+			}
+			d.Max = math.Max(d.Max, best)
+			d.Mean += best
+			n++
+		}
+	}
+	if n > 0 {
+		d.Mean /= float64(n)
+	}
+	return d
+}
+
+func TestDirectedDistance(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bw := color.Palette{color.White, color.Black}
+	sparse := func(b image.Rectangle, n int) *Image {
+		m := New(b, bw)
+		for i := 0; i < n; i++ {
+			m.SetColorIndex(b.Min.X+r.Intn(b.Dx()), b.Min.Y+r.Intn(b.Dy()), 1)
+		}
+		return m
+	}
+	for i := 0; i < 50; i++ {
+		// Bounds apart, overlapping or inside each other.
+		ab := image.Rect(r.Intn(20)-10, r.Intn(20)-10, 0, 0)
+		ab.Max = ab.Min.Add(image.Pt(1+r.Intn(30), 1+r.Intn(30)))
+		bb := image.Rect(r.Intn(30)-15, r.Intn(30)-15, 0, 0)
+		bb.Max = bb.Min.Add(image.Pt(1+r.Intn(30), 1+r.Intn(30)))
+		a, b := sparse(ab, r.Intn(40)), sparse(bb, r.Intn(8))
+		got, want := DirectedDistance(a, b), slowDistance(a, b)
+		if math.Abs(got.Max-want.Max) > 1e-9 || math.Abs(got.Mean-want.Mean) > 1e-9 {
+			t.Fatalf("%v to %v: got %+v, want %+v", ab, bb, got, want)
+		}
+	}
+
+	a := New(image.Rect(0, 0, 10, 10), bw)
+	b := New(image.Rect(5, 5, 20, 20), bw)
+	if d := DirectedDistance(a, b); d != (Distance{}) {
+		t.Errorf("empty to empty: %+v", d)
+	}
+	a.SetColorIndex(2, 3, 1)
+	if d := DirectedDistance(a, b); !math.IsInf(d.Max, 1) || !math.IsInf(d.Mean, 1) {
+		t.Errorf("to empty: %+v", d)
+	}
+	if d := DirectedDistance(b, a); d != (Distance{}) {
+		t.Errorf("from empty: %+v", d)
+	}
+}
+
+func TestHausdorffChamfer(t *testing.T) {
+	bw := color.Palette{color.White, color.Black}
+	r := image.Rect(0, 0, 40, 20)
+	a, b := New(r, bw), New(r, bw)
+	for x := 5; x < 35; x++ {
+		a.SetColorIndex(x, 10, 1)
+		b.SetColorIndex(x, 11, 1)
+	}
+	if h := HausdorffDistance(a, b); h != 1 {
+		t.Errorf("lines a pixel apart: Hausdorff distance %v, want 1", h)
+	}
+	if c := ChamferDistance(a, b); c != 1 {
+		t.Errorf("lines a pixel apart: chamfer distance %v, want 1", c)
+	}
+	if h, c := HausdorffDistance(a, a), ChamferDistance(a, a); h != 0 || c != 0 {
+		t.Errorf("same line: distances %v, %v", h, c)
+	}
+
+	// A stray pixel 3 away from the line: in full for the Hausdorff
+	// distance, diluted for the chamfer distance.
+	b.SetColorIndex(20, 14, 1)
+	if h := HausdorffDistance(a, b); h != 4 {
+		t.Errorf("stray pixel: Hausdorff distance %v, want 4", h)
+	}
+	if c, want := ChamferDistance(a, b), (1+(30+4)/31.0)/2; math.Abs(c-want) > 1e-12 {
+		t.Errorf("stray pixel: chamfer distance %v, want %v", c, want)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package epaper converts images to the frame buffers of e-paper display
+// controllers, such as the ones of Waveshare EPD modules and the IT8951.
+//
+// Frame buffers hold one bit per pixel, rows top to bottom, the leftmost
+// pixel of each byte in its most significant bit. Rows are padded to a
+// multiple of 8 pixels, or more for some controllers, with white pixels.
+// Black pixels are clear bits, as most controllers take them. Displays
+// with a third color take a second plane, in which red (or yellow) pixels
+// are set bits.
+//
+// Partial updates send the part of the frame buffer inside a window, which
+// controllers require to start and end at byte boundaries; see Window and
+// RAMAddress.
+package epaper
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// A FormatError reports that images can not be converted.
+type FormatError string
+
+func (e FormatError) Error() string { return "epaper: invalid format: " + string(e) }
+
+// Options describe the frame buffer layout of a controller.
+type Options struct {
+	// Align is the multiple of pixels rows are padded to. Zero means 8.
+	// The IT8951 takes 1 bpp rows aligned to 32 pixels.
+	Align int
+
+	// BlackIsOne stores black pixels as set bits.
+	BlackIsOne bool
+
+	// RedIsZero stores the pixels of the second color as clear bits in
+	// the second plane, as some controllers take them.
+	RedIsZero bool
+
+	// LSBFirst stores the leftmost pixel of each byte in the least
+	// significant bit.
+	LSBFirst bool
+
+	// SwapBytes swaps the bytes of each 16-bit word, for controllers with
+	// a 16-bit host interface taking little-endian words, like the
+	// IT8951. Rows then need an Align of 16 or more.
+	SwapBytes bool
+}
+
+// rowBytes returns the number of bytes of a frame buffer row of width
+// pixels.
+func (o *Options) rowBytes(width int) int {
+	align := o.Align
+	if align <= 0 {
+		align = 8
+	}
+	return (width + align - 1) / align * align / 8
+}
+
+// Pack returns the frame buffer showing m.
+func Pack(m *img1b.Image, opt *Options) []byte {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	return pack(m, &o, !o.BlackIsOne)
+}
+
+// PackRed returns the two planes of a frame buffer of a three color
+// display: the black plane showing black, and the color plane with the
+// black pixels of red set. Both images must be of the same size. Pixels
+// black in both images are shown as the display controller does, usually
+// red.
+func PackRed(black, red *img1b.Image, opt *Options) (bw, r []byte, err error) {
+	if black.Rect.Size() != red.Rect.Size() {
+		return nil, nil, FormatError(fmt.Sprintf("plane sizes %v and %v differ", black.Rect.Size(), red.Rect.Size()))
+	}
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	return pack(black, &o, !o.BlackIsOne), pack(red, &o, o.RedIsZero), nil
+}
+
+// pack returns the frame buffer of m with black pixels set, or clear if
+// invert is set.
+func pack(m *img1b.Image, o *Options, invert bool) []byte {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	rowBytes := o.rowBytes(width)
+	n := (width + 7) / 8
+	buf := make([]byte, rowBytes*height)
+	flip := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(width)
+	for y := 0; y < height; y++ {
+		row := buf[y*rowBytes : (y+1)*rowBytes]
+		copy(row, m.Pix[y*m.Stride:y*m.Stride+n])
+		if flip {
+			for i := range row[:n] {
+				row[i] = ^row[i]
+			}
+		}
+		// The padding is white.
+		row[n-1] &= tm
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+	}
+	if o.LSBFirst {
+		img1b.ReverseBits(buf)
+	}
+	if o.SwapBytes {
+		for i := 0; i+1 < len(buf); i += 2 {
+			buf[i], buf[i+1] = buf[i+1], buf[i]
+		}
+	}
+	return buf
+}
+
+// Window returns the smallest window containing r whose left and right
+// edges are multiples of align pixels, as partial updates need. Zero align
+// means 8.
+func Window(r image.Rectangle, align int) image.Rectangle {
+	if align <= 0 {
+		align = 8
+	}
+	floor := func(x int) int {
+		if x < 0 {
+			return -((-x + align - 1) / align * align)
+		}
+		return x / align * align
+	}
+	r.Min.X = floor(r.Min.X)
+	r.Max.X = -floor(-r.Max.X)
+	return r
+}
+
+// RAMAddress returns the display memory addresses of a byte aligned window,
+// as taken by the commands setting the RAM window of SSD16xx and similar
+// controllers: the first and last byte columns and the first and last
+// rows.
+func RAMAddress(r image.Rectangle) (xStart, xEnd, yStart, yEnd int) {
+	return r.Min.X / 8, (r.Max.X - 1) / 8, r.Min.Y, r.Max.Y - 1
+}
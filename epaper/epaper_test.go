@@ -0,0 +1,111 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package epaper
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage returns a 10x2 image with black pixels at (0, 0) and (9, 1).
+func testImage(p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 10, 2), p)
+	black := uint8(1)
+	if p[0] == color.Black {
+		black = 0
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 10; x++ {
+			m.SetColorIndex(x, y, 1-black)
+		}
+	}
+	m.SetColorIndex(0, 0, black)
+	m.SetColorIndex(9, 1, black)
+	return m
+}
+
+func TestPack(t *testing.T) {
+	wb := color.Palette{color.White, color.Black}
+	bw := color.Palette{color.Black, color.White}
+	tests := []struct {
+		palette color.Palette
+		opt     *Options
+		want    []byte
+	}{
+		{wb, nil, []byte{0x7f, 0xff, 0xff, 0xbf}},
+		{bw, nil, []byte{0x7f, 0xff, 0xff, 0xbf}},
+		{wb, &Options{BlackIsOne: true}, []byte{0x80, 0x00, 0x00, 0x40}},
+		{bw, &Options{LSBFirst: true}, []byte{0xfe, 0xff, 0xff, 0xfd}},
+		{wb, &Options{Align: 32}, []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xbf, 0xff, 0xff}},
+		{wb, &Options{Align: 16, SwapBytes: true}, []byte{0xff, 0x7f, 0xbf, 0xff}},
+	}
+	for i, tt := range tests {
+		if got := Pack(testImage(tt.palette), tt.opt); !bytes.Equal(got, tt.want) {
+			t.Errorf("%d: got % x, want % x", i, got, tt.want)
+		}
+	}
+}
+
+func TestPackRed(t *testing.T) {
+	black := testImage(color.Palette{color.White, color.Black})
+	red := img1b.New(image.Rect(5, 5, 15, 7), color.Palette{color.White, color.Black})
+	red.SetColorIndex(6, 5, 1)
+	b, r, err := PackRed(black, red, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x7f, 0xff, 0xff, 0xbf}; !bytes.Equal(b, want) {
+		t.Errorf("black plane: got % x, want % x", b, want)
+	}
+	if want := []byte{0x40, 0x00, 0x00, 0x00}; !bytes.Equal(r, want) {
+		t.Errorf("red plane: got % x, want % x", r, want)
+	}
+	_, r, err = PackRed(black, red, &Options{RedIsZero: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xbf, 0xff, 0xff, 0xff}; !bytes.Equal(r, want) {
+		t.Errorf("inverted red plane: got % x, want % x", r, want)
+	}
+	if _, _, err := PackRed(black, img1b.New(image.Rect(0, 0, 10, 3), nil), nil); err == nil {
+		t.Error("size mismatch: no error")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	tests := []struct {
+		r     image.Rectangle
+		align int
+		want  image.Rectangle
+	}{
+		{image.Rect(3, 4, 13, 20), 0, image.Rect(0, 4, 16, 20)},
+		{image.Rect(8, 0, 16, 1), 8, image.Rect(8, 0, 16, 1)},
+		{image.Rect(33, 2, 65, 3), 32, image.Rect(32, 2, 96, 3)},
+		{image.Rect(-3, 0, -1, 1), 8, image.Rect(-8, 0, 0, 1)},
+	}
+	for _, tt := range tests {
+		if got := Window(tt.r, tt.align); got != tt.want {
+			t.Errorf("Window(%v, %d) = %v, want %v", tt.r, tt.align, got, tt.want)
+		}
+	}
+	x0, x1, y0, y1 := RAMAddress(image.Rect(16, 10, 40, 30))
+	if x0 != 2 || x1 != 4 || y0 != 10 || y1 != 29 {
+		t.Errorf("RAMAddress = %d, %d, %d, %d", x0, x1, y0, y1)
+	}
+}
+
+func TestPartial(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 64, 8), color.Palette{color.White, color.Black})
+	m.SetColorIndex(20, 3, 1)
+	w := Window(image.Rect(19, 2, 22, 5), 8)
+	got := Pack(m.SubImage(w), nil)
+	want := []byte{0xff, 0xf7, 0xff}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package epl implements an encoder of images as EPL2 GW commands, the
+// graphics of the page mode language of Eltron and older Zebra desktop label
+// printers.
+//
+// GW takes binary rows in which, unlike most formats, clear bits are printed
+// as dots. Only the GW command is written, the label is started by N and
+// printed by P as usual.
+package epl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A FormatError reports that the image can not be encoded.
+type FormatError string
+
+func (e FormatError) Error() string { return "epl: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// X and Y are the position of the image on the label in dots.
+	X, Y int
+}
+
+// Encode writes the image m to w as a GW command followed by a line feed.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	if opt.X < 0 || opt.Y < 0 {
+		return FormatError(fmt.Sprintf("invalid position: %d,%d", opt.X, opt.Y))
+	}
+	rowBytes := (width + 7) / 8
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GW%d,%d,%d,%d,", opt.X, opt.Y, rowBytes, height)
+	// Black pixels must be clear, as must be the padding.
+	invert := bitmap.BlackIndex(m.Palette) == 1
+	tm := bitmap.TailMask(width)
+	row := make([]byte, rowBytes)
+	for y := 0; y < height; y++ {
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[rowBytes-1] |= ^tm
+		bw.Write(row)
+	}
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package epl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+		opt     *Options
+	}{
+		{16, 5, color.Palette{color.White, color.Black}, nil},
+		{13, 7, color.Palette{color.Black, color.White}, &Options{X: 50, Y: 120}},
+		{1, 1, color.Palette{color.White, color.Black}, &Options{X: 3}},
+	}
+	for i, tt := range tests {
+		m := img1b.New(image.Rect(0, 0, tt.w, tt.h), tt.palette)
+		rand.New(rand.NewSource(int64(i))).Read(m.Pix)
+		var b bytes.Buffer
+		if err := Encode(&b, m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		opt := tt.opt
+		if opt == nil {
+			opt = &Options{}
+		}
+		rowBytes := (tt.w + 7) / 8
+		header := fmt.Sprintf("GW%d,%d,%d,%d,", opt.X, opt.Y, rowBytes, tt.h)
+		data := b.Bytes()
+		if !bytes.HasPrefix(data, []byte(header)) || len(data) != len(header)+rowBytes*tt.h+1 || data[len(data)-1] != '\n' {
+			t.Fatalf("%d: bad command %q", i, data)
+		}
+		data = data[len(header):]
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < rowBytes*8; x++ {
+				dot := data[y*rowBytes+x/8]>>uint(7-x%8)&1 == 0
+				if black := x < tt.w && m.At(x, y) == color.Black; dot != black {
+					t.Fatalf("%d: at (%d, %d) got dot %v", i, x, y, dot)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if err := Encode(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 8, 0), nil), nil); err == nil {
+		t.Error("empty image accepted")
+	}
+	if err := Encode(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 8, 8), nil), &Options{X: -1}); err == nil {
+		t.Error("negative position accepted")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package escp implements an encoder of images as Epson ESC/P dot graphics,
+// the printer language of 9-pin and 24-pin dot matrix printers.
+//
+// The image is printed in bands as tall as the print head fires: 8 rows at
+// 72 dpi for 9-pin printers and 24 rows at 180 dpi for 24-pin ones. Each
+// band is sent as a bit image command with one byte per column and head
+// row of 8 pins, top pin in the most significant bit, and is followed by a
+// carriage return and a paper feed of the band height.
+//
+// In the densest modes the print head can not fire the same pin in adjacent
+// columns, which are then printed in two passes over the band: even columns
+// first and odd ones next.
+package escp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A FormatError reports that the image can not be printed.
+type FormatError string
+
+func (e FormatError) Error() string { return "escp: invalid format: " + string(e) }
+
+// A Mode is a bit image mode of the ESC * command. The horizontal
+// resolution is in dots per inch.
+type Mode byte
+
+// 8-dot modes print bands of 8 rows at 72 dpi, 24-dot modes bands of 24
+// rows at 180 dpi.
+const (
+	Single          Mode = 0  // 60 dpi
+	Double          Mode = 1  // 120 dpi
+	HighSpeedDouble Mode = 2  // 120 dpi, no adjacent dots
+	Quadruple       Mode = 3  // 240 dpi, no adjacent dots
+	CRT             Mode = 4  // 80 dpi
+	Plotter         Mode = 5  // 72 dpi
+	CRT2            Mode = 6  // 90 dpi
+	Single24        Mode = 32 // 60 dpi
+	Double24        Mode = 33 // 120 dpi
+	CRT24           Mode = 38 // 90 dpi
+	Triple24        Mode = 39 // 180 dpi
+	Hex24           Mode = 40 // 360 dpi, no adjacent dots
+)
+
+// dots returns the number of rows printed by a band in mode m, or 0 if m is
+// not a valid mode.
+func (m Mode) dots() int {
+	switch {
+	case m <= CRT2:
+		return 8
+	case m == Single24, m == Double24, m >= CRT24 && m <= Hex24:
+		return 24
+	}
+	return 0
+}
+
+// interleaved reports whether adjacent columns must be printed in separate
+// passes in mode m.
+func (m Mode) interleaved() bool {
+	return m == HighSpeedDouble || m == Quadruple || m == Hex24
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Mode is the bit image mode. The zero value is Single.
+	Mode Mode
+
+	// Legacy prints the first four 8-dot modes with the ESC K, ESC L,
+	// ESC Y and ESC Z commands, for printers predating ESC *.
+	Legacy bool
+}
+
+// legacyCommands are the commands of modes Single to Quadruple with Legacy.
+var legacyCommands = [...]byte{'K', 'L', 'Y', 'Z'}
+
+// bandFeed is the paper feed after a band, in the ESC J units of 1/216 inch
+// for 9-pin printers and 1/180 inch for 24-pin ones.
+const bandFeed = 24
+
+// Encode writes the image m to w as ESC/P bit image commands. The image
+// starts at the current print position, which is left below it.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || width > 0xffff {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	dots := o.Mode.dots()
+	if dots == 0 {
+		return FormatError(fmt.Sprintf("invalid mode %d", o.Mode))
+	}
+	cmd := []byte{0x1b, '*', byte(o.Mode), byte(width), byte(width >> 8)}
+	if o.Legacy && o.Mode <= Quadruple {
+		cmd = []byte{0x1b, legacyCommands[o.Mode], byte(width), byte(width >> 8)}
+	}
+
+	bw := bufio.NewWriter(w)
+	colBytes := dots / 8
+	data := make([]byte, width*colBytes)
+	var pass []byte
+	if o.Mode.interleaved() {
+		pass = make([]byte, len(data))
+	}
+	for y0 := 0; y0 < height; y0 += dots {
+		band(data, m, y0, colBytes)
+		if pass == nil {
+			bw.Write(cmd)
+			bw.Write(data)
+			bw.WriteByte('\r')
+		} else {
+			for odd := 0; odd < 2; odd++ {
+				copy(pass, data)
+				for x := 1 - odd; x < width; x += 2 {
+					for k := 0; k < colBytes; k++ {
+						pass[x*colBytes+k] = 0
+					}
+				}
+				bw.Write(cmd)
+				bw.Write(pass)
+				bw.WriteByte('\r')
+			}
+		}
+		bw.Write([]byte{0x1b, 'J', bandFeed})
+	}
+	return bw.Flush()
+}
+
+// band repacks the rows of m from y0 on into colBytes bytes per column,
+// with black dots set. Rows past the bottom of m are white.
+func band(data []byte, m *img1b.Image, y0, colBytes int) {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(width)
+	rowBytes := (width + 7) / 8
+	var block [8]byte
+	var cols [8 * 3]byte
+	for bx := 0; bx < rowBytes; bx++ {
+		// The band is repacked by blocks of 8×8 pixels.
+		for k := 0; k < colBytes; k++ {
+			for j := range block {
+				y := y0 + 8*k + j
+				if y >= height {
+					block[j] = 0
+					continue
+				}
+				b := m.Pix[y*m.Stride+bx]
+				if invert {
+					b = ^b
+				}
+				if bx == rowBytes-1 {
+					b &= tm
+				}
+				block[j] = b
+			}
+			bitmap.Transpose8(cols[k:], colBytes, block[:], 1)
+		}
+		copy(data[8*bx*colBytes:], cols[:8*colBytes])
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package escp
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	return m
+}
+
+// printDots interprets the commands written by Encode and returns the
+// printed dots, the number of passes over each band and whether a pass
+// fired a pin in adjacent columns.
+func printDots(t *testing.T, data []byte, opt *Options) (dots map[image.Point]bool, passes []int, adjacent bool) {
+	t.Helper()
+	dots = make(map[image.Point]bool)
+	colBytes := opt.Mode.dots() / 8
+	y0, n := 0, 0
+	for len(data) > 0 {
+		if len(data) >= 3 && data[0] == 0x1b && data[1] == 'J' {
+			if data[2] != bandFeed {
+				t.Fatalf("feed %d", data[2])
+			}
+			y0 += 8 * colBytes
+			passes = append(passes, n)
+			n = 0
+			data = data[3:]
+			continue
+		}
+		var width int
+		switch {
+		case opt.Legacy && opt.Mode <= Quadruple:
+			if len(data) < 4 || data[0] != 0x1b || data[1] != legacyCommands[opt.Mode] {
+				t.Fatalf("bad command % x", data[:4])
+			}
+			width = int(data[2]) | int(data[3])<<8
+			data = data[4:]
+		default:
+			if len(data) < 5 || data[0] != 0x1b || data[1] != '*' || data[2] != byte(opt.Mode) {
+				t.Fatalf("bad command % x", data[:5])
+			}
+			width = int(data[3]) | int(data[4])<<8
+			data = data[5:]
+		}
+		cols := data[:width*colBytes]
+		for x := 0; x < width; x++ {
+			for k := 0; k < colBytes; k++ {
+				c := cols[x*colBytes+k]
+				if x > 0 && c&cols[(x-1)*colBytes+k] != 0 {
+					adjacent = true
+				}
+				for j := 0; j < 8; j++ {
+					if c&(0x80>>uint(j)) != 0 {
+						dots[image.Pt(x, y0+8*k+j)] = true
+					}
+				}
+			}
+		}
+		if data[width*colBytes] != '\r' {
+			t.Fatal("no carriage return")
+		}
+		data = data[width*colBytes+1:]
+		n++
+	}
+	return dots, passes, adjacent
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+		opt     *Options
+		passes  int
+	}{
+		{16, 8, color.Palette{color.White, color.Black}, &Options{}, 1},
+		{13, 20, color.Palette{color.Black, color.White}, &Options{Mode: Double}, 1},
+		{30, 17, color.Palette{color.White, color.Black}, &Options{Mode: Quadruple}, 2},
+		{30, 17, color.Palette{color.White, color.Black}, &Options{Mode: HighSpeedDouble, Legacy: true}, 2},
+		{21, 50, color.Palette{color.Black, color.White}, &Options{Mode: Single24}, 1},
+		{21, 50, color.Palette{color.White, color.Black}, &Options{Mode: Hex24}, 2},
+		{9, 9, color.Palette{color.White, color.Black}, &Options{Mode: CRT2, Legacy: true}, 1},
+	}
+	for i, tt := range tests {
+		m := randImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := Encode(&b, m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		dots, passes, adjacent := printDots(t, b.Bytes(), tt.opt)
+		if adjacent && tt.passes > 1 {
+			t.Errorf("%d: adjacent dots in one pass", i)
+		}
+		band := tt.opt.Mode.dots()
+		if want := (tt.h + band - 1) / band; len(passes) != want {
+			t.Errorf("%d: %d bands, want %d", i, len(passes), want)
+		}
+		for _, n := range passes {
+			if n != tt.passes {
+				t.Errorf("%d: %d passes, want %d", i, n, tt.passes)
+				break
+			}
+		}
+		black := uint8(1)
+		if tt.palette[0] == color.Black {
+			black = 0
+		}
+		for y := 0; y < band*len(passes); y++ {
+			for x := 0; x < tt.w; x++ {
+				want := y < tt.h && m.ColorIndexAt(x, y) == black
+				if dots[image.Pt(x, y)] != want {
+					t.Fatalf("%d: dot at (%d, %d) is %v", i, x, y, !want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeNil(t *testing.T) {
+	m := randImage(8, 8, color.Palette{color.White, color.Black})
+	var a, b bytes.Buffer
+	if err := Encode(&a, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&b, m, &Options{Mode: Single}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("nil options differ from Single")
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	p := color.Palette{color.White, color.Black}
+	if err := Encode(&bytes.Buffer{}, img1b.New(image.Rect(0, 0, 0, 8), p), nil); err == nil {
+		t.Error("empty image: no error")
+	}
+	for _, mode := range []Mode{7, 31, 34, 41} {
+		if err := Encode(&bytes.Buffer{}, randImage(8, 8, p), &Options{Mode: mode}); err == nil {
+			t.Errorf("mode %d: no error", mode)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package escpos
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A ColumnMode is a bit image mode of the ESC * command.
+type ColumnMode byte
+
+// Column modes. Single density modes print dots twice as wide as double
+// density ones, 8-dot modes print them three times as tall as 24-dot ones.
+const (
+	Single8  ColumnMode = 0
+	Double8  ColumnMode = 1
+	Single24 ColumnMode = 32
+	Double24 ColumnMode = 33
+)
+
+// EncodeColumns writes the image m to w as ESC * bit image commands, which
+// many printers without GS v 0 support. The image is printed in stripes of 8
+// or 24 rows, each followed by a line feed, with the line spacing set to 24
+// motion units for the duration.
+func EncodeColumns(w io.Writer, m *img1b.Image, mode ColumnMode) error {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 || width > 0xffff {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	var colBytes int // bytes per column of a stripe
+	switch mode {
+	case Single8, Double8:
+		colBytes = 1
+	case Single24, Double24:
+		colBytes = 3
+	default:
+		return FormatError(fmt.Sprintf("invalid column mode %d", mode))
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{0x1b, '3', 24})
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(width)
+	rowBytes := (width + 7) / 8
+	data := make([]byte, width*colBytes)
+	for y0 := 0; y0 < height; y0 += 8 * colBytes {
+		var block [8]byte
+		var cols [8 * 3]byte
+		for bx := 0; bx < rowBytes; bx++ {
+			// The stripe is repacked by blocks of 8×8 pixels.
+			for k := 0; k < colBytes; k++ {
+				for j := range block {
+					y := y0 + 8*k + j
+					if y >= height {
+						block[j] = 0
+						continue
+					}
+					b := m.Pix[y*m.Stride+bx]
+					if invert {
+						b = ^b
+					}
+					if bx == rowBytes-1 {
+						b &= tm
+					}
+					block[j] = b
+				}
+				bitmap.Transpose8(cols[k:], colBytes, block[:], 1)
+			}
+			copy(data[8*bx*colBytes:], cols[:8*colBytes])
+		}
+		bw.Write([]byte{0x1b, '*', byte(mode), byte(width), byte(width >> 8)})
+		bw.Write(data)
+		bw.WriteByte('\n')
+	}
+	bw.Write([]byte{0x1b, '2'})
+	return bw.Flush()
+}
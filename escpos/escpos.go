@@ -0,0 +1,107 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package escpos implements an encoder of images as ESC/POS raster bit image
+// commands, the printer language of thermal receipt printers.
+//
+// Images are printed with GS v 0 commands, black pixels as dots. The rows
+// are sent as they are packed in the image, so no intermediate copy of the
+// image is made. Only the image commands are written: initialization, line
+// feeds and paper cutting are left to the caller.
+//
+// Printers lacking GS v 0, as many cheap 58 mm ones, are served by the
+// older ESC * command, which takes the image in stripes of 8 or 24 rows
+// packed by column.
+package escpos
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A FormatError reports that the image can not be printed.
+type FormatError string
+
+func (e FormatError) Error() string { return "escpos: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// BandHeight is the largest number of rows sent in one command. Printers
+	// with a small buffer need the image split in bands, commonly of 24 to
+	// 256 rows. Zero means bands of up to 65535 rows, the most a command
+	// can hold.
+	BandHeight int
+
+	// DoubleWidth and DoubleHeight print each pixel as two dots
+	// horizontally or vertically.
+	DoubleWidth, DoubleHeight bool
+}
+
+// maxBand is the largest number of rows of a GS v 0 command.
+const maxBand = 0xffff
+
+// Encode writes the image m to w as GS v 0 raster bit image commands.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	rowBytes := (width + 7) / 8
+	if width <= 0 || height <= 0 || rowBytes > 0xffff {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	band := opt.BandHeight
+	if band <= 0 || band > maxBand {
+		band = maxBand
+	}
+	var mode byte
+	if opt.DoubleWidth {
+		mode |= 1
+	}
+	if opt.DoubleHeight {
+		mode |= 2
+	}
+
+	bw := bufio.NewWriter(w)
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(width)
+	// Rows that need neither inversion nor masking are written straight
+	// from the image, contiguous ones at once.
+	direct := !invert && tm == 0xff
+	row := make([]byte, rowBytes)
+	for y0 := 0; y0 < height; y0 += band {
+		h := height - y0
+		if h > band {
+			h = band
+		}
+		bw.Write([]byte{
+			0x1d, 'v', '0', mode,
+			byte(rowBytes), byte(rowBytes >> 8),
+			byte(h), byte(h >> 8),
+		})
+		if direct && m.Stride == rowBytes {
+			bw.Write(m.Pix[y0*m.Stride : (y0+h)*m.Stride])
+			continue
+		}
+		for y := y0; y < y0+h; y++ {
+			src := m.Pix[y*m.Stride : y*m.Stride+rowBytes]
+			if direct {
+				bw.Write(src)
+				continue
+			}
+			copy(row, src)
+			if invert {
+				for i := range row {
+					row[i] = ^row[i]
+				}
+			}
+			row[rowBytes-1] &= tm
+			bw.Write(row)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package escpos
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func randImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	return m
+}
+
+// rasterBands parses GS v 0 commands and returns the printed dots and the
+// height of each band.
+func rasterBands(t *testing.T, data []byte, mode byte) (dots [][]byte, bands []int) {
+	t.Helper()
+	for len(data) > 0 {
+		if len(data) < 8 || !bytes.Equal(data[:3], []byte{0x1d, 'v', '0'}) || data[3] != mode {
+			t.Fatalf("bad command % x", data[:8])
+		}
+		x := int(data[4]) | int(data[5])<<8
+		y := int(data[6]) | int(data[7])<<8
+		data = data[8:]
+		for i := 0; i < y; i++ {
+			dots = append(dots, data[:x])
+			data = data[x:]
+		}
+		bands = append(bands, y)
+	}
+	return dots, bands
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+		opt     *Options
+		bands   []int
+	}{
+		{16, 10, color.Palette{color.White, color.Black}, nil, []int{10}},
+		{13, 10, color.Palette{color.White, color.Black}, &Options{BandHeight: 4}, []int{4, 4, 2}},
+		{16, 24, color.Palette{color.Black, color.White}, &Options{BandHeight: 24}, []int{24}},
+		{300, 50, color.Palette{color.Black, color.White}, &Options{BandHeight: 24, DoubleWidth: true}, []int{24, 24, 2}},
+	}
+	for i, tt := range tests {
+		m := randImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := Encode(&b, m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		var mode byte
+		if tt.opt != nil && tt.opt.DoubleWidth {
+			mode = 1
+		}
+		dots, bands := rasterBands(t, b.Bytes(), mode)
+		if len(bands) != len(tt.bands) {
+			t.Errorf("%d: got bands %v, want %v", i, bands, tt.bands)
+		}
+		for y := 0; y < tt.h; y++ {
+			for x := 0; x < (tt.w+7)&^7; x++ {
+				dot := dots[y][x/8]>>uint(7-x%8)&1 == 1
+				black := x < tt.w && m.At(x, y) == color.Black
+				if dot != black {
+					t.Fatalf("%d: at (%d, %d) got dot %v", i, x, y, dot)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeSubImage(t *testing.T) {
+	m := randImage(40, 20, color.Palette{color.White, color.Black})
+	s := m.SubImage(image.Rect(8, 3, 24, 17))
+	var b bytes.Buffer
+	if err := Encode(&b, s, &Options{DoubleHeight: true}); err != nil {
+		t.Fatal(err)
+	}
+	dots, _ := rasterBands(t, b.Bytes(), 2)
+	for y := range dots {
+		if !bytes.Equal(dots[y], m.Pix[(y+3)*m.Stride+1:][:2]) {
+			t.Fatalf("row %d: got % x", y, dots[y])
+		}
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	if err := Encode(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 8, 0), nil), nil); err == nil {
+		t.Error("empty image accepted")
+	}
+}
+
+func TestEncodeColumns(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+		mode    ColumnMode
+	}{
+		{16, 8, color.Palette{color.White, color.Black}, Single8},
+		{13, 30, color.Palette{color.Black, color.White}, Double8},
+		{384, 48, color.Palette{color.White, color.Black}, Double24},
+		{21, 50, color.Palette{color.Black, color.White}, Single24},
+	}
+	for i, tt := range tests {
+		m := randImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := EncodeColumns(&b, m, tt.mode); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		data := b.Bytes()
+		if !bytes.HasPrefix(data, []byte{0x1b, '3', 24}) || !bytes.HasSuffix(data, []byte{0x1b, '2'}) {
+			t.Fatalf("%d: bad line spacing commands", i)
+		}
+		data = data[3 : len(data)-2]
+		dots := 8
+		if tt.mode >= Single24 {
+			dots = 24
+		}
+		for y0 := 0; y0 < tt.h; y0 += dots {
+			if !bytes.Equal(data[:5], []byte{0x1b, '*', byte(tt.mode), byte(tt.w), byte(tt.w >> 8)}) {
+				t.Fatalf("%d: bad command % x", i, data[:5])
+			}
+			data = data[5:]
+			for x := 0; x < tt.w; x++ {
+				for j := 0; j < dots; j++ {
+					dot := data[x*dots/8+j/8]>>uint(7-j%8)&1 == 1
+					black := y0+j < tt.h && m.At(x, y0+j) == color.Black
+					if dot != black {
+						t.Fatalf("%d: at (%d, %d) got dot %v", i, x, y0+j, dot)
+					}
+				}
+			}
+			if data[tt.w*dots/8] != '\n' {
+				t.Fatalf("%d: missing line feed", i)
+			}
+			data = data[tt.w*dots/8+1:]
+		}
+		if len(data) != 0 {
+			t.Errorf("%d: %d extra bytes", i, len(data))
+		}
+	}
+	if err := EncodeColumns(new(bytes.Buffer), randImage(8, 8, nil), 2); err == nil {
+		t.Error("bad mode accepted")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+)
+
+// A Frozen is a read-only image. It has the read methods of Image but no way
+// to change its pixels, so it may be shared by goroutines and kept in caches
+// without copying. Its palette is not to be changed either.
+type Frozen struct {
+	m Image
+}
+
+var _ image.PalettedImage = (*Frozen)(nil)
+
+// Freeze returns a read-only copy of p. Later changes to p do not show in
+// it.
+func (p *Image) Freeze() *Frozen {
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	d := New(p.Rect, append(color.Palette(nil), p.Palette...))
+	if w > 0 {
+		for y := 0; y < h; y++ {
+			copy(d.Pix[y*d.Stride:(y+1)*d.Stride], p.Pix[y*p.Stride:])
+		}
+	}
+	d.own = false
+	return &Frozen{*d}
+}
+
+// Thaw returns a copy of f that can be changed.
+func (f *Frozen) Thaw() *Image {
+	d := New(f.m.Rect, append(color.Palette(nil), f.m.Palette...))
+	Blit(d, d.Rect, &f.m, f.m.Rect.Min)
+	return d
+}
+
+// At returns the color of the pixel at (x, y).
+func (f *Frozen) At(x, y int) color.Color { return f.m.At(x, y) }
+
+// RGBA64At returns the color of the pixel at (x, y) as a color.RGBA64.
+func (f *Frozen) RGBA64At(x, y int) color.RGBA64 { return f.m.RGBA64At(x, y) }
+
+// ColorIndexAt returns the palette index of the pixel at (x, y).
+func (f *Frozen) ColorIndexAt(x, y int) uint8 { return f.m.ColorIndexAt(x, y) }
+
+// Bounds returns the domain for which At can return non-zero color.
+func (f *Frozen) Bounds() image.Rectangle { return f.m.Rect }
+
+// ColorModel returns the image's palette.
+func (f *Frozen) ColorModel() color.Model { return f.m.Palette }
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (f *Frozen) Opaque() bool { return f.m.Opaque() }
+
+// SubImage returns the read-only portion of the image visible through r,
+// sharing the pixels. As with Image.SubImage, the left edge has to be byte
+// aligned.
+func (f *Frozen) SubImage(r image.Rectangle) *Frozen {
+	return &Frozen{*f.m.SubImage(r)}
+}
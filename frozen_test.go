@@ -0,0 +1,71 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestFrozen(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	full := randImage(r, image.Rect(-4, 3, 75, 20))
+	m := full.SubImage(image.Rect(4, 5, 60, 18))
+	want := New(m.Rect, append(color.Palette(nil), m.Palette...))
+	Blit(want, want.Rect, m, m.Rect.Min)
+	f := m.Freeze()
+	// Changes to the original do not show.
+	for i := range full.Pix {
+		full.Pix[i] = ^full.Pix[i]
+	}
+	full.Palette[0] = color.Transparent
+	if f.Bounds() != m.Rect {
+		t.Fatalf("bounds %v, want %v", f.Bounds(), m.Rect)
+	}
+	if !equalPixels(f.Thaw(), want) {
+		t.Fatal("pixels changed")
+	}
+	if f.At(4, 5) != want.At(4, 5) || f.ColorModel().Convert(color.Transparent) == color.Transparent {
+		t.Error("palette changed")
+	}
+
+	// Nor do changes to a thawed copy.
+	th := f.Thaw()
+	th.SetColorIndex(4, 5, 1-th.ColorIndexAt(4, 5))
+	if f.ColorIndexAt(4, 5) == th.ColorIndexAt(4, 5) {
+		t.Error("thawed copy shares pixels")
+	}
+
+	s := f.SubImage(image.Rect(12, 6, 30, 9))
+	for y := 6; y < 9; y++ {
+		for x := 12; x < 30; x++ {
+			if s.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) || s.RGBA64At(x, y) != want.RGBA64At(x, y) {
+				t.Fatalf("sub-image at (%d, %d) differs", x, y)
+			}
+		}
+	}
+
+	// Concurrent readers.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := 5; y < 18; y++ {
+				for x := 4; x < 60; x++ {
+					if f.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) {
+						t.Errorf("(%d, %d) differs", x, y)
+						return
+					}
+				}
+			}
+			f.Opaque()
+		}()
+	}
+	wg.Wait()
+}
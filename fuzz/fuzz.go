@@ -0,0 +1,141 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fuzz helps fuzzing the img1b decoders, with go-fuzz or with the
+// native fuzzing of go test.
+//
+// Run decodes fuzzed data, turning a panic into a *PanicError that keeps
+// its value and stack and an image failing Validate into its
+// img1b.InvalidError, and RoundTrip checks that a decoded image survives
+// encoding and decoding again. These errors are bugs, which IsBug tells
+// from the errors expected of malformed data. GoFuzz turns the
+// outcome into the result of a go-fuzz Fuzz function.
+//
+// A decoder package offers a DecodeFuzz function built with these and a
+// seed corpus, as png does:
+//
+//	func Fuzz(data []byte) int { return png.DecodeFuzz(data) }
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// A PanicError is a panic recovered by Run.
+type PanicError struct {
+	// Value is the value the decoder panicked with.
+	Value interface{}
+	// Stack is the stack of the goroutine at the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("fuzz: panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Runtime reports whether the panic is a runtime error, such as an index
+// out of range or a nil dereference, rather than a panic of the decoder
+// itself.
+func (e *PanicError) Runtime() bool {
+	_, ok := e.Value.(runtime.Error)
+	return ok
+}
+
+// A RoundTripError tells how a decoded image came out of encoding and
+// decoding again different.
+type RoundTripError string
+
+func (e RoundTripError) Error() string { return "fuzz: round trip: " + string(e) }
+
+// IsBug reports whether err, returned by Run or RoundTrip, is a bug rather
+// than a rejection of malformed data.
+func IsBug(err error) bool {
+	switch err.(type) {
+	case *PanicError, RoundTripError, img1b.InvalidError:
+		return true
+	}
+	return false
+}
+
+// Run returns decode(data), with a panic recovered as a *PanicError. An
+// image decoded is checked with Validate, and not returned if invalid.
+func Run(decode func([]byte) (*img1b.Image, error), data []byte) (*img1b.Image, error) {
+	var m *img1b.Image
+	err := protect(func() error {
+		var err error
+		m, err = decode(data)
+		return err
+	})
+	if _, ok := err.(*PanicError); ok {
+		return nil, err
+	}
+	if err == nil {
+		if verr := m.Validate(); verr != nil {
+			return nil, verr
+		}
+	}
+	return m, err
+}
+
+// protect returns f(), with a panic recovered as a *PanicError.
+func protect(f func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
+
+// RoundTrip encodes m with encode and decodes the result with decode,
+// returning a RoundTripError if that fails or gives an image with other
+// dimensions or colors than m, and a *PanicError if either panics.
+func RoundTrip(m *img1b.Image, encode func(io.Writer, *img1b.Image) error, decode func([]byte) (*img1b.Image, error)) error {
+	var b bytes.Buffer
+	if err := protect(func() error { return encode(&b, m) }); err != nil {
+		if IsBug(err) {
+			return err
+		}
+		return RoundTripError("encoding: " + err.Error())
+	}
+	d, err := Run(decode, b.Bytes())
+	if err != nil {
+		if IsBug(err) {
+			return err
+		}
+		return RoundTripError("decoding: " + err.Error())
+	}
+	if d.Rect.Size() != m.Rect.Size() {
+		return RoundTripError(fmt.Sprintf("size %v, want %v", d.Rect.Size(), m.Rect.Size()))
+	}
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			got := d.RGBA64At(d.Rect.Min.X+x, d.Rect.Min.Y+y)
+			want := m.RGBA64At(m.Rect.Min.X+x, m.Rect.Min.Y+y)
+			if got != want {
+				return RoundTripError(fmt.Sprintf("pixel (%d, %d) is %v, want %v", x, y, got, want))
+			}
+		}
+	}
+	return nil
+}
+
+// GoFuzz returns the result of a go-fuzz Fuzz function for data decoded
+// with err: 1, to have the data favored, if err is nil, and 0 if it is an
+// expected error. For a bug it panics with err, for go-fuzz to record the
+// data as a crasher.
+func GoFuzz(err error) int {
+	switch {
+	case err == nil:
+		return 1
+	case IsBug(err):
+		panic(err)
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"errors"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// A toy format: width, height, then a byte per pixel.
+func encode(w io.Writer, m *img1b.Image) error {
+	b := []byte{byte(m.Rect.Dx()), byte(m.Rect.Dy())}
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			b = append(b, m.ColorIndexAt(x, y))
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func decode(b []byte) (*img1b.Image, error) {
+	if len(b) < 2 {
+		return nil, errors.New("short")
+	}
+	w, h := int(b[0]), int(b[1])
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	for i, v := range b[2:] {
+		// Index out of range for too much data.
+		x := i % w
+		m.Pix[i/w*m.Stride+x/8] |= v << uint(7-x%8)
+	}
+	return m, nil
+}
+
+func TestRun(t *testing.T) {
+	m, err := Run(decode, []byte{3, 1, 1, 0, 1})
+	if err != nil || m == nil {
+		t.Fatalf("got %v, %v", m, err)
+	}
+	if _, err := Run(decode, []byte{1}); err == nil || IsBug(err) {
+		t.Errorf("short data: got %v", err)
+	}
+	_, err = Run(decode, []byte{1, 1, 1, 1, 1})
+	p, ok := err.(*PanicError)
+	if !ok || !p.Runtime() || len(p.Stack) == 0 || !IsBug(err) {
+		t.Errorf("overlong data: got %v", err)
+	}
+	_, err = Run(func([]byte) (*img1b.Image, error) { panic("boom") }, nil)
+	if p, ok := err.(*PanicError); !ok || p.Runtime() || p.Value != "boom" {
+		t.Errorf("panic: got %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	m, _ := decode([]byte{5, 2, 1, 0, 1, 1, 0, 0, 1, 0, 0, 1})
+	if err := RoundTrip(m, encode, decode); err != nil {
+		t.Errorf("got %v", err)
+	}
+	lossy := func(w io.Writer, m *img1b.Image) error {
+		return encode(w, m.SubImage(image.Rect(0, 0, 5, 1)))
+	}
+	if err := RoundTrip(m, lossy, decode); !IsBug(err) {
+		t.Errorf("lossy encoder: got %v", err)
+	}
+	flip := func(b []byte) (*img1b.Image, error) {
+		b[2] ^= 1
+		return decode(b)
+	}
+	if _, ok := RoundTrip(m, encode, flip).(RoundTripError); !ok {
+		t.Error("changed pixel not found")
+	}
+	failing := func(io.Writer, *img1b.Image) error { return errors.New("no") }
+	if _, ok := RoundTrip(m, failing, decode).(RoundTripError); !ok {
+		t.Error("encoding error not reported")
+	}
+}
+
+func TestGoFuzz(t *testing.T) {
+	if GoFuzz(nil) != 1 || GoFuzz(errors.New("bad")) != 0 {
+		t.Error("wrong results")
+	}
+	defer func() {
+		if _, ok := recover().(RoundTripError); !ok {
+			t.Error("no panic for a bug")
+		}
+	}()
+	GoFuzz(RoundTripError("x"))
+}
+
+func TestRunInvalid(t *testing.T) {
+	dirty := func(b []byte) (*img1b.Image, error) {
+		m, err := decode(b)
+		if err == nil {
+			m.Pix[0] |= 1
+		}
+		return m, err
+	}
+	_, err := Run(dirty, []byte{3, 1, 1, 0, 1})
+	if _, ok := err.(img1b.InvalidError); !ok || !IsBug(err) {
+		t.Errorf("got %v, want an InvalidError", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package g3 reads and writes raw Group 3 fax streams: ITU-T T.4 coded pages
+// without any header, as exchanged with fax modems and kept by fax spoolers
+// in .g3 files.
+//
+// A page is a sequence of rows, each one preceded by an EOL code, and ends
+// with RTC, six EOLs in a row. Rows are coded one-dimensionally (MH) or, with
+// TwoD, mostly two-dimensionally (MR). The coding itself is done by package
+// ccitt.
+//
+// A stream does not tell its resolution, which only affects the aspect of
+// its pixels: normal resolution pages have rows twice as far apart as fine
+// ones. Decoded images keep the rows as they are unless Options.Stretch is
+// set.
+package g3
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// A FormatError reports that the input is not a valid Group 3 stream.
+type FormatError string
+
+func (e FormatError) Error() string { return "g3: invalid format: " + string(e) }
+
+// Resolution is the vertical resolution of a fax page. The horizontal one
+// is 204 dpi (8 pixels per millimetre) in all cases.
+type Resolution int
+
+const (
+	Fine      Resolution = iota // 196 dpi, 7.7 lines per millimetre
+	Normal                      // 98 dpi, 3.85 lines per millimetre
+	Superfine                   // 391 dpi, 15.4 lines per millimetre
+)
+
+// DPI returns the horizontal and vertical resolution in dots per inch.
+func (r Resolution) DPI() (x, y int) {
+	switch r {
+	case Normal:
+		return 204, 98
+	case Superfine:
+		return 204, 391
+	}
+	return 204, 196
+}
+
+// k returns the K parameter of MR coding recommended by T.4: a
+// one-dimensionally coded row is sent at least every 2 normal or 4 fine
+// rows.
+func (r Resolution) k() int {
+	if r == Normal {
+		return 2
+	}
+	return 4
+}
+
+// Options are the coding parameters of a stream.
+type Options struct {
+	// Width is the number of pixels of a row, for decoding. Zero means
+	// trying the standard fax widths: 1728 (A4), 2048 (B4) and 2432 (A3)
+	// pixels, and twice that.
+	Width int
+
+	// Resolution is the vertical resolution of the page. It sets the K
+	// parameter of MR coding and the scaling done by Stretch.
+	Resolution Resolution
+
+	// TwoD selects MR (two-dimensional) coding. The decoder reads both.
+	TwoD bool
+
+	// NoEOL leaves out the EOL codes before rows and the final RTC. Such
+	// streams can not be resynchronized after an error.
+	NoEOL bool
+
+	// ByteAlign inserts fill bits so that each EOL ends at a byte boundary,
+	// or without EOLs, each row starts at one. Many modems need it.
+	ByteAlign bool
+
+	// LSBFirst stores the first bit of each byte in the least significant
+	// bit, as fax modems send it and most .g3 files keep it. By default it
+	// is in the most significant bit.
+	LSBFirst bool
+
+	// Stretch scales pages vertically to fine resolution: the rows of
+	// normal resolution pages are doubled on decoding and merged in pairs
+	// on encoding, superfine ones the other way round. Merged rows are
+	// black where either row is black, so thin lines are kept.
+	Stretch bool
+
+	// Limits, if not nil, bounds the size of the pages decoded, stretched
+	// or not. Pages over the limits are rejected with an img1b.LimitError
+	// as soon as their rows go over them. The encoder ignores it.
+	Limits *img1b.Limits
+}
+
+// standardWidths are the row widths tried when decoding with no width.
+var standardWidths = []int{1728, 2048, 2432, 3456, 4096, 4864}
+
+// ccittOptions returns the options of the CCITT codec for o.
+func (o *Options) ccittOptions() *ccitt.Options {
+	c := &ccitt.Options{
+		EndOfLine:        !o.NoEOL,
+		EncodedByteAlign: o.ByteAlign,
+		EndOfBlock:       !o.NoEOL,
+		Limits:           o.Limits,
+	}
+	if o.TwoD {
+		c.K = o.Resolution.k()
+	}
+	return c
+}
+
+// Decode reads a page from r. Decoding stops at RTC or at the end of the
+// data. The image palette is {white, black}.
+func Decode(r io.Reader, opt *Options) (*img1b.Image, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if o.LSBFirst {
+		img1b.ReverseBits(data)
+	}
+	c := o.ccittOptions()
+	var m *img1b.Image
+	if o.Width != 0 {
+		if o.Width < 0 {
+			return nil, FormatError(fmt.Sprintf("invalid width: %d", o.Width))
+		}
+		m, err = ccitt.Decode(data, o.Width, 0, c)
+	} else {
+		// Rows of the wrong width fail to decode, with EOLs as soon as the
+		// first row ends.
+		for _, w := range standardWidths {
+			m, err = ccitt.Decode(data, w, 0, c)
+			if _, limit := err.(img1b.LimitError); err == nil || limit {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Rect.Dy() == 0 {
+		return nil, FormatError("no rows")
+	}
+	if o.Stretch {
+		switch o.Resolution {
+		case Normal:
+			m, err = double(m, o.Limits)
+		case Superfine:
+			m = merge(m)
+		}
+	}
+	return m, err
+}
+
+// Encode writes the image m to w as a page of a Group 3 stream.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+	c := o.ccittOptions()
+	if o.Stretch && o.Resolution != Fine {
+		m = blackRows(m)
+		if o.Resolution == Normal {
+			m = merge(m)
+		} else {
+			m, _ = double(m, nil)
+		}
+	} else {
+		c.Invert = bitmap.BlackIndex(m.Palette) == 0
+	}
+	data := ccitt.EncodeRows(m.Pix, m.Stride, m.Rect.Dx(), m.Rect.Dy(), c)
+	if o.LSBFirst {
+		img1b.ReverseBits(data)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// blackRows returns a copy of m with black pixels set and zero padding.
+func blackRows(m *img1b.Image) *img1b.Image {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	b := img1b.New(image.Rect(0, 0, width, height), nil)
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(width)
+	for y := 0; y < height; y++ {
+		row := b.Pix[y*b.Stride : (y+1)*b.Stride]
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[len(row)-1] &= tm
+	}
+	return b
+}
+
+// double returns m with each row repeated, allocated within l. m has black
+// pixels set.
+func double(m *img1b.Image, l *img1b.Limits) (*img1b.Image, error) {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	d, err := l.New(image.Rect(0, 0, width, 2*height), m.Palette)
+	if err != nil {
+		return nil, err
+	}
+	for y := 0; y < height; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+d.Stride]
+		copy(d.Pix[2*y*d.Stride:], row)
+		copy(d.Pix[(2*y+1)*d.Stride:], row)
+	}
+	return d, nil
+}
+
+// merge returns m with pairs of rows merged into one, black where either
+// one is. m has black pixels set. An odd last row is kept as it is.
+func merge(m *img1b.Image) *img1b.Image {
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	d := img1b.New(image.Rect(0, 0, width, (height+1)/2), m.Palette)
+	for y := 0; y < height; y++ {
+		src := m.Pix[y*m.Stride : y*m.Stride+d.Stride]
+		dst := d.Pix[y/2*d.Stride:]
+		for i, c := range src {
+			dst[i] |= c
+		}
+	}
+	return d
+}
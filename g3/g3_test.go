@@ -0,0 +1,243 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package g3
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+// testImage returns an image with random blocks, which codes to runs of
+// various lengths.
+func testImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	r := rand.New(rand.NewSource(int64(w + h)))
+	for i := 0; i < 20; i++ {
+		x0, y0 := r.Intn(w), r.Intn(h)
+		x1, y1 := x0+r.Intn(w-x0)+1, y0+r.Intn(h-y0)+1
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				m.Pix[y*m.Stride+x/8] ^= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return m
+}
+
+// sameBlack reports whether a and b have the same black pixels.
+func sameBlack(a, b *img1b.Image) bool {
+	if a.Rect.Size() != b.Rect.Size() {
+		return false
+	}
+	ba, bb := bitmap.BlackIndex(a.Palette), bitmap.BlackIndex(b.Palette)
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			ca := a.ColorIndexAt(a.Rect.Min.X+x, a.Rect.Min.Y+y) == ba
+			cb := b.ColorIndexAt(b.Rect.Min.X+x, b.Rect.Min.Y+y) == bb
+			if ca != cb {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	wb := color.Palette{color.White, color.Black}
+	bw := color.Palette{color.Black, color.White}
+	tests := []struct {
+		w, h    int
+		palette color.Palette
+		opt     *Options
+		width   int // the decoding width
+	}{
+		{1728, 40, wb, nil, 0},
+		{1728, 40, bw, &Options{TwoD: true}, 0},
+		{2048, 30, wb, &Options{TwoD: true, Resolution: Normal, ByteAlign: true}, 0},
+		{2432, 30, wb, &Options{LSBFirst: true}, 0},
+		{100, 30, bw, &Options{NoEOL: true}, 100},
+		{100, 30, wb, &Options{NoEOL: true, ByteAlign: true, TwoD: true}, 100},
+		{1728, 20, wb, &Options{Stretch: true}, 0},
+	}
+	for i, tt := range tests {
+		m := testImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := Encode(&b, m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		var opt Options
+		if tt.opt != nil {
+			opt = *tt.opt
+		}
+		opt.Width = tt.width
+		d, err := Decode(&b, &opt)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !sameBlack(m, d) {
+			t.Errorf("%d: decoded image differs", i)
+		}
+	}
+}
+
+func TestSubImage(t *testing.T) {
+	m := testImage(1760, 50, color.Palette{color.White, color.Black})
+	sub := m.SubImage(image.Rect(16, 5, 1744, 45))
+	var b bytes.Buffer
+	if err := Encode(&b, sub, nil); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(&b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameBlack(sub, d) {
+		t.Error("decoded image differs")
+	}
+}
+
+func TestLSBFirst(t *testing.T) {
+	m := testImage(1728, 10, color.Palette{color.White, color.Black})
+	var msb, lsb bytes.Buffer
+	if err := Encode(&msb, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&lsb, m, &Options{LSBFirst: true}); err != nil {
+		t.Fatal(err)
+	}
+	a, b := msb.Bytes(), lsb.Bytes()
+	if len(a) != len(b) {
+		t.Fatalf("lengths %d and %d differ", len(a), len(b))
+	}
+	for i := range a {
+		if bits.Reverse8(a[i]) != b[i] {
+			t.Fatalf("byte %d: %#02x and %#02x", i, a[i], b[i])
+		}
+	}
+}
+
+func TestByteAlign(t *testing.T) {
+	m := testImage(1728, 10, color.Palette{color.White, color.Black})
+	var b bytes.Buffer
+	if err := Encode(&b, m, &Options{ByteAlign: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Each row and RTC start with an EOL ending at a byte boundary, so
+	// there are at least that many 0x01 bytes following four zero bits.
+	data := b.Bytes()
+	n := 0
+	for i := 1; i < len(data); i++ {
+		if data[i] == 0x01 && data[i-1]&0x0f == 0 {
+			n++
+		}
+	}
+	if n < 10+6 {
+		t.Errorf("found %d aligned EOLs, want at least %d", n, 10+6)
+	}
+}
+
+func TestStretch(t *testing.T) {
+	p := color.Palette{color.White, color.Black}
+	m := img1b.New(image.Rect(0, 0, 1728, 5), p)
+	m.Pix[0*m.Stride] = 0x80
+	m.Pix[1*m.Stride+1] = 0x80
+	m.Pix[4*m.Stride+2] = 0x80
+
+	var b bytes.Buffer
+	if err := Encode(&b, m, &Options{Resolution: Normal, Stretch: true}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Decode(bytes.NewReader(b.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Rect.Dy() != 3 {
+		t.Fatalf("got %d rows, want 3", d.Rect.Dy())
+	}
+	if d.Pix[0] != 0x80 || d.Pix[1] != 0x80 || d.Pix[2*d.Stride+2] != 0x80 {
+		t.Error("rows not merged")
+	}
+
+	d, err = Decode(bytes.NewReader(b.Bytes()), &Options{Resolution: Normal, Stretch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Rect.Dy() != 6 {
+		t.Fatalf("got %d rows, want 6", d.Rect.Dy())
+	}
+	if !bytes.Equal(d.Pix[4*d.Stride:5*d.Stride], d.Pix[5*d.Stride:6*d.Stride]) {
+		t.Error("rows not doubled")
+	}
+
+	b.Reset()
+	if err := Encode(&b, m, &Options{Resolution: Superfine, Stretch: true}); err != nil {
+		t.Fatal(err)
+	}
+	d, err = Decode(&b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Rect.Dy() != 10 {
+		t.Fatalf("got %d rows, want 10", d.Rect.Dy())
+	}
+}
+
+func TestResolutionDPI(t *testing.T) {
+	for r, want := range map[Resolution]int{Fine: 196, Normal: 98, Superfine: 391} {
+		if x, y := r.DPI(); x != 204 || y != want {
+			t.Errorf("%d: got %dx%d, want 204x%d", r, x, y, want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		data []byte
+		opt  *Options
+	}{
+		{nil, nil},
+		{[]byte{0, 1}, nil},
+		{[]byte{0xff, 0xff, 0xff}, nil},
+		{[]byte{0, 1}, &Options{Width: -1}},
+	}
+	for i, tt := range tests {
+		if _, err := Decode(bytes.NewReader(tt.data), tt.opt); err == nil {
+			t.Errorf("%d: no error", i)
+		}
+	}
+	m := img1b.New(image.Rect(0, 0, 0, 5), nil)
+	if err := Encode(&bytes.Buffer{}, m, nil); err == nil {
+		t.Error("empty image: no error")
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	var b bytes.Buffer
+	if err := Encode(&b, testImage(1728, 10, nil), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		opt Options
+		ok  bool
+	}{
+		{Options{Limits: &img1b.Limits{MaxPixels: 1728 * 10}}, true},
+		{Options{Limits: &img1b.Limits{MaxPixels: 1728*10 - 1}}, false},
+		{Options{Width: 1728, Limits: &img1b.Limits{MaxPixels: 1728*10 - 1}}, false},
+		// Stretched to 20 rows.
+		{Options{Resolution: Normal, Stretch: true, Limits: &img1b.Limits{MaxPixels: 1728 * 10}}, false},
+		{Options{Resolution: Normal, Stretch: true, Limits: &img1b.Limits{MaxPixels: 1728 * 20}}, true},
+	} {
+		_, err := Decode(bytes.NewReader(b.Bytes()), &tt.opt)
+		if _, limit := err.(img1b.LimitError); tt.ok && err != nil || !tt.ok && !limit {
+			t.Errorf("%+v: got %v", tt.opt, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	gogif "image/gif"
+	"testing"
+)
+
+var bw = color.Palette{color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}}
+
+func paletted(r image.Rectangle, p color.Palette) *image.Paletted {
+	m := image.NewPaletted(r, p)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetColorIndex(x, y, uint8(x*y/3)&1)
+		}
+	}
+	return m
+}
+
+func same(t *testing.T, name string, want *image.Paletted, got *img1b.Image) {
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("%s: got bounds %v, want %v", name, got.Bounds(), want.Bounds())
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) {
+				t.Fatalf("%s: at (%d, %d) got %d, want %d", name, x, y, got.ColorIndexAt(x, y), want.ColorIndexAt(x, y))
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	m0 := paletted(image.Rect(0, 0, 29, 17), bw)
+	var b bytes.Buffer
+	if err := gogif.Encode(&b, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same(t, "single", m0, m1)
+}
+
+func TestDecodeLimits(t *testing.T) {
+	g0 := &gogif.GIF{
+		Image: []*image.Paletted{
+			paletted(image.Rect(0, 0, 40, 30), bw),
+			paletted(image.Rect(13, 5, 31, 20), bw),
+		},
+		Delay: []int{0, 0},
+	}
+	var b bytes.Buffer
+	if err := gogif.EncodeAll(&b, g0); err != nil {
+		t.Fatal(err)
+	}
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 40 * 30}}
+	if _, err := d.DecodeAll(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	d.Limits.MaxPixels--
+	_, err := d.DecodeAll(bytes.NewReader(b.Bytes()))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	g0 := &gogif.GIF{
+		Image: []*image.Paletted{
+			paletted(image.Rect(0, 0, 40, 30), bw),
+			paletted(image.Rect(13, 5, 31, 20), bw),
+		},
+		Delay:     []int{10, 20},
+		Disposal:  []byte{DisposalNone, DisposalBackground},
+		LoopCount: 3,
+	}
+	var b bytes.Buffer
+	if err := gogif.EncodeAll(&b, g0); err != nil {
+		t.Fatal(err)
+	}
+	g1, err := DecodeAll(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Image) != 2 {
+		t.Fatalf("got %d frames, want 2", len(g1.Image))
+	}
+	for i := range g0.Image {
+		same(t, "frame", g0.Image[i], g1.Image[i])
+		if g1.Delay[i] != g0.Delay[i] || g1.Disposal[i] != g0.Disposal[i] {
+			t.Errorf("frame %d: got delay %d disposal %d", i, g1.Delay[i], g1.Disposal[i])
+		}
+	}
+	if g1.LoopCount != 3 {
+		t.Errorf("got loop count %d, want 3", g1.LoopCount)
+	}
+}
+
+func TestDecodeTransparent(t *testing.T) {
+	p := color.Palette{color.RGBA{0, 0, 0, 0}, color.RGBA{0xff, 0xff, 0xff, 0xff}}
+	var b bytes.Buffer
+	if err := gogif.Encode(&b, paletted(image.Rect(0, 0, 5, 5), p), nil); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := m.Palette[0].RGBA(); a != 0 {
+		t.Errorf("color 0 is not transparent")
+	}
+}
+
+func TestDecodeManyColors(t *testing.T) {
+	p := color.Palette{color.Black, color.White, color.Gray{0x80}, color.Gray{0x40}}
+	m0 := paletted(image.Rect(0, 0, 5, 5), p)
+	var b bytes.Buffer
+	if err := gogif.Encode(&b, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	if _, err := Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("indices 0 and 1 only: %v", err)
+	}
+
+	m0.SetColorIndex(2, 2, 3)
+	b.Reset()
+	if err := gogif.Encode(&b, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(&b); err != errBadPixel {
+		t.Errorf("got %v, want %v", err, errBadPixel)
+	}
+}
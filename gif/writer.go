@@ -0,0 +1,448 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bufio"
+	"compress/lzw"
+	"errors"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// writer is a buffered writer.
+type writer interface {
+	Flush() error
+	io.Writer
+	io.ByteWriter
+}
+
+// encoder encodes an image to the GIF format.
+type encoder struct {
+	// w is the writer to write to. err is the first error encountered during
+	// writing. All attempted writes after the first error become no-ops.
+	w   writer
+	err error
+	// g is a reference to the data that is being encoded.
+	g GIF
+	// buf is a scratch buffer. It must be at least 256 for the blockWriter.
+	buf [256]byte
+	// row is a scratch buffer for a row of expanded pixel indices.
+	row []byte
+}
+
+// blockWriter writes the block structure of GIF image data, which
+// comprises (n, (n bytes)) blocks, with 1 <= n <= 255. It is the
+// writer given to the LZW encoder, which is thus immune to the
+// blocking.
+type blockWriter struct {
+	e *encoder
+}
+
+func (b blockWriter) setup() {
+	b.e.buf[0] = 0
+}
+
+func (b blockWriter) Flush() error {
+	return b.e.err
+}
+
+func (b blockWriter) WriteByte(c byte) error {
+	if b.e.err != nil {
+		return b.e.err
+	}
+
+	// Append c to buffered sub-block.
+	b.e.buf[0]++
+	b.e.buf[b.e.buf[0]] = c
+	if b.e.buf[0] < 255 {
+		return nil
+	}
+
+	// Flush block
+	b.e.write(b.e.buf[:256])
+	b.e.buf[0] = 0
+	return b.e.err
+}
+
+// blockWriter must be an io.Writer for lzw.NewWriter, but this is never
+// actually called.
+func (b blockWriter) Write(data []byte) (int, error) {
+	for i, c := range data {
+		if err := b.WriteByte(c); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
+}
+
+func (b blockWriter) close() {
+	// Write the block terminator (0x00), either by itself, or along with a
+	// pending sub-block.
+	if b.e.buf[0] == 0 {
+		b.e.writeByte(0)
+	} else {
+		n := uint(b.e.buf[0])
+		b.e.buf[n+1] = 0
+		b.e.write(b.e.buf[:n+2])
+	}
+	b.e.flush()
+}
+
+func (e *encoder) flush() {
+	if e.err != nil {
+		return
+	}
+	e.err = e.w.Flush()
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(p)
+}
+
+func (e *encoder) writeByte(b byte) {
+	if e.err != nil {
+		return
+	}
+	e.err = e.w.WriteByte(b)
+}
+
+func (e *encoder) writeHeader() {
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, "GIF89a")
+	if e.err != nil {
+		return
+	}
+
+	// Logical screen width and height.
+	writeUint16(e.buf[0:2], uint16(e.g.Config.Width))
+	writeUint16(e.buf[2:4], uint16(e.g.Config.Height))
+	e.write(e.buf[:4])
+
+	if p, ok := e.g.Config.ColorModel.(color.Palette); ok && len(p) > 0 {
+		// Two-entry global color table.
+		e.buf[0] = fColorTable
+		e.buf[1] = e.g.BackgroundIndex
+		e.buf[2] = 0x00 // Pixel Aspect Ratio.
+		e.write(e.buf[:3])
+		e.writeColorTable(p)
+	} else {
+		// All frames have a local color table, so a global color table
+		// is not needed.
+		e.buf[0] = 0x00
+		e.buf[1] = 0x00 // Background Color Index.
+		e.buf[2] = 0x00 // Pixel Aspect Ratio.
+		e.write(e.buf[:3])
+	}
+
+	// Add animation info if necessary.
+	if len(e.g.Image) > 1 && e.g.LoopCount >= 0 {
+		e.buf[0] = 0x21 // Extension Introducer.
+		e.buf[1] = 0xff // Application Label.
+		e.buf[2] = 0x0b // Block Size.
+		e.write(e.buf[:3])
+		_, err := io.WriteString(e.w, "NETSCAPE2.0") // Application Identifier.
+		if err != nil && e.err == nil {
+			e.err = err
+			return
+		}
+		e.buf[0] = 0x03 // Block Size.
+		e.buf[1] = 0x01 // Sub-block Index.
+		writeUint16(e.buf[2:4], uint16(e.g.LoopCount))
+		e.buf[4] = 0x00 // Block Terminator.
+		e.write(e.buf[:5])
+	}
+}
+
+// writeColorTable writes a two-entry color table. Missing entries are black.
+func (e *encoder) writeColorTable(p color.Palette) {
+	for i := 0; i < 2; i++ {
+		c := color.Color(color.Black)
+		if i < len(p) {
+			c = p[i]
+		}
+		c1 := color.RGBAModel.Convert(c).(color.RGBA)
+		e.buf[3*i+0] = c1.R
+		e.buf[3*i+1] = c1.G
+		e.buf[3*i+2] = c1.B
+	}
+	e.write(e.buf[:6])
+}
+
+// transparentIndex returns the index of the first transparent palette color,
+// or -1.
+func transparentIndex(p color.Palette) int {
+	for i, c := range p {
+		if i > 1 {
+			break
+		}
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeImageBlock writes the part r of pm as a frame.
+func (e *encoder) writeImageBlock(pm *img1b.Image, b image.Rectangle, delay int, disposal byte) {
+	if e.err != nil {
+		return
+	}
+
+	if len(pm.Palette) == 0 {
+		e.err = errors.New("gif: cannot encode image block with empty palette")
+		return
+	}
+
+	if b.Min.X < 0 || b.Max.X >= 1<<16 || b.Min.Y < 0 || b.Max.Y >= 1<<16 {
+		e.err = errors.New("gif: image block is too large to encode")
+		return
+	}
+	if !b.In(image.Rectangle{Max: image.Point{e.g.Config.Width, e.g.Config.Height}}) {
+		e.err = errors.New("gif: image block is out of bounds")
+		return
+	}
+
+	transparent := transparentIndex(pm.Palette)
+	if delay > 0 || disposal != 0 || transparent != -1 {
+		e.buf[0] = sExtension  // Extension Introducer.
+		e.buf[1] = gcLabel     // Graphic Control Label.
+		e.buf[2] = gcBlockSize // Block Size.
+		if transparent != -1 {
+			e.buf[3] = 0x01 | disposal<<2
+		} else {
+			e.buf[3] = 0x00 | disposal<<2
+		}
+		writeUint16(e.buf[4:6], uint16(delay)) // Delay Time (1/100ths of a second)
+
+		// Transparent color index.
+		if transparent != -1 {
+			e.buf[6] = uint8(transparent)
+		} else {
+			e.buf[6] = 0x00
+		}
+		e.buf[7] = 0x00 // Block Terminator.
+		e.write(e.buf[:8])
+	}
+	e.buf[0] = sImageDescriptor
+	writeUint16(e.buf[1:3], uint16(b.Min.X))
+	writeUint16(e.buf[3:5], uint16(b.Min.Y))
+	writeUint16(e.buf[5:7], uint16(b.Dx()))
+	writeUint16(e.buf[7:9], uint16(b.Dy()))
+	e.write(e.buf[:9])
+
+	if p, ok := e.g.Config.ColorModel.(color.Palette); ok && len(p) > 0 && samePalette(p, pm.Palette) {
+		e.writeByte(0) // Use the global color table.
+	} else {
+		// Use a local color table of two entries.
+		e.writeByte(fColorTable)
+		e.writeColorTable(pm.Palette)
+	}
+
+	// The minimum code size is 2 even for 1-bit images.
+	const litWidth = 2
+	e.writeByte(litWidth)
+
+	bw := blockWriter{e: e}
+	bw.setup()
+	lzww := lzw.NewWriter(bw, lzw.LSB, litWidth)
+	if cap(e.row) < b.Dx() {
+		e.row = make([]byte, b.Dx())
+	}
+	row := e.row[:b.Dx()]
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		src := pm.Pix[(y-pm.Rect.Min.Y)*pm.Stride:]
+		for x := range row {
+			sx := b.Min.X - pm.Rect.Min.X + x
+			row[x] = src[sx/8] >> uint(7-sx%8) & 1
+		}
+		if _, e.err = lzww.Write(row); e.err != nil {
+			lzww.Close()
+			return
+		}
+	}
+	lzww.Close() // flush to bw
+	bw.close()   // flush to e.w
+}
+
+// samePalette reports whether the first two colors of p0 and p1 are equal.
+func samePalette(p0, p1 color.Palette) bool {
+	if len(p0) < 2 != (len(p1) < 2) {
+		return false
+	}
+	for i := 0; i < 2 && i < len(p0); i++ {
+		if color.RGBAModel.Convert(p0[i]) != color.RGBAModel.Convert(p1[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Graphic control extension fields.
+const (
+	gcLabel     = 0xF9
+	gcBlockSize = 0x04
+)
+
+func writeUint16(b []uint8, u uint16) {
+	b[0] = uint8(u)
+	b[1] = uint8(u >> 8)
+}
+
+func newEncoder(w io.Writer) *encoder {
+	e := &encoder{}
+	if ww, ok := w.(writer); ok {
+		e.w = ww
+	} else {
+		e.w = bufio.NewWriter(w)
+	}
+	return e
+}
+
+// Encode writes the Image m to w in GIF format with one bit per pixel.
+func Encode(w io.Writer, m *img1b.Image) error {
+	// Check for bounds and size restrictions.
+	b := m.Bounds()
+	if b.Dx() >= 1<<16 || b.Dy() >= 1<<16 {
+		return errors.New("gif: image is too large to encode")
+	}
+	if b.Empty() {
+		return errors.New("gif: cannot encode empty image")
+	}
+
+	e := newEncoder(w)
+	// A new Image at the origin over the same pixels; copying *m would
+	// also copy its bookkeeping, such as the pool ownership of New images.
+	pm := &img1b.Image{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect.Sub(m.Rect.Min), Palette: m.Palette}
+	e.g.Image = []*img1b.Image{pm}
+	e.g.Config = image.Config{
+		ColorModel: m.Palette,
+		Width:      b.Dx(),
+		Height:     b.Dy(),
+	}
+
+	e.writeHeader()
+	e.writeImageBlock(pm, pm.Rect, 0, 0)
+	e.writeByte(sTrailer)
+	e.flush()
+	return e.err
+}
+
+// EncodeAll writes the images in g to w in GIF format with the given loop
+// count, delay and disposal methods.
+//
+// When a frame only changes part of the previous one, only the changed
+// rectangle is written. This happens if both frames have the same bounds and
+// palette without transparent colors and the previous frame is not disposed.
+func EncodeAll(w io.Writer, g *GIF) error {
+	if len(g.Image) == 0 {
+		return errors.New("gif: must provide at least one image")
+	}
+
+	if len(g.Image) != len(g.Delay) {
+		return errors.New("gif: mismatched image and delay lengths")
+	}
+
+	if g.Disposal != nil && len(g.Image) != len(g.Disposal) {
+		return errors.New("gif: mismatched image and disposal lengths")
+	}
+
+	e := newEncoder(w)
+	e.g = *g
+	// A zero Config means that the logical screen is derived from the frame
+	// bounds and the first frame's palette becomes the global color table.
+	if e.g.Config == (image.Config{}) {
+		var p image.Point
+		for _, m := range g.Image {
+			if m.Rect.Max.X > p.X {
+				p.X = m.Rect.Max.X
+			}
+			if m.Rect.Max.Y > p.Y {
+				p.Y = m.Rect.Max.Y
+			}
+		}
+		e.g.Config.Width = p.X
+		e.g.Config.Height = p.Y
+		e.g.Config.ColorModel = g.Image[0].Palette
+	} else if e.g.Config.ColorModel != nil {
+		if _, ok := e.g.Config.ColorModel.(color.Palette); !ok {
+			return errors.New("gif: GIF color model must be a color.Palette")
+		}
+	}
+
+	e.writeHeader()
+	for i, pm := range g.Image {
+		disposal := uint8(0)
+		if g.Disposal != nil {
+			disposal = g.Disposal[i]
+		}
+		r := pm.Rect
+		if i > 0 {
+			prevDisposal := uint8(0)
+			if g.Disposal != nil {
+				prevDisposal = g.Disposal[i-1]
+			}
+			if prevDisposal == 0 || prevDisposal == DisposalNone {
+				r = changedRect(g.Image[i-1], pm)
+			}
+		}
+		e.writeImageBlock(pm, r, g.Delay[i], disposal)
+	}
+	e.writeByte(sTrailer)
+	e.flush()
+	return e.err
+}
+
+// changedRect returns the part of m that differs from prev, which is
+// displayed underneath it. The whole of m is returned if the frames can't be
+// compared.
+func changedRect(prev, m *img1b.Image) image.Rectangle {
+	if prev.Rect != m.Rect || !samePalette(prev.Palette, m.Palette) ||
+		transparentIndex(prev.Palette) != -1 || transparentIndex(m.Palette) != -1 {
+		return m.Rect
+	}
+	b := m.Rect
+	rowBytes := (b.Dx() + 7) / 8
+	tm := bitmap.TailMask(b.Dx())
+	x0, x1, y0, y1 := rowBytes*8, -1, -1, -1
+	for y := 0; y < b.Dy(); y++ {
+		r0 := prev.Pix[y*prev.Stride : y*prev.Stride+rowBytes]
+		r1 := m.Pix[y*m.Stride : y*m.Stride+rowBytes]
+		for i := range r1 {
+			d := r0[i] ^ r1[i]
+			if i == rowBytes-1 {
+				d &= tm
+			}
+			if d == 0 {
+				continue
+			}
+			if y0 < 0 {
+				y0 = y
+			}
+			y1 = y
+			if x := i*8 + bits.LeadingZeros8(d); x < x0 {
+				x0 = x
+			}
+			if x := i*8 + 7 - bits.TrailingZeros8(d); x > x1 {
+				x1 = x
+			}
+		}
+	}
+	if y0 < 0 {
+		// Nothing changed but frames can't be empty.
+		return image.Rectangle{b.Min, b.Min.Add(image.Point{1, 1})}
+	}
+	return image.Rect(x0, y0, x1+1, y1+1).Add(b.Min)
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	gogif "image/gif"
+	"testing"
+)
+
+func testImage(r image.Rectangle, p color.Palette) *img1b.Image {
+	m := img1b.New(r, p)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetColorIndex(x, y, uint8(x*y/5+x/3)&1)
+		}
+	}
+	return m
+}
+
+func TestEncode(t *testing.T) {
+	m0 := testImage(image.Rect(0, 0, 301, 77), bw)
+	var b bytes.Buffer
+	if err := Encode(&b, m0); err != nil {
+		t.Fatal(err)
+	}
+	// The stock decoder must accept the output.
+	pm, err := gogif.Decode(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 77; y++ {
+		for x := 0; x < 301; x++ {
+			r0, g0, b0, a0 := m0.At(x, y).RGBA()
+			r1, g1, b1, a1 := pm.At(x, y).RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				t.Fatalf("at (%d, %d): got %v, want %v", x, y, pm.At(x, y), m0.At(x, y))
+			}
+		}
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m0.Pix, m1.Pix) {
+		t.Error("round trip differs")
+	}
+}
+
+func TestEncodeTransparent(t *testing.T) {
+	p := color.Palette{color.Black, color.Transparent}
+	m0 := testImage(image.Rect(16, 8, 40, 20), p)
+	var b bytes.Buffer
+	if err := Encode(&b, m0); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m1.Bounds() != image.Rect(0, 0, 24, 12) {
+		t.Errorf("got bounds %v", m1.Bounds())
+	}
+	if _, _, _, a := m1.Palette[1].RGBA(); a != 0 {
+		t.Errorf("color 1 is not transparent")
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	m := testImage(image.Rect(0, 0, 640, 480), bw)
+	var buf bytes.Buffer
+	b.SetBytes(640 * 480 / 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		Encode(&buf, m)
+	}
+}
+
+func TestEncodeAll(t *testing.T) {
+	r := image.Rect(0, 0, 50, 20)
+	f0 := testImage(r, bw)
+	f1 := testImage(r, bw)
+	copy(f1.Pix, f0.Pix)
+	for y := 5; y < 9; y++ {
+		for x := 11; x < 21; x++ {
+			f1.SetColorIndex(x, y, 1-f1.ColorIndexAt(x, y))
+		}
+	}
+	f2 := testImage(r, bw)
+	copy(f2.Pix, f1.Pix)
+	g0 := &GIF{
+		Image:     []*img1b.Image{f0, f1, f2},
+		Delay:     []int{5, 10, 15},
+		LoopCount: 0,
+	}
+	var b bytes.Buffer
+	if err := EncodeAll(&b, g0); err != nil {
+		t.Fatal(err)
+	}
+	g1, err := DecodeAll(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Image) != 3 {
+		t.Fatalf("got %d frames, want 3", len(g1.Image))
+	}
+	want := []image.Rectangle{r, image.Rect(11, 5, 21, 9), image.Rect(0, 0, 1, 1)}
+	for i, m := range g1.Image {
+		if m.Bounds() != want[i] {
+			t.Errorf("frame %d: got bounds %v, want %v", i, m.Bounds(), want[i])
+		}
+		b := m.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if m.ColorIndexAt(x, y) != g0.Image[i].ColorIndexAt(x, y) {
+					t.Fatalf("frame %d: at (%d, %d) pixels differ", i, x, y)
+				}
+			}
+		}
+		if g1.Delay[i] != g0.Delay[i] {
+			t.Errorf("frame %d: got delay %d", i, g1.Delay[i])
+		}
+	}
+	if g1.LoopCount != 0 || g1.Config.Width != 50 || g1.Config.Height != 20 {
+		t.Errorf("got loop count %d, size %dx%d", g1.LoopCount, g1.Config.Width, g1.Config.Height)
+	}
+
+	// Disposed frames are written whole.
+	g0.Disposal = []byte{DisposalBackground, DisposalBackground, DisposalNone}
+	b.Reset()
+	if err := EncodeAll(&b, g0); err != nil {
+		t.Fatal(err)
+	}
+	if g1, err = DecodeAll(&b); err != nil {
+		t.Fatal(err)
+	}
+	if g1.Image[1].Bounds() != r {
+		t.Errorf("got bounds %v, want %v", g1.Image[1].Bounds(), r)
+	}
+}
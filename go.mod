@@ -1,3 +1,5 @@
 module github.com/mi-v/img1b
 
 go 1.15
+
+require google.golang.org/protobuf v1.31.0
@@ -0,0 +1,130 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httpimg serves bilevel images over HTTP, such as generated labels
+// and QR codes, in the format the client asks for.
+//
+// ServeImage picks PNG, WBMP or PBM by the Accept header of the request,
+// tags the response with an ETag of its content and answers conditional
+// and range requests as http.ServeContent does.
+package httpimg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"github.com/mi-v/img1b/pnm"
+	"github.com/mi-v/img1b/wbmp"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A format is a media type ServeImage can answer with.
+type format struct {
+	typ    string
+	encode func(w io.Writer, m *img1b.Image) error
+}
+
+// formats are the formats of ServeImage, the first preferred.
+var formats = []format{
+	{"image/png", png.Encode},
+	{"image/vnd.wap.wbmp", wbmp.Encode},
+	{"image/x-portable-bitmap", pnm.Encode},
+}
+
+// ServeImage replies to r with the Image m, encoded as PNG, WBMP or PBM,
+// whichever the Accept header of r prefers, PNG if it has no preference. It
+// replies 406 Not Acceptable if r accepts none of them.
+//
+// The ETag of the response is a hash of the encoded image, so that
+// requests with If-None-Match get 304 Not Modified for an unchanged image
+// without its being sent again. WBMP and PBM keep the darker color of the
+// palette only, as black.
+func ServeImage(w http.ResponseWriter, r *http.Request, m *img1b.Image) {
+	w.Header().Add("Vary", "Accept")
+	f, ok := negotiate(r.Header.Values("Accept"))
+	if !ok {
+		http.Error(w, "406 not acceptable: "+formatList(), http.StatusNotAcceptable)
+		return
+	}
+	var buf bytes.Buffer
+	if err := f.encode(&buf, m); err != nil {
+		http.Error(w, "500 internal server error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	h := w.Header()
+	h.Set("Content-Type", f.typ)
+	h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// negotiate returns the format the Accept header values accept prefer.
+// Each format gets the quality of the most specific media range matching
+// it; of those with the highest quality, above 0, the first of formats is
+// taken.
+func negotiate(accept []string) (format, bool) {
+	if strings.TrimSpace(strings.Join(accept, "")) == "" {
+		return formats[0], true
+	}
+	best, bestQ := -1, 0.0
+	for i, f := range formats {
+		q, spec := 0.0, -1
+		for _, v := range accept {
+			for _, r := range strings.Split(v, ",") {
+				typ, params, err := mime.ParseMediaType(r)
+				if err != nil {
+					continue
+				}
+				s := specificity(typ, f.typ)
+				if s <= spec {
+					continue
+				}
+				spec, q = s, 1
+				if v, ok := params["q"]; ok {
+					if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 {
+						q = 0
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	if best < 0 {
+		return format{}, false
+	}
+	return formats[best], true
+}
+
+// specificity returns how closely the media range r matches the media type
+// typ: 2 for the type itself, 1 for its top-level type with "*", 0 for
+// "*/*", and -1 for no match.
+func specificity(r, typ string) int {
+	switch {
+	case r == typ:
+		return 2
+	case r == "*/*":
+		return 0
+	case strings.HasSuffix(r, "/*") && strings.HasPrefix(typ, r[:len(r)-1]):
+		return 1
+	}
+	return -1
+}
+
+// formatList lists the media types of formats.
+func formatList() string {
+	s := make([]string, len(formats))
+	for i, f := range formats {
+		s[i] = f.typ
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpimg
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"github.com/mi-v/img1b/pnm"
+	"github.com/mi-v/img1b/wbmp"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var decoders = map[string]func(io.Reader) (*img1b.Image, error){
+	"image/png":               png.Decode,
+	"image/vnd.wap.wbmp":      wbmp.Decode,
+	"image/x-portable-bitmap": pnm.Decode,
+}
+
+func testImage() *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 21, 13), color.Palette{color.White, color.Black})
+	for i := 0; i < 13; i++ {
+		m.SetColorIndex(i, i, 1)
+		m.SetColorIndex(20-i, i, 1)
+	}
+	return m
+}
+
+func gray(c color.Color) color.Gray { return color.GrayModel.Convert(c).(color.Gray) }
+
+func TestServeImage(t *testing.T) {
+	m := testImage()
+	for _, tt := range []struct {
+		accept string
+		typ    string
+	}{
+		{"", "image/png"},
+		{"*/*", "image/png"},
+		{"image/vnd.wap.wbmp", "image/vnd.wap.wbmp"},
+		{"image/x-portable-bitmap, image/png;q=0.5", "image/x-portable-bitmap"},
+		{"image/*;q=0.1, image/png;q=0", "image/vnd.wap.wbmp"},
+		{"text/html, image/webp, */*;q=0.8", "image/png"},
+		{"text/html", ""},
+		{"image/png;q=0", ""},
+	} {
+		req := httptest.NewRequest("GET", "/label", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		ServeImage(rec, req, m)
+		if tt.typ == "" {
+			if rec.Code != http.StatusNotAcceptable {
+				t.Errorf("Accept %q: status %d, want %d", tt.accept, rec.Code, http.StatusNotAcceptable)
+			}
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("Accept %q: status %d", tt.accept, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.typ {
+			t.Errorf("Accept %q: content type %q, want %q", tt.accept, got, tt.typ)
+			continue
+		}
+		if rec.Header().Get("Vary") != "Accept" || rec.Header().Get("ETag") == "" {
+			t.Errorf("Accept %q: header %v", tt.accept, rec.Header())
+		}
+		d, err := decoders[tt.typ](rec.Body)
+		if err != nil {
+			t.Errorf("Accept %q: %v", tt.accept, err)
+			continue
+		}
+		for y := 0; y < 13; y++ {
+			for x := 0; x < 21; x++ {
+				if got, want := gray(d.At(x, y)), gray(m.At(x, y)); got != want {
+					t.Fatalf("Accept %q: pixel (%d, %d) is %v, want %v", tt.accept, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestServeImageConditional(t *testing.T) {
+	m := testImage()
+	serve := func(m *img1b.Image, accept, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/label", nil)
+		req.Header.Set("Accept", accept)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		ServeImage(rec, req, m)
+		return rec
+	}
+	first := serve(m, "image/png", "")
+	etag := first.Header().Get("ETag")
+	if again := serve(testImage(), "image/png", ""); again.Header().Get("ETag") != etag {
+		t.Errorf("same image: ETag %q, then %q", etag, again.Header().Get("ETag"))
+	}
+	if rec := serve(m, "image/png", etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match of the ETag: status %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	// Another format, or another image, is another representation.
+	if rec := serve(m, "image/vnd.wap.wbmp", etag); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match of the PNG, for WBMP: status %d", rec.Code)
+	}
+	m.SetColorIndex(1, 0, 1)
+	rec := serve(m, "image/png", etag)
+	if rec.Code != http.StatusOK || bytes.Equal(rec.Body.Bytes(), first.Body.Bytes()) {
+		t.Errorf("changed image: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func testIcon(w, h int) Icon {
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	mask := img1b.New(image.Rect(0, 0, w, h), maskPalette())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			m.SetColorIndex(x, y, uint8((x+y)%3)&1)
+			if x < y/2 {
+				mask.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return Icon{Image: m, Mask: mask, Hotspot: image.Pt(w/2, 1)}
+}
+
+func equal(t *testing.T, name string, got, want *img1b.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("%s: got bounds %v, want %v", name, got.Bounds(), want.Bounds())
+	}
+	for i := range want.Palette {
+		r0, g0, b0, a0 := got.Palette[i].RGBA()
+		r1, g1, b1, a1 := want.Palette[i].RGBA()
+		if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+			t.Fatalf("%s: got palette %v, want %v", name, got.Palette, want.Palette)
+		}
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) {
+				t.Fatalf("%s: at (%d, %d) got %d, want %d", name, x, y, got.ColorIndexAt(x, y), want.ColorIndexAt(x, y))
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, cursor := range []bool{false, true} {
+		f0 := &File{Cursor: cursor, Icons: []Icon{testIcon(32, 32), testIcon(13, 7), testIcon(256, 256)}}
+		var b bytes.Buffer
+		if err := Encode(&b, f0); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := DecodeConfig(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != 32 || cfg.Height != 32 {
+			t.Errorf("DecodeConfig: got %dx%d", cfg.Width, cfg.Height)
+		}
+		f1, err := DecodeAll(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f1.Cursor != cursor || len(f1.Icons) != len(f0.Icons) {
+			t.Fatalf("got cursor %v, %d icons", f1.Cursor, len(f1.Icons))
+		}
+		for i, icon := range f1.Icons {
+			equal(t, "image", icon.Image, f0.Icons[i].Image)
+			equal(t, "mask", icon.Mask, f0.Icons[i].Mask)
+			want := image.Point{}
+			if cursor {
+				want = f0.Icons[i].Hotspot
+			}
+			if icon.Hotspot != want {
+				t.Errorf("got hotspot %v, want %v", icon.Hotspot, want)
+			}
+		}
+	}
+}
+
+func TestNilMask(t *testing.T) {
+	icon := testIcon(16, 16)
+	icon.Mask = nil
+	var b bytes.Buffer
+	if err := Encode(&b, &File{Icons: []Icon{icon}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := DecodeAll(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range f.Icons[0].Mask.Pix {
+		if c != 0 {
+			t.Fatal("mask is not opaque")
+		}
+	}
+}
+
+func TestSkipColorImages(t *testing.T) {
+	var b bytes.Buffer
+	Encode(&b, &File{Icons: []Icon{testIcon(16, 16), testIcon(8, 8)}})
+	data := b.Bytes()
+	// Turn the first image into a PNG one.
+	off := binary.LittleEndian.Uint32(data[dirLen+12:])
+	copy(data[off:], pngSignature)
+	f, err := DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Icons) != 1 || f.Icons[0].Image.Bounds().Dx() != 8 {
+		t.Errorf("got %d icons", len(f.Icons))
+	}
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	equal(t, "Decode", m, testIcon(8, 8).Image)
+}
+
+func TestOneColor(t *testing.T) {
+	var b bytes.Buffer
+	Encode(&b, &File{Icons: []Icon{testIcon(16, 16)}})
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data[dirLen+entryLen+32:], 1)
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Palette) != 2 {
+		t.Fatalf("got %d palette entries, want 2", len(m.Palette))
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			m.At(x, y)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	var b bytes.Buffer
+	Encode(&b, &File{Icons: []Icon{testIcon(16, 16)}})
+	data := b.Bytes()
+	bpp4 := append([]byte(nil), data...)
+	bpp4[dirLen+entryLen+14] = 4
+	for _, tt := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "unexpected EOF"},
+		{[]byte("\x00\x00\x03\x00\x01\x00"), "not an icon file"},
+		{data[:len(data)-1], "out of bounds"},
+		{bpp4, "no monochrome images"},
+	} {
+		m, err := DecodeAll(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+		if m != nil {
+			t.Errorf("have file + error")
+		}
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	big := testIcon(257, 1)
+	mask := testIcon(4, 4)
+	mask.Mask = testIcon(5, 4).Mask
+	for _, tt := range []struct {
+		f   *File
+		err string
+	}{
+		{&File{}, "bad number of images"},
+		{&File{Icons: []Icon{big}}, "invalid image size"},
+		{&File{Icons: []Icon{mask}}, "mask size"},
+	} {
+		err := Encode(new(bytes.Buffer), tt.f)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	f := &File{Icons: []Icon{testIcon(16, 16), testIcon(32, 32)}}
+	var b bytes.Buffer
+	if err := Encode(&b, f); err != nil {
+		t.Fatal(err)
+	}
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 32 * 32}}
+	if _, err := d.DecodeAll(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	d.Limits.MaxPixels--
+	_, err := d.DecodeAll(bytes.NewReader(b.Bytes()))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
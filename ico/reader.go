@@ -0,0 +1,287 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ico implements a decoder and encoder for monochrome Windows icons
+// (ICO) and cursors (CUR).
+//
+// Each image of such a file is a pair of 1-bit masks. The XOR mask holds
+// the colors of the image and the AND mask its transparency: where the AND
+// mask is set, the screen shows through, inverted by set bits of the XOR
+// mask. Images with other bit depths and PNG compressed images, found in
+// most modern icon files, are skipped.
+//
+// The format is described at
+// https://docs.microsoft.com/en-us/previous-versions/ms997538(v=msdn.10).
+package ico
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// A FormatError reports that the input is not a valid icon or cursor file.
+type FormatError string
+
+func (e FormatError) Error() string { return "ico: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "ico: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of icon and cursor files.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError before their
+	// masks are read. Each image takes two allocations, one per mask.
+	Limits *img1b.Limits
+}
+
+// File types, as stored in the file header.
+const (
+	typeIcon   = 1
+	typeCursor = 2
+)
+
+const (
+	dirLen        = 6
+	entryLen      = 16
+	infoHeaderLen = 40
+)
+
+// pngSignature starts PNG compressed images.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// An Icon is a single image of an icon or cursor file.
+type Icon struct {
+	// Image is the XOR mask with the colors of the icon's color table,
+	// usually black and white.
+	Image *img1b.Image
+
+	// Mask is the AND mask, of the same size as Image. Set bits are
+	// transparent. A nil Mask is encoded as fully opaque.
+	Mask *img1b.Image
+
+	// Hotspot is the hotspot of a cursor, relative to the top-left corner.
+	Hotspot image.Point
+}
+
+// A File is the content of an icon or cursor file.
+type File struct {
+	// Cursor is set for cursor (CUR) files.
+	Cursor bool
+
+	Icons []Icon
+}
+
+// maskPalette returns the palette of AND masks: set bits are transparent.
+func maskPalette() color.Palette {
+	return color.Palette{color.Opaque, color.Transparent}
+}
+
+// An entry is a directory entry of an icon file.
+type entry struct {
+	w, h    int
+	hotspot image.Point
+	data    []byte
+}
+
+// readDir reads the file header and the directory.
+func readDir(data []byte) (cursor bool, entries []entry, err error) {
+	if len(data) < dirLen {
+		return false, nil, io.ErrUnexpectedEOF
+	}
+	typ := binary.LittleEndian.Uint16(data[2:])
+	if binary.LittleEndian.Uint16(data) != 0 || typ != typeIcon && typ != typeCursor {
+		return false, nil, FormatError("not an icon file")
+	}
+	cursor = typ == typeCursor
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if len(data) < dirLen+n*entryLen {
+		return false, nil, io.ErrUnexpectedEOF
+	}
+	for i := 0; i < n; i++ {
+		e := data[dirLen+i*entryLen:]
+		var en entry
+		en.w, en.h = int(e[0]), int(e[1])
+		if en.w == 0 {
+			en.w = 256
+		}
+		if en.h == 0 {
+			en.h = 256
+		}
+		if cursor {
+			en.hotspot.X = int(binary.LittleEndian.Uint16(e[4:]))
+			en.hotspot.Y = int(binary.LittleEndian.Uint16(e[6:]))
+		}
+		size := int64(binary.LittleEndian.Uint32(e[8:]))
+		off := int64(binary.LittleEndian.Uint32(e[12:]))
+		if off+size > int64(len(data)) {
+			return false, nil, FormatError("image data out of bounds")
+		}
+		en.data = data[off : off+size]
+		entries = append(entries, en)
+	}
+	return cursor, entries, nil
+}
+
+// isMonochrome reports whether the entry holds a 1-bit bitmap.
+func (e *entry) isMonochrome() bool {
+	d := e.data
+	return len(d) >= infoHeaderLen && !bytes.HasPrefix(d, []byte(pngSignature)) &&
+		binary.LittleEndian.Uint32(d) >= infoHeaderLen &&
+		binary.LittleEndian.Uint16(d[14:]) == 1
+}
+
+// readMask reads a bottom-up 1-bit bitmap with rows padded to 4 bytes.
+func readMask(data []byte, w, h int, p color.Palette, l *img1b.Limits) (*img1b.Image, []byte, error) {
+	rowBytes := (w + 7) / 8
+	padded := (rowBytes + 3) &^ 3
+	if len(data) < padded*h {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	m, err := l.New(image.Rect(0, 0, w, h), p)
+	if err != nil {
+		return nil, nil, err
+	}
+	tm := bitmap.TailMask(w)
+	for i := 0; i < h; i++ {
+		row := m.Pix[(h-1-i)*m.Stride:][:rowBytes]
+		copy(row, data[i*padded:])
+		row[rowBytes-1] &= tm
+	}
+	return m, data[padded*h:], nil
+}
+
+// decode decodes the images of a monochrome entry.
+func (e *entry) decode(l *img1b.Limits) (Icon, error) {
+	d := e.data
+	hlen := int(binary.LittleEndian.Uint32(d))
+	w := int(int32(binary.LittleEndian.Uint32(d[4:])))
+	// The height covers both masks.
+	h := int(int32(binary.LittleEndian.Uint32(d[8:]))) / 2
+	if binary.LittleEndian.Uint32(d[16:]) != 0 {
+		return Icon{}, UnsupportedError("compressed bitmap")
+	}
+	if w <= 0 || h <= 0 || w > 1<<16 || h > 1<<16 {
+		return Icon{}, FormatError("bad image size")
+	}
+	ncolors := int(binary.LittleEndian.Uint32(d[32:]))
+	if ncolors == 0 || ncolors > 2 {
+		ncolors = 2
+	}
+	if hlen > len(d) || len(d)-hlen < ncolors*4 {
+		return Icon{}, io.ErrUnexpectedEOF
+	}
+	d = d[hlen:]
+	p := make(color.Palette, ncolors)
+	for i := range p {
+		p[i] = color.RGBA{d[4*i+2], d[4*i+1], d[4*i], 0xff}
+	}
+	if ncolors == 1 {
+		// Pixels may still reference index 1; give it the color of a zeroed
+		// entry.
+		p = append(p, color.RGBA{0, 0, 0, 0xff})
+	}
+	d = d[ncolors*4:]
+	xor, d, err := readMask(d, w, h, p, l)
+	if err != nil {
+		return Icon{}, err
+	}
+	and, _, err := readMask(d, w, h, maskPalette(), l)
+	if err != nil {
+		return Icon{}, err
+	}
+	return Icon{Image: xor, Mask: and, Hotspot: e.hotspot}, nil
+}
+
+// DecodeAll reads the monochrome images of an icon or cursor file from r.
+// It is an error if there are none.
+func DecodeAll(r io.Reader) (*File, error) {
+	var d Decoder
+	return d.DecodeAll(r)
+}
+
+// DecodeAll reads the monochrome images of an icon or cursor file from r.
+// It is an error if there are none.
+func (dec *Decoder) DecodeAll(r io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cursor, entries, err := readDir(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Cursor: cursor}
+	for i := range entries {
+		if !entries[i].isMonochrome() {
+			continue
+		}
+		icon, err := entries[i].decode(dec.Limits)
+		if err != nil {
+			return nil, err
+		}
+		f.Icons = append(f.Icons, icon)
+	}
+	if len(f.Icons) == 0 {
+		return nil, UnsupportedError("no monochrome images")
+	}
+	return f, nil
+}
+
+// Decode reads the XOR mask of the first monochrome image of an icon or
+// cursor file from r.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads the XOR mask of the first monochrome image of an icon or
+// cursor file from r.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	f, err := dec.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.Icons[0].Image, nil
+}
+
+// DecodeConfig returns the color model and dimensions of the first
+// monochrome image of an icon or cursor file without decoding the masks.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	_, entries, err := readDir(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	for i := range entries {
+		if entries[i].isMonochrome() {
+			d := entries[i].data
+			p := color.Palette{color.Black, color.White}
+			if hlen := int(binary.LittleEndian.Uint32(d)); len(d) >= hlen+8 {
+				for j := range p {
+					c := d[hlen+4*j:]
+					p[j] = color.RGBA{c[2], c[1], c[0], 0xff}
+				}
+			}
+			return image.Config{
+				ColorModel: p,
+				Width:      int(int32(binary.LittleEndian.Uint32(d[4:]))),
+				Height:     int(int32(binary.LittleEndian.Uint32(d[8:]))) / 2,
+			}, nil
+		}
+	}
+	return image.Config{}, UnsupportedError("no monochrome images")
+}
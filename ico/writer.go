@@ -0,0 +1,117 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ico
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image/color"
+	"io"
+)
+
+// appendMask appends the rows of m bottom-up, padded to 4 bytes. A nil m
+// is written as all clear.
+func appendMask(b []byte, m *img1b.Image, w, h int) []byte {
+	rowBytes := (w + 7) / 8
+	padded := (rowBytes + 3) &^ 3
+	tm := bitmap.TailMask(w)
+	for y := h - 1; y >= 0; y-- {
+		row := make([]byte, padded)
+		if m != nil {
+			copy(row, m.Pix[y*m.Stride:y*m.Stride+rowBytes])
+			row[rowBytes-1] &= tm
+		}
+		b = append(b, row...)
+	}
+	return b
+}
+
+// imageData returns the bitmap data of an icon.
+func imageData(icon *Icon) ([]byte, error) {
+	m := icon.Image
+	if m == nil {
+		return nil, FormatError("missing image")
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w <= 0 || h <= 0 || w > 256 || h > 256 {
+		return nil, FormatError(fmt.Sprintf("invalid image size: %dx%d", w, h))
+	}
+	if len(m.Palette) < 1 || len(m.Palette) > 2 {
+		return nil, FormatError(fmt.Sprintf("bad palette length: %d", len(m.Palette)))
+	}
+	if icon.Mask != nil && icon.Mask.Rect.Size() != m.Rect.Size() {
+		return nil, FormatError("mask size differs from image size")
+	}
+	padded := ((w+7)/8 + 3) &^ 3
+	b := make([]byte, infoHeaderLen+2*4, infoHeaderLen+2*4+2*padded*h)
+	binary.LittleEndian.PutUint32(b[0:], infoHeaderLen)
+	binary.LittleEndian.PutUint32(b[4:], uint32(w))
+	binary.LittleEndian.PutUint32(b[8:], uint32(2*h))
+	binary.LittleEndian.PutUint16(b[12:], 1) // planes
+	binary.LittleEndian.PutUint16(b[14:], 1) // bits per pixel
+	binary.LittleEndian.PutUint32(b[20:], uint32(2*padded*h))
+	binary.LittleEndian.PutUint32(b[32:], 2)
+	ct := b[infoHeaderLen:]
+	for i := 0; i < 2; i++ {
+		c := color.Color(color.Black)
+		if i < len(m.Palette) {
+			c = m.Palette[i]
+		}
+		c1 := color.RGBAModel.Convert(c).(color.RGBA)
+		ct[4*i+0], ct[4*i+1], ct[4*i+2] = c1.B, c1.G, c1.R
+	}
+	b = appendMask(b, m, w, h)
+	return appendMask(b, icon.Mask, w, h), nil
+}
+
+// Encode writes the icons of f to w as an icon or cursor file.
+func Encode(w io.Writer, f *File) error {
+	n := len(f.Icons)
+	if n == 0 || n > 0xffff {
+		return FormatError(fmt.Sprintf("bad number of images: %d", n))
+	}
+	h := make([]byte, dirLen+n*entryLen)
+	typ := typeIcon
+	if f.Cursor {
+		typ = typeCursor
+	}
+	binary.LittleEndian.PutUint16(h[2:], uint16(typ))
+	binary.LittleEndian.PutUint16(h[4:], uint16(n))
+	data := make([][]byte, n)
+	off := len(h)
+	for i := range f.Icons {
+		icon := &f.Icons[i]
+		d, err := imageData(icon)
+		if err != nil {
+			return err
+		}
+		data[i] = d
+		e := h[dirLen+i*entryLen:]
+		// Sizes of 256 are stored as 0.
+		e[0], e[1] = byte(icon.Image.Rect.Dx()), byte(icon.Image.Rect.Dy())
+		e[2] = 2 // colors
+		if f.Cursor {
+			binary.LittleEndian.PutUint16(e[4:], uint16(icon.Hotspot.X))
+			binary.LittleEndian.PutUint16(e[6:], uint16(icon.Hotspot.Y))
+		} else {
+			binary.LittleEndian.PutUint16(e[4:], 1) // planes
+			binary.LittleEndian.PutUint16(e[6:], 1) // bits per pixel
+		}
+		binary.LittleEndian.PutUint32(e[8:], uint32(len(d)))
+		binary.LittleEndian.PutUint32(e[12:], uint32(off))
+		off += len(d)
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(h)
+	for _, d := range data {
+		if _, err := bw.Write(d); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -11,7 +11,7 @@
 package img1b
 
 import (
-	"bytes"
+	"github.com/mi-v/img1b/internal/bitmap"
 	"image"
 	"image/color"
 	"math/bits"
@@ -19,10 +19,22 @@ import (
 
 // Image implements the image.PalettedImage interface and is mostly analogous to
 // image.Paletted except that Pix is a bitmap, so only color indices 0 and 1 can be used.
+//
+// Images made by New and SubImage keep the two colors of the palette at hand
+// for At and RGBA64At. They are checked against Palette on each use, so
+// assigning another palette or changing its colors in place is noticed.
+//
+// An Image also keeps unexported state: whether it is copy-on-write, owns
+// its pixels for a Pool, or is a sub-image clipped on the right. Images are
+// used by pointer and made by New, NewFromPix or composite literals naming
+// their fields; copying an Image value copies that state too, so that both
+// copies could go to a Pool. SubImage makes another Image over the same
+// pixels safely.
 type Image struct {
 	// Pix is a bitmap of image pixels. Bytes represent up to 8 horizontally adjacent
-	// pixels (there may be unused bits in the last byte of a row) with the most
-	// significant bit corresponding to leftmost pixel.
+	// pixels (there may be unused bits in the last byte of a row, see
+	// Canonicalize) with the most significant bit corresponding to leftmost
+	// pixel.
 	Pix []byte
 	// Stride is the Pix stride (in bytes) between vertically adjacent pixels.
 	Stride int
@@ -30,10 +42,86 @@ type Image struct {
 	Rect image.Rectangle
 	// Palette is the image's palette.
 	Palette color.Palette
+
+	pc *paletteCache
+	// cow tells that Pix is shared with another image and is to be copied
+	// before a write.
+	cow bool
+	// own tells that the image was made by New and so owns Pix.
+	own bool
+	// clipped tells that the image is a sub-image ending short of the right
+	// edge of its parent, whose pixels then fill the padding of its rows.
+	clipped bool
+}
+
+// A paletteCache holds the colors of a palette of two or more colors.
+type paletteCache struct {
+	n      int // length of the palette
+	colors [2]color.Color
+	rgba64 [2]color.RGBA64
+	model  *BitModel
+}
+
+// newPaletteCache returns the cache of the colors of p, nil if it has less
+// than two colors or they are not all set.
+func newPaletteCache(p color.Palette) *paletteCache {
+	if len(p) < 2 || p[0] == nil || p[1] == nil {
+		return nil
+	}
+	c := &paletteCache{n: len(p), model: NewBitModel(p)}
+	for i := range c.colors {
+		c.colors[i] = p[i]
+		r, g, b, a := p[i].RGBA()
+		c.rgba64[i] = color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+	}
+	return c
+}
+
+// of tells if c is the cache of the palette p. The colors are compared, so
+// that a palette changed in place is noticed.
+func (c *paletteCache) of(p color.Palette) bool {
+	return c != nil && len(p) == c.n && p[0] == c.colors[0] && p[1] == c.colors[1]
+}
+
+// colorModel returns the BitModel of pal, from c if it is the cache of pal,
+// or pal itself if it has no BitModel. The cache is not stored, so that
+// ColorModel stays safe for concurrent use.
+func colorModel(c *paletteCache, pal color.Palette) color.Model {
+	if !c.of(pal) {
+		c = newPaletteCache(pal)
+	}
+	if c == nil {
+		return pal
+	}
+	return c.model
+}
+
+// cached returns the palette cache if it is of the current palette.
+func (p *Image) cached() *paletteCache {
+	if p.pc.of(p.Palette) {
+		return p.pc
+	}
+	return nil
+}
+
+// SetPalette sets the palette of the image and caches its colors at once.
+func (p *Image) SetPalette(pal color.Palette) {
+	p.Palette = pal
+	p.pc = newPaletteCache(pal)
 }
 
 // At returns the color of the pixel at (x, y).
 func (p *Image) At(x, y int) color.Color {
+	if c := p.cached(); c != nil {
+		if !(image.Point{x, y}.In(p.Rect)) {
+			return c.colors[0]
+		}
+		i, m := p.PixOffsetFast(x, y)
+		if p.Pix[i]&m != 0 {
+			return c.colors[1]
+		}
+		return c.colors[0]
+	}
 	if len(p.Palette) == 0 {
 		return nil
 	}
@@ -44,6 +132,26 @@ func (p *Image) At(x, y int) color.Color {
 	return p.Palette[(p.Pix[i]>>b)&1]
 }
 
+// RGBA64At returns the color of the pixel at (x, y) as a color.RGBA64.
+func (p *Image) RGBA64At(x, y int) color.RGBA64 {
+	if c := p.cached(); c != nil {
+		if !(image.Point{x, y}.In(p.Rect)) {
+			return c.rgba64[0]
+		}
+		i, m := p.PixOffsetFast(x, y)
+		if p.Pix[i]&m != 0 {
+			return c.rgba64[1]
+		}
+		return c.rgba64[0]
+	}
+	cl := p.At(x, y)
+	if cl == nil {
+		return color.RGBA64{}
+	}
+	r, g, b, a := cl.RGBA()
+	return color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+}
+
 // PixBitOffset returns the index of the byte of Pix that corresponds to
 // the pixel at (x, y) and bit offset (7 for MSB) in that byte.
 func (p *Image) PixBitOffset(x, y int) (ofs, bit int) {
@@ -56,8 +164,10 @@ func (p *Image) PixBitOffset(x, y int) (ofs, bit int) {
 // The bounds do not necessarily contain the point (0, 0).
 func (p *Image) Bounds() image.Rectangle { return p.Rect }
 
-// ColorModel returns the Image's color model.
-func (p *Image) ColorModel() color.Model { return p.Palette }
+// ColorModel returns the Image's color model: the BitModel of its palette,
+// which Set converts colors with, or the palette itself if it has less than
+// two colors.
+func (p *Image) ColorModel() color.Model { return colorModel(p.pc, p.Palette) }
 
 // ColorIndexAt returns the palette index of the pixel at (x, y).
 func (p *Image) ColorIndexAt(x, y int) uint8 {
@@ -73,6 +183,9 @@ func (p *Image) SetColorIndex(x, y int, index uint8) {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return
 	}
+	if p.cow {
+		p.Unshare()
+	}
 	i, b := p.PixBitOffset(x, y)
 	if index == 0 {
 		p.Pix[i] &^= 1 << b
@@ -81,6 +194,82 @@ func (p *Image) SetColorIndex(x, y int, index uint8) {
 	}
 }
 
+// Set sets the pixel at (x, y) to the color of the palette nearer to c in
+// luminance, as BitModel does, which makes the image a draw.Image. With
+// less than two colors in the palette the pixel gets index 0.
+func (p *Image) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	var i uint8
+	if m := p.model(); m != nil {
+		i = m.Index(c)
+	}
+	p.SetColorIndexUnchecked(x, y, i)
+}
+
+// SetRGBA64 is like Set but takes a color.RGBA64, avoiding the conversion
+// to an interface value.
+func (p *Image) SetRGBA64(x, y int, c color.RGBA64) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	var i uint8
+	if m := p.model(); m != nil {
+		i = m.index(uint32(c.R), uint32(c.G), uint32(c.B))
+	}
+	p.SetColorIndexUnchecked(x, y, i)
+}
+
+// model returns the BitModel of the palette, nil if it has less than two
+// colors.
+func (p *Image) model() *BitModel {
+	c := p.cached()
+	if c == nil {
+		c = newPaletteCache(p.Palette)
+		p.pc = c
+	}
+	if c == nil {
+		return nil
+	}
+	return c.model
+}
+
+// PixOffsetFast returns the index of the byte of Pix holding the pixel at
+// (x, y) and the mask of its bit in that byte. Unlike PixBitOffset it takes
+// the pixel to be in p.Rect, so it does no division and inlines well in
+// tight loops.
+func (p *Image) PixOffsetFast(x, y int) (ofs int, mask byte) {
+	dx := uint(x - p.Rect.Min.X)
+	return (y-p.Rect.Min.Y)*p.Stride + int(dx>>3), 0x80 >> (dx & 7)
+}
+
+// ColorIndexAtUnchecked is like ColorIndexAt but does not check that (x, y)
+// is in p.Rect. The caller must make sure it is: for a pixel outside, the
+// result is undefined and it may panic.
+func (p *Image) ColorIndexAtUnchecked(x, y int) uint8 {
+	i, m := p.PixOffsetFast(x, y)
+	if p.Pix[i]&m != 0 {
+		return 1
+	}
+	return 0
+}
+
+// SetColorIndexUnchecked is like SetColorIndex but does not check that
+// (x, y) is in p.Rect. The caller must make sure it is: setting a pixel
+// outside may change another pixel or panic.
+func (p *Image) SetColorIndexUnchecked(x, y int, index uint8) {
+	if p.cow {
+		p.Unshare()
+	}
+	i, m := p.PixOffsetFast(x, y)
+	if index == 0 {
+		p.Pix[i] &^= m
+	} else {
+		p.Pix[i] |= m
+	}
+}
+
 // mul2NonNeg returns (x * y), unless at least one argument is negative or
 // if the computation overflows the int type, in which case it returns -1.
 func mul2NonNeg(x int, y int) int {
@@ -107,7 +296,7 @@ func New(r image.Rectangle, p color.Palette) *Image {
 		panic("img1b.New: Rectangle has huge or negative dimensions")
 	}
 	pix := make([]byte, bytes)
-	return &Image{pix, stride, r, p}
+	return &Image{Pix: pix, Stride: stride, Rect: r, Palette: p, pc: newPaletteCache(p), own: true}
 }
 
 // SubImage returns an image representing the portion of the image p visible
@@ -118,9 +307,15 @@ func (p *Image) SubImage(r image.Rectangle) *Image {
 	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
 	// either r1 or r2 if the intersection is empty. Without explicitly checking for
 	// this, the Pix[i:] expression below can panic.
+	pc := p.cached()
+	if pc == nil {
+		pc = newPaletteCache(p.Palette)
+	}
 	if r.Empty() {
 		return &Image{
 			Palette: p.Palette,
+			pc:      pc,
+			cow:     p.cow,
 		}
 	}
 	i, b := p.PixBitOffset(r.Min.X, r.Min.Y)
@@ -132,9 +327,38 @@ func (p *Image) SubImage(r image.Rectangle) *Image {
 		Stride:  p.Stride,
 		Rect:    r,
 		Palette: p.Palette,
+		pc:      pc,
+		cow:     p.cow,
+		clipped: p.clipped || r.Max.X < p.Rect.Max.X,
 	}
 }
 
+// CowSubImage is like SubImage, but the returned image is copy-on-write: it
+// shares the pixels of p until it is first written to by SetColorIndex,
+// SetColorIndexUnchecked or Blit, which give it its own copy. Writes to p
+// show through until then. Code writing Pix directly has to call Unshare
+// first. SubImages of a copy-on-write image are copy-on-write too.
+func (p *Image) CowSubImage(r image.Rectangle) *Image {
+	s := p.SubImage(r)
+	s.cow = true
+	return s
+}
+
+// Unshare gives a copy-on-write image made by CowSubImage its own copy of
+// the pixels, if it does not have one yet. It does nothing to other images.
+func (p *Image) Unshare() {
+	if !p.cow {
+		return
+	}
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	stride := (w + 7) / 8
+	pix := make([]byte, stride*h)
+	for y := 0; y < h; y++ {
+		copy(pix[y*stride:(y+1)*stride], p.Pix[y*p.Stride:])
+	}
+	p.Pix, p.Stride, p.cow, p.own, p.clipped = pix, stride, false, true, false
+}
+
 // Opaque scans the entire image and reports whether it is fully opaque.
 func (p *Image) Opaque() bool {
 	ts := 0 // transparent indices+1 sum
@@ -161,18 +385,24 @@ func (p *Image) Opaque() bool {
 		return false // both colors are transparent
 	}
 
-	i0, i1 := 0, p.Rect.Dx()/8 // whole byte indices
-	bc := i1 - i0
-	tm := byte(0xff) << (8 - p.Rect.Dx()%8) // tail mask
-	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
-		if bytes.Count(p.Pix[i0:i1], []byte{ob}) != bc {
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	n := w / 8 // whole bytes of a row
+	var tm byte
+	if w%8 != 0 {
+		tm = bitmap.TailMask(w)
+	}
+	// Rows with no padding or gaps between them are checked as one.
+	if tm == 0 && p.Stride == n {
+		return bitmap.All(p.Pix[:n*h], ob)
+	}
+	for y, i := 0, 0; y < h; y, i = y+1, i+p.Stride {
+		if !bitmap.All(p.Pix[i:i+n], ob) {
 			return false
 		}
-		if tm != 0 && p.Pix[i1]&tm != ob&tm {
+		// Bits past the right edge belong to other pixels or to none.
+		if tm != 0 && (p.Pix[i+n]^ob)&tm != 0 {
 			return false
 		}
-		i0 += p.Stride
-		i1 += p.Stride
 	}
 	return true
 }
@@ -120,6 +120,77 @@ func TestImage(t *testing.T) {
 	m.SubImage(image.Rect(14, 10, 14, 14))
 }
 
+// slowOpaque reports whether every pixel of m is opaque, pixel by pixel.
+func slowOpaque(m *Image) bool {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := m.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestOpaque(t *testing.T) {
+	palettes := []color.Palette{
+		{color.Black, color.White},
+		{color.Transparent, color.Opaque},
+		{color.Opaque, color.Transparent},
+		{color.Transparent, color.Transparent},
+	}
+	for _, p := range palettes {
+		for _, w := range []int{1, 7, 8, 9, 64, 100, 257, 300} {
+			full := New(image.Rect(0, 0, w+24, 5), p)
+			rects := []image.Rectangle{
+				image.Rect(0, 0, w, 5),
+				image.Rect(8, 1, 8+w, 4),
+				image.Rect(16, 0, 16+w, 2),
+			}
+			for _, r := range rects {
+				for _, fill := range []uint8{0, 1} {
+					for i := range full.Pix {
+						full.Pix[i] = 0xff * fill
+					}
+					// The pixels around r, sharing its bytes, differ.
+					for y := 0; y < 5; y++ {
+						for x := 0; x < w+24; x++ {
+							if !(image.Point{x, y}.In(r)) {
+								full.SetColorIndex(x, y, 1-fill)
+							}
+						}
+					}
+					m := full.SubImage(r)
+					if got, want := m.Opaque(), slowOpaque(m); got != want {
+						t.Errorf("palette %v, %v of %v filled with %d: got %v, want %v", p, r, full.Rect, fill, got, want)
+					}
+					// One pixel off at the bottom right corner.
+					m.SetColorIndex(r.Max.X-1, r.Max.Y-1, 1-fill)
+					if got, want := m.Opaque(), slowOpaque(m); got != want {
+						t.Errorf("palette %v, %v of %v filled with %d, corner off: got %v, want %v", p, r, full.Rect, fill, got, want)
+					}
+				}
+			}
+		}
+	}
+	if !(&Image{Palette: palettes[1]}).Opaque() {
+		t.Error("empty image is not opaque")
+	}
+}
+
+func BenchmarkOpaque(b *testing.B) {
+	m := New(image.Rect(0, 0, 2500, 3500), color.Palette{color.Transparent, color.Opaque})
+	for i := range m.Pix {
+		m.Pix[i] = 0xff
+	}
+	b.SetBytes(int64(len(m.Pix)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Opaque()
+	}
+}
+
 func TestNewBadRectangle(t *testing.T) {
 	// call calls f(r) and reports whether it ran without panicking.
 	call := func(f func(image.Rectangle), r image.Rectangle) (ok bool) {
@@ -223,6 +294,134 @@ func TestSubimageBadRectangle(t *testing.T) {
 	}
 }
 
+func TestUnchecked(t *testing.T) {
+	full := New(image.Rect(-3, -5, 30, 17), color.Palette{color.Black, color.White})
+	m := full.SubImage(image.Rect(5, -2, 27, 15))
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			if (x*7+y*3)%5 < 2 {
+				m.SetColorIndexUnchecked(x, y, 1)
+			}
+		}
+	}
+	for y := full.Rect.Min.Y; y < full.Rect.Max.Y; y++ {
+		for x := full.Rect.Min.X; x < full.Rect.Max.X; x++ {
+			want := uint8(0)
+			if (image.Point{x, y}.In(m.Rect)) && (x*7+y*3)%5 < 2 {
+				want = 1
+			}
+			if got := full.ColorIndexAtUnchecked(x, y); got != want {
+				t.Fatalf("(%d, %d): got %d, want %d", x, y, got, want)
+			}
+			if got := full.ColorIndexAt(x, y); got != want {
+				t.Fatalf("(%d, %d): ColorIndexAt got %d, want %d", x, y, got, want)
+			}
+			i, b := full.PixBitOffset(x, y)
+			if j, mask := full.PixOffsetFast(x, y); j != i || mask != 1<<uint(b) {
+				t.Fatalf("(%d, %d): PixOffsetFast %d %#x, PixBitOffset %d %d", x, y, j, mask, i, b)
+			}
+		}
+	}
+	m.SetColorIndexUnchecked(5, -2, 0)
+	if m.ColorIndexAt(5, -2) != 0 {
+		t.Error("pixel not cleared")
+	}
+}
+
+func TestPaletteCache(t *testing.T) {
+	check := func(m *Image, want color.Palette) {
+		t.Helper()
+		for _, pt := range []image.Point{{1, 1}, {2, 1}, {-1, 0}} {
+			w := want[0]
+			if pt.In(m.Rect) {
+				w = want[m.ColorIndexAt(pt.X, pt.Y)]
+			}
+			if got := m.At(pt.X, pt.Y); got != w {
+				t.Errorf("At%v: got %v, want %v", pt, got, w)
+			}
+			r, g, b, a := w.RGBA()
+			if got, w := m.RGBA64At(pt.X, pt.Y), (color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}); got != w {
+				t.Errorf("RGBA64At%v: got %v, want %v", pt, got, w)
+			}
+		}
+	}
+	p := color.Palette{color.Black, color.White}
+	m := New(image.Rect(0, 0, 4, 4), p)
+	m.SetColorIndex(2, 1, 1)
+	check(m, p)
+	check(m.SubImage(image.Rect(0, 1, 3, 3)), p)
+
+	// Another palette.
+	q := color.Palette{color.Transparent, color.Opaque}
+	m.Palette = q
+	check(m, q)
+
+	// The same palette with a color changed.
+	q[1] = color.Gray{0x80}
+	m.SetPalette(q)
+	check(m, q)
+
+	// A color changed in place, without SetPalette.
+	q[1] = color.Gray{0x40}
+	check(m, q)
+	m.Set(2, 1, color.Gray{0x30})
+	if m.ColorIndexAt(2, 1) != 1 {
+		t.Error("Set used the old palette")
+	}
+
+	// No cache.
+	l := &Image{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect, Palette: q}
+	check(l, q)
+
+	if n := testing.AllocsPerRun(10, func() { m.At(2, 1) }); n != 0 {
+		t.Errorf("At: %v allocations", n)
+	}
+}
+
+func TestCowSubImage(t *testing.T) {
+	p := color.Palette{color.Black, color.White}
+	m := New(image.Rect(0, 0, 30, 10), p)
+	m.SetColorIndex(9, 3, 1)
+	c := m.CowSubImage(image.Rect(8, 2, 21, 8))
+	if c.ColorIndexAt(9, 3) != 1 {
+		t.Fatal("view does not show the pixels")
+	}
+	// Writes to the original show through until the view is written to.
+	m.SetColorIndex(10, 3, 1)
+	if c.ColorIndexAt(10, 3) != 1 {
+		t.Error("view does not share the pixels")
+	}
+
+	sub := c.SubImage(image.Rect(16, 2, 21, 8))
+	c.SetColorIndex(11, 3, 1)
+	c.SetColorIndexUnchecked(9, 3, 0)
+	if m.ColorIndexAt(11, 3) != 0 || m.ColorIndexAt(9, 3) != 1 {
+		t.Error("write through the view changed the original")
+	}
+	for y := 2; y < 8; y++ {
+		for x := 8; x < 21; x++ {
+			want := uint8(0)
+			if y == 3 && (x == 10 || x == 11) {
+				want = 1
+			}
+			if got := c.ColorIndexAt(x, y); got != want {
+				t.Errorf("view at (%d, %d): got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	// The sub-image of the view is copy-on-write too.
+	sub.SetColorIndex(17, 4, 1)
+	if m.ColorIndexAt(17, 4) != 0 || c.ColorIndexAt(17, 4) != 0 {
+		t.Error("write through a sub-image of the view changed another image")
+	}
+	b := m.CowSubImage(image.Rect(0, 0, 8, 8))
+	Blit(b, b.Rect, m, image.Pt(3, 3))
+	if m.ColorIndexAt(7, 0) != 0 || b.ColorIndexAt(7, 0) != 1 {
+		t.Error("Blit into a view changed the original")
+	}
+}
+
 func BenchmarkAt(b *testing.B) {
 	m := New(image.Rect(0, 0, 10, 10), color.Palette{
 		color.Transparent,
@@ -246,3 +445,27 @@ func BenchmarkSet(b *testing.B) {
 		m.SetColorIndex(4, 5, 1)
 	}
 }
+
+func BenchmarkSetUnchecked(b *testing.B) {
+	m := New(image.Rect(0, 0, 10, 10), color.Palette{
+		color.Transparent,
+		color.Opaque,
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.SetColorIndexUnchecked(4, 5, 1)
+	}
+}
+
+func BenchmarkRGBA64At(b *testing.B) {
+	m := New(image.Rect(0, 0, 10, 10), color.Palette{
+		color.Transparent,
+		color.Opaque,
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.RGBA64At(4, 5)
+	}
+}
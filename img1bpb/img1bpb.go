@@ -0,0 +1,89 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package img1bpb converts images to and from the Image message of
+// image.proto, for passing bilevel pages between services over gRPC in their
+// packed form, without an image format.
+//
+// The Image type is generated from image.proto with protoc-gen-go, so it is a
+// proto.Message that can be a field of other messages and go through gRPC.
+package img1bpb
+
+//go:generate protoc -I.. --go_out=.. --go_opt=paths=source_relative img1bpb/image.proto
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+)
+
+// A FormatError reports a message that is not a valid image.
+type FormatError string
+
+func (e FormatError) Error() string { return "img1bpb: invalid message: " + string(e) }
+
+// A RangeError reports an image whose bounds don't fit the int32 fields of
+// the message.
+type RangeError string
+
+func (e RangeError) Error() string { return "img1bpb: out of range: " + string(e) }
+
+// ToProto returns the message of the Image m, with a copy of its pixels
+// packed to (width+7)/8 bytes a row and the padding bits clear. It returns
+// nil for a nil m, and a RangeError if the bounds of m don't fit the
+// message.
+func ToProto(m *img1b.Image) (*Image, error) {
+	if m == nil {
+		return nil, nil
+	}
+	r := m.Rect
+	for _, v := range [4]int{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y} {
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, RangeError("bounds " + r.String())
+		}
+	}
+	p := &Image{MinX: int32(r.Min.X), MinY: int32(r.Min.Y), MaxX: int32(r.Max.X), MaxY: int32(r.Max.Y)}
+	for _, c := range m.Palette {
+		var v uint32
+		if c != nil {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			v = uint32(n.R)<<24 | uint32(n.G)<<16 | uint32(n.B)<<8 | uint32(n.A)
+		}
+		p.Palette = append(p.Palette, v)
+	}
+	w, h := r.Dx(), r.Dy()
+	if w <= 0 || h <= 0 {
+		return p, nil
+	}
+	n := (w + 7) / 8
+	p.Stride = uint32(n)
+	p.Pix = make([]byte, n*h)
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h; y++ {
+		row := p.Pix[y*n : (y+1)*n]
+		copy(row, m.Pix[y*m.Stride:])
+		row[n-1] &= tm
+	}
+	return p, nil
+}
+
+// FromProto returns the Image of the message p, checked as
+// img1b.Image.Validate does. The image shares the pixels of p.
+func FromProto(p *Image) (*img1b.Image, error) {
+	if p == nil {
+		return nil, FormatError("nil message")
+	}
+	if uint64(p.Stride) > math.MaxInt32 {
+		return nil, FormatError("stride " + strconv.FormatUint(uint64(p.Stride), 10) + " is too large")
+	}
+	pal := make(color.Palette, len(p.Palette))
+	for i, v := range p.Palette {
+		pal[i] = color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}
+	}
+	r := image.Rect(int(p.MinX), int(p.MinY), int(p.MaxX), int(p.MaxY))
+	return img1b.NewFromPix(p.Pix, int(p.Stride), r, pal)
+}
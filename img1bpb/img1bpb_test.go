@@ -0,0 +1,119 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1bpb
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"google.golang.org/protobuf/proto"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	m := img1b.New(image.Rect(-1, 0, 2, 2), color.Palette{color.White, color.Black})
+	m.SetColorIndex(-1, 0, 1)
+	m.SetColorIndex(1, 1, 1)
+	m.Pix[0] |= 0x0f
+	p, err := ToProto(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Image{MinX: -1, MaxX: 2, MaxY: 2, Stride: 1,
+		Palette: []uint32{0xffffffff, 0x000000ff}, Pix: []byte{0x80, 0x20}}
+	if !proto.Equal(p, want) {
+		t.Fatalf("ToProto: %v, want %v", p, want)
+	}
+	b, err := proto.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wire := []byte{
+		0x08, 0x01, // min_x -1
+		0x18, 0x04, // max_x 2
+		0x20, 0x04, // max_y 2
+		0x28, 0x01, // stride
+		0x32, 0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, // palette
+		0x3a, 0x02, 0x80, 0x20, // pix
+	}
+	if !bytes.Equal(b, wire) {
+		t.Errorf("Marshal: % x\nwant % x", b, wire)
+	}
+
+	// An unpacked palette and fields out of order.
+	odd := []byte{
+		0x3a, 0x02, 0x80, 0x20,
+		0x35, 0xff, 0xff, 0xff, 0xff, // palette
+		0x35, 0xff, 0x00, 0x00, 0x00,
+		0x08, 0x01, 0x18, 0x04, 0x20, 0x04, 0x28, 0x01,
+	}
+	var p1 Image
+	if err := proto.Unmarshal(odd, &p1); err != nil || !proto.Equal(&p1, want) {
+		t.Errorf("Unmarshal, unpacked: %v, %v", &p1, err)
+	}
+}
+
+func TestToProtoRange(t *testing.T) {
+	big := int64(1) << 31
+	if int64(int(big)) != big {
+		t.Skip("int is 32 bits")
+	}
+	lo, hi := int(-big-1), int(big)
+	m := &img1b.Image{Palette: color.Palette{color.White, color.Black}}
+	for _, r := range []image.Rectangle{
+		{image.Pt(lo, 0), image.Pt(0, 1)},
+		{image.Pt(0, 0), image.Pt(hi, 1)},
+		{image.Pt(0, hi), image.Pt(1, hi+1)},
+	} {
+		m.Rect = r
+		if _, err := ToProto(m); err == nil {
+			t.Errorf("%v: no error", r)
+		} else if _, ok := err.(RangeError); !ok {
+			t.Errorf("%v: got %v, want a RangeError", r, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		p := img1b.New(image.Rect(r.Intn(100)-50, r.Intn(100)-50, 50+r.Intn(60), 50+r.Intn(10)),
+			color.Palette{color.Black, color.RGBA{0xff, 0xee, 0xdd, 0xff}})
+		r.Read(p.Pix)
+		m := p.SubImage(image.Rect(p.Rect.Min.X+8*r.Intn(3), p.Rect.Min.Y, p.Rect.Max.X-r.Intn(20), p.Rect.Max.Y))
+		msg0, err := ToProto(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := proto.Marshal(msg0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg Image
+		if err := proto.Unmarshal(b, &msg); err != nil {
+			t.Fatal(err)
+		}
+		m1, err := FromProto(&msg)
+		if err != nil {
+			t.Fatalf("%v: %v", m.Rect, err)
+		}
+		if m1.Rect != m.Rect || !reflect.DeepEqual(m1.Palette[1], color.NRGBA{0xff, 0xee, 0xdd, 0xff}) {
+			t.Fatalf("%v: got %v, palette %v", m.Rect, m1.Rect, m1.Palette)
+		}
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+				if m1.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) {
+					t.Fatalf("%v: pixel (%d, %d) differs", m.Rect, x, y)
+				}
+			}
+		}
+	}
+	if _, err := FromProto(&Image{MaxX: 8, MaxY: 2, Stride: 1, Palette: []uint32{0xff}, Pix: []byte{0}}); err == nil {
+		t.Error("short pixels: no error")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgtest
+
+import (
+	"github.com/mi-v/img1b"
+	"math"
+	"math/rand"
+)
+
+// A Degradation describes the corruption Degrade applies to an image, to
+// test cleanup code on the defects of printing and scanning in known
+// measure. The zero value changes nothing.
+type Degradation struct {
+	// Blur, Threshold and Noise are the sigma, the threshold and the noise
+	// of Blur, which is skipped if Blur and Noise are 0.
+	Blur, Threshold, Noise float64
+	// Jitter is the probability of flipping an edge pixel, as for Jitter.
+	Jitter float64
+	// SaltPepper is the probability of flipping any pixel, as for
+	// SaltPepper.
+	SaltPepper float64
+}
+
+// Degrade returns a copy of m blurred, its edges jittered and salt and
+// pepper noise added, in that order, as d tells.
+func Degrade(r *rand.Rand, m *img1b.Image, d *Degradation) *img1b.Image {
+	src := m
+	if d.Blur > 0 || d.Noise > 0 {
+		m = Blur(r, m, d.Blur, d.Threshold, d.Noise)
+	}
+	if d.Jitter > 0 {
+		m = Jitter(r, m, d.Jitter)
+	}
+	if d.SaltPepper > 0 {
+		m = SaltPepper(r, m, d.SaltPepper)
+	}
+	if m == src {
+		return clone(m)
+	}
+	return m
+}
+
+// SaltPepper returns a copy of m with each pixel flipped with probability
+// p: black ones turn white, the salt, and white ones black, the pepper.
+func SaltPepper(r *rand.Rand, m *img1b.Image, p float64) *img1b.Image {
+	d := clone(m)
+	b := d.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r.Float64() < p {
+				d.SetColorIndex(x, y, d.ColorIndexAt(x, y)^1)
+			}
+		}
+	}
+	return d
+}
+
+// Jitter returns a copy of m with each pixel on an edge, of a color other
+// than one of its four neighbors in m, flipped with probability p. Shapes
+// keep their size on the whole but get ragged outlines, as from a scanner
+// of low quality.
+func Jitter(r *rand.Rand, m *img1b.Image, p float64) *img1b.Image {
+	d := clone(m)
+	b := m.Rect
+	at := func(x, y int, c uint8) uint8 {
+		if x < b.Min.X || y < b.Min.Y || x >= b.Max.X || y >= b.Max.Y {
+			return c
+		}
+		return m.ColorIndexAt(x, y)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := m.ColorIndexAt(x, y)
+			if at(x-1, y, c) == c && at(x+1, y, c) == c && at(x, y-1, c) == c && at(x, y+1, c) == c {
+				continue
+			}
+			if r.Float64() < p {
+				d.SetColorIndex(x, y, c^1)
+			}
+		}
+	}
+	return d
+}
+
+// Blur returns a copy of m blurred with a Gaussian of standard deviation
+// sigma pixels, with Gaussian noise of standard deviation noise added, and
+// thresholded back: a pixel is black where its darkness, 0 for white to 1
+// for black, is at least threshold, 0.5 if 0. This is Baird's model of
+// printing and scanning. Above 0.5 the threshold thins strokes and breaks
+// them, below it thickens them and fills holes. The pixels around m count
+// as white.
+func Blur(r *rand.Rand, m *img1b.Image, sigma, threshold, noise float64) *img1b.Image {
+	if threshold == 0 {
+		threshold = 0.5
+	}
+	b := m.Rect
+	w, h := b.Dx(), b.Dy()
+	dark := make([]float64, w*h)
+	black := ink(m)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if m.ColorIndexAt(b.Min.X+x, b.Min.Y+y) == black {
+				dark[y*w+x] = 1
+			}
+		}
+	}
+	if sigma > 0 {
+		k := gaussian(sigma)
+		tmp := make([]float64, w*h)
+		convolve(tmp, dark, k, w, h, 1, w)
+		convolve(dark, tmp, k, h, w, w, 1)
+	}
+	d := clone(m)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := dark[y*w+x]
+			if noise > 0 {
+				v += noise * r.NormFloat64()
+			}
+			c := black ^ 1
+			if v >= threshold {
+				c = black
+			}
+			d.SetColorIndex(b.Min.X+x, b.Min.Y+y, c)
+		}
+	}
+	return d
+}
+
+// gaussian returns the weights of a Gaussian kernel of standard deviation
+// sigma out to 3 sigma, from the middle on, summing to 1 both ways.
+func gaussian(sigma float64) []float64 {
+	n := int(math.Ceil(3 * sigma))
+	k := make([]float64, n+1)
+	sum := 0.0
+	for i := range k {
+		k[i] = math.Exp(-float64(i*i) / (2 * sigma * sigma))
+		sum += k[i]
+		if i > 0 {
+			sum += k[i]
+		}
+	}
+	for i := range k {
+		k[i] /= sum
+	}
+	return k
+}
+
+// convolve convolves the lines of src with the symmetric kernel k into
+// dst: n lines of length l, whose elements are step apart and which start
+// stride apart. Elements past the ends are 0.
+func convolve(dst, src, k []float64, l, n, step, stride int) {
+	for j := 0; j < n; j++ {
+		for i := 0; i < l; i++ {
+			v := k[0] * src[j*stride+i*step]
+			for t := 1; t < len(k); t++ {
+				if i-t >= 0 {
+					v += k[t] * src[j*stride+(i-t)*step]
+				}
+				if i+t < l {
+					v += k[t] * src[j*stride+(i+t)*step]
+				}
+			}
+			dst[j*stride+i*step] = v
+		}
+	}
+}
+
+// clone returns a copy of m, with clear padding.
+func clone(m *img1b.Image) *img1b.Image {
+	d := img1b.New(m.Rect, m.Palette)
+	n := (m.Rect.Dx() + 7) / 8
+	for y := 0; y < m.Rect.Dy(); y++ {
+		copy(d.Pix[y*d.Stride:y*d.Stride+n], m.Pix[y*m.Stride:])
+	}
+	d.Canonicalize()
+	return d
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgtest
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestDegrade(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pal := color.Palette{color.Black, color.White}
+	m := img1b.New(image.Rect(-5, 3, 45, 43), pal)
+	fill(m, ink(m)^1)
+	square := image.Rect(5, 13, 35, 33)
+	fillRect(m, square, ink(m))
+	DirtyPadding(r, m)
+
+	if _, n := Diff(SaltPepper(r, m, 0), m); n != 0 {
+		t.Errorf("SaltPepper(0): %d pixels differ", n)
+	}
+	if _, n := Diff(SaltPepper(r, m, 1), m); n != 50*40 {
+		t.Errorf("SaltPepper(1): %d pixels differ, want all", n)
+	}
+	if _, n := Diff(SaltPepper(r, m, 0.1), m); n < 100 || n > 300 {
+		t.Errorf("SaltPepper(0.1): %d pixels differ", n)
+	}
+
+	// Jitter only touches the pixels either side of the edges of the square.
+	d, n := Diff(Jitter(r, m, 0.5), m)
+	if n == 0 {
+		t.Error("Jitter changed nothing")
+	}
+	for y := 0; y < d.Rect.Dy(); y++ {
+		for x := 0; x < d.Rect.Dx(); x++ {
+			p := m.Rect.Min.Add(image.Pt(x, y))
+			if d.ColorIndexAt(x, y) == 1 && (p.In(square.Inset(1)) || !p.In(square.Inset(-1))) {
+				t.Errorf("Jitter changed %v, off the edges", p)
+			}
+		}
+	}
+
+	// Blurring keeps the square about its size, rounding its corners.
+	b := Blur(r, m, 2, 0, 0)
+	if _, n := Diff(b, m); n == 0 || n > 20 {
+		t.Errorf("Blur: %d pixels differ", n)
+	}
+	if b.ColorIndexAt(20, 23) != ink(m) || b.ColorIndexAt(square.Min.X, square.Min.Y) == ink(m) {
+		t.Error("Blur: the square is not kept with rounded corners")
+	}
+	if thin := Blur(r, m, 2, 0.8, 0); countInk(thin) >= countInk(b) {
+		t.Error("Blur: a higher threshold does not thin the square")
+	}
+
+	// Degrade is repeatable and copies m when told to do nothing.
+	dg := &Degradation{Blur: 1, Noise: 0.2, Jitter: 0.2, SaltPepper: 0.01}
+	d1 := Degrade(rand.New(rand.NewSource(7)), m, dg)
+	d2 := Degrade(rand.New(rand.NewSource(7)), m, dg)
+	if _, n := Diff(d1, d2); n != 0 {
+		t.Errorf("Degrade with the same seed: %d pixels differ", n)
+	}
+	if err := d1.Validate(); err != nil {
+		t.Error(err)
+	}
+	c := Degrade(r, m, &Degradation{})
+	if _, n := Diff(c, m); n != 0 || &c.Pix[0] == &m.Pix[0] {
+		t.Error("Degrade with no degradation: not a copy")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package imgtest helps testing code making bilevel images against golden
+// images kept as PNG files, typically under testdata:
+//
+//	func TestRender(t *testing.T) {
+//		imgtest.CompareGolden(t, render(), "testdata/render.png")
+//	}
+//
+// Running the tests with -update-golden writes the images made to the
+// golden files instead of comparing them. When an image differs, the
+// failure shows the differing region as text and names a PNG file with the
+// differing pixels.
+//
+// Random images for property tests come from Noise, Rects, Lines and Text,
+// with bounds and palettes from RandomBounds and RandomPalette meant to
+// catch code assuming aligned, zero-based images of one palette. Random
+// plugs them into testing/quick.
+//
+// Degrade corrupts clean images as printing and scanning do, with
+// SaltPepper noise, Jitter of the edges and Blur then threshold, for
+// testing cleanup code against defects of known measure.
+package imgtest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"github.com/mi-v/img1b/png"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update-golden", false, "write the images compared by imgtest to their golden files")
+
+// maxCols and maxRows bound the text rendering of a differing region.
+const (
+	maxCols = 72
+	maxRows = 40
+)
+
+// CompareGolden reports a test failure if got differs from the golden image
+// in the PNG file at path. Pixels are compared by whether they are of the
+// darker color of their palette, so the order and the exact colors of the
+// palettes do not matter, and so are the sizes, but not the origins.
+//
+// With the -update-golden flag, got is written to path instead, making the
+// directories as needed.
+func CompareGolden(t testing.TB, got *img1b.Image, path string) {
+	t.Helper()
+	if *update {
+		var b bytes.Buffer
+		if err := png.Encode(&b, got); err != nil {
+			t.Errorf("imgtest: encoding %s: %v", path, err)
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("imgtest: %v", err)
+			return
+		}
+		if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+			t.Errorf("imgtest: %v", err)
+			return
+		}
+		t.Logf("imgtest: updated %s", path)
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("imgtest: %v (run the test with -update-golden to make it)", err)
+		return
+	}
+	want, err := png.DecodeBytes(data)
+	if err != nil {
+		t.Errorf("imgtest: decoding %s: %v", path, err)
+		return
+	}
+	if got.Rect.Size() != want.Rect.Size() {
+		t.Errorf("imgtest: image is %v, golden %s is %v", got.Rect.Size(), path, want.Rect.Size())
+		return
+	}
+	diff, n := Diff(got, want)
+	if n == 0 {
+		return
+	}
+	r := bounds(diff)
+	msg := fmt.Sprintf("imgtest: %d pixels differ from %s in %v (+ black only in the image, - only in the golden one):\n%s",
+		n, path, r, render(got, want, r))
+	if name, err := writeDiff(diff, path); err != nil {
+		msg += "writing the differing pixels: " + err.Error()
+	} else {
+		msg += "differing pixels in " + name
+	}
+	t.Error(msg)
+}
+
+// Diff returns an image at the origin, black where a and b, of the same
+// size, differ in whether their pixels are of the darker color of their
+// palettes, white elsewhere, and the number of pixels differing.
+func Diff(a, b *img1b.Image) (*img1b.Image, int) {
+	w, h := a.Rect.Dx(), a.Rect.Dy()
+	d := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	if w <= 0 || h <= 0 {
+		return d, 0
+	}
+	var flip byte
+	if bitmap.BlackIndex(a.Palette) != bitmap.BlackIndex(b.Palette) {
+		flip = 0xff
+	}
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	count := 0
+	for y := 0; y < h; y++ {
+		row := d.Pix[y*d.Stride : y*d.Stride+n]
+		ra, rb := a.Pix[y*a.Stride:], b.Pix[y*b.Stride:]
+		for i := range row {
+			row[i] = ra[i] ^ rb[i] ^ flip
+		}
+		row[n-1] &= tm
+		count += bitmap.Count(row)
+	}
+	return d, count
+}
+
+// bounds returns the smallest rectangle holding the set pixels of d.
+func bounds(d *img1b.Image) image.Rectangle {
+	var r image.Rectangle
+	for y := 0; y < d.Rect.Dy(); y++ {
+		for x := 0; x < d.Rect.Dx(); x++ {
+			if d.Pix[y*d.Stride+x>>3]&(0x80>>uint(x&7)) != 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// black reports whether the pixel of m at (x, y) from its origin is of the
+// darker color.
+func black(m *img1b.Image, x, y int) bool {
+	return m.ColorIndexAt(m.Rect.Min.X+x, m.Rect.Min.Y+y) == bitmap.BlackIndex(m.Palette)
+}
+
+// render draws the region r of got and want as text, a character per
+// pixel, cut to maxCols by maxRows.
+func render(got, want *img1b.Image, r image.Rectangle) string {
+	if r.Dx() > maxCols {
+		r.Max.X = r.Min.X + maxCols
+	}
+	if r.Dy() > maxRows {
+		r.Max.Y = r.Min.Y + maxRows
+	}
+	var b strings.Builder
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			g, w := black(got, x, y), black(want, x, y)
+			switch {
+			case g && w:
+				b.WriteByte('#')
+			case g:
+				b.WriteByte('+')
+			case w:
+				b.WriteByte('-')
+			default:
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// writeDiff writes d to a new PNG file in the temporary directory, named
+// after the golden file, and returns its name.
+func writeDiff(d *img1b.Image, golden string) (string, error) {
+	base := strings.TrimSuffix(filepath.Base(golden), filepath.Ext(golden))
+	f, err := ioutil.TempFile("", base+".diff.*.png")
+	if err != nil {
+		return "", err
+	}
+	d.SetPalette(color.Palette{color.White, color.RGBA{0xff, 0, 0, 0xff}})
+	err = png.Encode(f, d)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return f.Name(), err
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgtest
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// recorder is a testing.TB keeping the failures reported to it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Logf(format string, args ...interface{}) {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func testImage(pal color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 21, 9), pal)
+	ink := bitmapIndex(pal)
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 21; x++ {
+			if x >= 3 && x < 18 && y >= 2 && y < 7 {
+				m.SetColorIndex(x, y, ink)
+			} else {
+				m.SetColorIndex(x, y, ink^1)
+			}
+		}
+	}
+	return m
+}
+
+// bitmapIndex returns the index of black in pal.
+func bitmapIndex(pal color.Palette) uint8 {
+	if pal[0] == color.Black {
+		return 0
+	}
+	return 1
+}
+
+func TestCompareGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imgtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "golden.png")
+	m := testImage(color.Palette{color.White, color.Black})
+
+	r := &recorder{TB: t}
+	CompareGolden(r, m, path)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "-update-golden") {
+		t.Fatalf("missing golden file: got %q", r.errors)
+	}
+
+	*update = true
+	r = &recorder{TB: t}
+	CompareGolden(r, m, path)
+	*update = false
+	if len(r.errors) != 0 {
+		t.Fatalf("update: %q", r.errors)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same ink with the palette the other way round matches.
+	r = &recorder{TB: t}
+	CompareGolden(r, testImage(color.Palette{color.Black, color.White}), path)
+	if len(r.errors) != 0 {
+		t.Errorf("same image: %q", r.errors)
+	}
+
+	d := testImage(color.Palette{color.White, color.Black})
+	d.SetColorIndex(5, 4, 0)
+	d.SetColorIndex(19, 7, 1)
+	r = &recorder{TB: t}
+	CompareGolden(r, d, path)
+	if len(r.errors) != 1 {
+		t.Fatalf("different image: got %q", r.errors)
+	}
+	msg := r.errors[0]
+	want := "imgtest: 2 pixels differ from " + path + " in (5,4)-(20,8) (+ black only in the image, - only in the golden one):\n" +
+		"-############..\n" +
+		"#############..\n" +
+		"#############..\n" +
+		"..............+\n"
+	if !strings.HasPrefix(msg, want) {
+		t.Errorf("got\n%s\nwant prefix\n%s", msg, want)
+	}
+	name := regexp.MustCompile(`differing pixels in (.*)$`).FindStringSubmatch(msg)
+	if name == nil {
+		t.Fatalf("no diff file named in %q", msg)
+	}
+	defer os.Remove(name[1])
+	f, err := os.Open(name[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	diff, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countIndex(diff, 1); n != 2 || diff.ColorIndexAt(5, 4) != 1 || diff.ColorIndexAt(19, 7) != 1 {
+		t.Errorf("diff has %d pixels set", n)
+	}
+
+	r = &recorder{TB: t}
+	CompareGolden(r, img1b.New(image.Rect(0, 0, 20, 9), m.Palette), path)
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "(20,9)") {
+		t.Errorf("different size: got %q", r.errors)
+	}
+}
+
+func countIndex(m *img1b.Image, i uint8) int {
+	n := 0
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			if m.ColorIndexAt(x, y) == i {
+				n++
+			}
+		}
+	}
+	return n
+}
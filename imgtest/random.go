@@ -0,0 +1,254 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgtest
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+)
+
+// RandomBounds returns a rectangle of up to max by max pixels, possibly
+// empty, at a random origin that may be negative and is mostly off the
+// byte boundaries that widths rarely fall on.
+func RandomBounds(r *rand.Rand, max int) image.Rectangle {
+	if max < 1 {
+		max = 1
+	}
+	min := image.Pt(r.Intn(41)-20, r.Intn(41)-20)
+	return image.Rectangle{min, min.Add(image.Pt(r.Intn(max+1), r.Intn(max+1)))}
+}
+
+// RandomPalette returns {white, black} or {black, white}, or now and then
+// two other colors of different luminance, so that code handling the
+// palette only one way round shows.
+func RandomPalette(r *rand.Rand) color.Palette {
+	switch r.Intn(5) {
+	case 0, 1:
+		return color.Palette{color.White, color.Black}
+	case 2, 3:
+		return color.Palette{color.Black, color.White}
+	}
+	dark := color.RGBA{uint8(r.Intn(0x60)), uint8(r.Intn(0x60)), uint8(r.Intn(0x60)), 0xff}
+	light := color.RGBA{0xa0 + uint8(r.Intn(0x60)), 0xa0 + uint8(r.Intn(0x60)), 0xa0 + uint8(r.Intn(0x60)), 0xff}
+	if r.Intn(2) == 0 {
+		return color.Palette{dark, light}
+	}
+	return color.Palette{light, dark}
+}
+
+// ink returns the color index of the darker color of m.
+func ink(m *img1b.Image) uint8 {
+	return bitmap.BlackIndex(m.Palette)
+}
+
+// Noise returns an image with the bounds b and the palette pal, each pixel
+// black with probability p.
+func Noise(r *rand.Rand, b image.Rectangle, pal color.Palette, p float64) *img1b.Image {
+	m := img1b.New(b, pal)
+	fill(m, ink(m)^1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r.Float64() < p {
+				m.SetColorIndex(x, y, ink(m))
+			}
+		}
+	}
+	return m
+}
+
+// Rects returns an image with the bounds b and the palette pal, with n
+// random black rectangles, some of them filled and some outlined, some
+// running off the edges.
+func Rects(r *rand.Rand, b image.Rectangle, pal color.Palette, n int) *img1b.Image {
+	m := img1b.New(b, pal)
+	fill(m, ink(m)^1)
+	if b.Empty() {
+		return m
+	}
+	for i := 0; i < n; i++ {
+		p := randomPoint(r, b, 4)
+		q := randomPoint(r, b, 4)
+		rect := image.Rectangle{p, q}.Canon()
+		if r.Intn(2) == 0 {
+			fillRect(m, rect, ink(m))
+			continue
+		}
+		fillRect(m, image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+1), ink(m))
+		fillRect(m, image.Rect(rect.Min.X, rect.Max.Y-1, rect.Max.X, rect.Max.Y), ink(m))
+		fillRect(m, image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Max.Y), ink(m))
+		fillRect(m, image.Rect(rect.Max.X-1, rect.Min.Y, rect.Max.X, rect.Max.Y), ink(m))
+	}
+	return m
+}
+
+// Lines returns an image with the bounds b and the palette pal, with n
+// random black lines one pixel wide, in any direction.
+func Lines(r *rand.Rand, b image.Rectangle, pal color.Palette, n int) *img1b.Image {
+	m := img1b.New(b, pal)
+	fill(m, ink(m)^1)
+	if b.Empty() {
+		return m
+	}
+	for i := 0; i < n; i++ {
+		line(m, randomPoint(r, b, 4), randomPoint(r, b, 4), ink(m))
+	}
+	return m
+}
+
+// Text returns an image with the bounds b and the palette pal looking like
+// a page of text from afar: lines of words made of small glyph-like blobs,
+// with the gaps between letters, words and lines that layout analysis
+// looks for.
+func Text(r *rand.Rand, b image.Rectangle, pal color.Palette) *img1b.Image {
+	m := img1b.New(b, pal)
+	fill(m, ink(m)^1)
+	size := 5 + r.Intn(8)
+	margin := 1 + r.Intn(size)
+	for y := b.Min.Y + margin; y+size <= b.Max.Y-margin; y += size * 3 / 2 {
+		x := b.Min.X + margin
+		for x < b.Max.X-margin {
+			word := 1 + r.Intn(8)
+			for i := 0; i < word && x < b.Max.X-margin; i++ {
+				w := size/2 + r.Intn(size/2+1)
+				glyph(r, m, image.Rect(x, y, x+w, y+size).Intersect(b), ink(m))
+				x += w + 1
+			}
+			x += size / 2
+		}
+	}
+	return m
+}
+
+// glyph draws a blob in g: a vertical stem and some strokes across, or a
+// dot, like a letter at a glance.
+func glyph(r *rand.Rand, m *img1b.Image, g image.Rectangle, c uint8) {
+	if g.Dx() < 2 || g.Dy() < 2 {
+		return
+	}
+	if r.Intn(12) == 0 {
+		fillRect(m, image.Rect(g.Min.X, g.Max.Y-2, g.Min.X+2, g.Max.Y), c)
+		return
+	}
+	x := g.Min.X + r.Intn(g.Dx())
+	fillRect(m, image.Rect(x, g.Min.Y+r.Intn(g.Dy()/2+1), x+1, g.Max.Y), c)
+	for i := r.Intn(3); i >= 0; i-- {
+		y := g.Min.Y + r.Intn(g.Dy())
+		fillRect(m, image.Rect(g.Min.X, y, g.Max.X-1, y+1), c)
+	}
+}
+
+// Random is an image generated by one of Noise, Rects, Lines and Text at
+// random, with random bounds and palette. It implements quick.Generator,
+// so that properties of images can be checked with testing/quick:
+//
+//	f := func(m imgtest.Random) bool { return roundTrips(m.Image) }
+//	if err := quick.Check(f, nil); err != nil {
+//		t.Error(err)
+//	}
+type Random struct {
+	*img1b.Image
+}
+
+// Generate implements quick.Generator. The images are up to size by size
+// pixels, with random bits past their right edges.
+func (Random) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(Random{RandomImage(r, size)})
+}
+
+// RandomImage returns an image as made by Random.Generate.
+func RandomImage(r *rand.Rand, max int) *img1b.Image {
+	b := RandomBounds(r, max)
+	pal := RandomPalette(r)
+	var m *img1b.Image
+	switch r.Intn(4) {
+	case 0:
+		m = Noise(r, b, pal, r.Float64())
+	case 1:
+		m = Rects(r, b, pal, r.Intn(8))
+	case 2:
+		m = Lines(r, b, pal, r.Intn(8))
+	default:
+		m = Text(r, b, pal)
+	}
+	DirtyPadding(r, m)
+	return m
+}
+
+// DirtyPadding sets the bits of m past its right edge at random, which no
+// code may take as pixels.
+func DirtyPadding(r *rand.Rand, m *img1b.Image) {
+	w := m.Rect.Dx()
+	if w%8 == 0 {
+		return
+	}
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	for y := 0; y < m.Rect.Dy(); y++ {
+		i := y*m.Stride + n - 1
+		m.Pix[i] = m.Pix[i]&tm | byte(r.Intn(256))&^tm
+	}
+}
+
+// randomPoint returns a point in b or up to out pixels outside.
+func randomPoint(r *rand.Rand, b image.Rectangle, out int) image.Point {
+	return image.Pt(b.Min.X-out+r.Intn(b.Dx()+2*out), b.Min.Y-out+r.Intn(b.Dy()+2*out))
+}
+
+// fill sets all the pixels of m to color index c.
+func fill(m *img1b.Image, c uint8) {
+	if c != 0 {
+		fillRect(m, m.Rect, c)
+	}
+}
+
+// fillRect sets the pixels of m in rect to color index c.
+func fillRect(m *img1b.Image, rect image.Rectangle, c uint8) {
+	rect = rect.Intersect(m.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			m.SetColorIndex(x, y, c)
+		}
+	}
+}
+
+// line draws the line from p to q in color index c, with Bresenham's
+// algorithm. Pixels outside m are left out.
+func line(m *img1b.Image, p, q image.Point, c uint8) {
+	dx, dy := abs(q.X-p.X), -abs(q.Y-p.Y)
+	sx, sy := 1, 1
+	if q.X < p.X {
+		sx = -1
+	}
+	if q.Y < p.Y {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		m.SetColorIndex(p.X, p.Y, c)
+		if p == q {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			p.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			p.Y += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
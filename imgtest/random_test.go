@@ -0,0 +1,90 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgtest
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+func countInk(m *img1b.Image) int {
+	n := 0
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			if m.ColorIndexAt(x, y) == ink(m) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestGenerators(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	pal := color.Palette{color.Black, color.White}
+	b := image.Rect(-3, 5, 97, 105)
+	for _, tc := range []struct {
+		name     string
+		m        *img1b.Image
+		min, max int
+	}{
+		{"Noise 0", Noise(r, b, pal, 0), 0, 0},
+		{"Noise 1", Noise(r, b, pal, 1), 10000, 10000},
+		{"Noise 0.3", Noise(r, b, pal, 0.3), 2700, 3300},
+		{"Rects", Rects(r, b, pal, 5), 1, 10000},
+		{"Lines", Lines(r, b, pal, 5), 5, 1000},
+		{"Text", Text(r, b, pal), 100, 6000},
+	} {
+		if tc.m.Rect != b {
+			t.Errorf("%s: bounds %v", tc.name, tc.m.Rect)
+		}
+		if n := countInk(tc.m); n < tc.min || n > tc.max {
+			t.Errorf("%s: %d black pixels, want %d to %d", tc.name, n, tc.min, tc.max)
+		}
+	}
+
+	for i := 0; i < 200; i++ {
+		b := RandomBounds(r, 30)
+		if b.Dx() < 0 || b.Dx() > 30 || b.Dy() < 0 || b.Dy() > 30 {
+			t.Fatalf("RandomBounds: %v", b)
+		}
+		m := RandomImage(r, 30)
+		n := countInk(m)
+		DirtyPadding(r, m)
+		if countInk(m) != n {
+			t.Fatal("DirtyPadding changes pixels")
+		}
+	}
+}
+
+// The PNG codec keeps random images, as an example of a property checked
+// with Random.
+func TestRandomQuick(t *testing.T) {
+	f := func(m Random) bool {
+		if m.Rect.Empty() {
+			// PNG has no empty images.
+			return true
+		}
+		var b bytes.Buffer
+		if err := png.Encode(&b, m.Image); err != nil {
+			return false
+		}
+		d, err := png.Decode(&b)
+		if err != nil || d.Rect.Size() != m.Rect.Size() {
+			return false
+		}
+		_, n := Diff(m.Image, d)
+		return n == 0
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(2))}); err != nil {
+		t.Error(err)
+	}
+}
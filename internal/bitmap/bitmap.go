@@ -0,0 +1,124 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bitmap holds helpers shared by the img1b codecs.
+package bitmap
+
+import (
+	"image"
+	"image/color"
+)
+
+// Luma returns the luminance of c, 0 to 0xffff, as in color.Gray16Model.
+func Luma(c color.Color) uint32 {
+	r, g, b, _ := c.RGBA()
+	return (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+}
+
+// BlackIndex returns the index (0 or 1) of the darker of the first two
+// palette colors. Formats that store foreground (black) as set bits use it to
+// decide whether image bits need to be inverted. A missing color is considered
+// to be white, so short palettes have black at index 0.
+func BlackIndex(p color.Palette) uint8 {
+	if len(p) < 2 {
+		return 0
+	}
+	if Luma(p[1]) < Luma(p[0]) {
+		return 1
+	}
+	return 0
+}
+
+// Palette returns {white, black}, the palette of bitmaps with black pixels
+// set, such as those CopyBlack makes.
+func Palette() color.Palette {
+	return color.Palette{color.White, color.Black}
+}
+
+// CopyBlack copies h rows of w pixels from src, of palette p, to dst so that
+// black pixels are set, and clears the padding of the rows of dst. The rows
+// are srcStride and dstStride bytes apart.
+func CopyBlack(dst []byte, dstStride int, src []byte, srcStride int, w, h int, p color.Palette) {
+	if w <= 0 {
+		return
+	}
+	n := (w + 7) / 8
+	invert := BlackIndex(p) == 0
+	tm := TailMask(w)
+	for y := 0; y < h; y++ {
+		row := dst[y*dstStride : y*dstStride+n]
+		copy(row, src[y*srcStride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[n-1] &= tm
+	}
+}
+
+// Bit reports whether the pixel at (x, y) of a bitmap of bounds r, with rows
+// stride bytes apart, is set. Pixels outside r are not.
+func Bit(pix []byte, stride int, r image.Rectangle, x, y int) bool {
+	if !(image.Point{x, y}.In(r)) {
+		return false
+	}
+	x -= r.Min.X
+	return pix[(y-r.Min.Y)*stride+x>>3]&(0x80>>uint(x&7)) != 0
+}
+
+// TailMask returns the mask of bits of the last byte of a row that belong to
+// an image of the given width.
+func TailMask(width int) byte {
+	return byte(uint16(0xff00) >> uint((width-1)%8+1))
+}
+
+// Transpose8 transposes an 8×8 block of pixels with rows in src[0],
+// src[stride], ... src[7*stride], into dst in the same way. The most
+// significant bit of a row byte is its leftmost pixel, so dst[0] gets the
+// leftmost column, top pixel first.
+func Transpose8(dst []byte, dstStride int, src []byte, srcStride int) {
+	// Hacker's Delight, section 7-3.
+	x := uint32(src[0])<<24 | uint32(src[srcStride])<<16 | uint32(src[2*srcStride])<<8 | uint32(src[3*srcStride])
+	y := uint32(src[4*srcStride])<<24 | uint32(src[5*srcStride])<<16 | uint32(src[6*srcStride])<<8 | uint32(src[7*srcStride])
+	t := (x ^ x>>7) & 0x00aa00aa
+	x ^= t ^ t<<7
+	t = (y ^ y>>7) & 0x00aa00aa
+	y ^= t ^ t<<7
+	t = (x ^ x>>14) & 0x0000cccc
+	x ^= t ^ t<<14
+	t = (y ^ y>>14) & 0x0000cccc
+	y ^= t ^ t<<14
+	x, y = x&0xf0f0f0f0|y>>4&0x0f0f0f0f, x<<4&0xf0f0f0f0|y&0x0f0f0f0f
+	for i := 0; i < 4; i++ {
+		dst[i*dstStride] = byte(x >> uint(24-8*i))
+		dst[(i+4)*dstStride] = byte(y >> uint(24-8*i))
+	}
+}
+
+// PackBits compresses src with the PackBits scheme of TIFF and appends the
+// result to dst.
+func PackBits(dst, src []byte) []byte {
+	for len(src) > 0 {
+		// Find a run of identical bytes.
+		n := 1
+		for n < len(src) && n < 128 && src[n] == src[0] {
+			n++
+		}
+		if n > 1 {
+			dst = append(dst, byte(1-n), src[0])
+			src = src[n:]
+			continue
+		}
+		// Literal bytes up to the next run of at least three.
+		n = 1
+		for n < len(src) && n < 128 && !(n+2 < len(src) && src[n] == src[n+1] && src[n] == src[n+2]) {
+			n++
+		}
+		dst = append(dst, byte(n-1))
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
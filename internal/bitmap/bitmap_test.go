@@ -0,0 +1,42 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bitmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCopyBlack(t *testing.T) {
+	src := []byte{0xf0, 0xff, 0xee, 0x0f, 0x00, 0x77}
+	dst := make([]byte, 4)
+	CopyBlack(dst, 2, src, 3, 11, 2, Palette())
+	if want := []byte{0xf0, 0xe0, 0x0f, 0x00}; !bytes.Equal(dst, want) {
+		t.Errorf("black set: got % x, want % x", dst, want)
+	}
+	CopyBlack(dst, 2, src, 3, 11, 2, color.Palette{color.Black, color.White})
+	if want := []byte{0x0f, 0x00, 0xf0, 0xe0}; !bytes.Equal(dst, want) {
+		t.Errorf("black clear: got % x, want % x", dst, want)
+	}
+}
+
+func TestBit(t *testing.T) {
+	pix := []byte{0x81, 0x40, 0x00, 0x80}
+	r := image.Rect(10, 20, 20, 22)
+	for _, tt := range []struct {
+		x, y int
+		want bool
+	}{
+		{10, 20, true}, {11, 20, false}, {17, 20, true}, {19, 20, true},
+		{17, 21, false}, {18, 21, true}, {19, 21, false},
+		{10, 19, false}, {9, 20, false}, {20, 20, false}, {10, 22, false},
+	} {
+		if got := Bit(pix, 2, r, tt.x, tt.y); got != tt.want {
+			t.Errorf("Bit(%d, %d): got %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bitmap
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The functions below are the hot loops over rows of packed pixels. They
+// have vector implementations on amd64 with AVX2 and on arm64 with NEON;
+// elsewhere, or when built with the purego tag, they work on 8 bytes at a
+// time. The binary operations work on the bytes dst and src both have.
+
+// And sets each byte of dst to its AND with the byte of src at the same
+// index.
+func And(dst, src []byte) {
+	n := minLen(dst, src)
+	and(dst[:n], src[:n])
+}
+
+// Or sets each byte of dst to its OR with the byte of src at the same index.
+func Or(dst, src []byte) {
+	n := minLen(dst, src)
+	or(dst[:n], src[:n])
+}
+
+// Xor sets each byte of dst to its XOR with the byte of src at the same
+// index.
+func Xor(dst, src []byte) {
+	n := minLen(dst, src)
+	xor(dst[:n], src[:n])
+}
+
+// Count returns the number of set bits of b.
+func Count(b []byte) int {
+	return count(b)
+}
+
+// CountDiff returns the number of bits differing between a and b, over the
+// bytes both have.
+func CountDiff(a, b []byte) int {
+	n := minLen(a, b)
+	return countDiff(a[:n], b[:n])
+}
+
+// All reports whether every byte of b is v.
+func All(b []byte, v byte) bool {
+	return all(b, v)
+}
+
+// Fill sets the bytes of b to v.
+func Fill(b []byte, v byte) {
+	fill(b, v)
+}
+
+// Reverse sets dst to the bits of src in reverse order, so a row of pixels
+// is mirrored: dst[i] is src[n-1-i] with its bits reversed, n being the
+// number of bytes both have.
+func Reverse(dst, src []byte) {
+	n := minLen(dst, src)
+	reverse(dst[:n], src[:n])
+}
+
+// ReverseBits reverses the bit order of each byte of b, converting between
+// MSB-first and LSB-first packing without moving the bytes.
+func ReverseBits(b []byte) {
+	reverseBits(b)
+}
+
+func minLen(a, b []byte) int {
+	if len(a) < len(b) {
+		return len(a)
+	}
+	return len(b)
+}
+
+// The portable implementations, 8 bytes at a time.
+
+func andWords(dst, src []byte) {
+	i := 0
+	for ; i+8 <= len(dst); i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], binary.LittleEndian.Uint64(dst[i:])&binary.LittleEndian.Uint64(src[i:]))
+	}
+	for ; i < len(dst); i++ {
+		dst[i] &= src[i]
+	}
+}
+
+func orWords(dst, src []byte) {
+	i := 0
+	for ; i+8 <= len(dst); i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], binary.LittleEndian.Uint64(dst[i:])|binary.LittleEndian.Uint64(src[i:]))
+	}
+	for ; i < len(dst); i++ {
+		dst[i] |= src[i]
+	}
+}
+
+func xorWords(dst, src []byte) {
+	i := 0
+	for ; i+8 <= len(dst); i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], binary.LittleEndian.Uint64(dst[i:])^binary.LittleEndian.Uint64(src[i:]))
+	}
+	for ; i < len(dst); i++ {
+		dst[i] ^= src[i]
+	}
+}
+
+func countWords(b []byte) int {
+	n, i := 0, 0
+	for ; i+8 <= len(b); i += 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(b[i:]))
+	}
+	for ; i < len(b); i++ {
+		n += bits.OnesCount8(b[i])
+	}
+	return n
+}
+
+func countDiffWords(a, b []byte) int {
+	n, i := 0, 0
+	for ; i+8 <= len(a); i += 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+	for ; i < len(a); i++ {
+		n += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return n
+}
+
+func allWords(b []byte, v byte) bool {
+	w := uint64(v) * 0x0101010101010101
+	i := 0
+	for ; i+8 <= len(b); i += 8 {
+		if binary.LittleEndian.Uint64(b[i:]) != w {
+			return false
+		}
+	}
+	for ; i < len(b); i++ {
+		if b[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func fillWords(b []byte, v byte) {
+	w := uint64(v) * 0x0101010101010101
+	i := 0
+	for ; i+8 <= len(b); i += 8 {
+		binary.LittleEndian.PutUint64(b[i:], w)
+	}
+	for ; i < len(b); i++ {
+		b[i] = v
+	}
+}
+
+// reversed holds each byte with its bits reversed.
+var reversed [256]byte
+
+func init() {
+	for i := range reversed {
+		reversed[i] = bits.Reverse8(uint8(i))
+	}
+}
+
+func reverseBitsTable(b []byte) {
+	for i, c := range b {
+		b[i] = reversed[c]
+	}
+}
+
+func reverseWords(dst, src []byte) {
+	n, i := len(dst), 0
+	// Reversing the bits of a little endian word also reverses its bytes.
+	for ; i+8 <= n; i += 8 {
+		binary.LittleEndian.PutUint64(dst[i:], bits.Reverse64(binary.LittleEndian.Uint64(src[n-8-i:])))
+	}
+	for ; i < n; i++ {
+		dst[i] = bits.Reverse8(src[n-1-i])
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package bitmap
+
+// useAVX2 tells whether the processor and the operating system support
+// AVX2.
+var useAVX2 = hasAVX2()
+
+// Implemented in simd_amd64.s.
+func hasAVX2() bool
+
+// vector returns the number of leading bytes of an n byte slice the vector
+// loops take, 0 if they are not to be used.
+func vector(n int) int {
+	if !useAVX2 {
+		return 0
+	}
+	return n &^ 31
+}
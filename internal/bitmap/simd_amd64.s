@@ -0,0 +1,265 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// func hasAVX2() bool
+TEXT ·hasAVX2(SB), NOSPLIT, $0-1
+	MOVB $0, ret+0(FP)
+	// The OS saves the YMM registers: OSXSAVE and AVX, then XCR0.
+	MOVL $1, AX
+	XORL CX, CX
+	CPUID
+	MOVL CX, DX
+	ANDL $0x18000000, DX
+	CMPL DX, $0x18000000
+	JNE  no
+	XORL CX, CX
+	XGETBV
+	ANDL $6, AX
+	CMPL AX, $6
+	JNE  no
+	// AVX2.
+	MOVL $7, AX
+	XORL CX, CX
+	CPUID
+	BTL  $5, BX
+	JCC  no
+	MOVB $1, ret+0(FP)
+no:
+	RET
+
+// func andVec(dst, src *byte, n int)
+TEXT ·andVec(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+andLoop:
+	VMOVDQU (DI), Y0
+	VPAND   (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	SUBQ    $32, CX
+	JNZ     andLoop
+	VZEROUPPER
+	RET
+
+// func orVec(dst, src *byte, n int)
+TEXT ·orVec(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+orLoop:
+	VMOVDQU (DI), Y0
+	VPOR    (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	SUBQ    $32, CX
+	JNZ     orLoop
+	VZEROUPPER
+	RET
+
+// func xorVec(dst, src *byte, n int)
+TEXT ·xorVec(SB), NOSPLIT, $0-24
+	MOVQ dst+0(FP), DI
+	MOVQ src+8(FP), SI
+	MOVQ n+16(FP), CX
+xorLoop:
+	VMOVDQU (DI), Y0
+	VPXOR   (SI), Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	ADDQ    $32, SI
+	SUBQ    $32, CX
+	JNZ     xorLoop
+	VZEROUPPER
+	RET
+
+// popcount adds the set bits of the bytes of Y0 to the 4 quadwords of Y6,
+// looking up the counts of nibbles. Y4 holds the nibble counts, Y5 the
+// nibble mask and Y7 zero.
+#define POPCOUNT \
+	VPSRLW   $4, Y0, Y1 \
+	VPAND    Y5, Y0, Y0 \
+	VPAND    Y5, Y1, Y1 \
+	VPSHUFB  Y0, Y4, Y2 \
+	VPSHUFB  Y1, Y4, Y3 \
+	VPADDB   Y2, Y3, Y2 \
+	VPSADBW  Y7, Y2, Y2 \
+	VPADDQ   Y2, Y6, Y6
+
+// SUM moves the sum of the quadwords of Y6 to AX.
+#define SUM \
+	VEXTRACTI128 $1, Y6, X0 \
+	VPADDQ       X0, X6, X6 \
+	VPSHUFD      $0x4e, X6, X0 \
+	VPADDQ       X0, X6, X6 \
+	MOVQ         X6, AX
+
+// func countVec(b *byte, n int) int
+TEXT ·countVec(SB), NOSPLIT, $0-24
+	MOVQ    b+0(FP), SI
+	MOVQ    n+8(FP), CX
+	VMOVDQU nibbleCounts<>(SB), Y4
+	VMOVDQU nibbleMask<>(SB), Y5
+	VPXOR   Y6, Y6, Y6
+	VPXOR   Y7, Y7, Y7
+countLoop:
+	VMOVDQU (SI), Y0
+	POPCOUNT
+	ADDQ    $32, SI
+	SUBQ    $32, CX
+	JNZ     countLoop
+	SUM
+	VZEROUPPER
+	MOVQ    AX, ret+16(FP)
+	RET
+
+// func countDiffVec(a, b *byte, n int) int
+TEXT ·countDiffVec(SB), NOSPLIT, $0-32
+	MOVQ    a+0(FP), SI
+	MOVQ    b+8(FP), DI
+	MOVQ    n+16(FP), CX
+	VMOVDQU nibbleCounts<>(SB), Y4
+	VMOVDQU nibbleMask<>(SB), Y5
+	VPXOR   Y6, Y6, Y6
+	VPXOR   Y7, Y7, Y7
+countDiffLoop:
+	VMOVDQU (SI), Y0
+	VPXOR   (DI), Y0, Y0
+	POPCOUNT
+	ADDQ    $32, SI
+	ADDQ    $32, DI
+	SUBQ    $32, CX
+	JNZ     countDiffLoop
+	SUM
+	VZEROUPPER
+	MOVQ    AX, ret+24(FP)
+	RET
+
+// func allVec(b *byte, n int, v byte) bool
+TEXT ·allVec(SB), NOSPLIT, $0-25
+	MOVQ         b+0(FP), SI
+	MOVQ         n+8(FP), CX
+	MOVBLZX      v+16(FP), AX
+	MOVQ         AX, X0
+	VPBROADCASTB X0, Y0
+	MOVB         $0, ret+24(FP)
+allLoop:
+	VPXOR   (SI), Y0, Y1
+	VPTEST  Y1, Y1
+	JNZ     allDone
+	ADDQ    $32, SI
+	SUBQ    $32, CX
+	JNZ     allLoop
+	MOVB    $1, ret+24(FP)
+allDone:
+	VZEROUPPER
+	RET
+
+// func fillVec(b *byte, n int, v byte)
+TEXT ·fillVec(SB), NOSPLIT, $0-17
+	MOVQ         b+0(FP), DI
+	MOVQ         n+8(FP), CX
+	MOVBLZX      v+16(FP), AX
+	MOVQ         AX, X0
+	VPBROADCASTB X0, Y0
+fillLoop:
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	SUBQ    $32, CX
+	JNZ     fillLoop
+	VZEROUPPER
+	RET
+
+// func reverseVec(dst, src *byte, n int)
+TEXT ·reverseVec(SB), NOSPLIT, $0-24
+	MOVQ    dst+0(FP), DI
+	MOVQ    src+8(FP), SI
+	MOVQ    n+16(FP), CX
+	VMOVDQU nibbleMask<>(SB), Y5
+	VMOVDQU reversedLow<>(SB), Y6
+	VMOVDQU reversedHigh<>(SB), Y7
+	VMOVDQU byteOrder<>(SB), Y8
+	// The blocks of src from the last one.
+	ADDQ    CX, SI
+reverseLoop:
+	SUBQ    $32, SI
+	VMOVDQU (SI), Y0
+	// The reversed low nibbles go high, the reversed high nibbles low.
+	VPSRLW  $4, Y0, Y1
+	VPAND   Y5, Y0, Y0
+	VPAND   Y5, Y1, Y1
+	VPSHUFB Y0, Y7, Y0
+	VPSHUFB Y1, Y6, Y1
+	VPOR    Y1, Y0, Y0
+	// Reverse the bytes of the lanes, then swap the lanes.
+	VPSHUFB Y8, Y0, Y0
+	VPERMQ  $0x4e, Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	SUBQ    $32, CX
+	JNZ     reverseLoop
+	VZEROUPPER
+	RET
+
+// func reverseBitsVec(b *byte, n int)
+TEXT ·reverseBitsVec(SB), NOSPLIT, $0-16
+	MOVQ    b+0(FP), DI
+	MOVQ    n+8(FP), CX
+	VMOVDQU nibbleMask<>(SB), Y5
+	VMOVDQU reversedLow<>(SB), Y6
+	VMOVDQU reversedHigh<>(SB), Y7
+reverseBitsLoop:
+	VMOVDQU (DI), Y0
+	VPSRLW  $4, Y0, Y1
+	VPAND   Y5, Y0, Y0
+	VPAND   Y5, Y1, Y1
+	VPSHUFB Y0, Y7, Y0
+	VPSHUFB Y1, Y6, Y1
+	VPOR    Y1, Y0, Y0
+	VMOVDQU Y0, (DI)
+	ADDQ    $32, DI
+	SUBQ    $32, CX
+	JNZ     reverseBitsLoop
+	VZEROUPPER
+	RET
+
+// The number of set bits of each nibble, in both lanes.
+DATA nibbleCounts<>+0(SB)/8, $0x0302020102010100
+DATA nibbleCounts<>+8(SB)/8, $0x0403030203020201
+DATA nibbleCounts<>+16(SB)/8, $0x0302020102010100
+DATA nibbleCounts<>+24(SB)/8, $0x0403030203020201
+GLOBL nibbleCounts<>(SB), RODATA|NOPTR, $32
+
+DATA nibbleMask<>+0(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibbleMask<>+8(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibbleMask<>+16(SB)/8, $0x0f0f0f0f0f0f0f0f
+DATA nibbleMask<>+24(SB)/8, $0x0f0f0f0f0f0f0f0f
+GLOBL nibbleMask<>(SB), RODATA|NOPTR, $32
+
+// Each nibble with its bits reversed, in the low and in the high nibble.
+DATA reversedLow<>+0(SB)/8, $0x0e060a020c040800
+DATA reversedLow<>+8(SB)/8, $0x0f070b030d050901
+DATA reversedLow<>+16(SB)/8, $0x0e060a020c040800
+DATA reversedLow<>+24(SB)/8, $0x0f070b030d050901
+GLOBL reversedLow<>(SB), RODATA|NOPTR, $32
+
+DATA reversedHigh<>+0(SB)/8, $0xe060a020c0408000
+DATA reversedHigh<>+8(SB)/8, $0xf070b030d0509010
+DATA reversedHigh<>+16(SB)/8, $0xe060a020c0408000
+DATA reversedHigh<>+24(SB)/8, $0xf070b030d0509010
+GLOBL reversedHigh<>(SB), RODATA|NOPTR, $32
+
+// The bytes of a lane in reverse order.
+DATA byteOrder<>+0(SB)/8, $0x08090a0b0c0d0e0f
+DATA byteOrder<>+8(SB)/8, $0x0001020304050607
+DATA byteOrder<>+16(SB)/8, $0x08090a0b0c0d0e0f
+DATA byteOrder<>+24(SB)/8, $0x0001020304050607
+GLOBL byteOrder<>(SB), RODATA|NOPTR, $32
@@ -0,0 +1,14 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build arm64 && !purego
+// +build arm64,!purego
+
+package bitmap
+
+// vector returns the number of leading bytes of an n byte slice the vector
+// loops take. NEON is part of every arm64 processor, so there is no check.
+func vector(n int) int {
+	return n &^ 31
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build arm64 && !purego
+// +build arm64,!purego
+
+#include "textflag.h"
+
+// The loops work on 32 bytes at a time, in pairs of 16 byte registers.
+
+// func andVec(dst, src *byte, n int)
+TEXT ·andVec(SB), NOSPLIT, $0-24
+	MOVD dst+0(FP), R0
+	MOVD src+8(FP), R1
+	MOVD n+16(FP), R2
+andLoop:
+	VLD1   (R0), [V0.B16, V1.B16]
+	VLD1.P 32(R1), [V2.B16, V3.B16]
+	VAND   V2.B16, V0.B16, V0.B16
+	VAND   V3.B16, V1.B16, V1.B16
+	VST1.P [V0.B16, V1.B16], 32(R0)
+	SUBS   $32, R2, R2
+	BNE    andLoop
+	RET
+
+// func orVec(dst, src *byte, n int)
+TEXT ·orVec(SB), NOSPLIT, $0-24
+	MOVD dst+0(FP), R0
+	MOVD src+8(FP), R1
+	MOVD n+16(FP), R2
+orLoop:
+	VLD1   (R0), [V0.B16, V1.B16]
+	VLD1.P 32(R1), [V2.B16, V3.B16]
+	VORR   V2.B16, V0.B16, V0.B16
+	VORR   V3.B16, V1.B16, V1.B16
+	VST1.P [V0.B16, V1.B16], 32(R0)
+	SUBS   $32, R2, R2
+	BNE    orLoop
+	RET
+
+// func xorVec(dst, src *byte, n int)
+TEXT ·xorVec(SB), NOSPLIT, $0-24
+	MOVD dst+0(FP), R0
+	MOVD src+8(FP), R1
+	MOVD n+16(FP), R2
+xorLoop:
+	VLD1   (R0), [V0.B16, V1.B16]
+	VLD1.P 32(R1), [V2.B16, V3.B16]
+	VEOR   V2.B16, V0.B16, V0.B16
+	VEOR   V3.B16, V1.B16, V1.B16
+	VST1.P [V0.B16, V1.B16], 32(R0)
+	SUBS   $32, R2, R2
+	BNE    xorLoop
+	RET
+
+// POPCOUNT adds the set bits of the bytes of V0 and V1 to R3. The bytes
+// count at most 16 bits each after the VADD, and their sum fits the
+// halfword VUADDLV leaves.
+#define POPCOUNT \
+	VCNT    V0.B16, V0.B16 \
+	VCNT    V1.B16, V1.B16 \
+	VADD    V1.B16, V0.B16, V0.B16 \
+	VUADDLV V0.B16, V4 \
+	VMOV    V4.H[0], R4 \
+	ADD     R4, R3, R3
+
+// func countVec(b *byte, n int) int
+TEXT ·countVec(SB), NOSPLIT, $0-24
+	MOVD b+0(FP), R0
+	MOVD n+8(FP), R1
+	MOVD $0, R3
+countLoop:
+	VLD1.P 32(R0), [V0.B16, V1.B16]
+	POPCOUNT
+	SUBS   $32, R1, R1
+	BNE    countLoop
+	MOVD   R3, ret+16(FP)
+	RET
+
+// func countDiffVec(a, b *byte, n int) int
+TEXT ·countDiffVec(SB), NOSPLIT, $0-32
+	MOVD a+0(FP), R0
+	MOVD b+8(FP), R1
+	MOVD n+16(FP), R2
+	MOVD $0, R3
+countDiffLoop:
+	VLD1.P 32(R0), [V0.B16, V1.B16]
+	VLD1.P 32(R1), [V2.B16, V3.B16]
+	VEOR   V2.B16, V0.B16, V0.B16
+	VEOR   V3.B16, V1.B16, V1.B16
+	POPCOUNT
+	SUBS   $32, R2, R2
+	BNE    countDiffLoop
+	MOVD   R3, ret+24(FP)
+	RET
+
+// func allVec(b *byte, n int, v byte) bool
+TEXT ·allVec(SB), NOSPLIT, $0-25
+	MOVD  b+0(FP), R0
+	MOVD  n+8(FP), R1
+	MOVBU v+16(FP), R2
+	VDUP  R2, V2.B16
+	MOVD  $0, R3
+allLoop:
+	VLD1.P 32(R0), [V0.B16, V1.B16]
+	VEOR   V2.B16, V0.B16, V0.B16
+	VEOR   V2.B16, V1.B16, V1.B16
+	VORR   V1.B16, V0.B16, V0.B16
+	VMOV   V0.D[0], R4
+	VMOV   V0.D[1], R5
+	ORR    R4, R5, R5
+	CBNZ   R5, allDone
+	SUBS   $32, R1, R1
+	BNE    allLoop
+	MOVD   $1, R3
+allDone:
+	MOVB R3, ret+24(FP)
+	RET
+
+// func fillVec(b *byte, n int, v byte)
+TEXT ·fillVec(SB), NOSPLIT, $0-17
+	MOVD  b+0(FP), R0
+	MOVD  n+8(FP), R1
+	MOVBU v+16(FP), R2
+	VDUP  R2, V0.B16
+	VDUP  R2, V1.B16
+fillLoop:
+	VST1.P [V0.B16, V1.B16], 32(R0)
+	SUBS   $32, R1, R1
+	BNE    fillLoop
+	RET
+
+// func reverseVec(dst, src *byte, n int)
+TEXT ·reverseVec(SB), NOSPLIT, $0-24
+	MOVD dst+0(FP), R0
+	MOVD src+8(FP), R1
+	MOVD n+16(FP), R2
+	// The blocks of src from the last one.
+	ADD  R2, R1, R1
+reverseLoop:
+	SUB    $32, R1, R1
+	VLD1   (R1), [V0.B16, V1.B16]
+	VRBIT  V0.B16, V0.B16
+	VRBIT  V1.B16, V1.B16
+	// Reverse the bytes of the halves, then swap the halves. The second
+	// register of the block goes first.
+	VREV64 V0.B16, V0.B16
+	VREV64 V1.B16, V1.B16
+	VEXT   $8, V1.B16, V1.B16, V2.B16
+	VEXT   $8, V0.B16, V0.B16, V3.B16
+	VST1.P [V2.B16, V3.B16], 32(R0)
+	SUBS   $32, R2, R2
+	BNE    reverseLoop
+	RET
+
+// func reverseBitsVec(b *byte, n int)
+TEXT ·reverseBitsVec(SB), NOSPLIT, $0-16
+	MOVD b+0(FP), R0
+	MOVD n+8(FP), R1
+reverseBitsLoop:
+	VLD1   (R0), [V0.B16, V1.B16]
+	VRBIT  V0.B16, V0.B16
+	VRBIT  V1.B16, V1.B16
+	VST1.P [V0.B16, V1.B16], 32(R0)
+	SUBS   $32, R1, R1
+	BNE    reverseBitsLoop
+	RET
@@ -0,0 +1,98 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build (amd64 || arm64) && !purego
+// +build amd64 arm64
+// +build !purego
+
+package bitmap
+
+// Implemented in simd_amd64.s and simd_arm64.s. The vector loops take a
+// positive multiple of 32 bytes, the leading bytes given by vector.
+
+func andVec(dst, src *byte, n int)
+func orVec(dst, src *byte, n int)
+func xorVec(dst, src *byte, n int)
+func countVec(b *byte, n int) int
+func countDiffVec(a, b *byte, n int) int
+func allVec(b *byte, n int, v byte) bool
+func fillVec(b *byte, n int, v byte)
+func reverseVec(dst, src *byte, n int)
+func reverseBitsVec(b *byte, n int)
+
+func and(dst, src []byte) {
+	v := vector(len(dst))
+	if v > 0 {
+		andVec(&dst[0], &src[0], v)
+	}
+	andWords(dst[v:], src[v:])
+}
+
+func or(dst, src []byte) {
+	v := vector(len(dst))
+	if v > 0 {
+		orVec(&dst[0], &src[0], v)
+	}
+	orWords(dst[v:], src[v:])
+}
+
+func xor(dst, src []byte) {
+	v := vector(len(dst))
+	if v > 0 {
+		xorVec(&dst[0], &src[0], v)
+	}
+	xorWords(dst[v:], src[v:])
+}
+
+func count(b []byte) int {
+	n := 0
+	v := vector(len(b))
+	if v > 0 {
+		n = countVec(&b[0], v)
+	}
+	return n + countWords(b[v:])
+}
+
+func countDiff(a, b []byte) int {
+	n := 0
+	v := vector(len(a))
+	if v > 0 {
+		n = countDiffVec(&a[0], &b[0], v)
+	}
+	return n + countDiffWords(a[v:], b[v:])
+}
+
+func all(b []byte, c byte) bool {
+	v := vector(len(b))
+	if v > 0 && !allVec(&b[0], v, c) {
+		return false
+	}
+	return allWords(b[v:], c)
+}
+
+func fill(b []byte, c byte) {
+	v := vector(len(b))
+	if v > 0 {
+		fillVec(&b[0], v, c)
+	}
+	fillWords(b[v:], c)
+}
+
+func reverse(dst, src []byte) {
+	n := len(dst)
+	v := vector(n)
+	// The head of dst takes the tail of src.
+	if v > 0 {
+		reverseVec(&dst[0], &src[n-v], v)
+	}
+	reverseWords(dst[v:], src[:n-v])
+}
+
+func reverseBits(b []byte) {
+	v := vector(len(b))
+	if v > 0 {
+		reverseBitsVec(&b[0], v)
+	}
+	reverseBitsTable(b[v:])
+}
@@ -0,0 +1,18 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build (!amd64 && !arm64) || purego
+// +build !amd64,!arm64 purego
+
+package bitmap
+
+func and(dst, src []byte)       { andWords(dst, src) }
+func or(dst, src []byte)        { orWords(dst, src) }
+func xor(dst, src []byte)       { xorWords(dst, src) }
+func count(b []byte) int        { return countWords(b) }
+func countDiff(a, b []byte) int { return countDiffWords(a, b) }
+func all(b []byte, v byte) bool { return allWords(b, v) }
+func fill(b []byte, v byte)     { fillWords(b, v) }
+func reverse(dst, src []byte)   { reverseWords(dst, src) }
+func reverseBits(b []byte)      { reverseBitsTable(b) }
@@ -0,0 +1,115 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bitmap
+
+import (
+	"bytes"
+	"math/bits"
+	"math/rand"
+	"testing"
+)
+
+func TestSIMD(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 7, 8, 9, 31, 32, 33, 63, 64, 100, 257} {
+		a, b := make([]byte, n), make([]byte, n+3)
+		r.Read(a)
+		r.Read(b)
+		want := make([]byte, n)
+		for _, op := range []struct {
+			name string
+			f    func(dst, src []byte)
+			g    func(x, y byte) byte
+		}{
+			{"And", And, func(x, y byte) byte { return x & y }},
+			{"Or", Or, func(x, y byte) byte { return x | y }},
+			{"Xor", Xor, func(x, y byte) byte { return x ^ y }},
+		} {
+			got := append([]byte(nil), a...)
+			op.f(got, b)
+			for i := range want {
+				want[i] = op.g(a[i], b[i])
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s of %d bytes: got %x, want %x", op.name, n, got, want)
+			}
+		}
+
+		wantN, wantD := 0, 0
+		for i := range a {
+			wantN += bits.OnesCount8(a[i])
+			wantD += bits.OnesCount8(a[i] ^ b[i])
+		}
+		if got := Count(a); got != wantN {
+			t.Errorf("Count of %d bytes: got %d, want %d", n, got, wantN)
+		}
+		if got := CountDiff(b, a); got != wantD {
+			t.Errorf("CountDiff of %d bytes: got %d, want %d", n, got, wantD)
+		}
+
+		for _, v := range []byte{0, 0xff, 0xa5} {
+			c := bytes.Repeat([]byte{v}, n)
+			if !All(c, v) {
+				t.Errorf("All of %d bytes %#x: false", n, v)
+			}
+			for i := range c {
+				c[i] ^= 0x10
+				if All(c, v) {
+					t.Errorf("All of %d bytes %#x, byte %d off: true", n, v, i)
+				}
+				c[i] ^= 0x10
+			}
+		}
+
+		got := append([]byte(nil), a...)
+		Fill(got, 0xa5)
+		if !bytes.Equal(got, bytes.Repeat([]byte{0xa5}, n)) {
+			t.Errorf("Fill of %d bytes: got %x", n, got)
+		}
+
+		got = make([]byte, n)
+		Reverse(got, a)
+		for i := range want {
+			want[i] = bits.Reverse8(a[n-1-i])
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Reverse of %d bytes: got %x, want %x", n, got, want)
+		}
+
+		got = append(got[:0], a...)
+		ReverseBits(got)
+		for i := range want {
+			want[i] = bits.Reverse8(a[i])
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReverseBits of %d bytes: got %x, want %x", n, got, want)
+		}
+	}
+}
+
+func BenchmarkXor(b *testing.B) {
+	dst, src := make([]byte, 4096), make([]byte, 4096)
+	b.SetBytes(4096)
+	for i := 0; i < b.N; i++ {
+		Xor(dst, src)
+	}
+}
+
+func BenchmarkCount(b *testing.B) {
+	buf := make([]byte, 4096)
+	rand.Read(buf)
+	b.SetBytes(4096)
+	for i := 0; i < b.N; i++ {
+		Count(buf)
+	}
+}
+
+func BenchmarkReverse(b *testing.B) {
+	dst, src := make([]byte, 4096), make([]byte, 4096)
+	b.SetBytes(4096)
+	for i := 0; i < b.N; i++ {
+		Reverse(dst, src)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package deflate is a small DEFLATE compressor whose output depends on its
+// input only, for encoders promising byte-identical files whatever the
+// version of Go: the output of compress/flate may change from one release
+// to the next.
+//
+// It looks for matches greedily along hash chains of bounded length and
+// codes them with the fixed Huffman codes, in a single block. That gives up
+// some compression, but packed bilevel rows are mostly long runs, which
+// the matches take well.
+package deflate
+
+import (
+	"encoding/binary"
+	"hash/adler32"
+	"math/bits"
+)
+
+const (
+	windowSize = 1 << 15
+	minMatch   = 3
+	maxMatch   = 258
+	hashBits   = 15
+	// maxChain is the number of earlier positions tried for a match.
+	maxChain = 64
+)
+
+// The bases and extra bits of the length codes, from 257, and of the
+// distance codes.
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+)
+
+// A code is a Huffman code with its bits reversed, as they are written.
+type code struct {
+	bits uint16
+	len  uint8
+}
+
+// fixedLit holds the fixed codes of the literal/length alphabet.
+var fixedLit [288]code
+
+func init() {
+	for v := range fixedLit {
+		var c, n int
+		switch {
+		case v < 144:
+			c, n = 0x30+v, 8
+		case v < 256:
+			c, n = 0x190+v-144, 9
+		case v < 280:
+			c, n = v-256, 7
+		default:
+			c, n = 0xc0+v-280, 8
+		}
+		fixedLit[v] = code{bits.Reverse16(uint16(c)) >> uint(16-n), uint8(n)}
+	}
+}
+
+// A writer writes bits LSB first.
+type writer struct {
+	out   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *writer) write(b uint64, n uint) {
+	w.acc |= b << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *writer) flush() {
+	if w.nbits > 0 {
+		w.out = append(w.out, byte(w.acc))
+	}
+	w.acc, w.nbits = 0, 0
+}
+
+func (w *writer) literal(b byte) {
+	c := fixedLit[b]
+	w.write(uint64(c.bits), uint(c.len))
+}
+
+func (w *writer) match(length, dist int) {
+	i := 0
+	for i+1 < len(lengthBase) && int(lengthBase[i+1]) <= length {
+		i++
+	}
+	c := fixedLit[257+i]
+	w.write(uint64(c.bits), uint(c.len))
+	w.write(uint64(length-int(lengthBase[i])), uint(lengthExtra[i]))
+	j := 0
+	for j+1 < len(distBase) && int(distBase[j+1]) <= dist {
+		j++
+	}
+	// The distance codes are all 5 bits long.
+	w.write(uint64(bits.Reverse8(uint8(j))>>3), 5)
+	w.write(uint64(dist-int(distBase[j])), uint(distExtra[j]))
+}
+
+func hash(b []byte) uint32 {
+	return (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 2654435761 >> (32 - hashBits)
+}
+
+// Append appends src compressed as a raw DEFLATE stream to dst.
+func Append(dst, src []byte) []byte {
+	w := writer{out: dst}
+	// The final block, of fixed codes.
+	w.write(1|1<<1, 3)
+	// head holds the last position+1 of each hash, prev the position+1
+	// before each position with the same hash, in a ring over the window.
+	var head [1 << hashBits]int32
+	var prev [windowSize]int32
+	insert := func(i int) {
+		if i+minMatch > len(src) {
+			return
+		}
+		h := hash(src[i:])
+		prev[i&(windowSize-1)] = head[h]
+		head[h] = int32(i + 1)
+	}
+	for i := 0; i < len(src); {
+		best, dist := 0, 0
+		if i+minMatch <= len(src) {
+			max := len(src) - i
+			if max > maxMatch {
+				max = maxMatch
+			}
+			p := int(head[hash(src[i:])]) - 1
+			for n := 0; n < maxChain && p >= 0 && i-p <= windowSize; n++ {
+				l := 0
+				for l < max && src[p+l] == src[i+l] {
+					l++
+				}
+				if l > best {
+					best, dist = l, i-p
+					if l == max {
+						break
+					}
+				}
+				next := int(prev[p&(windowSize-1)]) - 1
+				if next >= p {
+					// The ring slot was reused by a later position.
+					break
+				}
+				p = next
+			}
+		}
+		if best >= minMatch {
+			w.match(best, dist)
+			for j := 0; j < best; j++ {
+				insert(i + j)
+			}
+			i += best
+			continue
+		}
+		w.literal(src[i])
+		insert(i)
+		i++
+	}
+	// End of block.
+	c := fixedLit[256]
+	w.write(uint64(c.bits), uint(c.len))
+	w.flush()
+	return w.out
+}
+
+// AppendZlib appends src compressed as a zlib stream to dst.
+func AppendZlib(dst, src []byte) []byte {
+	// Deflate with a 32K window, the fastest algorithm flagged.
+	dst = append(dst, 0x78, 0x01)
+	dst = Append(dst, src)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], adler32.Checksum(src))
+	return append(dst, sum[:]...)
+}
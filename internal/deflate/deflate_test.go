@@ -0,0 +1,77 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package deflate
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rnd.Read(random)
+	runs := make([]byte, 100000)
+	for i := 0; i < len(runs); {
+		n := 1 + rnd.Intn(600)
+		v := byte(0)
+		if rnd.Intn(2) == 0 {
+			v = 0xff
+		}
+		for j := 0; j < n && i < len(runs); j++ {
+			runs[i] = v
+			i++
+		}
+	}
+	// A block repeated just within and just beyond the window.
+	far := make([]byte, 70000)
+	rnd.Read(far[:300])
+	copy(far[32768:], far[:300])
+	copy(far[65537:], far[:300])
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one", []byte{7}},
+		{"short", []byte("abcabcabcabcx")},
+		{"zeros", make([]byte, 100000)},
+		{"random", random},
+		{"runs", runs},
+		{"far", far},
+	} {
+		z := Append(nil, tc.data)
+		got, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(z)))
+		if err != nil || !bytes.Equal(got, tc.data) {
+			t.Errorf("%s: deflate round trip failed: %v", tc.name, err)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(AppendZlib([]byte{1, 2}, tc.data)[2:]))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err = ioutil.ReadAll(zr)
+		if err != nil || !bytes.Equal(got, tc.data) {
+			t.Errorf("%s: zlib round trip failed: %v", tc.name, err)
+		}
+		if len(tc.data) >= 100000 && len(z) > len(tc.data)/20 {
+			t.Errorf("%s: %d bytes compressed to %d", tc.name, len(tc.data), len(z))
+		}
+	}
+}
+
+// The output is part of the format of the encoders using the package: it
+// must not change.
+func TestStable(t *testing.T) {
+	got := AppendZlib(nil, []byte("abcabcabcabcx\x00\x00\x00\x00\x00\x00\x00\xff"))
+	want := []byte{0x78, 0x01, 0x4b, 0x4c, 0x4a, 0x86, 0xa3, 0x0a, 0x06, 0x08, 0xf8, 0x0f, 0x00, 0x4c, 0x78, 0x06, 0x10}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %#v", got)
+	}
+}
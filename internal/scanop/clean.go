@@ -0,0 +1,91 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scanop
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// Despeckle removes the groups of connected black pixels of m of at most
+// size pixels, into an image from p, and returns the number of groups
+// removed. Diagonal neighbours are connected.
+func Despeckle(m *img1b.Image, size int, p *img1b.Pool) (*img1b.Image, int) {
+	d := BlackBits(m, p)
+	w, h := d.Rect.Dx(), d.Rect.Dy()
+	seen := make([]bool, w*h)
+	var comp, stack []image.Point
+	n := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if seen[y*w+x] || !bitmap.Bit(d.Pix, d.Stride, d.Rect, x, y) {
+				continue
+			}
+			comp, stack = Component(d, x, y, seen, comp[:0], stack)
+			if len(comp) <= size {
+				for _, p := range comp {
+					Clear(d, p.X, p.Y)
+				}
+				n++
+			}
+		}
+	}
+	return d, n
+}
+
+// RemoveBorder removes the groups of connected black pixels touching the
+// edges of m, into an image from p, and returns the number of pixels
+// removed. Diagonal neighbours are connected.
+func RemoveBorder(m *img1b.Image, p *img1b.Pool) (*img1b.Image, int) {
+	d := BlackBits(m, p)
+	w, h := d.Rect.Dx(), d.Rect.Dy()
+	seen := make([]bool, w*h)
+	var comp, stack []image.Point
+	n := 0
+	edge := func(x, y int) {
+		if seen[y*w+x] || !bitmap.Bit(d.Pix, d.Stride, d.Rect, x, y) {
+			return
+		}
+		comp, stack = Component(d, x, y, seen, comp[:0], stack)
+		for _, p := range comp {
+			Clear(d, p.X, p.Y)
+		}
+		n += len(comp)
+	}
+	for x := 0; x < w; x++ {
+		edge(x, 0)
+		edge(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		edge(0, y)
+		edge(w-1, y)
+	}
+	return d, n
+}
+
+// Component appends to comp the pixels of the group of connected black
+// pixels of d holding (x, y), marking them seen. The stack is scratch
+// space; both slices are returned for reuse.
+func Component(d *img1b.Image, x, y int, seen []bool, comp, stack []image.Point) ([]image.Point, []image.Point) {
+	w := d.Rect.Dx()
+	seen[y*w+x] = true
+	stack = append(stack[:0], image.Pt(x, y))
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		comp = append(comp, p)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				q := p.Add(image.Pt(dx, dy))
+				if bitmap.Bit(d.Pix, d.Stride, d.Rect, q.X, q.Y) && !seen[q.Y*w+q.X] {
+					seen[q.Y*w+q.X] = true
+					stack = append(stack, q)
+				}
+			}
+		}
+	}
+	return comp, stack
+}
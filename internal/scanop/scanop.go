@@ -0,0 +1,81 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scanop implements the operations of package scan with their
+// images taken from a given pool, so that package pipeline can have them
+// use its Scratch and package scan its own pool. A nil pool allocates
+// every image.
+//
+// The images made are at the origin with the palette {white, black}.
+package scanop
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// Threshold converts m to a bilevel image from p, black where the
+// luminance is below level (0 to 256).
+func Threshold(m image.Image, level int, p *img1b.Pool) *img1b.Image {
+	b := m.Bounds()
+	d := p.Get(image.Rect(0, 0, b.Dx(), b.Dy()), bitmap.Palette())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			g := color.GrayModel.Convert(m.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			if int(g.Y) < level {
+				d.Pix[y*d.Stride+x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+	}
+	return d
+}
+
+// Dither converts m to a bilevel image from p with Floyd-Steinberg error
+// diffusion.
+func Dither(m image.Image, p *img1b.Pool) *img1b.Image {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	d := p.Get(image.Rect(0, 0, w, h), bitmap.Palette())
+	// The errors carried to the current and the next row, with a column of
+	// margin on both sides.
+	cur := make([]int, w+2)
+	next := make([]int, w+2)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g := color.GrayModel.Convert(m.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			v := int(g.Y) + cur[x+1]/16
+			e := v
+			if v < 128 {
+				d.Pix[y*d.Stride+x>>3] |= 0x80 >> uint(x&7)
+			} else {
+				e = v - 255
+			}
+			cur[x+2] += 7 * e
+			next[x] += 3 * e
+			next[x+1] += 5 * e
+			next[x+2] += e
+		}
+		cur, next = next, cur
+		for i := range next {
+			next[i] = 0
+		}
+	}
+	return d
+}
+
+// BlackBits returns a copy of m at the origin with black pixels set and
+// zero padding, with an image from p.
+func BlackBits(m *img1b.Image, p *img1b.Pool) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	d := p.Get(image.Rect(0, 0, w, h), bitmap.Palette())
+	bitmap.CopyBlack(d.Pix, d.Stride, m.Pix, m.Stride, w, h, m.Palette)
+	return d
+}
+
+// Clear makes the pixel at (x, y) of an image made by BlackBits white.
+func Clear(m *img1b.Image, x, y int) {
+	m.Pix[y*m.Stride+x>>3] &^= 0x80 >> uint(x&7)
+}
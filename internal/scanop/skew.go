@@ -0,0 +1,103 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scanop
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"math"
+	"sort"
+)
+
+// MaxSkew is the largest skew angle in degrees found by Skew.
+const MaxSkew = 10
+
+// Skew estimates the angle in degrees by which the lines of text of m are
+// rotated clockwise, with its temporary image from p. It picks the angle
+// whose projection profile, the number of black pixels along each line at
+// that angle, has the sharpest peaks.
+func Skew(m *img1b.Image, p *img1b.Pool) float64 {
+	s := BlackBits(m, p)
+	defer p.Put(s)
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	// A sample of the black pixels, the bottom ones of vertical runs, which
+	// keeps the baselines and fewer of the other pixels.
+	var pts []image.Point
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if bitmap.Bit(s.Pix, s.Stride, s.Rect, x, y) && !bitmap.Bit(s.Pix, s.Stride, s.Rect, x, y+1) {
+				pts = append(pts, image.Pt(x, y))
+			}
+		}
+	}
+	const maxPts = 50000
+	if len(pts) > maxPts {
+		step := float64(len(pts)) / maxPts
+		for i := 0; i < maxPts; i++ {
+			pts[i] = pts[int(float64(i)*step)]
+		}
+		pts = pts[:maxPts]
+	}
+	if len(pts) == 0 {
+		return 0
+	}
+	score := func(deg float64) float64 {
+		sin, cos := math.Sincos(deg * math.Pi / 180)
+		bins := make(map[int]int)
+		for _, p := range pts {
+			bins[int(math.Floor(float64(p.Y)*cos-float64(p.X)*sin))]++
+		}
+		var sum float64
+		for _, n := range bins {
+			sum += float64(n) * float64(n)
+		}
+		return sum
+	}
+	best, bestScore := 0.0, score(0)
+	for _, step := range []float64{0.5, 0.1, 0.02} {
+		lo, hi := best-10*step, best+10*step
+		if step == 0.5 {
+			lo, hi = -MaxSkew, MaxSkew
+		}
+		var cand []float64
+		for a := lo; a <= hi+step/2; a += step {
+			cand = append(cand, a)
+		}
+		sort.Float64s(cand)
+		for _, a := range cand {
+			if a < -MaxSkew || a > MaxSkew {
+				continue
+			}
+			if sc := score(a); sc > bestScore {
+				best, bestScore = a, sc
+			}
+		}
+	}
+	return best
+}
+
+// Rotate rotates m counter-clockwise by deg degrees about its center,
+// keeping its size, with the images from p. Uncovered pixels are white.
+func Rotate(m *img1b.Image, deg float64, p *img1b.Pool) *img1b.Image {
+	s := BlackBits(m, p)
+	defer p.Put(s)
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	d := p.Get(image.Rect(0, 0, w, h), bitmap.Palette())
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	cx, cy := float64(w)/2, float64(h)/2
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// The source pixel turned onto the center of (x, y).
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			sx := cx + dx*cos - dy*sin
+			sy := cy + dx*sin + dy*cos
+			if bitmap.Bit(s.Pix, s.Stride, s.Rect, int(math.Floor(sx)), int(math.Floor(sy))) {
+				d.Pix[y*d.Stride+x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package img1b
+
+import (
+	"image"
+	"iter"
+)
+
+// All returns an iterator over the pixels of p, row by row, yielding their
+// coordinates and color indices.
+func (p *Image) All() iter.Seq2[image.Point, uint8] {
+	return p.eachPixel
+}
+
+// Rows returns an iterator over the rows of p, yielding their y and the
+// (Dx()+7)/8 bytes of Pix they take. The bits of the last byte past the
+// right edge are not part of the image and may be anything. Code writing to the
+// rows of a copy-on-write image has to call Unshare first.
+func (p *Image) Rows() iter.Seq2[int, []byte] {
+	return p.eachRow
+}
+
+// RunsAll returns an iterator over the runs of p, row by row and left to
+// right. The runs of a row alternate in color index and cover it.
+func (p *Image) RunsAll() iter.Seq[Run] {
+	return p.eachRun
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	pal := color.Palette{color.White, color.Black}
+	rnd := rand.New(rand.NewSource(1))
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, 0, 3),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 8, 2),
+		image.Rect(0, 0, 13, 4),
+		image.Rect(-5, 3, 60, 9),
+	} {
+		m := New(r, pal)
+		for i := range m.Pix {
+			// Long runs as well as short ones.
+			switch rnd.Intn(3) {
+			case 0:
+				m.Pix[i] = byte(rnd.Intn(256))
+			case 1:
+				m.Pix[i] = 0xff
+			}
+		}
+
+		var pixels []Run
+		for pt, c := range m.All() {
+			if want := m.ColorIndexAt(pt.X, pt.Y); c != want {
+				t.Fatalf("%v: All: %v is %d, want %d", r, pt, c, want)
+			}
+			// Pixels collect into runs to check RunsAll with.
+			if n := len(pixels); n > 0 && pixels[n-1].Y == pt.Y && pixels[n-1].Index == c {
+				pixels[n-1].X1++
+			} else {
+				pixels = append(pixels, Run{Y: pt.Y, X0: pt.X, X1: pt.X + 1, Index: c})
+			}
+		}
+		if n := len(pixels); n != 0 && r.Dx()*r.Dy() == 0 {
+			t.Errorf("%v: All yields %d pixels", r, n)
+		}
+
+		var runs []Run
+		for run := range m.RunsAll() {
+			runs = append(runs, run)
+		}
+		if !reflect.DeepEqual(runs, pixels) {
+			t.Errorf("%v: RunsAll:\ngot  %v\nwant %v", r, runs, pixels)
+		}
+
+		y := r.Min.Y
+		for ry, row := range m.Rows() {
+			if ry != y {
+				t.Errorf("%v: Rows yields y %d, want %d", r, ry, y)
+			}
+			if want := (r.Dx() + 7) / 8; len(row) != want {
+				t.Errorf("%v: row %d has %d bytes, want %d", r, ry, len(row), want)
+			}
+			y++
+		}
+		if y != r.Max.Y {
+			t.Errorf("%v: Rows stops at %d", r, y)
+		}
+	}
+}
+
+func TestIteratorsBreak(t *testing.T) {
+	m := New(image.Rect(0, 0, 20, 20), color.Palette{color.White, color.Black})
+	n := 0
+	for range m.All() {
+		if n++; n == 5 {
+			break
+		}
+	}
+	for range m.RunsAll() {
+		if n++; n == 10 {
+			break
+		}
+	}
+	for range m.Rows() {
+		if n++; n == 15 {
+			break
+		}
+	}
+	if n != 15 {
+		t.Errorf("n = %d, want 15", n)
+	}
+}
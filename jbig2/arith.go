@@ -0,0 +1,287 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+// qe is a row of the probability estimation table, as per ITU-T T.88
+// table E.1.
+type qe struct {
+	qe         uint32
+	nmps, nlps uint8
+	switchMPS  bool
+}
+
+var qeTable = [...]qe{
+	{0x5601, 1, 1, true},
+	{0x3401, 2, 6, false},
+	{0x1801, 3, 9, false},
+	{0x0ac1, 4, 12, false},
+	{0x0521, 5, 29, false},
+	{0x0221, 38, 33, false},
+	{0x5601, 7, 6, true},
+	{0x5401, 8, 14, false},
+	{0x4801, 9, 14, false},
+	{0x3801, 10, 14, false},
+	{0x3001, 11, 17, false},
+	{0x2401, 12, 18, false},
+	{0x1c01, 13, 20, false},
+	{0x1601, 29, 21, false},
+	{0x5601, 15, 14, true},
+	{0x5401, 16, 14, false},
+	{0x5101, 17, 15, false},
+	{0x4801, 18, 16, false},
+	{0x3801, 19, 17, false},
+	{0x3401, 20, 18, false},
+	{0x3001, 21, 19, false},
+	{0x2801, 22, 19, false},
+	{0x2401, 23, 20, false},
+	{0x2201, 24, 21, false},
+	{0x1c01, 25, 22, false},
+	{0x1801, 26, 23, false},
+	{0x1601, 27, 24, false},
+	{0x1401, 28, 25, false},
+	{0x1201, 29, 26, false},
+	{0x1101, 30, 27, false},
+	{0x0ac1, 31, 28, false},
+	{0x09c1, 32, 29, false},
+	{0x08a1, 33, 30, false},
+	{0x0521, 34, 31, false},
+	{0x0441, 35, 32, false},
+	{0x02a1, 36, 33, false},
+	{0x0221, 37, 34, false},
+	{0x0141, 38, 35, false},
+	{0x0111, 39, 36, false},
+	{0x0085, 40, 37, false},
+	{0x0049, 41, 38, false},
+	{0x0025, 42, 39, false},
+	{0x0015, 43, 40, false},
+	{0x0009, 44, 41, false},
+	{0x0005, 45, 42, false},
+	{0x0001, 45, 43, false},
+	{0x5601, 46, 46, false},
+}
+
+// A context holds the adaptive state of an arithmetic coding context: the
+// index into qeTable shifted left by one and the MPS value in the low bit.
+type context uint8
+
+// arithDecoder is the MQ decoder of ITU-T T.88 annex E.3. Reading past the
+// end of the data yields 1 bits, as a marker would.
+type arithDecoder struct {
+	data []byte
+	bp   int
+	c    uint32 // the C register, with Chigh in the upper half
+	a    uint32
+	ct   int
+	over int // bytes read past the end or at a marker
+}
+
+func newArithDecoder(data []byte) *arithDecoder {
+	d := &arithDecoder{data: data}
+	d.c = uint32(d.byteAt(0)) << 16
+	d.byteIn()
+	d.c <<= 7
+	d.ct -= 7
+	d.a = 0x8000
+	return d
+}
+
+func (d *arithDecoder) byteAt(i int) byte {
+	if i < len(d.data) {
+		return d.data[i]
+	}
+	return 0xff
+}
+
+// exhausted reports whether the decoder has read well past the end of the
+// data, which valid data never needs.
+func (d *arithDecoder) exhausted() bool {
+	return d.over > 64
+}
+
+// byteIn is the BYTEIN procedure of figure E.19.
+func (d *arithDecoder) byteIn() {
+	if d.byteAt(d.bp) == 0xff {
+		if d.byteAt(d.bp+1) > 0x8f {
+			d.over++
+			d.c += 0xff00
+			d.ct = 8
+		} else {
+			d.bp++
+			d.c += uint32(d.byteAt(d.bp)) << 9
+			d.ct = 7
+		}
+	} else {
+		d.bp++
+		d.c += uint32(d.byteAt(d.bp)) << 8
+		d.ct = 8
+	}
+}
+
+// decode is the DECODE procedure of figure E.15.
+func (d *arithDecoder) decode(cx *context) int {
+	q := &qeTable[*cx>>1]
+	mps := int(*cx & 1)
+	d.a -= q.qe
+	var bit int
+	if d.c>>16 < q.qe {
+		// LPS_EXCHANGE.
+		if d.a < q.qe {
+			bit = mps
+			*cx = context(q.nmps<<1 | uint8(mps))
+		} else {
+			bit = 1 - mps
+			if q.switchMPS {
+				mps = bit
+			}
+			*cx = context(q.nlps<<1 | uint8(mps))
+		}
+		d.a = q.qe
+	} else {
+		d.c -= q.qe << 16
+		if d.a&0x8000 != 0 {
+			return mps
+		}
+		// MPS_EXCHANGE.
+		if d.a < q.qe {
+			bit = 1 - mps
+			if q.switchMPS {
+				mps = bit
+			}
+			*cx = context(q.nlps<<1 | uint8(mps))
+		} else {
+			bit = mps
+			*cx = context(q.nmps<<1 | uint8(mps))
+		}
+	}
+	// RENORMD.
+	for {
+		if d.ct == 0 {
+			d.byteIn()
+		}
+		d.a <<= 1
+		d.c <<= 1
+		d.ct--
+		if d.a&0x8000 != 0 {
+			break
+		}
+	}
+	return bit
+}
+
+// arithEncoder is the MQ encoder of ITU-T T.88 annex E.2.
+type arithEncoder struct {
+	buf     []byte
+	c       uint32
+	a       uint32
+	ct      int
+	b       byte
+	started bool // the first output byte precedes the data and is dropped
+}
+
+func newArithEncoder() *arithEncoder {
+	return &arithEncoder{a: 0x8000, ct: 12}
+}
+
+// emit writes the byte buffer.
+func (e *arithEncoder) emit() {
+	if e.started {
+		e.buf = append(e.buf, e.b)
+	}
+	e.started = true
+}
+
+// byteOut is the BYTEOUT procedure of figure E.9.
+func (e *arithEncoder) byteOut() {
+	if e.b == 0xff {
+		e.emit()
+		e.b = byte(e.c >> 20)
+		e.c &= 0xfffff
+		e.ct = 7
+		return
+	}
+	if e.c >= 0x8000000 {
+		// Propagate the carry.
+		e.b++
+		if e.b == 0xff {
+			e.c &= 0x7ffffff
+			e.emit()
+			e.b = byte(e.c >> 20)
+			e.c &= 0xfffff
+			e.ct = 7
+			return
+		}
+	}
+	e.emit()
+	e.b = byte(e.c >> 19)
+	e.c &= 0x7ffff
+	e.ct = 8
+}
+
+// renorm is the RENORME procedure of figure E.8.
+func (e *arithEncoder) renorm() {
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			break
+		}
+	}
+}
+
+// encode is the ENCODE procedure of figure E.3.
+func (e *arithEncoder) encode(cx *context, bit int) {
+	q := &qeTable[*cx>>1]
+	mps := int(*cx & 1)
+	e.a -= q.qe
+	if bit == mps {
+		// CODEMPS.
+		if e.a&0x8000 != 0 {
+			e.c += q.qe
+			return
+		}
+		if e.a < q.qe {
+			e.a = q.qe
+		} else {
+			e.c += q.qe
+		}
+		*cx = context(q.nmps<<1 | uint8(mps))
+	} else {
+		// CODELPS.
+		if e.a < q.qe {
+			e.c += q.qe
+		} else {
+			e.a = q.qe
+		}
+		if q.switchMPS {
+			mps = 1 - mps
+		}
+		*cx = context(q.nlps<<1 | uint8(mps))
+	}
+	e.renorm()
+}
+
+// flush is the FLUSH procedure of figure E.11. It terminates the data with
+// the 0xffac marker and returns it.
+func (e *arithEncoder) flush() []byte {
+	// SETBITS.
+	t := e.c + e.a
+	e.c |= 0xffff
+	if e.c >= t {
+		e.c -= 0x8000
+	}
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.emit()
+	if e.b != 0xff {
+		e.buf = append(e.buf, 0xff)
+	}
+	return append(e.buf, 0xac)
+}
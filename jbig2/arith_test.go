@@ -0,0 +1,79 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bytes"
+	"testing"
+)
+
+// The test sequence of ITU-T T.88 annex H.2.
+var (
+	arithPlain = []byte{
+		0x00, 0x02, 0x00, 0x51, 0x00, 0x00, 0x00, 0xc0,
+		0x03, 0x52, 0x87, 0x2a, 0xaa, 0xaa, 0xaa, 0xaa,
+		0x82, 0xc0, 0x20, 0x00, 0xfc, 0xd7, 0x9e, 0xf6,
+		0xbf, 0x7f, 0xed, 0x90, 0x4f, 0x46, 0xa3, 0xbf,
+	}
+	arithCoded = []byte{
+		0x84, 0xc7, 0x3b, 0xfc, 0xe1, 0xa1, 0x43, 0x04,
+		0x02, 0x20, 0x00, 0x00, 0x41, 0x0d, 0xbb, 0x86,
+		0xf4, 0x31, 0x7f, 0xff, 0x88, 0xff, 0x37, 0x47,
+		0x1a, 0xdb, 0x6a, 0xdf, 0xff, 0xac,
+	}
+)
+
+func TestArithDecoder(t *testing.T) {
+	d := newArithDecoder(arithCoded)
+	var cx context
+	got := make([]byte, len(arithPlain))
+	for i := range got {
+		for j := 0; j < 8; j++ {
+			got[i] = got[i]<<1 | byte(d.decode(&cx))
+		}
+	}
+	if !bytes.Equal(got, arithPlain) {
+		t.Errorf("got  % x\nwant % x", got, arithPlain)
+	}
+}
+
+func TestArithEncoder(t *testing.T) {
+	e := newArithEncoder()
+	var cx context
+	for _, c := range arithPlain {
+		for j := 7; j >= 0; j-- {
+			e.encode(&cx, int(c>>uint(j))&1)
+		}
+	}
+	if got := e.flush(); !bytes.Equal(got, arithCoded) {
+		t.Errorf("got  % x\nwant % x", got, arithCoded)
+	}
+}
+
+func TestInt(t *testing.T) {
+	values := []int{0, 1, -1, 3, 4, 19, 20, -83, 84, 339, 340, 4435, 4436, 1 << 20, -(1 << 20), oob, 7}
+	var cx intContexts
+	e := newArithEncoder()
+	for _, v := range values {
+		e.encodeInt(&cx, v)
+	}
+	idcx := make([]context, 2<<5)
+	for i := 0; i < 32; i++ {
+		e.encodeID(idcx, 5, i)
+	}
+	d := newArithDecoder(e.flush())
+	cx = intContexts{}
+	for _, want := range values {
+		if got := d.decodeInt(&cx); got != want {
+			t.Errorf("got %d, want %d", got, want)
+		}
+	}
+	idcx = make([]context, 2<<5)
+	for i := 0; i < 32; i++ {
+		if got := d.decodeID(idcx, 5); got != i {
+			t.Errorf("ID: got %d, want %d", got, i)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"sort"
+)
+
+// A component is a connected component of black pixels.
+type component struct {
+	r image.Rectangle
+	m *img1b.Image // the pixels of the component only, at the origin
+}
+
+// pixelRun is a horizontal run of black pixels.
+type pixelRun struct {
+	y, x0, x1 int
+	parent    int
+}
+
+// components returns the 8-connected components of the set pixels of m,
+// whose padding bits must be clear, sorted by their top left corner.
+func components(m *img1b.Image) []component {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	var runs []pixelRun
+	find := func(i int) int {
+		for runs[i].parent != i {
+			runs[i].parent = runs[runs[i].parent].parent
+			i = runs[i].parent
+		}
+		return i
+	}
+	prev := 0 // first run of the previous row
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride:][:(w+7)/8]
+		cur := len(runs)
+		for x := 0; x < w; {
+			if row[x>>3]<<uint(x&7) == 0 {
+				x = x&^7 + 8
+				continue
+			}
+			if pixel(row, x, w) == 0 {
+				x++
+				continue
+			}
+			x0 := x
+			for x < w && pixel(row, x, w) == 1 {
+				x++
+			}
+			i := len(runs)
+			runs = append(runs, pixelRun{y, x0, x, i})
+			// Join the runs of the previous row touching this one,
+			// diagonally included.
+			for j := prev; j < cur; j++ {
+				if runs[j].x1 < x0 || runs[j].x0 > x {
+					continue
+				}
+				if a, b := find(i), find(j); a != b {
+					runs[a].parent = b
+				}
+			}
+		}
+		prev = cur
+	}
+
+	index := make(map[int]int)
+	var comps []component
+	for i := range runs {
+		root := find(i)
+		r := image.Rect(runs[i].x0, runs[i].y, runs[i].x1, runs[i].y+1)
+		if c, ok := index[root]; ok {
+			comps[c].r = comps[c].r.Union(r)
+		} else {
+			index[root] = len(comps)
+			comps = append(comps, component{r: r})
+		}
+	}
+	for i := range comps {
+		comps[i].m = img1b.New(image.Rect(0, 0, comps[i].r.Dx(), comps[i].r.Dy()), palette())
+	}
+	for i := range runs {
+		c := &comps[index[find(i)]]
+		row := c.m.Pix[(runs[i].y-c.r.Min.Y)*c.m.Stride:]
+		for x := runs[i].x0 - c.r.Min.X; x < runs[i].x1-c.r.Min.X; x++ {
+			row[x>>3] |= 0x80 >> uint(x&7)
+		}
+	}
+	sort.Slice(comps, func(i, j int) bool {
+		a, b := comps[i].r.Min, comps[j].r.Min
+		return a.Y < b.Y || a.Y == b.Y && a.X < b.X
+	})
+	return comps
+}
+
+// mismatch returns the number of differing pixels of two bitmaps of the
+// same size, or a number above limit once it is exceeded.
+func mismatch(a, b *img1b.Image, limit int) int {
+	n := 0
+	rowBytes := (a.Rect.Dx() + 7) / 8
+	for y := 0; y < a.Rect.Dy(); y++ {
+		n += bitmap.CountDiff(a.Pix[y*a.Stride:][:rowBytes], b.Pix[y*b.Stride:][:rowBytes])
+		if n > limit {
+			break
+		}
+	}
+	return n
+}
+
+// classify assigns the components to symbols. A component matches a symbol
+// of the same size if at most the given fraction of its pixels differ; the
+// first component of a class becomes its symbol. It returns the symbols and
+// the symbol index of each component.
+func classify(comps []component, threshold float64) ([]*img1b.Image, []int) {
+	var syms []*img1b.Image
+	ids := make([]int, len(comps))
+	bySize := make(map[image.Point][]int)
+	for i, c := range comps {
+		size := c.r.Size()
+		limit := int(threshold * float64(size.X*size.Y))
+		ids[i] = -1
+		for _, id := range bySize[size] {
+			if mismatch(c.m, syms[id], limit) <= limit {
+				ids[i] = id
+				break
+			}
+		}
+		if ids[i] < 0 {
+			ids[i] = len(syms)
+			bySize[size] = append(bySize[size], len(syms))
+			syms = append(syms, c.m)
+		}
+	}
+	return syms, ids
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// palette returns the palette of decoded images: set bits are black.
+func palette() color.Palette {
+	return color.Palette{color.White, color.Black}
+}
+
+// newBitmap returns a new w×h bitmap allocated within l.
+func newBitmap(l *img1b.Limits, w, h int) (*img1b.Image, error) {
+	if w < 0 || h < 0 {
+		return nil, UnsupportedError("bitmap size")
+	}
+	return l.New(image.Rect(0, 0, w, h), palette())
+}
+
+// defaultLimits bounds the bitmaps of a Decoder without Limits, to guard
+// against bogus dimensions.
+var defaultLimits = &img1b.Limits{MaxPixels: maxField}
+
+// maxField bounds the sizes, offsets and counts read from segments, so
+// that they fit in an int.
+const maxField = 1 << 30
+
+// genericParams are the parameters of the generic region decoding
+// procedure, as per ITU-T T.88 table 2.
+type genericParams struct {
+	mmr      bool
+	template int
+	tpgdon   bool
+	at       [4]image.Point // adaptive template pixels
+	limits   *img1b.Limits
+}
+
+// numContexts returns the number of contexts used by a template.
+func numContexts(template int) int {
+	switch template {
+	case 0:
+		return 1 << 16
+	case 1:
+		return 1 << 13
+	}
+	return 1 << 10
+}
+
+// sltpContexts are the contexts used to decode the SLTP bit, as per
+// ITU-T T.88 figures 8 to 11.
+var sltpContexts = [4]int{0x9b25, 0x0795, 0x00e5, 0x0195}
+
+// pixel returns the pixel at x of row, which is 0 outside of the bitmap.
+func pixel(row []byte, x, w int) int {
+	if row == nil || x < 0 || x >= w {
+		return 0
+	}
+	return int(row[x>>3]>>uint(7-x&7)) & 1
+}
+
+// genericRow is a row of the bitmap being decoded with its two
+// predecessors, nil outside of the bitmap.
+type genericRow struct {
+	m          *img1b.Image
+	w          int
+	y          int
+	r0, r1, r2 []byte // rows y, y-1 and y-2
+}
+
+func (g *genericRow) row(y int) []byte {
+	if y < 0 || y >= g.m.Rect.Max.Y {
+		return nil
+	}
+	return g.m.Pix[y*g.m.Stride:]
+}
+
+// at returns the pixel at offset (dx, dy) from (x, g.y).
+func (g *genericRow) at(x int, p image.Point) int {
+	var row []byte
+	switch p.Y {
+	case 0:
+		row = g.r0
+	case -1:
+		row = g.r1
+	case -2:
+		row = g.r2
+	default:
+		row = g.row(g.y + p.Y)
+	}
+	return pixel(row, x+p.X, g.w)
+}
+
+// context returns the context of the pixel at x, as per ITU-T T.88
+// figures 3 to 6. The bit positions of the pixels follow the order in which
+// the standard lists them.
+func (g *genericRow) context(x int, p *genericParams) int {
+	r0, r1, r2, w := g.r0, g.r1, g.r2, g.w
+	switch p.template {
+	case 0:
+		return pixel(r0, x-1, w) | pixel(r0, x-2, w)<<1 | pixel(r0, x-3, w)<<2 |
+			pixel(r0, x-4, w)<<3 | g.at(x, p.at[0])<<4 |
+			pixel(r1, x+2, w)<<5 | pixel(r1, x+1, w)<<6 | pixel(r1, x, w)<<7 |
+			pixel(r1, x-1, w)<<8 | pixel(r1, x-2, w)<<9 | g.at(x, p.at[1])<<10 |
+			g.at(x, p.at[2])<<11 | pixel(r2, x+1, w)<<12 | pixel(r2, x, w)<<13 |
+			pixel(r2, x-1, w)<<14 | g.at(x, p.at[3])<<15
+	case 1:
+		return pixel(r0, x-1, w) | pixel(r0, x-2, w)<<1 | pixel(r0, x-3, w)<<2 |
+			g.at(x, p.at[0])<<3 |
+			pixel(r1, x+2, w)<<4 | pixel(r1, x+1, w)<<5 | pixel(r1, x, w)<<6 |
+			pixel(r1, x-1, w)<<7 | pixel(r1, x-2, w)<<8 |
+			pixel(r2, x+2, w)<<9 | pixel(r2, x+1, w)<<10 | pixel(r2, x, w)<<11 |
+			pixel(r2, x-1, w)<<12
+	case 2:
+		return pixel(r0, x-1, w) | pixel(r0, x-2, w)<<1 | g.at(x, p.at[0])<<2 |
+			pixel(r1, x+1, w)<<3 | pixel(r1, x, w)<<4 | pixel(r1, x-1, w)<<5 |
+			pixel(r1, x-2, w)<<6 |
+			pixel(r2, x+1, w)<<7 | pixel(r2, x, w)<<8 | pixel(r2, x-1, w)<<9
+	}
+	return pixel(r0, x-1, w) | pixel(r0, x-2, w)<<1 | pixel(r0, x-3, w)<<2 |
+		pixel(r0, x-4, w)<<3 | g.at(x, p.at[0])<<4 |
+		pixel(r1, x+1, w)<<5 | pixel(r1, x, w)<<6 | pixel(r1, x-1, w)<<7 |
+		pixel(r1, x-2, w)<<8 | pixel(r1, x-3, w)<<9
+}
+
+// decodeGenericArith decodes a w×h arithmetic coded generic region, as per
+// ITU-T T.88 section 6.2.5.7. The contexts in cx are updated in place, so
+// they can be shared with following regions.
+func decodeGenericArith(ad *arithDecoder, cx []context, w, h int, p *genericParams) (*img1b.Image, error) {
+	m, err := newBitmap(p.limits, w, h)
+	if err != nil {
+		return nil, err
+	}
+	g := genericRow{m: m, w: w}
+	sltp := sltpContexts[p.template]
+	ltp := 0
+	rowBytes := (w + 7) / 8
+	for y := 0; y < h; y++ {
+		if ad.exhausted() {
+			return nil, errTruncated
+		}
+		g.y = y
+		g.r0, g.r1, g.r2 = g.row(y), g.row(y-1), g.row(y-2)
+		if p.tpgdon {
+			ltp ^= ad.decode(&cx[sltp])
+			if ltp == 1 {
+				// The row is the same as the previous one.
+				if g.r1 != nil {
+					copy(g.r0[:rowBytes], g.r1[:rowBytes])
+				}
+				continue
+			}
+		}
+		for x := 0; x < w; x++ {
+			if x&1023 == 1023 && ad.exhausted() {
+				return nil, errTruncated
+			}
+			if ad.decode(&cx[g.context(x, p)]) == 1 {
+				g.r0[x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+	}
+	return m, nil
+}
+
+// decodeGenericMMR decodes a w×h MMR coded generic region.
+func decodeGenericMMR(data []byte, w, h int, l *img1b.Limits) (*img1b.Image, error) {
+	m, err := newBitmap(l, w, h)
+	if err != nil {
+		return nil, err
+	}
+	if w == 0 || h == 0 {
+		return m, nil
+	}
+	// The end of block marker is optional, so a short region is not an
+	// error.
+	if _, err := ccitt.DecodeRows(m.Pix, m.Stride, w, h, data, &ccitt.Options{K: -1}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// nominalAT returns the nominal adaptive template pixels of a template, as
+// per ITU-T T.88 section 6.2.5.4.
+func nominalAT(template int) [4]image.Point {
+	switch template {
+	case 0:
+		return [4]image.Point{{3, -1}, {-3, -1}, {2, -2}, {-2, -2}}
+	case 1:
+		return [4]image.Point{{3, -1}}
+	}
+	return [4]image.Point{{2, -1}}
+}
+
+// blackBitmap returns a copy of m at the origin with set bits for black
+// pixels and clear padding bits. Set bits of m are black unless invert is
+// set.
+func blackBitmap(m *img1b.Image, invert bool) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	rowBytes := (w + 7) / 8
+	c, err := newBitmap(nil, w, h)
+	if err != nil {
+		panic(err)
+	}
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h && w > 0; y++ {
+		row := c.Pix[y*c.Stride : y*c.Stride+rowBytes]
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[rowBytes-1] &= tm
+	}
+	return c
+}
+
+// encodeGenericArith codes the bitmap m as a generic region with the
+// arithmetic encoder. Set bits of m are coded as black unless invert is set.
+func encodeGenericArith(ae *arithEncoder, cx []context, m *img1b.Image, p *genericParams, invert bool) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	rowBytes := (w + 7) / 8
+	c := blackBitmap(m, invert)
+	g := genericRow{m: c, w: w}
+	sltp := sltpContexts[p.template]
+	ltp := 0
+	for y := 0; y < h; y++ {
+		g.y = y
+		g.r0, g.r1, g.r2 = g.row(y), g.row(y-1), g.row(y-2)
+		if p.tpgdon {
+			same := 1
+			if g.r1 != nil {
+				if !bytes.Equal(g.r0[:rowBytes], g.r1[:rowBytes]) {
+					same = 0
+				}
+			} else {
+				for _, b := range g.r0[:rowBytes] {
+					if b != 0 {
+						same = 0
+						break
+					}
+				}
+			}
+			ae.encode(&cx[sltp], same^ltp)
+			ltp = same
+			if same == 1 {
+				continue
+			}
+		}
+		for x := 0; x < w; x++ {
+			ae.encode(&cx[g.context(x, p)], pixel(g.r0, x, w))
+		}
+	}
+}
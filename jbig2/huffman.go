@@ -0,0 +1,493 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import "sort"
+
+// bitReader reads bits most significant first. Reading past the end sets
+// err and returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (r *bitReader) bit() int {
+	i := r.pos >> 3
+	if i >= len(r.data) {
+		r.err = errTruncated
+		return 0
+	}
+	v := int(r.data[i]>>uint(7-r.pos&7)) & 1
+	r.pos++
+	return v
+}
+
+// bits reads an n-bit number.
+func (r *bitReader) bits(n uint) int {
+	v := 0
+	for i := uint(0); i < n; i++ {
+		v = v<<1 | r.bit()
+	}
+	return v
+}
+
+// align skips the rest of the current byte.
+func (r *bitReader) align() {
+	r.pos = (r.pos + 7) &^ 7
+}
+
+// bytes reads n bytes from the next byte boundary on.
+func (r *bitReader) bytes(n int) []byte {
+	r.align()
+	i := r.pos >> 3
+	if n < 0 || n > len(r.data)-i {
+		r.err = errTruncated
+		r.pos = len(r.data) << 3
+		return nil
+	}
+	r.pos += n << 3
+	return r.data[i : i+n]
+}
+
+// exhausted reports whether all data has been read.
+func (r *bitReader) exhausted() bool {
+	return r.pos>>3 >= len(r.data)
+}
+
+// Kinds of Huffman table lines, as per ITU-T T.88 section B.2.
+const (
+	lineRange = iota // low to low+2^rangeLen-1
+	lineLower        // low and below, counting down
+	lineUpper        // low and above
+	lineOOB          // the out-of-band value
+)
+
+// A huffLine is a line of a Huffman table: its values are coded with a
+// prefix of prefLen bits followed by an offset of rangeLen bits. Lines with
+// no prefix have no code.
+type huffLine struct {
+	prefLen  uint
+	rangeLen uint
+	low      int
+	kind     int
+}
+
+// maxPrefLen bounds the prefix lengths of Huffman tables.
+const maxPrefLen = 32
+
+// A huffTable is a Huffman table with the prefix codes assigned as per
+// ITU-T T.88 section B.3: the codes of each length are consecutive and
+// follow the order of the lines.
+type huffTable struct {
+	lines []huffLine // by prefix length
+	first []int      // first code of each length
+	count []int      // number of codes of each length
+}
+
+func newHuffTable(lines []huffLine) (*huffTable, error) {
+	t := &huffTable{}
+	n := uint(0)
+	for _, l := range lines {
+		if l.prefLen == 0 {
+			continue
+		}
+		if l.prefLen > maxPrefLen || l.rangeLen > 32 {
+			return nil, FormatError("bad Huffman table")
+		}
+		if l.prefLen > n {
+			n = l.prefLen
+		}
+		t.lines = append(t.lines, l)
+	}
+	sort.SliceStable(t.lines, func(i, j int) bool {
+		return t.lines[i].prefLen < t.lines[j].prefLen
+	})
+	t.first = make([]int, n+1)
+	t.count = make([]int, n+1)
+	for _, l := range t.lines {
+		t.count[l.prefLen]++
+	}
+	for l := uint(1); l <= n; l++ {
+		t.first[l] = (t.first[l-1] + t.count[l-1]) << 1
+		if t.first[l]+t.count[l] > 1<<l {
+			return nil, FormatError("bad Huffman table")
+		}
+	}
+	return t, nil
+}
+
+// decodeInt decodes a value with the table t, as per ITU-T T.88 section
+// B.4. It returns oob for the out-of-band value.
+func (r *bitReader) decodeInt(t *huffTable) int {
+	code, i := 0, 0
+	for l := 1; l < len(t.count); l++ {
+		code = code<<1 | r.bit()
+		if c := code - t.first[l]; c < t.count[l] {
+			line := &t.lines[i+c]
+			switch line.kind {
+			case lineOOB:
+				return oob
+			case lineLower:
+				return line.low - r.bits(line.rangeLen)
+			}
+			return line.low + r.bits(line.rangeLen)
+		}
+		i += t.count[l]
+	}
+	if r.err == nil {
+		r.err = FormatError("bad Huffman code")
+	}
+	return 0
+}
+
+// decodeNum decodes a value that must not be out-of-band.
+func (r *bitReader) decodeNum(t *huffTable) (int, error) {
+	v := r.decodeInt(t)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if v == oob {
+		return 0, errOOB
+	}
+	return v, nil
+}
+
+// stdLines are the lines of the standard Huffman tables B.1 to B.15, as per
+// ITU-T T.88 section B.5.
+var stdLines = [...][]huffLine{
+	{ // B.1
+		{1, 4, 0, lineRange},
+		{2, 8, 16, lineRange},
+		{3, 16, 272, lineRange},
+		{3, 32, 65808, lineUpper},
+	},
+	{ // B.2
+		{1, 0, 0, lineRange},
+		{2, 0, 1, lineRange},
+		{3, 0, 2, lineRange},
+		{4, 3, 3, lineRange},
+		{5, 6, 11, lineRange},
+		{6, 32, 75, lineUpper},
+		{6, 0, 0, lineOOB},
+	},
+	{ // B.3
+		{8, 8, -256, lineRange},
+		{1, 0, 0, lineRange},
+		{2, 0, 1, lineRange},
+		{3, 0, 2, lineRange},
+		{4, 3, 3, lineRange},
+		{5, 6, 11, lineRange},
+		{8, 32, -257, lineLower},
+		{7, 32, 75, lineUpper},
+		{6, 0, 0, lineOOB},
+	},
+	{ // B.4
+		{1, 0, 1, lineRange},
+		{2, 0, 2, lineRange},
+		{3, 0, 3, lineRange},
+		{4, 3, 4, lineRange},
+		{5, 6, 12, lineRange},
+		{5, 32, 76, lineUpper},
+	},
+	{ // B.5
+		{7, 8, -255, lineRange},
+		{1, 0, 1, lineRange},
+		{2, 0, 2, lineRange},
+		{3, 0, 3, lineRange},
+		{4, 3, 4, lineRange},
+		{5, 6, 12, lineRange},
+		{7, 32, -256, lineLower},
+		{6, 32, 76, lineUpper},
+	},
+	{ // B.6
+		{5, 10, -2048, lineRange},
+		{4, 9, -1024, lineRange},
+		{4, 8, -512, lineRange},
+		{4, 7, -256, lineRange},
+		{5, 6, -128, lineRange},
+		{5, 5, -64, lineRange},
+		{4, 5, -32, lineRange},
+		{2, 7, 0, lineRange},
+		{3, 7, 128, lineRange},
+		{3, 8, 256, lineRange},
+		{4, 9, 512, lineRange},
+		{4, 10, 1024, lineRange},
+		{6, 32, -2049, lineLower},
+		{6, 32, 2048, lineUpper},
+	},
+	{ // B.7
+		{4, 9, -1024, lineRange},
+		{3, 8, -512, lineRange},
+		{4, 7, -256, lineRange},
+		{5, 6, -128, lineRange},
+		{5, 5, -64, lineRange},
+		{4, 5, -32, lineRange},
+		{4, 5, 0, lineRange},
+		{5, 5, 32, lineRange},
+		{5, 6, 64, lineRange},
+		{4, 7, 128, lineRange},
+		{3, 8, 256, lineRange},
+		{3, 9, 512, lineRange},
+		{3, 10, 1024, lineRange},
+		{5, 32, -1025, lineLower},
+		{5, 32, 2048, lineUpper},
+	},
+	{ // B.8
+		{8, 3, -15, lineRange},
+		{9, 1, -7, lineRange},
+		{8, 1, -5, lineRange},
+		{9, 0, -3, lineRange},
+		{7, 0, -2, lineRange},
+		{4, 0, -1, lineRange},
+		{2, 1, 0, lineRange},
+		{5, 0, 2, lineRange},
+		{6, 0, 3, lineRange},
+		{3, 4, 4, lineRange},
+		{6, 1, 20, lineRange},
+		{4, 4, 22, lineRange},
+		{4, 5, 38, lineRange},
+		{5, 6, 70, lineRange},
+		{5, 7, 134, lineRange},
+		{6, 7, 262, lineRange},
+		{7, 8, 390, lineRange},
+		{6, 10, 646, lineRange},
+		{9, 32, -16, lineLower},
+		{9, 32, 1670, lineUpper},
+		{2, 0, 0, lineOOB},
+	},
+	{ // B.9
+		{8, 4, -31, lineRange},
+		{9, 2, -15, lineRange},
+		{8, 2, -11, lineRange},
+		{9, 1, -7, lineRange},
+		{7, 1, -5, lineRange},
+		{4, 1, -3, lineRange},
+		{3, 1, -1, lineRange},
+		{3, 1, 1, lineRange},
+		{5, 1, 3, lineRange},
+		{6, 1, 5, lineRange},
+		{3, 5, 7, lineRange},
+		{6, 2, 39, lineRange},
+		{4, 5, 43, lineRange},
+		{4, 6, 75, lineRange},
+		{5, 7, 139, lineRange},
+		{5, 8, 267, lineRange},
+		{6, 8, 523, lineRange},
+		{7, 9, 779, lineRange},
+		{6, 11, 1291, lineRange},
+		{9, 32, -32, lineLower},
+		{9, 32, 3339, lineUpper},
+		{2, 0, 0, lineOOB},
+	},
+	{ // B.10
+		{7, 4, -21, lineRange},
+		{8, 0, -5, lineRange},
+		{7, 0, -4, lineRange},
+		{5, 0, -3, lineRange},
+		{2, 2, -2, lineRange},
+		{5, 0, 2, lineRange},
+		{6, 0, 3, lineRange},
+		{7, 0, 4, lineRange},
+		{8, 0, 5, lineRange},
+		{2, 6, 6, lineRange},
+		{5, 5, 70, lineRange},
+		{6, 5, 102, lineRange},
+		{6, 6, 134, lineRange},
+		{6, 7, 198, lineRange},
+		{6, 8, 326, lineRange},
+		{6, 9, 582, lineRange},
+		{6, 10, 1094, lineRange},
+		{7, 11, 2118, lineRange},
+		{8, 32, -22, lineLower},
+		{8, 32, 4166, lineUpper},
+		{2, 0, 0, lineOOB},
+	},
+	{ // B.11
+		{1, 0, 1, lineRange},
+		{2, 1, 2, lineRange},
+		{4, 0, 4, lineRange},
+		{4, 1, 5, lineRange},
+		{5, 1, 7, lineRange},
+		{5, 2, 9, lineRange},
+		{6, 2, 13, lineRange},
+		{7, 2, 17, lineRange},
+		{7, 3, 21, lineRange},
+		{7, 4, 29, lineRange},
+		{7, 5, 45, lineRange},
+		{7, 6, 77, lineRange},
+		{7, 32, 141, lineUpper},
+	},
+	{ // B.12
+		{1, 0, 1, lineRange},
+		{2, 0, 2, lineRange},
+		{3, 1, 3, lineRange},
+		{5, 0, 5, lineRange},
+		{5, 1, 6, lineRange},
+		{6, 1, 8, lineRange},
+		{7, 0, 10, lineRange},
+		{7, 1, 11, lineRange},
+		{7, 2, 13, lineRange},
+		{7, 3, 17, lineRange},
+		{7, 4, 25, lineRange},
+		{8, 5, 41, lineRange},
+		{8, 32, 73, lineUpper},
+	},
+	{ // B.13
+		{1, 0, 1, lineRange},
+		{3, 0, 2, lineRange},
+		{4, 0, 3, lineRange},
+		{5, 0, 4, lineRange},
+		{4, 1, 5, lineRange},
+		{3, 3, 7, lineRange},
+		{6, 1, 15, lineRange},
+		{6, 2, 17, lineRange},
+		{6, 3, 21, lineRange},
+		{6, 4, 29, lineRange},
+		{6, 5, 45, lineRange},
+		{7, 6, 77, lineRange},
+		{7, 32, 141, lineUpper},
+	},
+	{ // B.14
+		{3, 0, -2, lineRange},
+		{3, 0, -1, lineRange},
+		{1, 0, 0, lineRange},
+		{3, 0, 1, lineRange},
+		{3, 0, 2, lineRange},
+	},
+	{ // B.15
+		{7, 4, -24, lineRange},
+		{6, 2, -8, lineRange},
+		{5, 1, -4, lineRange},
+		{4, 0, -2, lineRange},
+		{3, 0, -1, lineRange},
+		{1, 0, 0, lineRange},
+		{3, 0, 1, lineRange},
+		{4, 0, 2, lineRange},
+		{5, 1, 3, lineRange},
+		{6, 2, 5, lineRange},
+		{7, 4, 9, lineRange},
+		{7, 32, -25, lineLower},
+		{7, 32, 25, lineUpper},
+	},
+}
+
+// stdTables are the standard Huffman tables: stdTables[n-1] is table B.n.
+var stdTables = newStdTables()
+
+func newStdTables() []*huffTable {
+	tables := make([]*huffTable, len(stdLines))
+	for i, lines := range stdLines {
+		t, err := newHuffTable(lines)
+		if err != nil {
+			panic(err)
+		}
+		tables[i] = t
+	}
+	return tables
+}
+
+// readTable decodes a tables segment holding a user supplied Huffman table,
+// as per ITU-T T.88 section 7.4.13.
+func readTable(data []byte) (*huffTable, error) {
+	b := &buffer{b: data}
+	flags := b.u8()
+	low, high := int(int32(b.u32())), int(int32(b.u32()))
+	if b.err != nil {
+		return nil, b.err
+	}
+	if low >= high {
+		return nil, FormatError("bad Huffman table")
+	}
+	ps, rs := uint(flags>>1&7)+1, uint(flags>>4&7)+1
+	r := &bitReader{data: b.b[b.off:]}
+	var lines []huffLine
+	for cur := low; cur < high; {
+		l := huffLine{prefLen: uint(r.bits(ps)), rangeLen: uint(r.bits(rs)), low: cur}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if l.rangeLen > 32 {
+			return nil, FormatError("bad Huffman table")
+		}
+		lines = append(lines, l)
+		cur += 1 << l.rangeLen
+	}
+	lines = append(lines,
+		huffLine{prefLen: uint(r.bits(ps)), rangeLen: 32, low: low - 1, kind: lineLower},
+		huffLine{prefLen: uint(r.bits(ps)), rangeLen: 32, low: high, kind: lineUpper})
+	if flags&1 != 0 {
+		lines = append(lines, huffLine{prefLen: uint(r.bits(ps)), kind: lineOOB})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return newHuffTable(lines)
+}
+
+// tableSelector picks the Huffman tables of a segment: standard ones, or
+// the user supplied tables of the segments it refers to, in order.
+type tableSelector struct {
+	user []*huffTable
+	err  error
+}
+
+// table returns table B.n, or the next user supplied table if custom is
+// set.
+func (s *tableSelector) table(custom bool, n int) *huffTable {
+	if !custom {
+		return stdTables[n-1]
+	}
+	if len(s.user) == 0 {
+		s.err = FormatError("missing Huffman table")
+		return nil
+	}
+	t := s.user[0]
+	s.user = s.user[1:]
+	return t
+}
+
+// readSymbolIDTable reads the symbol ID Huffman table of a text region
+// with n symbols, as per ITU-T T.88 section 7.4.3.1.7.
+func readSymbolIDTable(r *bitReader, n int) (*huffTable, error) {
+	runs := make([]huffLine, 35)
+	for i := range runs {
+		runs[i] = huffLine{prefLen: uint(r.bits(4)), low: i}
+	}
+	rt, err := newHuffTable(runs)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]huffLine, 0, n)
+	for len(lines) < n {
+		c, err := r.decodeNum(rt)
+		if err != nil {
+			return nil, err
+		}
+		l, rep := uint(c), 1
+		switch c {
+		case 32:
+			if len(lines) == 0 {
+				return nil, FormatError("bad symbol ID table")
+			}
+			l, rep = lines[len(lines)-1].prefLen, 3+r.bits(2)
+		case 33:
+			l, rep = 0, 3+r.bits(3)
+		case 34:
+			l, rep = 0, 11+r.bits(7)
+		}
+		if rep > n-len(lines) {
+			return nil, FormatError("bad symbol ID table")
+		}
+		for ; rep > 0; rep-- {
+			lines = append(lines, huffLine{prefLen: l, low: len(lines)})
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.align()
+	return newHuffTable(lines)
+}
@@ -0,0 +1,400 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"image"
+	"strings"
+	"testing"
+)
+
+// bitWriter writes bits most significant first.
+type bitWriter struct {
+	b   []byte
+	pos int // in bits
+}
+
+func (w *bitWriter) bits(v int, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.pos&7 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[len(w.b)-1] |= byte(v>>uint(i)&1) << uint(7-w.pos&7)
+		w.pos++
+	}
+}
+
+// align pads the current byte with zeros.
+func (w *bitWriter) align() {
+	w.pos = len(w.b) << 3
+}
+
+// write writes p from the next byte boundary on.
+func (w *bitWriter) write(p []byte) {
+	w.align()
+	w.b = append(w.b, p...)
+	w.pos += len(p) << 3
+}
+
+// huff writes v, which may be oob, coded with the table t.
+func (w *bitWriter) huff(t *huffTable, v int) {
+	i := 0
+	for l := 1; l < len(t.count); l++ {
+		for c := 0; c < t.count[l]; c, i = c+1, i+1 {
+			line := &t.lines[i]
+			off := v - line.low
+			switch line.kind {
+			case lineOOB:
+				if v != oob {
+					continue
+				}
+			case lineLower:
+				if v == oob || v > line.low {
+					continue
+				}
+				off = line.low - v
+			case lineUpper:
+				if v == oob || v < line.low {
+					continue
+				}
+			default:
+				if v == oob || off < 0 || off >= 1<<line.rangeLen {
+					continue
+				}
+			}
+			w.bits(t.first[l]+c, uint(l))
+			w.bits(off, line.rangeLen)
+			return
+		}
+	}
+	panic("value not in table")
+}
+
+var zeros = strings.Repeat("0", 32)
+
+// huffCodes are codes of the standard tables, as listed in ITU-T T.88
+// section B.5.
+var huffCodes = []struct {
+	table int
+	v     int
+	code  string
+}{
+	{1, 0, "00000"},
+	{1, 15, "01111"},
+	{1, 16, "1000000000"},
+	{1, 65808, "111" + zeros},
+	{2, oob, "111111"},
+	{2, 3, "1110000"},
+	{2, 75, "111110" + zeros},
+	{3, oob, "111110"},
+	{3, -1, "1111111011111111"},
+	{3, -258, "11111111" + zeros[1:] + "1"},
+	{4, 76, "11111" + zeros},
+	{5, -256, "1111111" + zeros},
+	{6, 0, "000000000"},
+	{6, -1, "101111111"},
+	{6, -2049, "111110" + zeros},
+	{7, 2047, "0111111111111"},
+	{8, oob, "01"},
+	{8, -1, "1010"},
+	{8, 1670, "111111111" + zeros},
+	{9, oob, "00"},
+	{9, -32, "111111110" + zeros},
+	{10, oob, "10"},
+	{10, -2, "0000"},
+	{11, 1, "0"},
+	{11, 141, "1111111" + zeros},
+	{12, 73, "11111111" + zeros},
+	{13, 7, "101000"},
+	{14, -2, "100"},
+	{14, 2, "111"},
+	{15, 3, "111010"},
+	{15, -25, "1111110" + zeros},
+}
+
+// bitString returns the bytes of a string of binary digits.
+func bitString(s string) []byte {
+	w := &bitWriter{}
+	for _, c := range s {
+		w.bits(int(c-'0'), 1)
+	}
+	return w.b
+}
+
+func TestStdTables(t *testing.T) {
+	for _, tt := range huffCodes {
+		r := &bitReader{data: bitString(tt.code)}
+		if v := r.decodeInt(stdTables[tt.table-1]); v != tt.v || r.err != nil || r.pos != len(tt.code) {
+			t.Errorf("B.%d: decoding %s got %d, %v after %d bits, want %d", tt.table, tt.code, v, r.err, r.pos, tt.v)
+		}
+		w := &bitWriter{}
+		w.huff(stdTables[tt.table-1], tt.v)
+		if !bytes.Equal(w.b, bitString(tt.code)) {
+			t.Errorf("B.%d: encoding %d got %x, want %s", tt.table, tt.v, w.b, tt.code)
+		}
+	}
+}
+
+// tableBytes returns the data of a tables segment holding table B.4.
+func tableBytes() []byte {
+	data := []byte{0x24} // 3-bit prefix and range lengths, no OOB
+	data = appendU32(data, 1)
+	data = appendU32(data, 76)
+	w := &bitWriter{}
+	for _, l := range [][2]int{{1, 0}, {2, 0}, {3, 0}, {4, 3}, {5, 6}} {
+		w.bits(l[0], 3)
+		w.bits(l[1], 3)
+	}
+	w.bits(0, 3) // no lower range
+	w.bits(5, 3)
+	return append(data, w.b...)
+}
+
+func TestReadTable(t *testing.T) {
+	table, err := readTable(tableBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &bitWriter{}
+	for v := 1; v < 100; v++ {
+		w.huff(stdTables[3], v)
+	}
+	r := &bitReader{data: w.b}
+	for v := 1; v < 100; v++ {
+		if got, err := r.decodeNum(table); got != v || err != nil {
+			t.Fatalf("got %d, %v, want %d", got, err, v)
+		}
+	}
+}
+
+// encodeTextHuffman is encodeText for Huffman coded text regions, with the
+// symbol IDs coded with ids. Refinements keep the size and position of the
+// symbol.
+func encodeTextHuffman(w *bitWriter, tt *textTables, ids *huffTable, gr []context, inst []instance, p *textParams) {
+	strips := 1 << p.logStrips
+	w.huff(tt.dt, 1)
+	stripT, firstS := -strips, 0
+	for i := 0; i < len(inst); {
+		h := p.syms[inst[i].id].Rect.Dy()
+		strip := (inst[i].y + h - 1) &^ (strips - 1)
+		w.huff(tt.dt, (strip-stripT)/strips)
+		stripT = strip
+		w.huff(tt.fs, inst[i].x-firstS)
+		firstS = inst[i].x
+		curS := firstS
+		for {
+			in := &inst[i]
+			sym := p.syms[in.id]
+			w.bits(in.y+sym.Rect.Dy()-1-strip, p.logStrips)
+			w.huff(ids, in.id)
+			if in.refine {
+				w.bits(1, 1)
+				for _, t := range []*huffTable{tt.rdw, tt.rdh, tt.rdx, tt.rdy} {
+					w.huff(t, 0)
+				}
+				ae := newArithEncoder()
+				encodeRefine(ae, gr, in.m, &refineParams{at: nominalRefineAT, ref: sym})
+				data := ae.flush()
+				w.huff(tt.rsize, len(data))
+				w.write(data)
+			} else {
+				w.bits(0, 1)
+			}
+			curS += sym.Rect.Dx() - 1
+			i++
+			if i == len(inst) || (inst[i].y+p.syms[inst[i].id].Rect.Dy()-1)&^(strips-1) != strip {
+				w.huff(tt.ds, oob)
+				break
+			}
+			w.huff(tt.ds, inst[i].x-curS)
+			curS = inst[i].x
+		}
+	}
+}
+
+func TestDecodeHuffman(t *testing.T) {
+	// Two height classes, coded uncompressed and with MMR.
+	classes := [][]*img1b.Image{
+		{testBitmap(3, 5), testBitmap(6, 5)},
+		{testBitmap(2, 8), testBitmap(4, 8), testBitmap(7, 8)},
+	}
+	var syms []*img1b.Image
+	w := &bitWriter{}
+	h := 0
+	for i, class := range classes {
+		w.huff(stdTables[3], class[0].Rect.Dy()-h)
+		h = class[0].Rect.Dy()
+		width, prev := 0, 0
+		for _, s := range class {
+			w.huff(stdTables[1], s.Rect.Dx()-prev)
+			prev = s.Rect.Dx()
+			width += prev
+		}
+		w.huff(stdTables[1], oob)
+		coll := img1b.New(image.Rect(0, 0, width, h), palette())
+		x := 0
+		for _, s := range class {
+			compose(coll, s, x, 0, opOr)
+			x += s.Rect.Dx()
+		}
+		if i == 0 {
+			w.huff(stdTables[0], 0)
+			for y := 0; y < h; y++ {
+				w.write(coll.Pix[y*coll.Stride:][:(width+7)/8])
+			}
+		} else {
+			data := ccitt.EncodeRows(coll.Pix, coll.Stride, width, h, nil)
+			w.huff(stdTables[0], len(data))
+			w.write(data)
+		}
+		syms = append(syms, class...)
+	}
+	w.huff(stdTables[0], 0)
+	w.huff(stdTables[0], len(syms))
+	// Huffman coding, user supplied height table.
+	dict := []byte{0x00, 0x0d}
+	dict = appendU32(dict, len(syms))
+	dict = appendU32(dict, len(syms))
+	dict = append(dict, w.b...)
+
+	refined := img1b.New(syms[4].Rect, palette())
+	copy(refined.Pix, syms[4].Pix)
+	refined.SetColorIndex(0, 0, 1-refined.ColorIndexAt(0, 0))
+	refined.SetColorIndex(5, 6, 1-refined.ColorIndexAt(5, 6))
+	inst := []instance{
+		{id: 1, x: 1, y: 2},
+		{id: 0, x: 9, y: 3},
+		{id: 4, x: 14, y: 0, refine: true, m: refined},
+		{id: 2, x: 2, y: 12},
+		{id: 3, x: 30, y: 11},
+	}
+	// Symbol IDs 0 to 4 with code lengths 1, 3, 3, 3 and 3: run codes 1,
+	// 3, and 32 repeating 3 three times.
+	w = &bitWriter{}
+	runs := make([]huffLine, 35)
+	for i := range runs {
+		runs[i].low = i
+		if i == 1 || i == 3 || i == 32 {
+			runs[i].prefLen = 2
+		}
+		w.bits(int(runs[i].prefLen), 4)
+	}
+	rt, _ := newHuffTable(runs)
+	w.huff(rt, 1)
+	w.huff(rt, 3)
+	w.huff(rt, 32)
+	w.bits(0, 2)
+	w.align()
+	ids, _ := newHuffTable([]huffLine{{1, 0, 0, 0}, {3, 0, 1, 0}, {3, 0, 2, 0}, {3, 0, 3, 0}, {3, 0, 4, 0}})
+	tt := &textTables{
+		fs: stdTables[5], ds: stdTables[7], dt: stdTables[10],
+		rdw: stdTables[13], rdh: stdTables[13], rdx: stdTables[13], rdy: stdTables[13],
+		rsize: stdTables[0],
+	}
+	p := &textParams{logStrips: 1, syms: syms}
+	encodeTextHuffman(w, tt, ids, make([]context, numRefineContexts(0)), inst, p)
+	page := image.Rect(0, 0, 40, 24)
+	text := regionInfoBytes(page, opOr)
+	// Huffman coding with the default tables, refinement, two rows per
+	// strip.
+	text = append(text, 0x00, 0x07, 0x00, 0x00)
+	text = appendAT(text, nominalRefineAT[:])
+	text = appendU32(text, len(inst))
+	text = append(text, w.b...)
+
+	var file bytes.Buffer
+	file.WriteString(fileID)
+	file.WriteByte(0x01) // sequential
+	binary.Write(&file, binary.BigEndian, uint32(1))
+	sw := &segmentWriter{w: bufio.NewWriter(&file)}
+	sw.write(stPageInformation, 1, pageInfoBytes(40, 24, 0))
+	sw.write(stTables, 1, tableBytes())
+	sw.write(stSymbolDictionary, 1, dict, 1)
+	sw.write(stImmediateLosslessTextRegion, 1, text, 2)
+	sw.write(stEndOfPage, 1, nil)
+	sw.w.Flush()
+
+	got, err := Decode(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := img1b.New(page, palette())
+	for _, in := range inst {
+		m := syms[in.id]
+		if in.refine {
+			m = in.m
+		}
+		compose(want, m, in.x, in.y, opOr)
+	}
+	checkPixels(t, "Huffman text region", got, func(x, y int) uint8 { return want.ColorIndexAt(x, y) })
+}
+
+func TestDecodeHuffmanAggregate(t *testing.T) {
+	in := []*img1b.Image{testBitmap(5, 6), testBitmap(4, 6)}
+	refined := img1b.New(in[0].Rect, palette())
+	copy(refined.Pix, in[0].Pix)
+	refined.SetColorIndex(2, 3, 1-refined.ColorIndexAt(2, 3))
+	p := &symbolParams{
+		huff:    true,
+		refAgg:  true,
+		rat:     nominalRefineAT,
+		numEx:   2,
+		numNew:  2,
+		in:      in,
+		limits:  defaultLimits,
+		dh:      stdTables[3],
+		dw:      stdTables[1],
+		bmSize:  stdTables[0],
+		aggInst: stdTables[0],
+	}
+	w := &bitWriter{}
+	w.huff(p.dh, 6)
+	// A refinement of the first input symbol.
+	w.huff(p.dw, 5)
+	w.huff(p.aggInst, 1)
+	w.bits(0, 2)
+	w.huff(stdTables[14], 0)
+	w.huff(stdTables[14], 0)
+	ae := newArithEncoder()
+	encodeRefine(ae, make([]context, numRefineContexts(0)), refined, &refineParams{at: p.rat, ref: in[0]})
+	data := ae.flush()
+	w.huff(stdTables[0], len(data))
+	w.write(data)
+	// The input symbols side by side.
+	w.huff(p.dw, 5)
+	w.huff(p.aggInst, 2)
+	w.huff(aggregateTables.dt, 1)
+	w.huff(aggregateTables.dt, 1)
+	w.huff(aggregateTables.fs, 0)
+	w.bits(0, 2)
+	w.bits(0, 1)
+	w.huff(aggregateTables.ds, 2)
+	w.bits(1, 2)
+	w.bits(0, 1)
+	w.huff(aggregateTables.ds, oob)
+	w.huff(p.dw, oob)
+	w.huff(stdTables[0], 2)
+	w.huff(stdTables[0], 2)
+
+	ex, err := decodeSymbolsHuffman(&bitReader{data: w.b}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ex) != 2 {
+		t.Fatalf("got %d symbols, want 2", len(ex))
+	}
+	checkPixels(t, "refinement", ex[0], func(x, y int) uint8 { return refined.ColorIndexAt(x, y) })
+	if ex[1].Bounds() != image.Rect(0, 0, 10, 6) {
+		t.Fatalf("got aggregate bounds %v", ex[1].Bounds())
+	}
+	checkPixels(t, "aggregate", ex[1], func(x, y int) uint8 {
+		return inside(in[0], image.Pt(0, 0), x, y) | inside(in[1], image.Pt(6, 0), x, y)
+	})
+}
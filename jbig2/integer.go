@@ -0,0 +1,124 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+// intContexts are the contexts of an integer arithmetic decoding procedure
+// (IAx), as per ITU-T T.88 annex A.2.
+type intContexts [512]context
+
+// oob is the out-of-band value of integer coding.
+const oob = -1 << 31
+
+// intRanges are the value ranges of integer coding: a prefix of ones, the
+// number of value bits and the offset of the range.
+var intRanges = [...]struct {
+	prefix int
+	bits   uint
+	offset int
+}{
+	{0, 2, 0},
+	{1, 4, 4},
+	{2, 6, 20},
+	{3, 8, 84},
+	{4, 12, 340},
+	{5, 32, 4436},
+}
+
+// decodeInt decodes an integer, as per ITU-T T.88 section A.2. It returns
+// oob for the out-of-band value.
+func (d *arithDecoder) decodeInt(cx *intContexts) int {
+	prev := 1
+	bit := func() int {
+		b := d.decode(&cx[prev])
+		if prev < 256 {
+			prev = prev<<1 | b
+		} else {
+			prev = (prev<<1|b)&511 | 256
+		}
+		return b
+	}
+	s := bit()
+	r := 0
+	for r < len(intRanges)-1 && bit() == 1 {
+		r++
+	}
+	v := 0
+	for i := uint(0); i < intRanges[r].bits; i++ {
+		v = v<<1 | bit()
+	}
+	v += intRanges[r].offset
+	if s == 1 {
+		if v == 0 {
+			return oob
+		}
+		return -v
+	}
+	return v
+}
+
+// encodeInt encodes an integer or oob, the inverse of decodeInt.
+func (e *arithEncoder) encodeInt(cx *intContexts, v int) {
+	prev := 1
+	bit := func(b int) {
+		e.encode(&cx[prev], b)
+		if prev < 256 {
+			prev = prev<<1 | b
+		} else {
+			prev = (prev<<1|b)&511 | 256
+		}
+	}
+	s := 0
+	switch {
+	case v == oob:
+		s, v = 1, 0
+	case v < 0:
+		s, v = 1, -v
+	}
+	bit(s)
+	r := 0
+	for r < len(intRanges)-1 && v >= intRanges[r+1].offset {
+		r++
+	}
+	for i := 0; i < intRanges[r].prefix; i++ {
+		bit(1)
+	}
+	if r < len(intRanges)-1 {
+		bit(0)
+	}
+	v -= intRanges[r].offset
+	for i := int(intRanges[r].bits) - 1; i >= 0; i-- {
+		bit(v >> uint(i) & 1)
+	}
+}
+
+// decodeID decodes a symbol ID of n bits, as per ITU-T T.88 section A.3.
+// The contexts must hold 2<<n entries.
+func (d *arithDecoder) decodeID(cx []context, n uint) int {
+	prev := 1
+	for i := uint(0); i < n; i++ {
+		prev = prev<<1 | d.decode(&cx[prev])
+	}
+	return prev - 1<<n
+}
+
+// encodeID encodes a symbol ID of n bits.
+func (e *arithEncoder) encodeID(cx []context, n uint, id int) {
+	prev := 1
+	for i := int(n) - 1; i >= 0; i-- {
+		b := id >> uint(i) & 1
+		e.encode(&cx[prev], b)
+		prev = prev<<1 | b
+	}
+}
+
+// codeLen returns the number of bits of symbol IDs given the number of
+// symbols: ceil(log2(n)).
+func codeLen(n int) uint {
+	l := uint(0)
+	for 1<<l < n {
+		l++
+	}
+	return l
+}
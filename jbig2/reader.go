@@ -0,0 +1,885 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package jbig2 implements a decoder and encoder for JBIG2 bilevel images.
+//
+// Both standalone JBIG2 files, in the sequential and the random-access
+// organizations, and embedded streams as found in PDF JBIG2Decode filters
+// are read. Generic regions, arithmetic or MMR coded, are decoded directly
+// into the packed format and composed onto the page. Symbol dictionaries and
+// the text regions placing their symbols, which most documents use for
+// text, are decoded with refinement and aggregation, arithmetic or Huffman
+// coded with the standard tables B.1 to B.15 or user supplied ones.
+// Halftone and standalone refinement regions are not supported.
+//
+// The encoder writes each page as a single lossless generic region or, with
+// symbol coding, as a symbol dictionary and a text region.
+//
+// Decoded images use the palette {white, black}: set bits are black, as in
+// JBIG2.
+//
+// The format is specified in ITU-T T.88 (ISO/IEC 14492).
+package jbig2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// A FormatError reports that the input is not a valid JBIG2 image.
+type FormatError string
+
+func (e FormatError) Error() string { return "jbig2: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "jbig2: unsupported feature: " + string(e) }
+
+var (
+	errTruncated = FormatError("truncated data")
+	errNoPage    = FormatError("region outside of a page")
+)
+
+// fileID starts every JBIG2 file.
+const fileID = "\x97JB2\r\n\x1a\n"
+
+// Segment types, as per ITU-T T.88 section 7.3.
+const (
+	stSymbolDictionary            = 0
+	stIntermediateTextRegion      = 4
+	stImmediateTextRegion         = 6
+	stImmediateLosslessTextRegion = 7
+	stPatternDictionary           = 16
+	stIntermediateHalftone        = 20
+	stImmediateHalftone           = 22
+	stImmediateLosslessHalftone   = 23
+	stIntermediateGeneric         = 36
+	stImmediateGeneric            = 38
+	stImmediateLosslessGeneric    = 39
+	stIntermediateRefinement      = 40
+	stImmediateRefinement         = 42
+	stImmediateLosslessRefinement = 43
+	stPageInformation             = 48
+	stEndOfPage                   = 49
+	stEndOfStripe                 = 50
+	stEndOfFile                   = 51
+	stProfiles                    = 52
+	stTables                      = 53
+	stColorPalette                = 54
+	stExtension                   = 62
+)
+
+// unknownLength is the data length of segments whose end is found by
+// scanning for a marker.
+const unknownLength = 0xffffffff
+
+// A segment is a segment header with its data.
+type segment struct {
+	number uint32
+	typ    int
+	page   uint32
+	refs   []uint32
+	length uint32
+	data   []byte
+}
+
+// buffer reads big-endian values from a byte slice. Reading past the end
+// sets err and returns zeros.
+type buffer struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (b *buffer) bytes(n int) []byte {
+	if n < 0 || n > len(b.b)-b.off {
+		b.err = errTruncated
+		b.off = len(b.b)
+		return nil
+	}
+	p := b.b[b.off : b.off+n]
+	b.off += n
+	return p
+}
+
+func (b *buffer) u8() uint8 {
+	p := b.bytes(1)
+	if p == nil {
+		return 0
+	}
+	return p[0]
+}
+
+func (b *buffer) u16() uint16 {
+	p := b.bytes(2)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(p)
+}
+
+func (b *buffer) u32() uint32 {
+	p := b.bytes(4)
+	if p == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p)
+}
+
+// readSegmentHeader reads a segment header, as per ITU-T T.88 section 7.2.
+func readSegmentHeader(b *buffer) *segment {
+	s := &segment{number: b.u32()}
+	flags := b.u8()
+	s.typ = int(flags & 0x3f)
+	n := uint32(b.u8() >> 5)
+	switch {
+	case n == 7:
+		b.off--
+		n = b.u32() & 0x1fffffff
+		b.bytes(int((n + 8) / 8))
+	case n > 4:
+		b.err = FormatError("bad referred-to segment count")
+		return s
+	}
+	if n > uint32(len(b.b)) {
+		b.err = errTruncated
+		return s
+	}
+	s.refs = make([]uint32, n)
+	for i := range s.refs {
+		switch {
+		case s.number <= 256:
+			s.refs[i] = uint32(b.u8())
+		case s.number <= 65536:
+			s.refs[i] = uint32(b.u16())
+		default:
+			s.refs[i] = b.u32()
+		}
+	}
+	if flags&0x40 != 0 {
+		s.page = b.u32()
+	} else {
+		s.page = uint32(b.u8())
+	}
+	s.length = b.u32()
+	return s
+}
+
+// readSegmentData sets the data of s from b.
+func readSegmentData(b *buffer, s *segment) {
+	if s.length != unknownLength {
+		s.data = b.bytes(int(s.length))
+		return
+	}
+	if s.typ != stImmediateGeneric {
+		b.err = FormatError("unknown segment length")
+		return
+	}
+	// The region data ends with a marker followed by the row count, as per
+	// ITU-T T.88 section 7.2.7.
+	rest := b.b[b.off:]
+	if len(rest) < regionInfoLen+1 {
+		b.err = errTruncated
+		return
+	}
+	start := regionInfoLen + 1
+	marker := []byte{0x00, 0x00}
+	if rest[regionInfoLen]&1 == 0 {
+		marker = []byte{0xff, 0xac}
+		start += 2
+		if rest[regionInfoLen]&0x06 == 0 {
+			start += 6
+		}
+	}
+	i := bytes.Index(rest[start:], marker)
+	if i < 0 || start+i+6 > len(rest) {
+		b.err = errTruncated
+		return
+	}
+	s.data = b.bytes(start + i + 6)
+}
+
+// readSegments reads segments until the end of the data or an end of file
+// segment. Files in the random-access organization have all headers first.
+func readSegments(b *buffer, random bool) ([]*segment, error) {
+	var segs []*segment
+	for b.off < len(b.b) {
+		s := readSegmentHeader(b)
+		if b.err != nil {
+			return nil, b.err
+		}
+		segs = append(segs, s)
+		if !random {
+			readSegmentData(b, s)
+			if b.err != nil {
+				return nil, b.err
+			}
+		}
+		if s.typ == stEndOfFile {
+			break
+		}
+	}
+	if random {
+		for _, s := range segs {
+			if s.length == unknownLength {
+				return nil, FormatError("unknown segment length")
+			}
+			readSegmentData(b, s)
+			if b.err != nil {
+				return nil, b.err
+			}
+		}
+	}
+	return segs, nil
+}
+
+// regionInfoLen is the length of the region segment information field.
+const regionInfoLen = 17
+
+// regionInfo is the region segment information field, as per ITU-T T.88
+// section 7.4.1.
+type regionInfo struct {
+	r  image.Rectangle
+	op int
+}
+
+func readRegionInfo(b *buffer) regionInfo {
+	w, h := b.u32(), b.u32()
+	x, y := b.u32(), b.u32()
+	op := int(b.u8() & 7)
+	if w > maxField || h > maxField || x > maxField || y > maxField {
+		b.err = UnsupportedError("region size")
+		return regionInfo{}
+	}
+	return regionInfo{image.Rect(int(x), int(y), int(x+w), int(y+h)), op}
+}
+
+// A page is a page being decoded.
+type page struct {
+	m            *img1b.Image
+	defaultPixel bool
+	striped      bool // the height is unknown
+	limits       *img1b.Limits
+}
+
+// pageInfo is the page information segment, as per ITU-T T.88 section
+// 7.4.8. A height of 0xffffffff means that the page is striped and its
+// height is set by the end of stripe segments.
+type pageInfo struct {
+	w, h  uint32
+	flags uint8
+}
+
+func readPageInfo(data []byte) (pageInfo, error) {
+	b := &buffer{b: data}
+	var pi pageInfo
+	pi.w, pi.h = b.u32(), b.u32()
+	b.u32() // X resolution
+	b.u32() // Y resolution
+	pi.flags = b.u8()
+	b.u16() // striping information
+	if b.err != nil {
+		return pi, b.err
+	}
+	if pi.w > maxField || pi.h > maxField && pi.h != 0xffffffff {
+		return pi, UnsupportedError("page size")
+	}
+	return pi, nil
+}
+
+// newPage creates a page from a page information segment, allocated
+// within l.
+func newPage(data []byte, l *img1b.Limits) (*page, error) {
+	pi, err := readPageInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &page{defaultPixel: pi.flags&0x04 != 0, limits: l}
+	h := int(pi.h)
+	if pi.h == 0xffffffff {
+		p.striped = true
+		h = 0
+	}
+	if p.m, err = newBitmap(l, int(pi.w), h); err != nil {
+		return nil, err
+	}
+	p.fill(0)
+	return p, nil
+}
+
+// grow extends the page to the given height. The limits are checked, but
+// the pixels are not allocated through them.
+func (p *page) grow(h int) error {
+	old := p.m.Rect.Dy()
+	if h <= old {
+		return nil
+	}
+	if err := p.limits.Check(p.m.Rect.Dx(), h); err != nil {
+		return err
+	}
+	n := h * p.m.Stride
+	if cap(p.m.Pix) >= n {
+		p.m.Pix = p.m.Pix[:n]
+	} else {
+		pix := make([]byte, n, n+n/2)
+		copy(pix, p.m.Pix)
+		p.m.Pix = pix
+	}
+	p.m.Rect.Max.Y = h
+	p.fill(old)
+	return nil
+}
+
+// fill sets the rows of the page from y0 on to the default pixel value,
+// assuming they are 0.
+func (p *page) fill(y0 int) {
+	if !p.defaultPixel {
+		return
+	}
+	h := p.m.Rect.Dy()
+	fill := p.m.Pix[y0*p.m.Stride : h*p.m.Stride]
+	for i := range fill {
+		fill[i] = 0xff
+	}
+	if w := p.m.Rect.Dx(); w > 0 {
+		tm := bitmap.TailMask(w)
+		for y := y0; y < h; y++ {
+			p.m.Pix[y*p.m.Stride+(w+7)/8-1] &= tm
+		}
+	}
+}
+
+// Combination operators, as per ITU-T T.88 section 7.4.1.5.
+const (
+	opOr = iota
+	opAnd
+	opXor
+	opXnor
+	opReplace
+)
+
+// bits8 returns the eight bits of row starting at x, which may be negative.
+// Bits outside of row are 0.
+func bits8(row []byte, x int) byte {
+	i, s := x>>3, uint(x&7)
+	var hi, lo byte
+	if i >= 0 && i < len(row) {
+		hi = row[i]
+	}
+	if i+1 >= 0 && i+1 < len(row) {
+		lo = row[i+1]
+	}
+	return hi<<s | lo>>(8-s)
+}
+
+// compose combines the bitmap src placed at (x, y) into dst using the
+// combination operator op.
+func compose(dst, src *img1b.Image, x, y, op int) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	r := image.Rect(x, y, x+sw, y+sh).Intersect(dst.Rect)
+	if r.Empty() {
+		return
+	}
+	srcBytes := (sw + 7) / 8
+	for dy := r.Min.Y; dy < r.Max.Y; dy++ {
+		srow := src.Pix[(dy-y)*src.Stride:][:srcBytes]
+		drow := dst.Pix[(dy-dst.Rect.Min.Y)*dst.Stride:]
+		for i := r.Min.X >> 3; i <= (r.Max.X-1)>>3; i++ {
+			mask := byte(0xff)
+			if x0 := r.Min.X - i*8; x0 > 0 {
+				mask >>= uint(x0)
+			}
+			if x1 := i*8 + 8 - r.Max.X; x1 > 0 {
+				mask &= 0xff << uint(x1)
+			}
+			s, d := bits8(srow, i*8-x), drow[i]
+			var v byte
+			switch op {
+			case opOr:
+				v = d | s
+			case opAnd:
+				v = d & s
+			case opXor:
+				v = d ^ s
+			case opXnor:
+				v = ^(d ^ s)
+			default:
+				v = s
+			}
+			drow[i] = d&^mask | v&mask
+		}
+	}
+}
+
+// decoder holds the state of decoding a sequence of segments.
+type decoder struct {
+	segs   []*segment
+	pages  []*img1b.Image
+	page   *page
+	dicts  map[uint32][]*img1b.Image // exported symbols by segment number
+	tables map[uint32]*huffTable     // user supplied tables by segment number
+	limits *img1b.Limits
+}
+
+// readGenericRegion decodes a generic region segment, as per ITU-T T.88
+// section 7.4.6.
+func (d *decoder) readGenericRegion(s *segment) (regionInfo, *img1b.Image, error) {
+	b := &buffer{b: s.data}
+	ri := readRegionInfo(b)
+	flags := b.u8()
+	p := &genericParams{
+		mmr:      flags&1 != 0,
+		template: int(flags>>1) & 3,
+		tpgdon:   flags&8 != 0,
+		limits:   d.limits,
+	}
+	if flags&0x10 != 0 {
+		return ri, nil, UnsupportedError("extended generic template")
+	}
+	if !p.mmr {
+		at := p.at[:numAT(p.template)]
+		readAT(b, at)
+		for _, a := range at {
+			// Only already decoded pixels may be referenced.
+			if a.Y > 0 || a.Y == 0 && a.X >= 0 {
+				return ri, nil, FormatError("bad adaptive template pixel")
+			}
+		}
+	}
+	if b.err != nil {
+		return ri, nil, b.err
+	}
+	data := b.b[b.off:]
+	w, h := ri.r.Dx(), ri.r.Dy()
+	if s.length == unknownLength {
+		// The actual row count follows the end marker.
+		h = int(binary.BigEndian.Uint32(data[len(data)-4:]))
+		if h > ri.r.Dy() {
+			return ri, nil, FormatError("bad row count")
+		}
+		ri.r.Max.Y = ri.r.Min.Y + h
+		data = data[:len(data)-6]
+	}
+	var m *img1b.Image
+	var err error
+	if p.mmr {
+		m, err = decodeGenericMMR(data, w, h, p.limits)
+	} else {
+		cx := make([]context, numContexts(p.template))
+		m, err = decodeGenericArith(newArithDecoder(data), cx, w, h, p)
+	}
+	return ri, m, err
+}
+
+// readAT reads n adaptive template pixels.
+func readAT(b *buffer, at []image.Point) {
+	for i := range at {
+		at[i].X = int(int8(b.u8()))
+		at[i].Y = int(int8(b.u8()))
+	}
+}
+
+// symbols returns the symbols exported by the symbol dictionaries that s
+// refers to.
+func (d *decoder) symbols(s *segment) []*img1b.Image {
+	var syms []*img1b.Image
+	for _, r := range s.refs {
+		syms = append(syms, d.dicts[r]...)
+	}
+	return syms
+}
+
+// userTables returns a selector of the user supplied Huffman tables that s
+// refers to.
+func (d *decoder) userTables(s *segment) *tableSelector {
+	ts := &tableSelector{}
+	for _, r := range s.refs {
+		if t, ok := d.tables[r]; ok {
+			ts.user = append(ts.user, t)
+		}
+	}
+	return ts
+}
+
+// readSymbolDict decodes a symbol dictionary segment, as per ITU-T T.88
+// section 7.4.2.
+func (d *decoder) readSymbolDict(s *segment) error {
+	b := &buffer{b: s.data}
+	flags := b.u16()
+	p := &symbolParams{
+		huff:      flags&1 != 0,
+		refAgg:    flags&2 != 0,
+		template:  int(flags>>10) & 3,
+		rtemplate: int(flags>>12) & 1,
+		in:        d.symbols(s),
+		limits:    d.limits,
+	}
+	if flags&0x100 != 0 {
+		return UnsupportedError("symbol dictionary context reuse")
+	}
+	if p.huff {
+		dh, dw := int(flags>>2)&3, int(flags>>4)&3
+		if dh == 2 || dw == 2 {
+			return FormatError("bad Huffman table selection")
+		}
+		ts := d.userTables(s)
+		p.dh = ts.table(dh == 3, 4+dh)
+		p.dw = ts.table(dw == 3, 2+dw)
+		p.bmSize = ts.table(flags&0x40 != 0, 1)
+		p.aggInst = ts.table(flags&0x80 != 0, 1)
+		if ts.err != nil {
+			return ts.err
+		}
+	} else {
+		readAT(b, p.at[:numAT(p.template)])
+	}
+	if p.refAgg && p.rtemplate == 0 {
+		readAT(b, p.rat[:])
+	}
+	numEx, numNew := b.u32(), b.u32()
+	if b.err != nil {
+		return b.err
+	}
+	if numNew > maxField || numEx > uint32(len(p.in))+numNew {
+		return FormatError("bad number of symbols")
+	}
+	p.numEx, p.numNew = int(numEx), int(numNew)
+	var syms []*img1b.Image
+	var err error
+	if p.huff {
+		syms, err = decodeSymbolsHuffman(&bitReader{data: b.b[b.off:]}, p)
+	} else {
+		syms, err = decodeSymbols(newArithDecoder(b.b[b.off:]), p)
+	}
+	if err != nil {
+		return err
+	}
+	if d.dicts == nil {
+		d.dicts = make(map[uint32][]*img1b.Image)
+	}
+	d.dicts[s.number] = syms
+	return nil
+}
+
+// readTextRegion decodes a text region segment, as per ITU-T T.88 section
+// 7.4.3.
+func (d *decoder) readTextRegion(s *segment) (regionInfo, *img1b.Image, error) {
+	b := &buffer{b: s.data}
+	ri := readRegionInfo(b)
+	flags := b.u16()
+	p := &textParams{
+		w:            ri.r.Dx(),
+		h:            ri.r.Dy(),
+		refine:       flags&2 != 0,
+		logStrips:    uint(flags>>2) & 3,
+		corner:       int(flags>>4) & 3,
+		transposed:   flags&0x40 != 0,
+		op:           int(flags>>7) & 3,
+		defaultPixel: flags&0x200 != 0,
+		dsOffset:     int(flags>>10) & 0x1f,
+		rtemplate:    int(flags >> 15),
+		syms:         d.symbols(s),
+		limits:       d.limits,
+	}
+	if p.dsOffset >= 16 {
+		p.dsOffset -= 32
+	}
+	var tt *textTables
+	if flags&1 != 0 {
+		var err error
+		if tt, err = d.selectTextTables(s, b.u16()); err != nil {
+			return ri, nil, err
+		}
+	}
+	if p.refine && p.rtemplate == 0 {
+		readAT(b, p.rat[:])
+	}
+	n := b.u32()
+	if b.err != nil {
+		return ri, nil, b.err
+	}
+	if n > maxField {
+		return ri, nil, FormatError("bad number of symbol instances")
+	}
+	p.numInstances = int(n)
+	if tt != nil {
+		r := &bitReader{data: b.b[b.off:]}
+		ids, err := readSymbolIDTable(r, len(p.syms))
+		if err != nil {
+			return ri, nil, err
+		}
+		src := &huffText{r: r, t: tt, ids: ids}
+		if p.refine {
+			src.gr = make([]context, numRefineContexts(p.rtemplate))
+		}
+		m, err := decodeText(src, p)
+		return ri, m, err
+	}
+	p.codeLen = codeLen(len(p.syms))
+	if p.codeLen > 24 {
+		return ri, nil, UnsupportedError("number of symbols")
+	}
+	cx := newTextContexts(p.codeLen, p.rtemplate)
+	m, err := decodeText(&arithText{newArithDecoder(b.b[b.off:]), cx}, p)
+	return ri, m, err
+}
+
+// selectTextTables selects the Huffman tables of a text region given its
+// Huffman flags, as per ITU-T T.88 section 7.4.3.1.2.
+func (d *decoder) selectTextTables(s *segment, flags uint16) (*textTables, error) {
+	sel := func(shift uint) int { return int(flags>>shift) & 3 }
+	fs, ds, dt := sel(0), sel(2), sel(4)
+	rd := [4]int{sel(6), sel(8), sel(10), sel(12)}
+	if fs == 2 || rd[0] == 2 || rd[1] == 2 || rd[2] == 2 || rd[3] == 2 {
+		return nil, FormatError("bad Huffman table selection")
+	}
+	ts := d.userTables(s)
+	tt := &textTables{
+		fs:    ts.table(fs == 3, 6+fs),
+		ds:    ts.table(ds == 3, 8+ds),
+		dt:    ts.table(dt == 3, 11+dt),
+		rdw:   ts.table(rd[0] == 3, 14+rd[0]),
+		rdh:   ts.table(rd[1] == 3, 14+rd[1]),
+		rdx:   ts.table(rd[2] == 3, 14+rd[2]),
+		rdy:   ts.table(rd[3] == 3, 14+rd[3]),
+		rsize: ts.table(flags&0x4000 != 0, 1),
+	}
+	return tt, ts.err
+}
+
+// compose places a region bitmap on the current page.
+func (d *decoder) compose(ri regionInfo, m *img1b.Image) error {
+	if d.page.striped {
+		if err := d.page.grow(ri.r.Max.Y); err != nil {
+			return err
+		}
+	}
+	compose(d.page.m, m, ri.r.Min.X, ri.r.Min.Y, ri.op)
+	return nil
+}
+
+// endPage finishes the current page.
+func (d *decoder) endPage() {
+	if d.page != nil {
+		d.pages = append(d.pages, d.page.m)
+		d.page = nil
+	}
+}
+
+// decodeSegment processes a single segment.
+func (d *decoder) decodeSegment(s *segment) error {
+	switch s.typ {
+	case stPageInformation:
+		d.endPage()
+		p, err := newPage(s.data, d.limits)
+		if err != nil {
+			return err
+		}
+		d.page = p
+	case stEndOfPage:
+		d.endPage()
+	case stEndOfStripe:
+		b := &buffer{b: s.data}
+		y := b.u32()
+		if b.err != nil {
+			return b.err
+		}
+		if d.page != nil && d.page.striped && y < maxField {
+			return d.page.grow(int(y) + 1)
+		}
+	case stImmediateGeneric, stImmediateLosslessGeneric:
+		if d.page == nil {
+			return errNoPage
+		}
+		ri, m, err := d.readGenericRegion(s)
+		if err != nil {
+			return err
+		}
+		return d.compose(ri, m)
+	case stSymbolDictionary:
+		return d.readSymbolDict(s)
+	case stImmediateTextRegion, stImmediateLosslessTextRegion:
+		if d.page == nil {
+			return errNoPage
+		}
+		ri, m, err := d.readTextRegion(s)
+		if err != nil {
+			return err
+		}
+		return d.compose(ri, m)
+	case stTables:
+		t, err := readTable(s.data)
+		if err != nil {
+			return err
+		}
+		if d.tables == nil {
+			d.tables = make(map[uint32]*huffTable)
+		}
+		d.tables[s.number] = t
+	case stEndOfFile, stProfiles, stColorPalette, stExtension:
+		// Nothing to do.
+	default:
+		return UnsupportedError(fmt.Sprintf("segment type %d", s.typ))
+	}
+	return nil
+}
+
+// decode processes all segments and returns the pages.
+func (d *decoder) decode() ([]*img1b.Image, error) {
+	for _, s := range d.segs {
+		if err := d.decodeSegment(s); err != nil {
+			return nil, err
+		}
+	}
+	// Embedded streams need not end their page.
+	d.endPage()
+	if len(d.pages) == 0 {
+		return nil, FormatError("no pages")
+	}
+	return d.pages, nil
+}
+
+// newDecoder reads the segments of a JBIG2 file.
+func newDecoder(r io.Reader) (*decoder, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b := &buffer{b: data}
+	if string(b.bytes(len(fileID))) != fileID {
+		return nil, FormatError("not a JBIG2 file")
+	}
+	flags := b.u8()
+	if flags&2 == 0 {
+		b.u32() // number of pages
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	segs, err := readSegments(b, flags&1 == 0)
+	if err != nil {
+		return nil, err
+	}
+	return &decoder{segs: segs}, nil
+}
+
+// Decoder configures decoding of JBIG2 images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the bitmaps decoded: the
+	// pages and the regions and symbols composed onto them. Bitmaps over
+	// the limits are rejected with an img1b.LimitError. If nil, bitmaps
+	// are limited to 1<<30 pixels.
+	Limits *img1b.Limits
+}
+
+func (dec *Decoder) limits() *img1b.Limits {
+	if dec.Limits == nil {
+		return defaultLimits
+	}
+	return dec.Limits
+}
+
+// Decode reads the first page of a JBIG2 file from r and returns it as an
+// img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var dec Decoder
+	return dec.Decode(r)
+}
+
+// Decode reads the first page of a JBIG2 file from r and returns it as an
+// img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	pages, err := dec.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return pages[0], nil
+}
+
+// DecodeAll reads all pages of a JBIG2 file from r.
+func DecodeAll(r io.Reader) ([]*img1b.Image, error) {
+	var dec Decoder
+	return dec.DecodeAll(r)
+}
+
+// DecodeAll reads all pages of a JBIG2 file from r.
+func (dec *Decoder) DecodeAll(r io.Reader) ([]*img1b.Image, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	d.limits = dec.limits()
+	return d.decode()
+}
+
+// DecodeEmbedded decodes an embedded JBIG2 stream, such as the data of a PDF
+// image with the JBIG2Decode filter. globals holds the segments shared by
+// several streams, it may be nil.
+func DecodeEmbedded(data, globals []byte) (*img1b.Image, error) {
+	var dec Decoder
+	return dec.DecodeEmbedded(data, globals)
+}
+
+// DecodeEmbedded decodes an embedded JBIG2 stream, such as the data of a PDF
+// image with the JBIG2Decode filter. globals holds the segments shared by
+// several streams, it may be nil.
+func (dec *Decoder) DecodeEmbedded(data, globals []byte) (*img1b.Image, error) {
+	gsegs, err := readSegments(&buffer{b: globals}, false)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := readSegments(&buffer{b: data}, false)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{segs: append(gsegs, segs...), limits: dec.limits()}
+	pages, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	return pages[0], nil
+}
+
+// DecodeConfig returns the color model and dimensions of the first page of
+// a JBIG2 file without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	found := false
+	var w, h int
+	for _, s := range d.segs {
+		switch {
+		case s.typ == stPageInformation && !found:
+			pi, err := readPageInfo(s.data)
+			if err != nil {
+				return image.Config{}, err
+			}
+			found = true
+			w = int(pi.w)
+			if pi.h != 0xffffffff {
+				return image.Config{ColorModel: palette(), Width: w, Height: int(pi.h)}, nil
+			}
+		case s.typ == stEndOfStripe && found && len(s.data) >= 4:
+			if y := binary.BigEndian.Uint32(s.data); y < maxField && int(y) >= h {
+				h = int(y) + 1
+			}
+		case s.typ == stEndOfPage && found:
+			return image.Config{ColorModel: palette(), Width: w, Height: h}, nil
+		}
+	}
+	if !found {
+		return image.Config{}, FormatError("no pages")
+	}
+	return image.Config{ColorModel: palette(), Width: w, Height: h}, nil
+}
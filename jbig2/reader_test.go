@@ -0,0 +1,272 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// segmentBytes returns a segment with a short header.
+func segmentBytes(number uint32, typ int, page uint8, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, number)
+	b.WriteByte(byte(typ))
+	b.WriteByte(0) // no referred-to segments
+	b.WriteByte(page)
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func pageInfoBytes(w, h uint32, flags byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{w, h, 0, 0})
+	b.WriteByte(flags)
+	b.Write([]byte{0, 0})
+	return b.Bytes()
+}
+
+func regionInfoBytes(r image.Rectangle, op byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, []uint32{
+		uint32(r.Dx()), uint32(r.Dy()), uint32(r.Min.X), uint32(r.Min.Y),
+	})
+	b.WriteByte(op)
+	return b.Bytes()
+}
+
+// mmrRegion returns the data of an immediate generic region segment
+// holding m, MMR coded, at p.
+func mmrRegion(m *img1b.Image, p image.Point, op byte) []byte {
+	b := m.Bounds()
+	data := regionInfoBytes(b.Sub(b.Min).Add(p), op)
+	data = append(data, 1) // MMR
+	return append(data, ccitt.EncodeRows(m.Pix, m.Stride, b.Dx(), b.Dy(), nil)...)
+}
+
+// testBitmap returns a w×h bitmap with a diagonal pattern.
+func testBitmap(w, h int) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), palette())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x+2*y)%7 < 3 || x == y {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// checkPixels compares m with the function want.
+func checkPixels(t *testing.T, name string, m *img1b.Image, want func(x, y int) uint8) {
+	t.Helper()
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if got, w := m.ColorIndexAt(x, y), want(x, y); got != w {
+				t.Fatalf("%s: at (%d, %d) got %d, want %d", name, x, y, got, w)
+			}
+		}
+	}
+	if m.Palette[1] != color.Black {
+		t.Errorf("%s: got palette %v", name, m.Palette)
+	}
+}
+
+// inside returns the pixel of m at (x, y) relative to p, or 0 outside m.
+func inside(m *img1b.Image, p image.Point, x, y int) uint8 {
+	q := image.Pt(x, y).Sub(p)
+	if !q.In(m.Bounds()) {
+		return 0
+	}
+	return m.ColorIndexAt(q.X, q.Y)
+}
+
+func TestDecodeMMR(t *testing.T) {
+	m := testBitmap(45, 20)
+	at := image.Pt(11, 3)
+	var file bytes.Buffer
+	file.WriteString(fileID)
+	file.WriteByte(0x01) // sequential
+	binary.Write(&file, binary.BigEndian, uint32(1))
+	file.Write(segmentBytes(0, stPageInformation, 1, pageInfoBytes(60, 30, 0)))
+	file.Write(segmentBytes(1, stImmediateLosslessGeneric, 1, mmrRegion(m, at, opOr)))
+	file.Write(segmentBytes(2, stEndOfPage, 1, nil))
+	file.Write(segmentBytes(3, stEndOfFile, 0, nil))
+
+	got, err := Decode(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != image.Rect(0, 0, 60, 30) {
+		t.Fatalf("got bounds %v", got.Bounds())
+	}
+	checkPixels(t, "MMR", got, func(x, y int) uint8 { return inside(m, at, x, y) })
+
+	cfg, err := DecodeConfig(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 60 || cfg.Height != 30 {
+		t.Errorf("got %dx%d, want 60x30", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeRandomAccess(t *testing.T) {
+	m := testBitmap(16, 9)
+	segs := [][]byte{
+		segmentBytes(0, stPageInformation, 1, pageInfoBytes(16, 9, 0)),
+		segmentBytes(1, stImmediateGeneric, 1, mmrRegion(m, image.Point{}, opOr)),
+		segmentBytes(2, stEndOfPage, 1, nil),
+		segmentBytes(3, stPageInformation, 2, pageInfoBytes(20, 10, 0x04)),
+		segmentBytes(4, stEndOfPage, 2, nil),
+		segmentBytes(5, stEndOfFile, 0, nil),
+	}
+	var file bytes.Buffer
+	file.WriteString(fileID)
+	file.WriteByte(0x02) // random access, unknown number of pages
+	for _, s := range segs {
+		file.Write(s[:11])
+	}
+	for _, s := range segs {
+		file.Write(s[11:])
+	}
+	pages, err := DecodeAll(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	checkPixels(t, "page 1", pages[0], func(x, y int) uint8 { return m.ColorIndexAt(x, y) })
+	// The second page is filled with its default pixel value.
+	checkPixels(t, "page 2", pages[1], func(x, y int) uint8 { return 1 })
+	if pages[1].Pix[2]&0x0f != 0 {
+		t.Error("page 2: padding bits are not clear")
+	}
+}
+
+func TestDecodeEmbedded(t *testing.T) {
+	m := testBitmap(24, 12)
+	var data bytes.Buffer
+	data.Write(segmentBytes(1, stPageInformation, 1, pageInfoBytes(30, 0xffffffff, 0x04)))
+	for i, op := range []byte{opReplace, opXor, opAnd} {
+		data.Write(segmentBytes(uint32(2+i), stImmediateGeneric, 1, mmrRegion(m, image.Pt(3, 4*i), op)))
+	}
+	data.Write(segmentBytes(5, stEndOfStripe, 1, []byte{0, 0, 0, 39}))
+	globals := segmentBytes(0, stTables, 0, tableBytes())
+
+	got, err := DecodeEmbedded(data.Bytes(), globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != image.Rect(0, 0, 30, 40) {
+		t.Fatalf("got bounds %v", got.Bounds())
+	}
+	checkPixels(t, "embedded", got, func(x, y int) uint8 {
+		pt := image.Pt(x, y)
+		v := uint8(1) // default pixel
+		if pt.In(image.Rect(3, 0, 27, 12)) {
+			v = inside(m, image.Pt(3, 0), x, y)
+		}
+		if pt.In(image.Rect(3, 4, 27, 16)) {
+			v ^= inside(m, image.Pt(3, 4), x, y)
+		}
+		if pt.In(image.Rect(3, 8, 27, 20)) {
+			v &= inside(m, image.Pt(3, 8), x, y)
+		}
+		return v
+	})
+}
+
+func TestCompose(t *testing.T) {
+	src := testBitmap(13, 5)
+	for _, x := range []int{-9, -3, 0, 1, 7, 8, 21} {
+		dst := img1b.New(image.Rect(0, 0, 27, 7), palette())
+		compose(dst, src, x, 1, opOr)
+		checkPixels(t, "compose", dst, func(px, py int) uint8 { return inside(src, image.Pt(x, 1), px, py) })
+	}
+}
+
+var decodeErrors = []struct {
+	data string
+	err  string
+}{
+	{"", "not a JBIG2 file"},
+	{fileID + "\x01\x00\x00", "truncated"},
+	{fileID + "\x03" + string(segmentBytes(0, stPageInformation, 1, pageInfoBytes(1, 1, 0))[:15]), "truncated"},
+	{fileID + "\x03" + string(segmentBytes(0, stPatternDictionary, 1, nil)), "segment type 16"},
+	{fileID + "\x03" + string(segmentBytes(0, stImmediateGeneric, 1, regionInfoBytes(image.Rect(0, 0, 1, 1), 0))), "region outside"},
+	{fileID + "\x03" + string(segmentBytes(0, stEndOfFile, 0, nil)), "no pages"},
+	{fileID + "\x03" + string(segmentBytes(0, stSymbolDictionary, 1, []byte{0, 0x09})), "bad Huffman table selection"},
+	{fileID + "\x03" + string(segmentBytes(0, stSymbolDictionary, 1, []byte{0, 0x0d})), "missing Huffman table"},
+	{fileID + "\x03" + string(segmentBytes(0, stTables, 0, []byte{0, 0, 0, 0, 1, 0, 0, 0, 0})), "bad Huffman table"},
+	{fileID + "\x03" + string(segmentBytes(0, stSymbolDictionary, 1, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1})), "bad number of symbols"},
+	{fileID + "\x03" + string(segmentBytes(0, stSymbolDictionary, 1, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 0})), "bad symbol height"},
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tt := range decodeErrors {
+		m, err := Decode(strings.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("decoding %q: missing error", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("decoding %q: %s, want %s", tt.data, err, tt.err)
+		}
+		if m != nil {
+			t.Errorf("decoding %q: have image + error", tt.data)
+		}
+	}
+}
+
+func TestTextRegionCorners(t *testing.T) {
+	sym := testBitmap(3, 2)
+	for _, tt := range []struct {
+		corner     int
+		transposed bool
+		x, y       int
+	}{
+		{cornerTopLeft, false, 5, 4},
+		{cornerTopRight, false, 5, 4},
+		{cornerBottomLeft, false, 5, 3},
+		{cornerBottomRight, false, 5, 3},
+		{cornerTopLeft, true, 4, 5},
+		{cornerTopRight, true, 2, 5},
+		{cornerBottomLeft, true, 4, 5},
+		{cornerBottomRight, true, 2, 5},
+	} {
+		// A single instance at S = 5, T = 4.
+		var cx textContexts
+		ae := newArithEncoder()
+		ae.encodeInt(&cx.iadt, 0)
+		ae.encodeInt(&cx.iadt, 4)
+		ae.encodeInt(&cx.iafs, 5)
+		ae.encodeInt(&cx.iads, oob)
+		p := &textParams{
+			w: 10, h: 10,
+			numInstances: 1,
+			syms:         []*img1b.Image{sym},
+			corner:       tt.corner,
+			transposed:   tt.transposed,
+		}
+		m, err := decodeText(&arithText{newArithDecoder(ae.flush()), newTextContexts(0, 0)}, p)
+		if err != nil {
+			t.Errorf("corner %d transposed %v: %v", tt.corner, tt.transposed, err)
+			continue
+		}
+		checkPixels(t, "text region", m, func(x, y int) uint8 {
+			return sym.ColorIndexAt(x-tt.x, y-tt.y)
+		})
+	}
+}
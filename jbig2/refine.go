@@ -0,0 +1,93 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+)
+
+// refineParams are the parameters of the generic refinement region decoding
+// procedure, as per ITU-T T.88 table 6. Typical prediction is not
+// supported, text regions and symbol dictionaries never use it.
+type refineParams struct {
+	template int
+	at       [2]image.Point // adaptive template pixels
+	ref      *img1b.Image
+	dx, dy   int // offset of the reference bitmap
+	limits   *img1b.Limits
+}
+
+// numRefineContexts returns the number of contexts used by a refinement
+// template.
+func numRefineContexts(template int) int {
+	if template == 0 {
+		return 1 << 13
+	}
+	return 1 << 10
+}
+
+// nominalRefineAT are the nominal adaptive template pixels of refinement
+// template 0, as per ITU-T T.88 section 6.3.5.3.
+var nominalRefineAT = [2]image.Point{{-1, -1}, {-1, -1}}
+
+// bitAt returns the pixel of m at (x, y), which is 0 outside of m.
+func bitAt(m *img1b.Image, x, y int) int {
+	if x < 0 || y < 0 || x >= m.Rect.Dx() || y >= m.Rect.Dy() {
+		return 0
+	}
+	return int(m.Pix[y*m.Stride+x>>3]>>uint(7-x&7)) & 1
+}
+
+// context returns the context of the pixel at (x, y) of m, as per ITU-T
+// T.88 figures 12 and 13. The pixels of m come first, then the pixels of
+// the reference bitmap.
+func (p *refineParams) context(m *img1b.Image, x, y int) int {
+	r, rx, ry := p.ref, x-p.dx, y-p.dy
+	if p.template == 0 {
+		return bitAt(m, x, y-1)<<12 | bitAt(m, x+1, y-1)<<11 | bitAt(m, x-1, y)<<10 |
+			bitAt(m, x+p.at[0].X, y+p.at[0].Y)<<9 |
+			bitAt(r, rx, ry-1)<<8 | bitAt(r, rx+1, ry-1)<<7 |
+			bitAt(r, rx-1, ry)<<6 | bitAt(r, rx, ry)<<5 | bitAt(r, rx+1, ry)<<4 |
+			bitAt(r, rx-1, ry+1)<<3 | bitAt(r, rx, ry+1)<<2 | bitAt(r, rx+1, ry+1)<<1 |
+			bitAt(r, rx+p.at[1].X, ry+p.at[1].Y)
+	}
+	return bitAt(m, x-1, y-1)<<9 | bitAt(m, x, y-1)<<8 | bitAt(m, x+1, y-1)<<7 |
+		bitAt(m, x-1, y)<<6 |
+		bitAt(r, rx, ry-1)<<5 | bitAt(r, rx-1, ry)<<4 | bitAt(r, rx, ry)<<3 |
+		bitAt(r, rx+1, ry)<<2 | bitAt(r, rx, ry+1)<<1 | bitAt(r, rx+1, ry+1)
+}
+
+// decodeRefine decodes a w×h generic refinement region, as per ITU-T T.88
+// section 6.3.5.6, with typical prediction off.
+func decodeRefine(ad *arithDecoder, cx []context, w, h int, p *refineParams) (*img1b.Image, error) {
+	m, err := newBitmap(p.limits, w, h)
+	if err != nil {
+		return nil, err
+	}
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride:]
+		for x := 0; x < w; x++ {
+			if x&1023 == 0 && ad.exhausted() {
+				return nil, errTruncated
+			}
+			if ad.decode(&cx[p.context(m, x, y)]) == 1 {
+				row[x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+	}
+	return m, nil
+}
+
+// encodeRefine codes the bitmap m as a refinement of p.ref. The padding
+// bits of m must be clear.
+func encodeRefine(ae *arithEncoder, cx []context, m *img1b.Image, p *refineParams) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			ae.encode(&cx[p.context(m, x, y)], bitAt(m, x, y))
+		}
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+)
+
+// symbolParams are the parameters of the symbol dictionary decoding
+// procedure, as per ITU-T T.88 table 13.
+type symbolParams struct {
+	huff      bool
+	refAgg    bool
+	template  int
+	at        [4]image.Point
+	rtemplate int
+	rat       [2]image.Point
+	numEx     int
+	numNew    int
+	in        []*img1b.Image // input symbols
+	limits    *img1b.Limits
+
+	// Huffman tables
+	dh, dw  *huffTable
+	bmSize  *huffTable
+	aggInst *huffTable
+}
+
+// decodeSymbols decodes an arithmetic coded symbol dictionary, as per
+// ITU-T T.88 section 6.5.5, and returns the exported symbols.
+func decodeSymbols(ad *arithDecoder, p *symbolParams) ([]*img1b.Image, error) {
+	var iadh, iadw, iaex, iaai intContexts
+	gcx := make([]context, numContexts(p.template))
+	gp := &genericParams{template: p.template, at: p.at, limits: p.limits}
+	n := len(p.in) + p.numNew
+	codeLen := codeLen(n)
+	var tcx *textContexts
+	if p.refAgg {
+		if codeLen > 24 {
+			return nil, UnsupportedError("number of symbols")
+		}
+		tcx = newTextContexts(codeLen, p.rtemplate)
+	}
+	c := p.numNew
+	if c > 1024 {
+		c = 1024
+	}
+	syms := append(make([]*img1b.Image, 0, len(p.in)+c), p.in...)
+	h := 0
+	for len(syms) < n {
+		if ad.exhausted() {
+			return nil, errTruncated
+		}
+		dh, err := ad.decodeNum(&iadh)
+		if err != nil {
+			return nil, err
+		}
+		if h += dh; h < 0 {
+			return nil, FormatError("bad symbol height")
+		}
+		w := 0
+		for {
+			dw := ad.decodeInt(&iadw)
+			if dw == oob {
+				break
+			}
+			if len(syms) == n {
+				return nil, FormatError("too many symbols")
+			}
+			if w += dw; w < 0 {
+				return nil, FormatError("bad symbol width")
+			}
+			var m *img1b.Image
+			if !p.refAgg {
+				m, err = decodeGenericArith(ad, gcx, w, h, gp)
+			} else {
+				m, err = decodeAggregate(ad, tcx, syms, w, h, codeLen, &iaai, p)
+			}
+			if err != nil {
+				return nil, err
+			}
+			syms = append(syms, m)
+			if ad.exhausted() {
+				return nil, errTruncated
+			}
+		}
+	}
+
+	return exportSymbols(syms, p.numEx, func() (int, error) {
+		run, err := ad.decodeNum(&iaex)
+		if err == nil && ad.exhausted() {
+			err = errTruncated
+		}
+		return run, err
+	})
+}
+
+// exportSymbols returns the symbols exported by the runs of export flags,
+// as per ITU-T T.88 section 6.5.10.
+func exportSymbols(syms []*img1b.Image, numEx int, run func() (int, error)) ([]*img1b.Image, error) {
+	var ex []*img1b.Image
+	export := false
+	for i := 0; i < len(syms); export = !export {
+		n, err := run()
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || n > len(syms)-i {
+			return nil, FormatError("bad export run")
+		}
+		if export {
+			ex = append(ex, syms[i:i+n]...)
+		}
+		i += n
+	}
+	if len(ex) != numEx {
+		return nil, FormatError("bad number of exported symbols")
+	}
+	return ex, nil
+}
+
+// decodeSymbolsHuffman decodes a Huffman coded symbol dictionary, as per
+// ITU-T T.88 section 6.5.5, and returns the exported symbols. Without
+// refinement and aggregation, the symbols of a height class are cut out of
+// a collective bitmap.
+func decodeSymbolsHuffman(r *bitReader, p *symbolParams) ([]*img1b.Image, error) {
+	n := len(p.in) + p.numNew
+	codeLen := codeLen(n)
+	var gr []context
+	if p.refAgg {
+		gr = make([]context, numRefineContexts(p.rtemplate))
+	}
+	c := p.numNew
+	if c > 1024 {
+		c = 1024
+	}
+	syms := append(make([]*img1b.Image, 0, len(p.in)+c), p.in...)
+	h := 0
+	for len(syms) < n {
+		dh, err := r.decodeNum(p.dh)
+		if err != nil {
+			return nil, err
+		}
+		if h += dh; h < 0 {
+			return nil, FormatError("bad symbol height")
+		}
+		w := 0
+		var widths []int
+		for {
+			dw := r.decodeInt(p.dw)
+			if r.err != nil {
+				return nil, r.err
+			}
+			if dw == oob {
+				break
+			}
+			if len(syms)+len(widths) == n {
+				return nil, FormatError("too many symbols")
+			}
+			if w += dw; w < 0 {
+				return nil, FormatError("bad symbol width")
+			}
+			if !p.refAgg {
+				widths = append(widths, w)
+				continue
+			}
+			m, err := decodeAggregateHuffman(r, gr, syms, w, h, codeLen, p)
+			if err != nil {
+				return nil, err
+			}
+			syms = append(syms, m)
+		}
+		if !p.refAgg {
+			if syms, err = decodeCollective(r, syms, widths, h, p.bmSize, p.limits); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return exportSymbols(syms, p.numEx, func() (int, error) {
+		return r.decodeNum(stdTables[0])
+	})
+}
+
+// decodeCollective decodes the collective bitmap of a height class of
+// symbols with the given widths and appends the symbols to syms, as per
+// ITU-T T.88 section 6.5.9.
+func decodeCollective(r *bitReader, syms []*img1b.Image, widths []int, h int, bmSize *huffTable, l *img1b.Limits) ([]*img1b.Image, error) {
+	size, err := r.decodeNum(bmSize)
+	if err != nil {
+		return nil, err
+	}
+	w := 0
+	for _, sw := range widths {
+		if w += sw; w > maxField {
+			return nil, UnsupportedError("bitmap size")
+		}
+	}
+	var m *img1b.Image
+	if size == 0 {
+		// Uncompressed, with the rows padded to bytes.
+		if m, err = newBitmap(l, w, h); err != nil {
+			return nil, err
+		}
+		stride := (w + 7) / 8
+		data := r.bytes(stride * h)
+		if r.err != nil {
+			return nil, r.err
+		}
+		for y := 0; y < h; y++ {
+			copy(m.Pix[y*m.Stride:], data[y*stride:(y+1)*stride])
+		}
+	} else {
+		data := r.bytes(size)
+		if r.err != nil {
+			return nil, r.err
+		}
+		if m, err = decodeGenericMMR(data, w, h, l); err != nil {
+			return nil, err
+		}
+	}
+	x := 0
+	for _, sw := range widths {
+		s, err := newBitmap(l, sw, h)
+		if err != nil {
+			return nil, err
+		}
+		compose(s, m, -x, 0, opReplace)
+		syms = append(syms, s)
+		x += sw
+	}
+	return syms, nil
+}
+
+// decodeAggregate decodes a w×h symbol coded by refinement or aggregation
+// of the symbols decoded so far, as per ITU-T T.88 section 6.5.8.2.
+func decodeAggregate(ad *arithDecoder, cx *textContexts, syms []*img1b.Image, w, h int, codeLen uint, iaai *intContexts, p *symbolParams) (*img1b.Image, error) {
+	n, err := ad.decodeNum(iaai)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, FormatError("bad aggregate instance count")
+	}
+	if n > 1 {
+		return decodeText(&arithText{ad, cx}, p.aggregate(syms, w, h, n, codeLen))
+	}
+	id := ad.decodeID(cx.iaid, codeLen)
+	if id >= len(syms) {
+		return nil, FormatError("bad symbol ID")
+	}
+	var d [2]int
+	for i, c := range []*intContexts{&cx.iardx, &cx.iardy} {
+		if d[i], err = ad.decodeNum(c); err != nil {
+			return nil, err
+		}
+	}
+	return decodeRefine(ad, cx.gr, w, h, p.refinement(syms[id], d[0], d[1]))
+}
+
+// aggregateTables are the Huffman tables of the text regions aggregating
+// symbols, as per ITU-T T.88 table 17.
+var aggregateTables = &textTables{
+	fs:    stdTables[5],
+	ds:    stdTables[7],
+	dt:    stdTables[10],
+	rdw:   stdTables[14],
+	rdh:   stdTables[14],
+	rdx:   stdTables[14],
+	rdy:   stdTables[14],
+	rsize: stdTables[0],
+}
+
+// decodeAggregateHuffman is decodeAggregate for Huffman coded dictionaries.
+// Refinements are arithmetic coded in separate runs of bytes.
+func decodeAggregateHuffman(r *bitReader, gr []context, syms []*img1b.Image, w, h int, codeLen uint, p *symbolParams) (*img1b.Image, error) {
+	n, err := r.decodeNum(p.aggInst)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, FormatError("bad aggregate instance count")
+	}
+	if n > 1 {
+		src := &huffText{r: r, t: aggregateTables, gr: gr}
+		return decodeText(src, p.aggregate(syms, w, h, n, codeLen))
+	}
+	id := r.bits(codeLen)
+	var d [2]int
+	for i := range d {
+		if d[i], err = r.decodeNum(stdTables[14]); err != nil {
+			return nil, err
+		}
+	}
+	size, err := r.decodeNum(stdTables[0])
+	if err != nil {
+		return nil, err
+	}
+	data := r.bytes(size)
+	if r.err != nil {
+		return nil, r.err
+	}
+	if id >= len(syms) {
+		return nil, FormatError("bad symbol ID")
+	}
+	return decodeRefine(newArithDecoder(data), gr, w, h, p.refinement(syms[id], d[0], d[1]))
+}
+
+// aggregate returns the parameters of the text region aggregating n of the
+// symbols syms into a w×h symbol, as per ITU-T T.88 table 17.
+func (p *symbolParams) aggregate(syms []*img1b.Image, w, h, n int, codeLen uint) *textParams {
+	return &textParams{
+		w:            w,
+		h:            h,
+		numInstances: n,
+		syms:         syms,
+		codeLen:      codeLen,
+		op:           opOr,
+		corner:       cornerTopLeft,
+		refine:       true,
+		rtemplate:    p.rtemplate,
+		rat:          p.rat,
+		limits:       p.limits,
+	}
+}
+
+// refinement returns the parameters of the refinement of the symbol ref
+// with the offset (dx, dy), as per ITU-T T.88 section 6.5.8.2.2.
+func (p *symbolParams) refinement(ref *img1b.Image, dx, dy int) *refineParams {
+	return &refineParams{
+		template: p.rtemplate,
+		at:       p.rat,
+		ref:      ref,
+		dx:       dx,
+		dy:       dy,
+		limits:   p.limits,
+	}
+}
+
+// encodeSymbols codes the symbols as a symbol dictionary without input
+// symbols that exports all of them, which is the inverse of decodeSymbols.
+// The symbols must be sorted by height.
+func encodeSymbols(ae *arithEncoder, syms []*img1b.Image, p *genericParams) {
+	var iadh, iadw, iaex intContexts
+	gcx := make([]context, numContexts(p.template))
+	h := 0
+	for i := 0; i < len(syms); {
+		ae.encodeInt(&iadh, syms[i].Rect.Dy()-h)
+		h = syms[i].Rect.Dy()
+		w := 0
+		for ; i < len(syms) && syms[i].Rect.Dy() == h; i++ {
+			ae.encodeInt(&iadw, syms[i].Rect.Dx()-w)
+			w = syms[i].Rect.Dx()
+			encodeGenericArith(ae, gcx, syms[i], p, false)
+		}
+		ae.encodeInt(&iadw, oob)
+	}
+	if len(syms) > 0 {
+		ae.encodeInt(&iaex, 0)
+		ae.encodeInt(&iaex, len(syms))
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// Reference corners of text region symbol instances, as per ITU-T T.88
+// section 7.4.3.1.1. Bit 0 is set for the top corners, bit 1 for the right
+// ones.
+const (
+	cornerBottomLeft = iota
+	cornerTopLeft
+	cornerBottomRight
+	cornerTopRight
+)
+
+// textParams are the parameters of the text region decoding procedure, as
+// per ITU-T T.88 table 9.
+type textParams struct {
+	w, h         int
+	numInstances int
+	logStrips    uint
+	syms         []*img1b.Image
+	codeLen      uint
+	defaultPixel bool
+	op           int
+	transposed   bool
+	corner       int
+	dsOffset     int
+	refine       bool
+	rtemplate    int
+	rat          [2]image.Point
+	limits       *img1b.Limits
+}
+
+// textContexts are the contexts of text region coding. Symbol dictionaries
+// using refinement and aggregation share them with their text regions.
+type textContexts struct {
+	iadt, iafs, iads, iait intContexts
+	iari, iardw, iardh     intContexts
+	iardx, iardy           intContexts
+	iaid                   []context
+	gr                     []context // refinement contexts
+}
+
+func newTextContexts(codeLen uint, rtemplate int) *textContexts {
+	return &textContexts{
+		iaid: make([]context, 2<<codeLen),
+		gr:   make([]context, numRefineContexts(rtemplate)),
+	}
+}
+
+// A textSource decodes the values of a text region, as per ITU-T T.88
+// section 6.4, which are arithmetic or Huffman coded.
+type textSource interface {
+	dt() (int, error)
+	fs() (int, error)
+	// ds returns oob at the end of a strip.
+	ds() (int, error)
+	it(p *textParams) (int, error)
+	id(p *textParams) (int, error)
+	ri() (int, error)
+	// refine decodes the refinement of the symbol ib.
+	refine(ib *img1b.Image, p *textParams) (*img1b.Image, error)
+	exhausted() bool
+}
+
+// arithText decodes the values of an arithmetic coded text region.
+type arithText struct {
+	ad *arithDecoder
+	cx *textContexts
+}
+
+func (t *arithText) dt() (int, error) { return t.ad.decodeNum(&t.cx.iadt) }
+func (t *arithText) fs() (int, error) { return t.ad.decodeNum(&t.cx.iafs) }
+func (t *arithText) ds() (int, error) { return t.ad.decodeInt(&t.cx.iads), nil }
+func (t *arithText) ri() (int, error) { return t.ad.decodeNum(&t.cx.iari) }
+func (t *arithText) exhausted() bool  { return t.ad.exhausted() }
+
+func (t *arithText) it(p *textParams) (int, error) {
+	return t.ad.decodeNum(&t.cx.iait)
+}
+
+func (t *arithText) id(p *textParams) (int, error) {
+	return t.ad.decodeID(t.cx.iaid, p.codeLen), nil
+}
+
+func (t *arithText) refine(ib *img1b.Image, p *textParams) (*img1b.Image, error) {
+	var d [4]int
+	for i, c := range []*intContexts{&t.cx.iardw, &t.cx.iardh, &t.cx.iardx, &t.cx.iardy} {
+		v, err := t.ad.decodeNum(c)
+		if err != nil {
+			return nil, err
+		}
+		d[i] = v
+	}
+	return refineInstance(t.ad, t.cx.gr, ib, d, p)
+}
+
+// textTables are the Huffman tables of text region coding, as per ITU-T
+// T.88 table 9.
+type textTables struct {
+	fs, ds, dt         *huffTable
+	rdw, rdh, rdx, rdy *huffTable
+	rsize              *huffTable
+}
+
+// huffText decodes the values of a Huffman coded text region.
+type huffText struct {
+	r   *bitReader
+	t   *textTables
+	ids *huffTable // symbol ID codes, or nil for codes of p.codeLen bits
+	gr  []context  // refinement contexts
+}
+
+func (t *huffText) dt() (int, error) { return t.r.decodeNum(t.t.dt) }
+func (t *huffText) fs() (int, error) { return t.r.decodeNum(t.t.fs) }
+func (t *huffText) exhausted() bool  { return t.r.exhausted() }
+
+func (t *huffText) ds() (int, error) {
+	v := t.r.decodeInt(t.t.ds)
+	return v, t.r.err
+}
+
+func (t *huffText) it(p *textParams) (int, error) {
+	v := t.r.bits(p.logStrips)
+	return v, t.r.err
+}
+
+func (t *huffText) id(p *textParams) (int, error) {
+	if t.ids != nil {
+		return t.r.decodeNum(t.ids)
+	}
+	v := t.r.bits(p.codeLen)
+	return v, t.r.err
+}
+
+func (t *huffText) ri() (int, error) {
+	v := t.r.bit()
+	return v, t.r.err
+}
+
+// refine decodes the refinement of the symbol ib, which is arithmetic coded
+// in a separate run of bytes, as per ITU-T T.88 section 6.4.11.
+func (t *huffText) refine(ib *img1b.Image, p *textParams) (*img1b.Image, error) {
+	var d [4]int
+	for i, tt := range []*huffTable{t.t.rdw, t.t.rdh, t.t.rdx, t.t.rdy} {
+		v, err := t.r.decodeNum(tt)
+		if err != nil {
+			return nil, err
+		}
+		d[i] = v
+	}
+	n, err := t.r.decodeNum(t.t.rsize)
+	if err != nil {
+		return nil, err
+	}
+	data := t.r.bytes(n)
+	if t.r.err != nil {
+		return nil, t.r.err
+	}
+	return refineInstance(newArithDecoder(data), t.gr, ib, d, p)
+}
+
+// errOOB reports an out-of-band value where a number is required.
+var errOOB = FormatError("unexpected out-of-band value")
+
+// decodeNum decodes an integer that must not be out-of-band.
+func (d *arithDecoder) decodeNum(cx *intContexts) (int, error) {
+	v := d.decodeInt(cx)
+	if v == oob {
+		return 0, errOOB
+	}
+	return v, nil
+}
+
+// fill sets all pixels of m.
+func fill(m *img1b.Image) {
+	w := m.Rect.Dx()
+	if w == 0 {
+		return
+	}
+	tm := bitmap.TailMask(w)
+	for y := 0; y < m.Rect.Dy(); y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+(w+7)/8]
+		for i := range row {
+			row[i] = 0xff
+		}
+		row[len(row)-1] &= tm
+	}
+}
+
+// decodeText decodes a text region, as per ITU-T T.88 section 6.4.5.
+func decodeText(src textSource, p *textParams) (*img1b.Image, error) {
+	m, err := newBitmap(p.limits, p.w, p.h)
+	if err != nil {
+		return nil, err
+	}
+	if p.defaultPixel {
+		fill(m)
+	}
+	strips := 1 << p.logStrips
+	stripT, err := src.dt()
+	if err != nil {
+		return nil, err
+	}
+	stripT *= -strips
+	firstS := 0
+	for n := 0; n < p.numInstances; {
+		if src.exhausted() {
+			return nil, errTruncated
+		}
+		dt, err := src.dt()
+		if err != nil {
+			return nil, err
+		}
+		stripT += dt * strips
+		dfs, err := src.fs()
+		if err != nil {
+			return nil, err
+		}
+		firstS += dfs
+		curS := firstS
+		for {
+			curT := 0
+			if strips > 1 {
+				if curT, err = src.it(p); err != nil {
+					return nil, err
+				}
+			}
+			t := stripT + curT
+			id, err := src.id(p)
+			if err != nil {
+				return nil, err
+			}
+			if id >= len(p.syms) {
+				return nil, FormatError("bad symbol ID")
+			}
+			ib := p.syms[id]
+			ri := 0
+			if p.refine {
+				if ri, err = src.ri(); err != nil {
+					return nil, err
+				}
+			}
+			if ri != 0 {
+				if ib, err = src.refine(ib, p); err != nil {
+					return nil, err
+				}
+			}
+			wi, hi := ib.Rect.Dx(), ib.Rect.Dy()
+			right, bottom := p.corner&2 != 0, p.corner&1 == 0
+			switch {
+			case !p.transposed && right:
+				curS += wi - 1
+			case p.transposed && bottom:
+				curS += hi - 1
+			}
+			s := curS
+			if p.transposed {
+				s, t = t, s
+			}
+			x, y := s, t
+			if right {
+				x -= wi - 1
+			}
+			if bottom {
+				y -= hi - 1
+			}
+			compose(m, ib, x, y, p.op)
+			switch {
+			case !p.transposed && !right:
+				curS += wi - 1
+			case p.transposed && !bottom:
+				curS += hi - 1
+			}
+			n++
+
+			ds, err := src.ds()
+			if err != nil {
+				return nil, err
+			}
+			if ds == oob {
+				break
+			}
+			if n >= p.numInstances {
+				return nil, FormatError("too many symbol instances")
+			}
+			curS += ds + p.dsOffset
+		}
+	}
+	return m, nil
+}
+
+// refineInstance decodes the refinement of the symbol ib given the size
+// and offset differences d: RDW, RDH, RDX and RDY, as per ITU-T T.88
+// section 6.4.11.
+func refineInstance(ad *arithDecoder, gr []context, ib *img1b.Image, d [4]int, p *textParams) (*img1b.Image, error) {
+	rp := &refineParams{
+		template: p.rtemplate,
+		at:       p.rat,
+		ref:      ib,
+		dx:       d[0]>>1 + d[2],
+		dy:       d[1]>>1 + d[3],
+		limits:   p.limits,
+	}
+	return decodeRefine(ad, gr, ib.Rect.Dx()+d[0], ib.Rect.Dy()+d[1], rp)
+}
+
+// An instance is a symbol placed in a text region.
+type instance struct {
+	id   int
+	x, y int
+	// If refine is set, the instance is coded as a refinement of the symbol
+	// and m holds its own bitmap.
+	refine bool
+	m      *img1b.Image
+}
+
+// encodeText codes the symbol instances as a text region with the
+// reference corner at the bottom left, which is the inverse of decodeText.
+// The instances must be sorted by strip, then by x. Only p.logStrips,
+// p.syms, p.codeLen, p.refine, p.rtemplate and p.rat are used.
+func encodeText(ae *arithEncoder, cx *textContexts, inst []instance, p *textParams) {
+	strips := 1 << p.logStrips
+	ae.encodeInt(&cx.iadt, 0)
+	stripT, firstS := 0, 0
+	for i := 0; i < len(inst); {
+		h := p.syms[inst[i].id].Rect.Dy()
+		strip := (inst[i].y + h - 1) &^ (strips - 1)
+		ae.encodeInt(&cx.iadt, (strip-stripT)/strips)
+		stripT = strip
+		ae.encodeInt(&cx.iafs, inst[i].x-firstS)
+		firstS = inst[i].x
+		curS := firstS
+		for {
+			in := &inst[i]
+			sym := p.syms[in.id]
+			if strips > 1 {
+				ae.encodeInt(&cx.iait, in.y+sym.Rect.Dy()-1-strip)
+			}
+			ae.encodeID(cx.iaid, p.codeLen, in.id)
+			if p.refine {
+				if !in.refine {
+					ae.encodeInt(&cx.iari, 0)
+				} else {
+					ae.encodeInt(&cx.iari, 1)
+					// Refinements keep the size and position of the symbol.
+					for _, c := range []*intContexts{&cx.iardw, &cx.iardh, &cx.iardx, &cx.iardy} {
+						ae.encodeInt(c, 0)
+					}
+					encodeRefine(ae, cx.gr, in.m, &refineParams{
+						template: p.rtemplate,
+						at:       p.rat,
+						ref:      sym,
+					})
+				}
+			}
+			curS += sym.Rect.Dx() - 1
+			i++
+			if i == len(inst) || (inst[i].y+p.syms[inst[i].id].Rect.Dy()-1)&^(strips-1) != strip {
+				ae.encodeInt(&cx.iads, oob)
+				break
+			}
+			ae.encodeInt(&cx.iads, inst[i].x-curS)
+			curS = inst[i].x
+		}
+	}
+}
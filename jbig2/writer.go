@@ -0,0 +1,303 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"io"
+	"sort"
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	// MMR selects MMR (CCITT Group 4) coding instead of arithmetic coding.
+	MMR bool
+
+	// Template is the generic region template, 0 to 3, of arithmetic
+	// coding. Template 0 uses the largest context and compresses best.
+	Template int
+
+	// TPGDON enables typical prediction: rows equal to the previous row
+	// are coded with a single bit.
+	TPGDON bool
+
+	// Symbols enables symbol coding: the connected components of the image
+	// are collected in a symbol dictionary, coded with Template, and placed
+	// by a text region. Repeated shapes such as the characters of a text
+	// are then coded only once. MMR and TPGDON are ignored.
+	Symbols bool
+
+	// Threshold is the largest fraction of pixels in which a component may
+	// differ from the symbol it is coded with. Zero only allows exact
+	// matches, larger values compress better, but the coding becomes lossy
+	// unless Refine is set.
+	Threshold float64
+
+	// Refine codes the differences between components and their symbols as
+	// refinements, so that symbol coding with a Threshold stays lossless.
+	Refine bool
+}
+
+// segmentWriter writes segments with increasing numbers.
+type segmentWriter struct {
+	w      *bufio.Writer
+	number uint32
+}
+
+// write writes a segment with a short header referring to at most four
+// segments.
+func (sw *segmentWriter) write(typ int, page uint32, data []byte, refs ...uint32) error {
+	h := make([]byte, 6, 32)
+	binary.BigEndian.PutUint32(h[0:], sw.number)
+	h[4] = byte(typ)
+	h[5] = byte(len(refs) << 5) // no retained segments
+	for _, r := range refs {
+		switch {
+		case sw.number <= 256:
+			h = append(h, byte(r))
+		case sw.number <= 65536:
+			h = append(h, byte(r>>8), byte(r))
+		default:
+			h = append(h, byte(r>>24), byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	if page > 0xff {
+		h[4] |= 0x40
+		h = append(h, byte(page>>24), byte(page>>16), byte(page>>8), byte(page))
+	} else {
+		h = append(h, byte(page))
+	}
+	sw.number++
+	if _, err := sw.w.Write(h); err != nil {
+		return err
+	}
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(data)))
+	if _, err := sw.w.Write(l[:]); err != nil {
+		return err
+	}
+	_, err := sw.w.Write(data)
+	return err
+}
+
+// writePage writes the page information and generic region segments of m.
+func (sw *segmentWriter) writePage(page uint32, m *img1b.Image, opt *Options) error {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 || int64(w)*int64(h) > maxField {
+		return UnsupportedError("image size")
+	}
+	if opt == nil {
+		opt = &Options{}
+	}
+	if opt.Template < 0 || opt.Template > 3 {
+		return UnsupportedError("generic template")
+	}
+	lossless := !opt.Symbols || opt.Threshold == 0 || opt.Refine
+
+	var info [19]byte
+	binary.BigEndian.PutUint32(info[0:], uint32(w))
+	binary.BigEndian.PutUint32(info[4:], uint32(h))
+	// Unknown resolution, white default pixel, OR combination operator, no
+	// striping.
+	if lossless {
+		info[16] = 0x01
+	}
+	if err := sw.write(stPageInformation, page, info[:]); err != nil {
+		return err
+	}
+	if opt.Symbols {
+		return sw.writeText(page, m, opt, lossless)
+	}
+
+	data := make([]byte, regionInfoLen+1, regionInfoLen+1+8)
+	binary.BigEndian.PutUint32(data[0:], uint32(w))
+	binary.BigEndian.PutUint32(data[4:], uint32(h))
+	// At (0, 0) with the OR combination operator.
+	p := &genericParams{
+		mmr:      opt.MMR,
+		template: opt.Template,
+		tpgdon:   opt.TPGDON,
+	}
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	if p.mmr {
+		data[regionInfoLen] = 1
+		data = append(data, ccitt.EncodeRows(m.Pix, m.Stride, w, h, &ccitt.Options{
+			K:          -1,
+			EndOfBlock: true,
+			Invert:     invert,
+		})...)
+	} else {
+		data[regionInfoLen] = byte(p.template << 1)
+		if p.tpgdon {
+			data[regionInfoLen] |= 0x08
+		}
+		p.at = nominalAT(p.template)
+		data = appendAT(data, p.at[:numAT(p.template)])
+		ae := newArithEncoder()
+		encodeGenericArith(ae, make([]context, numContexts(p.template)), m, p, invert)
+		data = append(data, ae.flush()...)
+	}
+	return sw.write(stImmediateLosslessGeneric, page, data)
+}
+
+// numAT returns the number of adaptive template pixels of a generic
+// template.
+func numAT(template int) int {
+	if template == 0 {
+		return 4
+	}
+	return 1
+}
+
+// appendAT appends adaptive template pixels to data.
+func appendAT(data []byte, at []image.Point) []byte {
+	for _, p := range at {
+		data = append(data, byte(int8(p.X)), byte(int8(p.Y)))
+	}
+	return data
+}
+
+// appendU32 appends a big-endian 32-bit number to data.
+func appendU32(data []byte, v int) []byte {
+	return append(data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// logStrips is the base 2 logarithm of the strip size of encoded text
+// regions.
+const logStrips = 2
+
+// writeText writes the symbol dictionary and text region segments of m.
+func (sw *segmentWriter) writeText(page uint32, m *img1b.Image, opt *Options, lossless bool) error {
+	b := blackBitmap(m, bitmap.BlackIndex(m.Palette) == 0)
+	comps := components(b)
+	syms, ids := classify(comps, opt.Threshold)
+	if len(syms) > 1<<24 {
+		return UnsupportedError("number of symbols")
+	}
+
+	// The dictionary codes the symbols in classes of equal height.
+	order := make([]int, len(syms))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := syms[order[i]].Rect.Size(), syms[order[j]].Rect.Size()
+		return a.Y < b.Y || a.Y == b.Y && a.X < b.X
+	})
+	sorted := make([]*img1b.Image, len(syms))
+	index := make([]int, len(syms))
+	for i, o := range order {
+		sorted[i] = syms[o]
+		index[o] = i
+	}
+	p := &genericParams{template: opt.Template, at: nominalAT(opt.Template)}
+	data := []byte{byte(opt.Template << 2), 0}
+	data = appendAT(data, p.at[:numAT(p.template)])
+	data = appendU32(data, len(sorted))
+	data = appendU32(data, len(sorted))
+	ae := newArithEncoder()
+	encodeSymbols(ae, sorted, p)
+	dict := sw.number
+	if err := sw.write(stSymbolDictionary, page, append(data, ae.flush()...)); err != nil {
+		return err
+	}
+
+	inst := make([]instance, len(comps))
+	refine := false
+	for i, c := range comps {
+		inst[i] = instance{id: index[ids[i]], x: c.r.Min.X, y: c.r.Min.Y}
+		if opt.Refine && mismatch(c.m, syms[ids[i]], 0) > 0 {
+			inst[i].refine, inst[i].m = true, c.m
+			refine = true
+		}
+	}
+	// Instances are coded by strips of their bottom rows.
+	strip := func(in *instance) int {
+		return (in.y + sorted[in.id].Rect.Dy() - 1) >> logStrips
+	}
+	sort.SliceStable(inst, func(i, j int) bool {
+		a, b := strip(&inst[i]), strip(&inst[j])
+		return a < b || a == b && inst[i].x < inst[j].x
+	})
+	tp := &textParams{
+		logStrips: logStrips,
+		syms:      sorted,
+		codeLen:   codeLen(len(sorted)),
+		refine:    refine,
+		rat:       nominalRefineAT,
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	data = make([]byte, regionInfoLen, regionInfoLen+2+4+4)
+	binary.BigEndian.PutUint32(data[0:], uint32(w))
+	binary.BigEndian.PutUint32(data[4:], uint32(h))
+	// Bottom left reference corner, OR combination operator, refinement
+	// template 0.
+	flags := logStrips << 2
+	if refine {
+		flags |= 0x02
+	}
+	data = append(data, byte(flags>>8), byte(flags))
+	if refine {
+		data = appendAT(data, tp.rat[:])
+	}
+	data = appendU32(data, len(inst))
+	ae = newArithEncoder()
+	encodeText(ae, newTextContexts(tp.codeLen, 0), inst, tp)
+	typ := stImmediateTextRegion
+	if lossless {
+		typ = stImmediateLosslessTextRegion
+	}
+	return sw.write(typ, page, append(data, ae.flush()...), dict)
+}
+
+// Encode writes the image m to w as a JBIG2 file with a single page. If opt
+// is nil, the page is a generic region arithmetic coded with template 0.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	return EncodeAll(w, []*img1b.Image{m}, opt)
+}
+
+// EncodeAll writes the images as the pages of a JBIG2 file.
+func EncodeAll(w io.Writer, pages []*img1b.Image, opt *Options) error {
+	if len(pages) == 0 {
+		return FormatError("no pages")
+	}
+	sw := &segmentWriter{w: bufio.NewWriter(w)}
+	var h [13]byte
+	copy(h[:], fileID)
+	h[8] = 0x01 // sequential organization, known number of pages
+	binary.BigEndian.PutUint32(h[9:], uint32(len(pages)))
+	if _, err := sw.w.Write(h[:]); err != nil {
+		return err
+	}
+	for i, m := range pages {
+		if err := sw.writePage(uint32(i+1), m, opt); err != nil {
+			return err
+		}
+		if err := sw.write(stEndOfPage, uint32(i+1), nil); err != nil {
+			return err
+		}
+	}
+	if err := sw.write(stEndOfFile, 0, nil); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// EncodeEmbedded writes the image m to w as an embedded JBIG2 stream, the
+// form used by the PDF JBIG2Decode filter. The stream holds all segments of
+// page 1 and needs no global segments.
+func EncodeEmbedded(w io.Writer, m *img1b.Image, opt *Options) error {
+	sw := &segmentWriter{w: bufio.NewWriter(w)}
+	if err := sw.writePage(1, m, opt); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
@@ -0,0 +1,290 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jbig2
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+var encodeTests = []struct {
+	name string
+	opt  *Options
+}{
+	{"default", nil},
+	{"template 1", &Options{Template: 1}},
+	{"template 2", &Options{Template: 2}},
+	{"template 3", &Options{Template: 3}},
+	{"TPGDON", &Options{TPGDON: true}},
+	{"template 2 TPGDON", &Options{Template: 2, TPGDON: true}},
+	{"MMR", &Options{MMR: true}},
+	{"symbols", &Options{Symbols: true}},
+	{"symbols template 3", &Options{Symbols: true, Template: 3}},
+	{"symbols refine", &Options{Symbols: true, Threshold: 0.2, Refine: true}},
+}
+
+// scanBitmap returns a bitmap resembling a scanned page: blank margins and
+// rows, blocks of noise and some shapes.
+func scanBitmap() *img1b.Image {
+	rnd := rand.New(rand.NewSource(1))
+	m := img1b.New(image.Rect(0, 0, 203, 150), palette())
+	for y := 20; y < 130; y++ {
+		if y%20 >= 12 {
+			continue
+		}
+		for x := 15; x < 190; x++ {
+			if rnd.Intn(3) == 0 || (x/9+y/4)%5 == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// glyphs are the shapes of textBitmap, '#' is black.
+var glyphs = [][]string{
+	{
+		"..##..",
+		".#..#.",
+		"#....#",
+		"######",
+		"#....#",
+		"#....#",
+	},
+	{
+		"#####.",
+		"#....#",
+		"#####.",
+		"#....#",
+		"#....#",
+		"#####.",
+	},
+	{
+		".####",
+		"#....",
+		"#....",
+		"#....",
+		"#....",
+		".####",
+	},
+	{
+		"#",
+		"#",
+		"#",
+		"#",
+		".",
+		"#",
+	},
+}
+
+// textBitmap returns a bitmap resembling a page of text: lines of repeated
+// glyphs, some of them with a flipped pixel.
+func textBitmap() *img1b.Image {
+	rnd := rand.New(rand.NewSource(1))
+	m := img1b.New(image.Rect(0, 0, 300, 120), palette())
+	for y := 5; y+8 < 120; y += 10 {
+		for x := 3; x+8 < 300; x += 9 {
+			g := glyphs[rnd.Intn(len(glyphs))]
+			for gy, row := range g {
+				for gx := range row {
+					if row[gx] == '#' {
+						m.SetColorIndex(x+gx, y+gy, 1)
+					}
+				}
+			}
+			if rnd.Intn(8) == 0 {
+				x1, y1 := x+rnd.Intn(len(g[0])), y+1+rnd.Intn(len(g)-2)
+				m.SetColorIndex(x1, y1, 1-m.ColorIndexAt(x1, y1))
+			}
+		}
+	}
+	return m
+}
+
+func TestEncodeSymbols(t *testing.T) {
+	m := textBitmap()
+	var generic bytes.Buffer
+	Encode(&generic, m, nil)
+	for _, tt := range []struct {
+		name     string
+		opt      *Options
+		lossless bool
+	}{
+		{"exact", &Options{Symbols: true}, true},
+		{"refine", &Options{Symbols: true, Threshold: 0.1, Refine: true}, true},
+		{"lossy", &Options{Symbols: true, Threshold: 0.1}, false},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if buf.Len() >= generic.Len() {
+			t.Errorf("%s: %d bytes, generic region %d bytes", tt.name, buf.Len(), generic.Len())
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.lossless {
+			checkPixels(t, tt.name, m1, m.ColorIndexAt)
+			continue
+		}
+		diff := 0
+		for y := 0; y < m.Rect.Dy(); y++ {
+			for x := 0; x < m.Rect.Dx(); x++ {
+				if m1.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) {
+					diff++
+				}
+			}
+		}
+		if diff == 0 || diff > 30*5 {
+			t.Errorf("%s: %d pixels differ", tt.name, diff)
+		}
+	}
+}
+
+func TestComponents(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 16, 4), palette())
+	for _, p := range []image.Point{{0, 0}, {1, 1}, {2, 0}, {9, 0}, {9, 2}, {15, 3}} {
+		m.SetColorIndex(p.X, p.Y, 1)
+	}
+	want := []image.Rectangle{
+		image.Rect(0, 0, 3, 2),
+		image.Rect(9, 0, 10, 1),
+		image.Rect(9, 2, 10, 3),
+		image.Rect(15, 3, 16, 4),
+	}
+	comps := components(m)
+	if len(comps) != len(want) {
+		t.Fatalf("got %d components, want %d", len(comps), len(want))
+	}
+	for i, c := range comps {
+		if c.r != want[i] {
+			t.Errorf("component %d: got %v, want %v", i, c.r, want[i])
+		}
+	}
+	if got := comps[0].m.ColorIndexAt(1, 0); got != 0 {
+		t.Errorf("got %d in the gap of component 0", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m0 := scanBitmap()
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if m1.Bounds() != m0.Bounds() {
+			t.Errorf("%s: got bounds %v", tt.name, m1.Bounds())
+			continue
+		}
+		checkPixels(t, tt.name, m1, m0.ColorIndexAt)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	m := scanBitmap()
+	n := m.Bounds().Dx() * m.Bounds().Dy()
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		d := Decoder{Limits: &img1b.Limits{MaxPixels: int64(n)}}
+		if _, err := d.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("%s: at the limit: %v", tt.name, err)
+		}
+		d.Limits.MaxPixels--
+		_, err := d.Decode(bytes.NewReader(buf.Bytes()))
+		if _, ok := err.(img1b.LimitError); !ok {
+			t.Errorf("%s: got %v, want LimitError", tt.name, err)
+		}
+	}
+}
+
+func TestEncodeCompresses(t *testing.T) {
+	m := scanBitmap()
+	var plain, tp bytes.Buffer
+	Encode(&plain, m, nil)
+	Encode(&tp, m, &Options{TPGDON: true})
+	if raw := len(m.Pix); plain.Len() >= raw {
+		t.Errorf("encoded %d bytes, raw %d bytes", plain.Len(), raw)
+	}
+	if tp.Len() >= plain.Len() {
+		t.Errorf("TPGDON %d bytes, plain %d bytes", tp.Len(), plain.Len())
+	}
+}
+
+func TestEncodePalette(t *testing.T) {
+	// Set bits are white here, so they are coded inverted.
+	m0 := scanBitmap()
+	m0.Palette = color.Palette{color.Black, color.White}
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		if err := EncodeEmbedded(&buf, m0.SubImage(image.Rect(8, 10, 150, 90)), tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		m1, err := DecodeEmbedded(buf.Bytes(), nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		checkPixels(t, tt.name, m1, func(x, y int) uint8 { return 1 - m0.ColorIndexAt(x+8, y+10) })
+	}
+}
+
+func TestEncodeAll(t *testing.T) {
+	pages := []*img1b.Image{scanBitmap(), testBitmap(33, 17), scanBitmap()}
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, pages, &Options{TPGDON: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(pages) {
+		t.Fatalf("got %d pages, want %d", len(got), len(pages))
+	}
+	for i, m := range got {
+		checkPixels(t, "page", m, pages[i].ColorIndexAt)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	m := scanBitmap()
+	b.SetBytes(int64(len(m.Pix)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Encode(ioutil.Discard, m, nil)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	var buf bytes.Buffer
+	m := scanBitmap()
+	Encode(&buf, m, nil)
+	b.SetBytes(int64(len(m.Pix)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Decode(bytes.NewReader(buf.Bytes()))
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+)
+
+// Labels number the objects of an image: the pixels of each object have a
+// label from 1 to Count, and the other pixels 0.
+type Labels struct {
+	Rect image.Rectangle
+	// L holds the labels, row by row, Rect.Dx() to a row.
+	L []int32
+	// Count is the number of objects.
+	Count int
+}
+
+// At returns the label of the pixel at (x, y), 0 outside Rect.
+func (l *Labels) At(x, y int) int {
+	if !(image.Point{x, y}.In(l.Rect)) {
+		return 0
+	}
+	return int(l.L[(y-l.Rect.Min.Y)*l.Rect.Dx()+x-l.Rect.Min.X])
+}
+
+// Areas returns the number of pixels of each label, by label; the first is
+// that of the pixels of no object.
+func (l *Labels) Areas() []int {
+	a := make([]int, l.Count+1)
+	for _, k := range l.L {
+		a[k]++
+	}
+	return a
+}
+
+// Mask returns an image of the object of label k: its pixels are black,
+// of color index 1, on white.
+func (l *Labels) Mask(k int) *Image {
+	m := New(l.Rect, color.Palette{color.White, color.Black})
+	w := l.Rect.Dx()
+	for i, v := range l.L {
+		if int(v) == k {
+			x, y := i%w, i/w
+			m.Pix[y*m.Stride+x>>3] |= 0x80 >> uint(x&7)
+		}
+	}
+	return m
+}
+
+// Label numbers the 8-connected components of the set pixels, of color
+// index 1, of m, from the top left. Color indices are used; the palette is
+// not looked at.
+func Label(m *Image) *Labels {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	l := &Labels{Rect: m.Rect}
+	if w <= 0 || h <= 0 {
+		l.Rect = image.Rectangle{}
+		return l
+	}
+	l.L = make([]int32, w*h)
+	var stack []int
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride:]
+		for x := 0; x < w; x++ {
+			if l.L[y*w+x] != 0 || !bitAt(row, x) {
+				continue
+			}
+			l.Count++
+			k := int32(l.Count)
+			l.L[y*w+x] = k
+			stack = append(stack[:0], y*w+x)
+			for len(stack) > 0 {
+				i := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				px, py := i%w, i/w
+				for dy := -1; dy <= 1; dy++ {
+					ny := py + dy
+					if ny < 0 || ny >= h {
+						continue
+					}
+					nrow := m.Pix[ny*m.Stride:]
+					for dx := -1; dx <= 1; dx++ {
+						nx := px + dx
+						if nx < 0 || nx >= w || l.L[ny*w+nx] != 0 || !bitAt(nrow, nx) {
+							continue
+						}
+						l.L[ny*w+nx] = k
+						stack = append(stack, ny*w+nx)
+					}
+				}
+			}
+		}
+	}
+	return l
+}
+
+// renumber numbers the labels of l in the order of their first pixels,
+// from 1, and sets Count.
+func (l *Labels) renumber() {
+	var next int32
+	seen := make(map[int32]int32)
+	for i, k := range l.L {
+		if k == 0 {
+			continue
+		}
+		n, ok := seen[k]
+		if !ok {
+			next++
+			n = next
+			seen[k] = n
+		}
+		l.L[i] = n
+	}
+	l.Count = int(next)
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import "testing"
+
+func TestLabel(t *testing.T) {
+	m := picture(
+		"##..#.",
+		"....#.",
+		".#....",
+		"#..##.",
+		"....##",
+	)
+	l := Label(m)
+	if l.Count != 4 {
+		t.Fatalf("got %d labels, want 4", l.Count)
+	}
+	want := []int32{
+		1, 1, 0, 0, 2, 0,
+		0, 0, 0, 0, 2, 0,
+		0, 3, 0, 0, 0, 0,
+		3, 0, 0, 4, 4, 0,
+		0, 0, 0, 0, 4, 4,
+	}
+	for i := range want {
+		if l.L[i] != want[i] {
+			t.Fatalf("labels %v, want %v", l.L, want)
+		}
+	}
+	if a := l.Areas(); a[0] != 20 || a[1] != 2 || a[4] != 4 {
+		t.Errorf("areas %v", a)
+	}
+	if got := art(l.Mask(3)); got != art(picture(
+		"......",
+		"......",
+		".#....",
+		"#.....",
+		"......",
+	)) {
+		t.Errorf("mask of 3:\n%s", got)
+	}
+	if l.At(1, 2) != 3 || l.At(-1, 0) != 0 {
+		t.Error("At is wrong")
+	}
+}
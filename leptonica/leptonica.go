@@ -0,0 +1,91 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package leptonica converts images to and from the pixel data of 1 bpp
+// Leptonica PIX, for cgo code handing bitmaps to Leptonica or Tesseract.
+//
+// A PIX row is wpl 32-bit words, the leftmost pixel of a word in its most
+// significant bit, so that in memory the bytes of a word are swapped on
+// little endian machines. Set bits are black. The data are handled here as
+// []uint32, which reads the words in the byte order of the machine as
+// Leptonica does: a slice over pixGetData works as is.
+package leptonica
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the dimensions or the data are not valid.
+type FormatError string
+
+func (e FormatError) Error() string { return "leptonica: invalid format: " + string(e) }
+
+// WordsPerLine returns the words of a row of the given width, as
+// Leptonica pads it.
+func WordsPerLine(width int) int {
+	return (width + 31) / 32
+}
+
+// ToPIXData returns the pixels of m laid out as the data of a 1 bpp PIX of
+// the same size, black set, and its words per line. The padding bits are
+// zero.
+func ToPIXData(m *img1b.Image) (data []uint32, wpl int) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	wpl = WordsPerLine(w)
+	data = make([]uint32, wpl*h)
+	if w == 0 {
+		return data, wpl
+	}
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	row := make([]byte, 4*wpl)
+	for y := 0; y < h; y++ {
+		copy(row, m.Pix[y*m.Stride:y*m.Stride+n])
+		if invert {
+			for i := range row[:n] {
+				row[i] = ^row[i]
+			}
+		}
+		row[n-1] &= tm
+		words := data[y*wpl : (y+1)*wpl]
+		for i := range words {
+			words[i] = binary.BigEndian.Uint32(row[4*i:])
+		}
+	}
+	return data, wpl
+}
+
+// FromPIXData returns a new image of the given size with the pixels of the
+// data of a 1 bpp PIX, wpl words per line. The palette is {white, black}.
+func FromPIXData(data []uint32, width, height, wpl int) (*img1b.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, FormatError(fmt.Sprintf("invalid size: %dx%d", width, height))
+	}
+	if wpl < WordsPerLine(width) {
+		return nil, FormatError(fmt.Sprintf("%d words per line too few for width %d", wpl, width))
+	}
+	if int64(wpl)*int64(height) > int64(len(data)) {
+		return nil, FormatError("short data")
+	}
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	n := (width + 7) / 8
+	tm := bitmap.TailMask(width)
+	var buf [4]byte
+	for y := 0; y < height; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+n]
+		words := data[y*wpl:]
+		for i := 0; i < n; i += 4 {
+			binary.BigEndian.PutUint32(buf[:], words[i/4])
+			copy(row[i:], buf[:])
+		}
+		row[n-1] &= tm
+	}
+	return m, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package leptonica
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// pixel returns the pixel at (x, y) of PIX data as Leptonica's GET_DATA_BIT
+// does.
+func pixel(data []uint32, wpl, x, y int) uint8 {
+	return uint8(data[y*wpl+x/32] >> uint(31-x%32) & 1)
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, w := range []int{1, 8, 31, 32, 33, 100} {
+		for _, p := range []color.Palette{{color.White, color.Black}, {color.Black, color.White}} {
+			m := img1b.New(image.Rect(0, 0, w, 5), p)
+			r.Read(m.Pix)
+			data, wpl := ToPIXData(m)
+			if wpl != (w+31)/32 || len(data) != 5*wpl {
+				t.Fatalf("width %d: wpl %d, %d words", w, wpl, len(data))
+			}
+			for y := 0; y < 5; y++ {
+				for x := 0; x < 32*wpl; x++ {
+					want := uint8(0)
+					if x < w && m.At(x, y) == color.Black {
+						want = 1
+					}
+					if got := pixel(data, wpl, x, y); got != want {
+						t.Fatalf("width %d, palette %v: (%d, %d) is %d, want %d", w, p, x, y, got, want)
+					}
+				}
+			}
+			back, err := FromPIXData(data, w, 5, wpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < 5; y++ {
+				for x := 0; x < w; x++ {
+					if back.At(x, y) != m.At(x, y) {
+						t.Fatalf("width %d, palette %v: (%d, %d) differs", w, p, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFromPIXDataErrors(t *testing.T) {
+	data := make([]uint32, 6)
+	for _, tc := range []struct{ w, h, wpl int }{
+		{0, 1, 1},
+		{33, 3, 1},
+		{32, 4, 2},
+	} {
+		if _, err := FromPIXData(data, tc.w, tc.h, tc.wpl); err == nil {
+			t.Errorf("%+v: no error", tc)
+		}
+	}
+	if _, err := FromPIXData(data, 40, 3, 2); err != nil {
+		t.Errorf("wider stride: %v", err)
+	}
+}
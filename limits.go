@@ -0,0 +1,75 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+)
+
+// Limits bounds what a decoder may allocate for an image, to guard against
+// untrusted input declaring huge dimensions. The decoders that take Limits
+// check them once the dimensions are known, before reading the pixels. A
+// nil *Limits sets no limits, and allocates with make.
+type Limits struct {
+	// MaxPixels is the largest number of pixels of an image; 0 means no
+	// limit.
+	MaxPixels int64
+	// MaxBytes is the largest number of bytes of the pixels of an image,
+	// Stride×height; 0 means no limit.
+	MaxBytes int64
+	// Alloc, if not nil, allocates the pixels of the images, returning n
+	// zero bytes. It may return nil to refuse the allocation, for instance
+	// to keep the memory of several decodings in a budget; a slice with a
+	// capacity of less than n bytes is taken as a refusal too.
+	Alloc func(n int) []byte
+}
+
+// A LimitError reports that an image exceeds Limits.
+type LimitError string
+
+func (e LimitError) Error() string { return "img1b: limit exceeded: " + string(e) }
+
+// Check returns a LimitError if an image of the given size exceeds l.
+func (l *Limits) Check(width, height int) error {
+	if width < 0 || height < 0 {
+		return LimitError("negative dimensions")
+	}
+	if l == nil {
+		return nil
+	}
+	size := func() string { return strconv.Itoa(width) + "x" + strconv.Itoa(height) }
+	// mul2NonNeg gives -1 on overflow, which no limit allows.
+	if n := mul2NonNeg(width, height); l.MaxPixels > 0 && (n < 0 || int64(n) > l.MaxPixels) {
+		return LimitError(size() + " is more than " + strconv.FormatInt(l.MaxPixels, 10) + " pixels")
+	}
+	if n := mul2NonNeg((width+7)/8, height); l.MaxBytes > 0 && (n < 0 || int64(n) > l.MaxBytes) {
+		return LimitError(size() + " is more than " + strconv.FormatInt(l.MaxBytes, 10) + " bytes")
+	}
+	return nil
+}
+
+// New returns a new Image as New does, once the size has passed Check,
+// with its pixels from Alloc.
+func (l *Limits) New(r image.Rectangle, p color.Palette) (*Image, error) {
+	w, h := r.Dx(), r.Dy()
+	if err := l.Check(w, h); err != nil {
+		return nil, err
+	}
+	if l == nil || l.Alloc == nil {
+		return New(r, p), nil
+	}
+	stride := (w + 7) / 8
+	n := mul2NonNeg(h, stride)
+	if n < 0 {
+		return nil, LimitError("huge dimensions")
+	}
+	pix := l.Alloc(n)
+	if cap(pix) < n {
+		return nil, LimitError("allocation of " + strconv.Itoa(n) + " bytes refused")
+	}
+	return &Image{Pix: pix[:n], Stride: stride, Rect: r, Palette: p, pc: newPaletteCache(p), own: true}, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	l := &Limits{MaxPixels: 1000, MaxBytes: 100}
+	for _, tc := range []struct {
+		w, h int
+		ok   bool
+	}{
+		{10, 10, true},
+		{40, 20, true},
+		{1001, 1, false},
+		{9, 50, true},
+		{9, 51, false},
+		{math.MaxInt32, math.MaxInt32, false},
+		{-1, 1, false},
+	} {
+		err := l.Check(tc.w, tc.h)
+		if (err == nil) != tc.ok {
+			t.Errorf("%dx%d: %v", tc.w, tc.h, err)
+		}
+		if _, isLimit := err.(LimitError); err != nil && !isLimit {
+			t.Errorf("%dx%d: %T is not a LimitError", tc.w, tc.h, err)
+		}
+	}
+	var none *Limits
+	if err := none.Check(math.MaxInt32, math.MaxInt32); err != nil {
+		t.Errorf("nil Limits: %v", err)
+	}
+}
+
+func TestLimitsNew(t *testing.T) {
+	budget := 50
+	l := &Limits{Alloc: func(n int) []byte {
+		if n > budget {
+			return nil
+		}
+		budget -= n
+		return make([]byte, n)
+	}}
+	pal := color.Palette{color.White, color.Black}
+	m, err := l.New(image.Rect(0, 0, 20, 10), pal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Pix) != 30 || m.Stride != 3 || budget != 20 {
+		t.Errorf("got %d bytes, stride %d, budget left %d", len(m.Pix), m.Stride, budget)
+	}
+	m.SetColorIndex(1, 1, 1)
+	if m.ColorIndexAt(1, 1) != 1 {
+		t.Error("Set had no effect")
+	}
+	if _, err := l.New(image.Rect(0, 0, 20, 10), pal); err == nil {
+		t.Error("refused allocation: no error")
+	}
+	short := &Limits{Alloc: func(n int) []byte { return make([]byte, n-1) }}
+	if _, err := short.New(image.Rect(0, 0, 20, 10), pal); err == nil {
+		t.Error("short allocation: no error")
+	}
+	var none *Limits
+	if m, err := none.New(image.Rect(0, 0, 9, 2), pal); err != nil || len(m.Pix) != 4 {
+		t.Errorf("nil Limits: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package macpaint
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"strings"
+	"testing"
+)
+
+// testPixel is the pattern of the test image.
+func testPixel(x, y int) uint8 {
+	if y < 100 && (x/7+y/3)%4 == 0 || y == 719 && x < 9 {
+		return 1
+	}
+	return 0
+}
+
+// testFile returns a MacPaint file of the test image. Rows are packed with
+// runs and literals of up to 8 bytes, the last run crosses into the next
+// row.
+func testFile(macBinary bool) []byte {
+	var b bytes.Buffer
+	if macBinary {
+		h := make([]byte, macBinaryLen)
+		copy(h[1:], "\x0ePicture")
+		copy(h[macBinaryTypeAt:], "PNTGMPNT")
+		b.Write(h)
+	}
+	h := make([]byte, headerLen)
+	h[3] = 2
+	b.Write(h)
+	pix := make([]byte, width*height/8)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pix[y*width/8+x/8] |= testPixel(x, y) << uint(7-x%8)
+		}
+	}
+	for i := 0; i < len(pix); {
+		n := 1
+		for n < 8 && i+n < len(pix) && pix[i+n] == pix[i] {
+			n++
+		}
+		if n > 1 {
+			b.Write([]byte{byte(1 - n), pix[i]})
+		} else {
+			for n < 8 && i+n < len(pix) && pix[i+n] != pix[i+n-1] {
+				n++
+			}
+			b.WriteByte(byte(n - 1))
+			b.Write(pix[i : i+n])
+		}
+		i += n
+		if i == 8 {
+			b.WriteByte(0x80) // no-op
+		}
+	}
+	return b.Bytes()
+}
+
+func check(t *testing.T, m *img1b.Image) {
+	t.Helper()
+	if m.Bounds().Dx() != width || m.Bounds().Dy() != height {
+		t.Fatalf("got bounds %v", m.Bounds())
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if got, want := m.ColorIndexAt(x, y), testPixel(x, y); got != want {
+				t.Fatalf("at (%d, %d) got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, mb := range []bool{false, true} {
+		m, err := Decode(bytes.NewReader(testFile(mb)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, m)
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	cfg, err := DecodeConfig(bytes.NewReader(testFile(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != width || cfg.Height != height {
+		t.Errorf("got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	data := testFile(false)
+	long := append(append([]byte(nil), data[:len(data)-2]...), 0x81, 0)
+	for _, tt := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "unexpected EOF"},
+		{append([]byte{0, 0, 1}, make([]byte, 600)...), "not a MacPaint file"},
+		{data[:len(data)-1], "unexpected EOF"},
+		{long, "run past the end"},
+	} {
+		m, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+		if m != nil {
+			t.Error("have image + error")
+		}
+	}
+}
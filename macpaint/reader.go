@@ -0,0 +1,137 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package macpaint implements a decoder for MacPaint (PNTG) images.
+//
+// MacPaint images are always 576x720 pixels. A 512 byte header holding the
+// version and the fill patterns is followed by the PackBits compressed rows
+// of 72 bytes, set bits are black. Files with a MacBinary header, as
+// produced when transferring them from a Macintosh, are also read.
+//
+// Decoded images use the palette {white, black}.
+//
+// The format is described in Apple Technical Note PT24, "MacPaint Document
+// Format".
+package macpaint
+
+import (
+	"bufio"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io"
+)
+
+// A FormatError reports that the input is not a valid MacPaint image.
+type FormatError string
+
+func (e FormatError) Error() string { return "macpaint: invalid format: " + string(e) }
+
+// Image dimensions and header lengths.
+const (
+	width           = 576
+	height          = 720
+	headerLen       = 512
+	macBinaryLen    = 128
+	macBinaryTypeAt = 65
+)
+
+// palette returns the palette of decoded images.
+func palette() color.Palette {
+	return color.Palette{color.White, color.Black}
+}
+
+// readHeader skips the MacBinary header, if any, and the MacPaint header.
+func readHeader(r *bufio.Reader) error {
+	p, err := r.Peek(macBinaryTypeAt + 4)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(p) == macBinaryTypeAt+4 && p[0] == 0 && string(p[macBinaryTypeAt:]) == "PNTG" {
+		if _, err := r.Discard(macBinaryLen); err != nil {
+			return err
+		}
+	}
+	var h [headerLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return err
+	}
+	// The version is 0, 2 or 3, the high bytes are zero.
+	if h[0] != 0 || h[1] != 0 || h[2] != 0 || h[3] > 3 {
+		return FormatError("not a MacPaint file")
+	}
+	return nil
+}
+
+// unpackBits decodes PackBits data from r into dst. Runs may cross rows.
+func unpackBits(r *bufio.Reader, dst []byte) error {
+	for i := 0; i < len(dst); {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		n := int(int8(c))
+		switch {
+		case n >= 0:
+			n++
+			if n > len(dst)-i {
+				return FormatError("run past the end of the image")
+			}
+			if _, err := io.ReadFull(r, dst[i:i+n]); err != nil {
+				return err
+			}
+		case n > -128:
+			n = 1 - n
+			if n > len(dst)-i {
+				return FormatError("run past the end of the image")
+			}
+			v, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			for j := i; j < i+n; j++ {
+				dst[j] = v
+			}
+		default:
+			// -128 is a no-op.
+			n = 0
+		}
+		i += n
+	}
+	return nil
+}
+
+// Decode reads a MacPaint image from r and returns it as an img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	br := bufio.NewReader(r)
+	err := readHeader(br)
+	var img *img1b.Image
+	if err == nil {
+		img = img1b.New(image.Rect(0, 0, width, height), palette())
+		err = unpackBits(br, img.Pix)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a MacPaint image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	if err := readHeader(bufio.NewReader(r)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: palette(),
+		Width:      width,
+		Height:     height,
+	}, nil
+}
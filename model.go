@@ -0,0 +1,61 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image/color"
+)
+
+// A BitModel is a color.Model converting colors to the nearer in luminance
+// of the two colors of a palette. It is much faster than the search of
+// color.Palette.Convert, which looks for the nearest color in RGBA space;
+// for the two colors of a bilevel image, typically black and white, the
+// results mostly agree.
+type BitModel struct {
+	colors [2]color.Color
+	// Colors with their luminance doubled up to mid are of index dark.
+	mid  uint32
+	dark uint8
+}
+
+// NewBitModel returns the BitModel of the first two colors of p. A missing
+// color is taken to be white.
+func NewBitModel(p color.Palette) *BitModel {
+	m := &BitModel{colors: [2]color.Color{color.White, color.White}}
+	copy(m.colors[:], p)
+	l0, l1 := bitmap.Luma(m.colors[0]), bitmap.Luma(m.colors[1])
+	switch {
+	case l1 < l0:
+		m.mid, m.dark = l0+l1, 1
+	case l0 < l1:
+		m.mid = l0 + l1
+	default:
+		// Colors of the same luminance make everything index 0.
+		m.mid = 0x20000
+	}
+	return m
+}
+
+// Convert returns the color of the palette nearer to c in luminance.
+func (m *BitModel) Convert(c color.Color) color.Color {
+	return m.colors[m.Index(c)]
+}
+
+// Index returns the index of the color of the palette nearer to c in
+// luminance. Ties go to the darker color.
+func (m *BitModel) Index(c color.Color) uint8 {
+	r, g, b, _ := c.RGBA()
+	return m.index(r, g, b)
+}
+
+// index is Index for a color with the given premultiplied components.
+func (m *BitModel) index(r, g, b uint32) uint8 {
+	l := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	if 2*l <= m.mid {
+		return m.dark
+	}
+	return m.dark ^ 1
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestBitModel(t *testing.T) {
+	dark := color.RGBA{0x20, 0x10, 0x40, 0xff}
+	light := color.Gray{0xc0}
+	for _, tc := range []struct {
+		pal  color.Palette
+		c    color.Color
+		want uint8
+	}{
+		{color.Palette{color.White, color.Black}, color.Black, 1},
+		{color.Palette{color.White, color.Black}, color.White, 0},
+		{color.Palette{color.White, color.Black}, color.Gray{0x7f}, 1},
+		{color.Palette{color.White, color.Black}, color.Gray{0x80}, 0},
+		{color.Palette{color.Black, color.White}, color.Gray{0x7f}, 0},
+		{color.Palette{color.Black, color.White}, color.Gray{0x80}, 1},
+		{color.Palette{color.Black, color.White}, color.RGBA{0xff, 0, 0, 0xff}, 0},
+		{color.Palette{color.Black, color.White}, color.RGBA{0, 0xff, 0, 0xff}, 1},
+		{color.Palette{dark, light}, color.Gray{0x60}, 0},
+		{color.Palette{dark, light}, color.Gray{0x90}, 1},
+		{color.Palette{light, dark}, color.Gray{0x90}, 0},
+		// A missing color is white.
+		{color.Palette{color.Black}, color.Gray{0xf0}, 1},
+		{color.Palette{}, color.Black, 0},
+		// Colors of the same luminance.
+		{color.Palette{color.Gray{0x40}, color.Gray{0x40}}, color.White, 0},
+		{color.Palette{color.Gray{0x40}, color.Gray{0x40}}, color.Black, 0},
+	} {
+		m := NewBitModel(tc.pal)
+		if got := m.Index(tc.c); got != tc.want {
+			t.Errorf("%v: Index(%v) = %d, want %d", tc.pal, tc.c, got, tc.want)
+		}
+		want := color.Color(color.White)
+		if int(tc.want) < len(tc.pal) {
+			want = tc.pal[tc.want]
+		}
+		if got := m.Convert(tc.c); got != want {
+			t.Errorf("%v: Convert(%v) = %v, want %v", tc.pal, tc.c, got, want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 256, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 256; x++ {
+			g.Pix[y*g.Stride+x] = uint8(x)
+		}
+	}
+	for _, pal := range []color.Palette{
+		{color.White, color.Black},
+		{color.Black, color.White},
+	} {
+		m := New(image.Rect(-3, 1, 253, 4), pal)
+		draw.Draw(m, m.Rect, g, image.Point{}, draw.Src)
+		for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+			for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+				v := x - m.Rect.Min.X
+				want := color.Color(color.White)
+				if v < 0x80 {
+					want = color.Black
+				}
+				if got := m.At(x, y); got != want {
+					t.Fatalf("%v: pixel (%d, %d) of gray %d is %v, want %v", pal, x, y, v, got, want)
+				}
+			}
+		}
+
+		m.SetRGBA64(0, 1, color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff})
+		if got := m.At(0, 1); got != color.White {
+			t.Errorf("%v: SetRGBA64 white gives %v", pal, got)
+		}
+		m.SetRGBA64(0, 1, color.RGBA64{0, 0, 0, 0xffff})
+		if got := m.At(0, 1); got != color.Black {
+			t.Errorf("%v: SetRGBA64 black gives %v", pal, got)
+		}
+		// Outside the image nothing happens.
+		m.Set(-4, 1, color.Black)
+		m.Set(0, 4, color.Black)
+	}
+
+	// Set changes a copy-on-write image, not the image it shares pixels
+	// with.
+	m := New(image.Rect(0, 0, 16, 2), color.Palette{color.White, color.Black})
+	s := m.CowSubImage(m.Rect)
+	s.Set(1, 1, color.Black)
+	if m.ColorIndexAt(1, 1) != 0 || s.ColorIndexAt(1, 1) != 1 {
+		t.Error("Set on a copy-on-write image shows through")
+	}
+}
+
+func TestColorModel(t *testing.T) {
+	// Set stores the color ColorModel converts to, as draw.Image requires.
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	for _, pal := range []color.Palette{
+		{color.White, color.Black},
+		{color.RGBA{0x80, 0, 0, 0xff}, color.RGBA{0, 0x60, 0, 0xff}},
+	} {
+		m := New(image.Rect(0, 0, 8, 1), pal)
+		b := NewBig(m.Rect, pal)
+		for _, c := range []color.Color{red, color.Gray{0x50}, color.Gray{0x80}, color.Transparent} {
+			m.Set(0, 0, c)
+			b.Set(0, 0, c)
+			if got, want := m.At(0, 0), m.ColorModel().Convert(c); got != want {
+				t.Errorf("%v: Set(%v) gives %v, ColorModel converts to %v", pal, c, got, want)
+			}
+			if got, want := b.At(0, 0), b.ColorModel().Convert(c); got != want {
+				t.Errorf("%v: BigImage Set(%v) gives %v, ColorModel converts to %v", pal, c, got, want)
+			}
+		}
+	}
+	if _, ok := New(image.Rect(0, 0, 1, 1), color.Palette{color.Black}).ColorModel().(color.Palette); !ok {
+		t.Error("one color palette: ColorModel is not the palette")
+	}
+}
+
+func BenchmarkSetColor(b *testing.B) {
+	m := New(image.Rect(0, 0, 64, 64), color.Palette{color.White, color.Black})
+	c := color.Gray{0x70}
+	for i := 0; i < b.N; i++ {
+		m.Set(i&63, i>>6&63, c)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"math"
+)
+
+// Moments are the moments of a shape, a set of pixels, up to order 3.
+// Pixels are at the integer coordinates of their top left corners.
+type Moments struct {
+	// Raw are the raw moments: Raw[p][q] is the sum of x^p·y^q over the
+	// pixels, for p+q up to 3; the others are 0.
+	Raw [4][4]float64
+	// Central are the moments about the centroid, likewise.
+	Central [4][4]float64
+}
+
+// Area returns the number of pixels of the shape.
+func (m *Moments) Area() float64 { return m.Raw[0][0] }
+
+// Centroid returns the center of mass of the shape, (0, 0) if it is empty.
+func (m *Moments) Centroid() (x, y float64) {
+	if m.Raw[0][0] == 0 {
+		return 0, 0
+	}
+	return m.Raw[1][0] / m.Raw[0][0], m.Raw[0][1] / m.Raw[0][0]
+}
+
+// Normalized returns the normalized central moment of order p, q: the
+// central moment scaled to be the same for the shape at any size.
+func (m *Moments) Normalized(p, q int) float64 {
+	a := m.Central[0][0]
+	if a == 0 {
+		return 0
+	}
+	return m.Central[p][q] / math.Pow(a, 1+float64(p+q)/2)
+}
+
+// Hu returns the seven invariant moments of Hu, which are the same for the
+// shape moved, scaled and rotated; the seventh changes sign for the shape
+// mirrored. Shapes of a few pixels only match their turned copies
+// roughly, the pixels being square.
+func (m *Moments) Hu() [7]float64 {
+	n20, n02, n11 := m.Normalized(2, 0), m.Normalized(0, 2), m.Normalized(1, 1)
+	n30, n03 := m.Normalized(3, 0), m.Normalized(0, 3)
+	n21, n12 := m.Normalized(2, 1), m.Normalized(1, 2)
+	a, b := n30+n12, n21+n03
+	return [7]float64{
+		n20 + n02,
+		(n20-n02)*(n20-n02) + 4*n11*n11,
+		(n30-3*n12)*(n30-3*n12) + (3*n21-n03)*(3*n21-n03),
+		a*a + b*b,
+		(n30-3*n12)*a*(a*a-3*b*b) + (3*n21-n03)*b*(3*a*a-b*b),
+		(n20-n02)*(a*a-b*b) + 4*n11*a*b,
+		(3*n21-n03)*a*(a*a-3*b*b) - (n30-3*n12)*b*(3*a*a-b*b),
+	}
+}
+
+// add adds the pixels from (x0, y) to (x1-1, y) to the raw moments.
+func (m *Moments) add(x0, x1, y int) {
+	// The sums of the powers of x over the run.
+	var s [4]float64
+	for k := range s {
+		s[k] = powerSum(k, x1) - powerSum(k, x0)
+	}
+	fy := float64(y)
+	py := 1.0
+	for q := 0; q < 4; q++ {
+		for p := 0; p+q < 4; p++ {
+			m.Raw[p][q] += s[p] * py
+		}
+		py *= fy
+	}
+}
+
+// powerSum returns the sum of x^k for x from 0 to n-1, k up to 3; for
+// negative n, minus the sum from n to -1.
+func powerSum(k, n int) float64 {
+	f := float64(n)
+	switch k {
+	case 0:
+		return f
+	case 1:
+		return f * (f - 1) / 2
+	case 2:
+		return (f - 1) * f * (2*f - 1) / 6
+	}
+	t := f * (f - 1) / 2
+	return t * t
+}
+
+// central computes the central moments from the raw ones.
+func (m *Moments) central() {
+	r := &m.Raw
+	c := &m.Central
+	*c = [4][4]float64{}
+	c[0][0] = r[0][0]
+	if r[0][0] == 0 {
+		return
+	}
+	x, y := m.Centroid()
+	c[2][0] = r[2][0] - x*r[1][0]
+	c[0][2] = r[0][2] - y*r[0][1]
+	c[1][1] = r[1][1] - x*r[0][1]
+	c[3][0] = r[3][0] - 3*x*r[2][0] + 2*x*x*r[1][0]
+	c[0][3] = r[0][3] - 3*y*r[0][2] + 2*y*y*r[0][1]
+	c[2][1] = r[2][1] - 2*x*r[1][1] - y*r[2][0] + 2*x*x*r[0][1]
+	c[1][2] = r[1][2] - 2*y*r[1][1] - x*r[0][2] + 2*y*y*r[1][0]
+}
+
+// Moments returns the moments of the set pixels, of color index 1, of p.
+// Color indices are used; the palette is not looked at.
+func (p *Image) Moments() *Moments {
+	m := &Moments{}
+	p.eachRun(func(r Run) bool {
+		if r.Index == 1 {
+			m.add(r.X0, r.X1, r.Y)
+		}
+		return true
+	})
+	m.central()
+	return m
+}
+
+// Moments returns the moments of each object of l, by label; the first are
+// those of the pixels of no object.
+func (l *Labels) Moments() []*Moments {
+	ms := make([]*Moments, l.Count+1)
+	for i := range ms {
+		ms[i] = &Moments{}
+	}
+	w := l.Rect.Dx()
+	for y := 0; y < l.Rect.Dy(); y++ {
+		row := l.L[y*w : (y+1)*w]
+		for x := 0; x < w; {
+			k := row[x]
+			x0 := x
+			for x < w && row[x] == k {
+				x++
+			}
+			ms[k].add(l.Rect.Min.X+x0, l.Rect.Min.X+x, l.Rect.Min.Y+y)
+		}
+	}
+	for _, m := range ms {
+		m.central()
+	}
+	return ms
+}
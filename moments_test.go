@@ -0,0 +1,112 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// slowMoments sums the moments of the set pixels of m one by one.
+func slowMoments(m *Image) [4][4]float64 {
+	var r [4][4]float64
+	for y := m.Rect.Min.Y; y < m.Rect.Max.Y; y++ {
+		for x := m.Rect.Min.X; x < m.Rect.Max.X; x++ {
+			if m.ColorIndexAt(x, y) != 1 {
+				continue
+			}
+			for p := 0; p < 4; p++ {
+				for q := 0; p+q < 4; q++ {
+					r[p][q] += math.Pow(float64(x), float64(p)) * math.Pow(float64(y), float64(q))
+				}
+			}
+		}
+	}
+	return r
+}
+
+func near(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func TestMoments(t *testing.T) {
+	// An L shape off the origin, and the same turned a quarter, mirrored
+	// and twice the size.
+	shape := func(b image.Rectangle, scale int, f func(x, y int) (int, int)) *Image {
+		m := New(b, color.Palette{color.White, color.Black})
+		for y := 0; y < 12*scale; y++ {
+			for x := 0; x < 8*scale; x++ {
+				if x < 3*scale || y >= 9*scale {
+					px, py := f(x, y)
+					m.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+		return m
+	}
+	b := image.Rect(-20, -15, 30, 25)
+	l := shape(b, 1, func(x, y int) (int, int) { return x - 13, y + 2 })
+	mo := l.Moments()
+	if raw := slowMoments(l); mo.Raw != raw {
+		t.Errorf("raw moments %v, want %v", mo.Raw, raw)
+	}
+	if a := mo.Area(); a != 3*12+5*3 {
+		t.Errorf("area %v", a)
+	}
+	if cx, cy := mo.Centroid(); !near(cx, mo.Raw[1][0]/51, 1e-12) || !near(cy, mo.Raw[0][1]/51, 1e-12) {
+		t.Errorf("centroid (%v, %v)", cx, cy)
+	}
+	if mo.Central[1][0] != 0 || mo.Central[0][1] != 0 {
+		t.Error("first central moments not 0")
+	}
+
+	hu := mo.Hu()
+	for _, tc := range []struct {
+		name  string
+		m     *Image
+		tol   float64
+		flip7 bool
+	}{
+		{"moved", shape(b, 1, func(x, y int) (int, int) { return x + 5, y - 11 }), 1e-9, false},
+		{"turned", shape(b, 1, func(x, y int) (int, int) { return 5 - y, x - 3 }), 1e-9, false},
+		{"mirrored", shape(b, 1, func(x, y int) (int, int) { return 7 - x, y }), 1e-9, true},
+		{"scaled", shape(b, 2, func(x, y int) (int, int) { return x - 18, y - 12 }), 0.05, false},
+	} {
+		got := tc.m.Moments().Hu()
+		for i := range got {
+			want := hu[i]
+			if i == 6 && tc.flip7 {
+				want = -want
+			}
+			if !near(got[i], want, tc.tol) {
+				t.Errorf("%s: Hu moment %d is %v, want %v", tc.name, i+1, got[i], want)
+			}
+		}
+	}
+
+	// Per label, as for the mask of each object.
+	m := New(b, color.Palette{color.White, color.Black})
+	for y := 0; y < 10; y++ {
+		for x := -18; x < -10+y; x++ {
+			m.SetColorIndex(x, y, 1)
+		}
+		m.SetColorIndex(20+y%3, y, 1)
+	}
+	lb := Label(m)
+	ms := lb.Moments()
+	if len(ms) != lb.Count+1 {
+		t.Fatalf("%d moments for %d labels", len(ms), lb.Count)
+	}
+	for k := 1; k <= lb.Count; k++ {
+		if want := lb.Mask(k).Moments(); *ms[k] != *want {
+			t.Errorf("label %d: moments %v, want %v", k, ms[k], want)
+		}
+	}
+	if e := New(b, nil).Moments(); e.Area() != 0 || e.Hu() != [7]float64{} {
+		t.Errorf("empty shape: %v", e)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package omr reads the checkboxes and bubbles of forms and answer sheets
+// from bilevel scans.
+//
+// A template gives the places of the fields and of registration marks,
+// solid black boxes printed on the form, in pixels from the top left
+// corner of the page. Scans are seldom placed exactly: each mark is looked
+// for around its place, and each field is moved by the offsets of the
+// marks, the nearest ones counting most, which follows small rotations and
+// stretches of the page as well as shifts. A field is checked when enough
+// of its inside is black.
+package omr
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// A FormatError reports that the page does not match the template.
+type FormatError string
+
+func (e FormatError) Error() string { return "omr: invalid format: " + string(e) }
+
+// A Field is a checkbox or a bubble.
+type Field struct {
+	Name string
+	Rect image.Rectangle
+	// Round fields are measured in the ellipse inscribed in Rect.
+	Round bool
+}
+
+// A Template describes a form.
+type Template struct {
+	// Marks are the registration marks.
+	Marks  []image.Rectangle
+	Fields []Field
+}
+
+// Options are the reading parameters.
+type Options struct {
+	// Search is the largest distance in pixels a mark is looked for from
+	// its place, 20 if 0.
+	Search int
+	// Inset is the margin in pixels left out of the fields, so that their
+	// printed outlines do not count, 2 if 0. It is not used if negative.
+	Inset int
+	// Threshold is the share of black pixels from which a field is
+	// checked, 0.3 if 0.
+	Threshold float64
+}
+
+// A Result is the reading of a field.
+type Result struct {
+	Name string
+	// Rect is where the field was found on the page.
+	Rect image.Rectangle
+	// Fill is the share of black pixels of the field.
+	Fill    float64
+	Checked bool
+}
+
+// Read reads the fields of t from m, in the order of t.Fields. It fails
+// if t has marks and none of them is found.
+func Read(m *img1b.Image, t *Template, opt *Options) ([]Result, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.Search <= 0 {
+		o.Search = 20
+	}
+	if o.Inset == 0 {
+		o.Inset = 2
+	} else if o.Inset < 0 {
+		o.Inset = 0
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 0.3
+	}
+	p := newPage(m)
+	var marks []image.Rectangle
+	var offsets []image.Point
+	for _, r := range t.Marks {
+		if d, ok := p.findMark(r, o.Search); ok {
+			marks = append(marks, r)
+			offsets = append(offsets, d)
+		}
+	}
+	if len(t.Marks) > 0 && len(marks) == 0 {
+		return nil, FormatError("registration marks not found")
+	}
+	res := make([]Result, len(t.Fields))
+	for i, f := range t.Fields {
+		r := f.Rect.Add(offset(f.Rect, marks, offsets))
+		fill := p.fill(r.Inset(o.Inset), f.Round)
+		res[i] = Result{f.Name, r.Add(m.Rect.Min), fill, fill >= o.Threshold}
+	}
+	return res, nil
+}
+
+// offset returns the offset of a field at r: the mean of the offsets of
+// the marks weighted by the inverse of their squared distances to r.
+func offset(r image.Rectangle, marks []image.Rectangle, offsets []image.Point) image.Point {
+	if len(marks) == 0 {
+		return image.Point{}
+	}
+	c := center(r)
+	var sx, sy, sw float64
+	for i, mr := range marks {
+		d := center(mr).Sub(c)
+		w := 1 / float64(d.X*d.X+d.Y*d.Y+1)
+		sx += w * float64(offsets[i].X)
+		sy += w * float64(offsets[i].Y)
+		sw += w
+	}
+	return image.Pt(round(sx/sw), round(sy/sw))
+}
+
+func center(r image.Rectangle) image.Point {
+	return image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+}
+
+func round(v float64) int {
+	if v < 0 {
+		return -int(-v + 0.5)
+	}
+	return int(v + 0.5)
+}
+
+// A page reads the pixels of an image, from its top left corner.
+type page struct {
+	m   *img1b.Image
+	ink uint8
+}
+
+func newPage(m *img1b.Image) *page {
+	return &page{m, bitmap.BlackIndex(m.Palette)}
+}
+
+// black reports whether the pixel at (x, y) is black. Pixels outside are
+// white.
+func (p *page) black(x, y int) bool {
+	if x < 0 || y < 0 || x >= p.m.Rect.Dx() || y >= p.m.Rect.Dy() {
+		return false
+	}
+	return p.m.Pix[y*p.m.Stride+x>>3]>>uint(7-x&7)&1 == p.ink
+}
+
+// findMark looks for the mark at r up to search pixels away and returns
+// its offset. The mark is where a box of its size holds the most black
+// pixels, the nearest such place if several do, and must be at least half
+// black.
+func (p *page) findMark(r image.Rectangle, search int) (image.Point, bool) {
+	win := r.Inset(-search)
+	w, h := win.Dx(), win.Dy()
+	// The sums of the black pixels above and left of each point.
+	sum := make([]int, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		row := 0
+		for x := 0; x < w; x++ {
+			if p.black(win.Min.X+x, win.Min.Y+y) {
+				row++
+			}
+			sum[(y+1)*(w+1)+x+1] = sum[y*(w+1)+x+1] + row
+		}
+	}
+	rw, rh := r.Dx(), r.Dy()
+	best, bestN, bestD := image.Point{}, -1, 0
+	for dy := -search; dy <= search; dy++ {
+		for dx := -search; dx <= search; dx++ {
+			x0, y0 := search+dx, search+dy
+			n := sum[(y0+rh)*(w+1)+x0+rw] - sum[y0*(w+1)+x0+rw] - sum[(y0+rh)*(w+1)+x0] + sum[y0*(w+1)+x0]
+			d := dx*dx + dy*dy
+			if n > bestN || n == bestN && d < bestD {
+				best, bestN, bestD = image.Pt(dx, dy), n, d
+			}
+		}
+	}
+	return best, 2*bestN >= rw*rh && rw*rh > 0
+}
+
+// fill returns the share of black pixels in r, or in the ellipse inscribed
+// in it if round.
+func (p *page) fill(r image.Rectangle, round bool) float64 {
+	cx, cy := float64(r.Min.X+r.Max.X)/2, float64(r.Min.Y+r.Max.Y)/2
+	ax, ay := float64(r.Dx())/2, float64(r.Dy())/2
+	n, total := 0, 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if round {
+				dx, dy := (float64(x)+0.5-cx)/ax, (float64(y)+0.5-cy)/ay
+				if dx*dx+dy*dy > 1 {
+					continue
+				}
+			}
+			total++
+			if p.black(x, y) {
+				n++
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package omr
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/scan"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// sheet returns a template of 4 corner marks and a row of 6 boxes and 6
+// bubbles, and a page of it moved by d with the given fields filled.
+func sheet(d image.Point, filled map[int]bool) (*Template, *img1b.Image) {
+	t := &Template{}
+	for _, c := range []image.Point{{20, 20}, {360, 20}, {20, 260}, {360, 260}} {
+		t.Marks = append(t.Marks, image.Rect(c.X, c.Y, c.X+12, c.Y+12))
+	}
+	for i := 0; i < 6; i++ {
+		t.Fields = append(t.Fields, Field{Name: fmt.Sprint("box", i), Rect: image.Rect(60+50*i, 80, 76+50*i, 96)})
+		t.Fields = append(t.Fields, Field{Name: fmt.Sprint("bubble", i), Rect: image.Rect(60+50*i, 180, 78+50*i, 198), Round: true})
+	}
+	m := img1b.New(image.Rect(0, 0, 400, 300), color.Palette{color.White, color.Black})
+	set := func(x, y int) { m.SetColorIndex(x+d.X, y+d.Y, 1) }
+	for _, r := range t.Marks {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				set(x, y)
+			}
+		}
+	}
+	for i, f := range t.Fields {
+		r := f.Rect
+		cx, cy := float64(r.Min.X+r.Max.X)/2, float64(r.Min.Y+r.Max.Y)/2
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				dx, dy := (float64(x)+0.5-cx)/9, (float64(y)+0.5-cy)/9
+				inside := x > r.Min.X && x < r.Max.X-1 && y > r.Min.Y && y < r.Max.Y-1
+				if f.Round {
+					q := dx*dx + dy*dy
+					inside = q < 0.8
+					if q >= 0.8 && q <= 1 {
+						set(x, y)
+					}
+				} else if !inside {
+					set(x, y)
+				}
+				// Filled bubbles, crossed boxes.
+				if inside && filled[i] && (f.Round || x-r.Min.X-(y-r.Min.Y) <= 1 && x-r.Min.X-(y-r.Min.Y) >= -1 ||
+					x-r.Min.X+(y-r.Min.Y)-15 <= 1 && x-r.Min.X+(y-r.Min.Y)-15 >= -1) {
+					set(x, y)
+				}
+			}
+		}
+	}
+	return t, m
+}
+
+func TestRead(t *testing.T) {
+	filled := map[int]bool{0: true, 3: true, 5: true, 10: true}
+	for _, d := range []image.Point{{0, 0}, {7, -5}, {-12, 9}} {
+		tmpl, m := sheet(d, filled)
+		for _, rotate := range []float64{0, 1} {
+			p := m
+			if rotate != 0 {
+				p = scan.Rotate(m, rotate)
+			}
+			res, err := Read(p, tmpl, nil)
+			if err != nil {
+				t.Fatalf("moved %v, turned %g: %v", d, rotate, err)
+			}
+			for i, r := range res {
+				if r.Name != tmpl.Fields[i].Name {
+					t.Errorf("result %d is %s", i, r.Name)
+				}
+				if r.Checked != filled[i] {
+					t.Errorf("moved %v, turned %g: %s fill %.2f", d, rotate, r.Name, r.Fill)
+				}
+			}
+			if want := tmpl.Fields[0].Rect.Add(d); rotate == 0 && res[0].Rect != want {
+				t.Errorf("moved %v: %s at %v, want %v", d, res[0].Name, res[0].Rect, want)
+			}
+		}
+	}
+}
+
+func TestReadNoMarks(t *testing.T) {
+	tmpl, _ := sheet(image.Point{}, nil)
+	blank := img1b.New(image.Rect(0, 0, 400, 300), color.Palette{color.White, color.Black})
+	if _, err := Read(blank, tmpl, nil); err == nil {
+		t.Error("no error")
+	}
+	tmpl.Marks = nil
+	res, err := Read(blank, tmpl, &Options{Inset: -1})
+	if err != nil || len(res) != len(tmpl.Fields) || res[0].Checked {
+		t.Errorf("without marks: %v, %v", res, err)
+	}
+}
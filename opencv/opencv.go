@@ -0,0 +1,133 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package opencv converts images to and from the unpacked 8-bit single
+// channel buffers (CV_8UC1) OpenCV works on, for gocv users binarizing with
+// OpenCV and keeping the results packed.
+//
+// A buffer holds a byte per pixel: 0 for black and 255 for white. Packing
+// takes bytes below 128 as black, so it also thresholds grayscale buffers.
+// Rows are stride bytes apart, as the step of a Mat.
+package opencv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the dimensions or the buffer are not valid.
+type FormatError string
+
+func (e FormatError) Error() string { return "opencv: invalid format: " + string(e) }
+
+// check returns an error if a buffer of the given length cannot hold an
+// image of the given size with rows stride bytes apart.
+func check(n, width, height, stride int) error {
+	if width <= 0 || height <= 0 {
+		return FormatError(fmt.Sprintf("invalid size: %dx%d", width, height))
+	}
+	if stride < width {
+		return FormatError(fmt.Sprintf("stride %d too small for width %d", stride, width))
+	}
+	if int64(stride)*int64(height-1)+int64(width) > int64(n) {
+		return FormatError("short buffer")
+	}
+	return nil
+}
+
+// Unpack writes the pixels of m to dst, a byte per pixel with rows stride
+// bytes apart. The bytes between the rows are left as they are. It
+// returns an error if dst is too short or stride too small.
+func Unpack(dst []byte, stride int, m *img1b.Image) error {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if err := check(len(dst), w, h, stride); err != nil {
+		return err
+	}
+	// The 8 bytes of the pixels of each byte, the leftmost first.
+	var table [256]uint64
+	// The byte of set bits, those of color index 1.
+	set := byte(0)
+	if bitmap.BlackIndex(m.Palette) == 0 {
+		set = 0xff
+	}
+	for b := range table {
+		var v uint64
+		for k := 0; k < 8; k++ {
+			if byte(b)>>uint(7-k)&1 == 1 {
+				v |= uint64(set) << uint(8*k)
+			} else {
+				v |= uint64(^set) << uint(8*k)
+			}
+		}
+		table[b] = v
+	}
+	var buf [8]byte
+	for y := 0; y < h; y++ {
+		src := m.Pix[y*m.Stride:]
+		row := dst[y*stride : y*stride+w]
+		x := 0
+		for ; x+8 <= w; x += 8 {
+			binary.LittleEndian.PutUint64(row[x:], table[src[x>>3]])
+		}
+		if x < w {
+			binary.LittleEndian.PutUint64(buf[:], table[src[x>>3]])
+			copy(row[x:], buf[:])
+		}
+	}
+	return nil
+}
+
+// ToMat returns the pixels of m unpacked into a new buffer with rows
+// stride bytes apart, and the stride: the width rounded up to a multiple
+// of align bytes, or the width if align is below 2.
+func ToMat(m *img1b.Image, align int) (buf []byte, stride int) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	stride = w
+	if align > 1 {
+		stride = (w + align - 1) / align * align
+	}
+	buf = make([]byte, stride*h)
+	if w > 0 && h > 0 {
+		Unpack(buf, stride, m)
+	}
+	return buf, stride
+}
+
+// Pack returns a new image of the given size from src, a byte per pixel
+// with rows stride bytes apart, black where the bytes are below 128. The
+// palette is {black, white}, so that set bits are the white pixels as the
+// nonzero bytes are.
+func Pack(src []byte, width, height, stride int) (*img1b.Image, error) {
+	if err := check(len(src), width, height, stride); err != nil {
+		return nil, err
+	}
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	for y := 0; y < height; y++ {
+		row := src[y*stride : y*stride+width]
+		dst := m.Pix[y*m.Stride:]
+		x := 0
+		for ; x+8 <= width; x += 8 {
+			dst[x>>3] = packByte(binary.LittleEndian.Uint64(row[x:]))
+		}
+		if x < width {
+			var buf [8]byte
+			copy(buf[:], row[x:])
+			dst[x>>3] = packByte(binary.LittleEndian.Uint64(buf[:])) & bitmap.TailMask(width)
+		}
+	}
+	return m, nil
+}
+
+// packByte returns the top bits of the 8 bytes of v, the lowest byte
+// becoming the most significant bit. The multiplication moves the bit of
+// byte i to bit 63-i; the other products land below bit 56 or above bit 63,
+// and as they are distinct powers of two they do not carry.
+func packByte(v uint64) byte {
+	v = v & 0x8080808080808080 >> 7
+	return byte(v * 0x8040201008040201 >> 56)
+}
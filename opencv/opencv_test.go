@@ -0,0 +1,82 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package opencv
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, w := range []int{1, 7, 8, 9, 64, 77} {
+		for _, p := range []color.Palette{{color.White, color.Black}, {color.Black, color.White}} {
+			m := img1b.New(image.Rect(0, 0, w, 4), p)
+			r.Read(m.Pix)
+			buf, stride := ToMat(m, 16)
+			if stride%16 != 0 || stride < w {
+				t.Fatalf("width %d: stride %d", w, stride)
+			}
+			for y := 0; y < 4; y++ {
+				for x := 0; x < w; x++ {
+					want := byte(0xff)
+					if m.At(x, y) == color.Black {
+						want = 0
+					}
+					if got := buf[y*stride+x]; got != want {
+						t.Fatalf("width %d, palette %v: (%d, %d) is %d, want %d", w, p, x, y, got, want)
+					}
+				}
+			}
+			back, err := Pack(buf, w, 4, stride)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < 4; y++ {
+				for x := 0; x < w; x++ {
+					if back.At(x, y) != m.At(x, y) {
+						t.Fatalf("width %d, palette %v: (%d, %d) differs", w, p, x, y)
+					}
+				}
+				if w%8 != 0 && back.Pix[y*back.Stride+back.Stride-1]&^bitmap.TailMask(w) != 0 {
+					t.Fatalf("width %d: padding set", w)
+				}
+			}
+		}
+	}
+}
+
+func TestPackGray(t *testing.T) {
+	src := []byte{0, 127, 128, 255, 1, 200, 100, 130, 90}
+	m, err := Pack(src, 9, 1, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, v := range src {
+		if got, want := m.At(x, 0) == color.White, v >= 128; got != want {
+			t.Errorf("%d: white %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 10, 3), color.Palette{color.White, color.Black})
+	if err := Unpack(make([]byte, 30), 10, m); err != nil {
+		t.Errorf("exact buffer: %v", err)
+	}
+	if err := Unpack(make([]byte, 29), 10, m); err == nil {
+		t.Error("short buffer: no error")
+	}
+	if err := Unpack(make([]byte, 100), 9, m); err == nil {
+		t.Error("small stride: no error")
+	}
+	if _, err := Pack(nil, 0, 1, 1); err == nil {
+		t.Error("zero width: no error")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pcl implements an encoder of bilevel images as PCL 5 raster
+// graphics, which laser printers print without a driver.
+//
+// Each image is printed on a page of its own from the top left corner of
+// the printable area, with black pixels as dots. Rows are sent by Transfer
+// Raster Data commands, compressed with delta row (mode 3) or TIFF PackBits
+// (mode 2) compression, or uncompressed.
+package pcl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A FormatError reports that the images or the options can not be encoded.
+type FormatError string
+
+func (e FormatError) Error() string { return "pcl: invalid format: " + string(e) }
+
+// CompressionType describes the type of compression used in Options.
+type CompressionType int
+
+// Constants for supported compression types.
+const (
+	DeltaRow CompressionType = iota
+	PackBits
+	Uncompressed
+)
+
+// mode returns the raster compression mode of c.
+func (c CompressionType) mode() int {
+	switch c {
+	case PackBits:
+		return 2
+	case Uncompressed:
+		return 0
+	}
+	return 3
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Compression is the type of compression used. The zero value is delta
+	// row compression, which codes the changes from the previous row and
+	// suits most documents best.
+	Compression CompressionType
+
+	// Resolution is the raster resolution in dots per inch. PCL 5 printers
+	// support 75, 100, 150, 200, 300 and 600. Zero means 300.
+	Resolution int
+}
+
+// maxRowBytes is the largest amount of data of a Transfer Raster Data
+// command.
+const maxRowBytes = 32767
+
+// Encode writes the image m to w as a PCL job of one page.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	return EncodeAll(w, []*img1b.Image{m}, opt)
+}
+
+// EncodeAll writes the images to w as a PCL job with a page per image.
+func EncodeAll(w io.Writer, pages []*img1b.Image, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	if len(pages) == 0 {
+		return FormatError("no pages")
+	}
+	if opt.Compression < DeltaRow || opt.Compression > Uncompressed {
+		return FormatError("unknown compression type")
+	}
+	res := opt.Resolution
+	if res == 0 {
+		res = 300
+	}
+	if res < 0 {
+		return FormatError("negative resolution")
+	}
+	for _, m := range pages {
+		d := m.Rect.Size()
+		if d.X <= 0 || d.Y <= 0 || (d.X+7)/8 > maxRowBytes {
+			return FormatError(fmt.Sprintf("invalid image size: %dx%d", d.X, d.Y))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x1bE")
+	for _, m := range pages {
+		writePage(bw, m, opt.Compression.mode(), res)
+	}
+	bw.WriteString("\x1bE")
+	return bw.Flush()
+}
+
+// writePage writes the raster graphics of m and ejects the page.
+func writePage(bw *bufio.Writer, m *img1b.Image, mode, res int) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	// Resolution, source width and height, cursor at the top left, start
+	// at the cursor, compression mode.
+	fmt.Fprintf(bw, "\x1b*t%dR\x1b*r%dS\x1b*r%dT\x1b*p0x0Y\x1b*r1A\x1b*b%dM", res, w, h, mode)
+	rowBytes := (w + 7) / 8
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(w)
+	row := make([]byte, rowBytes)
+	seed := make([]byte, rowBytes)
+	var data []byte
+	for y := 0; y < h; y++ {
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[rowBytes-1] &= tm
+		switch mode {
+		case 3:
+			data = deltaRow(data[:0], row, seed)
+			row, seed = seed, row
+		default:
+			// The printer fills the row with zeros.
+			n := rowBytes
+			for n > 0 && row[n-1] == 0 {
+				n--
+			}
+			if mode == 2 {
+				data = bitmap.PackBits(data[:0], row[:n])
+			} else {
+				data = append(data[:0], row[:n]...)
+			}
+		}
+		fmt.Fprintf(bw, "\x1b*b%dW", len(data))
+		bw.Write(data)
+	}
+	bw.WriteString("\x1b*rC\f")
+}
+
+// deltaRow codes row as the changes from seed and appends the result to
+// dst. Each change replaces up to 8 bytes at an offset from the end of the
+// previous one.
+func deltaRow(dst, row, seed []byte) []byte {
+	last := 0
+	for i := 0; i < len(row); {
+		if row[i] == seed[i] {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(row) && j-i < 8 && row[j] != seed[j] {
+			j++
+		}
+		cmd := byte(j-i-1) << 5
+		if off := i - last; off < 31 {
+			dst = append(dst, cmd|byte(off))
+		} else {
+			dst = append(dst, cmd|31)
+			for off -= 31; off >= 255; off -= 255 {
+				dst = append(dst, 255)
+			}
+			dst = append(dst, byte(off))
+		}
+		dst = append(dst, row[i:j]...)
+		last, i = j, j
+	}
+	return dst
+}
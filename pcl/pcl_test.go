@@ -0,0 +1,199 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pcl
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// testImage returns an image of a few text-like lines, where rows often
+// repeat or differ in few bytes from the previous ones.
+func testImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	r := rand.New(rand.NewSource(int64(w)))
+	for y := 0; y < h; y++ {
+		if y%12 >= 8 {
+			continue
+		}
+		for x := 0; x < w; x++ {
+			if x%7 < 3 && (x/7+y/12)%3 != 0 || r.Intn(50) == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// unpackBits decodes PackBits data.
+func unpackBits(t *testing.T, src []byte) []byte {
+	var dst []byte
+	for len(src) > 0 {
+		n := int(int8(src[0]))
+		switch {
+		case n >= 0 && len(src) >= n+2:
+			dst = append(dst, src[1:n+2]...)
+			src = src[n+2:]
+		case n > -128 && len(src) >= 2:
+			dst = append(dst, bytes.Repeat(src[1:2], 1-n)...)
+			src = src[2:]
+		default:
+			t.Fatalf("bad PackBits data % x", src)
+		}
+	}
+	return dst
+}
+
+// applyDelta applies delta row data to the seed row.
+func applyDelta(t *testing.T, seed, src []byte) {
+	pos := 0
+	for len(src) > 0 {
+		n, off := int(src[0]>>5)+1, int(src[0]&31)
+		src = src[1:]
+		for b := byte(255); off >= 31 && b == 255; {
+			if len(src) == 0 {
+				t.Fatal("bad delta row offset")
+			}
+			b, src = src[0], src[1:]
+			off += int(b)
+		}
+		pos += off
+		if pos+n > len(seed) || n > len(src) {
+			t.Fatalf("bad delta row data")
+		}
+		pos += copy(seed[pos:pos+n], src[:n])
+		src = src[n:]
+	}
+}
+
+var pageHeader = regexp.MustCompile(`^\x1b\*t(\d+)R\x1b\*r(\d+)S\x1b\*r(\d+)T\x1b\*p0x0Y\x1b\*r1A\x1b\*b(\d)M`)
+var rowHeader = regexp.MustCompile(`^\x1b\*b(\d+)W`)
+
+// decode parses a PCL job written by EncodeAll and returns its pages as
+// rows of dots.
+func decode(t *testing.T, job []byte, res, mode int) [][][]byte {
+	t.Helper()
+	if !bytes.HasPrefix(job, []byte("\x1bE")) || !bytes.HasSuffix(job, []byte("\x1bE")) {
+		t.Fatal("missing reset")
+	}
+	job = job[2 : len(job)-2]
+	var pages [][][]byte
+	for len(job) > 0 {
+		h := pageHeader.FindSubmatch(job)
+		if h == nil {
+			t.Fatalf("bad page header %q", job[:20])
+		}
+		if string(h[1]) != strconv.Itoa(res) || string(h[4]) != strconv.Itoa(mode) {
+			t.Fatalf("got resolution %s, mode %s", h[1], h[4])
+		}
+		w, _ := strconv.Atoi(string(h[2]))
+		ht, _ := strconv.Atoi(string(h[3]))
+		job = job[len(h[0]):]
+		seed := make([]byte, (w+7)/8)
+		var rows [][]byte
+		for y := 0; y < ht; y++ {
+			r := rowHeader.FindSubmatch(job)
+			if r == nil {
+				t.Fatalf("bad row header %q", job[:10])
+			}
+			n, _ := strconv.Atoi(string(r[1]))
+			data := job[len(r[0]) : len(r[0])+n]
+			job = job[len(r[0])+n:]
+			row := make([]byte, len(seed))
+			switch mode {
+			case 0:
+				copy(row, data)
+			case 2:
+				copy(row, unpackBits(t, data))
+			case 3:
+				applyDelta(t, seed, data)
+				copy(row, seed)
+			}
+			rows = append(rows, row)
+		}
+		if !bytes.HasPrefix(job, []byte("\x1b*rC\f")) {
+			t.Fatalf("bad page end %q", job)
+		}
+		job = job[5:]
+		pages = append(pages, rows)
+	}
+	return pages
+}
+
+func TestEncodeAll(t *testing.T) {
+	pages := []*img1b.Image{
+		testImage(300, 40, color.Palette{color.White, color.Black}),
+		testImage(77, 30, color.Palette{color.Black, color.White}),
+		testImage(2480, 13, color.Palette{color.White, color.Black}),
+	}
+	tests := []struct {
+		opt       *Options
+		res, mode int
+	}{
+		{nil, 300, 3},
+		{&Options{Compression: PackBits, Resolution: 600}, 600, 2},
+		{&Options{Compression: Uncompressed, Resolution: 150}, 150, 0},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := EncodeAll(&b, pages, tt.opt); err != nil {
+			t.Fatal(err)
+		}
+		got := decode(t, b.Bytes(), tt.res, tt.mode)
+		if len(got) != len(pages) {
+			t.Fatalf("mode %d: got %d pages", tt.mode, len(got))
+		}
+		for i, m := range pages {
+			for y, row := range got[i] {
+				for x := 0; x < len(row)*8; x++ {
+					dot := row[x/8]>>uint(7-x%8)&1 == 1
+					if black := x < m.Rect.Dx() && m.At(x, y) == color.Black; dot != black {
+						t.Fatalf("mode %d: page %d: at (%d, %d) got dot %v", tt.mode, i, x, y, dot)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDeltaRow(t *testing.T) {
+	seed := make([]byte, 600)
+	row := make([]byte, 600)
+	for _, i := range []int{0, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 40, 71, 72, 400, 599} {
+		row[i] = byte(i) | 1
+	}
+	data := deltaRow(nil, row, seed)
+	applyDelta(t, seed, data)
+	if !bytes.Equal(seed, row) {
+		t.Errorf("got % x", seed)
+	}
+	if data := deltaRow(nil, row, row); len(data) != 0 {
+		t.Errorf("equal rows: got % x", data)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	m := testImage(8, 8, nil)
+	tests := []struct {
+		pages []*img1b.Image
+		opt   *Options
+	}{
+		{nil, nil},
+		{[]*img1b.Image{m}, &Options{Compression: 5}},
+		{[]*img1b.Image{m}, &Options{Resolution: -300}},
+		{[]*img1b.Image{m, img1b.New(image.Rect(0, 0, 0, 1), nil)}, nil},
+	}
+	for i, tt := range tests {
+		if err := EncodeAll(new(bytes.Buffer), tt.pages, tt.opt); err == nil {
+			t.Errorf("%d: no error", i)
+		}
+	}
+}
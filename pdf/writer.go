@@ -0,0 +1,216 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pdf implements a writer of PDF documents holding bilevel images,
+// one per page, as produced by document scanners.
+//
+// Each image is CCITT Group 4 compressed and embedded as an image XObject
+// with the CCITTFaxDecode filter, which all PDF readers support. The page
+// size follows from the image size and resolution.
+//
+// The format is specified in ISO 32000-1, the output conforms to PDF 1.4.
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+	"strconv"
+)
+
+// A FormatError reports that the input can not be written as a PDF.
+type FormatError string
+
+func (e FormatError) Error() string { return "pdf: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// XResolution and YResolution are the pixel density in dots per inch.
+	// Zero values mean 72, one pixel per point.
+	XResolution, YResolution int
+}
+
+// The catalog and the page tree come first in the numbering, but are
+// written last, once all pages are known.
+const (
+	catalogObj = 1
+	pagesObj   = 2
+	firstObj   = 3
+)
+
+// A Writer writes a PDF document. Pages are appended with Add and the
+// document is completed with Close. The underlying writer does not need to
+// support seeking.
+type Writer struct {
+	w       *bufio.Writer
+	opt     Options
+	offset  int64   // Number of bytes written so far.
+	offsets []int64 // Offsets of the objects, by number starting at 1.
+	pages   []int   // Object numbers of the pages.
+	err     error
+}
+
+// NewWriter returns a Writer that writes pages to w with the given options.
+// If opt is nil, images are placed at 72 dots per inch.
+func NewWriter(w io.Writer, opt *Options) *Writer {
+	pw := &Writer{w: bufio.NewWriter(w)}
+	if opt != nil {
+		pw.opt = *opt
+	}
+	if pw.opt.XResolution < 0 || pw.opt.YResolution < 0 {
+		pw.err = FormatError("negative resolution")
+	}
+	// The catalog and page tree offsets are set by Close.
+	pw.offsets = make([]int64, firstObj-1)
+	pw.write("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+// write writes s, counting the bytes written.
+func (w *Writer) write(s string) {
+	n, _ := w.w.WriteString(s)
+	w.offset += int64(n)
+}
+
+// writeObj writes the object numbered n with the given dictionary and an
+// optional stream. Write errors are kept by the bufio.Writer and reported
+// by the final Flush, except for those of the stream.
+func (w *Writer) writeObj(n int, dict string, stream []byte) error {
+	w.offsets[n-1] = w.offset
+	w.write(fmt.Sprintf("%d 0 obj\n%s\n", n, dict))
+	if stream != nil {
+		w.write("stream\n")
+		m, err := w.w.Write(stream)
+		w.offset += int64(m)
+		if err != nil {
+			return err
+		}
+		w.write("\nendstream\n")
+	}
+	w.write("endobj\n")
+	return nil
+}
+
+// newObj allocates an object number.
+func (w *Writer) newObj() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+// points returns the length of n pixels at the given resolution in points,
+// with at most 4 decimals.
+func points(n, dpi int) string {
+	if dpi == 0 {
+		return strconv.Itoa(n)
+	}
+	return strconv.FormatFloat(float64(int64(n)*72*10000/int64(dpi))/10000, 'f', -1, 64)
+}
+
+// Add appends the image m as a new page.
+func (w *Writer) Add(m *img1b.Image) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.add(m)
+	return w.err
+}
+
+func (w *Writer) add(m *img1b.Image) error {
+	d := m.Bounds().Size()
+	if d.X <= 0 || d.Y <= 0 || int64(d.X) >= 1<<31 || int64(d.Y) >= 1<<31 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", d.X, d.Y))
+	}
+	// The filter decodes black pixels to 0, the black of DeviceGray, as long
+	// as the coded runs have the right colors.
+	data := ccitt.EncodeRows(m.Pix, m.Stride, d.X, d.Y, &ccitt.Options{
+		K:          -1,
+		EndOfBlock: true,
+		Invert:     bitmap.BlackIndex(m.Palette) == 0,
+	})
+	img := w.newObj()
+	err := w.writeObj(img, fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d "+
+		"/ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /CCITTFaxDecode "+
+		"/DecodeParms << /K -1 /Columns %d /Rows %d >> /Length %d >>",
+		d.X, d.Y, d.X, d.Y, len(data)), data)
+	if err != nil {
+		return err
+	}
+
+	pw, ph := points(d.X, w.opt.XResolution), points(d.Y, w.opt.YResolution)
+	content := []byte(fmt.Sprintf("q\n%s 0 0 %s 0 0 cm\n/Im0 Do\nQ", pw, ph))
+	contents := w.newObj()
+	if err := w.writeObj(contents, fmt.Sprintf("<< /Length %d >>", len(content)), content); err != nil {
+		return err
+	}
+
+	page := w.newObj()
+	w.pages = append(w.pages, page)
+	return w.writeObj(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] "+
+		"/Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		pagesObj, pw, ph, img, contents), nil)
+}
+
+// Close writes the page tree, the catalog and the cross-reference table,
+// and flushes the output. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.pages) == 0 {
+		w.err = FormatError("no pages")
+		return w.err
+	}
+	w.err = w.close()
+	if w.err == nil {
+		// Any further use is an error.
+		w.err = FormatError("write to closed Writer")
+		return nil
+	}
+	return w.err
+}
+
+func (w *Writer) close() error {
+	kids := make([]byte, 0, len(w.pages)*8)
+	for i, p := range w.pages {
+		if i > 0 {
+			kids = append(kids, ' ')
+		}
+		kids = append(kids, fmt.Sprintf("%d 0 R", p)...)
+	}
+	if err := w.writeObj(pagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(w.pages)), nil); err != nil {
+		return err
+	}
+	if err := w.writeObj(catalogObj, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObj), nil); err != nil {
+		return err
+	}
+	xref := w.offset
+	// Entries are exactly 20 bytes long.
+	w.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1))
+	for _, off := range w.offsets {
+		w.write(fmt.Sprintf("%010d 00000 n \n", off))
+	}
+	w.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, catalogObj, xref))
+	return w.w.Flush()
+}
+
+// Encode writes the image m to w as a single page PDF document. If opt is
+// nil, the image is placed at 72 dots per inch.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	return EncodeAll(w, []*img1b.Image{m}, opt)
+}
+
+// EncodeAll writes the images to w as the pages of a PDF document.
+func EncodeAll(w io.Writer, pages []*img1b.Image, opt *Options) error {
+	pw := NewWriter(w, opt)
+	for _, m := range pages {
+		if err := pw.Add(m); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
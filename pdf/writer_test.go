@@ -0,0 +1,134 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x/5+y/3)%3 == 0 || x == y {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// checkXref checks that the cross-reference table points at the objects
+// and returns the document's objects by number.
+func checkXref(t *testing.T, doc []byte) map[int][]byte {
+	t.Helper()
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatal("missing header or trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(doc[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	objs := make(map[int][]byte)
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(doc[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		prefix := strconv.Itoa(i+1) + " 0 obj\n"
+		if !bytes.HasPrefix(doc[off:], []byte(prefix)) {
+			t.Fatalf("object %d not at offset %d", i+1, off)
+		}
+		end := bytes.Index(doc[off:], []byte("endobj\n"))
+		objs[i+1] = doc[off+len(prefix) : off+end]
+	}
+	return objs
+}
+
+func TestEncodeAll(t *testing.T) {
+	pages := []*img1b.Image{
+		testImage(300, 150, color.Palette{color.White, color.Black}),
+		testImage(77, 41, color.Palette{color.Black, color.White}),
+	}
+	var b bytes.Buffer
+	if err := EncodeAll(&b, pages, &Options{XResolution: 300, YResolution: 150}); err != nil {
+		t.Fatal(err)
+	}
+	objs := checkXref(t, b.Bytes())
+	if len(objs) != 2+3*len(pages) {
+		t.Fatalf("got %d objects", len(objs))
+	}
+	if !bytes.Contains(objs[pagesObj], []byte("/Kids [5 0 R 8 0 R] /Count 2")) {
+		t.Errorf("bad page tree %q", objs[pagesObj])
+	}
+	if !bytes.Contains(objs[5], []byte("/MediaBox [0 0 72 72]")) {
+		t.Errorf("bad first page %q", objs[5])
+	}
+	if !bytes.Contains(objs[8], []byte("/MediaBox [0 0 18.48 19.68]")) {
+		t.Errorf("bad second page %q", objs[8])
+	}
+	for i, m := range pages {
+		obj := objs[firstObj+3*i]
+		j := bytes.Index(obj, []byte("stream\n"))
+		data := obj[j+7 : bytes.LastIndex(obj, []byte("\nendstream"))]
+		if !bytes.Contains(obj, []byte("/Length "+strconv.Itoa(len(data))+" ")) {
+			t.Errorf("page %d: bad image length", i)
+		}
+		got, err := ccitt.Decode(data, m.Rect.Dx(), m.Rect.Dy(), &ccitt.Options{K: -1})
+		if err != nil {
+			t.Fatalf("page %d: %v", i, err)
+		}
+		for y := 0; y < m.Rect.Dy(); y++ {
+			for x := 0; x < m.Rect.Dx(); x++ {
+				if got.At(x, y) != m.At(x, y) {
+					t.Fatalf("page %d: at (%d, %d) got %v, want %v", i, x, y, got.At(x, y), m.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var b bytes.Buffer
+	if err := Encode(&b, testImage(10, 20, color.Palette{color.White, color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+	objs := checkXref(t, b.Bytes())
+	if !bytes.Contains(objs[5], []byte("/MediaBox [0 0 10 20]")) {
+		t.Errorf("bad page %q", objs[5])
+	}
+	if !bytes.Contains(objs[4], []byte("10 0 0 20 0 0 cm")) {
+		t.Errorf("bad content %q", objs[4])
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(new(bytes.Buffer), nil)
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "no pages") {
+		t.Errorf("got %v, want no pages", err)
+	}
+	w = NewWriter(new(bytes.Buffer), nil)
+	if err := w.Add(img1b.New(image.Rect(0, 0, 0, 5), nil)); err == nil {
+		t.Error("empty image accepted")
+	}
+	w = NewWriter(new(bytes.Buffer), nil)
+	w.Add(testImage(8, 8, nil))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(testImage(8, 8, nil)); err == nil {
+		t.Error("write to closed Writer accepted")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf417
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Mode latch and shift codewords.
+const (
+	latchText    = 900
+	latchByte    = 901
+	latchNumeric = 902
+	shiftByte    = 913
+	latchByte6   = 924
+)
+
+// Text compaction submodes.
+const (
+	alpha = iota
+	lower
+	mixed
+	punct
+)
+
+// Text compaction values switching submodes.
+const (
+	ll = 27 // lower latch, from alpha or mixed
+	as = 27 // alpha shift, from lower
+	ml = 28 // mixed latch, from alpha or lower
+	al = 28 // alpha latch, from mixed
+	pl = 25 // punctuation latch, from mixed
+	ps = 29 // punctuation shift, from alpha, lower or mixed
+	pa = 29 // alpha latch, from punctuation
+)
+
+// The characters of the mixed and punctuation submodes, by value.
+const (
+	mixedChars = "0123456789&\r\t,:#-.$/+%*=^"
+	punctChars = ";<>@[\\]_`~!\r\t,:\n-.$/\"|*()?{}'"
+)
+
+// minNumeric is the shortest run of digits worth numeric compaction.
+const minNumeric = 13
+
+// compact returns the data codewords of text. Runs of digits are
+// compacted as numbers, runs of bytes text compaction can not code as
+// bytes, and the rest as text.
+func compact(text string) []int {
+	var cw, values []int
+	inText := true
+	sub := alpha
+	for i := 0; i < len(text); {
+		if n := digits(text[i:]); n >= minNumeric {
+			cw = flushText(cw, values)
+			values = nil
+			cw = append(cw, latchNumeric)
+			cw = compactDigits(cw, text[i:i+n])
+			inText, sub = false, alpha
+			i += n
+			continue
+		}
+		if !isText(text[i]) {
+			n := 1
+			for i+n < len(text) && !isText(text[i+n]) {
+				n++
+			}
+			cw = flushText(cw, values)
+			values = nil
+			if n == 1 && inText {
+				cw = append(cw, shiftByte, int(text[i]))
+			} else {
+				cw = compactBytes(cw, text[i:i+n])
+				inText, sub = false, alpha
+			}
+			i += n
+			continue
+		}
+		if !inText {
+			cw = append(cw, latchText)
+			inText = true
+		}
+		values, sub = textValue(values, sub, text, i)
+		i++
+	}
+	return flushText(cw, values)
+}
+
+// digits returns the length of the run of digits s starts with.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// isText reports whether text compaction codes c.
+func isText(c byte) bool {
+	return c >= ' ' && c <= '~' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// textValue appends the text compaction values of text[i], switching from
+// submode sub as needed, and returns the submode after it.
+func textValue(values []int, sub int, text string, i int) ([]int, int) {
+	c := text[i]
+	isUpper := c >= 'A' && c <= 'Z' || c == ' '
+	isLower := c >= 'a' && c <= 'z' || c == ' '
+	isMixed := strings.IndexByte(mixedChars, c) >= 0 || c == ' '
+	switch sub {
+	case alpha:
+		switch {
+		case isUpper:
+		case isLower:
+			values, sub = append(values, ll), lower
+		case isMixed:
+			values, sub = append(values, ml), mixed
+		default:
+			return append(values, ps, strings.IndexByte(punctChars, c)), sub
+		}
+	case lower:
+		switch {
+		case isLower:
+		case isUpper:
+			return append(values, as, int(c-'A')), sub
+		case isMixed:
+			values, sub = append(values, ml), mixed
+		default:
+			return append(values, ps, strings.IndexByte(punctChars, c)), sub
+		}
+	case mixed:
+		switch {
+		case isMixed:
+		case isUpper:
+			values, sub = append(values, al), alpha
+		case isLower:
+			values, sub = append(values, ll), lower
+		case i+1 < len(text) && isText(text[i+1]) && strings.IndexByte(punctChars, text[i+1]) >= 0:
+			values, sub = append(values, pl), punct
+		default:
+			return append(values, ps, strings.IndexByte(punctChars, c)), sub
+		}
+	case punct:
+		if strings.IndexByte(punctChars, c) < 0 {
+			return textValue(append(values, pa), alpha, text, i)
+		}
+	}
+	switch {
+	case c == ' ':
+		return append(values, 26), sub
+	case sub == alpha:
+		return append(values, int(c-'A')), sub
+	case sub == lower:
+		return append(values, int(c-'a')), sub
+	case sub == mixed:
+		return append(values, strings.IndexByte(mixedChars, c)), sub
+	}
+	return append(values, strings.IndexByte(punctChars, c)), sub
+}
+
+// flushText appends the codewords of the text compaction values to cw, two
+// values to a codeword, padding with a punctuation shift.
+func flushText(cw, values []int) []int {
+	if len(values)%2 == 1 {
+		values = append(values, ps)
+	}
+	for i := 0; i < len(values); i += 2 {
+		cw = append(cw, 30*values[i]+values[i+1])
+	}
+	return cw
+}
+
+// compactBytes appends the byte compaction of s to cw: groups of 6 bytes as 5
+// base 900 digits, the bytes left over one to a codeword.
+func compactBytes(cw []int, s string) []int {
+	if len(s)%6 == 0 {
+		cw = append(cw, latchByte6)
+	} else {
+		cw = append(cw, latchByte)
+	}
+	i := 0
+	for ; i+6 <= len(s); i += 6 {
+		var v uint64
+		for j := 0; j < 6; j++ {
+			v = v<<8 | uint64(s[i+j])
+		}
+		var g [5]int
+		for j := 4; j >= 0; j-- {
+			g[j] = int(v % 900)
+			v /= 900
+		}
+		cw = append(cw, g[:]...)
+	}
+	for ; i < len(s); i++ {
+		cw = append(cw, int(s[i]))
+	}
+	return cw
+}
+
+// compactDigits appends the numeric compaction of the digits s to cw: groups of
+// up to 44 digits, prefixed with 1, as base 900 numbers.
+func compactDigits(cw []int, s string) []int {
+	var n, r big.Int
+	d := big.NewInt(900)
+	for i := 0; i < len(s); i += 44 {
+		j := i + 44
+		if j > len(s) {
+			j = len(s)
+		}
+		n.SetString("1"+s[i:j], 10)
+		var g []int
+		for n.Sign() > 0 {
+			n.DivMod(&n, d, &r)
+			g = append(g, int(r.Int64()))
+		}
+		for k := len(g) - 1; k >= 0; k-- {
+			cw = append(cw, g[k])
+		}
+	}
+	return cw
+}
@@ -0,0 +1,277 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pdf417 implements a PDF417 generator rendering symbols straight
+// into bilevel images.
+//
+// A symbol is a stack of 3 to 90 rows of 1 to 30 data columns of
+// codewords, each row framed by start and stop patterns and row
+// indicators. The number of rows and columns and the error correction
+// level, from 1 to 8, can be set or left to Encode. Text is coded in text
+// compaction mode, long runs of digits in numeric compaction mode and other
+// bytes in byte compaction mode.
+//
+// The format is specified by ISO/IEC 15438.
+package pdf417
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math"
+)
+
+// A FormatError reports that the data can not be coded.
+type FormatError string
+
+func (e FormatError) Error() string { return "pdf417: invalid format: " + string(e) }
+
+// Symbol limits.
+const (
+	MinRows    = 3
+	MaxRows    = 90
+	MinColumns = 1
+	MaxColumns = 30
+	MaxLevel   = 8
+	// maxCodewords is the largest number of codewords of a symbol.
+	maxCodewords = 928
+)
+
+// The start and stop patterns, 17 and 18 modules.
+const (
+	startPattern = 0x1fea8
+	stopPattern  = 0x3fa29
+)
+
+// pad is the codeword padding the data.
+const pad = 900
+
+// Options are the symbol parameters.
+type Options struct {
+	// Columns is the number of data columns, chosen for a symbol about
+	// three times as wide as high if 0.
+	Columns int
+	// Rows is the number of rows, the fewest the data fits in if 0.
+	Rows int
+	// Level is the error correction level; a symbol carries 2^(Level+1)
+	// error correction codewords. If 0, the level the specification
+	// recommends for the data length is used.
+	Level int
+}
+
+// A Code is a PDF417 symbol.
+type Code struct {
+	Rows, Columns, Level int
+	// Width is the width of a row in modules.
+	Width int
+	bits  []bool
+}
+
+// Encode returns the symbol coding text.
+func Encode(text string, opt *Options) (*Code, error) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	data := compact(text)
+	if o.Level < 0 || o.Level > MaxLevel {
+		return nil, FormatError("bad error correction level")
+	}
+	if o.Level == 0 {
+		o.Level = recommendedLevel(len(data))
+	}
+	ecc := 2 << uint(o.Level)
+	// The length descriptor, the data and the error correction.
+	n := 1 + len(data) + ecc
+	if n > maxCodewords {
+		return nil, FormatError("text too long")
+	}
+	rows, cols, err := dimensions(n, o.Rows, o.Columns)
+	if err != nil {
+		return nil, err
+	}
+	cw := make([]int, 1, rows*cols)
+	cw = append(cw, data...)
+	for len(cw) < rows*cols-ecc {
+		cw = append(cw, pad)
+	}
+	cw[0] = len(cw)
+	cw = append(cw, rsCodewords(cw, ecc)...)
+
+	c := &Code{Rows: rows, Columns: cols, Level: o.Level, Width: 17*cols + 69}
+	c.bits = make([]bool, rows*c.Width)
+	for y := 0; y < rows; y++ {
+		k := y % 3
+		base := 30 * (y / 3)
+		indicators := [3]int{(rows - 1) / 3, o.Level*3 + (rows-1)%3, cols - 1}
+		row := c.bits[y*c.Width : (y+1)*c.Width]
+		x := put(row, 0, startPattern, 17)
+		x = put(row, x, patterns[k][base+indicators[k]], 17)
+		for _, v := range cw[y*cols : (y+1)*cols] {
+			x = put(row, x, patterns[k][v], 17)
+		}
+		x = put(row, x, patterns[k][base+indicators[(k+2)%3]], 17)
+		put(row, x, stopPattern, 18)
+	}
+	return c, nil
+}
+
+// recommendedLevel returns the error correction level recommended for n
+// data codewords.
+func recommendedLevel(n int) int {
+	switch {
+	case n <= 40:
+		return 2
+	case n <= 160:
+		return 3
+	case n <= 320:
+		return 4
+	}
+	return 5
+}
+
+// dimensions returns the rows and columns of a symbol holding n codewords,
+// as asked when not 0.
+func dimensions(n, rows, cols int) (int, int, error) {
+	if rows != 0 && (rows < MinRows || rows > MaxRows) || cols != 0 && (cols < MinColumns || cols > MaxColumns) {
+		return 0, 0, FormatError("bad dimensions")
+	}
+	fit := func(n, d int) int {
+		r := (n + d - 1) / d
+		if r < MinRows {
+			r = MinRows
+		}
+		return r
+	}
+	switch {
+	case rows == 0 && cols == 0:
+		// The width in modules over the height, with rows 3 modules
+		// high, closest to 3.
+		best := math.Inf(1)
+		for c := MinColumns; c <= MaxColumns; c++ {
+			r := fit(n, c)
+			if r > MaxRows || r*c > maxCodewords {
+				continue
+			}
+			ratio := float64(17*c+69) / float64(3*r)
+			if d := math.Abs(math.Log(ratio / 3)); d < best {
+				best, rows, cols = d, r, c
+			}
+		}
+	case rows == 0:
+		rows = fit(n, cols)
+	case cols == 0:
+		cols = (n + rows - 1) / rows
+	}
+	if cols == 0 || rows > MaxRows || cols > MaxColumns || rows*cols < n || rows*cols > maxCodewords {
+		return 0, 0, FormatError("text does not fit")
+	}
+	return rows, cols, nil
+}
+
+// put sets n modules of row from x to the pattern p, the first one in the
+// highest bit, and returns the position after them.
+func put(row []bool, x int, p uint32, n int) int {
+	for i := n - 1; i >= 0; i-- {
+		row[x] = p>>uint(i)&1 != 0
+		x++
+	}
+	return x
+}
+
+// rsCodewords returns the error correction codewords of data, computed in
+// GF(929) with a generator polynomial whose roots are 3^1 to 3^n.
+func rsCodewords(data []int, n int) []int {
+	// The generator, lowest powers first.
+	g := make([]int, n+1)
+	g[0] = 1
+	root := 1
+	for i := 1; i <= n; i++ {
+		root = root * 3 % 929
+		for j := i; j >= 0; j-- {
+			v := (929 - root) * g[j]
+			if j > 0 {
+				v += g[j-1]
+			}
+			g[j] = v % 929
+		}
+	}
+	// The remainder of data·x^n divided by the generator, negated.
+	e := make([]int, n)
+	for _, d := range data {
+		t := (d + e[n-1]) % 929
+		for j := n - 1; j > 0; j-- {
+			e[j] = (e[j-1] + 929 - t*g[j]%929) % 929
+		}
+		e[0] = (929 - t*g[0]%929) % 929
+	}
+	res := make([]int, n)
+	for j := range res {
+		res[j] = (929 - e[n-1-j]) % 929
+	}
+	return res
+}
+
+// Black reports whether the module at x of row y is dark. Modules outside
+// the symbol are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Width || y >= c.Rows {
+		return false
+	}
+	return c.bits[y*c.Width+x]
+}
+
+// Image renders the symbol with modules of scale pixels wide, rows of
+// height modules, surrounded by a quiet zone of quiet modules. The
+// specification asks for rows at least 3 modules high and a quiet zone of 2
+// modules. The image palette is {white, black}.
+func (c *Code) Image(scale, height, quiet int) *img1b.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if quiet < 0 {
+		quiet = 0
+	}
+	w, h := (c.Width+2*quiet)*scale, (c.Rows*height+2*quiet)*scale
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Rows; y++ {
+		y0 := (y*height + quiet) * scale
+		row := m.Pix[y0*m.Stride : (y0+1)*m.Stride]
+		for x := 0; x < c.Width; {
+			if !c.Black(x, y) {
+				x++
+				continue
+			}
+			x1 := x + 1
+			for x1 < c.Width && c.Black(x1, y) {
+				x1++
+			}
+			setBits(row, (x+quiet)*scale, (x1+quiet)*scale)
+			x = x1
+		}
+		for j := 1; j < height*scale; j++ {
+			copy(m.Pix[(y0+j)*m.Stride:], row)
+		}
+	}
+	return m
+}
+
+// setBits sets bits [x0, x1) of row.
+func setBits(row []byte, x0, x1 int) {
+	i0, i1 := x0/8, (x1-1)/8
+	m0 := byte(0xff) >> uint(x0%8)
+	m1 := byte(0xff) << uint(7-(x1-1)%8)
+	if i0 == i1 {
+		row[i0] |= m0 & m1
+		return
+	}
+	row[i0] |= m0
+	for i := i0 + 1; i < i1; i++ {
+		row[i] = 0xff
+	}
+	row[i1] |= m1
+}
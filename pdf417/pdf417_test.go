@@ -0,0 +1,153 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pdf417
+
+import (
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPatterns(t *testing.T) {
+	for k := range patterns {
+		seen := make(map[uint32]bool)
+		for v, p := range patterns[k] {
+			// 4 bars and 4 spaces of 1 to 6 modules.
+			var w []int
+			for i := 16; i >= 0; i-- {
+				b := p>>uint(i)&1 == 1
+				if len(w) == 0 || (len(w)%2 == 1) != b {
+					w = append(w, 0)
+				}
+				w[len(w)-1]++
+			}
+			if len(w) != 8 || p>>16 != 1 {
+				t.Fatalf("cluster %d, codeword %d: %d elements", 3*k, v, len(w))
+			}
+			for _, n := range w {
+				if n > 6 {
+					t.Fatalf("cluster %d, codeword %d: element of %d modules", 3*k, v, n)
+				}
+			}
+			if c := (w[0] - w[2] + w[4] - w[6] + 9) % 9; c != 3*k {
+				t.Errorf("cluster %d, codeword %d: in cluster %d", 3*k, v, c)
+			}
+			if seen[p] {
+				t.Errorf("cluster %d, codeword %d: pattern repeated", 3*k, v)
+			}
+			seen[p] = true
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	data := []int{16, 902, 1, 278, 827, 900, 295, 902, 2, 326, 823, 544, 900, 149, 900, 900}
+	tests := [][]int{
+		{156, 765},
+		{168, 875, 63, 355},
+		{628, 715, 393, 299, 863, 601, 169, 708},
+	}
+	for l, want := range tests {
+		if got := rsCodewords(data, 2<<uint(l)); !reflect.DeepEqual(got, want) {
+			t.Errorf("level %d: got %v, want %v", l, got, want)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"Super !", []int{567, 615, 137, 809, 329}},
+		{"Super ", []int{567, 615, 137, 809}},
+		{"AB", []int{1}},
+		{"ab", []int{27*30 + 0, 1*30 + 29}},
+		{"a1", []int{27*30 + 0, 28*30 + 1}},
+		{"A\xe9B", []int{29, shiftByte, 0xe9, 1*30 + 29}},
+		{"\x80\x81", []int{latchByte, 0x80, 0x81}},
+		{"\x00\x00\x00\x00\x00\x01", []int{latchByte6, 0, 0, 0, 0, 1}},
+		{"1234567890123", []int{latchNumeric, 17, 110, 836, 811, 223}},
+		{"No 0000000000000", []int{13*30 + 27, 14*30 + 26, latchNumeric, 15, 217, 379, 11, 100}},
+	}
+	for _, tt := range tests {
+		if got := compact(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text              string
+		o                 Options
+		rows, cols, level int
+	}{
+		{"Ticket 0042", Options{}, 8, 2, 2},
+		{"Ticket 0042", Options{Columns: 5}, 4, 5, 2},
+		{"Ticket 0042", Options{Rows: 10, Level: 4}, 10, 4, 4},
+		{"Ticket 0042", Options{Rows: 4, Columns: 12, Level: 1}, 4, 12, 1},
+		{strings.Repeat("Boarding pass ", 40), Options{}, 28, 12, 4},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.text, &tt.o)
+		if err != nil {
+			t.Errorf("%.20q %+v: %v", tt.text, tt.o, err)
+			continue
+		}
+		if c.Rows != tt.rows || c.Columns != tt.cols || c.Level != tt.level {
+			t.Errorf("%.20q %+v: %d×%d level %d, want %d×%d level %d", tt.text, tt.o,
+				c.Rows, c.Columns, c.Level, tt.rows, tt.cols, tt.level)
+		}
+		if c.Width != 17*c.Columns+69 {
+			t.Errorf("%.20q: width %d", tt.text, c.Width)
+		}
+		// Each row starts with the start pattern and ends with the stop one.
+		for y := 0; y < c.Rows; y++ {
+			for i := 0; i < 7; i++ {
+				if !c.Black(i, y) || !c.Black(c.Width-18+i, y) || !c.Black(c.Width-1, y) {
+					t.Fatalf("%.20q: row %d lacks start or stop pattern", tt.text, y)
+				}
+			}
+		}
+	}
+
+	errs := []struct {
+		text string
+		o    Options
+	}{
+		{"x", Options{Level: 9}},
+		{"x", Options{Rows: 2}},
+		{"x", Options{Columns: 31}},
+		{strings.Repeat("x", 100), Options{Rows: 3, Columns: 2}},
+		{strings.Repeat("\xff", 1200), Options{}},
+	}
+	for _, tt := range errs {
+		if _, err := Encode(tt.text, &tt.o); err == nil {
+			t.Errorf("%.20q %+v: no error", tt.text, tt.o)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	c, err := Encode("Row height", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Image(2, 3, 2)
+	if m.Rect.Dx() != (c.Width+4)*2 || m.Rect.Dy() != (3*c.Rows+4)*2 {
+		t.Fatalf("size %v", m.Rect)
+	}
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			mx, my := x/2-2, y/2-2
+			want := my >= 0 && c.Black(mx, my/3)
+			if (m.At(x, y) == color.Black) != want {
+				t.Fatalf("pixel (%d, %d) wrong", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+)
+
+// A MorphKind is a morphological operation.
+type MorphKind int
+
+const (
+	// Dilate makes black the pixels with a black pixel within the
+	// square.
+	Dilate MorphKind = iota
+	// Erode keeps black the pixels with only black pixels within the
+	// square.
+	Erode
+	// Open erodes, then dilates, removing black details smaller than the
+	// square.
+	Open
+	// Close dilates, then erodes, filling white details smaller than the
+	// square.
+	Close
+)
+
+// Morph applies a morphological operation with a square of 2×Radius+1
+// pixels centered on each pixel.
+type Morph struct {
+	Kind   MorphKind
+	Radius int
+}
+
+// Apply implements Op.
+func (o Morph) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	d := blackBits(m, s)
+	if o.Radius <= 0 || d.Rect.Empty() {
+		return d
+	}
+	switch o.Kind {
+	case Dilate:
+		d = morph(d, o.Radius, false, s)
+	case Erode:
+		d = morph(d, o.Radius, true, s)
+	case Open:
+		d = morph(morph(d, o.Radius, true, s), o.Radius, false, s)
+	case Close:
+		d = morph(morph(d, o.Radius, false, s), o.Radius, true, s)
+	}
+	return d
+}
+
+// morph dilates or erodes m, made by blackBits, which it gives back to s,
+// by the square of radius r. The square is separable: the rows are
+// combined first, then the columns.
+func morph(m *img1b.Image, r int, erode bool, s *Scratch) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	n := (w + 7) / 8
+	op := bitmap.Or
+	if erode {
+		op = bitmap.And
+	}
+	t := s.Get(w, h)
+	tmp := s.Row(n)
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h; y++ {
+		src := m.Pix[y*m.Stride : y*m.Stride+n]
+		dst := t.Pix[y*t.Stride : y*t.Stride+n]
+		copy(dst, src)
+		for k := 1; k <= r; k++ {
+			shiftRow(tmp, src, k)
+			op(dst, tmp)
+			shiftRow(tmp, src, -k)
+			op(dst, tmp)
+		}
+		dst[n-1] &= tm
+	}
+	d := m
+	for y := 0; y < h; y++ {
+		dst := d.Pix[y*d.Stride : y*d.Stride+n]
+		if erode && (y < r || y+r >= h) {
+			// A row out of the image is white.
+			bitmap.Fill(dst, 0)
+			continue
+		}
+		copy(dst, t.Pix[y*t.Stride:y*t.Stride+n])
+		for k := -r; k <= r; k++ {
+			if yy := y + k; k != 0 && yy >= 0 && yy < h {
+				op(dst, t.Pix[yy*t.Stride:yy*t.Stride+n])
+			}
+		}
+	}
+	s.Put(t)
+	return d
+}
+
+// shiftRow sets dst to the pixels of src moved k to the right, or -k to the
+// left if k is negative. The pixels moved in are zero.
+func shiftRow(dst, src []byte, k int) {
+	n := len(src)
+	if k >= 0 {
+		q, b := k/8, uint(k%8)
+		for i := n - 1; i >= 0; i-- {
+			var v byte
+			if j := i - q; j >= 0 {
+				v = src[j] >> b
+				if b != 0 && j > 0 {
+					v |= src[j-1] << (8 - b)
+				}
+			}
+			dst[i] = v
+		}
+		return
+	}
+	k = -k
+	q, b := k/8, uint(k%8)
+	for i := 0; i < n; i++ {
+		var v byte
+		if j := i + q; j < n {
+			v = src[j] << b
+			if b != 0 && j+1 < n {
+				v |= src[j+1] >> (8 - b)
+			}
+		}
+		dst[i] = v
+	}
+}
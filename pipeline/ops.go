@@ -0,0 +1,127 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"github.com/mi-v/img1b/internal/scanop"
+	"github.com/mi-v/img1b/scan"
+	"image"
+	"math"
+)
+
+// Threshold is a Binarizer turning pixels black where their luminance is
+// below Level, 1 to 256, or the level picked by scan.Level if Level is 0.
+// Bilevel images are only copied.
+type Threshold struct {
+	Level int
+}
+
+// Binarize implements Binarizer.
+func (t Threshold) Binarize(m image.Image, s *Scratch) *img1b.Image {
+	l := t.Level
+	if l <= 0 {
+		l = scan.Level(m)
+	}
+	return scanop.Threshold(m, l, s.images())
+}
+
+// Apply implements Op.
+func (t Threshold) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	return blackBits(m, s)
+}
+
+// Dither is a Binarizer dithering images with scan.Dither. Bilevel images
+// are only copied.
+type Dither struct{}
+
+// Binarize implements Binarizer.
+func (Dither) Binarize(m image.Image, s *Scratch) *img1b.Image {
+	return scanop.Dither(m, s.images())
+}
+
+// Apply implements Op.
+func (Dither) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	return blackBits(m, s)
+}
+
+// Despeckle removes the groups of connected black pixels of at most Size
+// pixels, 4 if 0, as scan.Despeckle does.
+type Despeckle struct {
+	Size int
+}
+
+// Apply implements Op.
+func (d Despeckle) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	size := d.Size
+	if size == 0 {
+		size = 4
+	}
+	out, _ := scanop.Despeckle(m, size, s.images())
+	return out
+}
+
+// RemoveBorder removes the black borders left by scanners, as
+// scan.RemoveBorder does.
+type RemoveBorder struct{}
+
+// Apply implements Op.
+func (RemoveBorder) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	d, _ := scanop.RemoveBorder(m, s.images())
+	return d
+}
+
+// Rotate rotates images counter-clockwise by Degrees about their center,
+// keeping their size, as scan.Rotate does.
+type Rotate struct {
+	Degrees float64
+}
+
+// Apply implements Op.
+func (r Rotate) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	return scanop.Rotate(m, r.Degrees, s.images())
+}
+
+// Deskew rotates images so that their lines of text are horizontal, if
+// they are skewed by at least MinSkew degrees, 0.1 if 0.
+type Deskew struct {
+	MinSkew float64
+}
+
+// Apply implements Op.
+func (d Deskew) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	min := d.MinSkew
+	if min <= 0 {
+		min = 0.1
+	}
+	a := scanop.Skew(m, s.images())
+	if math.Abs(a) < min {
+		return m
+	}
+	return scanop.Rotate(m, a, s.images())
+}
+
+// Invert swaps black and white.
+type Invert struct{}
+
+// Apply implements Op.
+func (Invert) Apply(m *img1b.Image, s *Scratch) *img1b.Image {
+	d := blackBits(m, s)
+	w := d.Rect.Dx()
+	if w == 0 {
+		return d
+	}
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	for y := 0; y < d.Rect.Dy(); y++ {
+		row := d.Pix[y*d.Stride : y*d.Stride+n]
+		for i := range row {
+			row[i] = ^row[i]
+		}
+		row[n-1] &= tm
+	}
+	return d
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pipeline applies a series of operations to an image, such as the
+// steps of cleaning up a scanned page, described as data:
+//
+//	p := pipeline.New(
+//		pipeline.Threshold{},
+//		pipeline.Despeckle{Size: 4},
+//		pipeline.Morph{Kind: pipeline.Close, Radius: 1},
+//	)
+//	m, err := p.Run(src)
+//
+// The images between the steps are kept by the pipeline for reuse, so that
+// running it over many pages of the same size does not allocate a buffer
+// per step and page.
+//
+// The images made by the operations are at the origin with the palette
+// {white, black}. Pixels outside an image are white.
+package pipeline
+
+import (
+	"errors"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"time"
+)
+
+// An Op is an operation on a bilevel image.
+type Op interface {
+	// Apply returns the result of the operation on m. It does not change
+	// m and may return it as is. The images it makes come from s, which
+	// may be nil.
+	Apply(m *img1b.Image, s *Scratch) *img1b.Image
+}
+
+// A Binarizer is an Op that also makes images bilevel. A pipeline starting
+// with one takes images of any kind.
+type Binarizer interface {
+	Op
+	// Binarize returns m made bilevel, with an image from s, which may be
+	// nil.
+	Binarize(m image.Image, s *Scratch) *img1b.Image
+}
+
+// Scratch keeps images no longer in use for reuse by the operations. The
+// zero value is ready to use. A nil *Scratch keeps nothing.
+type Scratch struct {
+	pool img1b.Pool
+	row  []byte
+}
+
+// Get returns a white image w by h pixels at the origin with the palette
+// {white, black}.
+func (s *Scratch) Get(w, h int) *img1b.Image {
+	return s.images().Get(image.Rect(0, 0, w, h), bitmap.Palette())
+}
+
+// Put gives m back for reuse. Neither m nor images sharing its pixels may
+// be used after that.
+func (s *Scratch) Put(m *img1b.Image) {
+	s.images().Put(m)
+}
+
+// images returns the pool of s, nil for a nil s.
+func (s *Scratch) images() *img1b.Pool {
+	if s == nil {
+		return nil
+	}
+	return &s.pool
+}
+
+// Row returns a buffer of n bytes, valid until the next call.
+func (s *Scratch) Row(n int) []byte {
+	if s == nil {
+		return make([]byte, n)
+	}
+	if cap(s.row) < n {
+		s.row = make([]byte, n)
+	}
+	return s.row[:n]
+}
+
+// ErrNotBilevel is returned by Run for an image that is not an
+// *img1b.Image when the pipeline does not start with a Binarizer.
+var ErrNotBilevel = errors.New("pipeline: image is not bilevel and there is no Binarizer to start with")
+
+// A Pipeline applies Ops in order. A Pipeline may not be run by several
+// goroutines at once.
+type Pipeline struct {
+	Ops []Op
+	// Timing, if not nil, is called after each step with its index in Ops
+	// and the time it took.
+	Timing func(step int, op Op, d time.Duration)
+
+	scratch Scratch
+}
+
+// New returns a Pipeline applying ops.
+func New(ops ...Op) *Pipeline {
+	return &Pipeline{Ops: ops}
+}
+
+// Run applies the operations to src, which it does not change, and returns
+// the result. The result belongs to the caller; giving it back with Put
+// lets the next run reuse it.
+func (p *Pipeline) Run(src image.Image) (*img1b.Image, error) {
+	m, ok := src.(*img1b.Image)
+	ops := p.Ops
+	if !ok {
+		var b Binarizer
+		if len(ops) > 0 {
+			b, _ = ops[0].(Binarizer)
+		}
+		if b == nil {
+			return nil, ErrNotBilevel
+		}
+		m = p.step(0, b, func() *img1b.Image { return b.Binarize(src, &p.scratch) })
+		ops = ops[1:]
+	}
+	if len(p.Ops) == 0 {
+		return blackBits(m, &p.scratch), nil
+	}
+	first := len(p.Ops) - len(ops)
+	for i, op := range ops {
+		d := p.step(first+i, op, func() *img1b.Image { return op.Apply(m, &p.scratch) })
+		// Each step makes a new image, and the one before goes back for
+		// reuse, unless it is the source.
+		if d != m && m != src {
+			p.scratch.Put(m)
+		}
+		m = d
+	}
+	if m == src {
+		m = blackBits(m, &p.scratch)
+	}
+	return m, nil
+}
+
+// step runs the step i of op, timing it if asked to.
+func (p *Pipeline) step(i int, op Op, f func() *img1b.Image) *img1b.Image {
+	if p.Timing == nil {
+		return f()
+	}
+	t := time.Now()
+	m := f()
+	p.Timing(i, op, time.Since(t))
+	return m
+}
+
+// Put gives an image returned by Run back for reuse by the next runs.
+func (p *Pipeline) Put(m *img1b.Image) {
+	p.scratch.Put(m)
+}
+
+// blackBits returns a copy of m at the origin with black pixels set and
+// zero padding, with an image from s.
+func blackBits(m *img1b.Image, s *Scratch) *img1b.Image {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	d := s.Get(w, h)
+	bitmap.CopyBlack(d.Pix, d.Stride, m.Pix, m.Stride, w, h, m.Palette)
+	return d
+}
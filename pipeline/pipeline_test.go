@@ -0,0 +1,191 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pipeline
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/scan"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// randomImage returns a w by h image with the palette {black, white} and
+// random pixels.
+func randomImage(w, h int, seed int64) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	rnd := rand.New(rand.NewSource(seed))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if rnd.Intn(3) != 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+func isBlack(m *img1b.Image, x, y int) bool {
+	if !(image.Point{x, y}.In(m.Rect)) {
+		return false
+	}
+	return m.At(x, y) == color.Black
+}
+
+// naiveMorph dilates or erodes m by the square of radius r pixel by pixel.
+func naiveMorph(m *img1b.Image, r int, erode bool) [][]bool {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	out := make([][]bool, h)
+	for y := range out {
+		out[y] = make([]bool, w)
+		for x := range out[y] {
+			v := erode
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					if b := isBlack(m, x+dx, y+dy); erode && !b {
+						v = false
+					} else if !erode && b {
+						v = true
+					}
+				}
+			}
+			out[y][x] = v
+		}
+	}
+	return out
+}
+
+func TestMorph(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, r int
+	}{
+		{1, 1, 1},
+		{7, 5, 1},
+		{13, 9, 2},
+		{40, 17, 3},
+		{64, 12, 9},
+	} {
+		m := randomImage(tc.w, tc.h, int64(tc.w))
+		for _, erode := range []bool{false, true} {
+			kind := Dilate
+			if erode {
+				kind = Erode
+			}
+			var s Scratch
+			d := Morph{Kind: kind, Radius: tc.r}.Apply(m, &s)
+			want := naiveMorph(m, tc.r, erode)
+			for y := 0; y < tc.h; y++ {
+				for x := 0; x < tc.w; x++ {
+					if got := isBlack(d, x, y); got != want[y][x] {
+						t.Fatalf("%dx%d r=%d erode=%t: pixel (%d, %d) is %t, want %t", tc.w, tc.h, tc.r, erode, x, y, got, want[y][x])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 30, 20))
+	for i := range g.Pix {
+		g.Pix[i] = 255
+	}
+	// A block and a speck.
+	for y := 5; y < 15; y++ {
+		for x := 5; x < 20; x++ {
+			g.Pix[y*g.Stride+x] = 10
+		}
+	}
+	g.Pix[2*g.Stride+27] = 0
+
+	var steps []int
+	p := New(Threshold{Level: 128}, Despeckle{Size: 2}, Morph{Kind: Erode, Radius: 1}, Invert{})
+	p.Timing = func(step int, op Op, d time.Duration) {
+		steps = append(steps, step)
+	}
+	m, err := p.Run(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 4 || steps[0] != 0 || steps[3] != 3 {
+		t.Errorf("timed steps %v", steps)
+	}
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			// The block, eroded, is white once inverted.
+			want := !(x >= 6 && x < 19 && y >= 6 && y < 14)
+			if got := isBlack(m, x, y); got != want {
+				t.Fatalf("pixel (%d, %d) is %t, want %t", x, y, got, want)
+			}
+		}
+	}
+
+	// A second run of the same size gives the same result.
+	p.Put(m)
+	m2, err := p.Run(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3, _ := New(Threshold{Level: 128}, Despeckle{Size: 2}, Morph{Kind: Erode, Radius: 1}, Invert{}).Run(g)
+	if !bytes.Equal(m2.Pix, m3.Pix) {
+		t.Error("second run differs")
+	}
+}
+
+func TestRunBilevel(t *testing.T) {
+	m := randomImage(21, 11, 2)
+	orig := append([]byte(nil), m.Pix...)
+	for _, p := range []*Pipeline{
+		New(),
+		New(Deskew{MinSkew: 90}),
+		New(Morph{Kind: Open, Radius: 1}, Morph{Kind: Close, Radius: 1}),
+	} {
+		d, err := p.Run(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d == m {
+			t.Error("Run returns its source")
+		}
+		if !bytes.Equal(m.Pix, orig) {
+			t.Fatal("Run changes its source")
+		}
+	}
+
+	if _, err := New(Despeckle{}).Run(image.NewGray(image.Rect(0, 0, 4, 4))); err != ErrNotBilevel {
+		t.Errorf("got %v, want ErrNotBilevel", err)
+	}
+}
+
+func TestScanOps(t *testing.T) {
+	m := randomImage(60, 40, 3)
+	for _, tc := range []struct {
+		op   Op
+		want *img1b.Image
+	}{
+		{Threshold{}, scan.Threshold(m, 128)},
+		{Despeckle{Size: 3}, scan.Despeckle(m, 3)},
+		{RemoveBorder{}, scan.RemoveBorder(m)},
+		{Rotate{Degrees: 5}, scan.Rotate(m, 5)},
+		{Deskew{MinSkew: 0.01}, scan.Deskew(m)},
+	} {
+		for _, s := range []*Scratch{nil, new(Scratch)} {
+			op := tc.op
+			var d *img1b.Image
+			if b, ok := op.(Binarizer); ok {
+				d = b.Binarize(m, s)
+			} else {
+				d = op.Apply(m, s)
+			}
+			if d.Rect != tc.want.Rect || !bytes.Equal(d.Pix, tc.want.Pix) {
+				t.Errorf("%T with Scratch %v: differs from package scan", op, s != nil)
+			}
+			s.Put(d)
+		}
+	}
+}
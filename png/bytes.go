@@ -0,0 +1,207 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"hash/crc32"
+	"io"
+)
+
+// An idatReader presents the payloads of consecutive IDAT chunks as one
+// stream. It is an io.ByteReader, so the zlib reader reads it directly.
+type idatReader struct {
+	cur    []byte   // the current chunk
+	pos    int      // the read position in cur
+	chunks [][]byte // the chunks after cur
+}
+
+// reset sets the chunks to read.
+func (r *idatReader) reset(chunks [][]byte) {
+	r.cur, r.pos, r.chunks = chunks[0], 0, chunks[1:]
+}
+
+// next moves on to the next chunk with data left and reports whether there
+// is one.
+func (r *idatReader) next() bool {
+	for r.pos == len(r.cur) {
+		if len(r.chunks) == 0 {
+			return false
+		}
+		r.cur, r.pos, r.chunks = r.chunks[0], 0, r.chunks[1:]
+	}
+	return true
+}
+
+// left returns the number of bytes left in the current chunk.
+func (r *idatReader) left() int { return len(r.cur) - r.pos }
+
+func (r *idatReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if !r.next() {
+		return 0, io.EOF
+	}
+	n := copy(p, r.cur[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func (r *idatReader) ReadByte() (byte, error) {
+	if r.pos == len(r.cur) && !r.next() {
+		return 0, io.EOF
+	}
+	c := r.cur[r.pos]
+	r.pos++
+	return c, nil
+}
+
+// DecodeBytes decodes a PNG image held in memory. It takes the chunks right
+// from b, without the buffering and the copying Decode needs for a reader.
+func DecodeBytes(b []byte) (*img1b.Image, error) {
+	var d Decoder
+	return d.DecodeBytes(b)
+}
+
+// DecodeBytes decodes a PNG image held in memory. It takes the chunks right
+// from b, without the buffering and the copying Decode needs for a reader.
+func (dec *Decoder) DecodeBytes(b []byte) (*img1b.Image, error) {
+	if dec.d == nil {
+		dec.d = &decoder{dec: dec}
+	}
+	d := dec.d
+	d.reset(nil)
+	// Do not hold on to b or the image.
+	defer func() {
+		for i := range d.idat {
+			d.idat[i] = nil
+		}
+		d.idat, d.ir, d.img = d.idat[:0], idatReader{}, nil
+	}()
+	d.timer.begin()
+	img, err := d.decodeBytes(b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	err = d.wrap(err)
+	d.report(err)
+	return img, err
+}
+
+func (d *decoder) decodeBytes(b []byte) (*img1b.Image, error) {
+	if len(b) < len(pngHeader) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if string(b[:len(pngHeader)]) != pngHeader {
+		return nil, FormatError("not a PNG file")
+	}
+	n := len(b)
+	b = b[len(pngHeader):]
+	for d.stage != dsSeenIEND {
+		d.stats.Bytes = int64(n - len(b))
+		d.chunk, d.chunkOffset = "", int64(n-len(b))
+		if len(b) >= 8 {
+			d.chunk = string(b[4:8])
+		}
+		name, p, rest, err := nextChunk(b)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+		known, err := d.nextStage(string(name), len(p))
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			continue
+		}
+		switch string(name) {
+		case "IHDR":
+			err = d.setIHDR(p)
+		case "PLTE":
+			err = d.setPLTE(p)
+		case "tRNS":
+			err = d.settRNS(p)
+		case "IDAT":
+			b, err = d.decodeIDATs(p, b)
+		case "IEND":
+			if len(p) != 0 {
+				err = FormatError("bad IEND length")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	d.stats.Bytes = int64(n - len(b))
+	return d.img, nil
+}
+
+// nextChunk splits the chunk at the start of b into its name and payload,
+// having verified its checksum.
+func nextChunk(b []byte) (name, p, rest []byte, err error) {
+	if len(b) < 12 {
+		return nil, nil, nil, io.ErrUnexpectedEOF
+	}
+	length := binary.BigEndian.Uint32(b[:4])
+	if length > 0x7fffffff {
+		return nil, nil, nil, FormatError(fmt.Sprintf("Bad chunk length: %d", length))
+	}
+	if uint32(len(b)-12) < length {
+		return nil, nil, nil, io.ErrUnexpectedEOF
+	}
+	end := 8 + int(length)
+	if binary.BigEndian.Uint32(b[end:end+4]) != crc32.ChecksumIEEE(b[4:end]) {
+		return nil, nil, nil, checksumError
+	}
+	return b[4:8], b[8:end], b[end+4:], nil
+}
+
+// decodeIDATs decodes the image from the payload p of the first IDAT chunk
+// and those of the IDAT chunks following it in b. It returns the rest of b.
+func (d *decoder) decodeIDATs(p, b []byte) ([]byte, error) {
+	d.idat = append(d.idat[:0], p)
+	first := d.chunkOffset
+	next := first + int64(12+len(p))
+	for len(b) >= 8 && string(b[4:8]) == "IDAT" {
+		d.chunkOffset = next
+		_, p, rest, err := nextChunk(b)
+		if err != nil {
+			return nil, err
+		}
+		d.idat = append(d.idat, p)
+		d.stats.Chunks++
+		next += int64(12 + len(p))
+		b = rest
+	}
+	d.chunkOffset = first
+	d.ir.reset(d.idat)
+	img, err := d.decode(&d.ir)
+	if err != nil {
+		return nil, err
+	}
+	// Data left in the chunk where the stream ended; the chunks after it
+	// are trailing IDAT chunks.
+	if d.ir.left() != 0 {
+		if err := d.tooMuchData(); err != nil {
+			return nil, err
+		}
+	}
+	off, k := first, len(d.idat)-len(d.ir.chunks)
+	for i, p := range d.idat {
+		if i >= k {
+			d.chunkOffset = off
+			if err := d.trailingIDAT(len(p)); err != nil {
+				return nil, err
+			}
+		}
+		off += int64(12 + len(p))
+	}
+	d.img = img
+	return b, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeBytes(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range filenames {
+		files = append(files, "testdata/pngsuite/"+fn+".png")
+	}
+	var d Decoder
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantErr := Decode(bytes.NewReader(data))
+		for _, decode := range []func([]byte) (interface{}, error){
+			func(b []byte) (interface{}, error) { return DecodeBytes(b) },
+			func(b []byte) (interface{}, error) { return d.DecodeBytes(b) },
+		} {
+			got, err := decode(data)
+			if (err == nil) != (wantErr == nil) {
+				t.Errorf("%s: got error %v, want %v", fn, err, wantErr)
+				continue
+			}
+			if err == nil && !reflect.DeepEqual(got, interface{}(want)) {
+				t.Errorf("%s: decodings differ", fn)
+			}
+		}
+	}
+}
+
+func TestDecodeBytesTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gradient.interlaced.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < len(data); n++ {
+		if _, err := DecodeBytes(data[:n]); err == nil {
+			t.Fatalf("%d bytes: no error", n)
+		}
+	}
+}
+
+func TestDecodeBytesSplitIDAT(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/benchBW.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := (&Encoder{}).Encode(&b, want); err != nil {
+		t.Fatal(err)
+	}
+	// Re-chunk the IDAT payload into pieces of 7 bytes.
+	in := b.Bytes()
+	var out bytes.Buffer
+	out.WriteString(pngHeader)
+	var idat []byte
+	for rest := in[len(pngHeader):]; len(rest) > 0; {
+		name, p, r, err := nextChunk(rest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rest = r
+		if string(name) == "IDAT" {
+			idat = append(idat, p...)
+			continue
+		}
+		if string(name) == "IEND" {
+			for len(idat) > 0 {
+				k := min(7, len(idat))
+				writeTestChunk(&out, "IDAT", idat[:k])
+				idat = idat[k:]
+			}
+		}
+		writeTestChunk(&out, string(name), p)
+	}
+	got, err := DecodeBytes(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("decodings differ")
+	}
+}
+
+func writeTestChunk(b *bytes.Buffer, name string, p []byte) {
+	e := &encoder{w: b}
+	e.writeChunk(p, name)
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	data, err := ioutil.ReadFile("testdata/benchBW.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var d Decoder
+	b.SetBytes(int64(cfg.Width * cfg.Height / 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.DecodeBytes(data)
+	}
+}
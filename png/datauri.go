@@ -0,0 +1,62 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"github.com/mi-v/img1b"
+)
+
+// MaxDataURIBytes is the largest PNG file EncodeDataURI makes a data URI
+// of, before base64 adds a third: plenty for a preview, and little enough
+// for mail clients and JSON payloads.
+const MaxDataURIBytes = 64 << 10
+
+// ErrDataURITooLarge is the error of EncodeDataURI for an image whose PNG
+// file would be more than MaxDataURIBytes.
+var ErrDataURITooLarge = errors.New("png: image too large for a data URI")
+
+// dataURIPrefix starts the data URIs of PNG images.
+const dataURIPrefix = "data:image/png;base64,"
+
+// EncodeDataURI returns the Image m as a "data:image/png;base64," URI, for
+// embedding small previews in HTML or JSON. It compresses as much as it
+// can, and fails with ErrDataURITooLarge as soon as the file gets over
+// MaxDataURIBytes.
+func EncodeDataURI(m *img1b.Image) (string, error) {
+	e := Encoder{CompressionLevel: BestCompression}
+	return e.EncodeDataURI(m)
+}
+
+// EncodeDataURI returns the Image m as a "data:image/png;base64," URI,
+// encoded by enc, as the function EncodeDataURI does.
+func (enc *Encoder) EncodeDataURI(m *img1b.Image) (string, error) {
+	var w cappedBuffer
+	if err := enc.Encode(&w, m); err != nil {
+		return "", err
+	}
+	b := make([]byte, len(dataURIPrefix)+base64.StdEncoding.EncodedLen(w.Len()))
+	n := copy(b, dataURIPrefix)
+	base64.StdEncoding.Encode(b[n:], w.Bytes())
+	return string(b), nil
+}
+
+// cappedBuffer is a bytes.Buffer refusing to grow over MaxDataURIBytes.
+type cappedBuffer struct {
+	bytes.Buffer
+}
+
+func (w *cappedBuffer) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > MaxDataURIBytes {
+		return 0, ErrDataURITooLarge
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *cappedBuffer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"encoding/base64"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDataURI(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 40, 30), color.Palette{color.Black, color.White})
+	for i := 0; i < 30; i++ {
+		m.SetColorIndex(i, i, 1)
+	}
+	s, err := EncodeDataURI(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, "data:image/png;base64,") {
+		t.Fatalf("data URI %.40q...", s)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "data:image/png;base64,"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, err := DecodeBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(m, m1); err != nil {
+		t.Error(err)
+	}
+
+	// Noise does not compress: 1000x1000 pixels take over 64 KiB.
+	big := img1b.New(image.Rect(0, 0, 1000, 1000), color.Palette{color.Black, color.White})
+	rand.New(rand.NewSource(1)).Read(big.Pix)
+	if _, err := EncodeDataURI(big); err != ErrDataURITooLarge {
+		t.Errorf("big image: got error %v, want %v", err, ErrDataURITooLarge)
+	}
+}
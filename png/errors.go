@@ -0,0 +1,127 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"compress/flate"
+	"compress/zlib"
+	"github.com/mi-v/img1b"
+	"io"
+	"strconv"
+)
+
+// An ErrorKind classifies the errors of decoding. It is an error itself, so
+// that errors.Is(err, KindTruncated) tells a file cut short from others.
+type ErrorKind int
+
+const (
+	// KindOther is an error of the reader.
+	KindOther ErrorKind = iota
+	// KindFormat is data that is not valid PNG.
+	KindFormat
+	// KindTruncated is data ending before the image does.
+	KindTruncated
+	// KindChecksum is a chunk or zlib checksum not matching the data.
+	KindChecksum
+	// KindUnsupported is valid PNG using a feature the decoder does not
+	// have, such as a bit depth over 1.
+	KindUnsupported
+	// KindLimit is an image over the Limits of the Decoder.
+	KindLimit
+)
+
+var kindNames = [...]string{
+	KindOther:       "other",
+	KindFormat:      "invalid format",
+	KindTruncated:   "truncated",
+	KindChecksum:    "checksum mismatch",
+	KindUnsupported: "unsupported feature",
+	KindLimit:       "limit exceeded",
+}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "ErrorKind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return kindNames[k]
+}
+
+func (k ErrorKind) Error() string { return "png: " + k.String() }
+
+// A DecodeError is an error of Decode, DecodeBytes, DecodeRegion or
+// DecodeConfig, telling what kind of error it is and where in the input it
+// happened. The error it wraps is a FormatError, an UnsupportedError, an
+// img1b.LimitError, io.ErrUnexpectedEOF, an error of compress/zlib or an
+// error of the reader, for errors.As and errors.Is to find.
+type DecodeError struct {
+	Kind ErrorKind
+	// Chunk is the type of the chunk being read, empty for errors in the
+	// signature or in the length and type of a chunk.
+	Chunk string
+	// Offset is the offset in the input of the chunk, 0 for errors in the
+	// signature. Errors in the image data of a file held in memory by
+	// DecodeBytes are at the first of its IDAT chunks.
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	s := e.Err.Error()
+	switch e.Err.(type) {
+	case FormatError, UnsupportedError, img1b.LimitError:
+	default:
+		s = "png: " + s
+	}
+	if e.Chunk != "" {
+		return s + " (" + e.Chunk + " chunk at offset " + strconv.FormatInt(e.Offset, 10) + ")"
+	}
+	return s + " (at offset " + strconv.FormatInt(e.Offset, 10) + ")"
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Is reports whether target is the ErrorKind of e.
+func (e *DecodeError) Is(target error) bool {
+	k, ok := target.(ErrorKind)
+	return ok && k == e.Kind
+}
+
+// errorKind returns the kind of an error of decoding.
+func errorKind(err error) ErrorKind {
+	switch err := err.(type) {
+	case FormatError:
+		if err == checksumError {
+			return KindChecksum
+		}
+		return KindFormat
+	case UnsupportedError:
+		return KindUnsupported
+	case img1b.LimitError:
+		return KindLimit
+	case flate.CorruptInputError:
+		return KindFormat
+	}
+	switch err {
+	case io.ErrUnexpectedEOF, io.EOF:
+		return KindTruncated
+	case zlib.ErrChecksum:
+		return KindChecksum
+	case zlib.ErrHeader, zlib.ErrDictionary:
+		return KindFormat
+	}
+	return KindOther
+}
+
+// wrap returns err as a *DecodeError at the chunk being read, nil if it is
+// nil.
+func (d *decoder) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{Kind: errorKind(err), Chunk: d.chunk, Offset: d.chunkOffset, Err: err}
+}
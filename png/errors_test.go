@@ -0,0 +1,106 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"github.com/mi-v/img1b"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// chunkOffsets returns the offsets of the chunks of a PNG file.
+func chunkOffsets(data []byte) []int {
+	var offs []int
+	for i := len(pngHeader); i+8 <= len(data); i += 12 + int(binary.BigEndian.Uint32(data[i:])) {
+		offs = append(offs, i)
+	}
+	return offs
+}
+
+func TestDecodeError(t *testing.T) {
+	pix := func(x, y int) bool { return (x+y)%3 == 0 }
+	plain := corpusPNG(corpusSpec{w: 20, h: 10, pix: pix})
+	split := corpusPNG(corpusSpec{w: 40, h: 6, pix: pix, split: true, stored: true})
+	offs := chunkOffsets(split)
+	// The third IDAT chunk, after IHDR, with a wrong checksum.
+	badCRC := append([]byte(nil), split...)
+	badCRC[offs[4]-1] ^= 1
+	// A bit depth of 2.
+	deep := append([]byte(nil), plain...)
+	deep[8+8+8] = 2
+	binary.BigEndian.PutUint32(deep[8+8+13:], crc32.ChecksumIEEE(deep[8+4:8+8+13]))
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		limits *img1b.Limits
+		kind   ErrorKind
+		chunk  string
+		offset int64
+		is     error
+	}{
+		{"signature", []byte("GIF89a..."), nil, KindFormat, "", 0, nil},
+		{"empty", nil, nil, KindTruncated, "", 0, io.ErrUnexpectedEOF},
+		{"truncated header", plain[:20], nil, KindTruncated, "IHDR", 8, io.ErrUnexpectedEOF},
+		{"truncated data", plain[:len(plain)-20], nil, KindTruncated, "IDAT", 33, io.ErrUnexpectedEOF},
+		{"checksum", badCRC, nil, KindChecksum, "IDAT", int64(offs[3]), nil},
+		{"bit depth", deep, nil, KindUnsupported, "IHDR", 8, nil},
+		{"limits", plain, &img1b.Limits{MaxPixels: 100}, KindLimit, "IHDR", 8, nil},
+	} {
+		dec := Decoder{Limits: tc.limits}
+		_, err1 := dec.Decode(bytes.NewReader(tc.data))
+		_, err2 := dec.DecodeBytes(tc.data)
+		for i, err := range []error{err1, err2} {
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				t.Errorf("%s %d: got %v, want a *DecodeError", tc.name, i, err)
+				continue
+			}
+			if de.Kind != tc.kind || de.Chunk != tc.chunk || de.Offset != tc.offset {
+				t.Errorf("%s %d: got %v %q at %d, want %v %q at %d", tc.name, i, de.Kind, de.Chunk, de.Offset, tc.kind, tc.chunk, tc.offset)
+			}
+			if !errors.Is(err, tc.kind) {
+				t.Errorf("%s %d: errors.Is(err, %v) is false", tc.name, i, tc.kind)
+			}
+			if tc.is != nil && !errors.Is(err, tc.is) {
+				t.Errorf("%s %d: errors.Is(err, %v) is false", tc.name, i, tc.is)
+			}
+		}
+	}
+
+	_, err := Decode(bytes.NewReader(deep))
+	var ue UnsupportedError
+	if !errors.As(err, &ue) || ue != "bit depth 2, color type 0" {
+		t.Errorf("got %v, want the UnsupportedError", err)
+	}
+	if got, want := err.Error(), "png: unsupported feature: bit depth 2, color type 0 (IHDR chunk at offset 8)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := DecodeConfig(bytes.NewReader(deep)); !errors.Is(err, KindUnsupported) {
+		t.Errorf("DecodeConfig: got %v", err)
+	}
+}
+
+func TestDecodeErrorZlibChecksum(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/invalid-zlib.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err1 := Decode(bytes.NewReader(data))
+	_, err2 := DecodeBytes(data)
+	if !errors.Is(err1, KindChecksum) || !errors.Is(err1, zlib.ErrChecksum) {
+		t.Errorf("Decode: got %v, want a zlib checksum error", err1)
+	}
+	// The chunk checksums, verified first, do not match either.
+	if !errors.Is(err2, KindChecksum) {
+		t.Errorf("DecodeBytes: got %v, want a checksum error", err2)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/fuzz"
+	"hash/crc32"
+)
+
+// fuzzLimits keeps fuzzed headers from allocating more than fuzzers have.
+var fuzzLimits = img1b.Limits{MaxPixels: 1 << 24}
+
+// fuzzDecode decodes data within fuzzLimits.
+func fuzzDecode(data []byte) (*img1b.Image, error) {
+	dec := Decoder{Limits: &fuzzLimits}
+	return dec.DecodeBytes(data)
+}
+
+// CheckDecode decodes data as fuzzers do: it returns the decoding error, or
+// a *fuzz.PanicError if decoding panics, or a fuzz.RoundTripError if the
+// image does not survive encoding and decoding again. Only the last two
+// are bugs, as fuzz.IsBug tells. Images are limited to 1<<24 pixels.
+func CheckDecode(data []byte) error {
+	m, err := fuzz.Run(fuzzDecode, data)
+	if err != nil {
+		return err
+	}
+	return fuzz.RoundTrip(m, Encode, fuzzDecode)
+}
+
+// DecodeFuzz is a go-fuzz Fuzz function for the decoder, returning
+// fuzz.GoFuzz(CheckDecode(data)).
+func DecodeFuzz(data []byte) int {
+	return fuzz.GoFuzz(CheckDecode(data))
+}
+
+// FuzzCorpus returns small valid PNG files to seed fuzzing with, covering
+// both bilevel color types, widths around a byte, every filter type,
+// interlacing, transparency, ancillary and unknown chunks, split IDAT
+// chunks and stored deflate blocks.
+func FuzzCorpus() [][]byte {
+	// A pattern reaching every filter's predictor.
+	pix := func(x, y int) bool { return (x*3+y*5)%7 < 3 }
+	return [][]byte{
+		corpusPNG(corpusSpec{w: 1, h: 1, pix: pix}),
+		corpusPNG(corpusSpec{w: 8, h: 2, pix: pix, palette: true}),
+		corpusPNG(corpusSpec{w: 9, h: 5, pix: pix, filters: true}),
+		corpusPNG(corpusSpec{w: 17, h: 11, pix: pix, palette: true, filters: true, interlace: true}),
+		corpusPNG(corpusSpec{w: 3, h: 9, pix: pix, interlace: true}),
+		corpusPNG(corpusSpec{w: 12, h: 4, pix: pix, palette: true, trns: true}),
+		corpusPNG(corpusSpec{w: 7, h: 3, pix: pix, trns: true, ancillary: true}),
+		corpusPNG(corpusSpec{w: 33, h: 6, pix: pix, filters: true, split: true, stored: true}),
+	}
+}
+
+// A corpusSpec describes a file made by corpusPNG.
+type corpusSpec struct {
+	w, h int
+	pix  func(x, y int) bool
+	// palette makes the file of color type 3 rather than 0.
+	palette bool
+	// filters cycles the rows through the filter types, rather than None.
+	filters   bool
+	interlace bool
+	trns      bool
+	// ancillary adds tEXt and unknown ancillary chunks.
+	ancillary bool
+	// split cuts the image data into IDAT chunks of a few bytes.
+	split bool
+	// stored compresses nothing.
+	stored bool
+}
+
+// The passes of Adam7 interlacing: their first column and row, and their
+// steps.
+var corpusPasses = [7][4]int{
+	{0, 0, 8, 8}, {4, 0, 8, 8}, {0, 4, 4, 8}, {2, 0, 4, 4},
+	{0, 2, 2, 4}, {1, 0, 2, 2}, {0, 1, 1, 2},
+}
+
+// corpusPNG returns the PNG file described by s.
+func corpusPNG(s corpusSpec) []byte {
+	var raw bytes.Buffer
+	passes := [][4]int{{0, 0, 1, 1}}
+	if s.interlace {
+		passes = corpusPasses[:]
+	}
+	filter := 0
+	for _, p := range passes {
+		pw := (s.w - p[0] + p[2] - 1) / p[2]
+		ph := (s.h - p[1] + p[3] - 1) / p[3]
+		if pw <= 0 || ph <= 0 {
+			continue
+		}
+		n := (pw + 7) / 8
+		prev := make([]byte, n)
+		for py := 0; py < ph; py++ {
+			row := make([]byte, n)
+			for px := 0; px < pw; px++ {
+				if s.pix(p[0]+px*p[2], p[1]+py*p[3]) {
+					row[px/8] |= 0x80 >> uint(px%8)
+				}
+			}
+			ft := byte(ftNone)
+			if s.filters {
+				ft = byte(filter % 5)
+				filter++
+			}
+			raw.WriteByte(ft)
+			raw.Write(filterRow(ft, row, prev))
+			prev = row
+		}
+	}
+
+	level := zlib.BestCompression
+	if s.stored {
+		level = zlib.NoCompression
+	}
+	var z bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&z, level)
+	zw.Write(raw.Bytes())
+	zw.Close()
+
+	var b bytes.Buffer
+	b.WriteString(pngHeader)
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(s.w))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(s.h))
+	ihdr[8] = 1
+	if s.palette {
+		ihdr[9] = ctPaletted
+	}
+	if s.interlace {
+		ihdr[12] = 1
+	}
+	corpusChunk(&b, "IHDR", ihdr)
+	if s.ancillary {
+		corpusChunk(&b, "tEXt", []byte("Comment\x00fuzz seed"))
+	}
+	if s.palette {
+		corpusChunk(&b, "PLTE", []byte{0xff, 0xff, 0xff, 0x20, 0x40, 0x80})
+	}
+	if s.trns {
+		if s.palette {
+			corpusChunk(&b, "tRNS", []byte{0x00})
+		} else {
+			corpusChunk(&b, "tRNS", []byte{0x00, 0x01})
+		}
+	}
+	if s.ancillary {
+		corpusChunk(&b, "fuZz", []byte{1, 2, 3})
+	}
+	data := z.Bytes()
+	for len(data) > 0 {
+		n := len(data)
+		if s.split && n > 5 {
+			n = 5
+		}
+		corpusChunk(&b, "IDAT", data[:n])
+		data = data[n:]
+	}
+	corpusChunk(&b, "IEND", nil)
+	return b.Bytes()
+}
+
+// filterRow returns row filtered with ft against prev, the row before, for
+// one byte per pixel unit as with bit depth 1.
+func filterRow(ft byte, row, prev []byte) []byte {
+	out := make([]byte, len(row))
+	for i := range row {
+		var a, c byte
+		if i > 0 {
+			a, c = row[i-1], prev[i-1]
+		}
+		b := prev[i]
+		switch ft {
+		case ftNone:
+			out[i] = row[i]
+		case ftSub:
+			out[i] = row[i] - a
+		case ftUp:
+			out[i] = row[i] - b
+		case ftAverage:
+			out[i] = row[i] - byte((int(a)+int(b))/2)
+		case ftPaeth:
+			out[i] = row[i] - paeth(a, b, c)
+		}
+	}
+	return out
+}
+
+// corpusChunk writes a chunk of the given type and payload to b.
+func corpusChunk(b *bytes.Buffer, typ string, p []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(p)))
+	b.Write(n[:])
+	b.WriteString(typ)
+	b.Write(p)
+	crc := crc32.ChecksumIEEE(append([]byte(typ), p...))
+	binary.BigEndian.PutUint32(n[:], crc)
+	b.Write(n[:])
+}
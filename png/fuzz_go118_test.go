@@ -0,0 +1,24 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package png
+
+import (
+	"github.com/mi-v/img1b/fuzz"
+	"testing"
+)
+
+func FuzzDecode(f *testing.F) {
+	for _, data := range FuzzCorpus() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := CheckDecode(data); fuzz.IsBug(err) {
+			t.Fatal(err)
+		}
+	})
+}
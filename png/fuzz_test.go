@@ -0,0 +1,57 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b/fuzz"
+	"testing"
+)
+
+func TestFuzzCorpus(t *testing.T) {
+	corpus := FuzzCorpus()
+	for i, data := range corpus {
+		m, err := DecodeBytes(data)
+		if err != nil {
+			t.Errorf("seed %d: %v", i, err)
+			continue
+		}
+		// The seeds differ in palette but all draw the same pattern.
+		ink := m.Palette[1]
+		for y := 0; y < m.Rect.Dy(); y++ {
+			for x := 0; x < m.Rect.Dx(); x++ {
+				want := (x*3+y*5)%7 < 3
+				if got := m.At(x, y) == ink; got != want {
+					t.Fatalf("seed %d: pixel (%d, %d) is %t, want %t", i, x, y, got, want)
+				}
+			}
+		}
+		if err := CheckDecode(data); err != nil {
+			t.Errorf("seed %d: CheckDecode: %v", i, err)
+		}
+		if DecodeFuzz(data) != 1 {
+			t.Errorf("seed %d: DecodeFuzz does not favor it", i)
+		}
+	}
+}
+
+func TestCheckDecodeMutations(t *testing.T) {
+	for i, seed := range FuzzCorpus() {
+		for j := 0; j < len(seed); j++ {
+			for _, data := range [][]byte{
+				seed[:j],
+				append(append([]byte(nil), seed[:j]...), seed[j]^0x5a),
+				append(append(append([]byte(nil), seed[:j]...), seed[j]^0x5a), seed[j+1:]...),
+			} {
+				if err := CheckDecode(data); fuzz.IsBug(err) {
+					t.Fatalf("seed %d cut or changed at %d: %v", i, j, err)
+				}
+			}
+		}
+	}
+	if DecodeFuzz(bytes.Repeat([]byte{0}, 16)) != 0 {
+		t.Error("DecodeFuzz favors garbage")
+	}
+}
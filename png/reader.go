@@ -6,19 +6,27 @@
 // Package png implements a PNG image decoder and encoder. Only 1-bit images can
 // be decoded (grayscale or paletted).
 //
+// Decoding errors are *DecodeError values wrapping the error that stopped
+// the decoder. Code testing for them directly, as err.(png.FormatError) or
+// err == io.ErrUnexpectedEOF, no longer matches: use errors.As and errors.Is,
+// which see through the wrapping, or the Kind of the DecodeError.
+//
 // The PNG specification is at https://www.w3.org/TR/PNG/.
 package png
 
 import (
+	"bufio"
 	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
 	"hash"
 	"hash/crc32"
 	"image"
 	"image/color"
 	"io"
+	"sync"
 )
 
 // Color type, as per the PNG spec.
@@ -104,7 +112,48 @@ const (
 
 const pngHeader = "\x89PNG\r\n\x1a\n"
 
+// Decoder configures decoding PNG images. A Decoder keeps its zlib reader,
+// checksum and row buffers between Decode calls, so decoding a series of
+// images with one allocates little more than the images. A Decoder must not
+// be used by several goroutines at once.
+type Decoder struct {
+	// Concurrency is the number of goroutines merging the passes of an
+	// interlaced image into the result once they are inflated. Values
+	// below 2 merge them in the decoding goroutine.
+	Concurrency int
+
+	// Progress, if not nil, is called after each of the 7 passes of an
+	// interlaced image, numbered from 1, with a coarse image of what the
+	// passes so far hold: the image is cut in blocks of 8×8 pixels after
+	// the first pass, down to 1×1 after the last, and each block takes the
+	// color of its top left pixel, decoded already. The image is the size
+	// of the result and only valid during the call; after the last pass it
+	// is the whole image. Progress is not called for images that are not
+	// interlaced.
+	Progress func(m *img1b.Image, pass int)
+
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their header is read.
+	Limits *img1b.Limits
+
+	// Report, if not nil, is called at the end of every decoding, failed
+	// ones included, with its Stats.
+	Report func(s Stats)
+
+	// Strictness selects how anomalies in the input are treated; the zero
+	// value is Normal.
+	Strictness Strictness
+
+	// Warnings, if not nil, is called with each anomaly in the input that
+	// the Strictness lets the decoding get past.
+	Warnings func(w Warning)
+
+	d *decoder
+}
+
 type decoder struct {
+	dec           *Decoder
 	r             io.Reader
 	img           *img1b.Image
 	crc           hash.Hash32
@@ -116,6 +165,64 @@ type decoder struct {
 	idatLength    uint32
 	tmp           [3 * 256]byte
 	interlace     int
+	br            *bufio.Reader
+	zr            io.ReadCloser
+	cr, pr        []byte
+	ir            idatReader
+	idat          [][]byte
+	// region tells whether only the rows from yMin to yMax are wanted.
+	region     bool
+	yMin, yMax int
+	counter    countingReader
+	stats      Stats
+	timer      timer
+	// chunk and chunkOffset are the type and the offset of the chunk being
+	// read, for errors.
+	chunk       string
+	chunkOffset int64
+	// eof tells that the input ended in the image data.
+	eof bool
+	// plte is the number of entries of the PLTE chunk.
+	plte int
+	// once has the bits of the singleChunks seen.
+	once uint16
+}
+
+// reset prepares d to decode a new image from r, keeping its buffers.
+func (d *decoder) reset(r io.Reader) {
+	if d.crc == nil {
+		d.crc = crc32.NewIEEE()
+	}
+	*d = decoder{
+		dec: d.dec,
+		r:   r,
+		crc: d.crc,
+		palette: color.Palette{
+			color.RGBAModel.Convert(color.Black),
+			color.RGBAModel.Convert(color.White),
+		},
+		br:   d.br,
+		zr:   d.zr,
+		cr:   d.cr,
+		pr:   d.pr,
+		idat: d.idat,
+	}
+	d.crc.Reset()
+	if r != nil {
+		d.counter.r = r
+		d.r = &d.counter
+	}
+}
+
+// report passes the stats of the decoding ending with err to the Report
+// hook.
+func (d *decoder) report(err error) {
+	if d.dec.Report == nil {
+		return
+	}
+	d.timer.end(&d.stats)
+	d.stats.Err = err
+	d.dec.Report(d.stats)
 }
 
 // A FormatError reports that the input is not a valid PNG.
@@ -123,7 +230,10 @@ type FormatError string
 
 func (e FormatError) Error() string { return "png: invalid format: " + string(e) }
 
-var chunkOrderError = FormatError("chunk out of order")
+var (
+	chunkOrderError = FormatError("chunk out of order")
+	checksumError   = FormatError("invalid checksum")
+)
 
 // An UnsupportedError reports that the input uses a valid but unimplemented PNG feature.
 type UnsupportedError string
@@ -145,19 +255,30 @@ func (d *decoder) parseIHDR(length uint32) error {
 		return err
 	}
 	d.crc.Write(d.tmp[:13])
-	if d.tmp[10] != 0 {
+	if err := d.setIHDR(d.tmp[:13]); err != nil {
+		return err
+	}
+	return d.verifyChecksum()
+}
+
+// setIHDR applies the payload of an IHDR chunk.
+func (d *decoder) setIHDR(p []byte) error {
+	if len(p) != 13 {
+		return FormatError("bad IHDR length")
+	}
+	if p[10] != 0 {
 		return UnsupportedError("compression method")
 	}
-	if d.tmp[11] != 0 {
+	if p[11] != 0 {
 		return UnsupportedError("filter method")
 	}
-	if d.tmp[12] != itNone && d.tmp[12] != itAdam7 {
+	if p[12] != itNone && p[12] != itAdam7 {
 		return FormatError("invalid interlace method")
 	}
-	d.interlace = int(d.tmp[12])
+	d.interlace = int(p[12])
 
-	w := int32(binary.BigEndian.Uint32(d.tmp[0:4]))
-	h := int32(binary.BigEndian.Uint32(d.tmp[4:8]))
+	w := int32(binary.BigEndian.Uint32(p[0:4]))
+	h := int32(binary.BigEndian.Uint32(p[4:8]))
 	if w <= 0 || h <= 0 {
 		return FormatError("non-positive dimension")
 	}
@@ -165,11 +286,14 @@ func (d *decoder) parseIHDR(length uint32) error {
 	if nPixels != int64(int(nPixels)) {
 		return UnsupportedError("dimension overflow")
 	}
+	if err := d.dec.Limits.Check(int(w), int(h)); err != nil {
+		return err
+	}
 
 	d.cb = cbInvalid
-	d.depth = int(d.tmp[8])
+	d.depth = int(p[8])
 	if d.depth == 1 {
-		switch d.tmp[9] {
+		switch p[9] {
 		case ctGrayscale:
 			d.cb = cbG1
 		case ctPaletted:
@@ -177,10 +301,10 @@ func (d *decoder) parseIHDR(length uint32) error {
 		}
 	}
 	if d.cb == cbInvalid {
-		return UnsupportedError(fmt.Sprintf("bit depth %d, color type %d", d.tmp[8], d.tmp[9]))
+		return UnsupportedError(fmt.Sprintf("bit depth %d, color type %d", p[8], p[9]))
 	}
 	d.width, d.height = int(w), int(h)
-	return d.verifyChecksum()
+	return nil
 }
 
 func (d *decoder) parsePLTE(length uint32) error {
@@ -193,58 +317,74 @@ func (d *decoder) parsePLTE(length uint32) error {
 		return err
 	}
 	d.crc.Write(d.tmp[:n])
+	if err := d.setPLTE(d.tmp[:n]); err != nil {
+		return err
+	}
+	return d.verifyChecksum()
+}
 
+// setPLTE applies the payload of a PLTE chunk.
+func (d *decoder) setPLTE(p []byte) error {
+	np := len(p) / 3 // The number of palette entries.
+	if len(p)%3 != 0 || np < 1 || np > 2 {
+		return FormatError("bad PLTE length")
+	}
 	if d.cb != cbP1 {
 		return FormatError("PLTE, color type mismatch")
 	}
 
-	d.palette[0] = color.RGBA{d.tmp[0], d.tmp[1], d.tmp[2], 0xff}
+	d.plte = np
+	d.palette[0] = color.RGBA{p[0], p[1], p[2], 0xff}
 	if np == 2 {
-		d.palette[1] = color.RGBA{d.tmp[3], d.tmp[4], d.tmp[5], 0xff}
+		d.palette[1] = color.RGBA{p[3], p[4], p[5], 0xff}
 	} else {
 		d.palette[1] = color.RGBA{0x00, 0x00, 0x00, 0xff}
 	}
+	return nil
+}
 
+func (d *decoder) parsetRNS(length uint32) error {
+	if length > 2 {
+		return FormatError("bad tRNS length")
+	}
+	n, err := io.ReadFull(d.r, d.tmp[:length])
+	if err != nil {
+		return err
+	}
+	d.crc.Write(d.tmp[:n])
+	if err := d.settRNS(d.tmp[:n]); err != nil {
+		return err
+	}
 	return d.verifyChecksum()
 }
 
-func (d *decoder) parsetRNS(length uint32) error {
+// settRNS applies the payload of a tRNS chunk.
+func (d *decoder) settRNS(p []byte) error {
 	switch d.cb {
 	case cbG1:
-		if length != 2 {
+		if len(p) != 2 {
 			return FormatError("bad tRNS length")
 		}
-		n, err := io.ReadFull(d.r, d.tmp[:length])
-		if err != nil {
-			return err
-		}
-		d.crc.Write(d.tmp[:n])
-
-		rgba := d.palette[d.tmp[1]&1].(color.RGBA)
-		d.palette[d.tmp[1]&1] = color.NRGBA{rgba.R, rgba.G, rgba.B, 0}
+		rgba := d.palette[p[1]&1].(color.RGBA)
+		d.palette[p[1]&1] = color.NRGBA{rgba.R, rgba.G, rgba.B, 0}
 
 	case cbP1:
-		if length > 2 {
+		n := len(p)
+		if n > 2 {
 			return FormatError("bad tRNS length")
 		}
-		n, err := io.ReadFull(d.r, d.tmp[:length])
-		if err != nil {
-			return err
-		}
-		d.crc.Write(d.tmp[:n])
-
 		if len(d.palette) < n {
 			d.palette = d.palette[:n]
 		}
 		for i := 0; i < n; i++ {
 			rgba := d.palette[i].(color.RGBA)
-			d.palette[i] = color.NRGBA{rgba.R, rgba.G, rgba.B, d.tmp[i]}
+			d.palette[i] = color.NRGBA{rgba.R, rgba.G, rgba.B, p[i]}
 		}
 
 	default:
 		return FormatError("tRNS, color type mismatch")
 	}
-	return d.verifyChecksum()
+	return nil
 }
 
 // Read presents one or more IDAT chunks as one continuous stream (minus the
@@ -265,13 +405,17 @@ func (d *decoder) Read(p []byte) (int, error) {
 		}
 		// Read the length and chunk type of the next chunk, and check that
 		// it is an IDAT chunk.
+		d.chunk, d.chunkOffset = "", d.counter.n
 		if _, err := io.ReadFull(d.r, d.tmp[:8]); err != nil {
+			d.eof = err == io.EOF || err == io.ErrUnexpectedEOF
 			return 0, err
 		}
+		d.chunk = string(d.tmp[4:8])
 		d.idatLength = binary.BigEndian.Uint32(d.tmp[:4])
 		if string(d.tmp[4:8]) != "IDAT" {
 			return 0, FormatError("not enough pixel data")
 		}
+		d.stats.Chunks++
 		d.crc.Reset()
 		d.crc.Write(d.tmp[4:8])
 	}
@@ -279,17 +423,51 @@ func (d *decoder) Read(p []byte) (int, error) {
 		return 0, UnsupportedError("IDAT chunk length overflow")
 	}
 	n, err := d.r.Read(p[:min(len(p), int(d.idatLength))])
+	if err == io.EOF {
+		d.eof = true
+	}
 	d.crc.Write(p[:n])
 	d.idatLength -= uint32(n)
 	return n, err
 }
 
-// decode decodes the IDAT data into an image.
-func (d *decoder) decode() (*img1b.Image, error) {
-	r, err := zlib.NewReader(d)
+// rows returns the range of rows to decode, clipped to the image.
+func (d *decoder) rows() (y0, y1 int) {
+	if !d.region {
+		return 0, d.height
+	}
+	y0, y1 = d.yMin, d.yMax
+	if y0 < 0 {
+		y0 = 0
+	}
+	if y1 > d.height {
+		y1 = d.height
+	}
+	if y1 < y0 {
+		y1 = y0
+	}
+	return y0, y1
+}
+
+// partial reports whether the decoding stops before the end of the image
+// data, which then is not checked.
+func (d *decoder) partial() bool {
+	_, y1 := d.rows()
+	return d.interlace == itNone && y1 < d.height
+}
+
+// decode decodes the IDAT data read from src into an image.
+func (d *decoder) decode(src io.Reader) (*img1b.Image, error) {
+	var err error
+	if d.zr == nil {
+		d.zr, err = zlib.NewReader(src)
+	} else {
+		err = d.zr.(zlib.Resetter).Reset(src, nil)
+	}
 	if err != nil {
 		return nil, err
 	}
+	r := d.zr
 	defer r.Close()
 	var img *img1b.Image
 	if d.interlace == itNone {
@@ -303,16 +481,42 @@ func (d *decoder) decode() (*img1b.Image, error) {
 		if err != nil {
 			return nil, err
 		}
+		var passes [7]*img1b.Image
+		var preview *img1b.Image
 		for pass := 0; pass < 7; pass++ {
 			imagePass, err := d.readImagePass(r, pass, false)
 			if err != nil {
 				return nil, err
 			}
-			if imagePass != nil {
+			if d.dec.Concurrency > 1 || d.dec.Progress != nil {
+				passes[pass] = imagePass
+			} else if imagePass != nil {
 				d.mergePassInto(img, imagePass, pass)
 			}
+			if d.dec.Progress != nil {
+				if preview == nil {
+					preview = img1b.New(img.Rect, d.palette)
+				}
+				fillPreview(preview, &passes, pass)
+				d.dec.Progress(preview, pass+1)
+			}
+		}
+		if d.dec.Concurrency > 1 {
+			d.mergePasses(img, &passes, d.dec.Concurrency)
+		} else if d.dec.Progress != nil {
+			for pass, src := range passes {
+				if src != nil {
+					d.mergePassInto(img, src, pass)
+				}
+			}
 		}
 	}
+	if err := d.checkPalette(img); err != nil {
+		return nil, err
+	}
+	if d.partial() {
+		return img, nil
+	}
 
 	// Check for EOF, to verify the zlib checksum.
 	n := 0
@@ -323,10 +527,18 @@ func (d *decoder) decode() (*img1b.Image, error) {
 		n, err = r.Read(d.tmp[:1])
 	}
 	if err != nil && err != io.EOF {
+		if d.eof {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err == zlib.ErrChecksum {
+			return nil, err
+		}
 		return nil, FormatError(err.Error())
 	}
 	if n != 0 || d.idatLength != 0 {
-		return nil, FormatError("too much pixel data")
+		if err := d.tooMuchData(); err != nil {
+			return nil, err
+		}
 	}
 
 	return img, nil
@@ -338,6 +550,8 @@ func (d *decoder) readImagePass(r io.Reader, pass int, allocateOnly bool) (*img1
 	var img *img1b.Image
 
 	width, height := d.width, d.height
+	// The rows of the image returned; a pass has them all.
+	y0, y1 := d.rows()
 	if d.interlace == itAdam7 && !allocateOnly {
 		p := interlacing[pass]
 		// Add the multiplication factor and subtract one, effectively rounding up.
@@ -349,8 +563,12 @@ func (d *decoder) readImagePass(r io.Reader, pass int, allocateOnly bool) (*img1
 		if width == 0 || height == 0 {
 			return nil, nil
 		}
+		y0, y1 = 0, height
+	}
+	img, err := d.dec.Limits.New(image.Rect(0, y0, width, y1), d.palette)
+	if err != nil {
+		return nil, err
 	}
-	img = img1b.New(image.Rect(0, 0, width, height), d.palette)
 	if allocateOnly {
 		return img, nil
 	}
@@ -358,13 +576,27 @@ func (d *decoder) readImagePass(r io.Reader, pass int, allocateOnly bool) (*img1
 	// The +1 is for the per-row filter type, which is at cr[0].
 	rowSize := 1 + (width+7)/8
 	// cr and pr are the bytes for the current and previous row.
-	cr := make([]uint8, rowSize)
-	pr := make([]uint8, rowSize)
+	if cap(d.cr) < rowSize {
+		d.cr = make([]uint8, rowSize)
+		d.pr = make([]uint8, rowSize)
+	}
+	cr := d.cr[:rowSize]
+	pr := d.pr[:rowSize]
+	tm := bitmap.TailMask(width)
+	// The row above the first one is all zeros.
+	for i := range pr {
+		pr[i] = 0
+	}
 
-	for y := 0; y < height; y++ {
+	// The rows above the region are read for the filters of the rows below.
+	for y := 0; y < y1; y++ {
 		// Read the decompressed bytes.
 		_, err := io.ReadFull(r, cr)
 		if err != nil {
+			if d.eof {
+				// The input, not the stream in it, was cut short.
+				return nil, io.ErrUnexpectedEOF
+			}
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				return nil, FormatError("not enough pixel data")
 			}
@@ -399,8 +631,13 @@ func (d *decoder) readImagePass(r io.Reader, pass int, allocateOnly bool) (*img1
 			return nil, FormatError("bad filter type")
 		}
 
-		copy(img.Pix[pixOffset:], cdat)
-		pixOffset += img.Stride
+		if y >= y0 {
+			copy(img.Pix[pixOffset:], cdat)
+			// The bits past the right edge may be anything in the file.
+			img.Pix[pixOffset+len(cdat)-1] &= tm
+			pixOffset += img.Stride
+		}
+		d.stats.Rows++
 
 		// The current row for y is the previous row for y+1.
 		pr, cr = cr, pr
@@ -418,20 +655,123 @@ func (d *decoder) mergePassInto(dst *img1b.Image, src *img1b.Image, pass int) {
 	rect = dst.Rect
 	bounds := src.Bounds()
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		dstY := y*p.yFactor + p.yOffset - rect.Min.Y
+		dstY := y*p.yFactor + p.yOffset
+		if dstY < rect.Min.Y || dstY >= rect.Max.Y {
+			continue
+		}
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			dstX := x*p.xFactor + p.xOffset - rect.Min.X
+			dstX := x*p.xFactor + p.xOffset
 			dst.SetColorIndex(dstX, dstY, src.ColorIndexAt(x, y))
 		}
 	}
 }
 
+// mergePasses merges the passes into a full sized image with n workers,
+// each of them filling a band of rows.
+func (d *decoder) mergePasses(dst *img1b.Image, passes *[7]*img1b.Image, n int) {
+	h := dst.Rect.Dy()
+	if n > h {
+		n = h
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		y0, y1 := h*i/n, h*(i+1)/n
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := y0; i < y1; i++ {
+				y := dst.Rect.Min.Y + i
+				for pass, src := range passes {
+					p := interlacing[pass]
+					if src == nil || y < p.yOffset || (y-p.yOffset)%p.yFactor != 0 {
+						continue
+					}
+					mergePassRow(dst.Pix[i*dst.Stride:(i+1)*dst.Stride], src, (y-p.yOffset)/p.yFactor, p)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// previewBlocks holds the width and height of the blocks of pixels whose
+// top left pixel is known after each pass.
+var previewBlocks = [7][2]int{{8, 8}, {4, 8}, {4, 4}, {2, 4}, {2, 2}, {1, 2}, {1, 1}}
+
+// fillPreview fills dst with the passes up to the given one, each pixel
+// taking the color of the top left pixel of its block, which those passes
+// hold.
+func fillPreview(dst *img1b.Image, passes *[7]*img1b.Image, pass int) {
+	bw, bh := previewBlocks[pass][0], previewBlocks[pass][1]
+	w := dst.Rect.Dx()
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		row := dst.Pix[(y-dst.Rect.Min.Y)*dst.Stride:]
+		row = row[:(w+7)/8]
+		for i := range row {
+			row[i] = 0
+		}
+		y0 := y &^ (bh - 1)
+		for x0 := 0; x0 < w; x0 += bw {
+			// Find the pass of the pixel at (x0, y0).
+			for q := 0; q <= pass; q++ {
+				p := interlacing[q]
+				if x0 < p.xOffset || y0 < p.yOffset || (x0-p.xOffset)%p.xFactor != 0 || (y0-p.yOffset)%p.yFactor != 0 {
+					continue
+				}
+				if passes[q].ColorIndexAt((x0-p.xOffset)/p.xFactor, (y0-p.yOffset)/p.yFactor) != 0 {
+					for x := x0; x < x0+bw && x < w; x++ {
+						row[x>>3] |= 0x80 >> uint(x&7)
+					}
+				}
+				break
+			}
+		}
+	}
+}
+
+// mergePassRow sets the bits of row sy of a pass in the destination row.
+// The passes cover disjoint pixels, so the bits are only ever set.
+func mergePassRow(row []byte, src *img1b.Image, sy int, p interlaceScan) {
+	sr := src.Pix[sy*src.Stride:]
+	for x := 0; x < src.Rect.Dx(); x++ {
+		if sr[x>>3]&(0x80>>uint(x&7)) == 0 {
+			continue
+		}
+		dx := x*p.xFactor + p.xOffset
+		row[dx>>3] |= 0x80 >> uint(dx&7)
+	}
+}
+
 func (d *decoder) parseIDAT(length uint32) (err error) {
 	d.idatLength = length
-	d.img, err = d.decode()
+	// The zlib reader would wrap d in a new bufio.Reader every time.
+	if d.br == nil {
+		d.br = bufio.NewReader(d)
+	} else {
+		d.br.Reset(d)
+	}
+	d.img, err = d.decode(d.br)
 	if err != nil {
 		return err
 	}
+	if d.partial() {
+		return nil
+	}
+	// The reader may hold data after the stream, read ahead.
+	if d.br.Buffered() != 0 {
+		if err := d.tooMuchData(); err != nil {
+			return err
+		}
+	}
+	// Skip the data Permissive mode leaves in the chunk.
+	for d.idatLength > 0 {
+		n, err := io.ReadFull(d.r, d.tmp[:min(len(d.tmp), int(d.idatLength))])
+		if err != nil {
+			return err
+		}
+		d.crc.Write(d.tmp[:n])
+		d.idatLength -= uint32(n)
+	}
 	return d.verifyChecksum()
 }
 
@@ -442,65 +782,95 @@ func (d *decoder) parseIEND(length uint32) error {
 	return d.verifyChecksum()
 }
 
-func (d *decoder) parseChunk() error {
-	// Read the length and chunk type.
-	_, err := io.ReadFull(d.r, d.tmp[:8])
-	if err != nil {
-		return err
-	}
-	length := binary.BigEndian.Uint32(d.tmp[:4])
-	d.crc.Reset()
-	d.crc.Write(d.tmp[4:8])
-
-	// Read the chunk data.
-	switch string(d.tmp[4:8]) {
+// nextStage checks that a chunk comes in order and advances the decoding
+// stage past it. It reports whether the chunk is to be parsed; unknown and
+// trailing IDAT chunks are ignored.
+func (d *decoder) nextStage(name string, length int) (bool, error) {
+	d.stats.Chunks++
+	switch name {
 	case "IHDR":
 		if d.stage != dsStart {
-			return chunkOrderError
+			return false, chunkOrderError
 		}
 		d.stage = dsSeenIHDR
-		return d.parseIHDR(length)
 	case "PLTE":
 		if d.stage != dsSeenIHDR {
-			return chunkOrderError
+			return false, chunkOrderError
 		}
 		d.stage = dsSeenPLTE
-		return d.parsePLTE(length)
 	case "tRNS":
+		if d.stage == dsSeentRNS && d.dec.Strictness == Permissive {
+			return false, d.anomaly(false, FormatError("repeated tRNS chunk"))
+		}
 		if cbPaletted(d.cb) {
 			if d.stage != dsSeenPLTE {
-				return chunkOrderError
+				return false, chunkOrderError
 			}
 		} else if d.stage != dsSeenIHDR {
-			return chunkOrderError
+			return false, chunkOrderError
 		}
 		d.stage = dsSeentRNS
-		return d.parsetRNS(length)
 	case "IDAT":
 		if d.stage < dsSeenIHDR || d.stage > dsSeenIDAT || (d.stage == dsSeenIHDR && cbPaletted(d.cb)) {
-			return chunkOrderError
+			return false, chunkOrderError
 		} else if d.stage == dsSeenIDAT {
 			// Ignore trailing zero-length or garbage IDAT chunks.
 			//
 			// This does not affect valid PNG images that contain multiple IDAT
-			// chunks, since the first call to parseIDAT below will consume all
+			// chunks, since the first call to parseIDAT will consume all
 			// consecutive IDAT chunks required for decoding the image.
-			break
+			return false, d.trailingIDAT(length)
 		}
 		d.stage = dsSeenIDAT
-		return d.parseIDAT(length)
+		d.timer.beginData()
 	case "IEND":
 		if d.stage != dsSeenIDAT {
-			return chunkOrderError
+			return false, chunkOrderError
 		}
 		d.stage = dsSeenIEND
-		return d.parseIEND(length)
+	default:
+		return false, d.ancillary(name)
+	}
+	return true, nil
+}
+
+func (d *decoder) parseChunk() error {
+	// Read the length and chunk type.
+	d.chunk, d.chunkOffset = "", d.counter.n
+	_, err := io.ReadFull(d.r, d.tmp[:8])
+	if err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(d.tmp[:4])
+	d.crc.Reset()
+	d.crc.Write(d.tmp[4:8])
+
+	// Read the chunk data.
+	name := string(d.tmp[4:8])
+	d.chunk = name
+	known, err := d.nextStage(name, int(length))
+	if err != nil {
+		return err
+	}
+	if known {
+		switch name {
+		case "IHDR":
+			return d.parseIHDR(length)
+		case "PLTE":
+			return d.parsePLTE(length)
+		case "tRNS":
+			return d.parsetRNS(length)
+		case "IDAT":
+			return d.parseIDAT(length)
+		case "IEND":
+			return d.parseIEND(length)
+		}
 	}
 	if length > 0x7fffffff {
 		return FormatError(fmt.Sprintf("Bad chunk length: %d", length))
 	}
 	// Ignore this chunk (of a known length).
-	var ignored [4096]byte
+	ignored := d.tmp[:]
 	for length > 0 {
 		n, err := io.ReadFull(d.r, ignored[:min(len(ignored), int(length))])
 		if err != nil {
@@ -517,7 +887,7 @@ func (d *decoder) verifyChecksum() error {
 		return err
 	}
 	if binary.BigEndian.Uint32(d.tmp[:4]) != d.crc.Sum32() {
-		return FormatError("invalid checksum")
+		return checksumError
 	}
 	return nil
 }
@@ -535,21 +905,52 @@ func (d *decoder) checkHeader() error {
 
 // Decode reads a PNG image from r and returns it as an img1b.Image.
 func Decode(r io.Reader) (*img1b.Image, error) {
-	d := &decoder{
-		r:   r,
-		crc: crc32.NewIEEE(),
-		palette: color.Palette{
-			color.RGBAModel.Convert(color.Black),
-			color.RGBAModel.Convert(color.White),
-		},
-	}
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads a PNG image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	return dec.decode(r, false, 0, 0)
+}
+
+// DecodeRegion reads the rows from yMin to yMax of a PNG image from r. The
+// image returned has the bounds of those rows, clipped to the image, as
+// SubImage would give. Only the image data up to yMax are inflated and
+// filtered; reading stops there, so that the rest of r, including its
+// checksums, is not read. An interlaced image spreads every row over the
+// whole data and is inflated to the end, but only the rows asked for are
+// assembled.
+func (dec *Decoder) DecodeRegion(r io.Reader, yMin, yMax int) (*img1b.Image, error) {
+	return dec.decode(r, true, yMin, yMax)
+}
+
+func (dec *Decoder) decode(r io.Reader, region bool, yMin, yMax int) (*img1b.Image, error) {
+	if dec.d == nil {
+		dec.d = &decoder{dec: dec}
+	}
+	d := dec.d
+	d.reset(r)
+	d.region, d.yMin, d.yMax = region, yMin, yMax
+	// Do not hold on to r or the image.
+	defer func() { d.r, d.counter.r, d.img = nil, nil, nil }()
+	d.timer.begin()
+	img, err := d.decodeStream()
+	err = d.wrap(err)
+	d.stats.Bytes = d.counter.n
+	d.report(err)
+	return img, err
+}
+
+// decodeStream decodes the image from d.r.
+func (d *decoder) decodeStream() (*img1b.Image, error) {
 	if err := d.checkHeader(); err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
 		return nil, err
 	}
-	for d.stage != dsSeenIEND {
+	for d.stage != dsSeenIEND && !(d.region && d.stage == dsSeenIDAT) {
 		if err := d.parseChunk(); err != nil {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
@@ -563,26 +964,20 @@ func Decode(r io.Reader) (*img1b.Image, error) {
 // DecodeConfig returns the color model and dimensions of a PNG image without
 // decoding the entire image.
 func DecodeConfig(r io.Reader) (image.Config, error) {
-	d := &decoder{
-		r:   r,
-		crc: crc32.NewIEEE(),
-		palette: color.Palette{
-			color.RGBAModel.Convert(color.Black),
-			color.RGBAModel.Convert(color.White),
-		},
-	}
+	d := &decoder{dec: &Decoder{}}
+	d.reset(r)
 	if err := d.checkHeader(); err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return image.Config{}, err
+		return image.Config{}, d.wrap(err)
 	}
 	for {
 		if err := d.parseChunk(); err != nil {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			return image.Config{}, err
+			return image.Config{}, d.wrap(err)
 		}
 		paletted := cbPaletted(d.cb)
 		if d.stage == dsSeenIHDR && !paletted {
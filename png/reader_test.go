@@ -8,12 +8,15 @@ package png
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/mi-v/img1b"
+	"image"
 	"image/color"
 	gopng "image/png"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"reflect"
 	"strings"
@@ -222,6 +225,201 @@ func TestInterlaced(t *testing.T) {
 	}
 }
 
+func TestInterlacedConcurrency(t *testing.T) {
+	want, err := readPNG("testdata/gradient.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("testdata/gradient.interlaced.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{2, 3, 7, 1000} {
+		d := Decoder{Concurrency: n}
+		got, err := d.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", n, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("concurrency %d: decodings differ", n)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	want, err := readPNG("testdata/gradient.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("testdata/gradient.interlaced.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []int{1, 3} {
+		var passes []int
+		d := Decoder{Concurrency: c}
+		d.Progress = func(m *img1b.Image, pass int) {
+			passes = append(passes, pass)
+			bw, bh := previewBlocks[pass-1][0], previewBlocks[pass-1][1]
+			if m.Rect != want.Rect {
+				t.Fatalf("pass %d: bounds %v, want %v", pass, m.Rect, want.Rect)
+			}
+			for y := 0; y < m.Rect.Dy(); y++ {
+				for x := 0; x < m.Rect.Dx(); x++ {
+					if m.ColorIndexAt(x, y) != want.ColorIndexAt(x&^(bw-1), y&^(bh-1)) {
+						t.Fatalf("pass %d: pixel (%d, %d) differs", pass, x, y)
+					}
+				}
+			}
+		}
+		got, err := d.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("concurrency %d: decodings differ", c)
+		}
+		if !reflect.DeepEqual(passes, []int{1, 2, 3, 4, 5, 6, 7}) {
+			t.Errorf("concurrency %d: passes %v", c, passes)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/benchBW.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int64(m.Rect.Dx() * m.Rect.Dy())
+	allocs := 0
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: n, Alloc: func(n int) []byte {
+		allocs++
+		return make([]byte, n)
+	}}}
+	if _, err := d.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	if allocs != 1 {
+		t.Errorf("%d allocations, want 1", allocs)
+	}
+	d.Limits.MaxPixels--
+	if _, err := d.Decode(bytes.NewReader(data)); err == nil {
+		t.Error("over the limit: no error")
+	} else if le := img1b.LimitError(""); !errors.As(err, &le) {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
+
+func TestDecoderReuse(t *testing.T) {
+	files := []string{
+		"testdata/gradient.interlaced.png",
+		"testdata/pngsuite/basn0g01.png",
+		"testdata/invalid-crc32.png",
+		"testdata/benchBW.png",
+		"testdata/invalid-trunc.png",
+		"testdata/pngsuite/basn3p01.png",
+		"testdata/gradient.png",
+	}
+	var d Decoder
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, wantErr := Decode(bytes.NewReader(data))
+		got, err := d.Decode(bytes.NewReader(data))
+		if (err == nil) != (wantErr == nil) {
+			t.Errorf("%s: got error %v, want %v", fn, err, wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decodings differ", fn)
+		}
+	}
+
+	data, err := ioutil.ReadFile("testdata/benchBW.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused := testing.AllocsPerRun(10, func() { d.Decode(bytes.NewReader(data)) })
+	fresh := testing.AllocsPerRun(10, func() { Decode(bytes.NewReader(data)) })
+	if reused >= fresh {
+		t.Errorf("reused Decoder: %v allocations, a new one: %v", reused, fresh)
+	}
+}
+
+func TestDecodeRegion(t *testing.T) {
+	for _, fn := range []string{
+		"testdata/gradient.png",
+		"testdata/gradient.interlaced.png",
+		"testdata/benchBW.png",
+	} {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, h := full.Rect.Dx(), full.Rect.Dy()
+		for _, c := range []int{1, 3} {
+			d := Decoder{Concurrency: c}
+			for _, r := range [][2]int{{0, 1}, {3, 17}, {-5, 10}, {h - 3, h + 10}, {0, h}, {5, 5}} {
+				got, err := d.DecodeRegion(bytes.NewReader(data), r[0], r[1])
+				if err != nil {
+					t.Errorf("%s %v: %v", fn, r, err)
+					continue
+				}
+				want := full.SubImage(image.Rect(0, r[0], w, r[1]))
+				if got.Rect != want.Rect && !(got.Rect.Empty() && want.Rect.Empty()) {
+					t.Errorf("%s %v: bounds %v, want %v", fn, r, got.Rect, want.Rect)
+					continue
+				}
+				for y := want.Rect.Min.Y; y < want.Rect.Max.Y; y++ {
+					for x := 0; x < w; x++ {
+						if got.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) {
+							t.Fatalf("%s %v: pixel (%d, %d) differs", fn, r, x, y)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeRegionTruncated(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 800, 1000), color.Palette{color.White, color.Black})
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()[:buf.Len()/2]
+	if _, err := Decode(bytes.NewReader(data)); err == nil {
+		t.Fatal("Decode of truncated data: no error")
+	}
+	var d Decoder
+	got, err := d.DecodeRegion(bytes.NewReader(data), 10, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 10; y < 20; y++ {
+		for x := 0; x < 800; x++ {
+			if got.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) {
+				t.Fatalf("pixel (%d, %d) differs", x, y)
+			}
+		}
+	}
+	if _, err := d.DecodeRegion(bytes.NewReader(data), 900, 1000); err == nil {
+		t.Error("rows past the truncation: no error")
+	}
+}
+
 func TestIncompleteIDATOnRowBoundary(t *testing.T) {
 	// The following is an invalid 1x2 grayscale PNG image. The header is OK,
 	// but the zlib-compressed IDAT payload contains two bytes "\x02\x00",
@@ -397,3 +595,23 @@ func BenchmarkDecodeStock(b *testing.B) {
 		gopng.Decode(bytes.NewReader(data))
 	}
 }
+
+func BenchmarkDecoderReuse(b *testing.B) {
+	data, err := ioutil.ReadFile("testdata/benchBW.png")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var d Decoder
+	r := bytes.NewReader(data)
+	b.SetBytes(int64(cfg.Width * cfg.Height / 8))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		d.Decode(r)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"io"
+	"time"
+)
+
+// Stats describes a decoding or an encoding, for services exporting metrics
+// or looking for inputs that take unusually long.
+type Stats struct {
+	// Bytes is the number of bytes of PNG data read or written.
+	Bytes int64
+	// Chunks is the number of chunks read or written, IDAT chunks included.
+	Chunks int
+	// Rows is the number of rows filtered or packed, counting the rows of
+	// every pass of an interlaced image.
+	Rows int
+	// Header is the time taken by the signature and the chunks before the
+	// image data.
+	Header time.Duration
+	// Data is the time taken by the image data: inflating and filtering it,
+	// or packing and deflating it.
+	Data time.Duration
+	// Err is the error returned, if any.
+	Err error
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// timer measures the stages of a decoding or an encoding into a Stats.
+type timer struct {
+	start, data time.Time
+}
+
+func (t *timer) begin() { t.start = time.Now(); t.data = time.Time{} }
+
+// beginData marks the start of the image data.
+func (t *timer) beginData() { t.data = time.Now() }
+
+// end fills in the durations of s.
+func (t *timer) end(s *Stats) {
+	now := time.Now()
+	if t.data.IsZero() {
+		s.Header = now.Sub(t.start)
+		return
+	}
+	s.Header = t.data.Sub(t.start)
+	s.Data = now.Sub(t.data)
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 700, 300), color.Palette{color.White, color.Black})
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	for _, c := range []int{0, 4} {
+		var es Stats
+		enc := Encoder{Concurrency: c, Report: func(s Stats) { es = s }}
+		var buf bytes.Buffer
+		if err := enc.Encode(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		chunks := 0
+		for b := data[8:]; len(b) > 0; {
+			_, _, rest, err := nextChunk(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b = rest
+			chunks++
+		}
+		want := Stats{Bytes: int64(len(data)), Chunks: chunks, Rows: 300}
+		if es.Bytes != want.Bytes || es.Chunks != want.Chunks || es.Rows != want.Rows || es.Err != nil {
+			t.Errorf("concurrency %d: encoding stats %+v, want %+v", c, es, want)
+		}
+
+		var ds []Stats
+		dec := Decoder{Report: func(s Stats) { ds = append(ds, s) }}
+		if _, err := dec.Decode(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dec.DecodeBytes(data); err != nil {
+			t.Fatal(err)
+		}
+		for i, s := range ds {
+			if s.Bytes != want.Bytes || s.Chunks != want.Chunks || s.Rows != want.Rows || s.Err != nil {
+				t.Errorf("concurrency %d: decoding %d stats %+v, want %+v", c, i, s, want)
+			}
+		}
+	}
+}
+
+func TestStatsError(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 100, 100), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	var got Stats
+	dec := Decoder{Report: func(s Stats) { n++; got = s }}
+	_, err := dec.Decode(bytes.NewReader(buf.Bytes()[:buf.Len()-20]))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if n != 1 || got.Err != err {
+		t.Errorf("%d reports, error %v, want 1 and %v", n, got.Err, err)
+	}
+}
+
+func TestRowWriterStats(t *testing.T) {
+	var got Stats
+	var buf bytes.Buffer
+	enc := Encoder{Report: func(s Stats) { got = s }}
+	rw, err := enc.NewRowWriter(&buf, 20, 5, color.Palette{color.White, color.Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := make([]byte, 3)
+	for i := 0; i < 5; i++ {
+		if err := rw.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got.Bytes != int64(buf.Len()) || got.Rows != 5 || got.Err != nil {
+		t.Errorf("stats %+v, %d bytes written", got, buf.Len())
+	}
+}
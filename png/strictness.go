@@ -0,0 +1,123 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"strings"
+)
+
+// Strictness selects how a Decoder treats anomalies that do not keep it from
+// decoding an image: data after the end of the image data, pixels referring
+// to a palette entry the PLTE chunk lacks, repeated ancillary chunks and
+// unknown critical chunks. The anomalies it gets past are passed to the
+// Warnings hook of the Decoder.
+type Strictness int
+
+const (
+	// Normal rejects data left after the end of the image data in its last
+	// IDAT chunk and repeated tRNS chunks. It ignores IDAT chunks after the
+	// one the image data ends in, other repeated ancillary chunks and
+	// unknown critical chunks, and shows pixels out of the palette opaque
+	// black.
+	Normal Strictness = iota
+
+	// Strict rejects every anomaly, for archives that only take images
+	// valid to the letter of the PNG specification. Empty IDAT chunks after
+	// the image data are allowed, as the specification does.
+	Strict
+
+	// Permissive decodes whatever it can: it ignores any data after the
+	// image data, any repeated ancillary chunk, keeping the first one, and
+	// unknown critical chunks, and shows pixels out of the palette opaque
+	// black.
+	Permissive
+)
+
+// A Warning is an anomaly in the input that a Decoder got past, as its
+// Strictness allows, for pipelines keeping track of the quality of their
+// data.
+type Warning struct {
+	// Chunk and Offset are the type and the offset in the input of the
+	// chunk of the anomaly, as for a DecodeError.
+	Chunk  string
+	Offset int64
+	// Err is the error Strict mode fails with: a FormatError, or an
+	// UnsupportedError for an unknown critical chunk.
+	Err error
+}
+
+func (w Warning) String() string {
+	e := DecodeError{Chunk: w.Chunk, Offset: w.Offset, Err: w.Err}
+	return "png: warning: " + strings.TrimPrefix(e.Error(), "png: ")
+}
+
+// anomaly returns err if the Strictness of the decoder rejects the anomaly
+// it tells of, and passes it to the Warnings hook otherwise.
+func (d *decoder) anomaly(reject bool, err error) error {
+	if reject {
+		return err
+	}
+	if d.dec.Warnings != nil {
+		d.dec.Warnings(Warning{Chunk: d.chunk, Offset: d.chunkOffset, Err: err})
+	}
+	return nil
+}
+
+// singleChunks are the ancillary chunks the PNG specification allows only
+// once in an image, besides tRNS.
+var singleChunks = [...]string{
+	"cHRM", "gAMA", "iCCP", "sBIT", "sRGB", "bKGD", "hIST", "pHYs", "tIME", "eXIf",
+}
+
+// ancillary checks a chunk the decoder skips, for being critical or
+// repeated.
+func (d *decoder) ancillary(name string) error {
+	if 'A' <= name[0] && name[0] <= 'Z' {
+		return d.anomaly(d.dec.Strictness == Strict, UnsupportedError("unknown critical chunk "+name))
+	}
+	for i, s := range singleChunks {
+		if s != name {
+			continue
+		}
+		if d.once&(1<<uint(i)) != 0 {
+			return d.anomaly(d.dec.Strictness == Strict, FormatError("repeated "+name+" chunk"))
+		}
+		d.once |= 1 << uint(i)
+	}
+	return nil
+}
+
+// trailingIDAT checks an IDAT chunk of the given length following the one
+// the image data ends in.
+func (d *decoder) trailingIDAT(length int) error {
+	if length == 0 {
+		return nil
+	}
+	return d.anomaly(d.dec.Strictness == Strict, FormatError("IDAT chunk after the image data"))
+}
+
+// tooMuchData checks data left after the end of the image data in its last
+// IDAT chunk.
+func (d *decoder) tooMuchData() error {
+	return d.anomaly(d.dec.Strictness != Permissive, FormatError("too much pixel data"))
+}
+
+// checkPalette checks that the pixels of m are all in the palette, if that
+// is of interest.
+func (d *decoder) checkPalette(m *img1b.Image) error {
+	if d.plte != 1 || (d.dec.Strictness != Strict && d.dec.Warnings == nil) {
+		return nil
+	}
+	// The row padding is clear, so a row is in the palette if it is all 0.
+	n := (m.Rect.Dx() + 7) / 8
+	for y := 0; y < m.Rect.Dy(); y++ {
+		if !bitmap.All(m.Pix[y*m.Stride:y*m.Stride+n], 0) {
+			return d.anomaly(d.dec.Strictness == Strict, FormatError("pixel out of palette"))
+		}
+	}
+	return nil
+}
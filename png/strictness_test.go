@@ -0,0 +1,144 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// Test chunks of 1×1 images.
+const (
+	ihdrG = "\x00\x00\x00\x0dIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x01\x00\x00\x00\x00\x37\x6e\xf9\x24"
+	ihdrP = "\x00\x00\x00\x0dIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x01\x03\x00\x00\x00\x25\xdb\x56\xca"
+	plte  = "\x00\x00\x00\x03PLTE\xff\x00\x00\x19\xe2\x09\x37"
+	trns  = "\x00\x00\x00\x01tRNS\x7f\x80\x5c\xb4\xcb"
+	// A white pixel, and a black one.
+	idatWhite = "\x00\x00\x00\x0eIDAT\x78\x9c\x62\xfa\x0f\x08\x00\x00\xff\xff\x01\x05\x01\x02\x5a\xdd\x39\xcd"
+	idatBlack = "\x00\x00\x00\x0eIDAT\x78\x9c\x62\x62\x00\x04\x00\x00\xff\xff\x00\x06\x00\x03\xfa\xd0\x59\xae"
+	idatZero  = "\x00\x00\x00\x00IDAT\x35\xaf\x06\x1e"
+	// Pixel index 0, and index 1.
+	idat0 = "\x00\x00\x00\x0aIDAT\x78\x5e\x63\x62\x00\x00\x00\x06\x00\x03\xa0\x06\x57\x66"
+	idat1 = "\x00\x00\x00\x0aIDAT\x78\x5e\x63\x6a\x00\x00\x00\x86\x00\x83\x9f\x64\x81\xa1"
+	iend  = "\x00\x00\x00\x00IEND\xae\x42\x60\x82"
+)
+
+func chunk(typ, p string) string {
+	var b bytes.Buffer
+	corpusChunk(&b, typ, []byte(p))
+	return b.String()
+}
+
+func TestStrictness(t *testing.T) {
+	gama := chunk("gAMA", "\x00\x00\xb1\x8f")
+	// The zlib stream of idatWhite with a byte after it.
+	idatLong := chunk("IDAT", "\x78\x9c\x62\xfa\x0f\x08\x00\x00\xff\xff\x01\x05\x01\x02\x00")
+
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	red := color.RGBA{0xff, 0x00, 0x00, 0xff}
+	redAlpha := color.NRGBA{0xff, 0x00, 0x00, 0x7f}
+	black := color.RGBA{0x00, 0x00, 0x00, 0xff}
+	tests := []struct {
+		name string
+		data string
+		// want is the color of the pixel in Normal, Strict and Permissive
+		// mode; nil for an error.
+		want [3]color.Color
+	}{
+		{"valid", ihdrG + idatWhite + iend, [3]color.Color{white, white, white}},
+		{"empty trailing IDAT", ihdrG + idatWhite + idatZero + iend, [3]color.Color{white, white, white}},
+		{"trailing IDAT", ihdrG + idatWhite + idatBlack + iend, [3]color.Color{white, nil, white}},
+		{"trailing IDAT later", ihdrG + idatWhite + gama + idatBlack + iend, [3]color.Color{white, nil, white}},
+		{"too much pixel data", ihdrG + idatLong + iend, [3]color.Color{nil, nil, white}},
+		{"in palette", ihdrP + plte + idat0 + iend, [3]color.Color{red, red, red}},
+		{"out of palette", ihdrP + plte + idat1 + iend, [3]color.Color{black, nil, black}},
+		{"tRNS", ihdrP + plte + trns + idat0 + iend, [3]color.Color{redAlpha, redAlpha, redAlpha}},
+		{"repeated tRNS", ihdrP + plte + trns + trns + idat0 + iend, [3]color.Color{nil, nil, redAlpha}},
+		{"repeated gAMA", ihdrG + gama + gama + idatWhite + iend, [3]color.Color{white, nil, white}},
+		{"unknown critical chunk", ihdrG + chunk("CRIT", "") + idatWhite + iend, [3]color.Color{white, nil, white}},
+	}
+	for _, tc := range tests {
+		data := []byte(pngHeader + tc.data)
+		for i, s := range []Strictness{Normal, Strict, Permissive} {
+			d := &Decoder{Strictness: s}
+			want := tc.want[i]
+			for _, bytesPath := range []bool{false, true} {
+				var m *img1b.Image
+				var err error
+				if bytesPath {
+					m, err = d.DecodeBytes(data)
+				} else {
+					m, err = d.Decode(bytes.NewReader(data))
+				}
+				if want == nil {
+					if err == nil {
+						t.Errorf("%s, mode %d, bytes %t: got nil error", tc.name, s, bytesPath)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s, mode %d, bytes %t: %v", tc.name, s, bytesPath, err)
+					continue
+				}
+				if got := m.At(0, 0); got != want {
+					t.Errorf("%s, mode %d, bytes %t: got %v, want %v", tc.name, s, bytesPath, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	gama := chunk("gAMA", "\x00\x00\xb1\x8f")
+	crit := chunk("CRIT", "")
+	tests := []struct {
+		name string
+		data string
+		s    Strictness
+		want []string
+	}{
+		{"valid", ihdrG + idatWhite + iend, Normal, nil},
+		{"trailing IDAT", ihdrG + idatWhite + idatZero + idatBlack + iend, Normal, []string{
+			"png: warning: invalid format: IDAT chunk after the image data (IDAT chunk at offset 71)",
+		}},
+		{"out of palette", ihdrP + plte + idat1 + iend, Normal, []string{
+			"png: warning: invalid format: pixel out of palette (IDAT chunk at offset 48)",
+		}},
+		{"repeated chunks", ihdrG + gama + gama + crit + idatWhite + iend, Normal, []string{
+			"png: warning: invalid format: repeated gAMA chunk (gAMA chunk at offset 49)",
+			"png: warning: unsupported feature: unknown critical chunk CRIT (CRIT chunk at offset 65)",
+		}},
+		{"repeated tRNS", ihdrP + plte + trns + trns + idat0 + iend, Permissive, []string{
+			"png: warning: invalid format: repeated tRNS chunk (tRNS chunk at offset 61)",
+		}},
+		{"too much pixel data", ihdrG + chunk("IDAT", "\x78\x9c\x62\xfa\x0f\x08\x00\x00\xff\xff\x01\x05\x01\x02\x00") + iend, Permissive, []string{
+			"png: warning: invalid format: too much pixel data (IDAT chunk at offset 33)",
+		}},
+	}
+	for _, tc := range tests {
+		data := []byte(pngHeader + tc.data)
+		var got []string
+		d := &Decoder{Strictness: tc.s, Warnings: func(w Warning) { got = append(got, w.String()) }}
+		for _, bytesPath := range []bool{false, true} {
+			got = nil
+			var err error
+			if bytesPath {
+				_, err = d.DecodeBytes(data)
+			} else {
+				_, err = d.Decode(bytes.NewReader(data))
+			}
+			if err != nil {
+				t.Errorf("%s, bytes %t: %v", tc.name, bytesPath, err)
+				continue
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("%s, bytes %t: got %q, want %q", tc.name, bytesPath, got, tc.want)
+			}
+		}
+	}
+}
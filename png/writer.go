@@ -7,13 +7,19 @@ package png
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"compress/zlib"
 	"encoding/binary"
 	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/deflate"
+	"hash/adler32"
 	"hash/crc32"
+	"image"
 	"image/color"
 	"io"
 	"strconv"
+	"sync"
 )
 
 // Encoder configures encoding PNG images.
@@ -21,8 +27,30 @@ type Encoder struct {
 	CompressionLevel CompressionLevel
 
 	// BufferPool optionally specifies a buffer pool to get temporary
-	// EncoderBuffers when encoding an image.
+	// EncoderBuffers when encoding an image. Once the pool holds a buffer
+	// that has encoded an image of the same width and compression level,
+	// Encode makes no heap allocations, unless Concurrency is 2 or more.
 	BufferPool EncoderBufferPool
+
+	// Concurrency is the number of goroutines compressing bands of rows
+	// into independent deflate streams. Values below 2 compress the image
+	// as a single stream. The bands have a fixed height, so the output
+	// does not depend on the number of goroutines.
+	Concurrency int
+
+	// Report, if not nil, is called at the end of every encoding, failed
+	// ones included, with its Stats.
+	Report func(s Stats)
+
+	// Deterministic makes the output depend on the image only, byte for
+	// byte, whatever the version of Go: the image data are compressed by a
+	// deflate implementation of the package, which does not change, rather
+	// than by compress/flate, which may. CompressionLevel and Concurrency
+	// are ignored, and the files are somewhat larger than with
+	// BestCompression. The rows are always filtered with None and the
+	// chunks are the same as without Deterministic. NewRowWriter does not
+	// support it.
+	Deterministic bool
 }
 
 // EncoderBufferPool is an interface for getting and returning temporary
@@ -36,6 +64,26 @@ type EncoderBufferPool interface {
 // EncoderBuffer holds the buffers used for encoding PNG images.
 type EncoderBuffer encoder
 
+// syncPool is an EncoderBufferPool backed by a sync.Pool.
+type syncPool struct {
+	p sync.Pool
+}
+
+// NewEncoderBufferPool returns an EncoderBufferPool safe for concurrent
+// use, which lets the garbage collector drop buffers left unused.
+func NewEncoderBufferPool() EncoderBufferPool {
+	return &syncPool{}
+}
+
+func (p *syncPool) Get() *EncoderBuffer {
+	b, _ := p.p.Get().(*EncoderBuffer)
+	return b
+}
+
+func (p *syncPool) Put(b *EncoderBuffer) {
+	p.p.Put(b)
+}
+
 type encoder struct {
 	enc     *Encoder
 	w       io.Writer
@@ -49,6 +97,27 @@ type encoder struct {
 	zw      *zlib.Writer
 	zwLevel int
 	bw      *bufio.Writer
+	// raw and z hold the image data of a deterministic encoding, before
+	// and after compression.
+	raw, z []byte
+	stats  Stats
+	timer  timer
+}
+
+// begin starts the stats of an encoding, the PNG signature written.
+func (e *encoder) begin() {
+	e.stats = Stats{Bytes: int64(len(pngHeader))}
+	e.timer.begin()
+}
+
+// report passes the stats of the encoding to the Report hook.
+func (e *encoder) report() {
+	if e.enc.Report == nil {
+		return
+	}
+	e.timer.end(&e.stats)
+	e.stats.Err = e.err
+	e.enc.Report(e.stats)
 }
 
 type CompressionLevel int
@@ -77,10 +146,9 @@ func (e *encoder) writeChunk(b []byte, name string) {
 	e.header[5] = name[1]
 	e.header[6] = name[2]
 	e.header[7] = name[3]
-	crc := crc32.NewIEEE()
-	crc.Write(e.header[4:8])
-	crc.Write(b)
-	binary.BigEndian.PutUint32(e.footer[:4], crc.Sum32())
+	crc := crc32.Update(0, crc32.IEEETable, e.header[4:8])
+	crc = crc32.Update(crc, crc32.IEEETable, b)
+	binary.BigEndian.PutUint32(e.footer[:4], crc)
 
 	_, e.err = e.w.Write(e.header[:8])
 	if e.err != nil {
@@ -91,10 +159,13 @@ func (e *encoder) writeChunk(b []byte, name string) {
 		return
 	}
 	_, e.err = e.w.Write(e.footer[:4])
+	if e.err == nil {
+		e.stats.Chunks++
+		e.stats.Bytes += int64(12 + len(b))
+	}
 }
 
-func (e *encoder) writeIHDR() {
-	b := e.m.Bounds()
+func (e *encoder) writeIHDR(b image.Rectangle) {
 	binary.BigEndian.PutUint32(e.tmp[0:4], uint32(b.Dx()))
 	binary.BigEndian.PutUint32(e.tmp[4:8], uint32(b.Dy()))
 	// Set bit depth and color type.
@@ -119,7 +190,7 @@ func (e *encoder) writePLTEAndTRNS(p color.Palette) {
 	}
 	last := -1
 	for i, c := range p {
-		c1 := color.NRGBAModel.Convert(c).(color.NRGBA)
+		c1 := nrgba(c)
 		e.tmp[3*i+0] = c1.R
 		e.tmp[3*i+1] = c1.G
 		e.tmp[3*i+2] = c1.B
@@ -170,27 +241,169 @@ func (e *encoder) writeImage(w io.Writer, m *img1b.Image, cb int, level int) err
 	}
 	cr := e.cr
 
+	for y := 0; y < b.Dy(); y++ {
+		rowBytes(cr, m, y)
+
+		// Write the compressed bytes.
+		if _, err := e.zw.Write(cr); err != nil {
+			return err
+		}
+		e.stats.Rows++
+	}
+	return nil
+}
+
+// rowBytes fills cr with the filter type byte and the bits of row y of m.
+func rowBytes(cr []byte, m *img1b.Image, y int) {
+	packRow(cr, m.Pix[y*m.Stride:], m.Rect.Dx())
+}
+
+// packRow fills cr with the filter type byte and the bits of a row of w
+// pixels.
+func packRow(cr []byte, row []byte, w int) {
+	sz := len(cr)
 	// Mask to blank out of bounds bits.
-	tm := byte(uint16(0xff00) >> ((b.Dx()-1)%8 + 1))
+	tm := byte(uint16(0xff00) >> ((w-1)%8 + 1))
 	lb := tm &^ (tm << 1)
 
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		offset := (y - b.Min.Y) * m.Stride
-		copy(cr[1:], m.Pix[offset:offset+(b.Dx()+7)/8])
-		// Extend the row last pixel till the end of the byte.
-		// It seems to result in slightly better compression than just zeroing.
-		if cr[sz-1]&lb == 0 {
-			cr[sz-1] &= tm
-		} else {
-			cr[sz-1] |= ^tm
+	cr[0] = ftNone
+	copy(cr[1:], row[:(w+7)/8])
+	// Extend the row last pixel till the end of the byte.
+	// It seems to result in slightly better compression than just zeroing.
+	if cr[sz-1]&lb == 0 {
+		cr[sz-1] &= tm
+	} else {
+		cr[sz-1] |= ^tm
+	}
+}
+
+// bandSize is the approximate number of uncompressed bytes in a band of
+// rows compressed on its own.
+const bandSize = 256 << 10
+
+// A band is a band of rows and its deflate stream.
+type band struct {
+	raw, z []byte
+	err    error
+	done   chan struct{}
+}
+
+// writeImageBands writes m to w as a zlib stream whose data are the deflate
+// streams of the bands, compressed by n goroutines. Every band but the last
+// ends with a sync flush, leaving it byte aligned and not final, so the
+// streams join into one.
+func (e *encoder) writeImageBands(w io.Writer, m *img1b.Image, level, n int) error {
+	sz := 1 + (m.Rect.Dx()+7)/8
+	h := m.Rect.Dy()
+	rows := bandSize / sz
+	if rows < 1 {
+		rows = 1
+	}
+	nb := (h + rows - 1) / rows
+
+	bands := make([]*band, nb)
+	for i := range bands {
+		bands[i] = &band{done: make(chan struct{})}
+	}
+	if _, err := w.Write(zlibHeader(level)); err != nil {
+		return err
+	}
+	// At most n bands are held at a time, the writing loop below freeing
+	// a slot after each. Closing stop on an error ends the feeding; the
+	// bands already started finish on their own.
+	sem := make(chan struct{}, n)
+	stop := make(chan struct{})
+	go func() {
+		for i, b := range bands {
+			select {
+			case sem <- struct{}{}:
+			case <-stop:
+				return
+			}
+			go compressBand(b, m, i*rows, min(h, (i+1)*rows), sz, level, i == nb-1)
 		}
+	}()
 
-		// Write the compressed bytes.
-		if _, err := e.zw.Write(cr); err != nil {
+	sum := adler32.New()
+	for _, b := range bands {
+		<-b.done
+		err := b.err
+		if err == nil {
+			sum.Write(b.raw)
+			_, err = w.Write(b.z)
+		}
+		b.raw, b.z = nil, nil
+		if err != nil {
+			close(stop)
 			return err
 		}
+		<-sem
 	}
-	return nil
+	e.stats.Rows += h
+	_, err := w.Write(sum.Sum(nil))
+	return err
+}
+
+// compressBand compresses rows [y0, y1) of m into b, closing the stream if
+// it is the last.
+func compressBand(b *band, m *img1b.Image, y0, y1, sz, level int, last bool) {
+	defer close(b.done)
+	b.raw = make([]byte, (y1-y0)*sz)
+	for y := y0; y < y1; y++ {
+		rowBytes(b.raw[(y-y0)*sz:(y-y0+1)*sz], m, y)
+	}
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if _, err := fw.Write(b.raw); err != nil {
+		b.err = err
+		return
+	}
+	if last {
+		b.err = fw.Close()
+	} else {
+		b.err = fw.Flush()
+	}
+	b.z = buf.Bytes()
+}
+
+// writeImageDeterministic writes m to w as a zlib stream made by the
+// deflate of the package, for Encoder.Deterministic.
+func (e *encoder) writeImageDeterministic(w io.Writer, m *img1b.Image) error {
+	sz := 1 + (m.Rect.Dx()+7)/8
+	h := m.Rect.Dy()
+	if cap(e.raw) < sz*h {
+		e.raw = make([]byte, sz*h)
+	}
+	raw := e.raw[:sz*h]
+	for y := 0; y < h; y++ {
+		rowBytes(raw[y*sz:(y+1)*sz], m, y)
+	}
+	e.z = deflate.AppendZlib(e.z[:0], raw)
+	e.stats.Rows += h
+	_, err := w.Write(e.z)
+	return err
+}
+
+// zlibHeader returns the zlib stream header for a compression level, as
+// compress/zlib writes it.
+func zlibHeader(level int) []byte {
+	h := []byte{0x78, 0}
+	switch level {
+	case -2, 0, 1:
+		h[1] = 0 << 6
+	case 2, 3, 4, 5:
+		h[1] = 1 << 6
+	case 6, -1:
+		h[1] = 2 << 6
+	case 7, 8, 9:
+		h[1] = 3 << 6
+	}
+	h[1] += uint8(31 - (uint16(h[0])<<8+uint16(h[1]))%31)
+	return h
 }
 
 // Write the actual image data to one or more IDAT chunks.
@@ -198,12 +411,20 @@ func (e *encoder) writeIDATs() {
 	if e.err != nil {
 		return
 	}
+	e.timer.beginData()
 	if e.bw == nil {
 		e.bw = bufio.NewWriterSize(e, 1<<15)
 	} else {
 		e.bw.Reset(e)
 	}
-	e.err = e.writeImage(e.bw, e.m, e.cb, levelToZlib(e.enc.CompressionLevel))
+	switch {
+	case e.enc.Deterministic:
+		e.err = e.writeImageDeterministic(e.bw, e.m)
+	case e.enc.Concurrency > 1:
+		e.err = e.writeImageBands(e.bw, e.m, levelToZlib(e.enc.CompressionLevel), e.enc.Concurrency)
+	default:
+		e.err = e.writeImage(e.bw, e.m, e.cb, levelToZlib(e.enc.CompressionLevel))
+	}
 	if e.err != nil {
 		return
 	}
@@ -229,10 +450,34 @@ func levelToZlib(l CompressionLevel) int {
 
 func (e *encoder) writeIEND() { e.writeChunk(nil, "IEND") }
 
+// nrgba converts c as color.NRGBAModel does, without boxing the result in
+// an interface.
+func nrgba(c color.Color) color.NRGBA {
+	if c, ok := c.(color.NRGBA); ok {
+		return c
+	}
+	r, g, b, a := c.RGBA()
+	switch a {
+	case 0xffff:
+		return color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}
+	case 0:
+		return color.NRGBA{}
+	}
+	r = (r * 0xffff) / a
+	g = (g * 0xffff) / a
+	b = (b * 0xffff) / a
+	return color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
 func isBlackWhite(pal color.Palette) bool {
-	return len(pal) > 1 &&
-		color.RGBAModel.Convert(pal[0]) == color.RGBAModel.Convert(color.Black) &&
-		color.RGBAModel.Convert(pal[1]) == color.RGBAModel.Convert(color.White)
+	if len(pal) < 2 {
+		return false
+	}
+	r0, g0, b0, a0 := pal[0].RGBA()
+	r1, g1, b1, a1 := pal[1].RGBA()
+	// Compared at 8 bits, as color.RGBAModel would.
+	return (r0|g0|b0)>>8 == 0 && a0>>8 == 0xff &&
+		(r1&g1&b1&a1)>>8 == 0xff
 }
 
 // Encode writes the Image m to w in PNG format.
@@ -275,12 +520,106 @@ func (enc *Encoder) Encode(w io.Writer, m *img1b.Image) error {
 		pal = nil
 	}
 
+	e.begin()
 	_, e.err = io.WriteString(w, pngHeader)
-	e.writeIHDR()
+	e.writeIHDR(m.Bounds())
 	if pal != nil {
 		e.writePLTEAndTRNS(pal)
 	}
 	e.writeIDATs()
 	e.writeIEND()
+	e.report()
+	return e.err
+}
+
+// A RowWriter writes a PNG image row by row, so that the whole image need
+// not be held in memory. It is made by Encoder.NewRowWriter.
+type RowWriter struct {
+	e             encoder
+	width, height int
+	y             int
+	cr            []byte
+	closed        bool
+}
+
+// NewRowWriter writes the header of a PNG image of the given size and
+// palette to w and returns a RowWriter for its rows. The rows are compressed
+// as one stream, whatever the Concurrency of enc.
+func (enc *Encoder) NewRowWriter(w io.Writer, width, height int, pal color.Palette) (*RowWriter, error) {
+	if width <= 0 || height <= 0 || int64(width) >= 1<<32 || int64(height) >= 1<<32 {
+		return nil, FormatError("invalid image size: " + strconv.Itoa(width) + "x" + strconv.Itoa(height))
+	}
+	if enc.Deterministic {
+		return nil, UnsupportedError("deterministic encoding of rows")
+	}
+	rw := &RowWriter{width: width, height: height, cr: make([]byte, 1+(width+7)/8)}
+	e := &rw.e
+	e.enc = enc
+	e.w = w
+	e.cb = cbP1
+	if isBlackWhite(pal) {
+		e.cb = cbG1
+		pal = nil
+	}
+	e.begin()
+	_, e.err = io.WriteString(w, pngHeader)
+	e.writeIHDR(image.Rect(0, 0, width, height))
+	if pal != nil {
+		e.writePLTEAndTRNS(pal)
+	}
+	if e.err != nil {
+		e.report()
+		return nil, e.err
+	}
+	e.timer.beginData()
+	e.bw = bufio.NewWriterSize(e, 1<<15)
+	e.zw, e.err = zlib.NewWriterLevel(e.bw, levelToZlib(enc.CompressionLevel))
+	if e.err != nil {
+		return nil, e.err
+	}
+	return rw, nil
+}
+
+// WriteRow writes the next row, its pixels packed as in img1b.Image.Pix.
+func (rw *RowWriter) WriteRow(row []byte) error {
+	e := &rw.e
+	if e.err != nil {
+		return e.err
+	}
+	if rw.y == rw.height {
+		return FormatError("too many rows")
+	}
+	if len(row) < (rw.width+7)/8 {
+		return FormatError("short row")
+	}
+	packRow(rw.cr, row, rw.width)
+	if _, err := e.zw.Write(rw.cr); err != nil {
+		e.err = err
+		return err
+	}
+	e.stats.Rows++
+	rw.y++
+	return nil
+}
+
+// Close finishes the image. All its rows must have been written.
+func (rw *RowWriter) Close() error {
+	e := &rw.e
+	if rw.closed {
+		return e.err
+	}
+	rw.closed = true
+	switch {
+	case e.err != nil:
+	case rw.y != rw.height:
+		e.err = FormatError("wrote " + strconv.Itoa(rw.y) + " rows of " + strconv.Itoa(rw.height))
+	default:
+		if e.err = e.zw.Close(); e.err == nil {
+			if e.err = e.bw.Flush(); e.err == nil {
+				e.writeIEND()
+			}
+		}
+	}
+	e.report()
 	return e.err
 }
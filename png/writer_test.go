@@ -7,13 +7,20 @@ package png
 
 import (
 	"bytes"
+	"compress/zlib"
+	"errors"
 	"fmt"
 	"github.com/mi-v/img1b"
+	"hash/crc32"
 	"image"
 	"image/color"
 	gopng "image/png"
 	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func diff(m0, m1 *img1b.Image) error {
@@ -101,6 +108,123 @@ func TestWriterLevels(t *testing.T) {
 	}
 }
 
+func TestWriterConcurrency(t *testing.T) {
+	p := color.Palette{color.Black, color.White}
+	// Tall enough for several bands.
+	m := img1b.New(image.Rect(0, 0, 3001, 2000), p)
+	for y := 0; y < 2000; y++ {
+		for x := 0; x < 3001; x++ {
+			m.SetColorIndex(x, y, uint8(x*x+y*y/7)>>6&1)
+		}
+	}
+	for _, level := range []CompressionLevel{DefaultCompression, NoCompression, BestSpeed} {
+		var first []byte
+		for _, n := range []int{2, 3, 16} {
+			var b bytes.Buffer
+			if err := (&Encoder{CompressionLevel: level, Concurrency: n}).Encode(&b, m); err != nil {
+				t.Fatal(err)
+			}
+			if first == nil {
+				first = b.Bytes()
+			} else if !bytes.Equal(b.Bytes(), first) {
+				t.Errorf("level %d: concurrency %d: output differs", level, n)
+			}
+			m1, err := Decode(bytes.NewReader(b.Bytes()))
+			if err != nil {
+				t.Fatalf("level %d: concurrency %d: %v", level, n, err)
+			}
+			if err := diff(m, m1); err != nil {
+				t.Errorf("level %d: concurrency %d: %v", level, n, err)
+			}
+			if _, err := gopng.Decode(bytes.NewReader(b.Bytes())); err != nil {
+				t.Errorf("level %d: concurrency %d: image/png: %v", level, n, err)
+			}
+		}
+	}
+}
+
+// A failingWriter fails once n bytes have been written.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("write failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriterConcurrencyError(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 3001, 2000), color.Palette{color.Black, color.White})
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	before := runtime.NumGoroutine()
+	for _, n := range []int{0, 100, 1 << 16, 1 << 19} {
+		if err := (&Encoder{Concurrency: 2}).Encode(&failingWriter{n}, m); err == nil {
+			t.Errorf("failing after %d bytes: no error", n)
+		}
+		// The encoder buffers the zlib header, so its write is made to
+		// fail directly.
+		var e encoder
+		if err := e.writeImageBands(&failingWriter{n}, m, zlib.DefaultCompression, 2); err == nil {
+			t.Errorf("bands failing after %d bytes: no error", n)
+		}
+	}
+	// The compressing goroutines started before the errors finish soon.
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines left, want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRowWriter(t *testing.T) {
+	for _, p := range []color.Palette{{color.Black, color.White}, {color.White, color.Black}} {
+		m := img1b.New(image.Rect(0, 0, 301, 123), p)
+		for y := 0; y < 123; y++ {
+			for x := 0; x < 301; x++ {
+				m.SetColorIndex(x, y, uint8(x*y/17)&1)
+			}
+		}
+		var want, got bytes.Buffer
+		if err := Encode(&want, m); err != nil {
+			t.Fatal(err)
+		}
+		rw, err := (&Encoder{}).NewRowWriter(&got, 301, 123, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 123; y++ {
+			if err := rw.WriteRow(m.Pix[y*m.Stride:]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("palette %v: output differs from Encode", p)
+		}
+	}
+
+	rw, err := (&Encoder{}).NewRowWriter(ioutil.Discard, 10, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.WriteRow([]byte{0}); err == nil {
+		t.Error("short row: no error")
+	}
+	rw.WriteRow([]byte{0, 0})
+	if err := rw.Close(); err == nil {
+		t.Error("missing row: no error")
+	}
+	if _, err := (&Encoder{}).NewRowWriter(ioutil.Discard, 0, 2, nil); err == nil {
+		t.Error("zero width: no error")
+	}
+}
+
 func TestSubImage(t *testing.T) {
 	p := color.Palette{color.Black, color.White}
 	m0 := img1b.New(image.Rect(0, 0, 256, 256), p)
@@ -163,6 +287,43 @@ func BenchmarkEncodeWithBufferPool(b *testing.B) {
 	}
 }
 
+func TestEncodeAllocs(t *testing.T) {
+	for _, pal := range []color.Palette{
+		{color.Black, color.White},
+		{color.White, color.Black},
+		{color.White, color.Transparent},
+	} {
+		img := img1b.New(image.Rect(0, 0, 640, 480), pal)
+		e := Encoder{BufferPool: &pool{}}
+		if err := e.Encode(ioutil.Discard, img); err != nil {
+			t.Fatal(err)
+		}
+		if n := testing.AllocsPerRun(10, func() { e.Encode(ioutil.Discard, img) }); n != 0 {
+			t.Errorf("palette %v: %v allocations per Encode", pal, n)
+		}
+	}
+}
+
+func BenchmarkEncodeReuse(b *testing.B) {
+	img := img1b.New(image.Rect(0, 0, 640, 480), color.Palette{
+		color.White,
+		color.Black,
+	})
+	e := Encoder{
+		BufferPool: NewEncoderBufferPool(),
+	}
+	e.Encode(ioutil.Discard, img)
+	if n := testing.AllocsPerRun(10, func() { e.Encode(ioutil.Discard, img) }); n != 0 {
+		b.Fatalf("%v allocations per Encode", n)
+	}
+	b.SetBytes(640 * 480 / 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Encode(ioutil.Discard, img)
+	}
+}
+
 func BenchmarkEncodeStock(b *testing.B) {
 	img := image.NewPaletted(image.Rect(0, 0, 640, 480), color.Palette{
 		color.Black,
@@ -175,3 +336,47 @@ func BenchmarkEncodeStock(b *testing.B) {
 		gopng.Encode(ioutil.Discard, img)
 	}
 }
+
+func TestEncodeDeterministic(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 203, 97), color.Palette{color.White, color.Black})
+	for y := 0; y < 97; y++ {
+		for x := 0; x < 203; x++ {
+			if (x/7+y/5)%3 == 0 || (x*x+y*3)%11 == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	var want []byte
+	for i, enc := range []Encoder{
+		{Deterministic: true},
+		{Deterministic: true, CompressionLevel: BestSpeed, Concurrency: 4},
+		{Deterministic: true, BufferPool: NewEncoderBufferPool()},
+	} {
+		var b bytes.Buffer
+		if err := enc.Encode(&b, m); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			want = b.Bytes()
+			continue
+		}
+		if !bytes.Equal(b.Bytes(), want) {
+			t.Errorf("encoder %d: output differs", i)
+		}
+	}
+	d, err := Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.Pix, m.Pix) {
+		t.Error("pixels differ")
+	}
+	// The output must not change from one version to the next.
+	if got := fmt.Sprintf("%d %08x", len(want), crc32.ChecksumIEEE(want)); got != "716 53c62eec" {
+		t.Errorf("output is %s", got)
+	}
+
+	if _, err := (&Encoder{Deterministic: true}).NewRowWriter(ioutil.Discard, 1, 1, nil); err == nil {
+		t.Error("NewRowWriter accepts Deterministic")
+	}
+}
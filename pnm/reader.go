@@ -0,0 +1,457 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pnm implements a decoder for the Netpbm family of image formats:
+// PBM (P1, P4), PGM (P2, P5), PPM (P3, P6) and PAM (P7), and an encoder for
+// raw PBM (P4). The format is detected from the magic number.
+//
+// Bitmaps are decoded directly. Grayscale and color images are only decoded
+// when a binarization threshold is set on the Decoder.
+//
+// Decoded images use the palette {white, black} so that set bits correspond
+// to black pixels, as in PBM.
+//
+// The format specification is at http://netpbm.sourceforge.net/doc/.
+package pnm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// A FormatError reports that the input is not a valid Netpbm image.
+type FormatError string
+
+func (e FormatError) Error() string { return "pnm: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "pnm: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of Netpbm images.
+type Decoder struct {
+	// Threshold enables decoding of grayscale and color images. Pixels with
+	// luminance (scaled to the range 0-0xffff) below Threshold become black.
+	// If Threshold is zero such images are rejected with an UnsupportedError.
+	Threshold uint16
+
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their header is read.
+	Limits *img1b.Limits
+}
+
+// Tuple types of the supported images.
+const (
+	ttBlackAndWhite = iota
+	ttGrayscale
+	ttRGB
+)
+
+type decoder struct {
+	r             *bufio.Reader
+	plain         bool
+	pam           bool
+	width, height int
+	maxval        int
+	depth         int
+	tupleType     int
+	threshold     uint16
+	limits        *img1b.Limits
+}
+
+// palette returns the palette of decoded images.
+func palette() color.Palette {
+	return color.Palette{color.White, color.Black}
+}
+
+// skipSpace skips whitespace and comments.
+func (d *decoder) skipSpace() error {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+			continue
+		case '#':
+			for c != '\n' && c != '\r' {
+				if c, err = d.r.ReadByte(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		return d.r.UnreadByte()
+	}
+}
+
+// readInt reads a non-negative decimal number preceded by optional whitespace
+// and comments.
+func (d *decoder) readInt() (int, error) {
+	if err := d.skipSpace(); err != nil {
+		return 0, err
+	}
+	n, digits := 0, 0
+	for {
+		c, err := d.r.ReadByte()
+		if err == io.EOF && digits > 0 {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c < '0' || c > '9' {
+			d.r.UnreadByte()
+			break
+		}
+		if n > (1<<31-1-9)/10 {
+			return 0, FormatError("number too large")
+		}
+		n = n*10 + int(c-'0')
+		digits++
+	}
+	if digits == 0 {
+		return 0, FormatError("number expected")
+	}
+	return n, nil
+}
+
+// readHeaderSpace consumes the single whitespace character that separates
+// the header from the binary raster.
+func (d *decoder) readHeaderSpace() error {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return nil
+	}
+	return FormatError("missing whitespace after header")
+}
+
+func (d *decoder) parseHeader() error {
+	var magic [2]byte
+	if _, err := io.ReadFull(d.r, magic[:]); err != nil {
+		return err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '7' {
+		return FormatError("not a Netpbm file")
+	}
+	if magic[1] == '7' {
+		return d.parsePAMHeader()
+	}
+	kind := magic[1] - '0'
+	d.plain = kind <= 3
+	d.depth = 1
+	switch kind {
+	case 1, 4:
+		d.tupleType = ttBlackAndWhite
+	case 2, 5:
+		d.tupleType = ttGrayscale
+	case 3, 6:
+		d.tupleType = ttRGB
+		d.depth = 3
+	}
+	var err error
+	if d.width, err = d.readInt(); err != nil {
+		return err
+	}
+	if d.height, err = d.readInt(); err != nil {
+		return err
+	}
+	d.maxval = 1
+	if d.tupleType != ttBlackAndWhite {
+		if d.maxval, err = d.readInt(); err != nil {
+			return err
+		}
+	}
+	if !d.plain {
+		if err := d.readHeaderSpace(); err != nil {
+			return err
+		}
+	}
+	return d.checkHeader()
+}
+
+func (d *decoder) parsePAMHeader() error {
+	if err := d.readHeaderSpace(); err != nil {
+		return err
+	}
+	d.pam = true
+	d.width, d.height, d.depth, d.maxval = -1, -1, -1, -1
+	tupleType := ""
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := splitFields(line)
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if fields[0] == "ENDHDR" {
+			break
+		}
+		if fields[0] == "TUPLTYPE" {
+			if len(fields) > 1 {
+				tupleType = fields[1]
+			}
+			continue
+		}
+		if len(fields) != 2 {
+			return FormatError("bad PAM header line")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return FormatError("bad PAM header value")
+		}
+		switch fields[0] {
+		case "WIDTH":
+			d.width = n
+		case "HEIGHT":
+			d.height = n
+		case "DEPTH":
+			d.depth = n
+		case "MAXVAL":
+			d.maxval = n
+		default:
+			return FormatError("unknown PAM header field " + fields[0])
+		}
+	}
+	if d.width < 0 || d.height < 0 || d.depth < 0 || d.maxval < 0 {
+		return FormatError("incomplete PAM header")
+	}
+	switch tupleType {
+	case "BLACKANDWHITE", "BLACKANDWHITE_ALPHA":
+		d.tupleType = ttBlackAndWhite
+		if d.maxval != 1 {
+			return FormatError("bad BLACKANDWHITE maxval")
+		}
+	case "GRAYSCALE", "GRAYSCALE_ALPHA":
+		d.tupleType = ttGrayscale
+	case "RGB", "RGB_ALPHA":
+		d.tupleType = ttRGB
+	default:
+		// Guess the tuple type from the depth.
+		switch d.depth {
+		case 1, 2:
+			d.tupleType = ttGrayscale
+		case 3, 4:
+			d.tupleType = ttRGB
+		default:
+			return UnsupportedError(fmt.Sprintf("PAM tuple type %q, depth %d", tupleType, d.depth))
+		}
+	}
+	min := 1
+	if d.tupleType == ttRGB {
+		min = 3
+	}
+	if d.depth < min {
+		return FormatError("PAM depth too small for tuple type")
+	}
+	return d.checkHeader()
+}
+
+func splitFields(s string) []string {
+	var fields []string
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r' {
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+func (d *decoder) checkHeader() error {
+	if d.width <= 0 || d.height <= 0 {
+		return FormatError("non-positive dimension")
+	}
+	if d.maxval < 1 || d.maxval > 0xffff {
+		return FormatError("bad maxval")
+	}
+	nPixels := int64(d.width) * int64(d.height)
+	if nPixels != int64(int(nPixels)) || nPixels*int64(d.depth) != int64(int(nPixels*int64(d.depth))) {
+		return UnsupportedError("dimension overflow")
+	}
+	return nil
+}
+
+// readSample reads one sample of a plain or binary raster.
+func (d *decoder) readSample() (int, error) {
+	if d.plain {
+		v, err := d.readInt()
+		if err == nil && v > d.maxval {
+			err = FormatError("sample exceeds maxval")
+		}
+		return v, err
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := int(c)
+	if d.maxval > 0xff {
+		c, err = d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<8 | int(c)
+	}
+	if v > d.maxval {
+		return 0, FormatError("sample exceeds maxval")
+	}
+	return v, nil
+}
+
+// readPlainBit reads a single '0' or '1' digit of a P1 raster.
+func (d *decoder) readPlainBit() (byte, error) {
+	if err := d.skipSpace(); err != nil {
+		return 0, err
+	}
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c != '0' && c != '1' {
+		return 0, FormatError("bad PBM pixel")
+	}
+	return c - '0', nil
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	if d.tupleType != ttBlackAndWhite && d.threshold == 0 {
+		return nil, UnsupportedError("grayscale or color image without threshold")
+	}
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), palette())
+	if err != nil {
+		return nil, err
+	}
+	rowBytes := (d.width + 7) / 8
+	tm := bitmap.TailMask(d.width)
+
+	if d.tupleType == ttBlackAndWhite && !d.plain && !d.pam {
+		// P4 rows are laid out exactly as img1b rows.
+		for y := 0; y < d.height; y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+			if _, err := io.ReadFull(d.r, row); err != nil {
+				return nil, err
+			}
+			row[rowBytes-1] &= tm
+		}
+		return img, nil
+	}
+
+	samples := make([]int, d.depth)
+	for y := 0; y < d.height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+		for x := 0; x < d.width; x++ {
+			var black bool
+			if d.tupleType == ttBlackAndWhite && d.plain {
+				b, err := d.readPlainBit()
+				if err != nil {
+					return nil, err
+				}
+				black = b == 1
+			} else {
+				for i := range samples {
+					v, err := d.readSample()
+					if err != nil {
+						return nil, err
+					}
+					samples[i] = v
+				}
+				black = d.isBlack(samples)
+			}
+			if black {
+				row[x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return img, nil
+}
+
+// isBlack reports whether the pixel made of the samples is black.
+func (d *decoder) isBlack(s []int) bool {
+	switch d.tupleType {
+	case ttBlackAndWhite:
+		// PAM bitmaps store one sample per byte and use 0 for black.
+		return s[0] == 0
+	case ttGrayscale:
+		return d.scale(s[0]) < uint32(d.threshold)
+	}
+	r, g, b := d.scale(s[0]), d.scale(s[1]), d.scale(s[2])
+	// Same coefficients as in color.GrayModel.
+	y := (19595*r + 38470*g + 7471*b + 1<<15) >> 16
+	return y < uint32(d.threshold)
+}
+
+// scale converts a sample to the range 0-0xffff.
+func (d *decoder) scale(v int) uint32 {
+	return uint32(v * 0xffff / d.maxval)
+}
+
+// Decode reads a Netpbm image from r and returns it as an img1b.Image.
+// Grayscale and color images are rejected, see Decoder.Threshold.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads a Netpbm image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d := &decoder{
+		r:         bufio.NewReader(r),
+		threshold: dec.Threshold,
+		limits:    dec.Limits,
+	}
+	if err := d.parseHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	img, err := d.decode()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a Netpbm image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{
+		r: bufio.NewReader(r),
+	}
+	if err := d.parseHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: palette(),
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
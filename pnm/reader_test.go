@@ -0,0 +1,131 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"github.com/mi-v/img1b"
+	"strings"
+	"testing"
+)
+
+// pattern is a 10x3 image, '#' is black.
+var pattern = []string{
+	"#.#.#.#.##",
+	"..........",
+	"##########",
+}
+
+func check(t *testing.T, name string, m *img1b.Image) {
+	b := m.Bounds()
+	if b.Dx() != len(pattern[0]) || b.Dy() != len(pattern) {
+		t.Errorf("%s: bounds %v", name, b)
+		return
+	}
+	for y, row := range pattern {
+		for x := range row {
+			want := uint8(0)
+			if row[x] == '#' {
+				want = 1
+			}
+			if got := m.ColorIndexAt(x, y); got != want {
+				t.Errorf("%s: at (%d, %d) got %d, want %d", name, x, y, got, want)
+				return
+			}
+		}
+	}
+}
+
+var decodeTests = []struct {
+	name      string
+	data      string
+	threshold uint16
+}{
+	{"P1", "P1\n# comment\n10 3\n1 0 1 0 1 0 1 0 1 1\n0000000000\n1111111111\n", 0},
+	{"P4", "P4 10 3\n\xaa\xc0\x00\x00\xff\xc0", 0},
+	{"P4 padding", "P4 10 3\n\xaa\xff\x00\x3f\xff\xc0", 0},
+	{"P2", "P2 10 3 255\n0 255 0 255 0 255 0 255 0 0\n200 200 200 200 200 200 200 200 200 200\n10 10 10 10 10 10 10 10 10 10\n", 0x8000},
+	{"P5", "P5 10 3 255\n\x00\xff\x00\xff\x00\xff\x00\xff\x00\x00\xc8\xc8\xc8\xc8\xc8\xc8\xc8\xc8\xc8\xc8\x0a\x0a\x0a\x0a\x0a\x0a\x0a\x0a\x0a\x0a", 0x8000},
+	{"P3", "P3 10 3 1\n0 0 0 1 1 1 0 0 0 1 1 1 0 0 0 1 1 1 0 0 0 1 1 1 0 0 0 0 0 0\n" +
+		strings.Repeat("1 1 1 ", 10) + "\n" + strings.Repeat("0 0 0 ", 10) + "\n", 0x8000},
+	{"P7", "P7\nWIDTH 10\nHEIGHT 3\nDEPTH 1\nMAXVAL 1\nTUPLTYPE BLACKANDWHITE\nENDHDR\n" +
+		"\x00\x01\x00\x01\x00\x01\x00\x01\x00\x00" + strings.Repeat("\x01", 10) + strings.Repeat("\x00", 10), 0},
+	{"P7 gray16", "P7\nWIDTH 10\nHEIGHT 3\nDEPTH 2\nMAXVAL 65535\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n" +
+		strings.Repeat("\x00\x00\xff\xff\xff\xff\xff\xff", 4) + strings.Repeat("\x00\x00\xff\xff", 2) +
+		strings.Repeat("\xff\xff\xff\xff", 10) + strings.Repeat("\x00\x00\xff\xff", 10), 0x8000},
+}
+
+func TestDecode(t *testing.T) {
+	for _, tt := range decodeTests {
+		d := Decoder{Threshold: tt.threshold}
+		m, err := d.Decode(strings.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		check(t, tt.name, m)
+		if m.Pix[1]&0x3f != 0 {
+			t.Errorf("%s: padding bits are not clear", tt.name)
+		}
+	}
+}
+
+func TestDecodeGrayWithoutThreshold(t *testing.T) {
+	_, err := Decode(strings.NewReader(decodeTests[3].data))
+	if _, ok := err.(UnsupportedError); !ok {
+		t.Errorf("got %v, want UnsupportedError", err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 100}}
+	if _, err := d.Decode(strings.NewReader("P4 10 10\n" + strings.Repeat("\x00", 20))); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	// The data are not there, the header is enough.
+	_, err := d.Decode(strings.NewReader("P4 100000 100000\n"))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
+
+var decodeErrors = []struct {
+	data string
+	err  string
+}{
+	{"", "unexpected EOF"},
+	{"P8 1 1\n", "not a Netpbm file"},
+	{"P4 0 1\n", "non-positive dimension"},
+	{"P4 2 2\n\x00", "unexpected EOF"},
+	{"P1 2 1\n0 2", "bad PBM pixel"},
+	{"P2 1 1 10\n11", "sample exceeds maxval"},
+	{"P7\nWIDTH 1\nHEIGHT 1\nENDHDR\n", "incomplete PAM header"},
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tt := range decodeErrors {
+		d := Decoder{Threshold: 0x8000}
+		m, err := d.Decode(strings.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("decoding %q: missing error", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("decoding %q: %s, want %s", tt.data, err, tt.err)
+		}
+		if m != nil {
+			t.Errorf("decoding %q: have image + error", tt.data)
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	cfg, err := DecodeConfig(strings.NewReader(decodeTests[3].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 10 || cfg.Height != 3 {
+		t.Errorf("got %dx%d, want 10x3", cfg.Width, cfg.Height)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// Encode writes the Image m to w as a raw PBM (P4) bitmap. The darker
+// palette color is written as black.
+func Encode(w io.Writer, m *img1b.Image) error {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "P4\n%d %d\n", b.Dx(), b.Dy())
+	var xor byte
+	if bitmap.BlackIndex(m.Palette) == 0 {
+		xor = 0xff
+	}
+	rowBytes := (b.Dx() + 7) / 8
+	row := make([]byte, rowBytes)
+	tm := bitmap.TailMask(b.Dx())
+	for y := 0; y < b.Dy(); y++ {
+		copy(row, m.Pix[y*m.Stride:y*m.Stride+rowBytes])
+		for i := range row {
+			row[i] ^= xor
+		}
+		row[rowBytes-1] &= tm
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pnm
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	// Black at either index, with dirty padding.
+	for _, tt := range []struct {
+		pal   color.Palette
+		black uint8
+	}{
+		{color.Palette{color.White, color.Black}, 1},
+		{color.Palette{color.Black, color.White}, 0},
+	} {
+		m := img1b.New(image.Rect(0, 0, 10, 3), tt.pal)
+		black := tt.black
+		for y, row := range pattern {
+			for x := range row {
+				if row[x] == '#' {
+					m.SetColorIndex(x, y, black)
+				} else {
+					m.SetColorIndex(x, y, 1-black)
+				}
+			}
+			m.Pix[y*m.Stride+1] |= 0x3f
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, m); err != nil {
+			t.Fatal(err)
+		}
+		if want := decodeTests[1].data; buf.String() != "P4\n10 3\n"+want[len("P4 10 3\n"):] {
+			t.Errorf("black at %d: encoded %q", black, buf.String())
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, "round trip", m1)
+	}
+	if err := Encode(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 0, 5), nil)); err == nil {
+		t.Error("empty image: no error")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// A Pool keeps images no longer in use for reuse by images of the same
+// size, so that the temporaries of a series of operations on large pages do
+// not each take a new buffer. The zero value is an empty pool, and a nil
+// *Pool keeps nothing: its Get is New. A Pool may be used by several
+// goroutines at once. The images in a pool may be freed at any time, as
+// with sync.Pool.
+type Pool struct {
+	mu    sync.Mutex
+	pools map[poolKey]*sync.Pool
+}
+
+// A poolKey is the shape of the pixel buffers of a sync.Pool.
+type poolKey struct {
+	width, stride, height int
+}
+
+// pool returns the sync.Pool of images of the given shape.
+func (p *Pool) pool(k poolKey) *sync.Pool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sp := p.pools[k]
+	if sp == nil {
+		if p.pools == nil {
+			p.pools = make(map[poolKey]*sync.Pool)
+		}
+		sp = new(sync.Pool)
+		p.pools[k] = sp
+	}
+	return sp
+}
+
+// Get returns an image with the given bounds and palette, all pixels of
+// index 0, as New does, reusing an image put in the pool if there is one of
+// the same size.
+func (p *Pool) Get(r image.Rectangle, pal color.Palette) *Image {
+	w, h := r.Dx(), r.Dy()
+	k := poolKey{w, (w + 7) / 8, h}
+	if p != nil && w > 0 && h > 0 {
+		if m, _ := p.pool(k).Get().(*Image); m != nil {
+			bitmap.Fill(m.Pix, 0)
+			m.Rect = r
+			m.SetPalette(pal)
+			return m
+		}
+	}
+	return New(r, pal)
+}
+
+// Put puts m in the pool. Neither m nor images sharing its pixels may be
+// used after that. Only images made by New or Get are taken, not their
+// sub-images.
+func (p *Pool) Put(m *Image) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if p == nil || !m.own || w <= 0 || h <= 0 || len(m.Pix) != m.Stride*h {
+		return
+	}
+	p.pool(poolKey{w, m.Stride, h}).Put(m)
+}
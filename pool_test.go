@@ -0,0 +1,89 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	var p Pool
+	pal := color.Palette{color.Black, color.White}
+	for i := 0; i < 3; i++ {
+		m := p.Get(image.Rect(5, 5, 105, 55), pal)
+		if m.Rect != image.Rect(5, 5, 105, 55) || m.Stride != 13 || len(m.Pix) != 13*50 {
+			t.Fatalf("got bounds %v, stride %d, %d bytes", m.Rect, m.Stride, len(m.Pix))
+		}
+		for _, b := range m.Pix {
+			if b != 0 {
+				t.Fatal("pixels not cleared")
+			}
+		}
+		if m.At(5, 5) != pal[0] {
+			t.Fatal("wrong palette")
+		}
+		for j := range m.Pix {
+			m.Pix[j] = 0xa5
+		}
+		p.Put(m)
+		pal = color.Palette{color.White, color.Black}
+	}
+
+	// A sub-image is not taken.
+	full := New(image.Rect(0, 0, 64, 8), pal)
+	p.Put(full.SubImage(image.Rect(0, 2, 64, 8)))
+	m := p.Get(image.Rect(0, 0, 64, 6), pal)
+	m.SetColorIndex(0, 0, 1)
+	if full.ColorIndexAt(0, 2) != 0 {
+		t.Error("pool gave out the pixels of a sub-image")
+	}
+	p.Put(full.CowSubImage(full.Rect))
+	if m := p.Get(full.Rect, pal); &m.Pix[0] == &full.Pix[0] {
+		t.Error("pool gave out the pixels of a copy-on-write image")
+	}
+}
+
+func TestNilPool(t *testing.T) {
+	var p *Pool
+	m := p.Get(image.Rect(0, 0, 9, 3), nil)
+	if m.Rect != image.Rect(0, 0, 9, 3) || len(m.Pix) != 2*3 {
+		t.Fatalf("got bounds %v, %d bytes", m.Rect, len(m.Pix))
+	}
+	p.Put(m)
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	var p Pool
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r := image.Rect(0, 0, 10+i%3, 10)
+				m := p.Get(r, nil)
+				if m.Rect != r {
+					t.Errorf("got bounds %v, want %v", m.Rect, r)
+					return
+				}
+				m.Pix[0] = 0xff
+				p.Put(m)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkPool(b *testing.B) {
+	var p Pool
+	r := image.Rect(0, 0, 2480, 3508)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Put(p.Get(r, nil))
+	}
+}
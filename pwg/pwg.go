@@ -0,0 +1,203 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pwg implements an encoder of bilevel images as PWG Raster
+// documents, media type image/pwg-raster, the format of driverless printing
+// with IPP Everywhere.
+//
+// Pages are written in the 1-bit Black color space, black pixels as set
+// bits, with the run-length compression of the format. The page size
+// follows from the image size and resolution.
+//
+// The format is specified in PWG 5102.4-2012.
+package pwg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// A FormatError reports that the images or the options can not be encoded.
+type FormatError string
+
+func (e FormatError) Error() string { return "pwg: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// XResolution and YResolution are the pixel density in dots per inch.
+	// Zero values mean 300.
+	XResolution, YResolution int
+}
+
+const (
+	syncWord   = "RaS2"
+	headerLen  = 1796
+	colorSpace = 3 // Black
+)
+
+// Offsets of the page header fields.
+const (
+	hMediaClass       = 0
+	hHWResolution     = 276
+	hPageSize         = 352
+	hWidth            = 372
+	hHeight           = 376
+	hBitsPerColor     = 384
+	hBitsPerPixel     = 388
+	hBytesPerLine     = 392
+	hColorOrder       = 396
+	hColorSpace       = 400
+	hNumColors        = 420
+	hTotalPageCount   = 452
+	hCrossFeed        = 456
+	hFeed             = 460
+	hImageBoxRight    = 472
+	hImageBoxBottom   = 476
+	hAlternatePrimary = 480
+)
+
+// Encode writes the image m to w as a PWG Raster document of one page.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	return EncodeAll(w, []*img1b.Image{m}, opt)
+}
+
+// EncodeAll writes the images to w as a PWG Raster document with a page per
+// image.
+func EncodeAll(w io.Writer, pages []*img1b.Image, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	if len(pages) == 0 {
+		return FormatError("no pages")
+	}
+	xres, yres := opt.XResolution, opt.YResolution
+	if xres == 0 {
+		xres = 300
+	}
+	if yres == 0 {
+		yres = 300
+	}
+	if xres < 0 || yres < 0 {
+		return FormatError("negative resolution")
+	}
+	for _, m := range pages {
+		d := m.Rect.Size()
+		if d.X <= 0 || d.Y <= 0 || int64(d.X) > 1<<32-1 || int64(d.Y) > 1<<32-1 {
+			return FormatError(fmt.Sprintf("invalid image size: %dx%d", d.X, d.Y))
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(syncWord)
+	for _, m := range pages {
+		writeHeader(bw, m, xres, yres, len(pages))
+		writeBitmap(bw, m)
+	}
+	return bw.Flush()
+}
+
+// writeHeader writes the page header of m.
+func writeHeader(bw *bufio.Writer, m *img1b.Image, xres, yres, numPages int) {
+	var h [headerLen]byte
+	put := func(off int, v int) {
+		binary.BigEndian.PutUint32(h[off:], uint32(v))
+	}
+	copy(h[hMediaClass:], "PwgRaster")
+	w, ht := m.Rect.Dx(), m.Rect.Dy()
+	put(hHWResolution, xres)
+	put(hHWResolution+4, yres)
+	put(hPageSize, int((int64(w)*72+int64(xres)/2)/int64(xres)))
+	put(hPageSize+4, int((int64(ht)*72+int64(yres)/2)/int64(yres)))
+	put(hWidth, w)
+	put(hHeight, ht)
+	put(hBitsPerColor, 1)
+	put(hBitsPerPixel, 1)
+	put(hBytesPerLine, (w+7)/8)
+	put(hColorOrder, 0) // chunky
+	put(hColorSpace, colorSpace)
+	put(hNumColors, 1)
+	put(hTotalPageCount, numPages)
+	put(hCrossFeed, 1)
+	put(hFeed, 1)
+	put(hImageBoxRight, w)
+	put(hImageBoxBottom, ht)
+	put(hAlternatePrimary, 0xffffff)
+	bw.Write(h[:])
+}
+
+// writeBitmap writes the rows of m compressed: each group of equal rows is
+// coded once, after a count of its repetitions, as runs of repeated and
+// literal bytes.
+func writeBitmap(bw *bufio.Writer, m *img1b.Image) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	rowBytes := (w + 7) / 8
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(w)
+	row := make([]byte, rowBytes)
+	next := make([]byte, rowBytes)
+	load := func(dst []byte, y int) {
+		copy(dst, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range dst {
+				dst[i] = ^dst[i]
+			}
+		}
+		dst[rowBytes-1] &= tm
+	}
+	load(row, 0)
+	for y := 0; y < h; {
+		repeat := 0
+		for y+repeat+1 < h && repeat < 255 {
+			load(next, y+repeat+1)
+			if !bytes.Equal(next, row) {
+				break
+			}
+			repeat++
+		}
+		bw.WriteByte(byte(repeat))
+		writeRow(bw, row)
+		y += repeat + 1
+		if y < h {
+			if repeat == 255 {
+				load(next, y)
+			}
+			row, next = next, row
+		}
+	}
+}
+
+// writeRow writes a compressed row. Runs of up to 128 equal bytes are coded
+// as their length minus one and the byte, up to 128 literal bytes as 257
+// minus their count and the bytes.
+func writeRow(bw *bufio.Writer, row []byte) {
+	for len(row) > 0 {
+		n := 1
+		for n < len(row) && n < 128 && row[n] == row[0] {
+			n++
+		}
+		if n > 1 || len(row) == 1 {
+			bw.WriteByte(byte(n - 1))
+			bw.WriteByte(row[0])
+			row = row[n:]
+			continue
+		}
+		// Literal bytes up to the next run of at least two.
+		n = 1
+		for n < len(row) && n < 128 && !(n+1 < len(row) && row[n] == row[n+1]) {
+			n++
+		}
+		if n == 1 {
+			bw.WriteByte(0)
+		} else {
+			bw.WriteByte(byte(257 - n))
+		}
+		bw.Write(row[:n])
+		row = row[n:]
+	}
+}
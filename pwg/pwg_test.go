@@ -0,0 +1,143 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pwg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func testImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	r := rand.New(rand.NewSource(int64(w)))
+	for y := 0; y < h; y++ {
+		// Blank bands make long groups of equal rows.
+		if y%300 > 150 {
+			continue
+		}
+		for x := 0; x < w; x++ {
+			if x%9 < 4 && y%5 != 0 || r.Intn(40) == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// decodePage decodes a page header and bitmap and returns the header and
+// rows of dots.
+func decodePage(t *testing.T, data []byte) (h []byte, rows [][]byte, rest []byte) {
+	t.Helper()
+	if len(data) < headerLen {
+		t.Fatal("short header")
+	}
+	h, data = data[:headerLen], data[headerLen:]
+	get := func(off int) int { return int(binary.BigEndian.Uint32(h[off:])) }
+	width, height, rowBytes := get(hWidth), get(hHeight), get(hBytesPerLine)
+	if rowBytes != (width+7)/8 {
+		t.Fatalf("got %d bytes per line for width %d", rowBytes, width)
+	}
+	for len(rows) < height {
+		repeat := int(data[0]) + 1
+		data = data[1:]
+		var row []byte
+		for len(row) < rowBytes {
+			c := int(data[0])
+			switch {
+			case c < 128:
+				row = append(row, bytes.Repeat(data[1:2], c+1)...)
+				data = data[2:]
+			case c > 128:
+				row = append(row, data[1:1+257-c]...)
+				data = data[1+257-c:]
+			default:
+				t.Fatal("reserved control byte")
+			}
+		}
+		if len(row) != rowBytes {
+			t.Fatalf("row %d: got %d bytes", len(rows), len(row))
+		}
+		for i := 0; i < repeat; i++ {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) != height {
+		t.Fatalf("got %d rows, want %d", len(rows), height)
+	}
+	return h, rows, data
+}
+
+func TestEncodeAll(t *testing.T) {
+	pages := []*img1b.Image{
+		testImage(2550, 700, color.Palette{color.White, color.Black}),
+		testImage(77, 30, color.Palette{color.Black, color.White}),
+		// More equal rows than a count holds.
+		img1b.New(image.Rect(0, 0, 20, 600), color.Palette{color.White, color.Black}),
+	}
+	var b bytes.Buffer
+	if err := EncodeAll(&b, pages, &Options{XResolution: 300, YResolution: 600}); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	if !bytes.HasPrefix(data, []byte(syncWord)) {
+		t.Fatal("missing sync word")
+	}
+	data = data[4:]
+	for i, m := range pages {
+		h, rows, rest := decodePage(t, data)
+		data = rest
+		get := func(off int) int { return int(binary.BigEndian.Uint32(h[off:])) }
+		if string(h[:10]) != "PwgRaster\x00" {
+			t.Errorf("page %d: bad media class %q", i, h[:10])
+		}
+		w, ht := m.Rect.Dx(), m.Rect.Dy()
+		fields := []struct {
+			off, want int
+		}{
+			{hHWResolution, 300},
+			{hHWResolution + 4, 600},
+			{hPageSize, (w*72 + 150) / 300},
+			{hPageSize + 4, (ht*72 + 300) / 600},
+			{hBitsPerColor, 1},
+			{hBitsPerPixel, 1},
+			{hColorSpace, 3},
+			{hNumColors, 1},
+			{hTotalPageCount, len(pages)},
+		}
+		for _, f := range fields {
+			if got := get(f.off); got != f.want {
+				t.Errorf("page %d: field at %d: got %d, want %d", i, f.off, got, f.want)
+			}
+		}
+		for y, row := range rows {
+			for x := 0; x < len(row)*8; x++ {
+				dot := row[x/8]>>uint(7-x%8)&1 == 1
+				if black := x < w && m.At(x, y) == color.Black; dot != black {
+					t.Fatalf("page %d: at (%d, %d) got dot %v", i, x, y, dot)
+				}
+			}
+		}
+	}
+	if len(data) != 0 {
+		t.Errorf("%d extra bytes", len(data))
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if err := EncodeAll(new(bytes.Buffer), nil, nil); err == nil {
+		t.Error("no pages accepted")
+	}
+	if err := Encode(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 5, 0), nil), nil); err == nil {
+		t.Error("empty image accepted")
+	}
+	if err := Encode(new(bytes.Buffer), testImage(8, 8, nil), &Options{XResolution: -1}); err == nil {
+		t.Error("negative resolution accepted")
+	}
+}
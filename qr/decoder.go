@@ -0,0 +1,770 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qr
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// An UnsupportedError reports that the code uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "qr: unsupported feature: " + string(e) }
+
+// maxTriples is the number of the likeliest triples of finder patterns
+// Decode tries.
+const maxTriples = 5
+
+// Decode finds a QR code in m and returns its text. The code may be
+// mirrored, turned and slightly distorted by perspective. Upright codes read
+// with modules of a pixel, turned ones need about three. Byte mode data is
+// returned as is.
+func Decode(m *img1b.Image) (string, error) {
+	p := &picture{
+		pix:    m.Pix,
+		stride: m.Stride,
+		w:      m.Rect.Dx(),
+		h:      m.Rect.Dy(),
+		ink:    bitmap.BlackIndex(m.Palette),
+	}
+	var err error = FormatError("no code found")
+	for i, t := range triples(p.finders()) {
+		if i == maxTriples {
+			break
+		}
+		var text string
+		if text, err = p.decode(t); err == nil {
+			return text, nil
+		}
+	}
+	return "", err
+}
+
+// picture gives access to the pixels of an image.
+type picture struct {
+	pix    []byte
+	stride int
+	w, h   int
+	ink    uint8 // bit value of black
+}
+
+// black reports whether the pixel at (x, y) is black. Pixels outside are
+// white.
+func (p *picture) black(x, y int) bool {
+	if x < 0 || y < 0 || x >= p.w || y >= p.h {
+		return false
+	}
+	return p.pix[y*p.stride+x>>3]>>uint(7-x&7)&1 == p.ink
+}
+
+// blackAt reports whether the pixel covering the point (x, y) is black.
+func (p *picture) blackAt(x, y float64) bool {
+	return p.black(int(math.Floor(x)), int(math.Floor(y)))
+}
+
+// inside reports whether (x, y) is a pixel of the picture.
+func (p *picture) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < p.w && y < p.h
+}
+
+// A finder is a candidate finder pattern.
+type finder struct {
+	x, y   float64 // center
+	module float64 // module size
+	hits   int     // number of rows it was seen in
+}
+
+// finderRatio reports whether runs look like the 1:1:3:1:1 runs across a
+// finder pattern.
+func finderRatio(runs []int) bool {
+	total := 0
+	for _, r := range runs {
+		total += r
+	}
+	if total < 7 {
+		return false
+	}
+	m := float64(total) / 7
+	for i, r := range runs {
+		want, tol := m, m/2
+		if i == 2 {
+			want, tol = 3*m, 3*m/2
+		}
+		if math.Abs(float64(r)-want) >= tol {
+			return false
+		}
+	}
+	return true
+}
+
+// crossCheck measures the runs across a finder pattern through the black
+// pixel (x, y) along the direction (dx, dy), one of the axes. It returns
+// the center of the middle run along that axis and the total length.
+func (p *picture) crossCheck(x, y, dx, dy int) (float64, int, bool) {
+	if !p.black(x, y) {
+		return 0, 0, false
+	}
+	var runs [5]int
+	i, j := x, y
+	for k := 2; k >= 0; k-- {
+		for p.inside(i, j) && p.black(i, j) == (k != 1) {
+			runs[k]++
+			i, j = i-dx, j-dy
+		}
+	}
+	back := runs[2]
+	i, j = x+dx, y+dy
+	for k := 2; k < 5; k++ {
+		for p.inside(i, j) && p.black(i, j) == (k != 3) {
+			runs[k]++
+			i, j = i+dx, j+dy
+		}
+	}
+	if runs[0] == 0 || runs[4] == 0 || !finderRatio(runs[:]) {
+		return 0, 0, false
+	}
+	pos := x*dx + y*dy
+	total := 0
+	for _, r := range runs {
+		total += r
+	}
+	return float64(2*pos-2*back+runs[2]+2) / 2, total, true
+}
+
+// finders returns the candidate finder patterns: those crossed by 1:1:3:1:1
+// runs both horizontally and vertically.
+func (p *picture) finders() []finder {
+	var fs []finder
+	var runs []int
+	for y := 0; y < p.h; y++ {
+		// Runs of the row, white ones at even indices.
+		runs = runs[:0]
+		cur, n := false, 0
+		for x := 0; x < p.w; x++ {
+			if b := p.black(x, y); b != cur {
+				runs = append(runs, n)
+				cur, n = b, 0
+			}
+			n++
+		}
+		runs = append(runs, n)
+		x := 0
+		for i := 0; i < len(runs); i++ {
+			if i%2 == 1 && i+5 <= len(runs) && finderRatio(runs[i:i+5]) {
+				total := runs[i] + runs[i+1] + runs[i+2] + runs[i+3] + runs[i+4]
+				fs = p.confirm(fs, x+runs[i]+runs[i+1]+runs[i+2]/2, y, total)
+			}
+			x += runs[i]
+		}
+	}
+	return fs
+}
+
+// confirm checks a finder pattern found in a row, centered at (x, y) and
+// total pixels wide, and merges it into fs.
+func (p *picture) confirm(fs []finder, x, y, total int) []finder {
+	cy, vt, ok := p.crossCheck(x, y, 0, 1)
+	if !ok || 5*abs(vt-total) >= 2*total {
+		return fs
+	}
+	cx, ht, ok := p.crossCheck(x, int(cy), 1, 0)
+	if !ok || 5*abs(ht-total) >= 2*total {
+		return fs
+	}
+	m := float64(ht+vt) / 14
+	for i := range fs {
+		f := &fs[i]
+		if math.Abs(f.x-cx) <= f.module && math.Abs(f.y-cy) <= f.module && math.Abs(f.module-m) <= math.Max(1, f.module/2) {
+			n := float64(f.hits)
+			f.x = (f.x*n + cx) / (n + 1)
+			f.y = (f.y*n + cy) / (n + 1)
+			f.module = (f.module*n + m) / (n + 1)
+			f.hits++
+			return fs
+		}
+	}
+	return append(fs, finder{cx, cy, m, 1})
+}
+
+// A triple is a triple of finder patterns: the top left, top right and
+// bottom left ones.
+type triple [3]finder
+
+// triples returns the triples of finder patterns that may belong to a
+// code, the likeliest first.
+func triples(fs []finder) []triple {
+	sort.SliceStable(fs, func(i, j int) bool { return fs[i].hits > fs[j].hits })
+	if len(fs) > 10 {
+		fs = fs[:10]
+	}
+	type scored struct {
+		t     triple
+		score float64
+	}
+	var ts []scored
+	for i := 0; i < len(fs); i++ {
+		for j := i + 1; j < len(fs); j++ {
+			for k := j + 1; k < len(fs); k++ {
+				t, score, ok := orient(fs[i], fs[j], fs[k])
+				if ok {
+					ts = append(ts, scored{t, score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(ts, func(i, j int) bool { return ts[i].score < ts[j].score })
+	res := make([]triple, len(ts))
+	for i, s := range ts {
+		res[i] = s.t
+	}
+	return res
+}
+
+// orient orders three finder patterns as the corners of a code and scores
+// how far they are from a right isosceles triangle of alike patterns.
+func orient(a, b, c finder) (triple, float64, bool) {
+	dist := func(f, g finder) float64 { return math.Hypot(f.x-g.x, f.y-g.y) }
+	// The top left pattern faces the longest side.
+	if dist(a, b) > dist(a, c) && dist(a, b) > dist(b, c) {
+		a, c = c, a
+	} else if dist(a, c) > dist(b, c) {
+		a, b = b, a
+	}
+	if (b.x-a.x)*(c.y-a.y)-(b.y-a.y)*(c.x-a.x) < 0 {
+		b, c = c, b
+	}
+	lo := math.Min(a.module, math.Min(b.module, c.module))
+	hi := math.Max(a.module, math.Max(b.module, c.module))
+	ab, ac, bc := dist(a, b), dist(a, c), dist(b, c)
+	if hi > 2*lo || math.Min(ab, ac) < 7*hi {
+		return triple{}, 0, false
+	}
+	score := math.Abs(ab-ac)/math.Max(ab, ac) + math.Abs(bc-math.Hypot(ab, ac))/bc + (hi-lo)/hi
+	return triple{a, b, c}, score, score < 0.5
+}
+
+// decode decodes the code with the finder patterns t.
+func (p *picture) decode(t triple) (string, error) {
+	a, b, c := t[0], t[1], t[2]
+	ab, ac := math.Hypot(b.x-a.x, b.y-a.y), math.Hypot(c.x-a.x, c.y-a.y)
+	mab := (p.moduleAlong(a, b.x-a.x, b.y-a.y) + p.moduleAlong(b, a.x-b.x, a.y-b.y)) / 2
+	mac := (p.moduleAlong(a, c.x-a.x, c.y-a.y) + p.moduleAlong(c, a.x-c.x, a.y-c.y)) / 2
+	// The estimated size, and the sizes of the nearest versions.
+	e := (ab/mab+ac/mac)/2 + 7
+	v := int(math.Floor((e-17)/4 + 0.5))
+	if v < MinVersion-1 || v > MaxVersion+1 {
+		return "", FormatError("no code found")
+	}
+	var sizes []int
+	for _, v := range []int{v, v - 1, v + 1} {
+		if v >= MinVersion && v <= MaxVersion && math.Abs(float64(size(v))-e) < 3 {
+			sizes = append(sizes, size(v))
+		}
+	}
+	var err error = FormatError("no code found")
+	for i := 0; i < len(sizes); i++ {
+		var text string
+		var n int
+		if text, n, err = p.decodeSize(t, sizes[i]); err == nil {
+			return text, nil
+		}
+		// The version information tells another size.
+		if n != 0 && i+1 == len(sizes) {
+			sizes = append(sizes, n)
+		}
+	}
+	return "", err
+}
+
+// decodeSize decodes the code of size n with the finder patterns t. When
+// the version information disagrees with n, it returns the size it tells.
+func (p *picture) decodeSize(t triple, n int) (string, int, error) {
+	a, b, c := t[0], t[1], t[2]
+	corners := [4][2]float64{{a.x, a.y}, {b.x, b.y}, {b.x + c.x - a.x, b.y + c.y - a.y}, {c.x, c.y}}
+	fn := float64(n)
+	affine := quadToQuad([4][2]float64{{3.5, 3.5}, {fn - 3.5, 3.5}, {fn - 3.5, fn - 3.5}, {3.5, fn - 3.5}}, corners)
+	trs := []transform{affine}
+	if n > size(1) {
+		if x, y, ok := p.findAlignment(&affine, n); ok {
+			corners[2] = [2]float64{x, y}
+			persp := quadToQuad([4][2]float64{{3.5, 3.5}, {fn - 3.5, 3.5}, {fn - 6.5, fn - 6.5}, {3.5, fn - 3.5}}, corners)
+			trs = []transform{persp, affine}
+		}
+	}
+	var err error
+	for _, tr := range trs {
+		grid := p.sample(&tr, n)
+		if n >= size(7) {
+			if v, ok := readVersion(grid, n); ok && size(v) != n {
+				return "", size(v), FormatError("bad version information")
+			}
+		}
+		var text string
+		if text, err = decodeGrid(grid, n); err == nil {
+			return text, 0, nil
+		}
+	}
+	return "", 0, err
+}
+
+// moduleAlong measures the module size of a finder pattern along the
+// direction (dx, dy), which differs from the one along the axes when the
+// code is turned.
+func (p *picture) moduleAlong(f finder, dx, dy float64) float64 {
+	const step = 0.125
+	l := math.Hypot(dx, dy)
+	dx, dy = dx/l*step, dy/l*step
+	total := 0.0
+	for _, sign := range []float64{-1, 1} {
+		// Small steps out to the white beyond the outer ring.
+		k, state := 0, 0
+		for ; state < 3 && float64(k)*step < 10*f.module; k++ {
+			if p.blackAt(f.x+sign*float64(k)*dx, f.y+sign*float64(k)*dy) != (state != 1) {
+				state++
+			}
+		}
+		if state < 3 {
+			return f.module
+		}
+		total += (float64(k) - 1.5) * step
+	}
+	return total / 7
+}
+
+// transform is a projective transform, a 3×3 matrix mapping (x, y, 1) to
+// homogeneous coordinates.
+type transform [9]float64
+
+func (t *transform) apply(x, y float64) (float64, float64) {
+	w := t[6]*x + t[7]*y + t[8]
+	return (t[0]*x + t[1]*y + t[2]) / w, (t[3]*x + t[4]*y + t[5]) / w
+}
+
+// mul returns t·u, which applies u first.
+func (t *transform) mul(u *transform) transform {
+	var r transform
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i*3+j] += t[i*3+k] * u[k*3+j]
+			}
+		}
+	}
+	return r
+}
+
+// adjugate returns the adjugate of t, which inverts the transform.
+func (t *transform) adjugate() transform {
+	a, b, c, d, e, f, g, h, i := t[0], t[1], t[2], t[3], t[4], t[5], t[6], t[7], t[8]
+	return transform{
+		e*i - f*h, c*h - b*i, b*f - c*e,
+		f*g - d*i, a*i - c*g, c*d - a*f,
+		d*h - e*g, b*g - a*h, a*e - b*d,
+	}
+}
+
+// squareToQuad returns the transform of the unit square corners (0, 0),
+// (1, 0), (1, 1) and (0, 1) to q.
+func squareToQuad(q [4][2]float64) transform {
+	x0, y0, x1, y1 := q[0][0], q[0][1], q[1][0], q[1][1]
+	x2, y2, x3, y3 := q[2][0], q[2][1], q[3][0], q[3][1]
+	dx3, dy3 := x0-x1+x2-x3, y0-y1+y2-y3
+	if dx3 == 0 && dy3 == 0 {
+		return transform{x1 - x0, x2 - x1, x0, y1 - y0, y2 - y1, y0, 0, 0, 1}
+	}
+	dx1, dx2, dy1, dy2 := x1-x2, x3-x2, y1-y2, y3-y2
+	den := dx1*dy2 - dx2*dy1
+	g := (dx3*dy2 - dx2*dy3) / den
+	h := (dx1*dy3 - dx3*dy1) / den
+	return transform{x1 - x0 + g*x1, x3 - x0 + h*x3, x0, y1 - y0 + g*y1, y3 - y0 + h*y3, y0, g, h, 1}
+}
+
+// quadToQuad returns the transform of the corners src to dst.
+func quadToQuad(src, dst [4][2]float64) transform {
+	s, d := squareToQuad(src), squareToQuad(dst)
+	adj := s.adjugate()
+	return d.mul(&adj)
+}
+
+// findAlignment looks for the bottom right alignment pattern of a code of
+// size n about where the transform from modules to pixels puts it.
+func (p *picture) findAlignment(tr *transform, n int) (float64, float64, bool) {
+	c := float64(n) - 6.5
+	ex, ey := tr.apply(c, c)
+	x1, y1 := tr.apply(c+1, c)
+	x2, y2 := tr.apply(c, c+1)
+	ux, uy, vx, vy := x1-ex, y1-ey, x2-ex, y2-ey
+	r := int(4*math.Max(math.Hypot(ux, uy), math.Hypot(vx, vy))) + 1
+	best := 0
+	var cands [][2]float64
+	for y := int(ey) - r; y <= int(ey)+r; y++ {
+		for x := int(ex) - r; x <= int(ex)+r; x++ {
+			cx, cy := float64(x)+0.5, float64(y)+0.5
+			s := 0
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					fx, fy := float64(dx), float64(dy)
+					if p.blackAt(cx+fx*ux+fy*vx, cy+fx*uy+fy*vy) == (max(abs(dx), abs(dy)) != 1) {
+						s++
+					}
+				}
+			}
+			if s > best {
+				best, cands = s, cands[:0]
+			}
+			if s == best {
+				cands = append(cands, [2]float64{cx, cy})
+			}
+		}
+	}
+	if best < 24 {
+		return 0, 0, false
+	}
+	// The centroid of the best positions next to the one nearest to the
+	// estimate.
+	near := cands[0]
+	for _, q := range cands {
+		if math.Hypot(q[0]-ex, q[1]-ey) < math.Hypot(near[0]-ex, near[1]-ey) {
+			near = q
+		}
+	}
+	m := math.Max(1, math.Hypot(ux, uy))
+	var sx, sy, k float64
+	for _, q := range cands {
+		if math.Abs(q[0]-near[0]) <= m && math.Abs(q[1]-near[1]) <= m {
+			sx, sy, k = sx+q[0], sy+q[1], k+1
+		}
+	}
+	return sx / k, sy / k, true
+}
+
+// sample reads the modules of a code of size n at their centers.
+func (p *picture) sample(tr *transform, n int) []bool {
+	grid := make([]bool, n*n)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			grid[y*n+x] = p.blackAt(tr.apply(float64(x)+0.5, float64(y)+0.5))
+		}
+	}
+	return grid
+}
+
+// readVersion reads the version information of a code of size n, from
+// either copy, which also reads it from mirrored codes.
+func readVersion(grid []bool, n int) (int, bool) {
+	bestV, bestD := 0, 4
+	for cp := 0; cp < 2; cp++ {
+		vi := 0
+		for i := 0; i < 18; i++ {
+			x, y := n-11+i%3, i/3
+			if cp == 1 {
+				x, y = y, x
+			}
+			if grid[y*n+x] {
+				vi |= 1 << uint(i)
+			}
+		}
+		for v := 7; v <= MaxVersion; v++ {
+			if d := bits.OnesCount(uint(vi ^ versionInfo(v))); d < bestD {
+				bestV, bestD = v, d
+			}
+		}
+	}
+	return bestV, bestD < 4
+}
+
+// decodeGrid decodes the modules of a code of size n, or of its mirror
+// image.
+func decodeGrid(grid []bool, n int) (string, error) {
+	text, err := readGrid(grid, n)
+	if err == nil {
+		return text, nil
+	}
+	t := make([]bool, n*n)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			t[x*n+y] = grid[y*n+x]
+		}
+	}
+	if text, terr := readGrid(t, n); terr == nil {
+		return text, nil
+	}
+	return "", err
+}
+
+// readGrid decodes the modules of a code of size n.
+func readGrid(grid []bool, n int) (string, error) {
+	v := (n - 17) / 4
+	l, mask, bestD := L, 0, 4
+	var f1, f2 int
+	for i := 0; i < 15; i++ {
+		x1, y1, x2, y2 := formatPos(i, n)
+		if grid[y1*n+x1] {
+			f1 |= 1 << uint(i)
+		}
+		if grid[y2*n+x2] {
+			f2 |= 1 << uint(i)
+		}
+	}
+	for ll := L; ll <= H; ll++ {
+		for k := 0; k < 8; k++ {
+			fi := formatInfo(ll, k)
+			for _, f := range []int{f1, f2} {
+				if d := bits.OnesCount(uint(f ^ fi)); d < bestD {
+					l, mask, bestD = ll, k, d
+				}
+			}
+		}
+	}
+	if bestD > 3 {
+		return "", FormatError("bad format information")
+	}
+
+	c := newCode(v, l)
+	raw := make([]byte, rawModules(v)/8)
+	i := 0
+	c.dataModules(func(x, y int) {
+		if i < len(raw)*8 {
+			if grid[y*n+x] != maskBit(mask, x, y) {
+				raw[i>>3] |= 0x80 >> uint(i&7)
+			}
+			i++
+		}
+	})
+
+	nb, short, shortLen, ecc := blockSizes(v, l)
+	blocks := make([][]byte, nb)
+	for j := range blocks {
+		blocks[j] = make([]byte, shortLen)
+		if j >= short {
+			blocks[j] = make([]byte, shortLen+1)
+		}
+	}
+	i = 0
+	blockOrder(v, l, func(j, k int) {
+		blocks[j][k] = raw[i]
+		i++
+	})
+	var data []byte
+	for _, b := range blocks {
+		if !rsCorrect(b, ecc) {
+			return "", FormatError("too many errors")
+		}
+		data = append(data, b[:len(b)-ecc]...)
+	}
+	return parse(data, v)
+}
+
+// bitReader reads bits from bytes, most significant first.
+type bitReader struct {
+	b   []byte
+	n   int  // number of bits read
+	eof bool // reading past the end
+}
+
+func (r *bitReader) left() int { return len(r.b)*8 - r.n }
+
+func (r *bitReader) read(n int) int {
+	if n > r.left() {
+		r.eof = true
+		r.n = len(r.b) * 8
+		return 0
+	}
+	v := 0
+	for ; n > 0; n-- {
+		v = v<<1 | int(r.b[r.n>>3]>>uint(7-r.n&7)&1)
+		r.n++
+	}
+	return v
+}
+
+// parse decodes the segments of data of a code of version v.
+func parse(data []byte, v int) (string, error) {
+	r := &bitReader{b: data}
+	var sb strings.Builder
+	for r.left() >= 4 {
+		md := r.read(4)
+		switch md {
+		case 0:
+			return sb.String(), nil
+		case modeNumeric:
+			n := r.read(countBits(md, v))
+			for ; n > 0 && !r.eof; n -= 3 {
+				k := n
+				if k > 3 {
+					k = 3
+				}
+				d := r.read(3*k + 1)
+				if d >= [...]int{1, 10, 100, 1000}[k] {
+					return "", FormatError("invalid numeric data")
+				}
+				fmt.Fprintf(&sb, "%0*d", k, d)
+			}
+		case modeAlnum:
+			n := r.read(countBits(md, v))
+			for ; n > 1 && !r.eof; n -= 2 {
+				d := r.read(11)
+				if d >= 45*45 {
+					return "", FormatError("invalid alphanumeric data")
+				}
+				sb.WriteByte(alnumChars[d/45])
+				sb.WriteByte(alnumChars[d%45])
+			}
+			if n == 1 {
+				d := r.read(6)
+				if d >= 45 {
+					return "", FormatError("invalid alphanumeric data")
+				}
+				sb.WriteByte(alnumChars[d])
+			}
+		case modeByte:
+			n := r.read(countBits(md, v))
+			for ; n > 0 && !r.eof; n-- {
+				sb.WriteByte(byte(r.read(8)))
+			}
+		case 3: // structured append
+			r.read(16)
+		case 5: // FNC1 in first position
+		case 7: // ECI, the character set is left to the caller
+			if d := r.read(8); d&0x80 != 0 {
+				if d&0x40 == 0 {
+					r.read(8)
+				} else {
+					r.read(16)
+				}
+			}
+		case 8:
+			return "", UnsupportedError("kanji mode")
+		case 9: // FNC1 in second position
+			r.read(8)
+		default:
+			return "", FormatError("invalid mode")
+		}
+		if r.eof {
+			return "", FormatError("truncated data")
+		}
+	}
+	return sb.String(), nil
+}
+
+// gfExp and gfLog are the powers of 2 in GF(256) and their logarithms.
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp, log [256]byte) {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+		x = gfMul(x, 2)
+	}
+	return
+}
+
+// gfInv returns the inverse of x, which is not 0.
+func gfInv(x byte) byte {
+	return gfExp[(255-int(gfLog[x]))%255]
+}
+
+// gfEval evaluates a polynomial, lowest power first, at x.
+func gfEval(poly []byte, x byte) byte {
+	var v byte
+	for i := len(poly) - 1; i >= 0; i-- {
+		v = gfMul(v, x) ^ poly[i]
+	}
+	return v
+}
+
+// rsSyndromes returns the syndromes of a block with ecc error correction
+// codewords, and whether any is not 0.
+func rsSyndromes(b []byte, ecc int) ([]byte, bool) {
+	s := make([]byte, ecc)
+	bad := false
+	for j := range s {
+		var v byte
+		for _, c := range b {
+			v = gfMul(v, gfExp[j]) ^ c
+		}
+		s[j] = v
+		bad = bad || v != 0
+	}
+	return s, bad
+}
+
+// rsCorrect corrects the errors of a block with ecc error correction
+// codewords and reports whether it could.
+func rsCorrect(b []byte, ecc int) bool {
+	s, bad := rsSyndromes(b, ecc)
+	if !bad {
+		return true
+	}
+	// The error locator by Berlekamp-Massey.
+	lam, prev := []byte{1}, []byte{1}
+	nl, m, pd := 0, 1, byte(1)
+	for k := 0; k < ecc; k++ {
+		d := s[k]
+		for i := 1; i <= nl && i < len(lam); i++ {
+			d ^= gfMul(lam[i], s[k-i])
+		}
+		if d == 0 {
+			m++
+			continue
+		}
+		t := append([]byte(nil), lam...)
+		coef := gfMul(d, gfInv(pd))
+		for len(lam) < len(prev)+m {
+			lam = append(lam, 0)
+		}
+		for i, c := range prev {
+			lam[i+m] ^= gfMul(coef, c)
+		}
+		if 2*nl <= k {
+			nl, prev, pd, m = k+1-nl, t, d, 1
+		} else {
+			m++
+		}
+	}
+	if 2*nl > ecc {
+		return false
+	}
+	// The error evaluator.
+	omega := make([]byte, ecc)
+	for i := range omega {
+		for j := 0; j <= i && j < len(lam); j++ {
+			omega[i] ^= gfMul(lam[j], s[i-j])
+		}
+	}
+	// Chien search and Forney's formula.
+	found := 0
+	for i := range b {
+		k := (len(b) - 1 - i) % 255
+		xinv := gfExp[(255-k)%255]
+		if gfEval(lam, xinv) != 0 {
+			continue
+		}
+		var den byte
+		xp, x2 := byte(1), gfMul(xinv, xinv)
+		for j := 1; j < len(lam); j += 2 {
+			den ^= gfMul(lam[j], xp)
+			xp = gfMul(xp, x2)
+		}
+		if den == 0 {
+			return false
+		}
+		b[i] ^= gfMul(gfMul(gfExp[k], gfEval(omega, xinv)), gfInv(den))
+		found++
+	}
+	if found != nl {
+		return false
+	}
+	_, bad = rsSyndromes(b, ecc)
+	return !bad
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qr
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+// warp returns a w×h image of m seen through f, which maps the centers of
+// the pixels of the result to points of m.
+func warp(m *img1b.Image, w, h int, p color.Palette, f func(x, y float64) (float64, float64)) *img1b.Image {
+	d := img1b.New(image.Rect(0, 0, w, h), p)
+	black := uint8(1)
+	if p[0] == color.Black {
+		black = 0
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := f(float64(x)+0.5, float64(y)+0.5)
+			b := m.At(int(math.Floor(sx)), int(math.Floor(sy))) == color.Black
+			if b == (black == 1) {
+				d.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return d
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		text         string
+		l            Level
+		scale, quiet int
+	}{
+		{"HELLO WORLD", M, 1, 4},
+		{"0123456789012345", L, 2, 4},
+		{"https://example.com/receipt?id=12345", H, 3, 2},
+		{"Ticket #42: row 7, seat 13", Q, 4, 4},
+		{strings.Repeat("Lorem ipsum dolor sit amet. ", 12), M, 2, 4},
+		{strings.Repeat("0123456789", 150), L, 2, 4},
+		{"", L, 1, 1},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.text, tt.l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := c.Image(tt.scale, tt.quiet)
+		got, err := Decode(m)
+		if err != nil {
+			t.Errorf("%.20q version %d: %v", tt.text, c.Version, err)
+			continue
+		}
+		if got != tt.text {
+			t.Errorf("%.20q version %d: got %.20q", tt.text, c.Version, got)
+		}
+	}
+}
+
+func TestDecodeTransformed(t *testing.T) {
+	c, err := Encode("https://example.com/ticket/2020-0042", M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scale = 6
+	m := c.Image(scale, 4)
+	s := float64(m.Rect.Dx())
+	wb := color.Palette{color.White, color.Black}
+	bw := color.Palette{color.Black, color.White}
+	tests := []struct {
+		name string
+		p    color.Palette
+		f    func(x, y float64) (float64, float64)
+	}{
+		{"turned 90", wb, func(x, y float64) (float64, float64) { return y, s - x }},
+		{"turned 180", bw, func(x, y float64) (float64, float64) { return s - x, s - y }},
+		{"mirrored", wb, func(x, y float64) (float64, float64) { return s - x, y }},
+		{"turned 30", wb, func(x, y float64) (float64, float64) {
+			sin, cos := math.Sincos(math.Pi / 6)
+			x, y = x-s*0.7, y-s*0.7
+			return x*cos - y*sin + s/2, x*sin + y*cos + s/2
+		}},
+		{"perspective", wb, func(x, y float64) (float64, float64) {
+			// Farther at the top.
+			w := 1 + 0.25*(1-y/s)
+			return (x-s/2)*w + s/2, y * (1 + 0.1*(1-y/s))
+		}},
+	}
+	for _, tt := range tests {
+		d := warp(m, int(1.4*s), int(1.4*s), tt.p, tt.f)
+		if got, err := Decode(d); err != nil || got != "https://example.com/ticket/2020-0042" {
+			t.Errorf("%s: got %q, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	text := "Damaged codes still read"
+	c, err := Encode(text, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Image(1, 4)
+	// Flip a 5×5 block of modules in the middle.
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			px, py := 4+c.Size/2+x, 4+c.Size/2+y
+			m.SetColorIndex(px, py, 1-m.ColorIndexAt(px, py))
+		}
+	}
+	if got, err := Decode(m); err != nil || got != text {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	empty := img1b.New(image.Rect(0, 0, 100, 100), color.Palette{color.White, color.Black})
+	if _, err := Decode(empty); err == nil {
+		t.Error("empty image: no error")
+	}
+	c, err := Encode("HELLO WORLD", L)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := c.Image(1, 4)
+	// Wipe the data.
+	for y := 13; y < 25; y++ {
+		for x := 13; x < 25; x++ {
+			m.SetColorIndex(x, y, 0)
+		}
+	}
+	if _, err := Decode(m); err == nil {
+		t.Error("wiped code: no error")
+	}
+}
+
+func TestReedSolomonCorrect(t *testing.T) {
+	data := []byte("some data codewords")
+	b := append(append([]byte(nil), data...), rsRemainder(data, rsDivisor(10))...)
+	for n := 0; n <= 5; n++ {
+		d := append([]byte(nil), b...)
+		for i := 0; i < n; i++ {
+			d[i*5+1] ^= byte(0x5a + i)
+		}
+		if !rsCorrect(d, 10) || string(d[:len(data)]) != string(data) {
+			t.Errorf("%d errors not corrected", n)
+		}
+	}
+	d := append([]byte(nil), b...)
+	for i := 0; i < 8; i++ {
+		d[i*3] ^= 0xff
+	}
+	if rsCorrect(d, 10) && string(d[:len(data)]) == string(data) {
+		t.Error("8 errors corrected")
+	}
+}
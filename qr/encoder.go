@@ -0,0 +1,440 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qr
+
+import (
+	"strings"
+)
+
+// Modes of data.
+const (
+	modeNumeric = 1
+	modeAlnum   = 2
+	modeByte    = 4
+)
+
+// alnumChars are the characters of alphanumeric mode, in code order.
+const alnumChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// mode returns the most compact mode able to code text.
+func mode(text string) int {
+	m := modeNumeric
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c >= '0' && c <= '9' {
+			continue
+		}
+		if strings.IndexByte(alnumChars, c) < 0 {
+			return modeByte
+		}
+		m = modeAlnum
+	}
+	return m
+}
+
+// countBits returns the width of the character count of a mode in version
+// v.
+func countBits(mode, v int) int {
+	i := 0
+	if v >= 27 {
+		i = 2
+	} else if v >= 10 {
+		i = 1
+	}
+	switch mode {
+	case modeNumeric:
+		return [...]int{10, 12, 14}[i]
+	case modeAlnum:
+		return [...]int{9, 11, 13}[i]
+	}
+	return [...]int{8, 16, 16}[i]
+}
+
+// dataBits returns the number of bits text takes in a mode, without the
+// mode indicator and character count.
+func dataBits(mode int, n int) int {
+	switch mode {
+	case modeNumeric:
+		return n/3*10 + [...]int{0, 4, 7}[n%3]
+	case modeAlnum:
+		return n/2*11 + n%2*6
+	}
+	return n * 8
+}
+
+// bitWriter accumulates bits into bytes, most significant first.
+type bitWriter struct {
+	b []byte
+	n int // number of bits
+}
+
+func (w *bitWriter) write(v uint, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.b[w.n/8] |= 0x80 >> uint(w.n%8)
+		}
+		w.n++
+	}
+}
+
+// Encode encodes text as a QR code of level l, in the smallest version that
+// holds it. Text of digits is coded in numeric mode, text of upper case
+// letters, digits and " $%*+-./:" in alphanumeric mode and other text in
+// byte mode, which readers usually take for UTF-8.
+func Encode(text string, l Level) (*Code, error) {
+	if l < L || l > H {
+		return nil, FormatError("invalid level")
+	}
+	md := mode(text)
+	v := MinVersion
+	for ; v <= MaxVersion; v++ {
+		if 4+countBits(md, v)+dataBits(md, len(text)) <= dataCodewords(v, l)*8 {
+			break
+		}
+	}
+	if v > MaxVersion {
+		return nil, FormatError("text too long")
+	}
+
+	var w bitWriter
+	w.write(uint(md), 4)
+	w.write(uint(len(text)), countBits(md, v))
+	switch md {
+	case modeNumeric:
+		for i := 0; i < len(text); i += 3 {
+			n := len(text) - i
+			if n > 3 {
+				n = 3
+			}
+			d := 0
+			for _, c := range text[i : i+n] {
+				d = d*10 + int(c-'0')
+			}
+			w.write(uint(d), 3*n+1)
+		}
+	case modeAlnum:
+		for i := 0; i < len(text); i += 2 {
+			d := strings.IndexByte(alnumChars, text[i])
+			if i+1 < len(text) {
+				w.write(uint(d*45+strings.IndexByte(alnumChars, text[i+1])), 11)
+			} else {
+				w.write(uint(d), 6)
+			}
+		}
+	default:
+		for i := 0; i < len(text); i++ {
+			w.write(uint(text[i]), 8)
+		}
+	}
+	capacity := dataCodewords(v, l) * 8
+	t := capacity - w.n
+	if t > 4 {
+		t = 4
+	}
+	w.write(0, t)
+	w.write(0, (8-w.n%8)%8)
+	for pad := uint(0xec); w.n < capacity; pad ^= 0xec ^ 0x11 {
+		w.write(pad, 8)
+	}
+
+	c := newCode(v, l)
+	c.place(interleave(w.b, v, l))
+	best := -1
+	for k := 0; k < 8; k++ {
+		c.applyMask(k)
+		c.drawFormat(k)
+		if p := c.penalty(); best < 0 || p < best {
+			best, c.Mask = p, k
+		}
+		c.applyMask(k)
+	}
+	c.applyMask(c.Mask)
+	c.drawFormat(c.Mask)
+	c.function = nil
+	return c, nil
+}
+
+// interleave appends error correction codewords to the data codewords of
+// each block and interleaves the blocks.
+func interleave(data []byte, v int, l Level) []byte {
+	nb, short, shortLen, ecc := blockSizes(v, l)
+	div := rsDivisor(ecc)
+	blocks := make([][]byte, nb)
+	for i, k := 0, 0; i < nb; i++ {
+		n := shortLen - ecc
+		if i >= short {
+			n++
+		}
+		dat := data[k : k+n]
+		k += n
+		blocks[i] = append(append([]byte(nil), dat...), rsRemainder(dat, div)...)
+	}
+	res := make([]byte, 0, rawModules(v)/8)
+	blockOrder(v, l, func(j, k int) {
+		res = append(res, blocks[j][k])
+	})
+	return res
+}
+
+// blockSizes returns the number of blocks of a code, how many of them are
+// short, the length of short blocks and the number of error correction
+// codewords of each block. Long blocks have one more data codeword.
+func blockSizes(v int, l Level) (nb, short, shortLen, ecc int) {
+	nb = numBlocks[l][v]
+	raw := rawModules(v) / 8
+	return nb, nb - raw%nb, raw / nb, eccPerBlock[l][v]
+}
+
+// blockOrder calls f with the block and the index in it of each codeword of
+// a code, in the order the codewords are placed: the data codewords of all
+// blocks interleaved, then their error correction codewords.
+func blockOrder(v int, l Level, f func(j, k int)) {
+	nb, short, shortLen, ecc := blockSizes(v, l)
+	for i := 0; i <= shortLen; i++ {
+		for j := 0; j < nb; j++ {
+			switch {
+			case j >= short:
+				f(j, i)
+			case i < shortLen-ecc:
+				f(j, i)
+			case i > shortLen-ecc:
+				// Short blocks lack the last data codeword.
+				f(j, i-1)
+			}
+		}
+	}
+}
+
+// gfMul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ z>>7*0x1d
+		z ^= (y >> uint(i) & 1) * x
+	}
+	return z
+}
+
+// rsDivisor returns the generator polynomial of degree n of Reed-Solomon
+// codes, without its leading coefficient, highest powers first.
+func rsDivisor(n int) []byte {
+	res := make([]byte, n)
+	res[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range res {
+			res[j] = gfMul(res[j], root)
+			if j+1 < n {
+				res[j] ^= res[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return res
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, div []byte) []byte {
+	res := make([]byte, len(div))
+	for _, b := range data {
+		f := b ^ res[0]
+		copy(res, res[1:])
+		res[len(res)-1] = 0
+		for i, c := range div {
+			res[i] ^= gfMul(c, f)
+		}
+	}
+	return res
+}
+
+// newCode returns a code of version v with its function patterns drawn.
+func newCode(v int, l Level) *Code {
+	n := size(v)
+	c := &Code{Version: v, Level: l, Size: n, bits: make([]bool, n*n), function: make([]bool, n*n)}
+	for i := 0; i < n; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(n-4, 3)
+	c.drawFinder(3, n-4)
+	pos := alignment(v)
+	for i, x := range pos {
+		for j, y := range pos {
+			// Skip the corners with finder patterns.
+			if i == 0 && j == 0 || i == 0 && j == len(pos)-1 || i == len(pos)-1 && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// Reserve the format information, drawn later.
+	c.drawFormat(0)
+	if v >= 7 {
+		vi := versionInfo(v)
+		for i := 0; i < 18; i++ {
+			a, b := n-11+i%3, i/3
+			c.setFunction(a, b, vi>>uint(i)&1 != 0)
+			c.setFunction(b, a, vi>>uint(i)&1 != 0)
+		}
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// setFunction sets a module of a function pattern.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.bits[y*c.Size+x] = dark
+	c.function[y*c.Size+x] = true
+}
+
+// drawFinder draws a finder pattern and its separator centered at (x, y).
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format information and the dark
+// module.
+func (c *Code) drawFormat(mask int) {
+	f := formatInfo(c.Level, mask)
+	for i := 0; i < 15; i++ {
+		x1, y1, x2, y2 := formatPos(i, c.Size)
+		c.setFunction(x1, y1, f>>uint(i)&1 != 0)
+		c.setFunction(x2, y2, f>>uint(i)&1 != 0)
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// dataModules calls f for the modules outside function patterns, in the
+// zigzag order of codeword bits.
+func (c *Code) dataModules(f func(x, y int)) {
+	n := c.Size
+	for right := n - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < n; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = n - 1 - vert
+				}
+				if !c.function[y*n+x] {
+					f(x, y)
+				}
+			}
+		}
+	}
+}
+
+// place places the codewords, leaving the remainder bits light.
+func (c *Code) place(data []byte) {
+	i := 0
+	c.dataModules(func(x, y int) {
+		if i < len(data)*8 {
+			c.bits[y*c.Size+x] = data[i>>3]>>uint(7-i&7)&1 != 0
+			i++
+		}
+	})
+}
+
+// applyMask inverts the modules outside function patterns where mask
+// pattern k says so. Applying it twice undoes it.
+func (c *Code) applyMask(k int) {
+	n := c.Size
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if !c.function[y*n+x] && maskBit(k, x, y) {
+				c.bits[y*n+x] = !c.bits[y*n+x]
+			}
+		}
+	}
+}
+
+// penalty scores the look of the code: long runs, blocks, patterns like
+// the finder ones and an unbalanced share of dark modules cost.
+func (c *Code) penalty() int {
+	n := c.Size
+	p := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			x, y = y, x
+		}
+		return c.bits[y*n+x]
+	}
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			run := 0
+			for x := 0; x < n; x++ {
+				if x > 0 && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					p += 3
+				} else if run > 5 {
+					p++
+				}
+			}
+			// 1:1:3:1:1 dark patterns with 4 light modules on one side.
+			for x := 0; x+11 <= n; x++ {
+				var v int
+				for i := 0; i < 11; i++ {
+					v <<= 1
+					if at(x+i, y, vertical) {
+						v |= 1
+					}
+				}
+				if v == 0x5d0 || v == 0x05d {
+					p += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			b := c.bits[y*n+x]
+			if b {
+				dark++
+			}
+			if x+1 < n && y+1 < n && b == c.bits[y*n+x+1] && b == c.bits[(y+1)*n+x] && b == c.bits[(y+1)*n+x+1] {
+				p += 3
+			}
+		}
+	}
+	return p + abs(dark*20-n*n*10)/(n*n)*10
+}
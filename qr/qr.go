@@ -0,0 +1,247 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qr implements a QR code generator rendering codes straight into
+// bilevel images, and a decoder reading them back from scans.
+//
+// Codes of all 40 versions and 4 error correction levels are generated, in
+// numeric, alphanumeric or byte mode. A code is a square of modules, which
+// are rendered as blocks of pixels surrounded by a quiet zone. Rows of
+// pixels are built once per row of modules and copied, so rendering stays
+// cheap at large scales.
+//
+// The decoder finds the finder patterns on runs of pixels and samples the
+// modules from the bits. It reads the modes the generator writes and skips
+// ECI and structured append headers; kanji mode is not supported.
+//
+// The format is specified by ISO/IEC 18004.
+package qr
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+)
+
+// A FormatError reports that the data can not be coded or that the image
+// holds no readable code.
+type FormatError string
+
+func (e FormatError) Error() string { return "qr: invalid format: " + string(e) }
+
+// Level is an error correction level: the share of codewords that can be
+// restored is about 7% for L, 15% for M, 25% for Q and 30% for H.
+type Level int
+
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+// formatBits returns the bits coding the level in format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// Version limits.
+const (
+	MinVersion = 1
+	MaxVersion = 40
+)
+
+// eccPerBlock is the number of error correction codewords of each block,
+// by level and version.
+var eccPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// numBlocks is the number of error correction blocks, by level and
+// version.
+var numBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// size returns the number of modules of a side of a code of version v.
+func size(v int) int { return 17 + 4*v }
+
+// rawModules returns the number of modules of a code of version v that
+// hold codewords, with the remainder bits.
+func rawModules(v int) int {
+	n := (16*v+128)*v + 64
+	if v >= 2 {
+		na := v/7 + 2
+		n -= (25*na-10)*na - 55
+		if v >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// dataCodewords returns the number of data codewords of a code.
+func dataCodewords(v int, l Level) int {
+	return rawModules(v)/8 - eccPerBlock[l][v]*numBlocks[l][v]
+}
+
+// alignment returns the coordinates of the centers of the alignment
+// patterns of a code of version v, both horizontally and vertically.
+func alignment(v int) []int {
+	if v == 1 {
+		return nil
+	}
+	na := v/7 + 2
+	step := (v*8 + na*3 + 5) / (na*4 - 4) * 2
+	pos := make([]int, na)
+	pos[0] = 6
+	for i, p := na-1, size(v)-7; i > 0; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// formatInfo returns the 15 bits of format information.
+func formatInfo(l Level, mask int) int {
+	data := l.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// formatPos returns the positions of bit i of both copies of the format
+// information in a code of size n.
+func formatPos(i, n int) (x1, y1, x2, y2 int) {
+	switch {
+	case i < 6:
+		x1, y1 = 8, i
+	case i < 8:
+		x1, y1 = 8, i+1
+	case i == 8:
+		x1, y1 = 7, 8
+	default:
+		x1, y1 = 14-i, 8
+	}
+	if i < 8 {
+		x2, y2 = n-1-i, 8
+	} else {
+		x2, y2 = 8, n-15+i
+	}
+	return
+}
+
+// versionInfo returns the 18 bits of version information of versions 7 and
+// up.
+func versionInfo(v int) int {
+	rem := v
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return v<<12 | rem
+}
+
+// maskBit reports whether mask pattern k inverts the module at (x, y).
+func maskBit(k, x, y int) bool {
+	switch k {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	}
+	return ((x+y)%2+x*y%3)%2 == 0
+}
+
+// A Code is a QR code symbol.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+	Size    int    // modules per side
+	bits    []bool // modules row by row, true for dark
+
+	function []bool // function pattern modules, while encoding
+}
+
+// Black reports whether the module at (x, y) is dark. Modules outside the
+// code are light.
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.bits[y*c.Size+x]
+}
+
+// Image renders the code with modules of scale×scale pixels surrounded by
+// a quiet zone of quiet modules. The specification asks for a quiet zone of
+// 4 modules. The image palette is {white, black}.
+func (c *Code) Image(scale, quiet int) *img1b.Image {
+	return Render(c.Size, c.Black, scale, quiet)
+}
+
+// Render renders a size×size matrix of modules, dark where black reports
+// so, as Code.Image does. It serves codes from other generators.
+func Render(size int, black func(x, y int) bool, scale, quiet int) *img1b.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	if quiet < 0 {
+		quiet = 0
+	}
+	side := (size + 2*quiet) * scale
+	m := img1b.New(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < size; y++ {
+		y0 := (y + quiet) * scale
+		row := m.Pix[y0*m.Stride : (y0+1)*m.Stride]
+		for x := 0; x < size; {
+			if !black(x, y) {
+				x++
+				continue
+			}
+			x1 := x + 1
+			for x1 < size && black(x1, y) {
+				x1++
+			}
+			setBits(row, (x+quiet)*scale, (x1+quiet)*scale)
+			x = x1
+		}
+		for j := 1; j < scale; j++ {
+			copy(m.Pix[(y0+j)*m.Stride:], row)
+		}
+	}
+	return m
+}
+
+// setBits sets bits [x0, x1) of row.
+func setBits(row []byte, x0, x1 int) {
+	i0, i1 := x0/8, (x1-1)/8
+	m0 := byte(0xff) >> uint(x0%8)
+	m1 := byte(0xff) << uint(7-(x1-1)%8)
+	if i0 == i1 {
+		row[i0] |= m0 & m1
+		return
+	}
+	row[i0] |= m0
+	for i := i0 + 1; i < i1; i++ {
+		row[i] = 0xff
+	}
+	row[i1] |= m1
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestTables(t *testing.T) {
+	// Well known data capacities in bytes.
+	for _, tt := range []struct {
+		v    int
+		l    Level
+		want int
+	}{
+		{1, L, 19}, {1, M, 16}, {1, Q, 13}, {1, H, 9},
+		{10, M, 216}, {40, L, 2956}, {40, M, 2334}, {40, Q, 1666}, {40, H, 1276},
+	} {
+		if got := dataCodewords(tt.v, tt.l); got != tt.want {
+			t.Errorf("version %d level %d: %d data codewords, want %d", tt.v, tt.l, got, tt.want)
+		}
+	}
+	if got := alignment(7); len(got) != 3 || got[1] != 22 || got[2] != 38 {
+		t.Errorf("version 7 alignment %v", got)
+	}
+	if got := alignment(32); got[1] != 34 || got[2] != 60 {
+		t.Errorf("version 32 alignment %v", got)
+	}
+	if got := formatInfo(M, 0); got != 0x5412 {
+		t.Errorf("format M 0: %015b", got)
+	}
+	if got := formatInfo(L, 0); got != 0x77c4 {
+		t.Errorf("format L 0: %015b", got)
+	}
+	if got := versionInfo(7); got != 0x07c94 {
+		t.Errorf("version 7: %018b", got)
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD at 1-M.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text string
+		l    Level
+		v    int
+	}{
+		{"HELLO WORLD", M, 1},
+		{"01234567", M, 1},
+		{strings.Repeat("7", 41), L, 1},
+		{strings.Repeat("7", 42), L, 2},
+		{strings.Repeat("A", 25), L, 1},
+		{strings.Repeat("a", 17), L, 1},
+		{strings.Repeat("a", 18), L, 2},
+		{"https://example.com/receipt?id=12345", H, 5},
+		{strings.Repeat("x", 2953), L, 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode(tt.text, tt.l)
+		if err != nil {
+			t.Errorf("%.20q: %v", tt.text, err)
+			continue
+		}
+		if c.Version != tt.v {
+			t.Errorf("%.20q: version %d, want %d", tt.text, c.Version, tt.v)
+		}
+		n := c.Size
+		if n != 17+4*tt.v {
+			t.Errorf("%.20q: size %d", tt.text, n)
+		}
+		// Finder patterns and timing patterns.
+		for _, p := range [][2]int{{0, 0}, {n - 7, 0}, {0, n - 7}} {
+			for i := 0; i < 7; i++ {
+				if !c.Black(p[0]+i, p[1]) || !c.Black(p[0], p[1]+i) || !c.Black(p[0]+2, p[1]+2+i%3) {
+					t.Fatalf("%.20q: finder at %v broken", tt.text, p)
+				}
+			}
+			if c.Black(p[0]+1, p[1]+1) {
+				t.Fatalf("%.20q: finder at %v broken", tt.text, p)
+			}
+		}
+		for i := 8; i < n-8; i++ {
+			if c.Black(i, 6) != (i%2 == 0) || c.Black(6, i) != (i%2 == 0) {
+				t.Fatalf("%.20q: timing broken at %d", tt.text, i)
+			}
+		}
+		// Both copies of the format information.
+		var f1, f2 int
+		for i := 14; i >= 0; i-- {
+			var x1, y1, x2, y2 int
+			switch {
+			case i < 6:
+				x1, y1 = 8, i
+			case i < 8:
+				x1, y1 = 8, i+1
+			case i == 8:
+				x1, y1 = 7, 8
+			default:
+				x1, y1 = 14-i, 8
+			}
+			if i < 8 {
+				x2, y2 = n-1-i, 8
+			} else {
+				x2, y2 = 8, n-15+i
+			}
+			f1 <<= 1
+			f2 <<= 1
+			if c.Black(x1, y1) {
+				f1 |= 1
+			}
+			if c.Black(x2, y2) {
+				f2 |= 1
+			}
+		}
+		if want := formatInfo(tt.l, c.Mask); f1 != want || f2 != want {
+			t.Errorf("%.20q: format information %015b %015b, want %015b", tt.text, f1, f2, want)
+		}
+		if !c.Black(8, n-8) {
+			t.Errorf("%.20q: no dark module", tt.text)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		l    Level
+	}{
+		{strings.Repeat("x", 2954), L},
+		{strings.Repeat("7", 3058), H},
+		{"x", Level(4)},
+		{"x", Level(-1)},
+	}
+	for _, tt := range tests {
+		if _, err := Encode(tt.text, tt.l); err == nil {
+			t.Errorf("%.20q level %d: no error", tt.text, tt.l)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	c, err := Encode("HELLO WORLD", Q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const scale, quiet = 3, 4
+	m := c.Image(scale, quiet)
+	side := (c.Size + 2*quiet) * scale
+	if m.Rect.Dx() != side || m.Rect.Dy() != side {
+		t.Fatalf("bounds %v", m.Rect)
+	}
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			want := c.Black(x/scale-quiet, y/scale-quiet)
+			if (m.At(x, y) == color.Black) != want {
+				t.Fatalf("pixel (%d, %d) is not %v", x, y, want)
+			}
+		}
+	}
+	// Padding bits stay clear.
+	for y := 0; y < side; y++ {
+		if m.Pix[(y+1)*m.Stride-1]&^(0xff<<uint(8*m.Stride-side)) != 0 {
+			t.Fatalf("row %d: padding set", y)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package raw reads and writes bare packed bitmaps: rows of pixels without
+// any header, as handed over by scanner SDKs, frame buffers and many
+// devices. The geometry, bit order and polarity are given by Options.
+package raw
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// A FormatError reports that the options or the input are not valid.
+type FormatError string
+
+func (e FormatError) Error() string { return "raw: invalid format: " + string(e) }
+
+// Options describe the layout of a raw bitmap.
+type Options struct {
+	// Width and Height are the dimensions of the bitmap. Write takes them
+	// from the image and ignores these.
+	Width, Height int
+
+	// Stride is the number of bytes between the starts of adjacent rows.
+	// Zero means rows padded to a byte, (Width+7)/8. Write fills the padding
+	// with zeros.
+	Stride int
+
+	// LSBFirst stores the leftmost pixel of each byte in the least
+	// significant bit. By default it is in the most significant bit.
+	LSBFirst bool
+
+	// BlackIsZero stores black pixels as clear bits. By default set bits
+	// are black.
+	BlackIsZero bool
+}
+
+// stride returns the row stride for the given width.
+func (o *Options) stride(w int) (int, error) {
+	rowBytes := (w + 7) / 8
+	if o.Stride == 0 {
+		return rowBytes, nil
+	}
+	if o.Stride < rowBytes {
+		return 0, FormatError(fmt.Sprintf("stride %d too small for width %d", o.Stride, w))
+	}
+	return o.Stride, nil
+}
+
+// palette returns the palette of bitmaps read with o.
+func (o *Options) palette() color.Palette {
+	if o.BlackIsZero {
+		return color.Palette{color.Black, color.White}
+	}
+	return color.Palette{color.White, color.Black}
+}
+
+// Read reads a raw bitmap laid out as described by opt from r. Bits are
+// kept as they are and the polarity is expressed by the palette: {white,
+// black} by default, {black, white} with BlackIsZero. The padding after the
+// last row is not read.
+func Read(r io.Reader, opt *Options) (*img1b.Image, error) {
+	w, h := opt.Width, opt.Height
+	if w <= 0 || h <= 0 {
+		return nil, FormatError(fmt.Sprintf("invalid size: %dx%d", w, h))
+	}
+	if int64(w)*int64(h) != int64(int(int64(w)*int64(h))) {
+		return nil, FormatError("size overflow")
+	}
+	stride, err := opt.stride(w)
+	if err != nil {
+		return nil, err
+	}
+	m := img1b.New(image.Rect(0, 0, w, h), opt.palette())
+	rowBytes := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	br := bufio.NewReader(r)
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+rowBytes]
+		_, err := io.ReadFull(br, row)
+		if err == nil && y < h-1 {
+			_, err = br.Discard(stride - rowBytes)
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if opt.LSBFirst {
+			img1b.ReverseBits(row)
+		}
+		row[rowBytes-1] &= tm
+	}
+	return m, nil
+}
+
+// Write writes the image m to w as a raw bitmap laid out as described by
+// opt. The darker palette color is written as black. A nil opt writes rows
+// padded to a byte with set bits black, most significant bit first.
+func Write(w io.Writer, m *img1b.Image, opt *Options) error {
+	if opt == nil {
+		opt = &Options{}
+	}
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	stride, err := opt.stride(b.Dx())
+	if err != nil {
+		return err
+	}
+	// Clear bits are black if exactly one of the image and the output has
+	// black at index 0.
+	var xor byte
+	if (bitmap.BlackIndex(m.Palette) == 0) != opt.BlackIsZero {
+		xor = 0xff
+	}
+	rowBytes := (b.Dx() + 7) / 8
+	row := make([]byte, stride)
+	tm := bitmap.TailMask(b.Dx())
+	bw := bufio.NewWriter(w)
+	for y := 0; y < b.Dy(); y++ {
+		src := m.Pix[y*m.Stride : y*m.Stride+rowBytes]
+		for i, c := range src {
+			c ^= xor
+			if i == rowBytes-1 {
+				c &= tm
+			}
+			if opt.LSBFirst {
+				c = bits.Reverse8(c)
+			}
+			row[i] = c
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
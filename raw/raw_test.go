@@ -0,0 +1,111 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// pattern is a 10x2 image, '#' is black.
+var pattern = []string{
+	"#.#.#.#.##",
+	"##......#.",
+}
+
+func testImage(p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 10, 2), p)
+	black := uint8(0)
+	if p[1] == color.Black {
+		black = 1
+	}
+	for y, row := range pattern {
+		for x := range row {
+			if row[x] == '#' {
+				m.SetColorIndex(x, y, black)
+			} else {
+				m.SetColorIndex(x, y, 1-black)
+			}
+		}
+	}
+	return m
+}
+
+var rawTests = []struct {
+	name string
+	opt  Options
+	data string
+}{
+	{"default", Options{}, "\xaa\xc0\xc0\x80"},
+	{"stride", Options{Stride: 3}, "\xaa\xc0\x00\xc0\x80\x00"},
+	{"LSB first", Options{LSBFirst: true}, "\x55\x03\x03\x01"},
+	{"black is zero", Options{BlackIsZero: true}, "\x55\x00\x3f\x40"},
+	{"all", Options{Stride: 4, LSBFirst: true, BlackIsZero: true}, "\xaa\x00\x00\x00\xfc\x02\x00\x00"},
+}
+
+func TestWrite(t *testing.T) {
+	for _, tt := range rawTests {
+		for _, p := range []color.Palette{{color.White, color.Black}, {color.Black, color.White}} {
+			var b bytes.Buffer
+			opt := tt.opt
+			if err := Write(&b, testImage(p), &opt); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.data {
+				t.Errorf("%s: got %q, want %q", tt.name, b.String(), tt.data)
+			}
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range rawTests {
+		opt := tt.opt
+		opt.Width, opt.Height = 10, 2
+		// The padding after the last row is optional.
+		data := tt.data
+		if opt.Stride > 2 {
+			data = data[:len(data)-opt.Stride+2]
+		}
+		m, err := Read(strings.NewReader(data), &opt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for y, row := range pattern {
+			for x := range row {
+				want := color.Color(color.White)
+				if row[x] == '#' {
+					want = color.Black
+				}
+				if got := m.At(x, y); got != want {
+					t.Fatalf("%s: at (%d, %d) got %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+		if m.Pix[1]&0x3f != 0 || m.Pix[3]&0x3f != 0 {
+			t.Errorf("%s: padding bits are not clear", tt.name)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	_, err := Read(strings.NewReader("\xaa\xc0\xc0"), &Options{Width: 10, Height: 2})
+	if err == nil || !strings.Contains(err.Error(), "unexpected EOF") {
+		t.Errorf("got %v, want unexpected EOF", err)
+	}
+	_, err = Read(strings.NewReader(""), &Options{Width: 0, Height: 2})
+	if err == nil || !strings.Contains(err.Error(), "invalid size") {
+		t.Errorf("got %v, want invalid size", err)
+	}
+	err = Write(new(bytes.Buffer), testImage(color.Palette{color.White, color.Black}), &Options{Stride: 1})
+	if err == nil || !strings.Contains(err.Error(), "stride 1 too small") {
+		t.Errorf("got %v, want stride too small", err)
+	}
+}
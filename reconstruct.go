@@ -0,0 +1,188 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+)
+
+// ReconstructByDilation returns the morphological reconstruction of mask
+// from marker: the 8-connected components of the set pixels, of color
+// index 1, of mask that hold a set pixel of marker. It is the limit of
+// dilating marker again and again within mask, found with a queue of runs
+// instead, in time linear in the pixels of the components. The image has
+// the bounds and the palette of mask; marker may have any bounds, its
+// pixels outside mask are ignored. Color indices are used; the palettes are
+// not looked at.
+func ReconstructByDilation(marker, mask *Image) *Image {
+	return reconstruct(marker, mask, true)
+}
+
+// FillHoles returns a copy of m with the holes of its set pixels set: the
+// clear pixels not 4-connected to the edges of m.
+func FillHoles(m *Image) *Image {
+	c := complement(m)
+	d := reconstruct(edges(c), c, false)
+	for y := 0; y < d.Rect.Dy(); y++ {
+		row := d.Pix[y*d.Stride : y*d.Stride+(d.Rect.Dx()+7)/8]
+		for i := range row {
+			row[i] = ^row[i]
+		}
+	}
+	d.Canonicalize()
+	return d
+}
+
+// ClearBorder returns a copy of m without the 8-connected components of its
+// set pixels touching the edges of m, such as objects cut by the frame.
+func ClearBorder(m *Image) *Image {
+	b := reconstruct(edges(m), m, true)
+	d := New(m.Rect, m.Palette)
+	n := (m.Rect.Dx() + 7) / 8
+	for y := 0; y < m.Rect.Dy(); y++ {
+		row := d.Pix[y*d.Stride : y*d.Stride+n]
+		copy(row, m.Pix[y*m.Stride:])
+		brow := b.Pix[y*b.Stride:]
+		for i := range row {
+			row[i] &^= brow[i]
+		}
+	}
+	d.Canonicalize()
+	return d
+}
+
+// complement returns a copy of m with the color indices flipped.
+func complement(m *Image) *Image {
+	d := New(m.Rect, m.Palette)
+	n := (m.Rect.Dx() + 7) / 8
+	for y := 0; y < m.Rect.Dy(); y++ {
+		row := d.Pix[y*d.Stride : y*d.Stride+n]
+		copy(row, m.Pix[y*m.Stride:])
+		for i := range row {
+			row[i] = ^row[i]
+		}
+	}
+	d.Canonicalize()
+	return d
+}
+
+// edges returns an image the size of m with the pixels of its edges set.
+func edges(m *Image) *Image {
+	d := New(m.Rect, m.Palette)
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w <= 0 || h <= 0 {
+		return d
+	}
+	n := (w + 7) / 8
+	bitmap.Fill(d.Pix[:n], 0xff)
+	bitmap.Fill(d.Pix[(h-1)*d.Stride:(h-1)*d.Stride+n], 0xff)
+	for y := 0; y < h; y++ {
+		d.Pix[y*d.Stride] |= 0x80
+		d.Pix[y*d.Stride+(w-1)>>3] |= 0x80 >> uint((w-1)&7)
+	}
+	d.Canonicalize()
+	return d
+}
+
+// reconstruct is ReconstructByDilation with 8-connectivity, or 4 if not
+// eight.
+func reconstruct(marker, mask *Image, eight bool) *Image {
+	d := New(mask.Rect, mask.Palette)
+	r := marker.Rect.Intersect(mask.Rect)
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	if r.Empty() || w <= 0 || h <= 0 {
+		return d
+	}
+	rw := r.Dx()
+	tmp := make([]byte, (rw+7)/8)
+	var stack []image.Point
+	fill := func(x, y int) {
+		stack = append(stack[:0], image.Pt(x, y))
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			mrow := mask.Pix[p.Y*mask.Stride:]
+			drow := d.Pix[p.Y*d.Stride:]
+			if bitAt(drow, p.X) || !bitAt(mrow, p.X) {
+				continue
+			}
+			x0, x1 := runStart(mrow, p.X), nextChange(mrow, p.X, w, 1)
+			setBits(drow, x0, x1)
+			lo, hi := x0, x1
+			if eight {
+				if lo > 0 {
+					lo--
+				}
+				if hi < w {
+					hi++
+				}
+			}
+			for _, y := range [2]int{p.Y - 1, p.Y + 1} {
+				if y < 0 || y >= h {
+					continue
+				}
+				row := mask.Pix[y*mask.Stride:]
+				drow := d.Pix[y*d.Stride:]
+				for x := lo; x < hi; {
+					if x = nextChange(row, x, w, 0); x >= hi {
+						break
+					}
+					if !bitAt(drow, x) {
+						stack = append(stack, image.Pt(x, y))
+					}
+					x = nextChange(row, x, w, 1)
+				}
+			}
+		}
+	}
+	dx := r.Min.X - mask.Rect.Min.X
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		seeds := frameRow(marker, r.Min.X, y, rw, tmp)
+		my := y - mask.Rect.Min.Y
+		for i := 0; i < rw; {
+			if i = nextChange(seeds, i, rw, 0); i >= rw {
+				break
+			}
+			fill(dx+i, my)
+			i++
+		}
+	}
+	return d
+}
+
+// bitAt reports whether the bit of row for pixel x is set.
+func bitAt(row []byte, x int) bool {
+	return row[x>>3]&(0x80>>uint(x&7)) != 0
+}
+
+// runStart returns the first x of the run of set bits of row ending at or
+// after x, which is set.
+func runStart(row []byte, x int) int {
+	for x > 0 {
+		if x&7 == 0 && x >= 8 && row[x>>3-1] == 0xff {
+			x -= 8
+			continue
+		}
+		if !bitAt(row, x-1) {
+			break
+		}
+		x--
+	}
+	return x
+}
+
+// setBits sets the bits of row for the pixels from x0 to x1-1.
+func setBits(row []byte, x0, x1 int) {
+	for x := x0; x < x1; {
+		if x&7 == 0 && x+8 <= x1 {
+			row[x>>3] = 0xff
+			x += 8
+			continue
+		}
+		row[x>>3] |= 0x80 >> uint(x&7)
+		x++
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// slowReconstruct dilates marker within mask until it stops changing.
+func slowReconstruct(marker, mask *Image) *Image {
+	d := New(mask.Rect, mask.Palette)
+	b := mask.Rect
+	set := func(m *Image, x, y int) bool {
+		return image.Pt(x, y).In(m.Rect) && m.ColorIndexAt(x, y) == 1
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if set(marker, x, y) && set(mask, x, y) {
+				d.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if set(d, x, y) || !set(mask, x, y) {
+					continue
+				}
+				for k := 0; k < 9; k++ {
+					if set(d, x+k%3-1, y+k/3-1) {
+						d.SetColorIndex(x, y, 1)
+						changed = true
+						break
+					}
+				}
+			}
+		}
+	}
+	return d
+}
+
+func TestReconstructByDilation(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bw := color.Palette{color.White, color.Black}
+	random := func(b image.Rectangle, p float64) *Image {
+		m := New(b, bw)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if r.Float64() < p {
+					m.SetColorIndex(x, y, 1)
+				}
+			}
+		}
+		// Padding bits are not pixels.
+		for y := 0; y < b.Dy(); y++ {
+			m.Pix[y*m.Stride+m.Stride-1] |= ^bitmap.TailMask(b.Dx())
+		}
+		return m
+	}
+	for i := 0; i < 20; i++ {
+		mask := random(image.Rect(r.Intn(9)-4, r.Intn(9)-4, 20+r.Intn(40), 10+r.Intn(30)), 0.4+0.2*r.Float64())
+		marker := random(image.Rect(r.Intn(21)-10, r.Intn(21)-10, 10+r.Intn(50), 5+r.Intn(40)), 0.01)
+		got, want := ReconstructByDilation(marker, mask), slowReconstruct(marker, mask)
+		if got.Rect != want.Rect {
+			t.Fatalf("bounds %v, want %v", got.Rect, want.Rect)
+		}
+		for y := want.Rect.Min.Y; y < want.Rect.Max.Y; y++ {
+			for x := want.Rect.Min.X; x < want.Rect.Max.X; x++ {
+				if got.ColorIndexAt(x, y) != want.ColorIndexAt(x, y) {
+					t.Fatalf("case %d: pixel (%d, %d) is %d, want %d", i, x, y, got.ColorIndexAt(x, y), want.ColorIndexAt(x, y))
+				}
+			}
+		}
+		if err := got.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// picture makes an image of rows of '#' for set pixels and '.' for clear.
+func picture(rows ...string) *Image {
+	m := New(image.Rect(0, 0, len(rows[0]), len(rows)), color.Palette{color.White, color.Black})
+	for y, row := range rows {
+		for x, c := range row {
+			if c == '#' {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// art draws m as picture takes it.
+func art(p *Image) string {
+	var b strings.Builder
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			b.WriteByte(".#"[p.ColorIndexAt(x, y)])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestFillHolesClearBorder(t *testing.T) {
+	m := picture(
+		"##.........",
+		"#...####...",
+		"...#....#..",
+		"...#.##.#..",
+		"....####...",
+		"..........#",
+	)
+	if got, want := art(FillHoles(m)), art(picture(
+		"##.........",
+		"#...####...",
+		"...######..",
+		"...######..",
+		"....####...",
+		"..........#",
+	)); got != want {
+		t.Errorf("FillHoles: got\n%swant\n%s", got, want)
+	}
+	if got, want := art(ClearBorder(m)), art(picture(
+		"...........",
+		"....####...",
+		"...#....#..",
+		"...#.##.#..",
+		"....####...",
+		"...........",
+	)); got != want {
+		t.Errorf("ClearBorder: got\n%swant\n%s", got, want)
+	}
+}
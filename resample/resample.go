@@ -0,0 +1,140 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package resample connects img1b images with the scalers and transformers
+// of golang.org/x/image/draw, which work on any draw.Image but are fast on
+// the standard image types only.
+//
+// Scale converts the source to an image.Gray a byte of pixels at a time,
+// lets the scaler draw into another image.Gray and thresholds the result
+// back, so that the scaler runs on its fast path both ways:
+//
+//	resample.Scale(dst, dst.Rect, src, src.Rect, 0x8000,
+//		func(d draw.Image, dr image.Rectangle, s image.Image, sr image.Rectangle) {
+//			xdraw.CatmullRom.Scale(d, dr, s, sr, xdraw.Src, nil)
+//		})
+//
+// Bilevel wraps an img1b.Image as a draw.Image that thresholds the colors
+// set, for drawing into it directly. The package itself does not import
+// x/image.
+package resample
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Gray returns the part r of m as an image.Gray with the bounds of r
+// clipped to m, each pixel the luminance of its palette color.
+func Gray(m *img1b.Image, r image.Rectangle) *image.Gray {
+	r = r.Intersect(m.Rect)
+	g := image.NewGray(r)
+	if r.Empty() {
+		return g
+	}
+	var v [2]uint8
+	for i := range v {
+		if i < len(m.Palette) {
+			v[i] = color.GrayModel.Convert(m.Palette[i]).(color.Gray).Y
+		}
+	}
+	// The gray values of the 8 pixels of each byte.
+	var table [256][8]uint8
+	for b := range table {
+		for k := range table[b] {
+			table[b][k] = v[b>>uint(7-k)&1]
+		}
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := m.Pix[(y-m.Rect.Min.Y)*m.Stride:]
+		dst := g.Pix[(y-r.Min.Y)*g.Stride:]
+		for x := r.Min.X; x < r.Max.X; {
+			bx := x - m.Rect.Min.X
+			if bx&7 == 0 && x+8 <= r.Max.X {
+				copy(dst[x-r.Min.X:], table[src[bx>>3]][:])
+				x += 8
+				continue
+			}
+			dst[x-r.Min.X] = v[src[bx>>3]>>uint(7-bx&7)&1]
+			x++
+		}
+	}
+	return g
+}
+
+// Threshold sets the pixels of the part r of dst from the pixels of g at the
+// same points, black where their luminance, scaled to 0-0xffff, is below
+// level.
+func Threshold(dst *img1b.Image, r image.Rectangle, g *image.Gray, level uint16) {
+	r = r.Intersect(dst.Rect).Intersect(g.Rect)
+	if r.Empty() {
+		return
+	}
+	dst.Unshare()
+	black := bitmap.BlackIndex(dst.Palette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := g.Pix[g.PixOffset(r.Min.X, y):]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i, m := dst.PixOffsetFast(x, y)
+			if (uint32(src[x-r.Min.X])*0x101 < uint32(level)) == (black == 1) {
+				dst.Pix[i] |= m
+			} else {
+				dst.Pix[i] &^= m
+			}
+		}
+	}
+}
+
+// Scale draws the part sr of src into the part dr of dst with f, which is
+// typically the Scale method of an x/image/draw Scaler or the Transform
+// method of a Transformer, called with image.Gray images. The result is
+// thresholded at level as in Threshold.
+func Scale(dst *img1b.Image, dr image.Rectangle, src *img1b.Image, sr image.Rectangle, level uint16,
+	f func(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle)) {
+	g := image.NewGray(dr.Intersect(dst.Rect))
+	if g.Rect.Empty() {
+		return
+	}
+	f(g, dr, Gray(src, sr), sr)
+	Threshold(dst, g.Rect, g, level)
+}
+
+// Bilevel is a draw.Image setting the pixels of M to black where the
+// luminance of the color set, scaled to 0-0xffff, is below Level, and to
+// white elsewhere.
+type Bilevel struct {
+	M     *img1b.Image
+	Level uint16
+}
+
+func (b *Bilevel) ColorModel() color.Model { return b.M.ColorModel() }
+
+func (b *Bilevel) Bounds() image.Rectangle { return b.M.Bounds() }
+
+func (b *Bilevel) At(x, y int) color.Color { return b.M.At(x, y) }
+
+func (b *Bilevel) RGBA64At(x, y int) color.RGBA64 { return b.M.RGBA64At(x, y) }
+
+func (b *Bilevel) Set(x, y int, c color.Color) {
+	r, g, bl, _ := c.RGBA()
+	b.set(x, y, r, g, bl)
+}
+
+func (b *Bilevel) SetRGBA64(x, y int, c color.RGBA64) {
+	b.set(x, y, uint32(c.R), uint32(c.G), uint32(c.B))
+}
+
+func (b *Bilevel) set(x, y int, r, g, bl uint32) {
+	// Same coefficients as in color.GrayModel.
+	l := (19595*r + 38470*g + 7471*bl + 1<<15) >> 16
+	black := bitmap.BlackIndex(b.M.Palette)
+	if l < uint32(b.Level) {
+		b.M.SetColorIndex(x, y, black)
+	} else {
+		b.M.SetColorIndex(x, y, 1-black)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package resample
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+func randImage(r image.Rectangle, p color.Palette) *img1b.Image {
+	m := img1b.New(r, p)
+	rand.New(rand.NewSource(1)).Read(m.Pix)
+	return m
+}
+
+// nearest scales with nearest neighbor sampling, as a stand-in for the
+// x/image/draw scalers.
+func nearest(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle) {
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		sy := sr.Min.Y + (y-dr.Min.Y)*sr.Dy()/dr.Dy()
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			sx := sr.Min.X + (x-dr.Min.X)*sr.Dx()/dr.Dx()
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+}
+
+func TestGray(t *testing.T) {
+	m := randImage(image.Rect(-3, 2, 37, 12), color.Palette{color.White, color.Black})
+	for _, r := range []image.Rectangle{m.Rect, image.Rect(0, 3, 21, 9), image.Rect(-10, 0, 5, 100)} {
+		g := Gray(m, r)
+		if want := r.Intersect(m.Rect); g.Rect != want {
+			t.Fatalf("%v: bounds %v, want %v", r, g.Rect, want)
+		}
+		for y := g.Rect.Min.Y; y < g.Rect.Max.Y; y++ {
+			for x := g.Rect.Min.X; x < g.Rect.Max.X; x++ {
+				want := uint8(0xff)
+				if m.ColorIndexAt(x, y) == 1 {
+					want = 0
+				}
+				if got := g.GrayAt(x, y).Y; got != want {
+					t.Fatalf("%v: (%d, %d) is %d, want %d", r, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	for _, p := range []color.Palette{{color.White, color.Black}, {color.Black, color.White}} {
+		src := randImage(image.Rect(0, 0, 20, 10), p)
+		dst := img1b.New(image.Rect(0, 0, 60, 30), color.Palette{color.White, color.Black})
+		Scale(dst, dst.Rect, src, src.Rect, 0x8000, nearest)
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 60; x++ {
+				want := src.ColorIndexAt(x/3, y/3)
+				if p[0] == color.Black {
+					want = 1 - want
+				}
+				if got := dst.ColorIndexAt(x, y); got != want {
+					t.Fatalf("palette %v: (%d, %d) is %d, want %d", p, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestBilevel(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 16, 1))
+	for x := 0; x < 16; x++ {
+		g.Pix[x] = uint8(x * 16)
+	}
+	m := img1b.New(g.Rect, color.Palette{color.White, color.Black})
+	draw.Draw(&Bilevel{M: m, Level: 0x8000}, m.Rect, g, image.Point{}, draw.Src)
+	for x := 0; x < 16; x++ {
+		want := uint8(0)
+		if x < 8 {
+			want = 1
+		}
+		if got := m.ColorIndexAt(x, 0); got != want {
+			t.Errorf("%d: got %d, want %d", x, got, want)
+		}
+	}
+}
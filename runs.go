@@ -0,0 +1,91 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"math/bits"
+)
+
+// A Run is a horizontal span of pixels of one color index: the pixels from
+// (X0, Y) to (X1-1, Y).
+type Run struct {
+	Y, X0, X1 int
+	Index     uint8
+}
+
+// Len returns the number of pixels of the run.
+func (r Run) Len() int { return r.X1 - r.X0 }
+
+// eachPixel calls yield for each pixel of p, row by row, until it returns
+// false.
+func (p *Image) eachPixel(yield func(image.Point, uint8) bool) {
+	w := p.Rect.Dx()
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		row := p.Pix[(y-p.Rect.Min.Y)*p.Stride:]
+		for x := 0; x < w; x++ {
+			if !yield(image.Point{p.Rect.Min.X + x, y}, row[x>>3]>>uint(7-x&7)&1) {
+				return
+			}
+		}
+	}
+}
+
+// eachRow calls yield for each row of p, with the bytes of Pix it takes,
+// until it returns false.
+func (p *Image) eachRow(yield func(int, []byte) bool) {
+	n := (p.Rect.Dx() + 7) / 8
+	if p.Rect.Dx() <= 0 {
+		n = 0
+	}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		i := (y - p.Rect.Min.Y) * p.Stride
+		if !yield(y, p.Pix[i:i+n:i+n]) {
+			return
+		}
+	}
+}
+
+// eachRun calls yield for each run of p, row by row and left to right, until
+// it returns false. The runs of a row alternate in color index and cover it.
+func (p *Image) eachRun(yield func(Run) bool) {
+	w := p.Rect.Dx()
+	if w <= 0 {
+		return
+	}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		row := p.Pix[(y-p.Rect.Min.Y)*p.Stride:]
+		x0, index := 0, row[0]>>7
+		for x0 < w {
+			x1 := nextChange(row, x0, w, index)
+			if !yield(Run{Y: y, X0: p.Rect.Min.X + x0, X1: p.Rect.Min.X + x1, Index: index}) {
+				return
+			}
+			x0, index = x1, index^1
+		}
+	}
+}
+
+// nextChange returns the first x from x0 on where the row of width w is not
+// of color index, w if there is none.
+func nextChange(row []byte, x0, w int, index uint8) int {
+	var flip byte
+	if index != 0 {
+		flip = 0xff
+	}
+	i := x0 >> 3
+	b := (row[i] ^ flip) & (0xff >> uint(x0&7))
+	for b == 0 {
+		i++
+		if 8*i >= w {
+			return w
+		}
+		b = row[i] ^ flip
+	}
+	if x := 8*i + bits.LeadingZeros8(b); x < w {
+		return x
+	}
+	return w
+}
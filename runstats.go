@@ -0,0 +1,139 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"github.com/mi-v/img1b/internal/bitmap"
+	"math"
+)
+
+// RunLengths counts the runs of one color by length: element n is the
+// number of runs of n pixels. It is as long as the longest run plus one, or
+// empty if there are no runs.
+type RunLengths []int
+
+// Count returns the number of runs.
+func (l RunLengths) Count() int {
+	c := 0
+	for _, k := range l {
+		c += k
+	}
+	return c
+}
+
+// Pixels returns the number of pixels of the runs.
+func (l RunLengths) Pixels() int {
+	s := 0
+	for n, k := range l {
+		s += n * k
+	}
+	return s
+}
+
+// Mean returns the mean length of the runs, 0 if there are none.
+func (l RunLengths) Mean() float64 {
+	c := l.Count()
+	if c == 0 {
+		return 0
+	}
+	return float64(l.Pixels()) / float64(c)
+}
+
+// Percentile returns the least length that the fraction q (0 to 1) of the
+// runs are no longer than, 0 if there are no runs. The 0.5 one is the
+// median; a high one of the white runs is where the smearing threshold of
+// RLSA is usually set.
+func (l RunLengths) Percentile(q float64) int {
+	c := l.Count()
+	if c == 0 {
+		return 0
+	}
+	need := int(math.Ceil(q * float64(c)))
+	if need < 1 {
+		need = 1
+	}
+	s := 0
+	for n, k := range l {
+		s += k
+		if s >= need {
+			return n
+		}
+	}
+	return len(l) - 1
+}
+
+// Entropy returns the entropy of the lengths in bits per run: what an ideal
+// code of the lengths, knowing their distribution, would spend on a run.
+func (l RunLengths) Entropy() float64 {
+	c := float64(l.Count())
+	h := 0.0
+	for _, k := range l {
+		if k != 0 {
+			p := float64(k) / c
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// A RunHistogram is the distribution of the lengths of the black and the
+// white runs of an image, made by Image.RunHistogram.
+//
+// Text and line art have long white runs and fairly regular black ones, and
+// compress well with the run-length codes of G3 and G4. Halftones and
+// dithering have short runs of both colors, which do not: PNG or JBIG2 does
+// better with them.
+type RunHistogram struct {
+	Black, White RunLengths
+}
+
+// RunHistogram returns the distribution of the lengths of the runs of p,
+// the rows of pixels of one color. Black is the darker of the two colors of
+// the palette, as in the codecs.
+func (p *Image) RunHistogram() *RunHistogram {
+	h := &RunHistogram{}
+	black := bitmap.BlackIndex(p.Palette)
+	p.eachRun(func(r Run) bool {
+		l := &h.White
+		if r.Index == black {
+			l = &h.Black
+		}
+		n := r.Len()
+		for len(*l) <= n {
+			*l = append(*l, 0)
+		}
+		(*l)[n]++
+		return true
+	})
+	return h
+}
+
+// Bits returns an estimate of the size of the image coded as runs, in bits:
+// the entropy of each color times its number of runs. It is a bound for one-
+// dimensional run-length coding, as G3 1D is; two-dimensional codes do
+// better with rows much like the ones above them.
+func (h *RunHistogram) Bits() float64 {
+	return h.Black.Entropy()*float64(h.Black.Count()) + h.White.Entropy()*float64(h.White.Count())
+}
+
+// Ratio returns the ratio of the pixels of the image to the Bits estimated
+// for it; bilevel images take one bit per pixel packed, so it is the
+// compression to expect from run-length coding. It is 0 for an empty image
+// and +Inf for one of a single run length per color.
+func (h *RunHistogram) Ratio() float64 {
+	px := h.Black.Pixels() + h.White.Pixels()
+	if px == 0 {
+		return 0
+	}
+	return float64(px) / h.Bits()
+}
+
+// Halftoned reports whether the image looks halftoned or dithered rather
+// than like text or line art: whether most runs of both colors are at most
+// 2 pixels long. A page with a halftoned picture among text may not look
+// so; look at the picture on its own.
+func (h *RunHistogram) Halftoned() bool {
+	return h.Black.Count() > 0 && h.Black.Percentile(0.5) <= 2 && h.White.Percentile(0.5) <= 2
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRunHistogram(t *testing.T) {
+	wb := color.Palette{color.White, color.Black}
+	m := New(image.Rect(3, 1, 13, 3), wb)
+	for _, x := range []int{0, 1, 5, 6, 7, 8, 9} {
+		m.SetColorIndex(3+x, 1, 1)
+	}
+	h := m.RunHistogram()
+	if want := (RunLengths{0, 0, 1, 0, 0, 1}); !reflect.DeepEqual(h.Black, want) {
+		t.Errorf("Black: got %v, want %v", h.Black, want)
+	}
+	if want := (RunLengths{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 1}); !reflect.DeepEqual(h.White, want) {
+		t.Errorf("White: got %v, want %v", h.White, want)
+	}
+	if c, px, mean := h.White.Count(), h.White.Pixels(), h.White.Mean(); c != 2 || px != 13 || mean != 6.5 {
+		t.Errorf("White: got count %d, pixels %d, mean %v", c, px, mean)
+	}
+	if p := h.White.Percentile(0.5); p != 3 {
+		t.Errorf("White median: got %d, want 3", p)
+	}
+	if p := h.White.Percentile(1); p != 10 {
+		t.Errorf("White 100th percentile: got %d, want 10", p)
+	}
+	if e := h.Black.Entropy(); e != 1 {
+		t.Errorf("Black entropy: got %v, want 1", e)
+	}
+	if b := h.Bits(); b != 4 {
+		t.Errorf("Bits: got %v, want 4", b)
+	}
+	if r := h.Ratio(); r != 5 {
+		t.Errorf("Ratio: got %v, want 5", r)
+	}
+	if h.Halftoned() {
+		t.Error("text-like image looks halftoned")
+	}
+
+	// With the palette the other way around, the colors swap.
+	m.Palette = color.Palette{color.Black, color.White}
+	if g := m.RunHistogram(); !reflect.DeepEqual(g.Black, h.White) || !reflect.DeepEqual(g.White, h.Black) {
+		t.Errorf("inverted palette: got %v", g)
+	}
+
+	checker := New(image.Rect(0, 0, 16, 16), wb)
+	for y := 0; y < 16; y++ {
+		for x := y & 1; x < 16; x += 2 {
+			checker.SetColorIndex(x, y, 1)
+		}
+	}
+	if !checker.RunHistogram().Halftoned() {
+		t.Error("checkerboard does not look halftoned")
+	}
+
+	e := New(image.Rectangle{}, wb).RunHistogram()
+	if len(e.Black) != 0 || len(e.White) != 0 || e.Ratio() != 0 || e.White.Percentile(0.5) != 0 || e.Halftoned() {
+		t.Errorf("empty image: got %v", e)
+	}
+	if r := New(image.Rect(0, 0, 8, 8), wb).RunHistogram().Ratio(); !math.IsInf(r, 1) {
+		t.Errorf("blank image: got ratio %v, want +Inf", r)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/scanop"
+)
+
+// Despeckle removes the groups of connected black pixels of at most size
+// pixels. Diagonal neighbours are connected.
+func Despeckle(m *img1b.Image, size int) *img1b.Image {
+	d, _ := scanop.Despeckle(m, size, &pool)
+	return d
+}
+
+// RemoveBorder removes the groups of connected black pixels touching the
+// edges of m, such as the dark margins left around a page by a scanner or
+// a copier. Diagonal neighbours are connected.
+func RemoveBorder(m *img1b.Image) *img1b.Image {
+	d, _ := scanop.RemoveBorder(m, &pool)
+	return d
+}
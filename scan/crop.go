@@ -0,0 +1,92 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+)
+
+// CropOptions are the parameters of AutoCrop.
+type CropOptions struct {
+	// Noise is the size in pixels of the largest specks of noise ignored
+	// in the margins, 4 if 0. No speck is ignored if it is negative.
+	Noise int
+	// Margin is the room in pixels left around the content.
+	Margin int
+}
+
+// AutoCrop finds the content of a scanned page and returns its bounds and a
+// copy of m cropped to them. The scanner background, the groups of
+// connected black pixels touching the edges of m and spanning half of its
+// width or height, and small specks of noise are not content. The bounds
+// are empty if there is no content.
+func AutoCrop(m *img1b.Image, opt *CropOptions) (image.Rectangle, *img1b.Image) {
+	var o CropOptions
+	if opt != nil {
+		o = *opt
+	}
+	if o.Noise == 0 {
+		o.Noise = 4
+	}
+	d := scanop.BlackBits(m, &pool)
+	w, h := d.Rect.Dx(), d.Rect.Dy()
+	seen := make([]bool, w*h)
+	var comp, stack []image.Point
+	edge := func(x, y int) {
+		if seen[y*w+x] || !bitmap.Bit(d.Pix, d.Stride, d.Rect, x, y) {
+			return
+		}
+		comp, stack = scanop.Component(d, x, y, seen, comp[:0], stack)
+		var b image.Rectangle
+		for _, p := range comp {
+			b = b.Union(image.Rectangle{p, p.Add(image.Pt(1, 1))})
+		}
+		if 2*b.Dx() < w && 2*b.Dy() < h {
+			return
+		}
+		for _, p := range comp {
+			scanop.Clear(d, p.X, p.Y)
+		}
+	}
+	for x := 0; x < w; x++ {
+		edge(x, 0)
+		edge(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		edge(0, y)
+		edge(w-1, y)
+	}
+	if o.Noise > 0 {
+		d, _ = scanop.Despeckle(d, o.Noise, &pool)
+	}
+
+	var r image.Rectangle
+	for y := 0; y < h; y++ {
+		row := d.Pix[y*d.Stride : (y+1)*d.Stride]
+		for i, b := range row {
+			if b == 0 {
+				continue
+			}
+			// The leftmost and rightmost black pixels of the byte.
+			x0, x1 := 8*i, 8*i+8
+			for b&0x80 == 0 {
+				b <<= 1
+				x0++
+			}
+			for row[i]>>uint(8*i+8-x1)&1 == 0 {
+				x1--
+			}
+			r = r.Union(image.Rect(x0, y, x1, y+1))
+		}
+	}
+	if r.Empty() {
+		return image.Rectangle{}, Crop(m, image.Rectangle{})
+	}
+	r = r.Inset(-o.Margin).Add(m.Rect.Min).Intersect(m.Rect)
+	return r, Crop(m, r)
+}
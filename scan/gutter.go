@@ -0,0 +1,127 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+	"math/bits"
+)
+
+// GutterOptions are the parameters of FindGutter and SplitPages.
+type GutterOptions struct {
+	// Search is the part of the width on either side of the middle the
+	// gutter is looked for in, 0.15 if 0.
+	Search float64
+	// Dark is the share of black pixels of a column making it part of the
+	// shadow of the binding, 0.6 if 0. No shadow is looked for if it is
+	// negative.
+	Dark float64
+}
+
+// FindGutter finds the gutter of a scan of two facing pages and returns the
+// x of the column to split them at. The gutter is the dark shadow of the
+// binding, if the scan has one, made of columns that are mostly black;
+// otherwise it is the valley of the count of black pixels by column, where
+// the margins of the pages meet. The widest shadow or valley is taken, and
+// the column returned is at its middle. Pages should be deskewed first.
+func FindGutter(m *img1b.Image, opt *GutterOptions) int {
+	var o GutterOptions
+	if opt != nil {
+		o = *opt
+	}
+	if o.Search <= 0 {
+		o.Search = 0.15
+	}
+	if o.Dark == 0 {
+		o.Dark = 0.6
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w < 2 || h == 0 {
+		return m.Rect.Min.X + w/2
+	}
+	s := int(o.Search * float64(w))
+	lo, hi := w/2-s, w/2+s+1
+	if lo < 1 {
+		lo = 1
+	}
+	if hi > w {
+		hi = w
+	}
+
+	cols := columnCounts(m)
+	if o.Dark > 0 {
+		dark := int(o.Dark * float64(h))
+		if x, ok := widest(cols, lo, hi, func(c int) bool { return c >= dark }); ok {
+			return m.Rect.Min.X + x
+		}
+	}
+	least := cols[lo]
+	for _, c := range cols[lo:hi] {
+		if c < least {
+			least = c
+		}
+	}
+	// A valley is not quite empty where text or specks reach into it.
+	valley := least + h/50
+	x, _ := widest(cols, lo, hi, func(c int) bool { return c <= valley })
+	return m.Rect.Min.X + x
+}
+
+// SplitPages splits a scan of two facing pages at its gutter, found by
+// FindGutter, and returns the x of the split and copies of the pages, at
+// the origin.
+func SplitPages(m *img1b.Image, opt *GutterOptions) (x int, left, right *img1b.Image) {
+	x = FindGutter(m, opt)
+	r := m.Rect
+	return x, Crop(m, image.Rect(r.Min.X, r.Min.Y, x, r.Max.Y)), Crop(m, image.Rect(x, r.Min.Y, r.Max.X, r.Max.Y))
+}
+
+// columnCounts returns the number of black pixels of each column of m.
+func columnCounts(m *img1b.Image) []int {
+	d := scanop.BlackBits(m, &pool)
+	defer pool.Put(d)
+	w, h := d.Rect.Dx(), d.Rect.Dy()
+	cols := make([]int, w)
+	for y := 0; y < h; y++ {
+		row := d.Pix[y*d.Stride : (y+1)*d.Stride]
+		for i, b := range row {
+			for b != 0 {
+				k := bits.LeadingZeros8(b)
+				cols[8*i+k]++
+				b &^= 0x80 >> uint(k)
+			}
+		}
+	}
+	return cols
+}
+
+// widest returns the middle of the widest run of columns from lo to hi
+// whose counts are in, the one nearest the middle of the image among runs
+// as wide, and whether there is one.
+func widest(cols []int, lo, hi int, in func(int) bool) (int, bool) {
+	mid := len(cols) / 2
+	best, bestLen, bestDist := 0, 0, 0
+	for x := lo; x < hi; {
+		if !in(cols[x]) {
+			x++
+			continue
+		}
+		x0 := x
+		for x < hi && in(cols[x]) {
+			x++
+		}
+		c := (x0 + x) / 2
+		dist := c - mid
+		if dist < 0 {
+			dist = -dist
+		}
+		if x-x0 > bestLen || x-x0 == bestLen && dist < bestDist {
+			best, bestLen, bestDist = c, x-x0, dist
+		}
+	}
+	return best, bestLen > 0
+}
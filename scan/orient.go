@@ -0,0 +1,152 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+)
+
+// Orientation estimates the rotation of a page of text, counter-clockwise
+// in degrees as for Rotate, that makes its text upright: 0, 90, 180 or 270.
+//
+// The lines of text run along the direction whose projection profile, the
+// number of black pixels by row or by column, has the sharper peaks. Which
+// way is up is told by the asymmetry of Latin script, whose ascenders, and
+// capitals, are far more common than its descenders: the more black pixels
+// there are on one side of the x-height band of the lines, the densest
+// rows, that side is up. The confidence returned, 0 to 1, is that
+// asymmetry; below 0.1 or so the answer is not much better than a guess.
+// Pages should be deskewed first.
+func Orientation(m *img1b.Image) (deg int, confidence float64) {
+	s := scanop.BlackBits(m, &pool)
+	defer pool.Put(s)
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	rows, cols := make([]int, h), make([]int, w)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if bitmap.Bit(s.Pix, s.Stride, s.Rect, x, y) {
+				rows[y]++
+				cols[x]++
+			}
+		}
+	}
+	if peakiness(cols) > peakiness(rows) {
+		// Vertical lines: turned a quarter counter-clockwise, the page is
+		// upright if that is the rotation wanted and upside down otherwise.
+		// Its rows are the columns from the right.
+		for i, j := 0, len(cols)-1; i < j; i, j = i+1, j-1 {
+			cols[i], cols[j] = cols[j], cols[i]
+		}
+		a := asymmetry(cols)
+		if a < 0 {
+			return 270, -a
+		}
+		return 90, a
+	}
+	a := asymmetry(rows)
+	if a < 0 {
+		return 180, -a
+	}
+	return 0, a
+}
+
+// Upright returns a copy of m turned as Orientation tells, so that its text
+// is upright.
+func Upright(m *img1b.Image) *img1b.Image {
+	deg, _ := Orientation(m)
+	s := scanop.BlackBits(m, &pool)
+	if deg == 0 {
+		return s
+	}
+	defer pool.Put(s)
+	return turn(s, deg)
+}
+
+// peakiness measures how much a profile is concentrated in peaks: the sum
+// of its squares relative to that of an even profile of the same total.
+func peakiness(p []int) float64 {
+	var sum, sq float64
+	for _, n := range p {
+		sum += float64(n)
+		sq += float64(n) * float64(n)
+	}
+	if sum == 0 {
+		return 0
+	}
+	return sq * float64(len(p)) / (sum * sum)
+}
+
+// asymmetry returns, from -1 to 1, how many more black pixels the lines of
+// text of a page have above their x-height band than below it, given the
+// number of black pixels of each of its rows.
+func asymmetry(rows []int) float64 {
+	var above, below int
+	for y := 0; y < len(rows); {
+		if rows[y] == 0 {
+			y++
+			continue
+		}
+		// A line is a band of rows with black pixels; its x-height band is
+		// the rows from the first to the last at least half as dense as the
+		// densest.
+		y0, peak := y, 0
+		for ; y < len(rows) && rows[y] != 0; y++ {
+			if rows[y] > peak {
+				peak = rows[y]
+			}
+		}
+		top, bottom := y0, y
+		for rows[top]*2 < peak {
+			top++
+		}
+		for rows[bottom-1]*2 < peak {
+			bottom--
+		}
+		for i := y0; i < top; i++ {
+			above += rows[i]
+		}
+		for i := bottom; i < y; i++ {
+			below += rows[i]
+		}
+	}
+	if above+below == 0 {
+		return 0
+	}
+	return float64(above-below) / float64(above+below)
+}
+
+// turn returns s, an image made by scanop.BlackBits, turned counter-clockwise by
+// deg degrees, a multiple of 90.
+func turn(s *img1b.Image, deg int) *img1b.Image {
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	deg = (deg%360 + 360) % 360
+	r := image.Rect(0, 0, w, h)
+	if deg == 90 || deg == 270 {
+		r = image.Rect(0, 0, h, w)
+	}
+	d := pool.Get(r, bitmap.Palette())
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			var sx, sy int
+			switch deg {
+			case 0:
+				sx, sy = x, y
+			case 90:
+				sx, sy = w-1-y, x
+			case 180:
+				sx, sy = w-1-x, h-1-y
+			case 270:
+				sx, sy = y, h-1-x
+			}
+			if bitmap.Bit(s.Pix, s.Stride, s.Rect, sx, sy) {
+				d.Pix[y*d.Stride+x>>3] |= 0x80 >> uint(x&7)
+			}
+		}
+	}
+	return d
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+	"math"
+)
+
+// Options are the parameters of ProcessScan. The zero value applies every
+// step with its defaults.
+type Options struct {
+	// Threshold is the luminance below which pixels of images that are not
+	// bilevel turn black, 1 to 256; if 0, it is picked by Level.
+	Threshold int
+	// Dither dithers images that are not bilevel instead.
+	Dither bool
+	// KeepBorder skips the removal of black borders.
+	KeepBorder bool
+	// NoDeskew skips deskewing.
+	NoDeskew bool
+	// MinSkew is the smallest skew in degrees corrected, 0.1 if 0.
+	MinSkew float64
+	// Despeckle is the size in pixels of the largest specks removed, 4 if
+	// 0. Despeckling is skipped if it is negative.
+	Despeckle int
+}
+
+// A Report tells the corrections ProcessScan applied.
+type Report struct {
+	// Threshold is the threshold the image was made bilevel with, 0 if it
+	// was bilevel or dithered.
+	Threshold int
+	// Border is the number of black pixels of borders removed.
+	Border int
+	// Skew is the angle in degrees by which the page was rotated
+	// counter-clockwise, 0 if it was not.
+	Skew float64
+	// Specks is the number of specks removed.
+	Specks int
+}
+
+// ProcessScan cleans up a scanned page: it makes it bilevel, removes its
+// black borders, deskews it and despeckles it, in this order, so that the
+// borders do not mislead the skew estimate.
+func ProcessScan(src image.Image, opt *Options) (*img1b.Image, Report) {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.MinSkew <= 0 {
+		o.MinSkew = 0.1
+	}
+	if o.Despeckle == 0 {
+		o.Despeckle = 4
+	}
+	var r Report
+	var m *img1b.Image
+	switch s := src.(type) {
+	case *img1b.Image:
+		m = scanop.BlackBits(s, &pool)
+	default:
+		if o.Dither {
+			m = Dither(src)
+			break
+		}
+		r.Threshold = o.Threshold
+		if r.Threshold <= 0 {
+			r.Threshold = Level(src)
+		}
+		m = Threshold(src, r.Threshold)
+	}
+	// Each step makes a new image, and the one before goes back to the
+	// pool.
+	var d *img1b.Image
+	if !o.KeepBorder {
+		d, r.Border = scanop.RemoveBorder(m, &pool)
+		pool.Put(m)
+		m = d
+	}
+	if !o.NoDeskew {
+		if a := Skew(m); math.Abs(a) >= o.MinSkew {
+			d = Rotate(m, a)
+			pool.Put(m)
+			m = d
+			r.Skew = a
+		}
+	}
+	if o.Despeckle > 0 {
+		d, r.Specks = scanop.Despeckle(m, o.Despeckle, &pool)
+		pool.Put(m)
+		m = d
+	}
+	return m, r
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scan cleans up scanned document pages and finds their layout.
+//
+// Pages are made bilevel with a threshold, picked from the histogram of
+// luminance by default, or by dithering. Black borders left by the scanner
+// are removed, the page is rotated so that its lines of text are
+// horizontal and small specks of noise are erased. ProcessScan applies all
+// of these in turn; the steps are also available on their own.
+//
+// AutoCrop finds the content of a page among the scanner background and
+// noise. FindTables finds ruled tables from their lines and returns their
+// cells, which Crop copies out of the page. SplitPages splits a scan of two
+// facing pages of a book at its gutter. Orientation tells how far a page is
+// turned from upright, and Upright turns it back.
+//
+// The images made by the package are at the origin with the palette
+// {white, black}.
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+	"image/color"
+)
+
+// pool holds the images of the package, in particular the temporaries of
+// the operations and ProcessScan.
+var pool img1b.Pool
+
+// Threshold converts m to a bilevel image, black where the luminance is
+// below level (0 to 256).
+func Threshold(m image.Image, level int) *img1b.Image {
+	return scanop.Threshold(m, level, &pool)
+}
+
+// Level returns the threshold level separating the dark and the light
+// pixels of m best, by Otsu's method: the level maximizing the variance
+// between the two classes of luminance.
+func Level(m image.Image) int {
+	var hist [256]int
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			hist[color.GrayModel.Convert(m.At(x, y)).(color.Gray).Y]++
+		}
+	}
+	total := b.Dx() * b.Dy()
+	var sum float64
+	for v, n := range hist {
+		sum += float64(v * n)
+	}
+	best, bestVar := 128, -1.0
+	var n0 int
+	var sum0 float64
+	for t := 0; t < 255; t++ {
+		n0 += hist[t]
+		sum0 += float64(t * hist[t])
+		n1 := total - n0
+		if n0 == 0 || n1 == 0 {
+			continue
+		}
+		d := sum0/float64(n0) - (sum-sum0)/float64(n1)
+		if v := float64(n0) * float64(n1) * d * d; v > bestVar {
+			best, bestVar = t+1, v
+		}
+	}
+	return best
+}
+
+// Dither converts m to a bilevel image with Floyd-Steinberg error
+// diffusion.
+func Dither(m image.Image) *img1b.Image {
+	return scanop.Dither(m, &pool)
+}
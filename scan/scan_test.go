@@ -0,0 +1,396 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// isBlack reports whether the pixel at (x, y) from the top left corner of m
+// is black.
+func isBlack(m *img1b.Image, x, y int) bool {
+	return m.At(m.Rect.Min.X+x, m.Rect.Min.Y+y) == color.Black
+}
+
+// count returns the number of black pixels of m.
+func count(m *img1b.Image) int {
+	n := 0
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			if isBlack(m, x, y) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// fill makes the pixels of r black.
+func fill(m *img1b.Image, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetColorIndex(x, y, 1)
+		}
+	}
+}
+
+// page returns a page with lines of dashes, like lines of text.
+func page() *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, 400, 300), bitmap.Palette())
+	for y := 30; y < 300; y += 30 {
+		for x := 20; x < 380; x++ {
+			if x%12 < 8 {
+				fill(m, image.Rect(x, y, x+1, y+3))
+			}
+		}
+	}
+	return m
+}
+
+func TestThreshold(t *testing.T) {
+	g := image.NewGray(image.Rect(3, 4, 13, 6))
+	for i := range g.Pix {
+		g.Pix[i] = uint8(i * 13)
+	}
+	m := Threshold(g, 100)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 10; x++ {
+			want := g.GrayAt(3+x, 4+y).Y < 100
+			if isBlack(m, x, y) != want {
+				t.Errorf("pixel (%d, %d) is %v", x, y, !want)
+			}
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	// Dark ink around 60 on paper around 200.
+	g := image.NewGray(image.Rect(0, 0, 100, 10))
+	for i := range g.Pix {
+		g.Pix[i] = uint8(200 + i%7)
+		if i%10 < 3 {
+			g.Pix[i] = uint8(60 + i%11)
+		}
+	}
+	if l := Level(g); l <= 70 || l > 200 {
+		t.Errorf("level %d", l)
+	}
+}
+
+func TestDither(t *testing.T) {
+	// A flat gray dithers to about as many black pixels as its darkness.
+	g := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range g.Pix {
+		g.Pix[i] = 64
+	}
+	n := count(Dither(g))
+	if want := 64 * 64 * 191 / 255; n < want-64 || n > want+64 {
+		t.Errorf("%d black pixels, want about %d", n, want)
+	}
+}
+
+func TestDespeckle(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 20, 20), bitmap.Palette())
+	set := func(x, y int) { m.SetColorIndex(x, y, 1) }
+	// A 2 pixel speck, a diagonal 3 pixel one and a 3x3 square.
+	set(1, 1)
+	set(2, 1)
+	set(10, 1)
+	set(11, 2)
+	set(12, 3)
+	fill(m, image.Rect(10, 10, 13, 13))
+	d := Despeckle(m, 2)
+	if isBlack(d, 1, 1) || isBlack(d, 2, 1) {
+		t.Error("speck of 2 kept")
+	}
+	if !isBlack(d, 10, 1) || !isBlack(d, 12, 3) {
+		t.Error("diagonal speck of 3 removed")
+	}
+	d = Despeckle(m, 3)
+	if isBlack(d, 11, 2) {
+		t.Error("diagonal speck of 3 kept")
+	}
+	if !isBlack(d, 11, 11) {
+		t.Error("square removed")
+	}
+}
+
+func TestRemoveBorder(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 50, 40), color.Palette{color.Black, color.White})
+	// A black frame, wider on the left, with a mark touching it diagonally,
+	// and a mark inside.
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 50; x++ {
+			if x < 6 || x >= 48 || y < 2 || y >= 38 {
+				m.SetColorIndex(x, y, 0)
+			} else {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	m.SetColorIndex(6, 2, 0)
+	m.SetColorIndex(7, 3, 0)
+	for y := 15; y < 20; y++ {
+		for x := 20; x < 30; x++ {
+			m.SetColorIndex(x, y, 0)
+		}
+	}
+	d := RemoveBorder(m)
+	if n := count(d); n != 50 {
+		t.Errorf("%d black pixels left, want 50", n)
+	}
+	if !isBlack(d, 25, 17) {
+		t.Error("mark inside removed")
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	m := page()
+	for _, a := range []float64{-3, 1.5, 4} {
+		s := Rotate(m, -a)
+		if got := Skew(s); math.Abs(got-a) > 0.2 {
+			t.Errorf("skew of %g: got %g", a, got)
+		}
+		if got := Skew(Deskew(s)); math.Abs(got) > 0.2 {
+			t.Errorf("deskewed %g: skew %g", a, got)
+		}
+	}
+}
+
+func TestProcessScan(t *testing.T) {
+	// A gray scan of a skewed page, with a dark margin and specks.
+	m := Rotate(page(), -2)
+	fill(m, image.Rect(0, 0, 8, 300))
+	for i := 0; i < 10; i++ {
+		fill(m, image.Rect(392, 20+i*25, 393, 22+i*25))
+	}
+	g := image.NewGray(m.Rect)
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			g.Pix[y*g.Stride+x] = uint8(220 - x%5)
+			if isBlack(m, x, y) {
+				g.Pix[y*g.Stride+x] = uint8(40 + y%9)
+			}
+		}
+	}
+	d, r := ProcessScan(g, nil)
+	if r.Threshold <= 48 || r.Threshold > 215 {
+		t.Errorf("threshold %d", r.Threshold)
+	}
+	if r.Border < 8*300 {
+		t.Errorf("%d border pixels removed", r.Border)
+	}
+	if math.Abs(r.Skew-2) > 0.2 {
+		t.Errorf("skew %g", r.Skew)
+	}
+	if r.Specks != 10 {
+		t.Errorf("%d specks removed", r.Specks)
+	}
+	if s := Skew(d); math.Abs(s) > 0.2 {
+		t.Errorf("skew %g left", s)
+	}
+	if isBlack(d, 2, 150) {
+		t.Error("margin left")
+	}
+
+	// Bilevel input with every step turned off.
+	d, r = ProcessScan(m, &Options{KeepBorder: true, NoDeskew: true, Despeckle: -1})
+	if r != (Report{}) || count(d) != count(m) {
+		t.Errorf("steps applied: %+v", r)
+	}
+}
+
+func TestFindTables(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 500, 400), bitmap.Palette())
+	// A table of 3 rows and 4 columns with lines 2 pixels thick, the middle
+	// cells of the first row merged, and some text.
+	xs := []int{20, 120, 220, 320, 420}
+	ys := []int{30, 70, 110, 150}
+	for _, y := range ys {
+		fill(m, image.Rect(20, y, 422, y+2))
+	}
+	for i, x := range xs {
+		y0 := 30
+		if i == 2 {
+			y0 = 70
+		}
+		fill(m, image.Rect(x, y0, x+2, 152))
+	}
+	for x := 30; x < 100; x += 6 {
+		fill(m, image.Rect(x, 80, x+4, 95))
+	}
+	// A 2×1 table below with a line broken by a 1 pixel gap.
+	fill(m, image.Rect(50, 250, 250, 251))
+	fill(m, image.Rect(50, 300, 150, 301))
+	fill(m, image.Rect(151, 300, 250, 301))
+	fill(m, image.Rect(50, 350, 250, 351))
+	fill(m, image.Rect(50, 250, 51, 351))
+	fill(m, image.Rect(249, 250, 250, 351))
+	// A stray line.
+	fill(m, image.Rect(300, 300, 450, 301))
+
+	sub := m.SubImage(image.Rect(8, 10, 500, 400))
+	tables := FindTables(sub, nil)
+	if len(tables) != 2 {
+		t.Fatalf("%d tables", len(tables))
+	}
+	tb := tables[0]
+	if tb.Rows != 3 || tb.Cols != 4 || len(tb.Cells) != 11 {
+		t.Fatalf("first table %d×%d, %d cells", tb.Rows, tb.Cols, len(tb.Cells))
+	}
+	if tb.Bounds != image.Rect(20, 30, 422, 152) {
+		t.Errorf("bounds %v", tb.Bounds)
+	}
+	want := []Cell{
+		{0, 0, 1, 1, image.Rect(22, 32, 120, 70)},
+		{0, 1, 1, 2, image.Rect(122, 32, 320, 70)},
+		{0, 3, 1, 1, image.Rect(322, 32, 420, 70)},
+		{1, 0, 1, 1, image.Rect(22, 72, 120, 110)},
+	}
+	for i, c := range want {
+		if tb.Cells[i] != c {
+			t.Errorf("cell %d: %+v, want %+v", i, tb.Cells[i], c)
+		}
+	}
+	tb = tables[1]
+	if tb.Rows != 2 || tb.Cols != 1 || tb.Cells[1].Rect != image.Rect(51, 301, 249, 350) {
+		t.Errorf("second table %+v", tb)
+	}
+}
+
+func TestCrop(t *testing.T) {
+	m := img1b.New(image.Rect(-3, 2, 37, 22), color.Palette{color.Black, color.White})
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i*37 + i>>2)
+	}
+	r := image.Rect(2, 5, 31, 20)
+	d := Crop(m, r)
+	if d.Rect != image.Rect(0, 0, 29, 15) {
+		t.Fatalf("bounds %v", d.Rect)
+	}
+	for y := 0; y < 15; y++ {
+		for x := 0; x < 29; x++ {
+			if d.ColorIndexAt(x, y) != m.ColorIndexAt(r.Min.X+x, r.Min.Y+y) {
+				t.Fatalf("pixel (%d, %d) differs", x, y)
+			}
+		}
+	}
+	if d.Pix[d.Stride-1]&0x07 != 0 {
+		t.Error("padding not cleared")
+	}
+}
+
+func TestAutoCrop(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 300, 200), bitmap.Palette())
+	// Scanner background on the left and at the bottom, content touching
+	// nothing, a mark touching the top edge and specks in the margins.
+	fill(m, image.Rect(0, 0, 15, 200))
+	fill(m, image.Rect(0, 185, 300, 200))
+	fill(m, image.Rect(43, 37, 250, 41))
+	fill(m, image.Rect(60, 50, 61, 150))
+	fill(m, image.Rect(280, 0, 283, 10))
+	fill(m, image.Rect(100, 170, 102, 171))
+	fill(m, image.Rect(290, 100, 291, 102))
+
+	r, d := AutoCrop(m, nil)
+	if want := image.Rect(43, 0, 283, 150); r != want {
+		t.Errorf("bounds %v, want %v", r, want)
+	}
+	if d.Rect != image.Rect(0, 0, r.Dx(), r.Dy()) || !isBlack(d, 0, 37) || isBlack(d, 0, 36) {
+		t.Errorf("cropped copy %v wrong", d.Rect)
+	}
+	r, _ = AutoCrop(m, &CropOptions{Noise: -1, Margin: 5})
+	if want := image.Rect(38, 0, 296, 176); r != want {
+		t.Errorf("with noise and margin: bounds %v, want %v", r, want)
+	}
+	blank := img1b.New(image.Rect(0, 0, 30, 20), bitmap.Palette())
+	fill(blank, image.Rect(0, 0, 30, 3))
+	if r, d := AutoCrop(blank, nil); !r.Empty() || !d.Rect.Empty() {
+		t.Errorf("blank page: bounds %v", r)
+	}
+}
+
+func TestSplitPages(t *testing.T) {
+	// Lines of text on two pages, with a speck in the gutter.
+	spread := func(r image.Rectangle, pages ...[2]int) *img1b.Image {
+		m := img1b.New(r, bitmap.Palette())
+		for _, p := range pages {
+			for y := r.Min.Y + 10; y < r.Max.Y-10; y += 6 {
+				fill(m, image.Rect(r.Min.X+p[0], y, r.Min.X+p[1], y+3))
+			}
+		}
+		return m
+	}
+	m := spread(image.Rect(0, 0, 200, 100), [2]int{20, 90}, [2]int{110, 180})
+	fill(m, image.Rect(97, 40, 98, 41))
+	if x := FindGutter(m, nil); x != 100 {
+		t.Errorf("valley: got %d, want 100", x)
+	}
+	m = spread(image.Rect(-50, 10, 150, 110), [2]int{10, 70}, [2]int{90, 190})
+	if x := FindGutter(m, nil); x != 30 {
+		t.Errorf("off center: got %d, want 30", x)
+	}
+
+	// A binding shadow beside the middle of the valley.
+	m = spread(image.Rect(0, 0, 200, 100), [2]int{20, 90}, [2]int{110, 180})
+	fill(m, image.Rect(103, 0, 107, 100))
+	x, left, right := SplitPages(m, nil)
+	if x != 105 {
+		t.Errorf("shadow: got %d, want 105", x)
+	}
+	if left.Rect != image.Rect(0, 0, 105, 100) || right.Rect != image.Rect(0, 0, 95, 100) {
+		t.Errorf("pages %v and %v", left.Rect, right.Rect)
+	}
+	if !isBlack(left, 20, 10) || isBlack(left, 102, 50) || !isBlack(left, 104, 50) || !isBlack(right, 0, 50) || isBlack(right, 2, 50) {
+		t.Error("pages not split at the gutter")
+	}
+	if x := FindGutter(m, &GutterOptions{Dark: -1}); x != 96 {
+		t.Errorf("shadow ignored: got %d, want 96", x)
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	// Lines of made up words: letters of an x-height of 6 pixels, many with
+	// ascenders and a few with descenders.
+	r := rand.New(rand.NewSource(1))
+	m := img1b.New(image.Rect(0, 0, 240, 150), bitmap.Palette())
+	for y := 10; y+16 < 150; y += 18 {
+		for x := 8 + r.Intn(6); x+5 < 232; {
+			n := 2 + r.Intn(6)
+			for i := 0; i < n && x+5 < 232; i++ {
+				lw := 3 + r.Intn(3)
+				fill(m, image.Rect(x, y+4, x+lw, y+10))
+				switch k := r.Intn(10); {
+				case k < 4:
+					fill(m, image.Rect(x, y, x+1, y+4))
+				case k < 5:
+					fill(m, image.Rect(x+lw-1, y+10, x+lw, y+14))
+				}
+				x += lw + 1
+			}
+			x += 4
+		}
+	}
+	for _, deg := range []int{0, 90, 180, 270} {
+		p := turn(m, deg)
+		got, c := Orientation(p)
+		if want := (360 - deg) % 360; got != want || c < 0.3 {
+			t.Errorf("page turned by %d: got %d with confidence %.2f, want %d", deg, got, c, want)
+		}
+		if u := Upright(p); !reflect.DeepEqual(u.Pix, m.Pix) || u.Rect != m.Rect {
+			t.Errorf("page turned by %d: Upright did not restore it", deg)
+		}
+	}
+	if deg, c := Orientation(img1b.New(image.Rect(0, 0, 20, 20), bitmap.Palette())); deg != 0 || c != 0 {
+		t.Errorf("blank page: got %d, %v", deg, c)
+	}
+}
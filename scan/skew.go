@@ -0,0 +1,36 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/scanop"
+)
+
+// MaxSkew is the largest skew angle in degrees found by Skew.
+const MaxSkew = scanop.MaxSkew
+
+// Skew estimates the angle in degrees by which the lines of text of m are
+// rotated clockwise. It picks the angle whose projection profile, the
+// number of black pixels along each line at that angle, has the sharpest
+// peaks.
+func Skew(m *img1b.Image) float64 {
+	return scanop.Skew(m, &pool)
+}
+
+// Rotate rotates m counter-clockwise by deg degrees about its center,
+// keeping its size. Uncovered pixels are white.
+func Rotate(m *img1b.Image, deg float64) *img1b.Image {
+	return scanop.Rotate(m, deg, &pool)
+}
+
+// Deskew rotates m so that its lines of text are horizontal.
+func Deskew(m *img1b.Image) *img1b.Image {
+	a := Skew(m)
+	if a == 0 {
+		return scanop.BlackBits(m, &pool)
+	}
+	return Rotate(m, a)
+}
@@ -0,0 +1,318 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scan
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"github.com/mi-v/img1b/internal/scanop"
+	"image"
+	"sort"
+)
+
+// TableOptions are the parameters of FindTables.
+type TableOptions struct {
+	// MinLength is the length in pixels of the shortest ruling line, 40 if
+	// 0.
+	MinLength int
+	// MaxThickness is the thickness in pixels of the thickest ruling line,
+	// 8 if 0.
+	MaxThickness int
+	// Gap is the widest break in pixels bridged in a line, and the
+	// farthest lines may stop short of each other and still meet, 2 if 0.
+	Gap int
+}
+
+// A Table is a grid of ruling lines.
+type Table struct {
+	Bounds image.Rectangle
+	// Rows and Cols are the size of the grid, in cells.
+	Rows, Cols int
+	// Cells are the cells, in rows from the top left one. A cell spanning
+	// several ones of the grid, with no ruling line between them, is
+	// listed once.
+	Cells []Cell
+}
+
+// A Cell is a cell of a table.
+type Cell struct {
+	// Row and Col place the top left corner of the cell in the grid.
+	Row, Col         int
+	RowSpan, ColSpan int
+	// Rect is the inside of the cell, between the ruling lines.
+	Rect image.Rectangle
+}
+
+// A line is a ruling line.
+type line struct {
+	image.Rectangle
+	vertical bool
+}
+
+// FindTables finds the ruled tables of m, from the top. A table is a group
+// of horizontal and vertical ruling lines meeting each other, at least two
+// of each. Pages should be deskewed first.
+func FindTables(m *img1b.Image, opt *TableOptions) []Table {
+	var o TableOptions
+	if opt != nil {
+		o = *opt
+	}
+	if o.MinLength <= 0 {
+		o.MinLength = 40
+	}
+	if o.MaxThickness <= 0 {
+		o.MaxThickness = 8
+	}
+	if o.Gap <= 0 {
+		o.Gap = 2
+	}
+	s := scanop.BlackBits(m, &pool)
+	lines := append(rulings(s, false, &o), rulings(s, true, &o)...)
+
+	// Group the lines meeting each other.
+	parent := make([]int, len(lines))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i, a := range lines {
+		for j := i + 1; j < len(lines); j++ {
+			b := lines[j]
+			if a.vertical != b.vertical && a.Inset(-o.Gap).Overlaps(b.Rectangle) {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+	groups := make(map[int][]line)
+	var roots []int
+	for i, l := range lines {
+		r := find(i)
+		if groups[r] == nil {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], l)
+	}
+	var tables []Table
+	for _, r := range roots {
+		if t, ok := grid(groups[r], &o); ok {
+			t.Bounds = t.Bounds.Add(m.Rect.Min)
+			for i := range t.Cells {
+				t.Cells[i].Rect = t.Cells[i].Rect.Add(m.Rect.Min)
+			}
+			tables = append(tables, t)
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return tables[i].Bounds.Min.Y < tables[j].Bounds.Min.Y
+	})
+	return tables
+}
+
+// rulings returns the horizontal or vertical ruling lines of s, an image
+// made by scanop.BlackBits: runs of black pixels at least o.MinLength long,
+// joined with the overlapping runs of the neighbouring rows or columns.
+func rulings(s *img1b.Image, vertical bool, o *TableOptions) []line {
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	at := func(i, j int) bool { return bitmap.Bit(s.Pix, s.Stride, s.Rect, j, i) }
+	if vertical {
+		w, h = h, w
+		at = func(i, j int) bool { return bitmap.Bit(s.Pix, s.Stride, s.Rect, i, j) }
+	}
+	// The lines so far, as rectangles in (along, across) coordinates, and
+	// those the previous row added to.
+	var lines []image.Rectangle
+	var prev, cur []int
+	for i := 0; i < h; i++ {
+		cur = cur[:0]
+		for j := 0; j < w; {
+			if !at(i, j) {
+				j++
+				continue
+			}
+			// A run, bridging short gaps.
+			k := j + 1
+			for k < w {
+				if at(i, k) {
+					k++
+					continue
+				}
+				g := k
+				for g < w && g-k < o.Gap && !at(i, g) {
+					g++
+				}
+				if g == w || !at(i, g) {
+					break
+				}
+				k = g
+			}
+			if k-j >= o.MinLength {
+				r := image.Rect(j, i, k, i+1)
+				joined := -1
+				for _, li := range prev {
+					if lines[li].Min.X < k && j < lines[li].Max.X {
+						if joined < 0 {
+							lines[li] = lines[li].Union(r)
+							joined = li
+						} else {
+							// The run joins two lines.
+							lines[joined] = lines[joined].Union(lines[li])
+							lines[li] = image.Rectangle{}
+						}
+					}
+				}
+				if joined < 0 {
+					joined = len(lines)
+					lines = append(lines, r)
+				}
+				cur = append(cur, joined)
+			}
+			j = k
+		}
+		prev, cur = cur, prev
+	}
+	var res []line
+	for _, r := range lines {
+		if r.Empty() || r.Dy() > o.MaxThickness {
+			continue
+		}
+		if vertical {
+			r = image.Rect(r.Min.Y, r.Min.X, r.Max.Y, r.Max.X)
+		}
+		res = append(res, line{r, vertical})
+	}
+	return res
+}
+
+// A rule is a line of a grid, spanning the extent of the lines at its
+// place across.
+type rule struct {
+	lo, hi int
+	lines  []image.Rectangle
+}
+
+// rules returns the rules of a grid made of lines, from the top or left.
+// Lines less than gap apart across are one rule.
+func rules(lines []image.Rectangle, vertical bool, gap int) []rule {
+	across := func(r image.Rectangle) (int, int) {
+		if vertical {
+			return r.Min.X, r.Max.X
+		}
+		return r.Min.Y, r.Max.Y
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		a, _ := across(lines[i])
+		b, _ := across(lines[j])
+		return a < b
+	})
+	var res []rule
+	for _, l := range lines {
+		lo, hi := across(l)
+		if n := len(res); n > 0 && lo <= res[n-1].hi+gap {
+			if hi > res[n-1].hi {
+				res[n-1].hi = hi
+			}
+			res[n-1].lines = append(res[n-1].lines, l)
+			continue
+		}
+		res = append(res, rule{lo, hi, []image.Rectangle{l}})
+	}
+	return res
+}
+
+// covers reports whether a line of the rule runs over p along it.
+func (r *rule) covers(p int, vertical bool) bool {
+	for _, l := range r.lines {
+		lo, hi := l.Min.X, l.Max.X
+		if vertical {
+			lo, hi = l.Min.Y, l.Max.Y
+		}
+		if p >= lo && p < hi {
+			return true
+		}
+	}
+	return false
+}
+
+// grid builds the table of a group of lines.
+func grid(lines []line, o *TableOptions) (Table, bool) {
+	var hs, vs []image.Rectangle
+	var t Table
+	for _, l := range lines {
+		if l.vertical {
+			vs = append(vs, l.Rectangle)
+		} else {
+			hs = append(hs, l.Rectangle)
+		}
+		t.Bounds = t.Bounds.Union(l.Rectangle)
+	}
+	rows, cols := rules(hs, false, o.Gap), rules(vs, true, o.Gap)
+	if len(rows) < 2 || len(cols) < 2 {
+		return t, false
+	}
+	t.Rows, t.Cols = len(rows)-1, len(cols)-1
+
+	// Join the cells of the grid with no line between them.
+	parent := make([]int, t.Rows*t.Cols)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for r := 0; r < t.Rows; r++ {
+		my := (rows[r].hi + rows[r+1].lo) / 2
+		for c := 0; c < t.Cols; c++ {
+			mx := (cols[c].hi + cols[c+1].lo) / 2
+			if c+1 < t.Cols && !cols[c+1].covers(my, true) {
+				parent[find(r*t.Cols+c)] = find(r*t.Cols + c + 1)
+			}
+			if r+1 < t.Rows && !rows[r+1].covers(mx, false) {
+				parent[find(r*t.Cols+c)] = find((r+1)*t.Cols + c)
+			}
+		}
+	}
+	index := make(map[int]int)
+	for r := 0; r < t.Rows; r++ {
+		for c := 0; c < t.Cols; c++ {
+			k := find(r*t.Cols + c)
+			i, ok := index[k]
+			if !ok {
+				i = len(t.Cells)
+				index[k] = i
+				t.Cells = append(t.Cells, Cell{Row: r, Col: c})
+			}
+			cell := &t.Cells[i]
+			if n := r - cell.Row + 1; n > cell.RowSpan {
+				cell.RowSpan = n
+			}
+			if n := c - cell.Col + 1; n > cell.ColSpan {
+				cell.ColSpan = n
+			}
+		}
+	}
+	for i := range t.Cells {
+		c := &t.Cells[i]
+		c.Rect = image.Rect(cols[c.Col].hi, rows[c.Row].hi, cols[c.Col+c.ColSpan].lo, rows[c.Row+c.RowSpan].lo)
+	}
+	return t, true
+}
+
+// Crop returns a copy of the part of m within r, at the origin.
+func Crop(m *img1b.Image, r image.Rectangle) *img1b.Image {
+	r = r.Intersect(m.Rect)
+	d := pool.Get(image.Rect(0, 0, r.Dx(), r.Dy()), m.Palette)
+	img1b.Blit(d, d.Rect, m, r.Min)
+	return d
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sixel implements an encoder of images as sixel graphics, which
+// terminals such as xterm, mlterm and WezTerm display inline.
+//
+// Sixel data draws bands of six rows, one color at a time, each column of a
+// band coded by a character. The two colors of the image are defined from
+// its palette and written to color registers 0 and 1, and runs of equal
+// columns are compressed.
+//
+// The format is described in the DEC VT330/VT340 Programmer Reference
+// Manual, chapter 14.
+package sixel
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image/color"
+	"io"
+)
+
+// A FormatError reports that the image can not be encoded.
+type FormatError string
+
+func (e FormatError) Error() string { return "sixel: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// Transparent leaves out the pixels that are not black, so that the
+	// terminal background shows through.
+	Transparent bool
+}
+
+// bandHeight is the number of rows drawn by a sixel.
+const bandHeight = 6
+
+// Encode writes the image m to w as a sixel graphics sequence.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", width, height))
+	}
+
+	bw := bufio.NewWriter(w)
+	if o.Transparent {
+		bw.WriteString("\x1bP0;1q")
+	} else {
+		bw.WriteString("\x1bPq")
+	}
+	fmt.Fprintf(bw, "\"1;1;%d;%d", width, height)
+	for i := 0; i < 2; i++ {
+		var c color.Color = color.Black
+		if i < len(m.Palette) {
+			c = m.Palette[i]
+		}
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i, pct(r), pct(g), pct(b))
+	}
+
+	black := bitmap.BlackIndex(m.Palette)
+	colors := []int{1 - int(black), int(black)}
+	if o.Transparent {
+		colors = colors[1:]
+	}
+	// The sixels of the band, one per column, for set and unset bits.
+	set := make([]byte, width)
+	unset := make([]byte, width)
+	for y0 := 0; y0 < height; y0 += bandHeight {
+		for x := range set {
+			set[x], unset[x] = 0, 0
+		}
+		for j := 0; j < bandHeight && y0+j < height; j++ {
+			row := m.Pix[(y0+j)*m.Stride:]
+			for x := 0; x < width; x++ {
+				if row[x>>3]&(0x80>>uint(x&7)) != 0 {
+					set[x] |= 1 << uint(j)
+				} else {
+					unset[x] |= 1 << uint(j)
+				}
+			}
+		}
+		first := true
+		for _, c := range colors {
+			six := unset
+			if c == 1 {
+				six = set
+			}
+			n := len(six)
+			for n > 0 && six[n-1] == 0 {
+				n--
+			}
+			if n == 0 {
+				continue
+			}
+			if !first {
+				bw.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(bw, "#%d", c)
+			writeSixels(bw, six[:n])
+		}
+		if y0+bandHeight < height {
+			bw.WriteByte('-')
+		}
+	}
+	bw.WriteString("\x1b\\")
+	return bw.Flush()
+}
+
+// writeSixels writes the sixels, compressing runs longer than three.
+func writeSixels(bw *bufio.Writer, six []byte) {
+	for i := 0; i < len(six); {
+		j := i + 1
+		for j < len(six) && six[j] == six[i] {
+			j++
+		}
+		c := six[i] + '?'
+		if n := j - i; n > 3 {
+			fmt.Fprintf(bw, "!%d%c", n, c)
+		} else {
+			for ; n > 0; n-- {
+				bw.WriteByte(c)
+			}
+		}
+		i = j
+	}
+}
+
+// pct converts a color component to a percentage.
+func pct(v uint32) int {
+	return int((v*100 + 0x7fff) / 0xffff)
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sixel
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	// Some runs.
+	for i := 0; i < len(m.Pix)/3; i++ {
+		m.Pix[i] = 0
+	}
+	return m
+}
+
+// paint interprets a sixel sequence and returns the color register drawn at
+// each pixel, or -1 where nothing was drawn, and the raster attributes.
+func paint(t *testing.T, s string) (pix map[image.Point]int, width, height int) {
+	t.Helper()
+	if !strings.HasPrefix(s, "\x1bP") || !strings.HasSuffix(s, "\x1b\\") {
+		t.Fatalf("bad sequence %q", s)
+	}
+	s = s[2 : len(s)-2]
+	s = s[strings.IndexByte(s, 'q')+1:]
+	pix = make(map[image.Point]int)
+	num := func() int {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			t.Fatalf("bad number at %q", s)
+		}
+		s = s[i:]
+		return n
+	}
+	x, y, c := 0, 0, 0
+	for len(s) > 0 {
+		ch := s[0]
+		s = s[1:]
+		switch {
+		case ch == '"':
+			num()
+			s = s[1:]
+			num()
+			s = s[1:]
+			width = num()
+			s = s[1:]
+			height = num()
+		case ch == '#':
+			c = num()
+			if len(s) > 0 && s[0] == ';' {
+				for k := 0; k < 4; k++ {
+					s = s[1:]
+					num()
+				}
+			}
+		case ch == '$':
+			x = 0
+		case ch == '-':
+			x, y = 0, y+6
+		case ch == '!' || ch >= '?' && ch <= '~':
+			n := 1
+			if ch == '!' {
+				n = num()
+				ch, s = s[0], s[1:]
+			}
+			for ; n > 0; n-- {
+				for j := 0; j < 6; j++ {
+					if (ch-'?')&(1<<uint(j)) != 0 {
+						pix[image.Pt(x, y+j)] = c
+					}
+				}
+				x++
+			}
+		default:
+			t.Fatalf("unexpected %q", ch)
+		}
+	}
+	return pix, width, height
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		w, h        int
+		palette     color.Palette
+		transparent bool
+	}{
+		{16, 12, color.Palette{color.White, color.Black}, false},
+		{13, 20, color.Palette{color.Black, color.White}, false},
+		{40, 7, color.Palette{color.White, color.Black}, true},
+		{9, 9, color.Palette{color.Black, color.White}, true},
+	}
+	for i, tt := range tests {
+		m := randImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := Encode(&b, m, &Options{Transparent: tt.transparent}); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		pix, w, h := paint(t, b.String())
+		if w != tt.w || h != tt.h {
+			t.Errorf("%d: raster size %dx%d", i, w, h)
+		}
+		for y := 0; y < tt.h+6; y++ {
+			for x := 0; x < tt.w+8; x++ {
+				want := -1
+				if x < tt.w && y < tt.h {
+					want = int(m.ColorIndexAt(x, y))
+					if tt.transparent && m.At(x, y) != color.Black {
+						want = -1
+					}
+				}
+				got, ok := pix[image.Pt(x, y)]
+				if !ok {
+					got = -1
+				}
+				if got != want {
+					t.Fatalf("%d: pixel (%d, %d) is %d, want %d", i, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestColors(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 1, 1), color.Palette{color.RGBA{0xff, 0x80, 0, 0xff}, color.Black})
+	var b bytes.Buffer
+	if err := Encode(&b, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); !strings.Contains(s, "#0;2;100;50;0#1;2;0;0;0") {
+		t.Errorf("no color definitions in %q", s)
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 0, 3), color.Palette{color.White, color.Black})
+	if err := Encode(&bytes.Buffer{}, m, nil); err == nil {
+		t.Error("no error")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stream converts bilevel images row by row, so that an image
+// coming from a scanner or a decoder can be written out or measured in
+// memory bounded by a few rows rather than the page.
+//
+// A Source produces rows and a Sink consumes them; a Pipeline moves the
+// rows from one to the other through filters changing them in place. Rows
+// are packed as in img1b.Image.Pix, the leftmost pixel in the most
+// significant bit, with set bits of color index 1. A ccitt.RowReader is a
+// Source and a png.RowWriter a Sink.
+package stream
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+// A Source produces the rows of an image.
+type Source interface {
+	// Width returns the width of the rows in pixels.
+	Width() int
+	// ReadRow reads the next row into dst, which holds at least
+	// (Width()+7)/8 bytes. It returns io.EOF after the last row.
+	ReadRow(dst []byte) error
+}
+
+// A Sink consumes the rows of an image.
+type Sink interface {
+	// WriteRow writes the next row. The row is not used after the call.
+	WriteRow(row []byte) error
+	// Close finishes the image.
+	Close() error
+}
+
+// A Filter changes a row of width pixels in place.
+type Filter func(row []byte, width int)
+
+// A Pipeline moves the rows of Src through Filters, in order, into Dst.
+type Pipeline struct {
+	Src     Source
+	Filters []Filter
+	Dst     Sink
+}
+
+// Run moves all the rows and closes Dst. It returns the number of rows
+// moved.
+func (p *Pipeline) Run() (int, error) {
+	w := p.Src.Width()
+	row := make([]byte, (w+7)/8)
+	n := 0
+	for {
+		err := p.Src.ReadRow(row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		for _, f := range p.Filters {
+			f(row, w)
+		}
+		if err := p.Dst.WriteRow(row); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, p.Dst.Close()
+}
+
+// Invert is a Filter swapping the color indices.
+func Invert(row []byte, width int) {
+	for i := range row {
+		row[i] = ^row[i]
+	}
+	if width%8 != 0 {
+		row[len(row)-1] &= bitmap.TailMask(width)
+	}
+}
+
+// readerSource reads raw rows.
+type readerSource struct {
+	r     io.Reader
+	width int
+}
+
+// NewReaderSource returns a Source reading packed rows of width pixels,
+// (width+7)/8 bytes each, one after another from r, as in the raster of a
+// raw PBM file.
+func NewReaderSource(r io.Reader, width int) Source {
+	return &readerSource{r, width}
+}
+
+func (s *readerSource) Width() int { return s.width }
+
+func (s *readerSource) ReadRow(dst []byte) error {
+	_, err := io.ReadFull(s.r, dst[:(s.width+7)/8])
+	return err
+}
+
+// funcSource calls a function for rows.
+type funcSource struct {
+	width int
+	f     func(dst []byte) error
+}
+
+// NewFuncSource returns a Source calling f to read each row of width
+// pixels into dst. f returns io.EOF after the last row.
+func NewFuncSource(width int, f func(dst []byte) error) Source {
+	return &funcSource{width, f}
+}
+
+func (s *funcSource) Width() int { return s.width }
+
+func (s *funcSource) ReadRow(dst []byte) error { return s.f(dst) }
+
+// imageSource reads the rows of an image.
+type imageSource struct {
+	m *img1b.Image
+	y int
+}
+
+// NewImageSource returns a Source of the rows of m.
+func NewImageSource(m *img1b.Image) Source {
+	return &imageSource{m: m}
+}
+
+func (s *imageSource) Width() int { return s.m.Rect.Dx() }
+
+func (s *imageSource) ReadRow(dst []byte) error {
+	if s.y >= s.m.Rect.Dy() {
+		return io.EOF
+	}
+	n := (s.m.Rect.Dx() + 7) / 8
+	copy(dst[:n], s.m.Pix[s.y*s.m.Stride:])
+	s.y++
+	return nil
+}
+
+// An ImageSink collects the rows into an image, for the ends of pipelines
+// that do need one.
+type ImageSink struct {
+	// Palette is the palette of the image.
+	Palette color.Palette
+
+	width int
+	pix   []byte
+	m     *img1b.Image
+}
+
+// NewImageSink returns an ImageSink of rows of width pixels.
+func NewImageSink(width int, p color.Palette) *ImageSink {
+	return &ImageSink{Palette: p, width: width}
+}
+
+func (s *ImageSink) WriteRow(row []byte) error {
+	s.pix = append(s.pix, row[:(s.width+7)/8]...)
+	return nil
+}
+
+func (s *ImageSink) Close() error {
+	stride := (s.width + 7) / 8
+	h := 0
+	if stride > 0 {
+		h = len(s.pix) / stride
+	}
+	s.m = img1b.New(image.Rect(0, 0, s.width, h), s.Palette)
+	copy(s.m.Pix, s.pix)
+	s.pix = nil
+	return nil
+}
+
+// Image returns the image, once the sink is closed.
+func (s *ImageSink) Image() *img1b.Image { return s.m }
+
+// A Profile is a Sink counting the set bits of the rows and the columns,
+// the projection profiles of the image.
+type Profile struct {
+	// Rows holds the count of each row written.
+	Rows []int
+	// Cols holds the count of each column.
+	Cols []int
+}
+
+// NewProfile returns a Profile of rows of width pixels.
+func NewProfile(width int) *Profile {
+	return &Profile{Cols: make([]int, width)}
+}
+
+func (p *Profile) WriteRow(row []byte) error {
+	w := len(p.Cols)
+	n := 0
+	for i := 0; i < (w+7)/8; i++ {
+		b := row[i]
+		if i == w/8 {
+			b &= bitmap.TailMask(w)
+		}
+		n += bits.OnesCount8(b)
+		for b != 0 {
+			k := bits.LeadingZeros8(b)
+			p.Cols[8*i+k]++
+			b &^= 0x80 >> uint(k)
+		}
+	}
+	p.Rows = append(p.Rows, n)
+	return nil
+}
+
+func (p *Profile) Close() error { return nil }
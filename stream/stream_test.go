@@ -0,0 +1,144 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/png"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+var bw = color.Palette{color.White, color.Black}
+
+func randImage(w, h int) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), bw)
+	r := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Runs rather than noise, as on a page.
+			if (x/5+y/3)%4 == 0 || r.Intn(50) == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+func samePixels(a, b *img1b.Image) bool {
+	if a.Rect.Size() != b.Rect.Size() {
+		return false
+	}
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			if a.ColorIndexAt(a.Rect.Min.X+x, a.Rect.Min.Y+y) != b.ColorIndexAt(b.Rect.Min.X+x, b.Rect.Min.Y+y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestCCITTToPNG(t *testing.T) {
+	m := randImage(77, 31)
+	g4 := ccitt.EncodeRows(m.Pix, m.Stride, 77, 31, nil)
+	src, err := ccitt.NewRowReader(g4, 77, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dst, err := (&png.Encoder{}).NewRowWriter(&buf, 77, 31, bw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := Pipeline{Src: src, Dst: dst}
+	n, err := p.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 31 {
+		t.Errorf("%d rows, want 31", n)
+	}
+	got, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(got, m) {
+		t.Error("pixels differ")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	m := randImage(13, 9)
+	dst := NewImageSink(13, bw)
+	p := Pipeline{Src: NewImageSource(m), Filters: []Filter{Invert}, Dst: dst}
+	if _, err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	got := dst.Image()
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 13; x++ {
+			if got.ColorIndexAt(x, y) == m.ColorIndexAt(x, y) {
+				t.Fatalf("(%d, %d) not inverted", x, y)
+			}
+		}
+		if got.Pix[y*got.Stride+1]&^0xf8 != 0 {
+			t.Fatalf("row %d: padding set", y)
+		}
+	}
+}
+
+func TestReaderSource(t *testing.T) {
+	m := randImage(20, 4)
+	dst := NewImageSink(20, bw)
+	p := Pipeline{Src: NewReaderSource(bytes.NewReader(m.Pix), 20), Dst: dst}
+	if n, err := p.Run(); err != nil || n != 4 {
+		t.Fatalf("Run: %d, %v", n, err)
+	}
+	if !samePixels(dst.Image(), m) {
+		t.Error("pixels differ")
+	}
+
+	p = Pipeline{Src: NewReaderSource(bytes.NewReader(m.Pix[:5]), 20), Dst: NewImageSink(20, bw)}
+	if _, err := p.Run(); err != io.ErrUnexpectedEOF {
+		t.Errorf("partial row: %v", err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	rows := [][]byte{{0xff, 0xc0}, {0x81, 0x00}, {0x00, 0x7f}}
+	i := 0
+	src := NewFuncSource(10, func(dst []byte) error {
+		if i == len(rows) {
+			return io.EOF
+		}
+		copy(dst, rows[i])
+		i++
+		return nil
+	})
+	prof := NewProfile(10)
+	if _, err := (&Pipeline{Src: src, Dst: prof}).Run(); err != nil {
+		t.Fatal(err)
+	}
+	wantRows := []int{10, 2, 1}
+	wantCols := []int{2, 1, 1, 1, 1, 1, 1, 2, 1, 2}
+	for i, n := range wantRows {
+		if prof.Rows[i] != n {
+			t.Errorf("Rows = %v, want %v", prof.Rows, wantRows)
+			break
+		}
+	}
+	for i, n := range wantCols {
+		if prof.Cols[i] != n {
+			t.Errorf("Cols = %v, want %v", prof.Cols, wantCols)
+			break
+		}
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"math"
+	"math/bits"
+)
+
+// A grid is a working copy of the image with black pixels set, which is
+// cleared path by path while tracing.
+type grid struct {
+	w, h   int
+	stride int
+	pix    []byte
+}
+
+func newGrid(m *img1b.Image) *grid {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	g := &grid{w: w, h: h, stride: (w + 7) / 8}
+	g.pix = make([]byte, g.stride*h)
+	if w == 0 {
+		return g
+	}
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h; y++ {
+		row := g.pix[y*g.stride : (y+1)*g.stride]
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[len(row)-1] &= tm
+	}
+	return g
+}
+
+// get reports whether the pixel at (x, y) is set. Pixels outside of the
+// grid are clear.
+func (g *grid) get(x, y int) bool {
+	if x < 0 || y < 0 || x >= g.w || y >= g.h {
+		return false
+	}
+	return g.pix[y*g.stride+x>>3]&(0x80>>uint(x&7)) != 0
+}
+
+// flip inverts the pixels x0 to x1-1 of row y.
+func (g *grid) flip(y, x0, x1 int) {
+	row := g.pix[y*g.stride:]
+	for x := x0; x < x1; {
+		if x&7 == 0 && x1-x >= 8 {
+			row[x>>3] = ^row[x>>3]
+			x += 8
+			continue
+		}
+		row[x>>3] ^= 0x80 >> uint(x&7)
+		x++
+	}
+}
+
+// next finds the first set pixel at or after (x, y) in scanning order.
+func (g *grid) next(x, y int) (int, int, bool) {
+	for ; y < g.h; y, x = y+1, 0 {
+		row := g.pix[y*g.stride : (y+1)*g.stride]
+		for i := x >> 3; i < len(row); i++ {
+			b := row[i]
+			if i == x>>3 {
+				b &= 0xff >> uint(x&7)
+			}
+			if b != 0 {
+				return i<<3 + bits.LeadingZeros8(b), y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// A path is a closed boundary between black and white pixels, running
+// along pixel edges with black on its left, so outlines run counter-clockwise
+// as seen on screen.
+type path struct {
+	pts  []image.Point // pixel corners, one unit step apart
+	hole bool          // the path encloses white pixels
+	area int           // number of enclosed pixels
+}
+
+// trace decomposes the image into paths, as per section 2.1 of the potrace
+// paper. Diagonally adjacent black pixels are connected. Paths enclosing at
+// most minArea pixels are dropped.
+func trace(m *img1b.Image, minArea int) []path {
+	g := newGrid(m)
+	orig := newGrid(m)
+	var paths []path
+	x, y := 0, 0
+	for {
+		var ok bool
+		if x, y, ok = g.next(x, y); !ok {
+			return paths
+		}
+		p := g.path(x, y, !orig.get(x, y))
+		// Invert the inside of the path: every vertical edge flips the row
+		// up to the start column, so rows are flipped an even number of
+		// times outside of the path.
+		n := len(p.pts)
+		for i, a := range p.pts {
+			b := p.pts[(i+1)%n]
+			if a.X != b.X {
+				continue
+			}
+			if a.X < x {
+				g.flip(minInt(a.Y, b.Y), a.X, x)
+			} else {
+				g.flip(minInt(a.Y, b.Y), x, a.X)
+			}
+		}
+		if p.area > minArea {
+			paths = append(paths, p)
+		}
+	}
+}
+
+// path traces the path starting at the top left corner of the set pixel at
+// (x0, y0).
+func (g *grid) path(x0, y0 int, hole bool) path {
+	p := path{hole: hole}
+	x, y := x0, y0
+	dx, dy := 0, 1
+	for {
+		p.pts = append(p.pts, image.Point{x, y})
+		x, y = x+dx, y+dy
+		p.area += x * dy
+		if x == x0 && y == y0 {
+			break
+		}
+		// The pixels ahead of the corner, on the left and on the right.
+		l := g.get(x+(dx+dy-1)/2, y+(dy-dx-1)/2)
+		r := g.get(x+(dx-dy-1)/2, y+(dy+dx-1)/2)
+		switch {
+		case l && r, !l && r && !hole:
+			// Right turn, which also connects diagonal black pixels
+			// outside of holes.
+			dx, dy = -dy, dx
+		case !l:
+			dx, dy = dy, -dx
+		}
+	}
+	if p.area < 0 {
+		p.area = -p.area
+	}
+	return p
+}
+
+// A vec is a point in real coordinates.
+type vec struct{ x, y float64 }
+
+func (a vec) add(b vec) vec             { return vec{a.x + b.x, a.y + b.y} }
+func (a vec) sub(b vec) vec             { return vec{a.x - b.x, a.y - b.y} }
+func (a vec) mul(k float64) vec         { return vec{a.x * k, a.y * k} }
+func (a vec) cross(b vec) float64       { return a.x*b.y - a.y*b.x }
+func (a vec) lerp(b vec, t float64) vec { return a.add(b.sub(a).mul(t)) }
+
+func pointVec(p image.Point) vec { return vec{float64(p.X), float64(p.Y)} }
+
+// polygon approximates the path by a polygon whose edges are within tol of
+// the path, and returns the indices of its vertices in p.pts. Vertices are
+// taken from the corners of the path, greedily following the longest
+// straight subpaths, so the polygon is at most one edge longer than an
+// optimal one.
+func (p *path) polygon(tol float64) []int {
+	n := len(p.pts)
+	var corners []int
+	for i := range p.pts {
+		a, b, c := p.pts[(i+n-1)%n], p.pts[i], p.pts[(i+1)%n]
+		if b.Sub(a) != c.Sub(b) {
+			corners = append(corners, i)
+		}
+	}
+	nc := len(corners)
+	// Edges are kept short enough for the polygon to have at least three
+	// vertices.
+	maxStep := (nc - 1) / 2
+	var poly []int
+	// A straight subpath may overshoot the first corner, but then the
+	// shorter one ending there is straight too.
+	for i := 0; i < nc; {
+		poly = append(poly, corners[i])
+		i += p.straight(corners, i, maxStep, tol)
+	}
+	return poly
+}
+
+// straight returns the largest number of steps, at most maxStep, from the
+// corner i such that the edge to the target corner stays within tol of the
+// corners in between. As in potrace, a straight subpath also never runs in
+// all four directions, which keeps thin spikes from being cut off.
+func (p *path) straight(corners []int, i, maxStep int, tol float64) int {
+	nc := len(corners)
+	at := func(k int) vec { return pointVec(p.pts[corners[(i+k)%nc]]) }
+	dir := func(k int) uint {
+		d := p.pts[corners[(i+k+1)%nc]].Sub(p.pts[corners[(i+k)%nc]])
+		switch {
+		case d.X > 0:
+			return 1
+		case d.X < 0:
+			return 2
+		case d.Y > 0:
+			return 4
+		}
+		return 8
+	}
+	o := at(0)
+	base := math.Atan2(at(1).y-o.y, at(1).x-o.x)
+	angle := func(v vec) float64 {
+		a := math.Atan2(v.y, v.x) - base
+		if a > math.Pi {
+			a -= 2 * math.Pi
+		} else if a <= -math.Pi {
+			a += 2 * math.Pi
+		}
+		return a
+	}
+	// The directions of edges passing close enough to the corners so far
+	// form a cone between lo and hi.
+	lo, hi := -math.Pi, math.Pi
+	dirs := dir(0)
+	step := 1
+	for k := 2; k <= maxStep; k++ {
+		v := at(k - 1).sub(o)
+		if d := math.Hypot(v.x, v.y); d > tol {
+			a, h := angle(v), math.Asin(tol/d)
+			lo, hi = math.Max(lo, a-h), math.Min(hi, a+h)
+		}
+		if dirs |= dir(k - 1); dirs == 15 {
+			break
+		}
+		if a := angle(at(k).sub(o)); a < lo || a > hi {
+			break
+		}
+		step = k
+	}
+	return step
+}
+
+// fitLine returns the centroid and direction of the least squares line
+// through the points of the path from index i to j.
+func (p *path) fitLine(i, j int) (vec, vec) {
+	n := len(p.pts)
+	if j < i {
+		j += n
+	}
+	var c vec
+	for k := i; k <= j; k++ {
+		c = c.add(pointVec(p.pts[k%n]))
+	}
+	c = c.mul(1 / float64(j-i+1))
+	var sxx, sxy, syy float64
+	for k := i; k <= j; k++ {
+		d := pointVec(p.pts[k%n]).sub(c)
+		sxx += d.x * d.x
+		sxy += d.x * d.y
+		syy += d.y * d.y
+	}
+	// The principal eigenvector of the covariance matrix.
+	l := (sxx+syy)/2 + math.Hypot((sxx-syy)/2, sxy)
+	switch {
+	case math.Abs(sxy) > 1e-9:
+		return c, vec{l - syy, sxy}
+	case sxx >= syy:
+		return c, vec{1, 0}
+	}
+	return c, vec{0, 1}
+}
+
+// vertices returns the vertices of the polygon moved to the intersections
+// of the lines fitted to its edges, as long as they stay within half a
+// pixel of the corners they replace.
+func (p *path) vertices(poly []int) []vec {
+	n := len(poly)
+	c := make([]vec, n)
+	d := make([]vec, n)
+	for i := range poly {
+		c[i], d[i] = p.fitLine(poly[i], poly[(i+1)%n])
+	}
+	v := make([]vec, n)
+	for i := range poly {
+		v[i] = pointVec(p.pts[poly[i]])
+		j := (i + n - 1) % n
+		den := d[j].cross(d[i])
+		if math.Abs(den) < 1e-9 {
+			continue
+		}
+		x := c[j].add(d[j].mul(c[i].sub(c[j]).cross(d[i]) / den))
+		if math.Abs(x.x-v[i].x) <= 0.5 && math.Abs(x.y-v[i].y) <= 0.5 {
+			v[i] = x
+		}
+	}
+	return v
+}
+
+// A segment is a part of a smoothed outline: a corner made of two lines
+// through c[1] or a cubic Bézier curve with control points c[0] and c[1].
+// Both end at c[2].
+type segment struct {
+	corner bool
+	c      [3]vec
+}
+
+// smooth turns the polygon into an outline of curves and corners, as per
+// section 2.3 of the potrace paper. Each segment runs from the middle of an
+// edge to the middle of the next one, turning at the vertex between them
+// if it is sharper than alphaMax.
+func smooth(v []vec, alphaMax float64) []segment {
+	n := len(v)
+	s := make([]segment, n)
+	for j := range v {
+		a, b, c := v[(j+n-1)%n], v[j], v[(j+1)%n]
+		mid := c.lerp(b, 0.5)
+		alpha := 4.0 / 3
+		if den := math.Abs(c.x-a.x) + math.Abs(c.y-a.y); den != 0 {
+			dd := math.Abs(b.sub(a).cross(c.sub(a))) / den
+			alpha = 0
+			if dd > 1 {
+				alpha = (1 - 1/dd) / 0.75
+			}
+		}
+		if alpha >= alphaMax {
+			s[j] = segment{corner: true, c: [3]vec{{}, b, mid}}
+			continue
+		}
+		alpha = math.Max(0.55, math.Min(1, alpha))
+		s[j].c = [3]vec{a.lerp(b, 0.5+0.5*alpha), c.lerp(b, 0.5+0.5*alpha), mid}
+	}
+	return s
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
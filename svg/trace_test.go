@@ -0,0 +1,219 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// parse returns an image from rows of '#' (black) and '.' (white).
+func parse(rows ...string) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, len(rows[0]), len(rows)), color.Palette{color.White, color.Black})
+	for y, r := range rows {
+		for x, c := range r {
+			if c == '#' {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// shapes returns an image of discs with holes and islands, and a few lines.
+func shapes(w, h int) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x-w/3, y-h/2
+			d := dx*dx + dy*dy
+			ex, ey := x-3*w/4, y-h/3
+			if d < h*h/5 && d > h*h/20 || d < h*h/100 || ex*ex+4*ey*ey < h*h/30 || x == y/2+w/2 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// winding returns the winding number of the polygons around p.
+func winding(polys [][]vec, p vec) int {
+	n := 0
+	for _, v := range polys {
+		for i, a := range v {
+			b := v[(i+1)%len(v)]
+			c := b.sub(a).cross(p.sub(a))
+			switch {
+			case a.y <= p.y && b.y > p.y && c > 0:
+				n++
+			case a.y > p.y && b.y <= p.y && c < 0:
+				n--
+			}
+		}
+	}
+	return n
+}
+
+// polygons returns the polygons of the paths of m with holes reversed. With
+// adjust unset, vertices are left at the path corners.
+func polygons(m *img1b.Image, tol float64, adjust bool) [][]vec {
+	var polys [][]vec
+	for _, p := range trace(m, 0) {
+		poly := p.polygon(tol)
+		var v []vec
+		if adjust {
+			v = p.vertices(poly)
+		} else {
+			for _, i := range poly {
+				v = append(v, pointVec(p.pts[i]))
+			}
+		}
+		if p.hole {
+			for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+				v[i], v[j] = v[j], v[i]
+			}
+		}
+		polys = append(polys, v)
+	}
+	return polys
+}
+
+// mismatches returns the number of pixels whose centers are covered by the
+// polygons differently from their color.
+func mismatches(m *img1b.Image, polys [][]vec) int {
+	n := 0
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			in := winding(polys, vec{float64(x) + 0.5, float64(y) + 0.5}) != 0
+			if in != (m.ColorIndexAt(x, y) == 1) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		rows  []string
+		areas []int
+		holes []bool
+	}{
+		{[]string{"#"}, []int{1}, []bool{false}},
+		{[]string{
+			".....",
+			".###.",
+			".#.#.",
+			".###.",
+		}, []int{9, 1}, []bool{false, true}},
+		// Diagonal black pixels are connected, diagonal white ones are
+		// not.
+		{[]string{
+			"#..",
+			".#.",
+			"..#",
+		}, []int{3}, []bool{false}},
+		{[]string{
+			"####",
+			"#.##",
+			"##.#",
+			"####",
+		}, []int{16, 1, 1}, []bool{false, true, true}},
+		{[]string{
+			"###...",
+			"#.#.#.",
+			"###...",
+		}, []int{9, 1, 1}, []bool{false, true, false}},
+	}
+	for i, tt := range tests {
+		paths := trace(parse(tt.rows...), 0)
+		if len(paths) != len(tt.areas) {
+			t.Errorf("%d: got %d paths, want %d", i, len(paths), len(tt.areas))
+			continue
+		}
+		for j, p := range paths {
+			if p.area != tt.areas[j] || p.hole != tt.holes[j] {
+				t.Errorf("%d: path %d: got area %d, hole %v, want %d, %v", i, j, p.area, p.hole, tt.areas[j], tt.holes[j])
+			}
+		}
+	}
+}
+
+func TestMinArea(t *testing.T) {
+	m := parse(
+		"#.......",
+		"...###..",
+		"...#.#..",
+		"...###..",
+	)
+	if n := len(trace(m, 1)); n != 1 {
+		t.Errorf("got %d paths, want 1", n)
+	}
+	if n := len(trace(m, 9)); n != 0 {
+		t.Errorf("got %d paths, want 0", n)
+	}
+}
+
+func TestPolygon(t *testing.T) {
+	paths := trace(parse(
+		"......",
+		".####.",
+		".####.",
+		"......",
+	), 0)
+	poly := paths[0].polygon(1)
+	var v []image.Point
+	for _, i := range poly {
+		v = append(v, paths[0].pts[i])
+	}
+	want := []image.Point{{1, 1}, {1, 3}, {5, 3}, {5, 1}}
+	if len(v) != len(want) {
+		t.Fatalf("got %v, want %v", v, want)
+	}
+	for i := range v {
+		if v[i] != want[i] {
+			t.Fatalf("got %v, want %v", v, want)
+		}
+	}
+
+	m := shapes(120, 90)
+	// Polygons with vertices on all corners of the paths match the pixels.
+	if n := mismatches(m, polygons(m, 0.1, false)); n != 0 {
+		t.Errorf("exact polygons: %d pixels differ", n)
+	}
+	for _, tol := range []float64{0.5, 0.75, 1} {
+		polys := polygons(m, tol, true)
+		if n := mismatches(m, polys); n > m.Rect.Dx()*m.Rect.Dy()/50 {
+			t.Errorf("tolerance %v: %d pixels differ", tol, n)
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	// A square is all corners, and the ones of an octagon are rounded off.
+	square := []vec{{0, 0}, {0, 10}, {10, 10}, {10, 0}}
+	for _, s := range smooth(square, 1) {
+		if !s.corner {
+			t.Errorf("square: curve %v", s.c)
+		}
+	}
+	octagon := []vec{{0, 3}, {0, 7}, {3, 10}, {7, 10}, {10, 7}, {10, 3}, {7, 0}, {3, 0}}
+	for _, s := range smooth(octagon, 1) {
+		if s.corner {
+			t.Errorf("octagon: corner %v", s.c)
+		}
+	}
+	for _, s := range smooth(octagon, -1) {
+		if !s.corner {
+			t.Errorf("octagon with no curves: curve %v", s.c)
+		}
+	}
+	s := smooth(square, 1)
+	if s[0].c[1] != (vec{0, 0}) || s[0].c[2] != (vec{0, 5}) {
+		t.Errorf("got corner %v, want (0, 0), (0, 5)", s[0].c)
+	}
+}
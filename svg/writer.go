@@ -0,0 +1,123 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package svg implements a tracer that converts bilevel images to SVG
+// documents made of smooth outlines, in the manner of potrace.
+//
+// The boundaries between black and white pixels are traced as closed paths
+// and each path is approximated by a polygon. The polygon vertices are then
+// either kept as corners or rounded off by Bézier curves, depending on how
+// sharply the path turns there. The outlines scale without the staircase
+// look of enlarged bitmaps, which suits logos and signatures captured as
+// images.
+//
+// The algorithm follows P. Selinger, "Potrace: a polygon-based tracing
+// algorithm", 2003, with a greedy polygon approximation and without the
+// final merging of curves.
+package svg
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Options are the tracing parameters.
+type Options struct {
+	// MinArea drops the outlines, and holes, enclosing at most that many
+	// pixels, which removes speckles.
+	MinArea int
+
+	// Tolerance is the largest distance in pixels between a traced path and
+	// the edges of its polygon. Larger values give fewer and longer curves.
+	// Zero or less means 0.75, which is close to the straightness criterion
+	// of potrace.
+	Tolerance float64
+
+	// AlphaMax is the smoothness threshold of potrace: vertices are turned
+	// into corners if they are sharper than that, from 0 for all corners up
+	// to 4/3 for none. Zero means 1, a negative value keeps all corners.
+	AlphaMax float64
+}
+
+// Encode traces the black pixels of m and writes them to w as an SVG
+// document of the same size as m, with one black filled path element.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if !(o.Tolerance > 0) {
+		o.Tolerance = 0.75
+	}
+	if o.AlphaMax == 0 {
+		o.AlphaMax = 1
+	}
+
+	bw := bufio.NewWriter(w)
+	width, height := m.Rect.Dx(), m.Rect.Dy()
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"+
+		"<svg xmlns=\"http://www.w3.org/2000/svg\" version=\"1.1\" "+
+		"width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		width, height, width, height)
+	paths := trace(m, o.MinArea)
+	if len(paths) > 0 {
+		bw.WriteString("<path fill=\"black\" d=\"")
+		for i := range paths {
+			p := &paths[i]
+			v := p.vertices(p.polygon(o.Tolerance))
+			// Holes run the other way round, so that they are left out by
+			// the nonzero fill rule.
+			if p.hole {
+				for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+					v[i], v[j] = v[j], v[i]
+				}
+			}
+			if i > 0 {
+				bw.WriteByte('\n')
+			}
+			writePath(bw, smooth(v, o.AlphaMax))
+		}
+		bw.WriteString("\"/>\n")
+	}
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writePath writes the segments as a closed subpath of path data.
+func writePath(bw *bufio.Writer, s []segment) {
+	bw.WriteString("M")
+	writeVec(bw, s[len(s)-1].c[2])
+	for _, g := range s {
+		if g.corner {
+			bw.WriteString("L")
+			writeVec(bw, g.c[1])
+			bw.WriteString(" ")
+			writeVec(bw, g.c[2])
+			continue
+		}
+		bw.WriteString("C")
+		writeVec(bw, g.c[0])
+		bw.WriteString(" ")
+		writeVec(bw, g.c[1])
+		bw.WriteString(" ")
+		writeVec(bw, g.c[2])
+	}
+	bw.WriteString("Z")
+}
+
+// writeVec writes a point with its coordinates rounded to 1/100 pixel.
+func writeVec(bw *bufio.Writer, v vec) {
+	bw.WriteString(coord(v.x))
+	bw.WriteString(",")
+	bw.WriteString(coord(v.y))
+}
+
+func coord(v float64) string {
+	// Adding zero turns -0 into 0.
+	return strconv.FormatFloat(math.Round(v*100)/100+0, 'f', -1, 64)
+}
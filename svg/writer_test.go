@@ -0,0 +1,119 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package svg
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// flatten parses the path data written by Encode and returns its subpaths
+// as polygons, with curves split in lines.
+func flatten(t *testing.T, d string) [][]vec {
+	t.Helper()
+	var polys [][]vec
+	var cur []vec
+	tok := regexp.MustCompile(`[MLCZ]|-?[0-9.]+,-?[0-9.]+`).FindAllString(d, -1)
+	var cmd string
+	var args []vec
+	for _, s := range tok {
+		if strings.IndexAny(s, "MLCZ") == 0 {
+			cmd, args = s, nil
+			if cmd == "Z" {
+				polys = append(polys, cur)
+				cur = nil
+			}
+			continue
+		}
+		xy := strings.Split(s, ",")
+		x, err1 := strconv.ParseFloat(xy[0], 64)
+		y, err2 := strconv.ParseFloat(xy[1], 64)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("bad point %q", s)
+		}
+		args = append(args, vec{x, y})
+		switch {
+		case cmd == "M" || cmd == "L":
+			cur = append(cur, args[0])
+			args = nil
+		case cmd == "C" && len(args) == 3:
+			p0 := cur[len(cur)-1]
+			for i := 1; i <= 16; i++ {
+				u := float64(i) / 16
+				a, b, c := p0.lerp(args[0], u), args[0].lerp(args[1], u), args[1].lerp(args[2], u)
+				a, b = a.lerp(b, u), b.lerp(c, u)
+				cur = append(cur, a.lerp(b, u))
+			}
+			args = nil
+		}
+	}
+	return polys
+}
+
+func encode(t *testing.T, m *img1b.Image, opt *Options) (header, d string) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := Encode(&b, m, opt); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	if !strings.HasSuffix(s, "</svg>\n") {
+		t.Fatalf("bad document %q", s)
+	}
+	if i := strings.Index(s, " d=\""); i >= 0 {
+		d = s[i+4 : strings.LastIndex(s, "\"")]
+	}
+	header = s[strings.Index(s, "<svg"):]
+	return header[:strings.Index(header, ">")], d
+}
+
+func TestEncode(t *testing.T) {
+	m := shapes(120, 90)
+	header, d := encode(t, m, nil)
+	if !strings.HasSuffix(header, `width="120" height="90" viewBox="0 0 120 90"`) {
+		t.Errorf("bad header %q", header)
+	}
+	polys := flatten(t, d)
+	if len(polys) != len(trace(m, 0)) {
+		t.Errorf("got %d subpaths, want %d", len(polys), len(trace(m, 0)))
+	}
+	if n := mismatches(m, polys); n > m.Rect.Dx()*m.Rect.Dy()/50 {
+		t.Errorf("%d pixels differ", n)
+	}
+
+	// The same shapes, white on black.
+	inv := img1b.New(m.Rect, color.Palette{color.White, color.Black})
+	for i := range inv.Pix {
+		inv.Pix[i] = ^m.Pix[i]
+	}
+	inv.Palette = color.Palette{color.Black, color.White}
+	_, d2 := encode(t, inv, nil)
+	if d2 != d {
+		t.Error("palette ignored")
+	}
+}
+
+func TestEncodeCorners(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 8, 4), color.Palette{color.White, color.Black})
+	m.SetColorIndex(2, 1, 1)
+	if _, d := encode(t, m, &Options{AlphaMax: -1}); d != "M2.5,1L2,1 2,1.5L2,2 2.5,2L3,2 3,1.5L3,1 2.5,1Z" {
+		t.Errorf("corners: got %q", d)
+	}
+	if _, d := encode(t, m, nil); strings.Contains(d, "L") {
+		t.Errorf("curves: got %q", d)
+	}
+	if _, d := encode(t, m, &Options{MinArea: 1}); d != "" {
+		t.Errorf("speckle: got %q", d)
+	}
+	if _, d := encode(t, img1b.New(image.Rect(0, 0, 0, 0), nil), nil); d != "" {
+		t.Errorf("empty image: got %q", d)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package terminal writes images as inline image escape sequences of
+// terminal emulators, the kitty graphics protocol and the iTerm2 inline
+// images protocol, which are also supported by WezTerm, Konsole and others.
+//
+// Images are sent as PNG, encoded by package png, and are displayed over a
+// block of character cells starting at the cursor. The block is sized from
+// the pixel size of a cell, so that images are shown at their size unless
+// the number of columns or rows is given.
+//
+// The protocols are described at
+// https://sw.kovidgoyal.net/kitty/graphics-protocol/ and
+// https://iterm2.com/documentation-images.html.
+package terminal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// An UnsupportedError reports that the options ask for an unknown protocol.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "terminal: unsupported feature: " + string(e) }
+
+// A Protocol is an inline image protocol.
+type Protocol int
+
+const (
+	Kitty Protocol = iota
+	ITerm2
+)
+
+// Detect guesses the protocol supported by the terminal from the
+// environment of the process, and reports whether there is one.
+func Detect() (Protocol, bool) {
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "", strings.HasSuffix(os.Getenv("TERM"), "kitty"):
+		return Kitty, true
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "mintty":
+		return ITerm2, true
+	}
+	return 0, false
+}
+
+// Options are the display parameters.
+type Options struct {
+	// Protocol is the protocol of the terminal.
+	Protocol Protocol
+
+	// Columns and Rows are the size of the block of cells the image is
+	// shown in. If one of them is zero, it is set to keep the aspect ratio
+	// of the image; if both are, the image is shown at its size.
+	Columns, Rows int
+
+	// CellWidth and CellHeight are the size of a cell in pixels. Zero
+	// values mean 10 by 20 pixels, a common size.
+	CellWidth, CellHeight int
+}
+
+// kittyChunk is the largest payload of a kitty graphics escape sequence.
+const kittyChunk = 4096
+
+// cells returns the size of the block of cells a w by h image is shown in.
+func (o *Options) cells(w, h int) (cols, rows int) {
+	cw, ch := o.CellWidth, o.CellHeight
+	if cw <= 0 {
+		cw = 10
+	}
+	if ch <= 0 {
+		ch = 20
+	}
+	cols, rows = o.Columns, o.Rows
+	switch {
+	case cols > 0 && rows > 0:
+	case cols > 0:
+		rows = (cols*cw*h + w*ch - 1) / (w * ch)
+	case rows > 0:
+		cols = (rows*ch*w + h*cw - 1) / (h * cw)
+	default:
+		cols, rows = (w+cw-1)/cw, (h+ch-1)/ch
+	}
+	return cols, rows
+}
+
+// Encode writes the image m to w as an inline image escape sequence,
+// displayed at the cursor. The cursor is left after the image.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	var o Options
+	if opt != nil {
+		o = *opt
+	}
+	if o.Protocol != Kitty && o.Protocol != ITerm2 {
+		return UnsupportedError(fmt.Sprintf("protocol %d", o.Protocol))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m); err != nil {
+		return err
+	}
+	cols, rows := o.cells(m.Rect.Dx(), m.Rect.Dy())
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	bw := bufio.NewWriter(w)
+	switch o.Protocol {
+	case Kitty:
+		// Transmit and display a PNG without replies, in chunks.
+		for i := 0; i < len(data); i += kittyChunk {
+			more := 0
+			end := i + kittyChunk
+			if end < len(data) {
+				more = 1
+			} else {
+				end = len(data)
+			}
+			if i == 0 {
+				fmt.Fprintf(bw, "\x1b_Ga=T,f=100,q=2,c=%d,r=%d,m=%d;", cols, rows, more)
+			} else {
+				fmt.Fprintf(bw, "\x1b_Gm=%d;", more)
+			}
+			bw.WriteString(data[i:end])
+			bw.WriteString("\x1b\\")
+		}
+	default:
+		fmt.Fprintf(bw, "\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=0:",
+			buf.Len(), cols, rows)
+		bw.WriteString(data)
+		bw.WriteString("\a")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package terminal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/png"
+	"image"
+	"image/color"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randImage(w, h int) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	rand.New(rand.NewSource(int64(w * h))).Read(m.Pix)
+	return m
+}
+
+// checkPNG checks that the base64 payload is a PNG of m.
+func checkPNG(t *testing.T, payload string, m *img1b.Image) {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Rect != m.Rect {
+		t.Fatalf("decoded bounds %v, want %v", d.Rect, m.Rect)
+	}
+	for y := 0; y < m.Rect.Dy(); y++ {
+		for x := 0; x < m.Rect.Dx(); x++ {
+			r0, _, _, _ := d.At(x, y).RGBA()
+			r1, _, _, _ := m.At(x, y).RGBA()
+			if r0 != r1 {
+				t.Fatalf("pixel (%d, %d) differs", x, y)
+			}
+		}
+	}
+}
+
+var kittyRE = regexp.MustCompile("^\x1b_G([^;]*);([^\x1b]*)\x1b\\\\")
+
+func TestKitty(t *testing.T) {
+	// Random pixels need a few chunks.
+	m := randImage(200, 150)
+	var b bytes.Buffer
+	if err := Encode(&b, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	var payload strings.Builder
+	n := 0
+	for len(s) > 0 {
+		sub := kittyRE.FindStringSubmatch(s)
+		if sub == nil {
+			t.Fatalf("bad sequence %q", s[:20])
+		}
+		s = s[len(sub[0]):]
+		keys := sub[1]
+		if n == 0 {
+			if !strings.HasPrefix(keys, "a=T,f=100,q=2,c=20,r=8,") {
+				t.Errorf("first chunk keys %q", keys)
+			}
+			keys = keys[strings.LastIndexByte(keys, ',')+1:]
+		}
+		more := "m=1"
+		if len(s) == 0 {
+			more = "m=0"
+		}
+		if keys != more {
+			t.Errorf("chunk %d: keys %q, want %q", n, keys, more)
+		}
+		if len(sub[2]) > kittyChunk {
+			t.Errorf("chunk %d: %d bytes", n, len(sub[2]))
+		}
+		payload.WriteString(sub[2])
+		n++
+	}
+	if n < 2 {
+		t.Errorf("%d chunks", n)
+	}
+	checkPNG(t, payload.String(), m)
+}
+
+func TestITerm2(t *testing.T) {
+	m := randImage(33, 10)
+	var b bytes.Buffer
+	if err := Encode(&b, m, &Options{Protocol: ITerm2, Columns: 8, CellWidth: 8, CellHeight: 16}); err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile("^\x1b]1337;File=inline=1;size=([0-9]+);width=8;height=2;preserveAspectRatio=0:([^\a]*)\a$")
+	sub := re.FindStringSubmatch(b.String())
+	if sub == nil {
+		t.Fatalf("bad sequence %q", b.String()[:60])
+	}
+	checkPNG(t, sub[2], m)
+	size, _ := strconv.Atoi(sub[1])
+	if data, _ := base64.StdEncoding.DecodeString(sub[2]); len(data) != size {
+		t.Errorf("size %d, want %d", size, len(data))
+	}
+}
+
+func TestCells(t *testing.T) {
+	tests := []struct {
+		opt        Options
+		w, h       int
+		cols, rows int
+	}{
+		{Options{}, 100, 40, 10, 2},
+		{Options{}, 101, 41, 11, 3},
+		{Options{Columns: 20}, 100, 100, 20, 10},
+		{Options{Rows: 5}, 100, 100, 10, 5},
+		{Options{Columns: 3, Rows: 4}, 100, 100, 3, 4},
+		{Options{CellWidth: 8, CellHeight: 8}, 64, 64, 8, 8},
+	}
+	for _, tt := range tests {
+		if c, r := tt.opt.cells(tt.w, tt.h); c != tt.cols || r != tt.rows {
+			t.Errorf("%+v %dx%d: got %dx%d cells, want %dx%d", tt.opt, tt.w, tt.h, c, r, tt.cols, tt.rows)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, randImage(8, 8), &Options{Protocol: 2}); err == nil {
+		t.Error("unknown protocol: no error")
+	}
+	m := img1b.New(image.Rect(0, 0, 0, 8), nil)
+	if err := Encode(&bytes.Buffer{}, m, nil); err == nil {
+		t.Error("empty image: no error")
+	}
+}
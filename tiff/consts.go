@@ -0,0 +1,86 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+// A tiff image file contains one or more images. The metadata
+// of each image is contained in an Image File Directory (IFD),
+// which contains entries of 12 bytes each and is described
+// on page 14-16 of the specification. An IFD entry consists of
+//
+//  - a tag, which describes the signification of the entry,
+//  - the data type and length of the entry,
+//  - the data itself or a pointer to it if it is more than 4 bytes.
+//
+// The presence of a length means that each IFD is effectively an array.
+
+const (
+	leHeader = "II\x2A\x00" // Header for little-endian files.
+	beHeader = "MM\x00\x2A" // Header for big-endian files.
+
+	ifdLen = 12 // Length of an IFD entry in bytes.
+)
+
+// Data types (p. 14-16 of the spec).
+const (
+	dtByte     = 1
+	dtASCII    = 2
+	dtShort    = 3
+	dtLong     = 4
+	dtRational = 5
+)
+
+// The length of one instance of each data type in bytes.
+var lengths = [...]uint32{0, 1, 1, 2, 4, 8}
+
+// Tags (see p. 28-41 of the spec).
+const (
+	tNewSubfileType            = 254
+	tImageWidth                = 256
+	tImageLength               = 257
+	tBitsPerSample             = 258
+	tCompression               = 259
+	tPhotometricInterpretation = 262
+	tFillOrder                 = 266
+	tStripOffsets              = 273
+	tOrientation               = 274
+	tSamplesPerPixel           = 277
+	tRowsPerStrip              = 278
+	tStripByteCounts           = 279
+	tXResolution               = 282
+	tYResolution               = 283
+	tPlanarConfiguration       = 284
+	tT4Options                 = 292
+	tT6Options                 = 293
+	tResolutionUnit            = 296
+	tPageNumber                = 297
+	tSoftware                  = 305
+
+	tTileWidth      = 322
+	tTileLength     = 323
+	tTileOffsets    = 324
+	tTileByteCounts = 325
+)
+
+// Compression types (defined in various places in the spec and supplements).
+const (
+	cNone     = 1
+	cCCITT    = 2
+	cG3       = 3 // Group 3 Fax.
+	cG4       = 4 // Group 4 Fax.
+	cPackBits = 32773
+)
+
+// Photometric interpretation values (see p. 37 of the spec).
+const (
+	pWhiteIsZero = 0
+	pBlackIsZero = 1
+)
+
+// Fill order values.
+const (
+	foMSBFirst = 1
+	foLSBFirst = 2
+)
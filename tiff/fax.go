@@ -0,0 +1,159 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/g3"
+	"io"
+)
+
+// TIFF-F, the fax profile of TIFF, is described in RFC 2306. Its pages are
+// 1728, 2048 or 2432 pixels wide at 204 dpi, the widths of ISO A4, B4 and
+// A3 paper, with one of the vertical resolutions of fax machines, and are
+// CCITT coded in a single strip.
+
+// faxWidths are the page widths allowed by TIFF-F.
+var faxWidths = []int{1728, 2048, 2432}
+
+// checkFaxWidth reports whether width is a valid TIFF-F page width.
+func checkFaxWidth(width int) error {
+	for _, w := range faxWidths {
+		if width == w {
+			return nil
+		}
+	}
+	return FormatError(fmt.Sprintf("TIFF-F page width %d", width))
+}
+
+// FaxOptions are the encoding parameters of TIFF-F files.
+type FaxOptions struct {
+	// Compression is CCITTGroup4 (MMR), the zero value, CCITTGroup3 (MH)
+	// or CCITTGroup3TwoD (MR). MH is the one every fax reader supports.
+	Compression CompressionType
+
+	// Resolution is the vertical resolution of the pages.
+	Resolution g3.Resolution
+
+	// ByteAlign inserts fill bits so that T.4 EOLs end at byte boundaries.
+	ByteAlign bool
+
+	// LSBFirst stores the first pixel of each byte in the least
+	// significant bit, FillOrder 2, which is the bit order of fax modems.
+	LSBFirst bool
+}
+
+// NewFaxWriter returns a Writer that writes a TIFF-F file to w. Pages must
+// have one of the widths allowed by the profile. If opt is nil, pages are
+// CCITT Group 4 compressed at fine resolution.
+func NewFaxWriter(w io.Writer, opt *FaxOptions) *Writer {
+	var fo FaxOptions
+	if opt != nil {
+		fo = *opt
+	}
+	xres, yres := fo.Resolution.DPI()
+	tw := NewWriter(w, &Options{
+		Compression: fo.Compression,
+		XResolution: xres,
+		YResolution: yres,
+		LSBFirst:    fo.LSBFirst,
+	})
+	tw.fax = &fo
+	switch fo.Compression {
+	case CCITTGroup4, CCITTGroup3, CCITTGroup3TwoD:
+	default:
+		tw.err = UnsupportedError(fmt.Sprintf("TIFF-F compression type %d", fo.Compression))
+	}
+	return tw
+}
+
+// EncodeFax writes the images as the pages of a TIFF-F file.
+func EncodeFax(w io.Writer, pages []*img1b.Image, opt *FaxOptions) error {
+	tw := NewFaxWriter(w, opt)
+	for _, m := range pages {
+		if err := tw.Add(m); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// A FaxPage is a page of a TIFF-F file.
+type FaxPage struct {
+	Image      *img1b.Image
+	Resolution g3.Resolution
+}
+
+// faxResolution checks that the current IFD follows TIFF-F and returns the
+// vertical resolution of its page.
+func (d *decoder) faxResolution() (g3.Resolution, error) {
+	switch d.firstVal(tCompression) {
+	case cG3, cG4:
+	default:
+		return 0, FormatError("TIFF-F page not CCITT coded")
+	}
+	if d.firstVal(tPhotometricInterpretation) != pWhiteIsZero {
+		return 0, FormatError("TIFF-F page not WhiteIsZero")
+	}
+	if err := checkFaxWidth(d.config.Width); err != nil {
+		return 0, err
+	}
+	dpi := func(tag int) float64 {
+		r := d.features[tag]
+		if len(r) != 2 || r[1] == 0 {
+			return 0
+		}
+		v := float64(r[0]) / float64(r[1])
+		if d.firstVal(tResolutionUnit) == 3 {
+			v *= 2.54 // centimetre
+		}
+		return v
+	}
+	// The nominal 8 pixels per millimetre are 203.2 dpi, which is
+	// usually rounded to 204 or 200.
+	if x := dpi(tXResolution); x < 195 || x > 210 {
+		return 0, FormatError(fmt.Sprintf("TIFF-F horizontal resolution %g dpi", x))
+	}
+	y := dpi(tYResolution)
+	switch {
+	case y >= 90 && y <= 105:
+		return g3.Normal, nil
+	case y >= 180 && y <= 210:
+		return g3.Fine, nil
+	case y >= 370 && y <= 410:
+		return g3.Superfine, nil
+	}
+	return 0, FormatError(fmt.Sprintf("TIFF-F vertical resolution %g dpi", y))
+}
+
+// DecodeFax reads all pages of a TIFF-F file from r. It fails on pages that
+// do not follow the profile.
+func DecodeFax(r io.Reader) ([]FaxPage, error) {
+	var d Decoder
+	return d.DecodeFax(r)
+}
+
+// DecodeFax reads all pages of a TIFF-F file from r. It fails on pages that
+// do not follow the profile.
+func (dec *Decoder) DecodeFax(r io.Reader) ([]FaxPage, error) {
+	var pages []FaxPage
+	err := decodePages(r, dec.Limits, func(d *decoder) error {
+		res, err := d.faxResolution()
+		if err != nil {
+			return err
+		}
+		m, err := d.decode()
+		if err != nil {
+			return err
+		}
+		pages = append(pages, FaxPage{m, res})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/g3"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// faxPage returns a page with a few black bars depending on n.
+func faxPage(width, height, n int) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/(7+n)+y/(5+n))%3 == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+func TestFax(t *testing.T) {
+	tests := []*FaxOptions{
+		nil,
+		{Compression: CCITTGroup3, Resolution: g3.Normal},
+		{Compression: CCITTGroup3TwoD, ByteAlign: true, LSBFirst: true},
+		{Compression: CCITTGroup4, Resolution: g3.Superfine, LSBFirst: true},
+	}
+	for i, opt := range tests {
+		name := fmt.Sprint(i)
+		pages := []*img1b.Image{faxPage(1728, 40, 0), faxPage(2048, 30, 1), faxPage(2432, 20, 2)}
+		var buf bytes.Buffer
+		if err := EncodeFax(&buf, pages, opt); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var o FaxOptions
+		if opt != nil {
+			o = *opt
+		}
+
+		// Check the tags required by the profile.
+		d, err := newDecoder(bytes.NewReader(buf.Bytes()), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for n := 0; ; n++ {
+			if got := d.firstVal(tNewSubfileType); got != 2 {
+				t.Errorf("%s: page %d: NewSubfileType %d", name, n, got)
+			}
+			if got := d.features[tPageNumber]; len(got) != 2 || got[0] != uint(n) {
+				t.Errorf("%s: page %d: PageNumber %v", name, n, got)
+			}
+			if got := len(d.features[tStripOffsets]); got != 1 {
+				t.Errorf("%s: page %d: %d strips", name, n, got)
+			}
+			fo := uint(foMSBFirst)
+			if o.LSBFirst {
+				fo = foLSBFirst
+			}
+			if got := d.firstVal(tFillOrder); got != fo {
+				t.Errorf("%s: page %d: FillOrder %d, want %d", name, n, got, fo)
+			}
+			if o.Compression != CCITTGroup4 {
+				t4 := d.firstVal(tT4Options)
+				if (t4&0x1 != 0) != (o.Compression == CCITTGroup3TwoD) || (t4&0x4 != 0) != o.ByteAlign {
+					t.Errorf("%s: page %d: T4Options %#x", name, n, t4)
+				}
+			}
+			if d.next == 0 {
+				if n != len(pages)-1 {
+					t.Errorf("%s: %d pages, want %d", name, n+1, len(pages))
+				}
+				break
+			}
+			if err := d.readIFD(d.next); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+
+		got, err := DecodeFax(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != len(pages) {
+			t.Fatalf("%s: got %d pages, want %d", name, len(got), len(pages))
+		}
+		for j, p := range got {
+			if p.Resolution != o.Resolution {
+				t.Errorf("%s: page %d: resolution %d, want %d", name, j, p.Resolution, o.Resolution)
+			}
+			compare(t, fmt.Sprintf("%s: page %d", name, j), pages[j], p.Image)
+		}
+	}
+}
+
+func TestFaxErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeFax(&buf, []*img1b.Image{faxPage(1000, 10, 0)}, nil); err == nil {
+		t.Error("page width: no error")
+	}
+	if err := EncodeFax(&buf, []*img1b.Image{faxPage(1728, 10, 0)}, &FaxOptions{Compression: PackBits}); err == nil {
+		t.Error("compression: no error")
+	}
+	if err := EncodeFax(&buf, nil, nil); err == nil {
+		t.Error("no pages: no error")
+	}
+
+	// Files that are not TIFF-F.
+	for _, opt := range []*Options{
+		nil, // 72 dpi
+		{Compression: PackBits, XResolution: 204, YResolution: 196},
+		{BlackIsZero: true, XResolution: 204, YResolution: 196},
+		{XResolution: 204, YResolution: 150},
+	} {
+		buf.Reset()
+		if err := Encode(&buf, faxPage(1728, 10, 0), opt); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeFax(&buf); err == nil {
+			t.Errorf("%+v: no error", opt)
+		}
+	}
+	buf.Reset()
+	if err := Encode(&buf, faxPage(1000, 10, 0), &Options{XResolution: 204, YResolution: 196}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeFax(&buf); err == nil {
+		t.Error("page width: no error")
+	}
+}
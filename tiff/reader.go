@@ -0,0 +1,482 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tiff implements a decoder and encoder for bilevel TIFF images.
+//
+// Uncompressed, PackBits, CCITT RLE, CCITT Group 3 (T.4, both one- and
+// two-dimensional) and CCITT Group 4 (T.6) compressed images are supported
+// by the decoder. Pixels are decoded directly into the packed format; images
+// with PhotometricInterpretation WhiteIsZero get the palette {white, black}
+// and BlackIsZero ones get {black, white}.
+//
+// The encoder writes CCITT Group 4, CCITT Group 3, PackBits or uncompressed
+// images. Multi-page files are read with DecodeAll and written with a
+// Writer. Fax files following the TIFF-F profile are read with DecodeFax and
+// written with a Writer made by NewFaxWriter.
+//
+// The TIFF specification is at
+// http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// A FormatError reports that the input is not a valid TIFF image.
+type FormatError string
+
+func (e FormatError) Error() string {
+	return "tiff: invalid format: " + string(e)
+}
+
+// An UnsupportedError reports that the input uses a valid but
+// unimplemented feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return "tiff: unsupported feature: " + string(e)
+}
+
+var errNoPixels = FormatError("not enough pixel data")
+
+// Decoder configures decoding of TIFF images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their IFD is read.
+	Limits *img1b.Limits
+}
+
+type decoder struct {
+	buf       []byte
+	byteOrder binary.ByteOrder
+	config    image.Config
+	features  map[int][]uint
+	palette   color.Palette
+	offset    uint32 // Offset of the current IFD.
+	next      uint32 // Offset of the next IFD, or 0.
+	limits    *img1b.Limits
+}
+
+// firstVal returns the first uint of the features entry with the given tag,
+// or 0 if the tag does not exist.
+func (d *decoder) firstVal(tag int) uint {
+	f := d.features[tag]
+	if len(f) == 0 {
+		return 0
+	}
+	return f[0]
+}
+
+// ifdUint decodes the IFD entry in p, which must be of the Byte, Short
+// or Long type, and returns the decoded uint values.
+func (d *decoder) ifdUint(p []byte) (u []uint, err error) {
+	var raw []byte
+	if len(p) < ifdLen {
+		return nil, FormatError("bad IFD entry")
+	}
+
+	datatype := d.byteOrder.Uint16(p[2:4])
+	if dt := int(datatype); dt <= 0 || dt >= len(lengths) {
+		return nil, UnsupportedError("IFD entry datatype")
+	}
+
+	count := d.byteOrder.Uint32(p[4:8])
+	if count > uint32(len(d.buf))/lengths[datatype] {
+		return nil, FormatError("IFD data too large")
+	}
+	if datalen := lengths[datatype] * count; datalen > 4 {
+		// The IFD contains a pointer to the real value.
+		off := d.byteOrder.Uint32(p[8:12])
+		if uint64(off)+uint64(datalen) > uint64(len(d.buf)) {
+			return nil, FormatError("IFD data out of bounds")
+		}
+		raw = d.buf[off : off+datalen]
+	} else {
+		raw = p[8 : 8+datalen]
+	}
+
+	u = make([]uint, count)
+	switch datatype {
+	case dtByte:
+		for i := uint32(0); i < count; i++ {
+			u[i] = uint(raw[i])
+		}
+	case dtShort:
+		for i := uint32(0); i < count; i++ {
+			u[i] = uint(d.byteOrder.Uint16(raw[2*i : 2*(i+1)]))
+		}
+	case dtLong:
+		for i := uint32(0); i < count; i++ {
+			u[i] = uint(d.byteOrder.Uint32(raw[4*i : 4*(i+1)]))
+		}
+	case dtRational:
+		// Only the numerators are kept, followed by the denominators.
+		u = make([]uint, 2*count)
+		for i := uint32(0); i < count; i++ {
+			u[i] = uint(d.byteOrder.Uint32(raw[8*i : 8*i+4]))
+			u[count+i] = uint(d.byteOrder.Uint32(raw[8*i+4 : 8*i+8]))
+		}
+	default:
+		return nil, UnsupportedError("data type")
+	}
+	return u, nil
+}
+
+// parseIFD decides whether the IFD entry in p is "interesting" and
+// stows away the data in the decoder.
+func (d *decoder) parseIFD(p []byte) error {
+	tag := d.byteOrder.Uint16(p[0:2])
+	switch tag {
+	case tNewSubfileType,
+		tBitsPerSample,
+		tImageWidth,
+		tImageLength,
+		tCompression,
+		tPhotometricInterpretation,
+		tFillOrder,
+		tStripOffsets,
+		tSamplesPerPixel,
+		tRowsPerStrip,
+		tStripByteCounts,
+		tXResolution,
+		tYResolution,
+		tPlanarConfiguration,
+		tT4Options,
+		tT6Options,
+		tResolutionUnit,
+		tPageNumber,
+		tTileWidth,
+		tTileLength,
+		tTileOffsets,
+		tTileByteCounts:
+		val, err := d.ifdUint(p)
+		if err != nil {
+			return err
+		}
+		d.features[int(tag)] = val
+	}
+	return nil
+}
+
+// newDecoder parses the TIFF header and the first IFD.
+func newDecoder(r io.Reader, limits *img1b.Limits) (*decoder, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{
+		buf:    buf,
+		limits: limits,
+	}
+	if len(buf) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch string(buf[0:4]) {
+	case leHeader:
+		d.byteOrder = binary.LittleEndian
+	case beHeader:
+		d.byteOrder = binary.BigEndian
+	default:
+		return nil, FormatError("malformed header")
+	}
+
+	ifdOffset := d.byteOrder.Uint32(buf[4:8])
+	if err := d.readIFD(ifdOffset); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// readIFD parses the IFD at the given offset.
+func (d *decoder) readIFD(ifdOffset uint32) error {
+	d.features = make(map[int][]uint)
+	d.offset = ifdOffset
+	if uint64(ifdOffset)+2 > uint64(len(d.buf)) {
+		return FormatError("IFD out of bounds")
+	}
+	// The first two bytes contain the number of entries (12 bytes each).
+	numItems := int(d.byteOrder.Uint16(d.buf[ifdOffset : ifdOffset+2]))
+	start := int(ifdOffset) + 2
+	if start+ifdLen*numItems > len(d.buf) {
+		return FormatError("IFD out of bounds")
+	}
+	for i := 0; i < numItems; i++ {
+		if err := d.parseIFD(d.buf[start+ifdLen*i : start+ifdLen*(i+1)]); err != nil {
+			return err
+		}
+	}
+	// The entries are followed by the offset of the next IFD. Some writers
+	// omit it after the last IFD.
+	d.next = 0
+	if end := start + ifdLen*numItems; end+4 <= len(d.buf) {
+		d.next = d.byteOrder.Uint32(d.buf[end : end+4])
+	}
+
+	d.config.Width = int(d.firstVal(tImageWidth))
+	d.config.Height = int(d.firstVal(tImageLength))
+	if d.config.Width <= 0 || d.config.Height <= 0 {
+		return FormatError("non-positive dimension")
+	}
+	nPixels := int64(d.config.Width) * int64(d.config.Height)
+	if nPixels != int64(int(nPixels)) {
+		return UnsupportedError("dimension overflow")
+	}
+
+	if _, ok := d.features[tBitsPerSample]; !ok {
+		// Default is 1 per specification.
+		d.features[tBitsPerSample] = []uint{1}
+	}
+	if len(d.features[tBitsPerSample]) != 1 || d.firstVal(tSamplesPerPixel) > 1 || d.firstVal(tBitsPerSample) != 1 {
+		return UnsupportedError(fmt.Sprintf("bits per sample %v", d.features[tBitsPerSample]))
+	}
+	if len(d.features[tTileWidth]) > 0 {
+		return UnsupportedError("tiled images")
+	}
+
+	switch d.firstVal(tPhotometricInterpretation) {
+	case pWhiteIsZero:
+		d.palette = color.Palette{color.White, color.Black}
+	case pBlackIsZero:
+		d.palette = color.Palette{color.Black, color.White}
+	default:
+		return UnsupportedError("color model")
+	}
+	d.config.ColorModel = d.palette
+	return nil
+}
+
+// unpackBits decodes the PackBits-compressed data in src and returns the
+// uncompressed data.
+//
+// The PackBits compression format is described in section 9 (p. 42)
+// of the TIFF spec.
+func unpackBits(src []byte) ([]byte, error) {
+	var dst []byte
+	for i := 0; i < len(src); {
+		code := int(int8(src[i]))
+		i++
+		switch {
+		case code >= 0:
+			n := code + 1
+			if i+n > len(src) {
+				return nil, errNoPixels
+			}
+			dst = append(dst, src[i:i+n]...)
+			i += n
+		case code == -128:
+			// No-op.
+		default:
+			if i >= len(src) {
+				return nil, errNoPixels
+			}
+			for j := 0; j < 1-code; j++ {
+				dst = append(dst, src[i])
+			}
+			i++
+		}
+	}
+	return dst, nil
+}
+
+// decode decodes the strips of the image described by the current IFD.
+func (d *decoder) decode() (*img1b.Image, error) {
+	width, height := d.config.Width, d.config.Height
+	img, err := d.limits.New(image.Rect(0, 0, width, height), d.palette)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsPerStrip := height
+	if v := d.firstVal(tRowsPerStrip); v != 0 && v < uint(height) {
+		rowsPerStrip = int(v)
+	}
+	offsets, counts := d.features[tStripOffsets], d.features[tStripByteCounts]
+	numStrips := (height + rowsPerStrip - 1) / rowsPerStrip
+	if len(offsets) < numStrips {
+		return nil, FormatError("inconsistent strip offsets")
+	}
+	compression := d.firstVal(tCompression)
+	if compression == 0 {
+		compression = cNone
+	}
+	rowBytes := (width + 7) / 8
+	if len(counts) < numStrips {
+		if compression != cNone || len(counts) != 0 {
+			return nil, FormatError("inconsistent strip byte counts")
+		}
+		// Uncompressed strip sizes can be inferred.
+		counts = make([]uint, numStrips)
+		for i := range counts {
+			counts[i] = uint(rowsPerStrip * rowBytes)
+		}
+	}
+	lsbFirst := d.firstVal(tFillOrder) == foLSBFirst
+
+	for i := 0; i < numStrips; i++ {
+		y0 := i * rowsPerStrip
+		rows := rowsPerStrip
+		if y0+rows > height {
+			rows = height - y0
+		}
+		offset, n := uint64(offsets[i]), uint64(counts[i])
+		if offset+n > uint64(len(d.buf)) {
+			if compression != cNone || offset > uint64(len(d.buf)) {
+				return nil, errNoPixels
+			}
+			n = uint64(len(d.buf)) - offset
+		}
+		data := d.buf[offset : offset+n]
+		if lsbFirst {
+			rev := append([]byte(nil), data...)
+			img1b.ReverseBits(rev)
+			data = rev
+		}
+		dst := img.Pix[y0*img.Stride:]
+
+		var err error
+		switch compression {
+		case cNone:
+			err = copyRows(dst, img.Stride, data, rowBytes, rows)
+		case cPackBits:
+			data, err = unpackBits(data)
+			if err == nil {
+				err = copyRows(dst, img.Stride, data, rowBytes, rows)
+			}
+		case cCCITT:
+			err = decodeCCITT(data, dst, img.Stride, width, rows, &ccitt.Options{EncodedByteAlign: true})
+		case cG3:
+			opts := d.firstVal(tT4Options)
+			if opts&0x2 != 0 {
+				return nil, UnsupportedError("uncompressed CCITT mode")
+			}
+			// Any positive K makes the decoder read the tag bits.
+			k := int(opts & 0x1)
+			err = decodeCCITT(data, dst, img.Stride, width, rows, &ccitt.Options{K: k})
+		case cG4:
+			if d.firstVal(tT6Options)&0x2 != 0 {
+				return nil, UnsupportedError("uncompressed CCITT mode")
+			}
+			err = decodeCCITT(data, dst, img.Stride, width, rows, &ccitt.Options{K: -1})
+		default:
+			return nil, UnsupportedError(fmt.Sprintf("compression value %d", compression))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Clear the row padding.
+	tm := bitmap.TailMask(width)
+	for y := 0; y < height; y++ {
+		img.Pix[y*img.Stride+rowBytes-1] &= tm
+	}
+	return img, nil
+}
+
+// decodeCCITT decodes a CCITT coded strip of the given number of rows.
+func decodeCCITT(data, dst []byte, stride, width, rows int, opt *ccitt.Options) error {
+	n, err := ccitt.DecodeRows(dst, stride, width, rows, data, opt)
+	if err == nil && n < rows {
+		err = errNoPixels
+	}
+	return err
+}
+
+// copyRows copies rows of uncompressed data.
+func copyRows(dst []byte, stride int, src []byte, rowBytes, rows int) error {
+	if len(src) < rowBytes*rows {
+		return errNoPixels
+	}
+	for y := 0; y < rows; y++ {
+		copy(dst[y*stride:y*stride+rowBytes], src[y*rowBytes:])
+	}
+	return nil
+}
+
+// DecodeConfig returns the color model and dimensions of a TIFF image without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d, err := newDecoder(r, nil)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return d.config, nil
+}
+
+// Decode reads the first image of a TIFF file from r and returns it as an
+// img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads the first image of a TIFF file from r and returns it as an
+// img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d, err := newDecoder(r, dec.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return d.decode()
+}
+
+// DecodeAll reads all images of a multi-page TIFF file from r and returns
+// them in file order.
+func DecodeAll(r io.Reader) ([]*img1b.Image, error) {
+	var d Decoder
+	return d.DecodeAll(r)
+}
+
+// DecodeAll reads all images of a multi-page TIFF file from r and returns
+// them in file order.
+func (dec *Decoder) DecodeAll(r io.Reader) ([]*img1b.Image, error) {
+	var pages []*img1b.Image
+	err := decodePages(r, dec.Limits, func(d *decoder) error {
+		m, err := d.decode()
+		if err != nil {
+			return err
+		}
+		pages = append(pages, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// decodePages calls page for each IFD of the TIFF file read from r, with
+// the decoder positioned at it.
+func decodePages(r io.Reader, limits *img1b.Limits, page func(d *decoder) error) error {
+	d, err := newDecoder(r, limits)
+	if err != nil {
+		return err
+	}
+	seen := map[uint32]bool{d.offset: true}
+	for {
+		if err := page(d); err != nil {
+			return err
+		}
+		if d.next == 0 {
+			return nil
+		}
+		if seen[d.next] {
+			return FormatError("IFD loop")
+		}
+		seen[d.next] = true
+		if err := d.readIFD(d.next); err != nil {
+			return err
+		}
+	}
+}
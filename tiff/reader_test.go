@@ -0,0 +1,100 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	gopng "image/png"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func load(t *testing.T, name string) *img1b.Image {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := Decode(f)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return m
+}
+
+// compare checks that m has the same pixels as the reference image.
+func compare(t *testing.T, name string, want image.Image, m *img1b.Image) {
+	if want.Bounds() != m.Bounds() {
+		t.Fatalf("%s: got bounds %v, want %v", name, m.Bounds(), want.Bounds())
+	}
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g0 := color.GrayModel.Convert(want.At(x, y)).(color.Gray)
+			g1 := color.GrayModel.Convert(m.At(x, y)).(color.Gray)
+			if g0 != g1 {
+				t.Fatalf("%s: at (%d, %d) got %v, want %v", name, x, y, g1, g0)
+			}
+		}
+	}
+}
+
+func TestDecodeG4(t *testing.T) {
+	f, err := os.Open("testdata/bw-gopher.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want, err := gopng.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, "G4", want, load(t, "bw-gopher_ccittGroup4.tiff"))
+}
+
+func TestDecodeUncompressed(t *testing.T) {
+	m0 := load(t, "bw-uncompressed.tiff")
+	m1 := load(t, "bw-packbits.tiff")
+	compare(t, "PackBits", m0, m1)
+}
+
+func TestDecodeConfig(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/bw-gopher_ccittGroup4.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 153 || cfg.Height != 55 {
+		t.Errorf("got %dx%d, want 153x55", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/bw-gopher_ccittGroup4.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 7, 100, len(data) / 2} {
+		if _, err := Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("%d bytes: got nil error", n)
+		}
+	}
+	if _, err := Decode(strings.NewReader("GIF89a..")); err == nil {
+		t.Error("bad header: got nil error")
+	}
+}
+
+func TestDecodeG3(t *testing.T) {
+	want := load(t, "bw-gopher_ccittGroup4.tiff")
+	compare(t, "G3", want, load(t, "bw-gopher_ccittGroup3.tiff"))
+}
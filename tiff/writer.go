@@ -0,0 +1,479 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/ccitt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+	"sort"
+)
+
+// The TIFF format allows to choose the order of the different elements freely.
+// The basic structure of a TIFF file written by this package is:
+//
+//   1. Header (8 bytes).
+//   2. Image data.
+//   3. Image File Directory (IFD).
+//   4. "Pointer area" for larger entries in the IFD.
+
+// We only write little-endian TIFF files.
+var enc = binary.LittleEndian
+
+// An ifdEntry is a single entry in an Image File Directory.
+// A value of type dtRational is composed of two 32-bit values,
+// thus data contains two uints (numerator and denominator) for a single number.
+type ifdEntry struct {
+	tag      int
+	datatype int
+	data     []uint32
+}
+
+func (e ifdEntry) putData(p []byte) {
+	for _, d := range e.data {
+		switch e.datatype {
+		case dtByte, dtASCII:
+			p[0] = byte(d)
+			p = p[1:]
+		case dtShort:
+			enc.PutUint16(p, uint16(d))
+			p = p[2:]
+		case dtLong, dtRational:
+			enc.PutUint32(p, uint32(d))
+			p = p[4:]
+		}
+	}
+}
+
+type byTag []ifdEntry
+
+func (d byTag) Len() int           { return len(d) }
+func (d byTag) Less(i, j int) bool { return d[i].tag < d[j].tag }
+func (d byTag) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// ifdSize returns the number of bytes taken by the IFD d and its pointer
+// area.
+func ifdSize(d []ifdEntry) int {
+	n := 2 + ifdLen*len(d) + 4
+	for _, ent := range d {
+		count := len(ent.data)
+		if ent.datatype == dtRational {
+			count /= 2
+		}
+		if datalen := count * int(lengths[ent.datatype]); datalen > 4 {
+			n += datalen
+		}
+	}
+	return n
+}
+
+// writeIFD writes an IFD located at ifdOffset and its pointer area. next is
+// the offset of the following IFD, or 0 for the last one.
+func writeIFD(w io.Writer, ifdOffset int, d []ifdEntry, next uint32) error {
+	var buf [ifdLen]byte
+	// Make space for "pointer area" containing IFD entry data
+	// longer than 4 bytes.
+	parea := make([]byte, 1024)
+	pstart := ifdOffset + ifdLen*len(d) + 6
+	var o int // Current offset in parea.
+
+	// The IFD has to be written with the tags in ascending order.
+	sort.Sort(byTag(d))
+
+	// Write the number of entries in this IFD.
+	if err := binary.Write(w, enc, uint16(len(d))); err != nil {
+		return err
+	}
+	for _, ent := range d {
+		enc.PutUint16(buf[0:2], uint16(ent.tag))
+		enc.PutUint16(buf[2:4], uint16(ent.datatype))
+		count := uint32(len(ent.data))
+		if ent.datatype == dtRational {
+			count /= 2
+		}
+		enc.PutUint32(buf[4:8], count)
+		datalen := int(count * lengths[ent.datatype])
+		if datalen <= 4 {
+			ent.putData(buf[8:12])
+		} else {
+			if (o + datalen) > len(parea) {
+				newlen := len(parea) + 1024
+				for (o + datalen) > newlen {
+					newlen += 1024
+				}
+				newarea := make([]byte, newlen)
+				copy(newarea, parea)
+				parea = newarea
+			}
+			ent.putData(parea[o : o+datalen])
+			enc.PutUint32(buf[8:12], uint32(pstart+o))
+			o += datalen
+		}
+		if _, err := w.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	// The IFD ends with the offset of the next IFD in the file,
+	// or zero if it is the last one (page 14).
+	if err := binary.Write(w, enc, next); err != nil {
+		return err
+	}
+	_, err := w.Write(parea[:o])
+	return err
+}
+
+// CompressionType describes the type of compression used in Options.
+type CompressionType int
+
+// Constants for supported compression types.
+const (
+	CCITTGroup4 CompressionType = iota
+	Uncompressed
+	PackBits
+	CCITTGroup3     // one-dimensional T.4 coding (MH)
+	CCITTGroup3TwoD // two-dimensional T.4 coding (MR)
+)
+
+// specValue returns the compression type constant from the TIFF spec that
+// is equivalent to c.
+func (c CompressionType) specValue() uint32 {
+	switch c {
+	case Uncompressed:
+		return cNone
+	case PackBits:
+		return cPackBits
+	case CCITTGroup3, CCITTGroup3TwoD:
+		return cG3
+	}
+	return cG4
+}
+
+// Options are the encoding parameters.
+type Options struct {
+	// Compression is the type of compression used. The zero value is
+	// CCITT Group 4.
+	Compression CompressionType
+
+	// BlackIsZero selects the BlackIsZero photometric interpretation.
+	// By default WhiteIsZero, the usual one for bilevel images, is used.
+	BlackIsZero bool
+
+	// XResolution and YResolution are the pixel density in dots per inch.
+	// Zero values mean 72.
+	XResolution, YResolution int
+
+	// RowsPerStrip is the number of rows per strip. If zero, strips of
+	// about 8 KiB of uncompressed data are written. CCITT strips are coded
+	// independently, so larger strips compress better.
+	RowsPerStrip int
+
+	// LSBFirst stores the first pixel of each byte in the least
+	// significant bit, FillOrder 2. It is meant for fax software; the
+	// default FillOrder 1 is the one all readers support.
+	LSBFirst bool
+}
+
+// encoding holds the CCITT coding parameters of strips.
+type encoding struct {
+	compression CompressionType
+	invert      bool
+	k           int  // K of two-dimensional T.4 coding
+	byteAlign   bool // T.4 EOLs end at byte boundaries
+	lsbFirst    bool
+}
+
+// encodeStrips compresses m into strips of rowsPerStrip rows. Set bits are
+// written as black; the invert flag flips pixel values.
+func encodeStrips(m *img1b.Image, e *encoding, rowsPerStrip int) [][]byte {
+	compression, invert := e.compression, e.invert
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+	rowBytes := (width + 7) / 8
+	tm := bitmap.TailMask(width)
+	var strips [][]byte
+	row := make([]byte, rowBytes)
+	for y0 := 0; y0 < height; y0 += rowsPerStrip {
+		rows := rowsPerStrip
+		if y0+rows > height {
+			rows = height - y0
+		}
+		src := m.Pix[y0*m.Stride:]
+		var data []byte
+		switch compression {
+		case CCITTGroup4:
+			data = ccitt.EncodeRows(src, m.Stride, width, rows, &ccitt.Options{
+				K:          -1,
+				EndOfBlock: true,
+				Invert:     invert,
+			})
+		case CCITTGroup3, CCITTGroup3TwoD:
+			// Each row starts with an EOL, there is no RTC.
+			o := &ccitt.Options{
+				EndOfLine:        true,
+				EncodedByteAlign: e.byteAlign,
+				Invert:           invert,
+			}
+			if compression == CCITTGroup3TwoD {
+				o.K = e.k
+			}
+			data = ccitt.EncodeRows(src, m.Stride, width, rows, o)
+		default:
+			for y := 0; y < rows; y++ {
+				copy(row, src[y*m.Stride:y*m.Stride+rowBytes])
+				if invert {
+					for i := range row {
+						row[i] = ^row[i]
+					}
+				}
+				row[rowBytes-1] &= tm
+				if compression == PackBits {
+					// Rows are packed separately, as the spec requires.
+					data = bitmap.PackBits(data, row)
+				} else {
+					data = append(data, row...)
+				}
+			}
+		}
+		if e.lsbFirst {
+			img1b.ReverseBits(data)
+		}
+		strips = append(strips, data)
+	}
+	return strips
+}
+
+// A Writer writes a multi-page TIFF file. Pages are appended with Add and
+// the file is completed with Close. The underlying writer does not need to
+// support seeking: the IFD of each page is held back until the size of the
+// next page is known.
+type Writer struct {
+	w      *bufio.Writer
+	opt    Options
+	offset int64      // Number of bytes written so far.
+	ifd    []ifdEntry // IFD of the last added page, not yet written.
+	pages  int
+	fax    *FaxOptions // TIFF-F profile, if the Writer was made by NewFaxWriter.
+	err    error
+}
+
+// pageEntry marks every image of a multi-page file as a page.
+var pageEntry = ifdEntry{tNewSubfileType, dtLong, []uint32{2}}
+
+// NewWriter returns a Writer that writes pages to w with the given options.
+// If opt is nil, pages are CCITT Group 4 compressed.
+func NewWriter(w io.Writer, opt *Options) *Writer {
+	tw := &Writer{w: bufio.NewWriter(w)}
+	if opt != nil {
+		tw.opt = *opt
+	}
+	if tw.opt.Compression < CCITTGroup4 || tw.opt.Compression > CCITTGroup3TwoD {
+		tw.err = UnsupportedError(fmt.Sprintf("compression type %d", tw.opt.Compression))
+	}
+	return tw
+}
+
+// flushIFD writes the pending IFD, which is followed by the next one at the
+// given offset, or is the last one if next is 0.
+func (w *Writer) flushIFD(next int64) error {
+	if err := writeIFD(w.w, int(w.offset), w.ifd, uint32(next)); err != nil {
+		return err
+	}
+	w.offset += int64(ifdSize(w.ifd))
+	w.ifd = nil
+	return nil
+}
+
+// Add appends the image m as a new page.
+func (w *Writer) Add(m *img1b.Image) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.add(m)
+	return w.err
+}
+
+func (w *Writer) add(m *img1b.Image) error {
+	d := m.Bounds().Size()
+	if d.X <= 0 || d.Y <= 0 || int64(d.X) >= 1<<32 || int64(d.Y) >= 1<<32 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", d.X, d.Y))
+	}
+	opt := &w.opt
+	if w.fax != nil {
+		if err := checkFaxWidth(d.X); err != nil {
+			return err
+		}
+	}
+
+	rowsPerStrip := opt.RowsPerStrip
+	if rowsPerStrip <= 0 {
+		rowsPerStrip = 8192 / ((d.X + 7) / 8)
+		if rowsPerStrip < 1 {
+			rowsPerStrip = 1
+		}
+	}
+	if rowsPerStrip > d.Y || w.fax != nil {
+		rowsPerStrip = d.Y
+	}
+
+	// Set bits are black in WhiteIsZero.
+	photometric := uint32(pWhiteIsZero)
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	if opt.BlackIsZero {
+		photometric = pBlackIsZero
+		invert = !invert
+	}
+
+	xres, yres := opt.XResolution, opt.YResolution
+	if xres <= 0 {
+		xres = 72
+	}
+	if yres <= 0 {
+		yres = 72
+	}
+	e := &encoding{
+		compression: opt.Compression,
+		invert:      invert,
+		lsbFirst:    opt.LSBFirst,
+	}
+	// T.4 sends a one-dimensionally coded row at least every 2 rows at
+	// standard resolution and every 4 at higher ones.
+	e.k = 4
+	if yres < 150 {
+		e.k = 2
+	}
+	if w.fax != nil {
+		e.byteAlign = w.fax.ByteAlign
+	}
+	strips := encodeStrips(m, e, rowsPerStrip)
+
+	// The image data is followed by its IFD, which must start at a word
+	// boundary. The data goes after the header on the first page and
+	// after the IFD of the previous page on the others.
+	start := w.offset + 8
+	if w.pages > 0 {
+		if w.pages == 1 && w.fax == nil {
+			w.ifd = append(w.ifd, pageEntry)
+		}
+		start = w.offset + int64(ifdSize(w.ifd))
+	}
+	offsets := make([]uint32, len(strips))
+	counts := make([]uint32, len(strips))
+	offset := start
+	for i, s := range strips {
+		offsets[i] = uint32(offset)
+		counts[i] = uint32(len(s))
+		offset += int64(len(s))
+	}
+	pad := int(offset % 2)
+	offset += int64(pad)
+	if offset >= 1<<32 {
+		return FormatError("image data is too large")
+	}
+
+	w.pages++
+	if w.pages == 1 {
+		var h [8]byte
+		copy(h[:4], leHeader)
+		enc.PutUint32(h[4:], uint32(offset))
+		if _, err := w.w.Write(h[:]); err != nil {
+			return err
+		}
+		w.offset = 8
+	} else if err := w.flushIFD(offset); err != nil {
+		return err
+	}
+	for _, s := range strips {
+		if _, err := w.w.Write(s); err != nil {
+			return err
+		}
+	}
+	if pad != 0 {
+		if err := w.w.WriteByte(0); err != nil {
+			return err
+		}
+	}
+	w.offset = offset
+
+	w.ifd = []ifdEntry{
+		{tImageWidth, dtLong, []uint32{uint32(d.X)}},
+		{tImageLength, dtLong, []uint32{uint32(d.Y)}},
+		{tBitsPerSample, dtShort, []uint32{1}},
+		{tCompression, dtShort, []uint32{opt.Compression.specValue()}},
+		{tPhotometricInterpretation, dtShort, []uint32{photometric}},
+		{tStripOffsets, dtLong, offsets},
+		{tSamplesPerPixel, dtShort, []uint32{1}},
+		{tRowsPerStrip, dtLong, []uint32{uint32(rowsPerStrip)}},
+		{tStripByteCounts, dtLong, counts},
+		{tXResolution, dtRational, []uint32{uint32(xres), 1}},
+		{tYResolution, dtRational, []uint32{uint32(yres), 1}},
+		{tResolutionUnit, dtShort, []uint32{2}}, // inch
+	}
+	switch opt.Compression {
+	case CCITTGroup4:
+		w.ifd = append(w.ifd, ifdEntry{tT6Options, dtLong, []uint32{0}})
+	case CCITTGroup3, CCITTGroup3TwoD:
+		var t4 uint32
+		if opt.Compression == CCITTGroup3TwoD {
+			t4 |= 0x1
+		}
+		if e.byteAlign {
+			t4 |= 0x4 // fill bits before EOLs
+		}
+		w.ifd = append(w.ifd, ifdEntry{tT4Options, dtLong, []uint32{t4}})
+	}
+	if opt.LSBFirst {
+		w.ifd = append(w.ifd, ifdEntry{tFillOrder, dtShort, []uint32{foLSBFirst}})
+	}
+	if w.fax != nil {
+		// The profile wants every image marked as a page and numbered. The
+		// number of pages is not known yet, which is written as zero.
+		w.ifd = append(w.ifd, pageEntry,
+			ifdEntry{tPageNumber, dtShort, []uint32{uint32(w.pages - 1), 0}})
+		if !opt.LSBFirst {
+			w.ifd = append(w.ifd, ifdEntry{tFillOrder, dtShort, []uint32{foMSBFirst}})
+		}
+	} else if w.pages > 1 {
+		w.ifd = append(w.ifd, pageEntry)
+	}
+	return nil
+}
+
+// Close writes the IFD of the last page and flushes the output. It does
+// not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.pages == 0 {
+		w.err = FormatError("no pages")
+		return w.err
+	}
+	if w.err = w.flushIFD(0); w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	if w.err == nil {
+		// Any further use is an error.
+		w.err = FormatError("write to closed Writer")
+		return nil
+	}
+	return w.err
+}
+
+// Encode writes the image m to w. opt determines the options used for
+// encoding, such as the compression type. If opt is nil, an image with CCITT
+// Group 4 compression is written.
+func Encode(w io.Writer, m *img1b.Image, opt *Options) error {
+	tw := NewWriter(w, opt)
+	if err := tw.Add(m); err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+)
+
+var encodeTests = []struct {
+	name string
+	opt  *Options
+}{
+	{"default", nil},
+	{"G4 BlackIsZero", &Options{BlackIsZero: true}},
+	{"uncompressed", &Options{Compression: Uncompressed}},
+	{"PackBits", &Options{Compression: PackBits}},
+	{"PackBits BlackIsZero", &Options{Compression: PackBits, BlackIsZero: true}},
+	{"G4 strips", &Options{RowsPerStrip: 7}},
+	{"uncompressed strips", &Options{Compression: Uncompressed, RowsPerStrip: 1}},
+	{"G3", &Options{Compression: CCITTGroup3}},
+	{"G3 2D", &Options{Compression: CCITTGroup3TwoD, RowsPerStrip: 10}},
+	{"G3 2D normal", &Options{Compression: CCITTGroup3TwoD, YResolution: 98}},
+	{"G4 LSBFirst", &Options{LSBFirst: true}},
+	{"PackBits LSBFirst", &Options{Compression: PackBits, LSBFirst: true}},
+}
+
+func TestEncode(t *testing.T) {
+	m0 := load(t, "bw-gopher_ccittGroup4.tiff")
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		compare(t, tt.name, m0, m1)
+	}
+}
+
+func TestEncodePalette(t *testing.T) {
+	// Set bits are white here, so they must be inverted for WhiteIsZero.
+	m0 := img1b.New(image.Rect(0, 0, 21, 9), color.Palette{color.Black, color.White})
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 21; x++ {
+			m0.SetColorIndex(x, y, uint8((x/3+y)%2))
+		}
+	}
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, tt.opt); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		m1, err := Decode(&buf)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		compare(t, tt.name, m0, m1)
+	}
+}
+
+func TestEncodeSubImage(t *testing.T) {
+	m0 := load(t, "bw-gopher_ccittGroup4.tiff").SubImage(image.Rect(16, 10, 101, 50))
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The decoded image starts at the origin.
+	want := *m0
+	want.Rect = want.Rect.Sub(want.Rect.Min)
+	compare(t, "SubImage", &want, m1)
+}
+
+func TestEncodeResolution(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 8, 8), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{XResolution: 204, YResolution: 196}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDecoder(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.features[tXResolution]; len(got) != 2 || got[0] != 204 || got[1] != 1 {
+		t.Errorf("XResolution: got %v, want [204 1]", got)
+	}
+	if got := d.features[tYResolution]; len(got) != 2 || got[0] != 196 || got[1] != 1 {
+		t.Errorf("YResolution: got %v, want [196 1]", got)
+	}
+}
+
+func TestPackBits(t *testing.T) {
+	src := []byte("aaaaabcdeffffffffg")
+	src = append(src, bytes.Repeat([]byte{0}, 300)...)
+	got, err := unpackBits(bitmap.PackBits(nil, src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, src) {
+		t.Errorf("got %q, want %q", got, src)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	m := img1b.New(image.Rect(0, 0, 1728, 2200), color.Palette{color.White, color.Black})
+	for y := 0; y < 2200; y += 10 {
+		for x := y % 1728; x < 1728; x += 3 {
+			m.SetColorIndex(x, y, 1)
+		}
+	}
+	b.SetBytes(1728 * 2200 / 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Encode(ioutil.Discard, m, nil)
+	}
+}
+
+func TestWriterPages(t *testing.T) {
+	m0 := load(t, "bw-gopher_ccittGroup4.tiff")
+	m1 := img1b.New(image.Rect(0, 0, 30, 17), color.Palette{color.Black, color.White})
+	for y := 0; y < 17; y++ {
+		m1.SetColorIndex(y, y, 1)
+	}
+	pages := []*img1b.Image{m0, m1, m0}
+	for _, tt := range encodeTests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, tt.opt)
+		for _, m := range pages {
+			if err := w.Add(m); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := DecodeAll(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(pages) {
+			t.Errorf("%s: got %d pages, want %d", tt.name, len(got), len(pages))
+			continue
+		}
+		for i, m := range got {
+			compare(t, tt.name, pages[i], m)
+		}
+		// Decode returns the first page.
+		m, err := Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		compare(t, tt.name, m0, m)
+	}
+}
+
+func TestWriterNoPages(t *testing.T) {
+	if err := NewWriter(ioutil.Discard, nil).Close(); err == nil {
+		t.Error("missing error")
+	}
+}
+
+func TestDecodeAllSinglePage(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/bw-gopher_ccittGroup3.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Errorf("got %d pages, want 1", len(pages))
+	}
+}
+
+func TestDecodeIFDLoop(t *testing.T) {
+	// A single page whose next IFD is itself.
+	var buf bytes.Buffer
+	if err := Encode(&buf, img1b.New(image.Rect(0, 0, 9, 9), nil), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	ifd := binary.LittleEndian.Uint32(data[4:8])
+	n := binary.LittleEndian.Uint16(data[ifd:])
+	binary.LittleEndian.PutUint32(data[int(ifd)+2+ifdLen*int(n):], ifd)
+	calls := 0
+	err := decodePages(bytes.NewReader(data), nil, func(d *decoder) error {
+		calls++
+		return nil
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("got %d pages and error %v, want 1 page and an IFD loop", calls, err)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	for _, h := range []int{10, 20} {
+		if err := w.Add(img1b.New(image.Rect(0, 0, 10, h), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 100}}
+	if _, err := d.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	// The second page is over.
+	_, err := d.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+)
+
+// An InvalidError reports an image breaking an invariant of Image.
+type InvalidError string
+
+func (e InvalidError) Error() string { return "img1b: invalid image: " + string(e) }
+
+// Validate checks the invariants of p that the package and the codecs rely
+// on, returning an InvalidError telling the first one broken:
+//
+//   - Rect is well-formed, and Stride holds a row of its width;
+//   - Pix holds every row;
+//   - the palette has the colors of the pixels: at least one, two if
+//     any pixel is of index 1, and they are not nil;
+//   - the bits past the right edge of each row are zero.
+//
+// It is meant for images made of data received from elsewhere, as by
+// NewFromPix, and for checking code making images. Sub-images whose right
+// edge is not on a byte boundary have pixels of their parent past it, so
+// they may well fail the last check: validate the parent instead.
+func (p *Image) Validate() error { return p.validate(true) }
+
+// validate is Validate, checking the padding if padding is set.
+func (p *Image) validate(padding bool) error {
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	if w < 0 || h < 0 {
+		return InvalidError(fmt.Sprintf("Rect %v is not well-formed", p.Rect))
+	}
+	n := (w + 7) / 8
+	if w == 0 || h == 0 {
+		n = 0
+	}
+	if p.Stride < n {
+		return InvalidError(fmt.Sprintf("Stride %d is less than the %d bytes of a row of %d pixels", p.Stride, n, w))
+	}
+	if n > 0 {
+		// The last row need not extend to Stride.
+		need := mul2NonNeg(h-1, p.Stride)
+		if need < 0 || need+n < 0 {
+			return InvalidError(fmt.Sprintf("%v with Stride %d overflows", p.Rect, p.Stride))
+		}
+		if len(p.Pix) < need+n {
+			return InvalidError(fmt.Sprintf("Pix has %d bytes, less than the %d of %d rows with Stride %d", len(p.Pix), need+n, h, p.Stride))
+		}
+	}
+	for i := 0; i < len(p.Palette) && i < 2; i++ {
+		if p.Palette[i] == nil {
+			return InvalidError(fmt.Sprintf("palette color %d is nil", i))
+		}
+	}
+	switch {
+	case len(p.Palette) == 0:
+		return InvalidError("empty palette")
+	case len(p.Palette) == 1 && n > 0:
+		if pt, ok := p.findSet(); ok {
+			return InvalidError(fmt.Sprintf("pixel %v has index 1 but the palette has one color", pt))
+		}
+	}
+	if padding && n > 0 && w%8 != 0 {
+		tm := bitmap.TailMask(w)
+		for y := 0; y < h; y++ {
+			if p.Pix[y*p.Stride+n-1]&^tm != 0 {
+				return InvalidError(fmt.Sprintf("row %d has bits set past the right edge", p.Rect.Min.Y+y))
+			}
+		}
+	}
+	return nil
+}
+
+// Canonicalize clears the padding of p: the bits past the right edge of
+// each row, in its last byte. Images made by New, the decoders and the
+// operations of this module have it clear.
+//
+// What the padding holds never changes the pixels, and Opaque, the encoders
+// and the device exports mask it off. Code comparing or hashing the bytes of
+// Pix sees it, though, as Validate does: bring images from elsewhere to the
+// canonical form before.
+//
+// The padding of a sub-image ending short of the right edge of its parent,
+// not on a byte boundary, is pixels of the parent: Canonicalize leaves it
+// alone, so the sub-image stays as it is. A copy-on-write sub-image gets its
+// own copy of the pixels first, which it then canonicalizes.
+func (p *Image) Canonicalize() { p.FillPadding(0) }
+
+// FillPadding is like Canonicalize, but sets the padding bits to index
+// instead, for devices that want rows padded with ones.
+func (p *Image) FillPadding(index uint8) {
+	w, h := p.Rect.Dx(), p.Rect.Dy()
+	if w <= 0 || h <= 0 || w%8 == 0 {
+		return
+	}
+	p.Unshare()
+	if p.clipped {
+		return
+	}
+	tm := bitmap.TailMask(w)
+	for y, i := 0, (w-1)/8; y < h; y, i = y+1, i+p.Stride {
+		if index == 0 {
+			p.Pix[i] &= tm
+		} else {
+			p.Pix[i] |= ^tm
+		}
+	}
+}
+
+// findSet returns the first pixel of index 1, if any.
+func (p *Image) findSet() (image.Point, bool) {
+	w := p.Rect.Dx()
+	n := w / 8
+	for y := 0; y < p.Rect.Dy(); y++ {
+		row := p.Pix[y*p.Stride:]
+		if bitmap.All(row[:n], 0) && (w%8 == 0 || row[n]&bitmap.TailMask(w) == 0) {
+			continue
+		}
+		for x := 0; x < w; x++ {
+			if row[x>>3]&(0x80>>uint(x&7)) != 0 {
+				return image.Pt(p.Rect.Min.X+x, p.Rect.Min.Y+y), true
+			}
+		}
+	}
+	return image.Point{}, false
+}
+
+// NewFromPix returns an image of pixels held elsewhere, as for an Image
+// literal, having checked them with Validate. The image shares pix.
+func NewFromPix(pix []byte, stride int, r image.Rectangle, pal color.Palette) (*Image, error) {
+	m := &Image{Pix: pix, Stride: stride, Rect: r, Palette: pal, pc: newPaletteCache(pal)}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	bw := color.Palette{color.White, color.Black}
+	maxInt := int(^uint(0) >> 1)
+	for _, tc := range []struct {
+		name string
+		m    *Image
+		err  string
+	}{
+		{"new", New(image.Rect(-3, 2, 17, 9), bw), ""},
+		{"empty", New(image.Rect(0, 0, 0, 5), bw), ""},
+		{"aligned", &Image{Pix: make([]byte, 6), Stride: 2, Rect: image.Rect(0, 0, 16, 3), Palette: bw}, ""},
+		{"short last row", &Image{Pix: make([]byte, 8), Stride: 3, Rect: image.Rect(0, 0, 10, 3), Palette: bw}, ""},
+		{"not well-formed", &Image{Rect: image.Rectangle{image.Pt(5, 0), image.Pt(0, 5)}, Palette: bw}, "not well-formed"},
+		{"narrow stride", &Image{Pix: make([]byte, 8), Stride: 1, Rect: image.Rect(0, 0, 9, 4), Palette: bw}, "Stride 1 is less than the 2 bytes"},
+		{"short pix", &Image{Pix: make([]byte, 7), Stride: 2, Rect: image.Rect(0, 0, 9, 4), Palette: bw}, "Pix has 7 bytes, less than the 8"},
+		{"overflow", &Image{Stride: maxInt/2 + 1, Rect: image.Rect(0, 0, 8, 8), Palette: bw}, "overflows"},
+		{"empty palette", &Image{Pix: make([]byte, 1), Stride: 1, Rect: image.Rect(0, 0, 8, 1)}, "empty palette"},
+		{"nil color", &Image{Pix: make([]byte, 1), Stride: 1, Rect: image.Rect(0, 0, 8, 1), Palette: color.Palette{color.Black, nil}}, "color 1 is nil"},
+		{"one color", &Image{Pix: []byte{0, 0}, Stride: 1, Rect: image.Rect(0, 0, 8, 2), Palette: color.Palette{color.Black}}, ""},
+		{"missing color", &Image{Pix: []byte{0, 0x08}, Stride: 1, Rect: image.Rect(2, 3, 10, 5), Palette: color.Palette{color.Black}}, "pixel (6,4) has index 1"},
+		{"padding", &Image{Pix: []byte{0xf8, 0xf8, 0xfc}, Stride: 1, Rect: image.Rect(0, 0, 5, 3), Palette: bw}, "row 2 has bits set past the right edge"},
+	} {
+		err := tc.m.Validate()
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got %v, want %q", tc.name, err, tc.err)
+		case err != nil:
+			if _, ok := err.(InvalidError); !ok {
+				t.Errorf("%s: got %T, want InvalidError", tc.name, err)
+			}
+		}
+	}
+}
+
+func TestNewFromPix(t *testing.T) {
+	pix := []byte{0x80, 0, 0, 0x80}
+	m, err := NewFromPix(pix, 2, image.Rect(1, 1, 10, 3), color.Palette{color.White, color.Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.At(1, 1) != color.Black || m.At(2, 2) != color.White || m.At(9, 2) != color.Black {
+		t.Error("wrong pixels")
+	}
+	m.SetColorIndex(2, 1, 1)
+	if pix[0] != 0xc0 {
+		t.Error("pixels not shared")
+	}
+	pix[1] = 0x01
+	if _, err := NewFromPix(pix, 2, image.Rect(0, 0, 12, 2), color.Palette{color.White, color.Black}); err == nil {
+		t.Error("dirty padding accepted")
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	bw := color.Palette{color.White, color.Black}
+	m := &Image{Pix: []byte{0xff, 0xfa, 0x00, 0x07, 0x55, 0x81}, Stride: 2, Rect: image.Rect(0, 0, 13, 3), Palette: bw}
+	m.FillPadding(1)
+	if want := []byte{0xff, 0xff, 0x00, 0x07, 0x55, 0x87}; string(m.Pix) != string(want) {
+		t.Errorf("FillPadding(1): got % x, want % x", m.Pix, want)
+	}
+	m.Canonicalize()
+	if want := []byte{0xff, 0xf8, 0x00, 0x00, 0x55, 0x80}; string(m.Pix) != string(want) {
+		t.Errorf("Canonicalize: got % x, want % x", m.Pix, want)
+	}
+	if err := m.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// A copy-on-write sub-image leaves its parent alone.
+	p := New(image.Rect(0, 0, 16, 2), bw)
+	p.Pix[0], p.Pix[2] = 0x3c, 0xff
+	s := p.CowSubImage(image.Rect(0, 0, 5, 2))
+	s.Canonicalize()
+	if p.Pix[0] != 0x3c || p.Pix[2] != 0xff {
+		t.Errorf("parent changed: % x", p.Pix)
+	}
+	if s.Pix[0] != 0x38 || s.Pix[s.Stride] != 0xf8 {
+		t.Errorf("sub-image: got % x", s.Pix)
+	}
+
+	// So does a plain one, whose padding is pixels of the parent.
+	p.SubImage(image.Rect(0, 0, 5, 2)).FillPadding(1)
+	p.SubImage(image.Rect(0, 0, 5, 2)).SubImage(image.Rect(0, 0, 4, 2)).Canonicalize()
+	if p.Pix[0] != 0x3c || p.Pix[2] != 0xff {
+		t.Errorf("parent changed by a sub-image: % x", p.Pix)
+	}
+	// A sub-image at the right edge of its parent shares its padding.
+	q := New(image.Rect(0, 0, 13, 2), bw)
+	q.Pix[1] = 0xff
+	q.SubImage(image.Rect(8, 0, 13, 2)).Canonicalize()
+	if q.Pix[1] != 0xf8 {
+		t.Errorf("right sub-image: got % x", q.Pix)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"math"
+)
+
+// WatershedOptions are the parameters of Watershed.
+type WatershedOptions struct {
+	// Depth is how far, in pixels, the distance to the edge has to fall
+	// from the peak of the lesser of two touching parts of a blob to the
+	// neck between them for the parts to be split, 1 if 0. Larger depths
+	// keep blobs with a bumpy outline, or elongated ones, in one piece.
+	Depth float64
+}
+
+// Watershed numbers the objects of the set pixels, of color index 1, of m
+// as Label does, but splits blobs of touching objects, such as cells or
+// seeds, at their necks. Each object grows from a peak of the distance of
+// its pixels to the edge of the blob, taking the pixels in order of
+// falling distance, until it meets another one: the pixels where they meet
+// are left out, as a line between them, unless the objects are not deep
+// enough to be told apart as WatershedOptions.Depth tells, and are merged.
+// Distances are of the 3-4 chamfer, about Euclidean; the pixels around m
+// count as clear.
+func Watershed(m *Image, opt *WatershedOptions) *Labels {
+	var o WatershedOptions
+	if opt != nil {
+		o = *opt
+	}
+	if o.Depth <= 0 {
+		o.Depth = 1
+	}
+	depth := int32(math.Round(o.Depth * chamferUnit))
+
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	l := &Labels{Rect: m.Rect}
+	if w <= 0 || h <= 0 {
+		l.Rect = image.Rectangle{}
+		return l
+	}
+	dist := chamfer(m)
+
+	// The pixels in order of falling distance, by counting.
+	var top int32
+	for _, d := range dist {
+		if d > top {
+			top = d
+		}
+	}
+	start := make([]int, top+2)
+	for _, d := range dist {
+		if d > 0 {
+			start[top-d+1]++
+		}
+	}
+	for i := 1; i < len(start); i++ {
+		start[i] += start[i-1]
+	}
+	order := make([]int, start[len(start)-1])
+	for i, d := range dist {
+		if d > 0 {
+			order[start[top-d]] = i
+			start[top-d]++
+		}
+	}
+
+	// The basins grow by union-find; lab holds the basin of each pixel
+	// taken, -1 for the lines between basins.
+	lab := make([]int32, w*h)
+	parent := []int32{0}
+	peak := []int32{0}
+	find := func(b int32) int32 {
+		for parent[b] != b {
+			parent[b] = parent[parent[b]]
+			b = parent[b]
+		}
+		return b
+	}
+	var roots []int32
+	for _, i := range order {
+		d := dist[i]
+		x, y := i%w, i/w
+		roots = roots[:0]
+		for k := 0; k < 9; k++ {
+			nx, ny := x+k%3-1, y+k/3-1
+			if k == 4 || nx < 0 || ny < 0 || nx >= w || ny >= h {
+				continue
+			}
+			if b := lab[ny*w+nx]; b > 0 {
+				roots = appendRoot(roots, find(b))
+			}
+		}
+		if len(roots) == 0 {
+			b := int32(len(parent))
+			parent = append(parent, b)
+			peak = append(peak, d)
+			lab[i] = b
+			continue
+		}
+		// Merge the basins too shallow to stand apart into the ones with
+		// the higher peaks.
+		for j := 1; j < len(roots); j++ {
+			for k := 0; k < j; k++ {
+				a, b := find(roots[k]), find(roots[j])
+				if a == b {
+					continue
+				}
+				if peak[b] > peak[a] {
+					a, b = b, a
+				}
+				if peak[b]-d < depth {
+					parent[b] = a
+				}
+			}
+		}
+		b := find(roots[0])
+		for _, r := range roots[1:] {
+			if find(r) != b {
+				b = -1
+				break
+			}
+		}
+		lab[i] = b
+	}
+
+	l.L = make([]int32, w*h)
+	for i, b := range lab {
+		if b > 0 {
+			l.L[i] = find(b)
+		}
+	}
+	l.renumber()
+	return l
+}
+
+// appendRoot appends b to roots unless it is there already.
+func appendRoot(roots []int32, b int32) []int32 {
+	for _, r := range roots {
+		if r == b {
+			return roots
+		}
+	}
+	return append(roots, b)
+}
+
+// chamferUnit is the distance of the 3-4 chamfer between side neighbors.
+const chamferUnit = 3
+
+// chamfer returns the 3-4 chamfer distance of each set pixel of m, by row,
+// to the nearest clear pixel, the pixels around m being clear; 0 for clear
+// pixels. Diagonal steps count 4, side steps 3.
+func chamfer(m *Image) []int32 {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	d := make([]int32, w*h)
+	at := func(x, y int) int32 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		return d[y*w+x]
+	}
+	relax := func(v *int32, nx, ny int, step int32) {
+		if n := at(nx, ny) + step; n < *v {
+			*v = n
+		}
+	}
+	for y := 0; y < h; y++ {
+		row := m.Pix[y*m.Stride:]
+		for x := 0; x < w; x++ {
+			if !bitAt(row, x) {
+				continue
+			}
+			v := int32(math.MaxInt32)
+			relax(&v, x-1, y, 3)
+			relax(&v, x-1, y-1, 4)
+			relax(&v, x, y-1, 3)
+			relax(&v, x+1, y-1, 4)
+			d[y*w+x] = v
+		}
+	}
+	for y := h - 1; y >= 0; y-- {
+		for x := w - 1; x >= 0; x-- {
+			v := d[y*w+x]
+			if v == 0 {
+				continue
+			}
+			relax(&v, x+1, y, 3)
+			relax(&v, x+1, y+1, 4)
+			relax(&v, x, y+1, 3)
+			relax(&v, x-1, y+1, 4)
+			d[y*w+x] = v
+		}
+	}
+	return d
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package img1b
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// discs returns an image with discs of radius r set at the centers cs.
+func discs(b image.Rectangle, r int, cs ...image.Point) *Image {
+	m := New(b, color.Palette{color.White, color.Black})
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			for _, c := range cs {
+				if (x-c.X)*(x-c.X)+(y-c.Y)*(y-c.Y) <= r*r {
+					m.SetColorIndex(x, y, 1)
+				}
+			}
+		}
+	}
+	return m
+}
+
+func TestWatershed(t *testing.T) {
+	b := image.Rect(-10, 5, 90, 45)
+	for _, tc := range []struct {
+		name  string
+		m     *Image
+		label int
+		want  int
+	}{
+		{"one disc", discs(b, 12, image.Pt(30, 25)), 1, 1},
+		{"two apart", discs(b, 8, image.Pt(10, 25), image.Pt(50, 25)), 2, 2},
+		{"two touching", discs(b, 12, image.Pt(20, 25), image.Pt(40, 25)), 1, 2},
+		{"three in a row", discs(b, 10, image.Pt(10, 25), image.Pt(27, 25), image.Pt(44, 25)), 1, 3},
+		{"square", func() *Image {
+			m := New(b, color.Palette{color.White, color.Black})
+			for y := 10; y < 40; y++ {
+				for x := 0; x < 60; x++ {
+					m.SetColorIndex(x, y, 1)
+				}
+			}
+			return m
+		}(), 1, 1},
+	} {
+		if l := Label(tc.m); l.Count != tc.label {
+			t.Errorf("%s: Label found %d objects, want %d", tc.name, l.Count, tc.label)
+		}
+		l := Watershed(tc.m, nil)
+		if l.Count != tc.want {
+			t.Errorf("%s: Watershed found %d objects, want %d", tc.name, l.Count, tc.want)
+		}
+		// The objects are all of the blobs but for the lines between them.
+		a := l.Areas()
+		set := 0
+		for i := range l.L {
+			set += int(tc.m.ColorIndexAt(b.Min.X+i%b.Dx(), b.Min.Y+i/b.Dx()))
+		}
+		if lines := set - (len(l.L) - a[0]); lines < 0 || lines > 3*b.Dy()*(tc.want-1) {
+			t.Errorf("%s: %d pixels on lines", tc.name, lines)
+		}
+	}
+	// A deep enough neck keeps touching discs together.
+	if l := Watershed(discs(b, 12, image.Pt(20, 25), image.Pt(40, 25)), &WatershedOptions{Depth: 10}); l.Count != 1 {
+		t.Errorf("deep: got %d objects, want 1", l.Count)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package wbmp implements a decoder and encoder for WBMP (Wireless
+// Application Protocol bitmap) images.
+//
+// Only type 0 images, uncompressed bitmaps without extension headers, are
+// supported, which is the only type in use. Rows are packed most
+// significant bit first and padded to a byte, as in img1b, and clear bits
+// are black. Decoded images use the palette {black, white}, so the rows are
+// copied unchanged.
+//
+// The format is specified in the WAP Wireless Application Environment
+// Specification (WAP-190-WAESpec), section 6.
+package wbmp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+)
+
+// A FormatError reports that the input is not a valid WBMP image.
+type FormatError string
+
+func (e FormatError) Error() string { return "wbmp: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "wbmp: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of WBMP images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their header is read.
+	Limits *img1b.Limits
+}
+
+// palette returns the palette of decoded images: clear bits are black.
+func palette() color.Palette {
+	return color.Palette{color.Black, color.White}
+}
+
+type decoder struct {
+	r             *bufio.Reader
+	width, height int
+	limits        *img1b.Limits
+}
+
+// readUint reads a multi-byte integer: groups of 7 bits, most significant
+// first, with the high bit set in all bytes but the last.
+func (d *decoder) readUint() (int, error) {
+	n := 0
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if n > (1<<31-1)>>7 {
+			return 0, FormatError("number too large")
+		}
+		n = n<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return n, nil
+		}
+	}
+}
+
+func (d *decoder) parseHeader() error {
+	typ, err := d.readUint()
+	if err != nil {
+		return err
+	}
+	if typ != 0 {
+		return UnsupportedError(fmt.Sprintf("type %d", typ))
+	}
+	fix, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if fix&0x80 != 0 {
+		return UnsupportedError("extension headers")
+	}
+	if fix != 0 {
+		return FormatError("bad fixed header")
+	}
+	if d.width, err = d.readUint(); err != nil {
+		return err
+	}
+	if d.height, err = d.readUint(); err != nil {
+		return err
+	}
+	if d.width == 0 || d.height == 0 {
+		return FormatError("zero dimension")
+	}
+	if n := int64(d.width) * int64(d.height); n != int64(int(n)) {
+		return UnsupportedError("dimension overflow")
+	}
+	return nil
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), palette())
+	if err != nil {
+		return nil, err
+	}
+	rowBytes := (d.width + 7) / 8
+	tm := bitmap.TailMask(d.width)
+	for y := 0; y < d.height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+		if _, err := io.ReadFull(d.r, row); err != nil {
+			return nil, err
+		}
+		row[rowBytes-1] &= tm
+	}
+	return img, nil
+}
+
+// Decode reads a WBMP image from r and returns it as an img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads a WBMP image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d := &decoder{r: bufio.NewReader(r), limits: dec.Limits}
+	err := d.parseHeader()
+	var img *img1b.Image
+	if err == nil {
+		img, err = d.decode()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeConfig returns the color model and dimensions of a WBMP image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.parseHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: palette(),
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wbmp
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// testWBMP is a 10x3 image: "#.#.#.#.##", "..........", "##########" with
+// '#' black.
+const testWBMP = "\x00\x00\x0a\x03\x55\x3f\xff\xff\x00\x00"
+
+func TestDecode(t *testing.T) {
+	m, err := Decode(strings.NewReader(testWBMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 10, 3) {
+		t.Fatalf("got bounds %v", m.Bounds())
+	}
+	want := []string{"#.#.#.#.##", "..........", "##########"}
+	for y, row := range want {
+		for x := range row {
+			c := color.Color(color.White)
+			if row[x] == '#' {
+				c = color.Black
+			}
+			if got := m.At(x, y); got != c {
+				t.Fatalf("at (%d, %d) got %v, want %v", x, y, got, c)
+			}
+		}
+	}
+	if m.Pix[1]&0x3f != 0 {
+		t.Error("padding bits are not clear")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m, err := Decode(strings.NewReader(testWBMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "\x00\x00\x0a\x03\x55\x00\xff\xc0\x00\x00" {
+		t.Errorf("got %q", b.String())
+	}
+
+	// Inverted palette and a large width.
+	inv := img1b.New(image.Rect(0, 0, 200, 2), color.Palette{color.White, color.Black})
+	inv.SetColorIndex(3, 1, 1)
+	b.Reset()
+	if err := Encode(&b, inv); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Bytes()[:6]; !bytes.Equal(got, []byte{0, 0, 0x81, 0x48, 0x02, 0xff}) {
+		t.Errorf("got header % x", got)
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 200; x++ {
+			if m1.At(x, y) != inv.At(x, y) {
+				t.Fatalf("at (%d, %d): got %v, want %v", x, y, m1.At(x, y), inv.At(x, y))
+			}
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	cfg, err := DecodeConfig(strings.NewReader(testWBMP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 10 || cfg.Height != 3 {
+		t.Errorf("got %dx%d, want 10x3", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{"", "unexpected EOF"},
+		{"\x02\x00\x01\x01\x00", "type 2"},
+		{"\x00\x80\x01\x01\x00", "extension headers"},
+		{"\x00\x00\x00\x01", "zero dimension"},
+		{"\x00\x00\xff\xff\xff\xff\xff\x7f", "number too large"},
+		{testWBMP[:len(testWBMP)-1], "unexpected EOF"},
+	} {
+		m, err := Decode(strings.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("decoding %q: got %v, want %s", tt.data, err, tt.err)
+		}
+		if m != nil {
+			t.Errorf("decoding %q: have image + error", tt.data)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 30}}
+	if _, err := d.Decode(strings.NewReader(testWBMP)); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	// The header is enough: 100000x100000 and no rows.
+	_, err := d.Decode(strings.NewReader("\x00\x00\x86\x8d\x20\x86\x8d\x20"))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wbmp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+)
+
+// appendUint appends n as a multi-byte integer.
+func appendUint(b []byte, n int) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		tmp[i] = byte(n&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
+
+// Encode writes the Image m to w in WBMP format. The darker palette color
+// is written as black.
+func Encode(w io.Writer, m *img1b.Image) error {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || int64(b.Dx()) >= 1<<31 || int64(b.Dy()) >= 1<<31 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	h := []byte{0, 0} // type 0, no extension headers
+	h = appendUint(h, b.Dx())
+	h = appendUint(h, b.Dy())
+
+	bw := bufio.NewWriter(w)
+	bw.Write(h)
+	var xor byte
+	if bitmap.BlackIndex(m.Palette) == 1 {
+		xor = 0xff
+	}
+	rowBytes := (b.Dx() + 7) / 8
+	row := make([]byte, rowBytes)
+	tm := bitmap.TailMask(b.Dx())
+	for y := 0; y < b.Dy(); y++ {
+		copy(row, m.Pix[y*m.Stride:y*m.Stride+rowBytes])
+		for i := range row {
+			row[i] ^= xor
+		}
+		row[rowBytes-1] &= tm
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
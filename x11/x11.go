@@ -0,0 +1,150 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package x11 converts images to and from the XYBitmap image data of the
+// X Window System, laid out as a server asks in its connection setup, so
+// that they can be sent with PutImage against any server.
+//
+// The rows of the data are split in scanline units of 8, 16 or 32 bits,
+// which hold their pixels from the most or the least significant bit and
+// are stored most or least significant byte first, and are padded to a
+// multiple of the scanline pad. The bits are the color indices of the
+// image: with XYBitmap, set bits are drawn in the foreground of the GC and
+// clear ones in its background, which are to be the colors 1 and 0 of the
+// palette.
+package x11
+
+import (
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// A FormatError reports that the format, the dimensions or the data are not
+// valid.
+type FormatError string
+
+func (e FormatError) Error() string { return "x11: invalid format: " + string(e) }
+
+// Format holds the bitmap format parameters of a server.
+type Format struct {
+	// Unit is the bitmap-scanline-unit: 8, 16 or 32.
+	Unit int
+	// Pad is the bitmap-scanline-pad: 8, 16 or 32, at least Unit.
+	Pad int
+	// LSBFirst is the bitmap-format-bit-order: whether the leftmost pixel
+	// of a unit is its least significant bit.
+	LSBFirst bool
+	// LSBFirstBytes is the image-byte-order: whether units are stored
+	// least significant byte first.
+	LSBFirstBytes bool
+}
+
+// check returns an error if f is not a valid format.
+func (f *Format) check() error {
+	switch f.Unit {
+	case 8, 16, 32:
+	default:
+		return FormatError(fmt.Sprintf("bad scanline unit %d", f.Unit))
+	}
+	switch f.Pad {
+	case 8, 16, 32:
+	default:
+		return FormatError(fmt.Sprintf("bad scanline pad %d", f.Pad))
+	}
+	if f.Pad < f.Unit {
+		return FormatError("scanline pad smaller than unit")
+	}
+	return nil
+}
+
+// BytesPerLine returns the number of bytes of a row of the given width.
+func (f *Format) BytesPerLine(width int) int {
+	return (width + f.Pad - 1) / f.Pad * f.Pad / 8
+}
+
+// convert converts the units of a row, in place, between MSB-first bytes
+// and the layout of f. The conversion is its own inverse.
+func (f *Format) convert(row []byte) {
+	n := f.Unit / 8
+	switch {
+	case !f.LSBFirst && (!f.LSBFirstBytes || n == 1):
+		// The layout of img1b.
+	case f.LSBFirst && (f.LSBFirstBytes || n == 1):
+		// Reversing the bits of a unit reverses its bytes, which the
+		// byte order reverses back.
+		img1b.ReverseBits(row)
+	default:
+		// Reverse the bytes of each unit, and the bits of the bytes for
+		// LSBFirst bits with MSBFirst bytes.
+		for i := 0; i+n <= len(row); i += n {
+			u := row[i : i+n]
+			for j := 0; j < n/2; j++ {
+				u[j], u[n-1-j] = u[n-1-j], u[j]
+			}
+			if f.LSBFirst {
+				for j := range u {
+					u[j] = bits.Reverse8(u[j])
+				}
+			}
+		}
+	}
+}
+
+// ToXYBitmap returns the pixels of m as XYBitmap data in the format f, and
+// its bytes per line. The padding bits are zero.
+func ToXYBitmap(m *img1b.Image, f *Format) (data []byte, bytesPerLine int, err error) {
+	if err := f.check(); err != nil {
+		return nil, 0, err
+	}
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	bpl := f.BytesPerLine(w)
+	data = make([]byte, bpl*h)
+	if w == 0 {
+		return data, bpl, nil
+	}
+	n := (w + 7) / 8
+	tm := bitmap.TailMask(w)
+	for y := 0; y < h; y++ {
+		row := data[y*bpl : (y+1)*bpl]
+		copy(row, m.Pix[y*m.Stride:y*m.Stride+n])
+		row[n-1] &= tm
+		f.convert(row)
+	}
+	return data, bpl, nil
+}
+
+// FromXYBitmap returns a new image of the given size from XYBitmap data,
+// or a single plane of XYPixmap data, in the format f, with rows
+// bytesPerLine apart. The palette is {white, black}, for set bits in the
+// black foreground.
+func FromXYBitmap(data []byte, width, height, bytesPerLine int, f *Format) (*img1b.Image, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, FormatError(fmt.Sprintf("invalid size: %dx%d", width, height))
+	}
+	if bytesPerLine < f.BytesPerLine(width) || bytesPerLine%(f.Unit/8) != 0 {
+		return nil, FormatError(fmt.Sprintf("bad bytes per line %d for width %d", bytesPerLine, width))
+	}
+	if int64(bytesPerLine)*int64(height) > int64(len(data)) {
+		return nil, FormatError("short data")
+	}
+	m := img1b.New(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	n := (width + 7) / 8
+	tm := bitmap.TailMask(width)
+	line := make([]byte, bytesPerLine)
+	for y := 0; y < height; y++ {
+		copy(line, data[y*bytesPerLine:])
+		f.convert(line)
+		row := m.Pix[y*m.Stride : y*m.Stride+n]
+		copy(row, line)
+		row[n-1] &= tm
+	}
+	return m, nil
+}
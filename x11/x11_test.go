@@ -0,0 +1,101 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x11
+
+import (
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// pixel returns the pixel at (x, y) of XYBitmap data as a server reads it:
+// the unit holding it is assembled in the byte order, then the pixel is
+// picked in the bit order.
+func pixel(data []byte, bpl, x, y int, f *Format) uint8 {
+	n := f.Unit / 8
+	u := data[y*bpl+x/f.Unit*n:]
+	var v uint32
+	for i := 0; i < n; i++ {
+		j := i
+		if f.LSBFirstBytes {
+			j = n - 1 - i
+		}
+		v = v<<8 | uint32(u[j])
+	}
+	k := x % f.Unit
+	if !f.LSBFirst {
+		k = f.Unit - 1 - k
+	}
+	return uint8(v >> uint(k) & 1)
+}
+
+func TestRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, unit := range []int{8, 16, 32} {
+		for _, pad := range []int{8, 16, 32} {
+			if pad < unit {
+				continue
+			}
+			for _, order := range []int{0, 1, 2, 3} {
+				f := &Format{Unit: unit, Pad: pad, LSBFirst: order&1 != 0, LSBFirstBytes: order&2 != 0}
+				for _, w := range []int{1, 9, 16, 33} {
+					m := img1b.New(image.Rect(0, 0, w, 3), color.Palette{color.White, color.Black})
+					r.Read(m.Pix)
+					data, bpl, err := ToXYBitmap(m, f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if bpl*8%pad != 0 || bpl*8 < w || len(data) != 3*bpl {
+						t.Fatalf("%+v, width %d: %d bytes per line, %d bytes", f, w, bpl, len(data))
+					}
+					for y := 0; y < 3; y++ {
+						for x := 0; x < 8*bpl; x++ {
+							want := uint8(0)
+							if x < w {
+								want = m.ColorIndexAt(x, y)
+							}
+							if got := pixel(data, bpl, x, y, f); got != want {
+								t.Fatalf("%+v, width %d: (%d, %d) is %d, want %d", f, w, x, y, got, want)
+							}
+						}
+					}
+					back, err := FromXYBitmap(data, w, 3, bpl, f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					for y := 0; y < 3; y++ {
+						for x := 0; x < w; x++ {
+							if back.ColorIndexAt(x, y) != m.ColorIndexAt(x, y) {
+								t.Fatalf("%+v, width %d: back at (%d, %d) differs", f, w, x, y)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 8, 1), color.Palette{color.White, color.Black})
+	for _, f := range []Format{{Unit: 8, Pad: 12}, {Unit: 24, Pad: 32}, {Unit: 32, Pad: 16}} {
+		if _, _, err := ToXYBitmap(m, &f); err == nil {
+			t.Errorf("%+v: no error", f)
+		}
+	}
+	f := &Format{Unit: 16, Pad: 32}
+	for _, tc := range []struct{ n, w, h, bpl int }{
+		{4, 0, 1, 4},
+		{8, 40, 2, 4},
+		{8, 8, 2, 6},
+		{7, 8, 2, 4},
+	} {
+		if _, err := FromXYBitmap(make([]byte, tc.n), tc.w, tc.h, tc.bpl, f); err == nil {
+			t.Errorf("%+v: no error", tc)
+		}
+	}
+}
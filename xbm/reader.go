@@ -0,0 +1,192 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xbm implements an XBM image decoder and encoder.
+//
+// XBM images are C source fragments declaring the image dimensions and an
+// array of bytes (or 16-bit words in the older X10 flavor) holding the rows.
+// Bits are stored least significant first and set bits are foreground
+// (black) pixels. Decoded images use the palette {white, black}.
+package xbm
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"strconv"
+)
+
+// A FormatError reports that the input is not a valid XBM.
+type FormatError string
+
+func (e FormatError) Error() string { return "xbm: invalid format: " + string(e) }
+
+// Decoder configures decoding of XBM images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError before the
+	// bits are read.
+	Limits *img1b.Limits
+}
+
+// palette returns the palette of decoded images.
+func palette() color.Palette {
+	return color.Palette{color.White, color.Black}
+}
+
+type decoder struct {
+	src           []byte
+	width, height int
+	wordSize      int // 1 for X11 char arrays, 2 for X10 short arrays
+	data          []byte
+	limits        *img1b.Limits
+}
+
+// parseHeader finds the dimensions and the array of bits in the source.
+func (d *decoder) parseHeader() error {
+	i := bytes.Index(d.src, []byte("_bits[]"))
+	if i < 0 {
+		return FormatError("missing bits array")
+	}
+	j := bytes.IndexByte(d.src[i:], '{')
+	if j < 0 {
+		return FormatError("missing bits array")
+	}
+	d.data = d.src[i+j+1:]
+	// The element type is on the same line as the array name.
+	ls := bytes.LastIndexByte(d.src[:i], '\n') + 1
+	d.wordSize = 1
+	if bytes.Contains(d.src[ls:i], []byte("short")) {
+		d.wordSize = 2
+	}
+
+	d.width, d.height = -1, -1
+	for _, line := range bytes.Split(d.src[:ls], []byte("\n")) {
+		f := bytes.Fields(line)
+		if len(f) != 3 || string(f[0]) != "#define" {
+			continue
+		}
+		n, err := strconv.Atoi(string(f[2]))
+		if err != nil {
+			return FormatError("bad #define value")
+		}
+		switch {
+		case bytes.HasSuffix(f[1], []byte("_width")):
+			d.width = n
+		case bytes.HasSuffix(f[1], []byte("_height")):
+			d.height = n
+		}
+	}
+	if d.width < 0 || d.height < 0 {
+		return FormatError("missing dimensions")
+	}
+	if d.width == 0 || d.height == 0 {
+		return FormatError("non-positive dimension")
+	}
+	nPixels := int64(d.width) * int64(d.height)
+	if nPixels != int64(int(nPixels)) {
+		return FormatError("dimension overflow")
+	}
+	return nil
+}
+
+// nextValue parses the next number of the array.
+func (d *decoder) nextValue() (uint16, error) {
+	s := d.data
+	for len(s) > 0 && (s[0] == ',' || s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r') {
+		s = s[1:]
+	}
+	i := 0
+	for i < len(s) && s[i] != ',' && s[i] != '}' && s[i] != ' ' && s[i] != '\t' && s[i] != '\n' && s[i] != '\r' {
+		i++
+	}
+	if i == 0 {
+		if len(s) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, FormatError("not enough data")
+	}
+	v, err := strconv.ParseUint(string(s[:i]), 0, 16)
+	if err != nil || (d.wordSize == 1 && v > 0xff) {
+		return 0, FormatError("bad array value")
+	}
+	d.data = s[i:]
+	return uint16(v), nil
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), palette())
+	if err != nil {
+		return nil, err
+	}
+	rowBytes := (d.width + 7) / 8
+	// Rows are padded to the word size.
+	rowWords := (rowBytes + d.wordSize - 1) / d.wordSize
+	tm := bitmap.TailMask(d.width)
+	for y := 0; y < d.height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+		for i := 0; i < rowWords; i++ {
+			v, err := d.nextValue()
+			if err != nil {
+				return nil, err
+			}
+			for j := 0; j < d.wordSize; j++ {
+				if k := i*d.wordSize + j; k < rowBytes {
+					row[k] = bits.Reverse8(byte(v >> uint(8*j)))
+				}
+			}
+		}
+		row[rowBytes-1] &= tm
+	}
+	return img, nil
+}
+
+func newDecoder(r io.Reader) (*decoder, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{src: src}
+	if err := d.parseHeader(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Decode reads an XBM image from r and returns it as an img1b.Image.
+// Hotspot definitions are ignored.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads an XBM image from r and returns it as an img1b.Image.
+// Hotspot definitions are ignored.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	d.limits = dec.Limits
+	return d.decode()
+}
+
+// DecodeConfig returns the color model and dimensions of an XBM image without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: palette(),
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
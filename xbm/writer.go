@@ -0,0 +1,80 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xbm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"io"
+	"math/bits"
+)
+
+// Encoder configures encoding XBM images.
+type Encoder struct {
+	// Name is the prefix of the C identifiers. If empty, "image" is used.
+	Name string
+
+	// Hotspot, if not nil, is written as the x_hot and y_hot definitions.
+	// It is relative to the image's top-left corner.
+	Hotspot *image.Point
+}
+
+// Encode writes the Image m to w in XBM format. The darker palette color is
+// written as foreground.
+func Encode(w io.Writer, m *img1b.Image) error {
+	var e Encoder
+	return e.Encode(w, m)
+}
+
+// Encode writes the Image m to w in XBM format. The darker palette color is
+// written as foreground.
+func (enc *Encoder) Encode(w io.Writer, m *img1b.Image) error {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	name := enc.Name
+	if name == "" {
+		name = "image"
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#define %s_width %d\n#define %s_height %d\n", name, b.Dx(), name, b.Dy())
+	if enc.Hotspot != nil {
+		fmt.Fprintf(bw, "#define %s_x_hot %d\n#define %s_y_hot %d\n", name, enc.Hotspot.X, name, enc.Hotspot.Y)
+	}
+	fmt.Fprintf(bw, "static unsigned char %s_bits[] = {", name)
+
+	var xor byte
+	if bitmap.BlackIndex(m.Palette) == 0 {
+		xor = 0xff
+	}
+	rowBytes := (b.Dx() + 7) / 8
+	tm := bitmap.TailMask(b.Dx())
+	n := 0
+	for y := 0; y < b.Dy(); y++ {
+		row := m.Pix[y*m.Stride : y*m.Stride+rowBytes]
+		for i, c := range row {
+			c ^= xor
+			if i == rowBytes-1 {
+				c &= tm
+			}
+			sep := ", "
+			if n == 0 {
+				sep = ""
+			}
+			if n%12 == 0 {
+				sep += "\n   "
+			}
+			fmt.Fprintf(bw, "%s0x%02x", sep, bits.Reverse8(c))
+			n++
+		}
+	}
+	io.WriteString(bw, "};\n")
+	return bw.Flush()
+}
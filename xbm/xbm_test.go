@@ -0,0 +1,132 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xbm
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const testXBM = `#define test_width 10
+#define test_height 3
+#define test_x_hot 1
+#define test_y_hot 2
+static unsigned char test_bits[] = {
+   0x55, 0x03, 0x00, 0x00, 0xff, 0x03};
+`
+
+const testX10 = `#define test_width 10
+#define test_height 3
+static short test_bits[] = {
+   0x0355, 0x0000, 0x03ff};
+`
+
+// pattern is the image above, '#' is black.
+var pattern = []string{
+	"#.#.#.#.##",
+	"..........",
+	"##########",
+}
+
+func check(t *testing.T, name string, m *img1b.Image) {
+	b := m.Bounds()
+	if b.Dx() != len(pattern[0]) || b.Dy() != len(pattern) {
+		t.Fatalf("%s: bounds %v", name, b)
+	}
+	for y, row := range pattern {
+		for x := range row {
+			want := color.Color(color.White)
+			if row[x] == '#' {
+				want = color.Black
+			}
+			if got := m.At(x, y); got != want {
+				t.Fatalf("%s: at (%d, %d) got %v, want %v", name, x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, s := range []string{testXBM, testX10} {
+		m, err := Decode(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, s, m)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m, err := Decode(strings.NewReader(testXBM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	e := Encoder{Name: "test", Hotspot: &image.Point{1, 2}}
+	if err := e.Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != testXBM {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), testXBM)
+	}
+
+	// Inverted palette.
+	inv := &img1b.Image{Pix: append([]byte(nil), m.Pix...), Stride: m.Stride, Rect: m.Rect, Palette: color.Palette{color.Black, color.White}}
+	for i := range inv.Pix {
+		inv.Pix[i] = ^inv.Pix[i]
+	}
+	b.Reset()
+	if err := Encode(&b, inv); err != nil {
+		t.Fatal(err)
+	}
+	m, err = Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, "inverted", m)
+}
+
+var decodeErrors = []struct {
+	data string
+	err  string
+}{
+	{"", "missing bits array"},
+	{"static char x_bits[] = {0};", "missing dimensions"},
+	{"#define x_width 8\n#define x_height 2\nstatic char x_bits[] = {0x00", "unexpected EOF"},
+	{"#define x_width 8\n#define x_height 2\nstatic char x_bits[] = {0x00};", "not enough data"},
+	{"#define x_width 8\n#define x_height 1\nstatic char x_bits[] = {0x100};", "bad array value"},
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tt := range decodeErrors {
+		m, err := Decode(strings.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("decoding %q: missing error", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("decoding %q: %s, want %s", tt.data, err, tt.err)
+		}
+		if m != nil {
+			t.Errorf("decoding %q: have image + error", tt.data)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 30}}
+	if _, err := d.Decode(strings.NewReader(testXBM)); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	huge := strings.Replace(testXBM, "test_height 3", "test_height 100000", 1)
+	_, err := d.Decode(strings.NewReader(huge))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xpm implements a decoder and encoder for XPM images (both the XPM3
+// C source flavor and the plain XPM2 one) that use at most two colors.
+//
+// Colors are mapped to palette indices in the order they are defined in the
+// file.
+package xpm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A FormatError reports that the input is not a valid XPM.
+type FormatError string
+
+func (e FormatError) Error() string { return "xpm: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "xpm: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of XPM images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError before the
+	// pixels are read.
+	Limits *img1b.Limits
+}
+
+// namedColors are the color names accepted in addition to #RGB values.
+var namedColors = map[string]color.Color{
+	"none":        color.Transparent,
+	"black":       color.Black,
+	"white":       color.White,
+	"gray":        color.Gray{0xbe},
+	"grey":        color.Gray{0xbe},
+	"red":         color.RGBA{0xff, 0x00, 0x00, 0xff},
+	"green":       color.RGBA{0x00, 0xff, 0x00, 0xff},
+	"blue":        color.RGBA{0x00, 0x00, 0xff, 0xff},
+	"yellow":      color.RGBA{0xff, 0xff, 0x00, 0xff},
+	"cyan":        color.RGBA{0x00, 0xff, 0xff, 0xff},
+	"magenta":     color.RGBA{0xff, 0x00, 0xff, 0xff},
+	"transparent": color.Transparent,
+}
+
+type decoder struct {
+	lines         []string
+	width, height int
+	ncolors       int
+	cpp           int
+	palette       color.Palette
+	keys          map[string]uint8
+	limits        *img1b.Limits
+}
+
+// splitXPM3 returns the string literals of an XPM3 C source.
+func splitXPM3(src []byte) ([]string, error) {
+	var lines []string
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '/':
+			if i+1 < len(src) && src[i+1] == '*' {
+				j := bytes.Index(src[i+2:], []byte("*/"))
+				if j < 0 {
+					return nil, FormatError("unterminated comment")
+				}
+				i += j + 3
+			}
+		case '"':
+			var b []byte
+			for i++; ; i++ {
+				if i >= len(src) || src[i] == '\n' {
+					return nil, FormatError("unterminated string")
+				}
+				if src[i] == '"' {
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				b = append(b, src[i])
+			}
+			lines = append(lines, string(b))
+		}
+	}
+	return lines, nil
+}
+
+func (d *decoder) parse(src []byte) error {
+	var err error
+	switch {
+	case bytes.HasPrefix(src, []byte("! XPM2")):
+		d.lines = strings.Split(strings.Replace(string(src), "\r\n", "\n", -1), "\n")[1:]
+	case bytes.Contains(src, []byte("XPM")):
+		if d.lines, err = splitXPM3(src); err != nil {
+			return err
+		}
+	default:
+		return FormatError("not an XPM file")
+	}
+	if len(d.lines) == 0 {
+		return FormatError("missing values")
+	}
+
+	f := strings.Fields(d.lines[0])
+	if len(f) < 4 {
+		return FormatError("bad values")
+	}
+	v := make([]int, 4)
+	for i := range v {
+		if v[i], err = strconv.Atoi(f[i]); err != nil || v[i] <= 0 {
+			return FormatError("bad values")
+		}
+	}
+	d.width, d.height, d.ncolors, d.cpp = v[0], v[1], v[2], v[3]
+	if d.ncolors > 2 {
+		return UnsupportedError(fmt.Sprintf("%d colors", d.ncolors))
+	}
+	nPixels := int64(d.width) * int64(d.height)
+	if nPixels != int64(int(nPixels)) || int64(d.width)*int64(d.cpp) != int64(int(int64(d.width)*int64(d.cpp))) {
+		return UnsupportedError("dimension overflow")
+	}
+	if len(d.lines) < 1+d.ncolors {
+		return FormatError("missing colors")
+	}
+
+	d.keys = make(map[string]uint8)
+	for i, line := range d.lines[1 : 1+d.ncolors] {
+		if len(line) < d.cpp {
+			return FormatError("bad color definition")
+		}
+		c, err := parseColor(strings.Fields(line[d.cpp:]))
+		if err != nil {
+			return err
+		}
+		d.keys[line[:d.cpp]] = uint8(i)
+		d.palette = append(d.palette, c)
+	}
+	d.lines = d.lines[1+d.ncolors:]
+	return nil
+}
+
+// parseColor picks the color value from the key/value pairs of a color
+// definition, preferring the color visual.
+func parseColor(f []string) (color.Color, error) {
+	values := make(map[string]string)
+	for i := 0; i+1 < len(f); {
+		key := f[i]
+		// Color names may contain spaces; the value lasts until the next key.
+		j := i + 2
+		for j < len(f) && !isKey(f[j]) {
+			j++
+		}
+		values[key] = strings.Join(f[i+1:j], " ")
+		i = j
+	}
+	for _, key := range []string{"c", "g", "g4", "m"} {
+		if s, ok := values[key]; ok {
+			return parseColorValue(s)
+		}
+	}
+	return nil, FormatError("missing color value")
+}
+
+func isKey(s string) bool {
+	switch s {
+	case "c", "g", "g4", "m", "s":
+		return true
+	}
+	return false
+}
+
+func parseColorValue(s string) (color.Color, error) {
+	if s[0] != '#' {
+		if c, ok := namedColors[strings.ToLower(strings.Replace(s, " ", "", -1))]; ok {
+			return c, nil
+		}
+		return nil, UnsupportedError("color name " + s)
+	}
+	h := s[1:]
+	if len(h) == 0 || len(h)%3 != 0 || len(h) > 12 {
+		return nil, FormatError("bad color value " + s)
+	}
+	n := len(h) / 3
+	var rgb [3]uint32
+	for i := range rgb {
+		v, err := strconv.ParseUint(h[i*n:(i+1)*n], 16, 16)
+		if err != nil {
+			return nil, FormatError("bad color value " + s)
+		}
+		// Scale to 16 bits.
+		rgb[i] = uint32(v) * 0xffff / (1<<uint(4*n) - 1)
+	}
+	return color.RGBA64{uint16(rgb[0]), uint16(rgb[1]), uint16(rgb[2]), 0xffff}, nil
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	if len(d.lines) < d.height {
+		return nil, FormatError("not enough pixel data")
+	}
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), d.palette)
+	if err != nil {
+		return nil, err
+	}
+	for y := 0; y < d.height; y++ {
+		line := d.lines[y]
+		if len(line) < d.width*d.cpp {
+			return nil, FormatError("short pixel row")
+		}
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < d.width; x++ {
+			i, ok := d.keys[line[x*d.cpp:(x+1)*d.cpp]]
+			if !ok {
+				return nil, FormatError("undefined pixel")
+			}
+			row[x/8] |= i << uint(7-x%8)
+		}
+	}
+	return img, nil
+}
+
+// Decode reads an XPM image from r and returns it as an img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads an XPM image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{limits: dec.Limits}
+	if err := d.parse(src); err != nil {
+		return nil, err
+	}
+	return d.decode()
+}
+
+// DecodeConfig returns the color model and dimensions of an XPM image without
+// decoding the pixels.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	d := &decoder{}
+	if err := d.parse(src); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: d.palette,
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
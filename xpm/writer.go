@@ -0,0 +1,97 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xpm
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"image/color"
+	"io"
+)
+
+// Encoder configures encoding XPM images.
+type Encoder struct {
+	// Name is the name of the C array. If empty, "image" is used.
+	Name string
+
+	// XPM2 selects the plain XPM2 flavor instead of XPM3 C source.
+	XPM2 bool
+}
+
+// pixelChars are the characters used for palette indices 0 and 1.
+const pixelChars = ".#"
+
+// Encode writes the Image m to w in XPM3 format.
+func Encode(w io.Writer, m *img1b.Image) error {
+	var e Encoder
+	return e.Encode(w, m)
+}
+
+// Encode writes the Image m to w in XPM format.
+func (enc *Encoder) Encode(w io.Writer, m *img1b.Image) error {
+	b := m.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return FormatError(fmt.Sprintf("invalid image size: %dx%d", b.Dx(), b.Dy()))
+	}
+	ncolors := len(m.Palette)
+	if ncolors < 1 || ncolors > 2 {
+		return FormatError(fmt.Sprintf("bad palette length: %d", ncolors))
+	}
+	if ncolors == 1 {
+		// Only the character of index 0 gets a color.
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if m.ColorIndexAt(x, y) != 0 {
+					return FormatError(fmt.Sprintf("pixel (%d, %d) is out of the palette", x, y))
+				}
+			}
+		}
+	}
+	name := enc.Name
+	if name == "" {
+		name = "image"
+	}
+
+	bw := bufio.NewWriter(w)
+	// line writes a line of XPM data, quoted as needed.
+	line := func(s string, last bool) {
+		if enc.XPM2 {
+			fmt.Fprintf(bw, "%s\n", s)
+			return
+		}
+		sep := ","
+		if last {
+			sep = "\n};"
+		}
+		fmt.Fprintf(bw, "\"%s\"%s\n", s, sep)
+	}
+
+	if enc.XPM2 {
+		io.WriteString(bw, "! XPM2\n")
+	} else {
+		fmt.Fprintf(bw, "/* XPM */\nstatic char *%s[] = {\n", name)
+	}
+	line(fmt.Sprintf("%d %d %d 1", b.Dx(), b.Dy(), ncolors), false)
+	for i, c := range m.Palette {
+		line(fmt.Sprintf("%c c %s", pixelChars[i], colorValue(c)), false)
+	}
+	row := make([]byte, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := range row {
+			row[x] = pixelChars[m.ColorIndexAt(b.Min.X+x, y)&1]
+		}
+		line(string(row), y == b.Max.Y-1)
+	}
+	return bw.Flush()
+}
+
+func colorValue(c color.Color) string {
+	c1 := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if c1.A == 0 {
+		return "None"
+	}
+	return fmt.Sprintf("#%02X%02X%02X", c1.R, c1.G, c1.B)
+}
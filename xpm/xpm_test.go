@@ -0,0 +1,148 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xpm
+
+import (
+	"bytes"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const testXPM3 = `/* XPM */
+static char *test[] = {
+"10 3 2 1",
+". c #FFFFFF",
+"# c #000000",
+"#.#.#.#.##",
+"..........",
+"##########"
+};
+`
+
+const testXPM2 = `! XPM2
+10 3 2 2
+ab c None
+cd s fg c #00f m black
+cdabcdabcdabcdabcdcd
+abababababababababab
+cdcdcdcdcdcdcdcdcdcd
+`
+
+// pattern is the image above, '#' is index 1.
+var pattern = []string{
+	"#.#.#.#.##",
+	"..........",
+	"##########",
+}
+
+func TestDecode(t *testing.T) {
+	for _, s := range []string{testXPM3, testXPM2} {
+		m, err := Decode(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y, row := range pattern {
+			for x := range row {
+				want := uint8(0)
+				if row[x] == '#' {
+					want = 1
+				}
+				if got := m.ColorIndexAt(x, y); got != want {
+					t.Fatalf("at (%d, %d) got %d, want %d", x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeColors(t *testing.T) {
+	m, err := Decode(strings.NewReader(testXPM2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, a := m.Palette[0].RGBA(); a != 0 {
+		t.Errorf("color 0: got alpha %d, want 0", a)
+	}
+	if want := (color.RGBA64{0, 0, 0xffff, 0xffff}); m.Palette[1] != want {
+		t.Errorf("color 1: got %v, want %v", m.Palette[1], want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m, err := Decode(strings.NewReader(testXPM3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	e := Encoder{Name: "test"}
+	if err := e.Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != testXPM3 {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), testXPM3)
+	}
+
+	b.Reset()
+	e.XPM2 = true
+	if err := e.Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	m1, err := Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.Pix, m1.Pix) {
+		t.Error("XPM2 round trip differs")
+	}
+}
+
+func TestEncodeOneColor(t *testing.T) {
+	m := img1b.New(image.Rect(0, 0, 9, 2), color.Palette{color.White})
+	var b bytes.Buffer
+	if err := Encode(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(&b); err != nil {
+		t.Error(err)
+	}
+	m.SetColorIndex(8, 1, 1)
+	err := Encode(new(bytes.Buffer), m)
+	if err == nil || !strings.Contains(err.Error(), "(8, 1)") {
+		t.Errorf("got %v, want out of the palette error", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{"", "not an XPM file"},
+		{"! XPM2\n1 1 3 1\n", "3 colors"},
+		{"! XPM2\n1 1 1 1\n. c chartreuse\n.\n", "color name"},
+		{"! XPM2\n2 1 1 1\n. c #000\n.\n", "short pixel row"},
+		{"! XPM2\n2 1 1 1\n. c #000\n.x\n", "undefined pixel"},
+	} {
+		_, err := Decode(strings.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("decoding %q: got %v, want %s", tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: 30}}
+	if _, err := d.Decode(strings.NewReader(testXPM3)); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	// A single short row is enough.
+	_, err := d.Decode(strings.NewReader("! XPM2\n100000 1 1 1\n. c #000\n.\n"))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xwd implements a decoder for 1-bit X Window System window dumps
+// (XWD), as written by xwd(1).
+//
+// Only version 7 dumps of depth 1 are supported, in any pixmap format, as
+// these hold a single bit plane. The scanline unit, byte order, bit order
+// and pad of the dumping server are all honored, so are dumps written with
+// either header byte order.
+//
+// Decoded images take their palette from the dump's colormap. Dumps
+// without one use the palette {white, black}: set bits are black.
+//
+// The format is defined by the XWDFileHeader structure in X11/XWDFile.h.
+package xwd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math/bits"
+)
+
+// A FormatError reports that the input is not a valid XWD image.
+type FormatError string
+
+func (e FormatError) Error() string { return "xwd: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid but unimplemented
+// feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "xwd: unsupported feature: " + string(e) }
+
+// Decoder configures decoding of XWD images.
+type Decoder struct {
+	// Limits, if not nil, bounds the size of the images decoded. Images
+	// over the limits are rejected with an img1b.LimitError as soon as
+	// their header is read.
+	Limits *img1b.Limits
+}
+
+const (
+	headerLen   = 100 // 25 32-bit fields
+	fileVersion = 7
+	colorLen    = 12
+)
+
+// Header fields, as indices of 32-bit words.
+const (
+	hHeaderSize = iota
+	hFileVersion
+	hPixmapFormat
+	hPixmapDepth
+	hPixmapWidth
+	hPixmapHeight
+	hXOffset
+	hByteOrder
+	hBitmapUnit
+	hBitmapBitOrder
+	hBitmapPad
+	hBitsPerPixel
+	hBytesPerLine
+	hVisualClass
+	hRedMask
+	hGreenMask
+	hBlueMask
+	hBitsPerRGB
+	hColormapEntries
+	hNColors
+)
+
+// Byte and bit orders.
+const (
+	lsbFirst = 0
+	msbFirst = 1
+)
+
+type decoder struct {
+	r             *bufio.Reader
+	order         binary.ByteOrder // of the header and colormap
+	h             [headerLen / 4]uint32
+	width, height int
+	palette       color.Palette
+	limits        *img1b.Limits
+}
+
+func (d *decoder) parseHeader() error {
+	var b [headerLen]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		return err
+	}
+	// xwd writes the header most significant byte first, other writers
+	// may use their native order.
+	d.order = binary.BigEndian
+	if binary.BigEndian.Uint32(b[4:]) != fileVersion {
+		d.order = binary.LittleEndian
+		if binary.LittleEndian.Uint32(b[4:]) != fileVersion {
+			return FormatError("not an XWD file")
+		}
+	}
+	for i := range d.h {
+		d.h[i] = d.order.Uint32(b[i*4:])
+	}
+	h := &d.h
+	if h[hHeaderSize] < headerLen || h[hHeaderSize] > 1<<16 {
+		return FormatError("bad header size")
+	}
+	if h[hPixmapDepth] != 1 || h[hBitsPerPixel] != 1 {
+		return UnsupportedError(fmt.Sprintf("depth %d", h[hPixmapDepth]))
+	}
+	if h[hPixmapFormat] > 2 {
+		return FormatError("bad pixmap format")
+	}
+	if h[hByteOrder] > msbFirst || h[hBitmapBitOrder] > msbFirst {
+		return FormatError("bad byte or bit order")
+	}
+	switch h[hBitmapUnit] {
+	case 8, 16, 32:
+	default:
+		return FormatError("bad bitmap unit")
+	}
+	if h[hPixmapWidth] == 0 || h[hPixmapHeight] == 0 || h[hPixmapWidth] > 1<<24 || h[hPixmapHeight] > 1<<24 {
+		return FormatError("bad image size")
+	}
+	d.width, d.height = int(h[hPixmapWidth]), int(h[hPixmapHeight])
+	bpl := int64(h[hBytesPerLine])
+	if bpl*8 < int64(h[hXOffset])+int64(d.width) || bpl%int64(h[hBitmapUnit]/8) != 0 {
+		return FormatError("bad bytes per line")
+	}
+	if _, err := io.CopyN(ioutil.Discard, d.r, int64(h[hHeaderSize]-headerLen)); err != nil {
+		return err
+	}
+	return d.readColormap()
+}
+
+// readColormap reads the colors and sets the palette.
+func (d *decoder) readColormap() error {
+	n := d.h[hNColors]
+	if n > 1<<16 {
+		return FormatError("bad number of colors")
+	}
+	p := color.Palette{color.White, color.Black}
+	found := 0
+	var c [colorLen]byte
+	for i := uint32(0); i < n; i++ {
+		if _, err := io.ReadFull(d.r, c[:]); err != nil {
+			return err
+		}
+		pixel := d.order.Uint32(c[0:])
+		if pixel > 1 {
+			continue
+		}
+		if found == 0 {
+			p = color.Palette{color.Black, color.White}
+		}
+		found |= 1 << pixel
+		p[pixel] = color.RGBA64{d.order.Uint16(c[4:]), d.order.Uint16(c[6:]), d.order.Uint16(c[8:]), 0xffff}
+	}
+	d.palette = p
+	return nil
+}
+
+// unit reads a scanline unit of n bytes from b.
+func unit(b []byte, n int, order uint32) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		j := i
+		if order == lsbFirst {
+			j = n - 1 - i
+		}
+		v = v<<8 | uint32(b[j])
+	}
+	return v
+}
+
+func (d *decoder) decode() (*img1b.Image, error) {
+	h := &d.h
+	img, err := d.limits.New(image.Rect(0, 0, d.width, d.height), d.palette)
+	if err != nil {
+		return nil, err
+	}
+	bpl := int(h[hBytesPerLine])
+	n := int(h[hBitmapUnit] / 8)
+	xoff := int(h[hXOffset])
+	line := make([]byte, bpl)
+	row := make([]byte, bpl+1)
+	rowBytes := (d.width + 7) / 8
+	tm := bitmap.TailMask(d.width)
+	for y := 0; y < d.height; y++ {
+		if _, err := io.ReadFull(d.r, line); err != nil {
+			return nil, err
+		}
+		// Convert the units to most significant bit first bytes.
+		for i := 0; i < bpl; i += n {
+			v := unit(line[i:], n, h[hByteOrder])
+			if h[hBitmapBitOrder] == lsbFirst {
+				v = bits.Reverse32(v) >> uint(32-8*n)
+			}
+			for j := 0; j < n; j++ {
+				row[i+j] = byte(v >> uint(8*(n-1-j)))
+			}
+		}
+		dst := img.Pix[y*img.Stride : y*img.Stride+rowBytes]
+		src, s := row[xoff/8:], uint(xoff%8)
+		for i := range dst {
+			dst[i] = src[i]<<s | src[i+1]>>(8-s)
+		}
+		dst[rowBytes-1] &= tm
+	}
+	return img, nil
+}
+
+// Decode reads an XWD image from r and returns it as an img1b.Image.
+func Decode(r io.Reader) (*img1b.Image, error) {
+	var d Decoder
+	return d.Decode(r)
+}
+
+// Decode reads an XWD image from r and returns it as an img1b.Image.
+func (dec *Decoder) Decode(r io.Reader) (*img1b.Image, error) {
+	d := &decoder{r: bufio.NewReader(r), limits: dec.Limits}
+	err := d.parseHeader()
+	var img *img1b.Image
+	if err == nil {
+		img, err = d.decode()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DecodeConfig returns the color model and dimensions of an XWD image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	if err := d.parseHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: d.palette,
+		Width:      d.width,
+		Height:     d.height,
+	}, nil
+}
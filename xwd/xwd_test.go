@@ -0,0 +1,185 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xwd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/mi-v/img1b"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const testWidth, testHeight = 21, 3
+
+func testPixel(x, y int) uint32 {
+	if (x*y+x/3)%4 == 1 || x == 20 {
+		return 1
+	}
+	return 0
+}
+
+type dumpParams struct {
+	header    binary.ByteOrder
+	byteOrder uint32
+	bitOrder  uint32
+	unit      uint32
+	xoffset   uint32
+	colors    bool
+}
+
+// dump returns an XWD file of the test image.
+func dump(p dumpParams) []byte {
+	name := "xterm\x00"
+	unitBytes := int(p.unit / 8)
+	bpl := (int(p.xoffset) + testWidth + int(p.unit) - 1) / int(p.unit) * unitBytes
+	h := make([]uint32, headerLen/4)
+	h[hHeaderSize] = uint32(headerLen + len(name))
+	h[hFileVersion] = fileVersion
+	h[hPixmapFormat] = 0
+	h[hPixmapDepth] = 1
+	h[hPixmapWidth] = testWidth
+	h[hPixmapHeight] = testHeight
+	h[hXOffset] = p.xoffset
+	h[hByteOrder] = p.byteOrder
+	h[hBitmapUnit] = p.unit
+	h[hBitmapBitOrder] = p.bitOrder
+	h[hBitmapPad] = p.unit
+	h[hBitsPerPixel] = 1
+	h[hBytesPerLine] = uint32(bpl)
+	var b bytes.Buffer
+	for _, v := range h {
+		binary.Write(&b, p.header, v)
+	}
+	b.WriteString(name)
+	if p.colors {
+		h[hNColors] = 2
+		binary.Write(&b, p.header, []uint32{0})
+		binary.Write(&b, p.header, []uint16{0xffff, 0xffff, 0xffff})
+		b.Write([]byte{7, 0})
+		binary.Write(&b, p.header, []uint32{1})
+		binary.Write(&b, p.header, []uint16{0, 0, 0x8000})
+		b.Write([]byte{7, 0})
+		// Patch the color count.
+		data := b.Bytes()
+		p.header.PutUint32(data[hNColors*4:], 2)
+	}
+	for y := 0; y < testHeight; y++ {
+		line := make([]byte, bpl)
+		for x := 0; x < testWidth; x++ {
+			px := x + int(p.xoffset)
+			u, i := px/int(p.unit), px%int(p.unit)
+			// Bit i of the unit, counted from the first pixel.
+			bit := uint(i)
+			if p.bitOrder == msbFirst {
+				bit = uint(int(p.unit) - 1 - i)
+			}
+			// Byte holding the bit within the unit.
+			j := int(bit / 8)
+			if p.byteOrder == msbFirst {
+				j = unitBytes - 1 - j
+			}
+			line[u*unitBytes+j] |= byte(testPixel(x, y) << (bit % 8))
+		}
+		b.Write(line)
+	}
+	return b.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	var tests []dumpParams
+	for _, header := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		for _, unit := range []uint32{8, 16, 32} {
+			for order := uint32(0); order < 4; order++ {
+				tests = append(tests, dumpParams{header, order & 1, order >> 1, unit, 0, false})
+			}
+		}
+	}
+	tests = append(tests,
+		dumpParams{binary.BigEndian, msbFirst, msbFirst, 32, 5, false},
+		dumpParams{binary.BigEndian, lsbFirst, lsbFirst, 16, 11, true},
+	)
+	for _, tt := range tests {
+		m, err := Decode(bytes.NewReader(dump(tt)))
+		if err != nil {
+			t.Errorf("%+v: %v", tt, err)
+			continue
+		}
+		if m.Bounds().Dx() != testWidth || m.Bounds().Dy() != testHeight {
+			t.Errorf("%+v: got bounds %v", tt, m.Bounds())
+			continue
+		}
+		for y := 0; y < testHeight; y++ {
+			for x := 0; x < testWidth; x++ {
+				if got, want := m.ColorIndexAt(x, y), uint8(testPixel(x, y)); got != want {
+					t.Errorf("%+v: at (%d, %d) got %d, want %d", tt, x, y, got, want)
+				}
+			}
+		}
+		if m.Pix[m.Stride-1]&^0xf8 != 0 {
+			t.Errorf("%+v: padding bits are not clear", tt)
+		}
+		want := color.Palette{color.White, color.Black}
+		if tt.colors {
+			want = color.Palette{color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}, color.RGBA64{0, 0, 0x8000, 0xffff}}
+		}
+		if m.Palette[0] != want[0] || m.Palette[1] != want[1] {
+			t.Errorf("%+v: got palette %v", tt, m.Palette)
+		}
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	cfg, err := DecodeConfig(bytes.NewReader(dump(dumpParams{binary.BigEndian, msbFirst, msbFirst, 8, 0, true})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != testWidth || cfg.Height != testHeight {
+		t.Errorf("got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	p := dumpParams{binary.BigEndian, msbFirst, msbFirst, 8, 0, false}
+	data := dump(p)
+	patch := func(field int, v uint32) []byte {
+		b := append([]byte(nil), data...)
+		binary.BigEndian.PutUint32(b[field*4:], v)
+		return b
+	}
+	for _, tt := range []struct {
+		data []byte
+		err  string
+	}{
+		{nil, "unexpected EOF"},
+		{patch(hFileVersion, 6), "not an XWD file"},
+		{patch(hPixmapDepth, 8), "depth 8"},
+		{patch(hBitmapUnit, 24), "bad bitmap unit"},
+		{patch(hBytesPerLine, 2), "bad bytes per line"},
+		{data[:len(data)-1], "unexpected EOF"},
+	} {
+		m, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got %v, want %s", err, tt.err)
+		}
+		if m != nil {
+			t.Error("have image + error")
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	data := dump(dumpParams{binary.BigEndian, msbFirst, msbFirst, 8, 0, false})
+	d := Decoder{Limits: &img1b.Limits{MaxPixels: testWidth * testHeight}}
+	if _, err := d.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	d.Limits.MaxPixels--
+	_, err := d.Decode(bytes.NewReader(data))
+	if _, ok := err.(img1b.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zpl implements an encoder of images as ZPL II graphics, the label
+// format of Zebra printers.
+//
+// Images are either stored in printer memory by a ~DG Download Graphics
+// command, to be recalled by ^XG in label formats, or placed directly in a
+// label by a ^GF Graphic Field command. The graphic data is hexadecimal or,
+// with the Z64 option, deflate compressed and base64 encoded, which is
+// several times shorter for typical labels. Black pixels are printed as
+// dots.
+package zpl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"github.com/mi-v/img1b/internal/bitmap"
+	"io"
+	"strings"
+)
+
+// A FormatError reports that the image or its name can not be encoded.
+type FormatError string
+
+func (e FormatError) Error() string { return "zpl: invalid format: " + string(e) }
+
+// Options are the encoding parameters.
+type Options struct {
+	// Z64 compresses the graphic data. Printers with firmware older than
+	// V60.13 only accept hexadecimal data.
+	Z64 bool
+}
+
+// rows returns the image rows with black pixels set and clear padding, and
+// the number of bytes per row.
+func rows(m *img1b.Image) ([]byte, int, error) {
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if w <= 0 || h <= 0 {
+		return nil, 0, FormatError(fmt.Sprintf("invalid image size: %dx%d", w, h))
+	}
+	rowBytes := (w + 7) / 8
+	invert := bitmap.BlackIndex(m.Palette) == 0
+	tm := bitmap.TailMask(w)
+	data := make([]byte, rowBytes*h)
+	for y := 0; y < h; y++ {
+		row := data[y*rowBytes : (y+1)*rowBytes]
+		copy(row, m.Pix[y*m.Stride:])
+		if invert {
+			for i := range row {
+				row[i] = ^row[i]
+			}
+		}
+		row[rowBytes-1] &= tm
+	}
+	return data, rowBytes, nil
+}
+
+// writeData writes the graphic data, Z64 encoded or hexadecimal. Hexadecimal
+// data is split in lines of lineBytes, unless it is zero.
+func writeData(bw *bufio.Writer, data []byte, lineBytes int, opt *Options) {
+	if opt != nil && opt.Z64 {
+		var z bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&z, zlib.BestCompression)
+		zw.Write(data)
+		zw.Close()
+		s := base64.StdEncoding.EncodeToString(z.Bytes())
+		fmt.Fprintf(bw, ":Z64:%s:%04X", s, crc16([]byte(s)))
+		return
+	}
+	const digits = "0123456789ABCDEF"
+	for i, b := range data {
+		if lineBytes > 0 && i > 0 && i%lineBytes == 0 {
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte(digits[b>>4])
+		bw.WriteByte(digits[b&15])
+	}
+}
+
+// crc16 returns the CRC-16/XMODEM checksum of Z64 data.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// EncodeDG writes the image m to w as a ~DG command storing a graphic under
+// the given name, such as "R:LOGO.GRF". The printer defaults a missing
+// device to R:, the RAM, and a missing extension to .GRF. Hexadecimal data
+// is written with a line per row.
+func EncodeDG(w io.Writer, name string, m *img1b.Image, opt *Options) error {
+	if name == "" || strings.ContainsAny(name, "^~,\n") {
+		return FormatError(fmt.Sprintf("invalid graphic name %q", name))
+	}
+	data, rowBytes, err := rows(m)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "~DG%s,%d,%d,", name, len(data), rowBytes)
+	writeData(bw, data, rowBytes, opt)
+	bw.WriteByte('\n')
+	return bw.Flush()
+}
+
+// EncodeGF writes the image m to w as a ^GF command ending with ^FS, which
+// prints it at the current field origin of a label format.
+func EncodeGF(w io.Writer, m *img1b.Image, opt *Options) error {
+	data, rowBytes, err := rows(m)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "^GFA,%d,%d,%d,", len(data), len(data), rowBytes)
+	writeData(bw, data, 0, opt)
+	bw.WriteString("^FS\n")
+	return bw.Flush()
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Mikhail Vladimirov
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zpl
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/mi-v/img1b"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func testImage(w, h int, p color.Palette) *img1b.Image {
+	m := img1b.New(image.Rect(0, 0, w, h), p)
+	r := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x%11 < 4 || r.Intn(7) == 0 {
+				m.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return m
+}
+
+// graphicData decodes hexadecimal or Z64 graphic data.
+func graphicData(t *testing.T, s string) []byte {
+	t.Helper()
+	if !strings.HasPrefix(s, ":Z64:") {
+		data, err := hex.DecodeString(strings.Replace(s, "\n", "", -1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	f := strings.Split(s[5:], ":")
+	if len(f) != 2 {
+		t.Fatalf("bad Z64 data %q", s)
+	}
+	if crc := fmt.Sprintf("%04X", crc16([]byte(f[0]))); crc != f[1] {
+		t.Fatalf("got CRC %s, want %s", f[1], crc)
+	}
+	z, err := base64.StdEncoding.DecodeString(f[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(z))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func checkData(t *testing.T, m *img1b.Image, data []byte, rowBytes int) {
+	t.Helper()
+	w, h := m.Rect.Dx(), m.Rect.Dy()
+	if rowBytes != (w+7)/8 || len(data) != rowBytes*h {
+		t.Fatalf("got %d bytes, %d per row", len(data), rowBytes)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < rowBytes*8; x++ {
+			dot := data[y*rowBytes+x/8]>>uint(7-x%8)&1 == 1
+			if black := x < w && m.At(x, y) == color.Black; dot != black {
+				t.Fatalf("at (%d, %d) got dot %v", x, y, dot)
+			}
+		}
+	}
+}
+
+var encodeTests = []struct {
+	w, h    int
+	palette color.Palette
+	opt     *Options
+}{
+	{16, 4, color.Palette{color.White, color.Black}, nil},
+	{13, 9, color.Palette{color.Black, color.White}, &Options{}},
+	{203, 100, color.Palette{color.White, color.Black}, &Options{Z64: true}},
+	{5, 1, color.Palette{color.Black, color.White}, &Options{Z64: true}},
+}
+
+func TestEncodeDG(t *testing.T) {
+	for i, tt := range encodeTests {
+		m := testImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := EncodeDG(&b, "R:TEST.GRF", m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		s := b.String()
+		if !strings.HasPrefix(s, "~DGR:TEST.GRF,") || !strings.HasSuffix(s, "\n") {
+			t.Fatalf("%d: bad command %q", i, s)
+		}
+		f := strings.SplitN(strings.TrimSuffix(s, "\n"), ",", 4)
+		total, _ := strconv.Atoi(f[1])
+		rowBytes, _ := strconv.Atoi(f[2])
+		data := graphicData(t, f[3])
+		if total != len(data) {
+			t.Errorf("%d: got total %d, want %d", i, total, len(data))
+		}
+		checkData(t, m, data, rowBytes)
+	}
+	for _, name := range []string{"", "R:A,B.GRF", "^XA"} {
+		if err := EncodeDG(new(bytes.Buffer), name, testImage(8, 8, nil), nil); err == nil {
+			t.Errorf("name %q accepted", name)
+		}
+	}
+}
+
+func TestEncodeGF(t *testing.T) {
+	for i, tt := range encodeTests {
+		m := testImage(tt.w, tt.h, tt.palette)
+		var b bytes.Buffer
+		if err := EncodeGF(&b, m, tt.opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		s := b.String()
+		if !strings.HasPrefix(s, "^GFA,") || !strings.HasSuffix(s, "^FS\n") || strings.Count(s, "\n") != 1 {
+			t.Fatalf("%d: bad command %q", i, s)
+		}
+		f := strings.SplitN(strings.TrimSuffix(s[5:], "^FS\n"), ",", 4)
+		rowBytes, _ := strconv.Atoi(f[2])
+		data := graphicData(t, f[3])
+		if f[0] != strconv.Itoa(len(data)) || f[1] != f[0] {
+			t.Errorf("%d: got byte counts %s, %s, want %d", i, f[0], f[1], len(data))
+		}
+		checkData(t, m, data, rowBytes)
+	}
+	if err := EncodeGF(new(bytes.Buffer), img1b.New(image.Rect(0, 0, 0, 3), nil), nil); err == nil {
+		t.Error("empty image accepted")
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	if crc := crc16([]byte("123456789")); crc != 0x31c3 {
+		t.Errorf("got %04x, want 31c3", crc)
+	}
+}